@@ -0,0 +1,238 @@
+package capstone
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// maxBodyBytes caps request bodies so one client can't exhaust memory
+const maxBodyBytes = 1 << 20
+
+// routes is the service's HTTP surface
+func (a *App) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", a.handleLivez)
+	mux.HandleFunc("/readyz", a.handleReadyz)
+	mux.HandleFunc("/api/users", a.handleUsers)
+	mux.HandleFunc("/api/users/", a.handleUser)
+	mux.HandleFunc("/api/stats", a.handleStats)
+	return a.recoverMiddleware(a.loggingMiddleware(mux))
+}
+
+// /api/users
+func (a *App) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := a.store.List(r.Context())
+		if err != nil {
+			a.respondWithStoreError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, domain.APIResponse{Success: true, Data: users})
+	case http.MethodPost:
+		var req domain.CreateUserRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if problems := req.Validate(); len(problems) > 0 {
+			respondWithValidationErrors(w, problems)
+			return
+		}
+		user, err := a.store.Create(r.Context(), domain.User{Name: req.Name, Email: req.Email, Age: req.Age})
+		if err != nil {
+			a.respondWithStoreError(w, err)
+			return
+		}
+		a.publish(UserCreated, user)
+		w.Header().Set("Location", "/api/users/"+strconv.Itoa(user.ID))
+		respondWithJSON(w, http.StatusCreated, domain.APIResponse{Success: true, Data: user, Message: "User created successfully"})
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// /api/users/{id}
+func (a *App) handleUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/users/"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := a.store.Get(r.Context(), id)
+		if err != nil {
+			a.respondWithStoreError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, domain.APIResponse{Success: true, Data: user})
+	case http.MethodPut:
+		var req domain.UpdateUserRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		user, err := a.store.Get(r.Context(), id)
+		if err != nil {
+			a.respondWithStoreError(w, err)
+			return
+		}
+		req.Apply(&user)
+		check := domain.CreateUserRequest{Name: user.Name, Email: user.Email, Age: user.Age}
+		if problems := check.Validate(); len(problems) > 0 {
+			respondWithValidationErrors(w, problems)
+			return
+		}
+		if user, err = a.store.Update(r.Context(), user); err != nil {
+			a.respondWithStoreError(w, err)
+			return
+		}
+		a.publish(UserUpdated, user)
+		respondWithJSON(w, http.StatusOK, domain.APIResponse{Success: true, Data: user, Message: "User updated successfully"})
+	case http.MethodDelete:
+		user, err := a.store.Get(r.Context(), id)
+		if err == nil {
+			err = a.store.Delete(r.Context(), id)
+		}
+		if err != nil {
+			a.respondWithStoreError(w, err)
+			return
+		}
+		a.publish(UserDeleted, user)
+		respondWithJSON(w, http.StatusOK, domain.APIResponse{Success: true, Message: "User deleted successfully"})
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Stats is the body of GET /api/stats: what the workers have done so far
+type Stats struct {
+	Users         int            `json:"users"`
+	Events        map[string]int `json:"events"`
+	EmailsSent    int            `json:"emails_sent"`
+	EventsDropped int            `json:"events_dropped"`
+}
+
+// GET /api/stats
+func (a *App) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	users, err := a.store.List(r.Context())
+	if err != nil {
+		a.respondWithStoreError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Stats{
+		Users:         len(users),
+		Events:        a.activity.Counts(),
+		EmailsSent:    len(a.mailer.Sent()),
+		EventsDropped: a.broker.Dropped(),
+	})
+}
+
+// GET /livez - the process is up and serving
+func (a *App) handleLivez(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// GET /readyz - send traffic here: not shutting down, and the store answers
+func (a *App) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if a.shuttingDown.Load() {
+		respondWithJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+		return
+	}
+	if err := a.store.Ping(r.Context()); err != nil {
+		respondWithJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "store unavailable", "error": err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// publish tells the workers about a change once it is stored
+func (a *App) publish(eventType string, user domain.User) {
+	a.broker.Publish(Event{Type: eventType, User: user, At: time.Now()})
+}
+
+// respondWithStoreError maps the store's errors to status codes, and logs
+// anything unexpected rather than showing it to the client
+func (a *App) respondWithStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		respondWithError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, ErrDuplicateEmail):
+		respondWithError(w, http.StatusConflict, "Email already in use")
+	default:
+		a.logger.Error("store failed", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// decodeJSON reads a JSON body into v, answering 400 itself if it can't
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return false
+	}
+	return true
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		// The status is already sent, so all that's left is to log it
+		slog.Error("encoding response", "error", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, domain.ErrorResponse{Error: message})
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, problems []domain.ValidationError) {
+	respondWithJSON(w, http.StatusBadRequest, domain.ErrorResponse{Error: "Validation failed", Details: problems})
+}
+
+// statusRecorder remembers the status a handler sent, for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// loggingMiddleware writes one structured line per request
+func (a *App) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		a.logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start))
+	})
+}
+
+// recoverMiddleware turns a panicking handler into a 500 instead of a
+// dropped connection, as lesson 7's SafeCall does for plain functions
+func (a *App) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				a.logger.Error("handler panicked", "path", r.URL.Path, "panic", err)
+				respondWithError(w, http.StatusInternalServerError, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
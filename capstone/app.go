@@ -0,0 +1,114 @@
+package capstone
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// App is the whole service: a store, the HTTP API in front of it, and
+// background workers that hear about every change through the broker
+type App struct {
+	cfg      Config
+	logger   *slog.Logger
+	store    UserStore
+	broker   *Broker
+	mailer   *Mailer
+	activity *Activity
+
+	shuttingDown atomic.Bool
+}
+
+// New wires an App together. Nothing runs until Serve.
+func New(cfg Config, logger *slog.Logger, store UserStore) *App {
+	return &App{
+		cfg:      cfg,
+		logger:   logger,
+		store:    store,
+		broker:   NewBroker(),
+		mailer:   &Mailer{Delay: 50 * time.Millisecond},
+		activity: NewActivity(),
+	}
+}
+
+// Handler is the API, for tests that want it without a listener
+func (a *App) Handler() http.Handler {
+	return a.routes()
+}
+
+// Sent returns the emails the mailer has sent
+func (a *App) Sent() []Email {
+	return a.mailer.Sent()
+}
+
+// Serve runs the API on ln and the workers alongside it until ctx is
+// cancelled, then shuts down in order:
+//
+//  1. fail /readyz, so a load balancer stops sending new requests
+//  2. stop accepting connections and finish the requests in flight
+//  3. close the broker, so workers see no new events
+//  4. wait for workers to handle what is already queued
+//
+// Steps 2 to 4 share cfg.ShutdownTimeout; work left after it is abandoned.
+func (a *App) Serve(ctx context.Context, ln net.Listener) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	for _, w := range []Worker{a.mailer.Worker(a.cfg.Workers), a.activity.Worker()} {
+		startWorker(workerCtx, a.logger, a.broker, w, &workers)
+	}
+
+	server := &http.Server{
+		Handler:           a.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ErrorLog:          slog.NewLogLogger(a.logger.Handler(), slog.LevelWarn),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(ln)
+	}()
+	a.logger.Info("serving", "addr", ln.Addr().String(), "workers", a.cfg.Workers)
+
+	select {
+	case err := <-serverErr:
+		a.broker.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	a.shuttingDown.Store(true)
+	a.logger.Info("shutting down", "timeout", a.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+
+	a.broker.Close()
+	drained := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		stopWorkers()
+		<-drained
+		errs = append(errs, errors.New("workers didn't finish in time"))
+	}
+
+	a.logger.Info("shutdown complete")
+	return errors.Join(errs...)
+}
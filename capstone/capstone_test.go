@@ -0,0 +1,230 @@
+package capstone
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang-lab/lab/fixtures"
+	"golang-lab/lab/golden"
+)
+
+// startApp serves a fresh App on a free port until the test ends, and
+// returns its base URL and a function that shuts it down and returns
+// Serve's error
+func startApp(t *testing.T, cfg Config) (*App, string, func() error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), NewMemoryStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Serve(ctx, ln)
+	}()
+	var once sync.Once
+	var serveErr error
+	stop := func() error {
+		once.Do(func() {
+			cancel()
+			select {
+			case serveErr = <-done:
+			case <-time.After(5 * time.Second):
+				serveErr = errors.New("Serve didn't return after shutdown")
+			}
+		})
+		return serveErr
+	}
+	// Tests that care about Serve's error call stop themselves
+	t.Cleanup(func() { stop() })
+	return app, "http://" + ln.Addr().String(), stop
+}
+
+func testConfig() Config {
+	return Config{Workers: 2, ShutdownTimeout: 2 * time.Second}
+}
+
+// TestAPI sends a fixed script of requests to a running service and
+// compares the responses with testdata/api.golden, then checks that the
+// workers caught up with what the requests did
+func TestAPI(t *testing.T) {
+	app, baseURL, _ := startApp(t, testConfig())
+	app.mailer.Delay = time.Millisecond
+
+	requests := []struct{ method, target, body string }{
+		{"GET", "/readyz", ""},
+		{"POST", "/api/users", `{"name":"Ada","email":"ada@example.com","age":36}`},
+		{"POST", "/api/users", `{"name":"Grace","email":"grace@example.com","age":45}`},
+		{"POST", "/api/users", `{"name":"Imposter","email":"ada@example.com","age":20}`},
+		{"POST", "/api/users", `{"name":"","email":"nobody","age":200}`},
+		{"POST", "/api/users", `{"name":`},
+		{"GET", "/api/users", ""},
+		{"PUT", "/api/users/2", `{"age":46}`},
+		{"PUT", "/api/users/2", `{"email":"ada@example.com"}`},
+		{"DELETE", "/api/users/1", ""},
+		{"GET", "/api/users/1", ""},
+		{"GET", "/api/users/abc", ""},
+		{"PATCH", "/api/users", ""},
+	}
+
+	var transcript strings.Builder
+	for _, req := range requests {
+		r, err := http.NewRequest(req.method, baseURL+req.target, strings.NewReader(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(&transcript, "%s\n%d", strings.TrimSpace(req.method+" "+req.target+" "+req.body), resp.StatusCode)
+		if location := resp.Header.Get("Location"); location != "" {
+			fmt.Fprintf(&transcript, " Location: %s", location)
+		}
+		fmt.Fprintf(&transcript, "\n%s\n\n", strings.TrimSpace(string(body)))
+	}
+	golden.Check(t, "api.golden", transcript.String(), golden.Timestamps)
+
+	// The workers run behind the API, so give them a moment
+	want := Stats{Users: 1, Events: map[string]int{UserCreated: 2, UserUpdated: 1, UserDeleted: 1}, EmailsSent: 2}
+	var got Stats
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(baseURL + "/api/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = Stats{}
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) == fmt.Sprint(want) {
+			return
+		}
+	}
+	t.Errorf("stats = %+v, want %+v", got, want)
+}
+
+// TestShutdownDrainsWorkers checks that events queued before shutdown are
+// still handled: a user created just before Ctrl+C still gets an email
+func TestShutdownDrainsWorkers(t *testing.T) {
+	app, baseURL, stop := startApp(t, testConfig())
+
+	resp, err := http.Post(baseURL+"/api/users", "application/json", strings.NewReader(`{"name":"Ada","email":"ada@example.com","age":36}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if err := stop(); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if sent := app.Sent(); len(sent) != 1 || sent[0].To != "ada@example.com" {
+		t.Errorf("sent = %+v, want one welcome email to ada@example.com", sent)
+	}
+	if _, err := http.Get(baseURL + "/livez"); err == nil {
+		t.Error("server still accepting requests after shutdown")
+	}
+}
+
+// TestShutdownTimeout checks that a stuck worker can't hold shutdown up
+// for longer than ShutdownTimeout
+func TestShutdownTimeout(t *testing.T) {
+	cfg := testConfig()
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+	app, baseURL, stop := startApp(t, cfg)
+	app.mailer.Delay = time.Hour
+
+	resp, err := http.Post(baseURL+"/api/users", "application/json", strings.NewReader(`{"name":"Ada","email":"ada@example.com","age":36}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	start := time.Now()
+	err = stop()
+	if err == nil || !strings.Contains(err.Error(), "workers didn't finish") {
+		t.Errorf("Serve = %v, want the workers to time out", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown took %v", elapsed)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: "port=8080 level=INFO format=text workers=2 timeout=10s version=dev",
+		},
+		{
+			name: "everything set",
+			env:  map[string]string{"PORT": "9000", "LOG_LEVEL": "debug", "LOG_FORMAT": "json", "WORKERS": "4", "SHUTDOWN_TIMEOUT": "3s", "APP_VERSION": "1.2.3"},
+			want: "port=9000 level=DEBUG format=json workers=4 timeout=3s version=1.2.3",
+		},
+		{
+			name:    "every problem at once",
+			env:     map[string]string{"PORT": "http", "WORKERS": "0", "LOG_FORMAT": "xml"},
+			wantErr: "invalid configuration:\n  PORT must be a number between 0 and 65535, got \"http\"\n  LOG_FORMAT must be json or text, got \"xml\"\n  WORKERS must be a positive number, got \"0\"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg, err := LoadConfig(func(key string) string { return tt.env[key] })
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := fmt.Sprintf("port=%d level=%s format=%s workers=%d timeout=%s version=%s", cfg.Port, cfg.LogLevel, cfg.LogFormat, cfg.Workers, cfg.ShutdownTimeout, cfg.Version)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkListUsers lists a store holding lab/fixtures' Medium set of
+// users, the size of a page-through-it demo
+func BenchmarkListUsers(b *testing.B) {
+	store := NewMemoryStore()
+	if _, err := fixtures.Load(context.Background(), store, fixtures.Users(fixtures.Medium)); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.List(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
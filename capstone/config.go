@@ -0,0 +1,101 @@
+package capstone
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the service needs. Like lesson 13, it comes
+// from the environment so the same binary runs locally and in a container.
+type Config struct {
+	Port            int
+	LogLevel        slog.Level
+	LogFormat       string
+	Workers         int
+	ShutdownTimeout time.Duration
+	Version         string
+}
+
+// LoadConfig reads Config with getenv, which is os.Getenv outside of
+// tests. Every problem is reported at once rather than one per restart.
+func LoadConfig(getenv func(string) string) (Config, error) {
+	cfg := Config{
+		Port:            8080,
+		LogFormat:       "text",
+		Workers:         2,
+		ShutdownTimeout: 10 * time.Second,
+		Version:         "dev",
+	}
+	var problems []string
+
+	if raw := getenv("PORT"); raw != "" {
+		port, err := strconv.Atoi(raw)
+		if err != nil || port < 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("PORT must be a number between 0 and 65535, got %q", raw))
+		} else {
+			cfg.Port = port
+		}
+	}
+
+	if raw := getenv("LOG_LEVEL"); raw != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(raw)); err != nil {
+			problems = append(problems, fmt.Sprintf("LOG_LEVEL: %v", err))
+		}
+	}
+
+	if raw := getenv("LOG_FORMAT"); raw != "" {
+		if raw != "json" && raw != "text" {
+			problems = append(problems, fmt.Sprintf("LOG_FORMAT must be json or text, got %q", raw))
+		}
+		cfg.LogFormat = raw
+	}
+
+	if raw := getenv("WORKERS"); raw != "" {
+		workers, err := strconv.Atoi(raw)
+		if err != nil || workers < 1 {
+			problems = append(problems, fmt.Sprintf("WORKERS must be a positive number, got %q", raw))
+		} else {
+			cfg.Workers = workers
+		}
+	}
+
+	if raw := getenv("SHUTDOWN_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("SHUTDOWN_TIMEOUT must be a positive duration, got %q", raw))
+		} else {
+			cfg.ShutdownTimeout = timeout
+		}
+	}
+
+	if raw := getenv("APP_VERSION"); raw != "" {
+		cfg.Version = raw
+	}
+
+	if len(problems) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return cfg, nil
+}
+
+// Addr is the listen address, on every interface
+func (c Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// NewLogger returns a structured logger writing to w in the configured
+// format, tagged with the service version
+func NewLogger(w io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	var handler slog.Handler
+	if cfg.LogFormat == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(handler).With("version", cfg.Version)
+}
@@ -0,0 +1,102 @@
+package capstone
+
+import (
+	"sync"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// Event types published by the API
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+// Event is one change to the user store
+type Event struct {
+	Type string      `json:"type"`
+	User domain.User `json:"user"`
+	At   time.Time   `json:"at"`
+}
+
+// Broker is an in-process publish/subscribe hub, the same idea as lesson
+// 15's chat hub without the WebSockets. Publishing never blocks: a
+// subscriber that falls behind by more than its buffer misses events
+// rather than stalling the HTTP handler that published them.
+type Broker struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	closed  bool
+	dropped int
+}
+
+// NewBroker returns a broker with no subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of every event published from now on, and
+// a function that unsubscribes and closes the channel. The channel is
+// also closed when the broker is.
+func (b *Broker) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish delivers event to every subscriber with room for it
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			b.dropped++
+		}
+	}
+}
+
+// Dropped is how many deliveries were skipped because a subscriber was full
+func (b *Broker) Dropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Close closes every subscriber's channel, which is how workers learn
+// there will be no more events. Events already buffered are still
+// delivered.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,53 @@
+// Capstone: User Service
+// This project puts the lessons together into one service: the shared
+// domain types, a store behind an interface, a JSON API with middleware,
+// background workers fed by pub/sub, environment config, structured logs
+// and graceful shutdown
+
+package capstone
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Run is the project's entry point; cmd/capstone calls it
+func Run() {
+	cfg, err := LoadConfig(os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger := NewLogger(os.Stderr, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", cfg.Addr())
+	if err != nil {
+		logger.Error("listen failed", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("User service listening on http://localhost:%d\n", ln.Addr().(*net.TCPAddr).Port)
+	fmt.Println("Available endpoints:")
+	fmt.Println("  GET    /api/users       - List users")
+	fmt.Println("  POST   /api/users       - Create a user (the mailer sends a welcome email)")
+	fmt.Println("  GET    /api/users/{id}  - Get a user")
+	fmt.Println("  PUT    /api/users/{id}  - Update some of a user's fields")
+	fmt.Println("  DELETE /api/users/{id}  - Delete a user")
+	fmt.Println("  GET    /api/stats       - What the background workers have done")
+	fmt.Println("  GET    /livez, /readyz  - Health probes")
+	fmt.Println("\nPress Ctrl+C to watch the shutdown sequence")
+
+	app := New(cfg, logger, NewMemoryStore())
+	if err := app.Serve(ctx, ln); err != nil {
+		logger.Error("server stopped with error", "error", err)
+		stop()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,200 @@
+//go:build soak
+
+package capstone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/soak"
+)
+
+// Soak tests for the broker and the workers it feeds; run them with
+// go run ./cmd/golab soak ./capstone
+
+// soakSubscriber drains one subscription, counting what arrives and
+// checking each publisher's events arrive in the order it sent them
+type soakSubscriber struct {
+	events      <-chan Event
+	unsubscribe func()
+	received    atomic.Int64
+	done        chan struct{}
+	err         error // set before done is closed
+}
+
+func startSoakSubscriber(b *Broker, buffer int, slow bool, seed int64) *soakSubscriber {
+	events, unsubscribe := b.Subscribe(buffer)
+	s := &soakSubscriber{events: events, unsubscribe: unsubscribe, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		rng := rand.New(rand.NewSource(seed))
+		last := make(map[string]int) // publisher -> last sequence number seen
+		for event := range s.events {
+			if seq := event.User.ID; seq <= last[event.Type] {
+				s.err = fmt.Errorf("publisher %s's event %d arrived after %d", event.Type, seq, last[event.Type])
+			} else {
+				last[event.Type] = seq
+			}
+			s.received.Add(1)
+			// A slow subscriber falls behind, so its buffer fills and the
+			// broker drops events for it
+			if slow {
+				time.Sleep(time.Duration(rng.Intn(200)) * time.Microsecond)
+			}
+		}
+	}()
+	return s
+}
+
+// TestSoakBroker publishes from many goroutines while subscribers come
+// and go. Publish never blocks, so events can be dropped; none may be
+// lost: every delivery is received or counted in Dropped.
+func TestSoakBroker(t *testing.T) {
+	b := NewBroker()
+	var (
+		all      []*soakSubscriber // every subscriber there has been
+		current  []*soakSubscriber // the ones still subscribed
+		attempts atomic.Int64      // deliveries Publish should have tried
+		seqs     [8]int            // each publisher's last sequence number
+	)
+	subscribe := func(rng *rand.Rand) {
+		s := startSoakSubscriber(b, rng.Intn(16), rng.Intn(2) == 0, rng.Int63())
+		all = append(all, s)
+		current = append(current, s)
+	}
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 3; i++ {
+		subscribe(rng)
+	}
+
+	soak.Run(t, soak.MustConfig(t), soak.Target{
+		Workers: len(seqs),
+		Step: func(worker int, rng *rand.Rand) {
+			// Subscribers only change while the steps are paused, so
+			// current is the same for every Publish in this step
+			for n := rng.Intn(5) + 1; n > 0; n-- {
+				seqs[worker]++
+				b.Publish(Event{Type: strconv.Itoa(worker), User: domain.User{ID: seqs[worker]}})
+				attempts.Add(int64(len(current)))
+				soak.Jitter(rng)
+			}
+		},
+		Check: func() error {
+			var received int64
+			for _, s := range all {
+				received += s.received.Load()
+			}
+			if got := received + int64(b.Dropped()); got != attempts.Load() {
+				return fmt.Errorf("%d deliveries tried, but %d received and %d dropped", attempts.Load(), received, b.Dropped())
+			}
+			return nil
+		},
+		Reshuffle: func(rng *rand.Rand) {
+			if len(current) > 1 && rng.Intn(3) == 0 {
+				i := rng.Intn(len(current))
+				current[i].unsubscribe()
+				current = append(current[:i], current[i+1:]...)
+			}
+			if len(current) < 6 && rng.Intn(3) == 0 {
+				subscribe(rng)
+			}
+		},
+	})
+
+	// Closing the broker ends every subscription, and publishing after
+	// that is a no-op
+	b.Close()
+	b.Publish(Event{Type: "late"})
+	for _, s := range all {
+		select {
+		case <-s.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("a subscriber's channel wasn't closed with the broker")
+		}
+		if s.err != nil {
+			t.Error(s.err)
+		}
+	}
+	if events, _ := b.Subscribe(1); !isClosed(events) {
+		t.Error("Subscribe after Close returned an open channel")
+	}
+}
+
+func isClosed(events <-chan Event) bool {
+	_, ok := <-events
+	return !ok
+}
+
+// TestSoakWorkers runs the worker pools the App starts: a counting worker
+// with several goroutines, some of whose events fail, and the Activity
+// worker. Every event delivered to a worker must be handled exactly once,
+// and the workers must all stop once the broker closes.
+func TestSoakWorkers(t *testing.T) {
+	b := NewBroker()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled, failed atomic.Int64
+	counter := Worker{Name: "counter", Concurrency: 4, Handle: func(ctx context.Context, event Event) error {
+		handled.Add(1)
+		if event.User.ID%10 == 0 {
+			failed.Add(1)
+			return errors.New("every tenth event fails")
+		}
+		return nil
+	}}
+	activity := NewActivity()
+	var wg sync.WaitGroup
+	startWorker(ctx, logger, b, counter, &wg)
+	startWorker(ctx, logger, b, activity.Worker(), &wg)
+
+	types := []string{UserCreated, UserUpdated, UserDeleted}
+	var published atomic.Int64
+	soak.Run(t, soak.MustConfig(t), soak.Target{
+		Workers: 8,
+		Step: func(worker int, rng *rand.Rand) {
+			id := int(published.Add(1))
+			b.Publish(Event{Type: types[rng.Intn(len(types))], User: domain.User{ID: id}})
+			soak.Jitter(rng)
+		},
+		Check: func() error {
+			counted := 0
+			for _, n := range activity.Counts() {
+				counted += n
+			}
+			// Two subscriptions, so two deliveries per event
+			want := 2 * published.Load()
+			if got := handled.Load() + int64(counted) + int64(b.Dropped()); got != want {
+				return fmt.Errorf("%d deliveries, but %d handled by the counter, %d by Activity and %d dropped",
+					want, handled.Load(), counted, b.Dropped())
+			}
+			if failed.Load() > handled.Load() {
+				return fmt.Errorf("%d failures out of %d events", failed.Load(), handled.Load())
+			}
+			return nil
+		},
+	})
+
+	b.Close()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the workers didn't stop after the broker closed")
+	}
+}
@@ -0,0 +1,124 @@
+package capstone
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// Errors returned by every UserStore implementation
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrDuplicateEmail = errors.New("email already in use")
+)
+
+// UserStore is a smaller cousin of lesson 10's store.UserStore, over the
+// shared domain.User. The service only ever talks to this, so a MongoDB
+// store could replace the memory one without touching the handlers.
+type UserStore interface {
+	Get(ctx context.Context, id int) (domain.User, error)
+	List(ctx context.Context) ([]domain.User, error)
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+	Update(ctx context.Context, user domain.User) (domain.User, error)
+	Delete(ctx context.Context, id int) error
+	Ping(ctx context.Context) error
+}
+
+// MemoryStore keeps users in a map guarded by a mutex
+type MemoryStore struct {
+	mu     sync.RWMutex
+	users  map[int]domain.User
+	nextID int
+	now    func() time.Time
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[int]domain.User), nextID: 1, now: time.Now}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id int) (domain.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return domain.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]domain.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]domain.User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(user.Email, 0) {
+		return domain.User{}, ErrDuplicateEmail
+	}
+	user.ID = s.nextID
+	s.nextID++
+	user.CreatedAt = s.now()
+	user.UpdatedAt = user.CreatedAt
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, user domain.User) (domain.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[user.ID]
+	if !ok {
+		return domain.User{}, ErrUserNotFound
+	}
+	if s.emailTaken(user.Email, user.ID) {
+		return domain.User{}, ErrDuplicateEmail
+	}
+	user.CreatedAt = existing.CreatedAt
+	user.UpdatedAt = s.now()
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// Ping always succeeds; a database-backed store would make a round trip
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// emailTaken reports whether a user other than id has email. The caller
+// holds the lock.
+func (s *MemoryStore) emailTaken(email string, id int) bool {
+	for _, user := range s.users {
+		if user.ID != id && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package capstone
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Worker handles events in the background, away from the request that
+// caused them. Concurrency goroutines share one subscription, lesson 8's
+// worker pool fed by the broker instead of a slice of jobs.
+type Worker struct {
+	Name        string
+	Concurrency int
+	Handle      func(ctx context.Context, event Event) error
+}
+
+// startWorker subscribes w to broker and starts its goroutines. They stop
+// once the broker closes and the events already queued are handled, or
+// when ctx is cancelled.
+func startWorker(ctx context.Context, logger *slog.Logger, broker *Broker, w Worker, wg *sync.WaitGroup) {
+	events, _ := broker.Subscribe(64)
+	logger = logger.With("worker", w.Name)
+	for i := 0; i < max(w.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+					if err := w.Handle(ctx, event); err != nil {
+						logger.Error("event failed", "event", event.Type, "user_id", event.User.ID, "error", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Email is a message the mailer has sent
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+// Mailer welcomes new users. Sending is simulated with a delay, which is
+// the point: nobody wants POST /api/users to wait for an SMTP server.
+type Mailer struct {
+	Delay time.Duration
+
+	mu   sync.Mutex
+	sent []Email
+}
+
+// Worker returns the mailer as a worker with the given concurrency
+func (m *Mailer) Worker(concurrency int) Worker {
+	return Worker{Name: "mailer", Concurrency: concurrency, Handle: m.handle}
+}
+
+func (m *Mailer) handle(ctx context.Context, event Event) error {
+	if event.Type != UserCreated {
+		return nil
+	}
+	select {
+	case <-time.After(m.Delay):
+	case <-ctx.Done():
+		return fmt.Errorf("welcome email to %s: %w", event.User.Email, ctx.Err())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, Email{To: event.User.Email, Subject: "Welcome, " + event.User.Name})
+	return nil
+}
+
+// Sent returns a copy of every email sent so far
+func (m *Mailer) Sent() []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Email(nil), m.sent...)
+}
+
+// Activity counts events by type, for GET /api/stats
+type Activity struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewActivity returns an empty counter
+func NewActivity() *Activity {
+	return &Activity{counts: make(map[string]int)}
+}
+
+// Worker returns the counter as a single worker, so counts need no
+// ordering between goroutines
+func (a *Activity) Worker() Worker {
+	return Worker{Name: "activity", Concurrency: 1, Handle: a.handle}
+}
+
+func (a *Activity) handle(ctx context.Context, event Event) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts[event.Type]++
+	return nil
+}
+
+// Counts returns a copy of the counts so far
+func (a *Activity) Counts() map[string]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counts := make(map[string]int, len(a.counts))
+	for eventType, n := range a.counts {
+		counts[eventType] = n
+	}
+	return counts
+}
@@ -0,0 +1,9 @@
+// Command capstone runs the capstone project, a user service built from
+// the lessons.
+package main
+
+import "golang-lab/capstone"
+
+func main() {
+	capstone.Run()
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverBlock is one line of a coverage profile: a range of source and how
+// often the tests ran it
+type coverBlock struct {
+	statements int
+	count      int
+}
+
+// coverProfile is a parsed go test -coverprofile file, or several merged.
+// Blocks are keyed by "file:start,end" exactly as the profile spells them.
+type coverProfile struct {
+	mode   string
+	blocks map[string]coverBlock
+}
+
+// runCoverage implements golab coverage
+func runCoverage(args []string) error {
+	flags := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	htmlFile := flags.String("html", "", "also write an HTML report with every lesson's source to this file")
+	profileFile := flags.String("o", "", "also write the merged coverage profile to this file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: golab coverage [-html coverage.html] [-o coverage.out] [lesson...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	selected := lessons
+	if flags.NArg() > 0 {
+		selected = nil
+		for _, name := range flags.Args() {
+			lesson, err := findLesson(lessons, name)
+			if err != nil {
+				return err
+			}
+			selected = append(selected, lesson)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "golab-coverage-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	merged := &coverProfile{blocks: make(map[string]coverBlock)}
+	failed := false
+	fmt.Printf("%-6s  %-40s  %8s  %s\n", "Lesson", "Title", "Coverage", "Minimum")
+	for _, lesson := range selected {
+		profile, err := lessonCoverage(root, dir, lesson)
+		if err != nil {
+			fmt.Printf("%-6s  %-40s  %s\n", fmt.Sprintf("%02d", lesson.Number), truncate(lesson.Title, 40), "tests failed:")
+			for _, line := range outputLines(err.Error()) {
+				fmt.Printf("          %s\n", line)
+			}
+			failed = true
+			continue
+		}
+		if err := merged.merge(profile); err != nil {
+			return err
+		}
+
+		percent := profile.percent()
+		minimum, verdict := "", ""
+		if want := lesson.MinCoverage.Lesson; want > 0 {
+			minimum = fmt.Sprintf("%.0f%%", want)
+			if percent < want {
+				verdict = "  BELOW MINIMUM"
+				failed = true
+			}
+		}
+		fmt.Printf("%-6s  %-40s  %7.1f%%  %s%s\n", fmt.Sprintf("%02d", lesson.Number), truncate(lesson.Title, 40), percent, minimum, verdict)
+	}
+	fmt.Printf("%-6s  %-40s  %7.1f%%\n", "Total", "", merged.percent())
+
+	if *profileFile != "" || *htmlFile != "" {
+		// go tool cover runs in root, so relative names would land there
+		path := filepath.Join(dir, "merged.out")
+		if *profileFile != "" {
+			if path, err = filepath.Abs(*profileFile); err != nil {
+				return err
+			}
+		}
+		if err := writeFileWith(path, merged.write); err != nil {
+			return err
+		}
+		if *htmlFile != "" {
+			html, err := filepath.Abs(*htmlFile)
+			if err != nil {
+				return err
+			}
+			cmd := exec.Command("go", "tool", "cover", "-html="+path, "-o", html)
+			cmd.Dir = root
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("go tool cover: %v\n%s", err, output)
+			}
+			fmt.Printf("\nHTML report written to %s\n", *htmlFile)
+		}
+		if *profileFile != "" {
+			fmt.Printf("Merged profile written to %s\n", *profileFile)
+		}
+	}
+
+	if failed {
+		return exitError{code: 1}
+	}
+	return nil
+}
+
+// lessonCoverage runs the tests of every package in a lesson, each with
+// -coverpkg naming them all, so a handler the root package's tests call
+// counts as covered wherever it lives, and merges the profiles. The
+// exercises aren't included: they are graded, not tested here.
+func lessonCoverage(root, dir string, lesson Lesson) (*coverProfile, error) {
+	packages, err := lessonPackages(root, lesson)
+	if err != nil {
+		return nil, err
+	}
+	var coverpkg []string
+	for _, pkg := range packages {
+		coverpkg = append(coverpkg, pkg.path)
+	}
+
+	merged := &coverProfile{blocks: make(map[string]coverBlock)}
+	for i, pkg := range packages {
+		if !pkg.hasTests {
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d.out", lesson.ID(), i))
+		cmd := exec.Command("go", "test", "-count=1", "-covermode=set",
+			"-coverpkg="+strings.Join(coverpkg, ","), "-coverprofile="+path, pkg.path)
+		cmd.Dir = root
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("%v\n%s", err, bytes.TrimSpace(output))
+		}
+		profile, err := readCoverProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := merged.merge(profile); err != nil {
+			return nil, err
+		}
+	}
+	if merged.mode == "" {
+		merged.mode = "set"
+	}
+	return merged, nil
+}
+
+// lessonPackage is a package in a lesson's directory
+type lessonPackage struct {
+	path     string // the import path
+	hasTests bool
+}
+
+// lessonPackages lists the packages under a lesson's directory, but for
+// its exercises
+func lessonPackages(root string, lesson Lesson) ([]lessonPackage, error) {
+	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}} {{len .TestGoFiles}} {{len .XTestGoFiles}}", "./"+lesson.Dir+"/...")
+	cmd.Dir = root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v\n%s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var packages []lessonPackage
+	for _, line := range outputLines(string(output)) {
+		var pkg lessonPackage
+		var tests, xtests int
+		if _, err := fmt.Sscan(line, &pkg.path, &tests, &xtests); err != nil {
+			return nil, fmt.Errorf("go list: %q: %v", line, err)
+		}
+		if isExercises(pkg.path) {
+			continue
+		}
+		pkg.hasTests = tests+xtests > 0
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// isExercises reports whether the package at path is an exercises/
+// package, or inside one
+func isExercises(path string) bool {
+	return strings.HasSuffix(path, "/exercises") || strings.Contains(path, "/exercises/")
+}
+
+// readCoverProfile parses the profile go test wrote to path
+func readCoverProfile(path string) (*coverProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseCoverProfile(file)
+}
+
+// parseCoverProfile reads the format go test -coverprofile writes:
+//
+//	mode: set
+//	golang-lab/lesson01-hello-world/main.go:20.13,22.2 1 1
+func parseCoverProfile(r io.Reader) (*coverProfile, error) {
+	profile := &coverProfile{blocks: make(map[string]coverBlock)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if mode, ok := strings.CutPrefix(line, "mode: "); ok {
+			profile.mode = mode
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("bad coverage profile line %q", line)
+		}
+		block := profile.blocks[fields[0]]
+		block.statements = statements
+		block.count += count
+		profile.blocks[fields[0]] = block
+	}
+	if profile.mode == "" {
+		return nil, fmt.Errorf("not a coverage profile (no mode line)")
+	}
+	return profile, scanner.Err()
+}
+
+// merge adds other's counts to p. In set mode a block counts as run if
+// either profile ran it.
+func (p *coverProfile) merge(other *coverProfile) error {
+	if p.mode == "" {
+		p.mode = other.mode
+	}
+	if p.mode != other.mode {
+		return fmt.Errorf("can't merge coverage profiles in %s and %s mode", p.mode, other.mode)
+	}
+	for key, block := range other.blocks {
+		existing := p.blocks[key]
+		existing.statements = block.statements
+		if p.mode == "set" {
+			existing.count = max(existing.count, block.count)
+		} else {
+			existing.count += block.count
+		}
+		p.blocks[key] = existing
+	}
+	return nil
+}
+
+// percent is the share of statements the tests ran
+func (p *coverProfile) percent() float64 {
+	total, covered := 0, 0
+	for _, block := range p.blocks {
+		total += block.statements
+		if block.count > 0 {
+			covered += block.statements
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// write prints the profile back out in go test's format, sorted so the
+// output is stable
+func (p *coverProfile) write(w io.Writer) error {
+	keys := make([]string, 0, len(p.blocks))
+	for key := range p.blocks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if _, err := fmt.Fprintf(w, "mode: %s\n", p.mode); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s %d %d\n", key, p.blocks[key].statements, p.blocks[key].count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileWith creates path and fills it with write
+func writeFileWith(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
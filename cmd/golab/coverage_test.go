@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAndMergeCoverProfiles(t *testing.T) {
+	// Two packages' tests, each covering the other's blocks with -coverpkg
+	first, err := parseCoverProfile(strings.NewReader(`mode: set
+golang-lab/lesson10/store/store.go:10.1,12.2 2 1
+golang-lab/lesson10/handlers/users.go:20.1,25.2 3 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := parseCoverProfile(strings.NewReader(`mode: set
+golang-lab/lesson10/store/store.go:10.1,12.2 2 0
+golang-lab/lesson10/handlers/users.go:20.1,25.2 3 1
+golang-lab/lesson10/handlers/users.go:30.1,31.2 5 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := &coverProfile{blocks: make(map[string]coverBlock)}
+	for _, p := range []*coverProfile{first, second} {
+		if err := merged.merge(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := merged.percent(); got != 50 {
+		t.Errorf("merged coverage = %v%%, want 50%% (5 of 10 statements)", got)
+	}
+	var out strings.Builder
+	if err := merged.write(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `mode: set
+golang-lab/lesson10/handlers/users.go:20.1,25.2 3 1
+golang-lab/lesson10/handlers/users.go:30.1,31.2 5 0
+golang-lab/lesson10/store/store.go:10.1,12.2 2 1
+`
+	if out.String() != want {
+		t.Errorf("merged profile:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	count, err := parseCoverProfile(strings.NewReader("mode: count\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merged.merge(count); err == nil {
+		t.Error("merging a count profile into a set one succeeded")
+	}
+}
+
+// TestLessonPackages checks lesson 10's packages are all measured, and
+// its exercises aren't
+func TestLessonPackages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	root, err := findRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lesson, err := findLesson(lessons, "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages, err := lessonPackages(root, lesson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, pkg := range packages {
+		found[strings.TrimPrefix(pkg.path, "golang-lab/"+lesson.Dir)] = pkg.hasTests
+	}
+	for _, sub := range []string{"", "/handlers", "/store", "/models", "/middleware"} {
+		if hasTests, ok := found[sub]; !ok || !hasTests {
+			t.Errorf("package %q: listed %v, with tests %v; want both", sub, ok, hasTests)
+		}
+	}
+	if _, ok := found["/exercises"]; ok {
+		t.Error("the exercises were listed")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The rubric: how many points each check is worth in a lesson's grade.
+// Exercise points are shared out by the fraction of exercises passing.
+const (
+	exercisePoints = 70
+	vetPoints      = 10
+	racePoints     = 10
+	coveragePoints = 10
+)
+
+// Check statuses in the grade report
+const (
+	checkPass    = "pass"
+	checkFail    = "fail"
+	checkSkipped = "skipped" // doesn't count towards the maximum either
+)
+
+// GradeReport is the JSON golab grade prints, one per student
+type GradeReport struct {
+	Student     string         `json:"student,omitempty"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	GoVersion   string         `json:"go_version"`
+	Solutions   bool           `json:"solutions,omitempty"`
+	Rubric      map[string]int `json:"rubric"`
+	Points      float64        `json:"points"`
+	MaxPoints   float64        `json:"max_points"`
+	Score       float64        `json:"score"` // percent
+	Lessons     []LessonGrade  `json:"lessons"`
+}
+
+// LessonGrade is the rubric applied to one lesson's exercises
+type LessonGrade struct {
+	Lesson    string         `json:"lesson"` // e.g. "lesson07"
+	Title     string         `json:"title"`
+	Points    float64        `json:"points"`
+	MaxPoints float64        `json:"max_points"`
+	Score     float64        `json:"score"` // percent
+	Exercises ExercisesGrade `json:"exercises"`
+	Vet       CheckGrade     `json:"vet"`
+	Race      CheckGrade     `json:"race"`
+	// Coverage checks the exercise coverage against the lesson's minimum
+	Coverage CheckGrade `json:"coverage"`
+}
+
+// ExercisesGrade is the outcome of the exercise tests
+type ExercisesGrade struct {
+	Passed     int               `json:"passed"`
+	Total      int               `json:"total"`
+	Failures   []ExerciseFailure `json:"failures,omitempty"`
+	BuildError string            `json:"build_error,omitempty"`
+	// Coverage is the percentage of statements the tests ran; left out
+	// when the exercises don't compile
+	Coverage *float64 `json:"coverage,omitempty"`
+	// Structure is feedback on //golab:require directives not yet met.
+	// It costs the vet points, since golab vet reports it too.
+	Structure []string `json:"structure,omitempty"`
+}
+
+// ExerciseFailure is one failing exercise with what its test logged
+type ExerciseFailure struct {
+	Exercise string   `json:"exercise"`
+	Output   []string `json:"output,omitempty"`
+}
+
+// CheckGrade is the outcome of the vet checks (go vet, then golab vet),
+// the race detector or the coverage minimum
+type CheckGrade struct {
+	Status string   `json:"status"` // checkPass, checkFail or checkSkipped
+	Output []string `json:"output,omitempty"`
+}
+
+// runGrade implements golab grade
+func runGrade(args []string) error {
+	flags := flag.NewFlagSet("grade", flag.ContinueOnError)
+	output := flags.String("o", "", "write the report to this file instead of stdout")
+	student := flags.String("student", currentUser(), "name to put in the report")
+	solutions := flags.Bool("solutions", false, "grade the reference solutions instead of your code")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: golab grade [-o report.json] [-student name] [--solutions] [lesson...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	var selected []Lesson
+	if flags.NArg() == 0 {
+		for _, lesson := range lessons {
+			if lesson.Exercises {
+				selected = append(selected, lesson)
+			}
+		}
+	}
+	for _, name := range flags.Args() {
+		lesson, err := findLesson(lessons, name)
+		if err != nil {
+			return err
+		}
+		if !lesson.Exercises {
+			return fmt.Errorf("lesson %02d has no exercises to grade", lesson.Number)
+		}
+		selected = append(selected, lesson)
+	}
+
+	report := GradeReport{
+		Student:     *student,
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		GoVersion:   runtime.Version(),
+		Solutions:   *solutions,
+		Rubric:      map[string]int{"exercises": exercisePoints, "vet": vetPoints, "race": racePoints, "coverage": coveragePoints},
+	}
+	for _, lesson := range selected {
+		// Progress goes to stderr so stdout is only the report
+		fmt.Fprintf(os.Stderr, "golab: grading lesson %02d...\n", lesson.Number)
+		grade, err := gradeLesson(root, lesson, *solutions)
+		if err != nil {
+			return err
+		}
+		report.Lessons = append(report.Lessons, grade)
+		report.Points += grade.Points
+		report.MaxPoints += grade.MaxPoints
+	}
+	report.Score = percent(report.Points, report.MaxPoints)
+
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false) // test output is full of <nil>
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(data.Bytes())
+		return err
+	}
+	if err := os.WriteFile(*output, data.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "golab: %s scored %.1f%%; report written to %s\n", report.Student, report.Score, *output)
+	return nil
+}
+
+// gradeLesson runs the exercise tests, go vet and the race detector on one
+// lesson's exercises and scores them against the rubric
+func gradeLesson(root string, lesson Lesson, solutions bool) (LessonGrade, error) {
+	grade := LessonGrade{Lesson: lesson.ID(), Title: lesson.Title}
+
+	result, err := verifyLesson(root, lesson, solutions)
+	if err != nil {
+		return grade, err
+	}
+	grade.Exercises = ExercisesGrade{
+		Passed:     result.Passed(),
+		Total:      len(result.Exercises),
+		BuildError: result.BuildError,
+	}
+	for _, exercise := range result.Exercises {
+		if !exercise.Passed {
+			grade.Exercises.Failures = append(grade.Exercises.Failures, ExerciseFailure{exercise.Name, exercise.Output})
+		}
+	}
+	for _, diagnostic := range result.Structure {
+		grade.Exercises.Structure = append(grade.Exercises.Structure, fmt.Sprintf("%s (%s:%d)", diagnostic.Message, diagnostic.Pos.Filename, diagnostic.Pos.Line))
+	}
+	if result.Coverage >= 0 {
+		coverage := result.Coverage
+		grade.Exercises.Coverage = &coverage
+	}
+	grade.MaxPoints += exercisePoints
+	if grade.Exercises.Total > 0 {
+		grade.Points += exercisePoints * float64(grade.Exercises.Passed) / float64(grade.Exercises.Total)
+	}
+
+	tags := strings.Join(verifyTags(solutions), ",")
+	pkg := "./" + lesson.Dir + "/exercises"
+
+	grade.Vet = runCheck(root, "go", "vet", "-tags", tags, pkg)
+	if grade.Vet.Status == checkPass {
+		grade.Vet = labVetCheck(root, solutions, pkg)
+	}
+	// Code that doesn't compile can't be race tested either; vet already
+	// reports why
+	if result.BuildError != "" {
+		grade.Race = CheckGrade{Status: checkFail, Output: []string{"the exercises don't compile"}}
+	} else {
+		grade.Race = raceCheck(root, tags, pkg)
+	}
+
+	grade.Coverage = coverageCheck(lesson, result)
+
+	for _, check := range []struct {
+		grade  CheckGrade
+		points float64
+	}{{grade.Vet, vetPoints}, {grade.Race, racePoints}, {grade.Coverage, coveragePoints}} {
+		switch check.grade.Status {
+		case checkPass:
+			grade.Points += check.points
+			grade.MaxPoints += check.points
+		case checkFail:
+			grade.MaxPoints += check.points
+		}
+	}
+	grade.Points = math.Round(grade.Points*10) / 10
+	grade.Score = percent(grade.Points, grade.MaxPoints)
+	return grade, nil
+}
+
+// runCheck passes if the command succeeds and keeps its output otherwise
+func runCheck(root string, name string, args ...string) CheckGrade {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = root
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Run(); err != nil {
+		return CheckGrade{Status: checkFail, Output: outputLines(output.String())}
+	}
+	return CheckGrade{Status: checkPass}
+}
+
+// labVetCheck runs golab vet's own checks, which go vet doesn't have
+func labVetCheck(root string, solutions bool, pkg string) CheckGrade {
+	diagnostics, err := vetPackages(root, solutions, pkg)
+	if err != nil {
+		return CheckGrade{Status: checkFail, Output: outputLines(err.Error())}
+	}
+	if len(diagnostics) == 0 {
+		return CheckGrade{Status: checkPass}
+	}
+	check := CheckGrade{Status: checkFail}
+	for _, diagnostic := range diagnostics {
+		check.Output = append(check.Output, diagnostic.String())
+	}
+	return check
+}
+
+// raceCheck runs the exercise tests under the race detector. Failing tests
+// are the exercise score's business; only a reported race fails this.
+func raceCheck(root, tags, pkg string) CheckGrade {
+	cmd := exec.Command("go", "test", "-race", "-count=1", "-tags", tags, pkg)
+	cmd.Dir = root
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err := cmd.Run()
+
+	text := output.String()
+	switch {
+	case strings.Contains(text, "WARNING: DATA RACE"):
+		return CheckGrade{Status: checkFail, Output: raceReports(text)}
+	case err != nil && strings.Contains(text, "-race requires cgo"),
+		err != nil && strings.Contains(text, "-race is not supported"):
+		// e.g. CGO_ENABLED=0 or no C compiler; not the student's fault
+		return CheckGrade{Status: checkSkipped, Output: outputLines(text)}
+	}
+	return CheckGrade{Status: checkPass}
+}
+
+// coverageCheck compares how much of the exercises the tests ran with the
+// lesson's minimum. Code the tests never reach is usually dead, or a case
+// the exercise didn't ask for.
+func coverageCheck(lesson Lesson, result VerifyResult) CheckGrade {
+	want := lesson.MinCoverage.Exercises
+	switch {
+	case want == 0:
+		return CheckGrade{Status: checkSkipped, Output: []string{"this lesson has no coverage minimum"}}
+	case result.BuildError != "":
+		return CheckGrade{Status: checkFail, Output: []string{"the exercises don't compile"}}
+	case result.Coverage < 0:
+		return CheckGrade{Status: checkFail, Output: []string{"go test didn't report coverage"}}
+	case result.Coverage < want:
+		return CheckGrade{Status: checkFail, Output: []string{
+			fmt.Sprintf("the tests ran %.1f%% of the statements; the minimum is %.0f%%", result.Coverage, want),
+		}}
+	}
+	return CheckGrade{Status: checkPass}
+}
+
+// raceReports keeps the race detector's reports and drops the test noise
+// between them
+func raceReports(text string) []string {
+	var lines []string
+	inReport := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, "WARNING: DATA RACE") {
+			inReport = true
+		}
+		if inReport {
+			lines = append(lines, line)
+		}
+		if strings.HasPrefix(line, "==================") && len(lines) > 1 {
+			inReport = false
+		}
+	}
+	return lines
+}
+
+func outputLines(text string) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// percent rounds to one decimal place; nothing out of nothing is 0%
+func percent(points, max float64) float64 {
+	if max == 0 {
+		return 0
+	}
+	return math.Round(points/max*1000) / 10
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"go/scanner"
+	"go/token"
+	"html"
+	"html/template"
+	"strings"
+)
+
+// predeclared names get their own colour, like in most editors
+var predeclared = map[string]bool{
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true, "int": true, "int8": true, "int16": true,
+	"int32": true, "int64": true, "rune": true, "string": true, "uint": true,
+	"uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"any": true, "comparable": true, "true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true,
+	"new": true, "panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// highlightGo returns src as HTML with every token wrapped in a span whose
+// class names its kind. It uses the same scanner as the compiler, so it
+// never gets confused by strings that look like comments or vice versa.
+// Source that doesn't scan cleanly is still shown; the scanner just
+// skips what it can't read and the gaps are copied as plain text.
+func highlightGo(src []byte) template.HTML {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	var out strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // inserted by the scanner, not in the source
+		}
+
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		start := file.Offset(pos)
+		end := start + len(text)
+		if start < last || end > len(src) {
+			continue
+		}
+
+		out.WriteString(html.EscapeString(string(src[last:start])))
+		if class := tokenClass(tok, lit); class != "" {
+			out.WriteString(`<span class="` + class + `">`)
+			out.WriteString(html.EscapeString(string(src[start:end])))
+			out.WriteString("</span>")
+		} else {
+			out.WriteString(html.EscapeString(string(src[start:end])))
+		}
+		last = end
+	}
+	out.WriteString(html.EscapeString(string(src[last:])))
+
+	return template.HTML(out.String())
+}
+
+func tokenClass(tok token.Token, lit string) string {
+	switch {
+	case tok == token.COMMENT:
+		return "comment"
+	case tok == token.STRING || tok == token.CHAR:
+		return "string"
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return "number"
+	case tok.IsKeyword():
+		return "keyword"
+	case tok == token.IDENT && predeclared[lit]:
+		return "builtin"
+	}
+	return ""
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// maxRunOutput caps what the hub keeps of one run's output
+const maxRunOutput = 1 << 20
+
+//go:embed hubui
+var hubFiles embed.FS
+
+var hubTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"statusClass": func(status string) string { return strings.ReplaceAll(status, " ", "-") },
+}).ParseFS(hubFiles, "hubui/*.html"))
+
+// hub is the web UI behind golab hub: it lists lessons, shows their source
+// and runs them, streaming the output to the browser. Its playground runs
+// snippets through a snippetRunner.
+type hub struct {
+	root    string
+	lessons []Lesson
+
+	mu     sync.Mutex
+	runs   map[string]*hubRun // by run ID
+	active map[int]*hubRun    // the current run of each lesson, by number
+	nextID int
+}
+
+// hubRun is one execution of a lesson started from the browser
+type hubRun struct {
+	ID     string
+	Lesson Lesson
+
+	mu       sync.Mutex
+	output   []byte
+	url      string // set once a server lesson accepts connections
+	done     bool
+	status   string
+	process  *os.Process
+	stopping bool
+	watchers map[chan struct{}]bool
+}
+
+// runHub implements golab hub
+func runHub(args []string) error {
+	flags := flag.NewFlagSet("hub", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:7070", "address for the web UI")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	h := &hub{
+		root:    root,
+		lessons: lessons,
+		runs:    make(map[string]*hubRun),
+		active:  make(map[int]*hubRun),
+	}
+
+	static, err := fs.Sub(hubFiles, "hubui/static")
+	if err != nil {
+		return err
+	}
+	snippets, err := newSnippetRunner()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", h.handleIndex)
+	mux.HandleFunc("/lessons/", h.handleLesson)
+	mux.HandleFunc("/api/runs", h.handleStartRun)
+	mux.HandleFunc("/api/runs/", h.handleRun)
+	mux.HandleFunc("/playground", h.handlePlayground)
+	mux.Handle("/api/snippets", snippets)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           hubLogging(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("golab hub running on http://%s\n", *addr)
+		fmt.Println("Press Ctrl+C to stop (running lessons are stopped too)")
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("\nShutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	h.stopAll()
+	return nil
+}
+
+func hubLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Logged up front: streams stay open for as long as a lesson runs
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// lessonView is what the templates get for each lesson
+type lessonView struct {
+	Lesson
+	Status string // from golab progress
+	RunID  string // current run, if any
+	URL    string // where a running server lesson listens
+}
+
+func (h *hub) view(lesson Lesson, progress *Progress) lessonView {
+	view := lessonView{Lesson: lesson, Status: progress.status(lesson)}
+
+	h.mu.Lock()
+	run := h.active[lesson.Number]
+	h.mu.Unlock()
+	if run != nil {
+		run.mu.Lock()
+		if !run.done {
+			view.RunID, view.URL = run.ID, run.url
+		}
+		run.mu.Unlock()
+	}
+	return view
+}
+
+// loadProgressOrEmpty never fails: the hub works without progress
+func loadProgressOrEmpty() *Progress {
+	if path, err := progressPath(); err == nil {
+		if progress, err := loadProgress(path); err == nil {
+			return progress
+		}
+	}
+	return &Progress{Lessons: make(map[string]*LessonProgress)}
+}
+
+// GET /
+func (h *hub) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	progress := loadProgressOrEmpty()
+	var views []lessonView
+	for _, lesson := range h.lessons {
+		views = append(views, h.view(lesson, progress))
+	}
+	h.render(w, "index.html", views)
+}
+
+// sourceFile is one highlighted .go file on a lesson page
+type sourceFile struct {
+	Name string
+	HTML template.HTML
+}
+
+// GET /lessons/{number}
+func (h *hub) handleLesson(w http.ResponseWriter, r *http.Request) {
+	lesson, err := findLesson(h.lessons, strings.TrimPrefix(r.URL.Path, "/lessons/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	files, err := h.sourceFiles(lesson)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.render(w, "lesson.html", struct {
+		lessonView
+		Files []sourceFile
+	}{h.view(lesson, loadProgressOrEmpty()), files})
+}
+
+// sourceFiles returns the lesson's .go files, main.go first, then any
+// exercises (but not their solutions)
+func (h *hub) sourceFiles(lesson Lesson) ([]sourceFile, error) {
+	var names []string
+	for _, pattern := range []string{"*.go", "exercises/*.go"} {
+		matches, err := filepath.Glob(filepath.Join(h.root, lesson.Dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		matches = slices.DeleteFunc(matches, func(name string) bool {
+			return filepath.Base(name) == "solution.go" // no spoilers
+		})
+		sort.Slice(matches, func(i, j int) bool {
+			mainI, mainJ := filepath.Base(matches[i]) == "main.go", filepath.Base(matches[j]) == "main.go"
+			if mainI != mainJ {
+				return mainI
+			}
+			return matches[i] < matches[j]
+		})
+		names = append(names, matches...)
+	}
+
+	var files []sourceFile
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(filepath.Join(h.root, lesson.Dir), name)
+		files = append(files, sourceFile{Name: filepath.ToSlash(rel), HTML: highlightGo(src)})
+	}
+	return files, nil
+}
+
+// playgroundStarter is what the playground shows before the student types
+const playgroundStarter = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello, playground!")
+}
+`
+
+// GET /playground
+func (h *hub) handlePlayground(w http.ResponseWriter, r *http.Request) {
+	h.render(w, "playground.html", struct {
+		Source  string
+		Timeout time.Duration
+	}{playgroundStarter, snippetRun})
+}
+
+func (h *hub) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := hubTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("rendering %s: %v", name, err)
+	}
+}
+
+// POST /api/runs {"lesson": "07"}
+//
+// Requiring a JSON body means another website can't start lessons from a
+// visitor's browser: a cross-origin JSON POST needs a CORS preflight, and
+// the hub never approves one.
+func (h *hub) handleStartRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		hubJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		hubJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "expected application/json"})
+		return
+	}
+	var req struct {
+		Lesson string `json:"lesson"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		hubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	lesson, err := findLesson(h.lessons, req.Lesson)
+	if err != nil {
+		hubJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	run, started := h.start(lesson)
+	status := http.StatusCreated
+	if !started {
+		status = http.StatusConflict // already running: attach to that run
+	}
+	hubJSON(w, status, map[string]string{"id": run.ID})
+}
+
+// GET /api/runs/{id}/stream and POST /api/runs/{id}/stop
+func (h *hub) handleRun(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/runs/"), "/")
+	h.mu.Lock()
+	run := h.runs[id]
+	h.mu.Unlock()
+	if run == nil {
+		hubJSON(w, http.StatusNotFound, map[string]string{"error": "no such run"})
+		return
+	}
+
+	switch {
+	case action == "stream" && r.Method == http.MethodGet:
+		run.stream(w, r)
+	case action == "stop" && r.Method == http.MethodPost:
+		run.stop()
+		hubJSON(w, http.StatusAccepted, map[string]string{"id": run.ID})
+	default:
+		hubJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func hubJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// start launches lesson unless it is already running, in which case the
+// existing run is returned
+func (h *hub) start(lesson Lesson) (*hubRun, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if run := h.active[lesson.Number]; run != nil && !run.finished() {
+		return run, false
+	}
+
+	h.nextID++
+	run := &hubRun{
+		ID:       fmt.Sprintf("%s-%d", lesson.ID(), h.nextID),
+		Lesson:   lesson,
+		watchers: make(map[chan struct{}]bool),
+	}
+	h.runs[run.ID] = run
+	h.active[lesson.Number] = run
+	go run.execute(h.root)
+	return run, true
+}
+
+func (h *hub) stopAll() {
+	h.mu.Lock()
+	var runs []*hubRun
+	for _, run := range h.active {
+		runs = append(runs, run)
+	}
+	h.mu.Unlock()
+
+	for _, run := range runs {
+		run.stop()
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for _, run := range runs {
+		for !run.finished() && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// execute builds and runs the lesson, recording everything it prints
+func (r *hubRun) execute(root string) {
+	fmt.Fprintf(r, "Building %s...\n", r.Lesson.ID())
+
+	var args, env []string
+	port := 0
+	if r.Lesson.Server != nil {
+		var err error
+		if port, args, env, err = choosePort(r.Lesson, 0, r); err != nil {
+			r.finish("error: " + err.Error())
+			return
+		}
+	}
+	binary, cleanup, err := buildLesson(root, r.Lesson, r)
+	if err != nil {
+		r.finish("error: " + err.Error())
+		return
+	}
+	defer cleanup()
+
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = r, r
+
+	// Start under the lock so a stop that arrives mid-build isn't lost
+	r.mu.Lock()
+	if r.stopping {
+		r.mu.Unlock()
+		r.finish("stopped")
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		r.mu.Unlock()
+		r.finish("error: " + err.Error())
+		return
+	}
+	r.process = cmd.Process
+	r.mu.Unlock()
+	updateProgress(func(p *Progress) { p.recordRun(r.Lesson, time.Now()) })
+
+	exited := make(chan struct{})
+	if r.Lesson.Server != nil {
+		go func() {
+			if url, ok := waitForServer(r.Lesson, port, exited); ok {
+				r.mu.Lock()
+				r.url = url
+				r.mu.Unlock()
+				r.notify()
+			}
+		}()
+	}
+
+	err = cmd.Wait()
+	close(exited)
+
+	r.mu.Lock()
+	stopped := r.stopping
+	r.mu.Unlock()
+	var exit *exec.ExitError
+	switch {
+	case stopped:
+		r.finish("stopped")
+	case errors.As(err, &exit):
+		r.finish(fmt.Sprintf("exited with status %d", exit.ExitCode()))
+	case err != nil:
+		r.finish("error: " + err.Error())
+	default:
+		r.finish("finished")
+	}
+}
+
+// Write collects output from the build and the lesson
+func (r *hubRun) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	if room := maxRunOutput - len(r.output); room > 0 {
+		if len(p) > room {
+			r.output = append(r.output, p[:room]...)
+			r.output = append(r.output, "\n[output truncated]\n"...)
+		} else {
+			r.output = append(r.output, p...)
+		}
+	}
+	r.mu.Unlock()
+	r.notify()
+	return len(p), nil
+}
+
+func (r *hubRun) finish(status string) {
+	r.mu.Lock()
+	r.done, r.status = true, status
+	r.mu.Unlock()
+	r.notify()
+}
+
+func (r *hubRun) finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+// notify wakes every stream without ever blocking on a slow browser; each
+// stream then catches up from its own offset
+func (r *hubRun) notify() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for watcher := range r.watchers {
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stop asks the lesson to shut down gracefully, then kills it if it is
+// still running after stopTimeout
+func (r *hubRun) stop() {
+	r.mu.Lock()
+	process, already := r.process, r.stopping
+	r.stopping = true
+	r.mu.Unlock()
+	if process == nil || already {
+		return
+	}
+
+	if err := process.Signal(os.Interrupt); err != nil {
+		process.Kill() // Windows can't deliver os.Interrupt
+		return
+	}
+	time.AfterFunc(stopTimeout, func() {
+		if !r.finished() {
+			process.Kill()
+		}
+	})
+}
+
+// stream sends the run's output as server-sent events: "output" with new
+// text, "ready" with the URL of a server lesson, and "exit" at the end
+func (r *hubRun) stream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	watcher := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.watchers[watcher] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.watchers, watcher)
+		r.mu.Unlock()
+	}()
+
+	offset, sentURL := 0, ""
+	for {
+		r.mu.Lock()
+		chunk := completeUTF8(r.output[offset:])
+		url, done, status := r.url, r.done, r.status
+		if done {
+			chunk = r.output[offset:]
+		}
+		r.mu.Unlock()
+
+		if len(chunk) > 0 {
+			writeEvent(w, "output", map[string]string{"text": string(chunk)})
+			offset += len(chunk)
+		}
+		if url != sentURL {
+			writeEvent(w, "ready", map[string]string{"url": url})
+			sentURL = url
+		}
+		if done {
+			writeEvent(w, "exit", map[string]string{"status": status})
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-watcher:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// completeUTF8 trims a trailing partial character, which the next chunk
+// will complete
+func completeUTF8(b []byte) []byte {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+	return b
+}
@@ -0,0 +1,111 @@
+// Runs the lesson on a lesson page and streams its output with
+// server-sent events from /api/runs/{id}/stream
+const runner = document.querySelector(".runner");
+
+if (runner) {
+    const runButton = runner.querySelector(".run");
+    const stopButton = runner.querySelector(".stop");
+    const link = runner.querySelector(".server-link");
+    const status = runner.querySelector(".run-status");
+    const output = runner.querySelector(".output");
+    let runID = runner.dataset.run;
+
+    function watch(id) {
+        runID = id;
+        runButton.disabled = true;
+        stopButton.hidden = false;
+        output.hidden = false;
+        output.textContent = "";
+        status.textContent = "running";
+
+        const events = new EventSource(`/api/runs/${id}/stream`);
+        events.addEventListener("output", (e) => {
+            // textContent, never innerHTML: lesson output is not markup
+            output.textContent += JSON.parse(e.data).text;
+            output.scrollTop = output.scrollHeight;
+        });
+        events.addEventListener("ready", (e) => {
+            const url = JSON.parse(e.data).url;
+            link.href = url;
+            link.textContent = `open ${url}`;
+            link.hidden = false;
+        });
+        events.addEventListener("exit", (e) => {
+            events.close();
+            status.textContent = JSON.parse(e.data).status;
+            runButton.disabled = false;
+            stopButton.hidden = true;
+            link.hidden = true;
+        });
+    }
+
+    runButton.addEventListener("click", async () => {
+        const response = await fetch("/api/runs", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ lesson: runner.dataset.lesson }),
+        });
+        const body = await response.json();
+        if (body.id) {
+            watch(body.id);
+        } else {
+            status.textContent = body.error;
+        }
+    });
+
+    stopButton.addEventListener("click", () => {
+        fetch(`/api/runs/${runID}/stop`, { method: "POST" });
+        status.textContent = "stopping...";
+    });
+
+    if (runID) {
+        watch(runID);
+    }
+}
+
+// The playground posts its snippet to /api/snippets and shows what the
+// program printed once it has finished
+const playground = document.querySelector(".playground");
+
+if (playground) {
+    const source = playground.querySelector(".source");
+    const runButton = playground.querySelector(".run");
+    const status = playground.querySelector(".run-status");
+    const output = playground.querySelector(".output");
+
+    // Tab indents, as in an editor, instead of leaving the textarea
+    source.addEventListener("keydown", (e) => {
+        if (e.key === "Tab" && !e.shiftKey) {
+            e.preventDefault();
+            source.setRangeText("\t", source.selectionStart, source.selectionEnd, "end");
+        }
+    });
+
+    runButton.addEventListener("click", async () => {
+        runButton.disabled = true;
+        status.textContent = "compiling and running...";
+        try {
+            const response = await fetch("/api/snippets", {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ source: source.value }),
+            });
+            const body = await response.json();
+            if (body.error) {
+                status.textContent = body.error;
+                return;
+            }
+            // textContent, never innerHTML: program output is not markup
+            output.textContent = body.stdout + body.stderr;
+            output.hidden = false;
+            status.textContent = `${body.status} in ${body.duration_ms} ms`;
+            if (body.status === "exited") {
+                status.textContent += ` (status ${body.exit_code})`;
+            }
+        } catch (err) {
+            status.textContent = `request failed: ${err}`;
+        } finally {
+            runButton.disabled = false;
+        }
+    });
+}
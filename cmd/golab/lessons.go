@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// modulePath identifies the repository root: the directory whose go.mod
+// declares this module
+const modulePath = "golang-lab"
+
+// Lesson is one lessonNN-slug directory found in the repository
+type Lesson struct {
+	Number      int
+	Dir         string // e.g. "lesson08-concurrency"
+	Title       string // from the "// Lesson NN: Title" header in main.go
+	Description string // the rest of that header comment
+	Server      *ServerSpec
+	Exercises   bool // has an exercises/ package for golab verify
+	MinCoverage CoverageMinimum
+	LessonInfo  // topics, difficulty and prerequisites from the registry
+}
+
+// ID is the short name used for the lesson's package and command
+func (l Lesson) ID() string {
+	return fmt.Sprintf("lesson%02d", l.Number)
+}
+
+// ServerSpec describes a lesson that keeps running and serves HTTP
+type ServerSpec struct {
+	Port   int    // default port
+	Scheme string // "http" or "https"
+	// Configure returns the flags and environment that move the lesson to
+	// another port; nil means the port is fixed
+	Configure func(port int) (args, env []string)
+}
+
+func addrFlag(host string) func(int) ([]string, []string) {
+	return func(port int) ([]string, []string) {
+		return []string{fmt.Sprintf("-addr=%s:%d", host, port)}, nil
+	}
+}
+
+func portFlag(port int) ([]string, []string) {
+	return []string{fmt.Sprintf("-port=%d", port)}, nil
+}
+
+func portEnv(port int) ([]string, []string) {
+	return nil, []string{fmt.Sprintf("PORT=%d", port)}
+}
+
+// servers lists the lessons that start a server and how each one picks
+// its port. Every other lesson is a demo that prints its output and exits.
+var servers = map[int]*ServerSpec{
+	9:  {Port: 8080, Scheme: "http", Configure: portFlag},
+	10: {Port: 8080, Scheme: "http", Configure: portFlag},
+	12: {Port: 8080, Scheme: "http", Configure: addrFlag("")},
+	13: {Port: 8080, Scheme: "http", Configure: portEnv},
+	14: {Port: 8080, Scheme: "http", Configure: portEnv},
+	15: {Port: 8080, Scheme: "http", Configure: addrFlag("")},
+	16: {Port: 8080, Scheme: "http", Configure: func(port int) ([]string, []string) {
+		return []string{
+			fmt.Sprintf("-addr=:%d", port),
+			fmt.Sprintf("-base-url=http://localhost:%d", port),
+		}, nil
+	}},
+	17: {Port: 8443, Scheme: "https", Configure: addrFlag("localhost")},
+	18: {Port: 8080, Scheme: "http", Configure: addrFlag("localhost")},
+	19: {Port: 8080, Scheme: "http", Configure: addrFlag("")},
+}
+
+// CoverageMinimum is the statement coverage, in percent, a lesson must
+// keep. Zero means no minimum.
+type CoverageMinimum struct {
+	Lesson    float64 // the lesson package under its own tests; golab coverage
+	Exercises float64 // the exercises under the exercise tests; golab grade
+}
+
+// coverageMinimums sit a little below what each lesson reaches today, so
+// coverage can only go up. Server lessons are mostly exercised by hand.
+var coverageMinimums = map[int]CoverageMinimum{
+	1:  {Lesson: 95},
+	2:  {Lesson: 95, Exercises: 90},
+	3:  {Lesson: 95, Exercises: 90},
+	4:  {Lesson: 95, Exercises: 90},
+	5:  {Lesson: 95},
+	6:  {Lesson: 85, Exercises: 90},
+	7:  {Lesson: 85, Exercises: 90},
+	8:  {Lesson: 30, Exercises: 90},
+	9:  {Lesson: 30},
+	10: {Lesson: 75, Exercises: 90},
+	11: {Lesson: 45},
+	12: {Lesson: 30},
+	13: {Lesson: 35},
+	14: {Lesson: 40},
+	15: {Lesson: 5},
+	16: {Lesson: 50},
+	17: {Lesson: 35},
+	18: {Lesson: 35},
+	19: {Lesson: 15},
+	20: {Lesson: 90, Exercises: 90},
+}
+
+var lessonDirPattern = regexp.MustCompile(`^lesson(\d{2})-[a-z0-9-]+$`)
+
+// findRoot walks up from the working directory to the module root
+func findRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil && strings.HasPrefix(string(data), "module "+modulePath+"\n") {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("not inside the golang_lab repository (no go.mod for module " + modulePath + ")")
+		}
+		dir = parent
+	}
+}
+
+// discoverLessons finds every lesson directory under root, sorted by number
+func discoverLessons(root string) ([]Lesson, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var lessons []Lesson
+	for _, entry := range entries {
+		match := lessonDirPattern.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() || match == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		lesson := Lesson{
+			Number:      number,
+			Dir:         entry.Name(),
+			Server:      servers[number],
+			MinCoverage: coverageMinimums[number],
+			LessonInfo:  registry[number],
+		}
+		lesson.Title, lesson.Description, err = readHeader(filepath.Join(root, entry.Name(), "main.go"))
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(filepath.Join(root, entry.Name(), "exercises")); err == nil && info.IsDir() {
+			lesson.Exercises = true
+		}
+		lessons = append(lessons, lesson)
+	}
+
+	sort.Slice(lessons, func(i, j int) bool { return lessons[i].Number < lessons[j].Number })
+	return lessons, nil
+}
+
+// readHeader parses the comment block every lesson's main.go starts with:
+//
+//	// Lesson 08: Concurrency with Goroutines and Channels
+//	// This lesson covers Go's concurrency primitives and patterns
+func readHeader(path string) (title, description string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(line, "//")))
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if len(lines) == 0 {
+		return "", "", fmt.Errorf("%s: missing \"// Lesson NN: Title\" header", path)
+	}
+
+	title = lines[0]
+	if _, after, ok := strings.Cut(title, ": "); ok {
+		title = after
+	}
+	return title, strings.Join(lines[1:], " "), nil
+}
+
+// findLesson accepts "8", "08", "lesson08" or the full directory name
+func findLesson(lessons []Lesson, name string) (Lesson, error) {
+	key := strings.TrimPrefix(strings.TrimSuffix(name, "/"), "lesson")
+	if number, _, ok := strings.Cut(key, "-"); ok {
+		key = number
+	}
+	number, err := strconv.Atoi(key)
+	if err != nil {
+		return Lesson{}, fmt.Errorf("%q is not a lesson; try golab list", name)
+	}
+	for _, lesson := range lessons {
+		if lesson.Number == number {
+			return lesson, nil
+		}
+	}
+	return Lesson{}, fmt.Errorf("no lesson %02d; try golab list", number)
+}
+
+// runList implements golab list
+func runList(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+
+	for _, lesson := range lessons {
+		kind := "demo"
+		if lesson.Server != nil {
+			kind = fmt.Sprintf("server :%d", lesson.Server.Port)
+		}
+		if lesson.Exercises {
+			kind += ", exercises"
+		}
+		fmt.Printf("%02d  %-56s %s\n", lesson.Number, lesson.Title, kind)
+		if lesson.Description != "" {
+			fmt.Printf("    %s\n", lesson.Description)
+		}
+	}
+	fmt.Printf("\nRun one with: golab run %02d\n", lessons[0].Number)
+	fmt.Println("Check your exercises with: golab verify lesson07")
+	return nil
+}
@@ -0,0 +1,103 @@
+// Command golab lists and runs the lessons in this repository.
+//
+//	golab list
+//	golab run 08
+//	golab run -port 9000 16
+//	golab run 19 -- -loadtest
+//	golab verify lesson07
+//	golab verify --solutions
+//	golab vet
+//	golab vet ./lesson12-object-storage
+//	golab grade -o report.json
+//	golab coverage -html coverage.html
+//	golab soak -duration 5m ./capstone
+//	golab progress
+//	golab hub
+//	golab tui
+//	golab new-lesson "Generics"
+//
+// Run it from anywhere inside the repository, for example with
+// go run ./cmd/golab list, or install it with go install ./cmd/golab.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// command is one golab subcommand
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"list", "golab list", "show every lesson with its description", runList},
+		{"run", "golab run [-port N] [-deterministic] <lesson> [-- lesson flags]", "build and run a lesson", runRun},
+		{"verify", "golab verify [--solutions] [lesson...]", "run exercise tests (all lessons if none given)", runVerify},
+		{"vet", "golab vet [--solutions] [lesson... | ./pkg...]", "check exercises or packages for ignored errors and more", runVet},
+		{"grade", "golab grade [-o report.json] [lesson...]", "score exercises, vet and race checks as a JSON report", runGrade},
+		{"coverage", "golab coverage [-html file] [-o file] [lesson...]", "measure each lesson's test coverage against its minimum", runCoverage},
+		{"soak", "golab soak [-duration 1m] [-seed N] [lesson...]", "stress-test concurrent code with the race detector", runSoak},
+		{"path", "golab path [lesson...]", "order lessons by their prerequisites, or show what one needs", runPath},
+		{"progress", "golab progress [-json] [-reset]", "show which lessons and exercises you have finished", runProgress},
+		{"hub", "golab hub [-addr localhost:7070]", "browse, read and run lessons in a web browser", runHub},
+		{"tui", "golab tui", "browse, run and verify lessons in the terminal", runTUI},
+		{"new-lesson", `golab new-lesson [-number N] "Topic Name"`, "create a lesson from the templates", runNewLesson},
+		{"help", "golab help", "show this message", func([]string) error {
+			printUsage()
+			return nil
+		}},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				var exit exitError
+				if errors.As(err, &exit) {
+					os.Exit(exit.code)
+				}
+				fmt.Fprintf(os.Stderr, "golab %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "golab: unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "golab runs the Go Lab lessons.")
+	fmt.Fprintln(os.Stderr, "\nUsage:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-48s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nLessons can be named as 8, 08, lesson08 or lesson08-concurrency.")
+}
+
+// exitError carries a lesson's exit code back to main without printing
+// anything more; the lesson already explained itself
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("lesson exited with status %d", e.code)
+}
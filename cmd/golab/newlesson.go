@@ -0,0 +1,263 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// newLessonFiles are the templates golab new-lesson fills in. Everything
+// under lesson/ lands in the new lesson directory and cmd/main.go.tmpl
+// becomes cmd/lessonNN/main.go; the .tmpl suffix is dropped.
+//
+//go:embed newlesson
+var newLessonFiles embed.FS
+
+// newLessonData is what the templates can refer to
+type newLessonData struct {
+	Number int
+	Num    string // two digits, e.g. "20"
+	ID     string // package and command name, e.g. "lesson20"
+	Dir    string // e.g. "lesson20-generics"
+	Title  string
+}
+
+// runNewLesson implements golab new-lesson
+func runNewLesson(args []string) error {
+	flags := flag.NewFlagSet("new-lesson", flag.ContinueOnError)
+	number := flags.Int("number", 0, "lesson number (default: one after the last lesson)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `Usage: golab new-lesson [-number N] "Topic Name"`)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New(`give the title as one argument, e.g. golab new-lesson "Generics"`)
+	}
+	title := strings.TrimSpace(flags.Arg(0))
+	if err := checkTitle(title); err != nil {
+		return err
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	if *number == 0 {
+		*number = 1
+		if len(lessons) > 0 {
+			*number = lessons[len(lessons)-1].Number + 1
+		}
+	}
+	if *number < 1 || *number > 99 {
+		return fmt.Errorf("lesson number %d is out of range 1-99", *number)
+	}
+	for _, lesson := range lessons {
+		if lesson.Number == *number {
+			return fmt.Errorf("lesson %02d already exists: %s", *number, lesson.Dir)
+		}
+	}
+
+	data := newLessonData{
+		Number: *number,
+		Num:    fmt.Sprintf("%02d", *number),
+		ID:     fmt.Sprintf("lesson%02d", *number),
+		Title:  title,
+	}
+	data.Dir = data.ID + "-" + slugify(title)
+
+	created, err := scaffoldLesson(root, data)
+	if err != nil {
+		return err
+	}
+	for _, name := range created {
+		fmt.Printf("  created %s\n", name)
+	}
+	if err := registerLesson(root, data.Number); err != nil {
+		return err
+	}
+	fmt.Printf("  updated %s\n", registryFile)
+	fmt.Printf("\nLesson %s: %s is ready. First fill in its topics, difficulty and\n", data.Num, data.Title)
+	fmt.Println("prerequisites in its new entry in the registry, which golab path uses. Then:")
+	steps := [][2]string{
+		{"go run ./cmd/golab run " + data.Num, "see it run"},
+		{"go test ./" + data.Dir, "check its golden output"},
+		{"go run ./cmd/golab verify --solutions " + data.Num, "check the exercises"},
+	}
+	width := 0
+	for _, step := range steps {
+		width = max(width, len(step[0]))
+	}
+	for _, step := range steps {
+		fmt.Printf("  %-*s  # %s\n", width, step[0], step[1])
+	}
+	fmt.Println("After changing what Demo prints, refresh the golden file with go test -update.")
+	fmt.Println("Give it a coverage minimum in coverageMinimums in cmd/golab/lessons.go, and if")
+	fmt.Println("it starts a server, add it to the servers table there too.")
+	return nil
+}
+
+// registryFile is the source file holding the lesson registry
+var registryFile = filepath.Join("cmd", "golab", "registry.go")
+
+// registerLesson adds an entry for lesson number to the registry, in
+// order, for the instructor to fill in; golab picks it up the next time
+// it is built
+func registerLesson(root string, number int) error {
+	path := filepath.Join(root, registryFile)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	const start = "var registry = map[int]LessonInfo{\n"
+	begin := strings.Index(string(src), start)
+	if begin < 0 {
+		return fmt.Errorf("%s has no %q", registryFile, strings.TrimSpace(start))
+	}
+	begin += len(start)
+	end := strings.Index(string(src[begin:]), "\n}\n")
+	if end < 0 {
+		return fmt.Errorf("%s: the registry never ends", registryFile)
+	}
+	end += begin + 1
+
+	// Entries are one per line, "N: {...},", sorted by N
+	at := end
+	for i := begin; i < end; {
+		line, _, _ := strings.Cut(string(src[i:end]), "\n")
+		var n int
+		if _, err := fmt.Sscanf(strings.TrimSpace(line), "%d:", &n); err == nil {
+			if n == number {
+				return nil
+			}
+			if n > number {
+				at = i
+				break
+			}
+		}
+		i += len(line) + 1
+	}
+	entry := fmt.Sprintf("\t%d: {Difficulty: Unrated}, // TODO: topics, difficulty and prerequisites\n", number)
+	out := append(append(append([]byte{}, src[:at]...), entry...), src[at:]...)
+	if out, err = format.Source(out); err != nil {
+		return fmt.Errorf("%s: %w", registryFile, err)
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+// checkTitle rejects titles that would break the generated Go source or
+// the one-line header golab list reads
+func checkTitle(title string) error {
+	if title == "" {
+		return errors.New("the title is empty")
+	}
+	if strings.ContainsAny(title, "\"`\\\n\r") {
+		return fmt.Errorf("the title %q can't contain quotes, backslashes or newlines", title)
+	}
+	if slugify(title) == "" {
+		return fmt.Errorf("the title %q needs at least one letter or digit", title)
+	}
+	return nil
+}
+
+// slugify turns "JSON & REST APIs" into "json-rest-apis" for the directory
+// name, matching lessonDirPattern
+func slugify(title string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return slug.String()
+}
+
+// scaffoldLesson renders every template and writes the results, returning
+// the paths it created relative to root. It never overwrites a file.
+func scaffoldLesson(root string, data newLessonData) ([]string, error) {
+	type output struct {
+		path string
+		data []byte
+	}
+	var outputs []output
+
+	// Render everything before writing anything, so a broken template
+	// doesn't leave half a lesson behind
+	err := fs.WalkDir(newLessonFiles, "newlesson", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel := strings.TrimSuffix(strings.TrimPrefix(name, "newlesson/"), ".tmpl")
+		var target string
+		switch {
+		case strings.HasPrefix(rel, "lesson/"):
+			target = path.Join(data.Dir, strings.TrimPrefix(rel, "lesson/"))
+		case rel == "cmd/main.go":
+			target = path.Join("cmd", data.ID, "main.go")
+		default:
+			return fmt.Errorf("unexpected template %s", name)
+		}
+
+		tmpl, err := template.ParseFS(newLessonFiles, name)
+		if err != nil {
+			return err
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, data); err != nil {
+			return err
+		}
+		src := []byte(out.String())
+		if strings.HasSuffix(target, ".go") {
+			if src, err = format.Source(src); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		outputs = append(outputs, output{filepath.FromSlash(target), src})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{data.Dir, filepath.Join("cmd", data.ID)} {
+		if _, err := os.Stat(filepath.Join(root, dir)); err == nil {
+			return nil, fmt.Errorf("%s already exists", dir)
+		}
+	}
+
+	var created []string
+	for _, out := range outputs {
+		target := filepath.Join(root, out.path)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return created, err
+		}
+		if err := os.WriteFile(target, out.data, 0o644); err != nil {
+			return created, err
+		}
+		created = append(created, out.path)
+	}
+	return created, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestNewLessonThenVerify scaffolds a lesson in a copy of the repository's
+// skeleton and verifies it straight away, as an instructor would
+func TestNewLessonThenVerify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test on the new lesson")
+	}
+	repo, err := findRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrySrc, err := os.ReadFile(filepath.Join(repo, registryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module "+modulePath+"\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "cmd", "golab"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, registryFile), registrySrc, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// 98 goes at the end of the registry, then 50 before it
+	for _, number := range []string{"98", "50"} {
+		if err := runNewLesson([]string{"-number", number, "Scaffold Check"}); err != nil {
+			t.Fatalf("new-lesson %s: %v", number, err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(root, registryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := string(got)
+	twenty, fifty, ninetyEight := strings.Index(registry, "\n\t20: "), strings.Index(registry, "\n\t50: {Difficulty: Unrated}"), strings.Index(registry, "\n\t98: {Difficulty: Unrated}")
+	if twenty < 0 || fifty < twenty || ninetyEight < fifty {
+		t.Errorf("the registry should have new entries for 50 and 98, in order, after 20:\n%s", registry)
+	}
+	if err := registerLesson(root, 98); err != nil {
+		t.Errorf("registering 98 again: %v", err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(root, registryFile)); string(again) != registry {
+		t.Error("registering a lesson twice changed the registry")
+	}
+
+	// The binary's registry has no lesson 98, which verify only warns about
+	if err := runVerify([]string{"-solutions", "98"}); err != nil {
+		t.Errorf("verify -solutions 98 after new-lesson: %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// progressEnv overrides where progress is saved, e.g. to keep several
+// students' progress apart on a shared machine
+const progressEnv = "GOLAB_PROGRESS_FILE"
+
+// Progress is everything golab remembers about one student
+type Progress struct {
+	Lessons map[string]*LessonProgress `json:"lessons"` // keyed by Lesson.ID()
+}
+
+// LessonProgress tracks one lesson. A lesson with exercises is complete
+// once they all pass; any other lesson once it has been run.
+type LessonProgress struct {
+	Runs        int                          `json:"runs,omitempty"`
+	LastRun     *time.Time                   `json:"last_run,omitempty"`
+	Verifies    int                          `json:"verifies,omitempty"`
+	LastVerify  *VerifyRecord                `json:"last_verify,omitempty"`
+	Exercises   map[string]*ExerciseProgress `json:"exercises,omitempty"`
+	CompletedAt *time.Time                   `json:"completed_at,omitempty"`
+}
+
+// VerifyRecord is the summary of one golab verify run
+type VerifyRecord struct {
+	At         time.Time `json:"at"`
+	Passed     int       `json:"passed"`
+	Total      int       `json:"total"`
+	BuildError bool      `json:"build_error,omitempty"`
+}
+
+// ExerciseProgress tracks one exercise across verify runs
+type ExerciseProgress struct {
+	Passed      bool       `json:"passed"`
+	FirstPassed *time.Time `json:"first_passed,omitempty"`
+}
+
+// progressPath is $GOLAB_PROGRESS_FILE, or golab/progress.json in the
+// user's config directory (~/.config on Linux, AppData on Windows)
+func progressPath() (string, error) {
+	if path := os.Getenv(progressEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding a place to save progress (set %s): %w", progressEnv, err)
+	}
+	return filepath.Join(dir, "golab", "progress.json"), nil
+}
+
+// loadProgress reads the progress file. A missing file is a new student.
+func loadProgress(path string) (*Progress, error) {
+	progress := &Progress{Lessons: make(map[string]*LessonProgress)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, progress); err != nil {
+		return nil, fmt.Errorf("%s is corrupt (delete it to start over): %w", path, err)
+	}
+	if progress.Lessons == nil {
+		progress.Lessons = make(map[string]*LessonProgress)
+	}
+	return progress, nil
+}
+
+// save writes the file atomically, so an interrupted golab never leaves
+// half a progress file behind
+func (p *Progress) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".progress-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (p *Progress) lesson(lesson Lesson) *LessonProgress {
+	entry, ok := p.Lessons[lesson.ID()]
+	if !ok {
+		entry = &LessonProgress{}
+		p.Lessons[lesson.ID()] = entry
+	}
+	return entry
+}
+
+// status sums up a lesson as "not started", "started" or "complete"
+func (p *Progress) status(lesson Lesson) string {
+	entry := p.Lessons[lesson.ID()]
+	switch {
+	case entry == nil:
+		return "not started"
+	case entry.CompletedAt != nil:
+		return "complete"
+	default:
+		return "started"
+	}
+}
+
+// recordRun notes that the student ran a lesson
+func (p *Progress) recordRun(lesson Lesson, now time.Time) {
+	entry := p.lesson(lesson)
+	entry.Runs++
+	entry.LastRun = &now
+	if !lesson.Exercises && entry.CompletedAt == nil {
+		entry.CompletedAt = &now
+	}
+}
+
+// recordVerify stores the result of golab verify for a lesson
+func (p *Progress) recordVerify(result VerifyResult, now time.Time) {
+	entry := p.lesson(result.Lesson)
+	entry.Verifies++
+	entry.LastVerify = &VerifyRecord{
+		At:         now,
+		Passed:     result.Passed(),
+		Total:      len(result.Exercises),
+		BuildError: result.BuildError != "",
+	}
+	if result.BuildError != "" {
+		return // says nothing about individual exercises
+	}
+
+	if entry.Exercises == nil {
+		entry.Exercises = make(map[string]*ExerciseProgress)
+	}
+	for _, exercise := range result.Exercises {
+		state, ok := entry.Exercises[exercise.Name]
+		if !ok {
+			state = &ExerciseProgress{}
+			entry.Exercises[exercise.Name] = state
+		}
+		state.Passed = exercise.Passed
+		if exercise.Passed && state.FirstPassed == nil {
+			state.FirstPassed = &now
+		}
+	}
+	if result.Complete() && entry.CompletedAt == nil {
+		entry.CompletedAt = &now
+	}
+}
+
+// updateProgress loads, changes and saves progress in one go. Failing to
+// save is reported but never fails the command that triggered it.
+func updateProgress(change func(*Progress)) {
+	path, err := progressPath()
+	if err == nil {
+		var progress *Progress
+		if progress, err = loadProgress(path); err == nil {
+			change(progress)
+			err = progress.save(path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "golab: could not save progress: %v\n", err)
+	}
+}
+
+// runProgress implements golab progress
+func runProgress(args []string) error {
+	flags := flag.NewFlagSet("progress", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the raw progress file")
+	reset := flags.Bool("reset", false, "forget all progress")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := progressPath()
+	if err != nil {
+		return err
+	}
+	if *reset {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Println("Progress reset.")
+		return nil
+	}
+
+	progress, err := loadProgress(path)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(progress, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	printDashboard(root, lessons, progress, path, time.Now())
+	return nil
+}
+
+func printDashboard(root string, lessons []Lesson, progress *Progress, path string, now time.Time) {
+	fmt.Printf("Go Lab progress (%s)\n\n", path)
+
+	completed, passing, exercises := 0, 0, 0
+	for _, lesson := range lessons {
+		entry := progress.Lessons[lesson.ID()]
+
+		status, detail := "not started", ""
+		switch {
+		case entry == nil:
+		case entry.CompletedAt != nil:
+			status = "complete"
+			detail = "finished " + ago(now, *entry.CompletedAt)
+			completed++
+		default:
+			status = "started"
+		}
+
+		if entry != nil && entry.LastVerify != nil {
+			verify := entry.LastVerify
+			result := fmt.Sprintf("%d/%d exercises", verify.Passed, verify.Total)
+			if verify.BuildError {
+				result = "did not compile"
+			}
+			detail = fmt.Sprintf("%s, verified %s", result, ago(now, verify.At))
+		} else if entry != nil && entry.LastRun != nil && status != "complete" {
+			detail = "ran " + ago(now, *entry.LastRun)
+		}
+
+		if lesson.Exercises {
+			exercises += countExercises(root, lesson)
+			if entry != nil {
+				for _, state := range entry.Exercises {
+					if state.Passed {
+						passing++
+					}
+				}
+			}
+			if entry == nil || entry.LastVerify == nil {
+				detail = "exercises not verified yet"
+			}
+		}
+
+		line := fmt.Sprintf("  %02d  %-44s %-12s %s", lesson.Number, truncate(lesson.Title, 44), status, detail)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+
+	fmt.Printf("\nLessons complete:  %2d/%-3d %s\n", completed, len(lessons), progressBar(completed, len(lessons)))
+	fmt.Printf("Exercises passing: %2d/%-3d %s\n", passing, exercises, progressBar(passing, exercises))
+}
+
+// countExercises counts the TestXxx functions in a lesson's exercise
+// tests, so lessons that were never verified still count towards the total
+func countExercises(root string, lesson Lesson) int {
+	files, _ := filepath.Glob(filepath.Join(root, lesson.Dir, "exercises", "*_test.go"))
+	count := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "func Test") {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// ago formats t relative to now for the dashboard
+func ago(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 7*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+func truncate(s string, max int) string {
+	if len([]rune(s)) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-3]) + "..."
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Difficulty says how much Go a lesson expects a student to know already
+type Difficulty int
+
+const (
+	Unrated Difficulty = iota
+	Beginner
+	Intermediate
+	Advanced
+)
+
+func (d Difficulty) String() string {
+	switch d {
+	case Beginner:
+		return "beginner"
+	case Intermediate:
+		return "intermediate"
+	case Advanced:
+		return "advanced"
+	default:
+		return "unrated"
+	}
+}
+
+// LessonInfo is what the registry records about a lesson. Its title and
+// description come from the header in its main.go instead, where the
+// lesson declares them itself.
+type LessonInfo struct {
+	Topics     []string
+	Difficulty Difficulty
+	// Prereqs are the lessons whose material this one uses directly;
+	// what they build on is implied
+	Prereqs []int
+}
+
+// registry describes every lesson for golab path. Keep Prereqs to direct
+// dependencies, on lessons with lower numbers, so the graph stays
+// readable and acyclic.
+var registry = map[int]LessonInfo{
+	1:  {Topics: []string{"packages", "fmt", "go run"}, Difficulty: Beginner},
+	2:  {Topics: []string{"types", "constants", "slices", "maps"}, Difficulty: Beginner, Prereqs: []int{1}},
+	3:  {Topics: []string{"functions", "methods", "closures"}, Difficulty: Beginner, Prereqs: []int{2}},
+	4:  {Topics: []string{"structs", "interfaces", "embedding"}, Difficulty: Beginner, Prereqs: []int{3}},
+	5:  {Topics: []string{"pointers", "escape analysis"}, Difficulty: Beginner, Prereqs: []int{4}},
+	6:  {Topics: []string{"if", "for", "switch", "range"}, Difficulty: Beginner, Prereqs: []int{2}},
+	7:  {Topics: []string{"errors", "wrapping", "panic", "recover"}, Difficulty: Intermediate, Prereqs: []int{4, 6}},
+	8:  {Topics: []string{"goroutines", "channels", "select", "sync"}, Difficulty: Intermediate, Prereqs: []int{3, 6}},
+	9:  {Topics: []string{"net/http", "routing", "middleware"}, Difficulty: Intermediate, Prereqs: []int{7, 8}},
+	10: {Topics: []string{"encoding/json", "REST", "validation"}, Difficulty: Intermediate, Prereqs: []int{5, 9}},
+	11: {Topics: []string{"MongoDB", "BSON", "context"}, Difficulty: Advanced, Prereqs: []int{10}},
+	12: {Topics: []string{"S3", "streaming uploads", "presigned URLs"}, Difficulty: Advanced, Prereqs: []int{10}},
+	13: {Topics: []string{"containers", "config", "signals"}, Difficulty: Intermediate, Prereqs: []int{10}},
+	14: {Topics: []string{"Kubernetes", "probes", "graceful shutdown"}, Difficulty: Advanced, Prereqs: []int{13}},
+	15: {Topics: []string{"WebSocket", "hub pattern", "keepalive"}, Difficulty: Advanced, Prereqs: []int{9}},
+	16: {Topics: []string{"storage", "redirects", "expiry"}, Difficulty: Intermediate, Prereqs: []int{10}},
+	17: {Topics: []string{"TLS", "certificates", "mTLS"}, Difficulty: Advanced, Prereqs: []int{9}},
+	18: {Topics: []string{"OAuth2", "PKCE", "token refresh"}, Difficulty: Advanced, Prereqs: []int{10}},
+	19: {Topics: []string{"overload", "concurrency limits", "AIMD"}, Difficulty: Advanced, Prereqs: []int{9}},
+	20: {Topics: []string{"go/ast", "go/types", "analyzers"}, Difficulty: Advanced, Prereqs: []int{4, 7}},
+}
+
+// checkRegistry returns an error naming the lessons that have no entry
+// in the registry, which golab path would show without topics or
+// prerequisites
+func checkRegistry(lessons []Lesson) error {
+	var missing []string
+	for _, lesson := range lessons {
+		if _, ok := registry[lesson.Number]; !ok {
+			missing = append(missing, fmt.Sprintf("%02d", lesson.Number))
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("lesson %s has no entry in the registry; list its topics, difficulty and prerequisites in cmd/golab/registry.go", missing[0])
+	default:
+		return fmt.Errorf("lessons %s have no entry in the registry; list their topics, difficulty and prerequisites in cmd/golab/registry.go", strings.Join(missing, ", "))
+	}
+}
+
+// learningPath orders lessons so every lesson comes after its
+// prerequisites, lower numbers first where the order is free. With
+// targets it returns only the targets and what they need.
+func learningPath(lessons []Lesson, targets []Lesson) ([]Lesson, error) {
+	byNumber := make(map[int]Lesson, len(lessons))
+	for _, lesson := range lessons {
+		byNumber[lesson.Number] = lesson
+	}
+	for _, lesson := range lessons {
+		for _, prereq := range lesson.Prereqs {
+			if _, ok := byNumber[prereq]; !ok {
+				return nil, fmt.Errorf("lesson %02d needs lesson %02d, which doesn't exist", lesson.Number, prereq)
+			}
+		}
+	}
+
+	// Narrow down to what the targets need, if there are any
+	wanted := make(map[int]bool)
+	var want func(number int)
+	want = func(number int) {
+		if wanted[number] {
+			return
+		}
+		wanted[number] = true
+		for _, prereq := range byNumber[number].Prereqs {
+			want(prereq)
+		}
+	}
+	for _, target := range targets {
+		want(target.Number)
+	}
+	if len(targets) == 0 {
+		for number := range byNumber {
+			wanted[number] = true
+		}
+	}
+
+	// lessons is sorted by number, so taking the first ready lesson on
+	// each pass puts lower numbers first
+	placed := make(map[int]bool)
+	var path []Lesson
+	for len(path) < len(wanted) {
+		progress := false
+		for _, lesson := range lessons {
+			if !wanted[lesson.Number] || placed[lesson.Number] || !allPlaced(lesson.Prereqs, placed) {
+				continue
+			}
+			placed[lesson.Number] = true
+			path = append(path, lesson)
+			progress = true
+			break
+		}
+		if !progress {
+			var stuck []string
+			for _, lesson := range lessons {
+				if wanted[lesson.Number] && !placed[lesson.Number] {
+					stuck = append(stuck, fmt.Sprintf("%02d", lesson.Number))
+				}
+			}
+			return nil, fmt.Errorf("lessons %s need each other; fix their Prereqs in cmd/golab/registry.go", strings.Join(stuck, ", "))
+		}
+	}
+	return path, nil
+}
+
+func allPlaced(numbers []int, placed map[int]bool) bool {
+	for _, number := range numbers {
+		if !placed[number] {
+			return false
+		}
+	}
+	return true
+}
+
+// missingPrereqs returns the lessons that lesson needs directly and the
+// student hasn't completed
+func missingPrereqs(lessons []Lesson, lesson Lesson, progress *Progress) []Lesson {
+	var missing []Lesson
+	for _, prereq := range lesson.Prereqs {
+		for _, other := range lessons {
+			if other.Number == prereq && progress.status(other) != "complete" {
+				missing = append(missing, other)
+			}
+		}
+	}
+	return missing
+}
+
+// warnPrereqs tells the student, without stopping them, that a lesson
+// builds on ones they haven't finished
+func warnPrereqs(w io.Writer, lessons []Lesson, selected []Lesson) {
+	path, err := progressPath()
+	if err != nil {
+		return
+	}
+	progress, err := loadProgress(path)
+	if err != nil {
+		return
+	}
+	for _, lesson := range selected {
+		missing := missingPrereqs(lessons, lesson, progress)
+		if len(missing) == 0 {
+			continue
+		}
+		names := make([]string, len(missing))
+		for i, prereq := range missing {
+			names[i] = fmt.Sprintf("%02d (%s)", prereq.Number, prereq.Title)
+		}
+		fmt.Fprintf(w, "golab: lesson %02d builds on lesson %s, which you haven't completed yet\n",
+			lesson.Number, strings.Join(names, " and "))
+	}
+}
+
+// runPath implements golab path
+func runPath(args []string) error {
+	flags := flag.NewFlagSet("path", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	var targets []Lesson
+	for _, name := range flags.Args() {
+		lesson, err := findLesson(lessons, name)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, lesson)
+	}
+	path, err := learningPath(lessons, targets)
+	if err != nil {
+		return err
+	}
+
+	progress := &Progress{Lessons: make(map[string]*LessonProgress)}
+	if file, err := progressPath(); err == nil {
+		if loaded, err := loadProgress(file); err == nil {
+			progress = loaded
+		}
+	}
+
+	if len(targets) > 0 {
+		fmt.Printf("Learning path to lesson %s (%d lessons):\n\n", lessonNumbers(targets), len(path))
+	} else {
+		fmt.Printf("Learning path through all %d lessons:\n\n", len(path))
+	}
+	var next *Lesson
+	for i, lesson := range path {
+		status := progress.status(lesson)
+		if next == nil && status != "complete" {
+			next = &path[i]
+		}
+		fmt.Printf("%3d. %02d  %-45s %-12s %s\n", i+1, lesson.Number, truncate(lesson.Title, 45), lesson.Difficulty, status)
+		if len(lesson.Topics) > 0 {
+			fmt.Printf("             %s\n", strings.Join(lesson.Topics, ", "))
+		}
+	}
+
+	if next == nil {
+		fmt.Println("\nYou've completed all of them.")
+		return nil
+	}
+	fmt.Printf("\nNext up: golab run %02d\n", next.Number)
+	return nil
+}
+
+func lessonNumbers(lessons []Lesson) string {
+	numbers := make([]string, len(lessons))
+	for i, lesson := range lessons {
+		numbers[i] = fmt.Sprintf("%02d", lesson.Number)
+	}
+	return strings.Join(numbers, ", ")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func numbers(lessons []Lesson) []int {
+	var ns []int
+	for _, lesson := range lessons {
+		ns = append(ns, lesson.Number)
+	}
+	return ns
+}
+
+// testLessons returns lessons numbered from prereqs, in order, the way
+// discoverLessons sorts them
+func testLessons(prereqs map[int][]int) []Lesson {
+	var lessons []Lesson
+	for number := 1; len(lessons) < len(prereqs); number++ {
+		if p, ok := prereqs[number]; ok {
+			lessons = append(lessons, Lesson{Number: number, LessonInfo: LessonInfo{Prereqs: p}})
+		}
+	}
+	return lessons
+}
+
+func TestLearningPathRegistry(t *testing.T) {
+	root, err := findRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRegistry(lessons); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := learningPath(lessons, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != len(lessons) {
+		t.Fatalf("path has %d lessons, want all %d", len(path), len(lessons))
+	}
+	placed := make(map[int]bool)
+	for _, lesson := range path {
+		for _, prereq := range lesson.Prereqs {
+			if !placed[prereq] {
+				t.Errorf("lesson %02d comes before its prerequisite %02d", lesson.Number, prereq)
+			}
+		}
+		placed[lesson.Number] = true
+	}
+
+	byNumber := make(map[int]Lesson)
+	for _, lesson := range lessons {
+		byNumber[lesson.Number] = lesson
+	}
+	tests := []struct {
+		targets []int
+		want    []int
+	}{
+		{[]int{1}, []int{1}},
+		{[]int{16}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 16}},
+		{[]int{20}, []int{1, 2, 3, 4, 6, 7, 20}},
+		{[]int{14, 11}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 14}},
+	}
+	for _, tt := range tests {
+		var targets []Lesson
+		for _, n := range tt.targets {
+			targets = append(targets, byNumber[n])
+		}
+		path, err := learningPath(lessons, targets)
+		if err != nil {
+			t.Errorf("path to %v: %v", tt.targets, err)
+			continue
+		}
+		if got := numbers(path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("path to %v = %v, want %v", tt.targets, got, tt.want)
+		}
+	}
+}
+
+func TestLearningPathOrder(t *testing.T) {
+	// 2 needs 3, so 3 moves ahead of it; 1 and 4 keep their places
+	lessons := testLessons(map[int][]int{1: nil, 2: {3}, 3: {1}, 4: {2}})
+	path, err := learningPath(lessons, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := numbers(path), []int{1, 3, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("path = %v, want %v", got, want)
+	}
+}
+
+func TestLearningPathErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		prereqs map[int][]int
+		want    string
+	}{
+		{"cycle", map[int][]int{1: nil, 2: {4}, 3: {2}, 4: {3}, 5: {1}}, "lessons 02, 03, 04 need each other"},
+		{"self", map[int][]int{1: {1}}, "lessons 01 need each other"},
+		{"unknown prerequisite", map[int][]int{1: nil, 2: {1, 7}}, "lesson 02 needs lesson 07, which doesn't exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := learningPath(testLessons(tt.prereqs), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, %v; want an error containing %q", numbers(path), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	if err := checkRegistry([]Lesson{{Number: 1}, {Number: 99}}); err == nil || !strings.Contains(err.Error(), "lesson 99 has no entry") {
+		t.Errorf("got %v, want an error naming lesson 99", err)
+	}
+	if err := checkRegistry([]Lesson{{Number: 1}, {Number: 98}, {Number: 99}}); err == nil || !strings.Contains(err.Error(), "lessons 98, 99 have no entry") {
+		t.Errorf("got %v, want an error naming lessons 98 and 99", err)
+	}
+}
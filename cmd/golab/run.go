@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang-lab/lab/demo"
+)
+
+const (
+	// readyTimeout is how long a server lesson gets to start listening
+	readyTimeout = 60 * time.Second
+	// stopTimeout is how long a lesson gets to shut down after a signal
+	// before it is killed
+	stopTimeout = 10 * time.Second
+)
+
+// runRun implements golab run. The lesson is built first and the binary is
+// started directly, not through go run, so that signals reach the lesson
+// itself and its exit status comes back unchanged.
+func runRun(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	port := flags.Int("port", 0, "port for a server lesson (default: its usual port, or a free one if that is busy)")
+	deterministic := flags.Bool("deterministic", false, "fix random numbers and the clock so the lesson prints the same every run")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: golab run [-port N] [-deterministic] <lesson> [-- lesson flags]")
+		flags.PrintDefaults()
+	}
+
+	// Allow the lesson before the flags too: golab run 16 -port 9000
+	var name string
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		name, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	rest := flags.Args()
+	if name == "" {
+		if len(rest) == 0 {
+			flags.Usage()
+			return errors.New("which lesson? try golab list")
+		}
+		name, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	lesson, err := findLesson(lessons, name)
+	if err != nil {
+		return err
+	}
+
+	var env []string
+	servePort := 0
+	if lesson.Server != nil {
+		var portArgs []string
+		servePort, portArgs, env, err = choosePort(lesson, *port, os.Stdout)
+		if err != nil {
+			return err
+		}
+		rest = append(portArgs, rest...)
+	} else if *port != 0 {
+		return fmt.Errorf("lesson %02d is not a server lesson; -port does not apply", lesson.Number)
+	}
+
+	if *deterministic {
+		env = append(env, demo.EnvVar+"=1")
+	}
+
+	binary, cleanup, err := buildLesson(root, lesson, os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	updateProgress(func(p *Progress) { p.recordRun(lesson, time.Now()) })
+	fmt.Printf("golab: running lesson %02d: %s\n\n", lesson.Number, lesson.Title)
+	cmd := exec.Command(binary, rest...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return supervise(cmd, lesson, servePort)
+}
+
+// choosePort decides which port a server lesson listens on. An explicit
+// -port wins; otherwise the lesson's usual port is kept unless something
+// else already has it. Notes for the user go to out.
+func choosePort(lesson Lesson, requested int, out io.Writer) (port int, args, env []string, err error) {
+	spec := lesson.Server
+	port = spec.Port
+	switch {
+	case requested != 0:
+		port = requested
+	case !portFree(spec.Port) && spec.Configure != nil:
+		if port, err = freePort(); err != nil {
+			return 0, nil, nil, err
+		}
+		fmt.Fprintf(out, "golab: port %d is busy, using %d instead\n", spec.Port, port)
+	}
+
+	if port != spec.Port {
+		if spec.Configure == nil {
+			return 0, nil, nil, fmt.Errorf("lesson %02d always listens on port %d", lesson.Number, spec.Port)
+		}
+		args, env = spec.Configure(port)
+	}
+	if !portFree(port) {
+		return 0, nil, nil, fmt.Errorf("port %d is already in use; stop whatever is listening there or pass -port", port)
+	}
+	return port, args, env, nil
+}
+
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// freePort asks the kernel for an unused port. Another process could take
+// it before the lesson binds it, but for local development that is rare.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// buildLesson compiles cmd/lessonNN into a temporary directory. Compiler
+// errors are written to out.
+func buildLesson(root string, lesson Lesson, out io.Writer) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "golab-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	binary := filepath.Join(dir, lesson.ID())
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	build := exec.Command("go", "build", "-o", binary, "./cmd/"+lesson.ID())
+	build.Dir = root
+	build.Stdout, build.Stderr = out, out
+	if err := build.Run(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("building %s: %w", lesson.ID(), err)
+	}
+	return binary, cleanup, nil
+}
+
+// supervise runs the lesson until it exits. For server lessons it also
+// announces when the port accepts connections.
+//
+// Ctrl+C in a terminal is delivered to golab and the lesson alike, so golab
+// only waits for the lesson to finish its own graceful shutdown. SIGTERM
+// is forwarded. A lesson still running stopTimeout after either signal,
+// or after a second Ctrl+C, is killed.
+func supervise(cmd *exec.Cmd, lesson Lesson, port int) error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	exited := make(chan struct{})
+	go func() {
+		done <- cmd.Wait()
+		close(exited)
+	}()
+
+	if lesson.Server != nil {
+		go announceWhenReady(lesson, port, exited)
+	}
+
+	var stopping <-chan time.Time
+	for {
+		select {
+		case err := <-done:
+			return exitStatus(err, stopping != nil)
+		case sig := <-signals:
+			if stopping != nil {
+				cmd.Process.Kill()
+				continue
+			}
+			if sig != os.Interrupt {
+				if err := cmd.Process.Signal(sig); err != nil {
+					cmd.Process.Kill()
+				}
+			}
+			stopping = time.After(stopTimeout)
+		case <-stopping:
+			fmt.Fprintf(os.Stderr, "golab: lesson %02d did not stop within %s, killing it\n", lesson.Number, stopTimeout)
+			cmd.Process.Kill()
+		}
+	}
+}
+
+func announceWhenReady(lesson Lesson, port int, exited <-chan struct{}) {
+	if url, ok := waitForServer(lesson, port, exited); ok {
+		fmt.Printf("\ngolab: lesson %02d is listening on %s (Ctrl+C to stop)\n\n", lesson.Number, url)
+	}
+}
+
+// waitForServer polls a server lesson's port and returns its URL once it
+// accepts connections. It gives up if the lesson exits first, e.g.
+// lesson 19 with -loadtest, or after readyTimeout.
+func waitForServer(lesson Lesson, port int, exited <-chan struct{}) (string, bool) {
+	addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+	deadline := time.Now().Add(readyTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return lesson.Server.Scheme + "://" + addr, true
+		}
+		select {
+		case <-exited:
+			return "", false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return "", false
+}
+
+// exitStatus turns the lesson's result into golab's. A lesson that was
+// stopped on request has done nothing wrong.
+func exitStatus(err error, stopped bool) error {
+	if err == nil {
+		return nil
+	}
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return err
+	}
+	if stopped {
+		return nil
+	}
+	return exitError{code: exit.ExitCode()}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits for one snippet. The compile limit is generous because the first
+// build after a Go upgrade has to rebuild the standard library.
+const (
+	maxSnippetSource = 64 << 10
+	maxSnippetOutput = 64 << 10 // per stream
+	snippetCompile   = 60 * time.Second
+	snippetRun       = 5 * time.Second
+	maxSnippets      = 2 // compiling or running at the same time
+)
+
+// blockedImports are packages a playground snippet may not use. Snippets
+// are for trying out language features; these reach outside the process.
+// net and everything under it is blocked too (see blockedImport), and so
+// is os, but for the few names in allowedOS. This keeps honest mistakes
+// contained, but it is not a security boundary: only run the hub on a
+// machine you trust, bound to localhost.
+var blockedImports = map[string]string{
+	"C":           "cgo is disabled",
+	"io/ioutil":   "snippets can't use files",
+	"log/syslog":  "snippets can't use the network",
+	"os/exec":     "snippets can't start programs",
+	"os/signal":   "snippets can't handle signals",
+	"plugin":      "snippets can't load plugins",
+	"syscall":     "snippets can't make system calls",
+	"unsafe":      "snippets can't use unsafe",
+	"runtime/cgo": "cgo is disabled",
+}
+
+// blockedImport returns why path can't be imported, or "" if it can
+func blockedImport(path string) string {
+	if path == "net" || strings.HasPrefix(path, "net/") {
+		return "snippets can't use the network"
+	}
+	return blockedImports[path]
+}
+
+// allowedOS is what a snippet may use from os: its arguments, exiting,
+// and the standard streams. The rest of os reads and writes files and
+// starts programs (os.StartProcess), which os/exec only wraps.
+var allowedOS = map[string]bool{
+	"Args":   true,
+	"Exit":   true,
+	"Getenv": true,
+	"Stdin":  true,
+	"Stdout": true,
+	"Stderr": true,
+}
+
+// SnippetResult is the JSON answer to POST /api/snippets
+type SnippetResult struct {
+	// Status is "finished", "exited", "compile error", "timed out" or
+	// "rejected"
+	Status     string `json:"status"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// snippetRunner compiles and runs Go snippets for the hub's playground.
+// Each snippet gets its own temporary directory and a stripped-down
+// environment, so it sees none of the student's variables or files.
+type snippetRunner struct {
+	goTool     string
+	cache      string // shared GOCACHE, so repeat builds take a moment
+	slots      chan struct{}
+	runTimeout time.Duration // snippetRun, but tests wait less
+}
+
+func newSnippetRunner() (*snippetRunner, error) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		return nil, fmt.Errorf("the playground needs the go command: %w", err)
+	}
+	cache, err := exec.Command(goTool, "env", "GOCACHE").Output()
+	if err != nil {
+		return nil, fmt.Errorf("finding the Go build cache: %w", err)
+	}
+	return &snippetRunner{
+		goTool:     goTool,
+		cache:      strings.TrimSpace(string(cache)),
+		slots:      make(chan struct{}, maxSnippets),
+		runTimeout: snippetRun,
+	}, nil
+}
+
+// POST /api/snippets {"source": "package main ..."}
+//
+// Like POST /api/runs this only accepts JSON, so other websites can't
+// make a visitor's browser run code.
+func (s *snippetRunner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		hubJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		hubJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "expected application/json"})
+		return
+	}
+	var req struct {
+		Source string `json:"source"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSnippetSource+1024)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		hubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON or snippet too large"})
+		return
+	}
+	if len(req.Source) > maxSnippetSource {
+		hubJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "snippet too large"})
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		hubJSON(w, http.StatusTooManyRequests, map[string]string{"error": "the playground is busy, try again"})
+		return
+	}
+
+	result, err := s.run(r.Context(), req.Source)
+	if err != nil {
+		hubJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	hubJSON(w, http.StatusOK, result)
+}
+
+// run compiles source in a fresh directory and runs the binary. It builds
+// and runs in two steps rather than with go run: killing go run on a
+// timeout would leave the program it started still running.
+func (s *snippetRunner) run(ctx context.Context, source string) (SnippetResult, error) {
+	start := time.Now()
+	if reason := checkSnippet(source); reason != "" {
+		return SnippetResult{Status: "rejected", Stderr: reason + "\n", ExitCode: -1}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "golab-snippet-")
+	if err != nil {
+		return SnippetResult{}, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0o600); err != nil {
+		return SnippetResult{}, err
+	}
+	binary := filepath.Join(dir, "snippet")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	buildCtx, cancel := context.WithTimeout(ctx, snippetCompile)
+	defer cancel()
+	build := exec.CommandContext(buildCtx, s.goTool, "build", "-o", binary, "main.go")
+	build.Dir = dir
+	build.Env = s.buildEnv(dir)
+	buildOutput := &cappedBuffer{max: maxSnippetOutput}
+	build.Stdout, build.Stderr = buildOutput, buildOutput
+	if err := build.Run(); err != nil {
+		result := SnippetResult{Status: "compile error", ExitCode: -1, Truncated: buildOutput.truncated}
+		result.Stderr = strings.ReplaceAll(buildOutput.String(), dir+string(filepath.Separator), "./")
+		if buildCtx.Err() != nil {
+			result.Status = "timed out"
+			result.Stderr += fmt.Sprintf("compiling took longer than %v\n", snippetCompile)
+		}
+		result.DurationMS = time.Since(start).Milliseconds()
+		return result, nil
+	}
+
+	runCtx, cancelRun := context.WithTimeout(ctx, s.runTimeout)
+	defer cancelRun()
+	program := exec.CommandContext(runCtx, binary)
+	program.Dir = dir
+	program.Env = s.runEnv(dir)
+	stdout := &cappedBuffer{max: maxSnippetOutput}
+	stderr := &cappedBuffer{max: maxSnippetOutput}
+	program.Stdout, program.Stderr = stdout, stderr
+	// Don't wait forever for output from anything the snippet left behind
+	program.WaitDelay = time.Second
+	runErr := program.Run()
+
+	result := SnippetResult{
+		Status:     "finished",
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		Truncated:  stdout.truncated || stderr.truncated,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	var exit *exec.ExitError
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded:
+		result.Status, result.ExitCode = "timed out", -1
+		if result.Stderr != "" && !strings.HasSuffix(result.Stderr, "\n") {
+			result.Stderr += "\n"
+		}
+		result.Stderr += fmt.Sprintf("program ran longer than %v and was stopped\n", s.runTimeout)
+	case errors.As(runErr, &exit):
+		result.Status, result.ExitCode = "exited", exit.ExitCode()
+	case runErr != nil:
+		return SnippetResult{}, runErr
+	}
+	return result, nil
+}
+
+// checkSnippet returns why source can't be run, or "" if it can. Syntax
+// errors are left for the compiler, which explains them better.
+func checkSnippet(source string) string {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", source, 0)
+	if err != nil {
+		return ""
+	}
+	if file.Name.Name != "main" {
+		return "a snippet must be package main with a func main"
+	}
+	osName := ""
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if reason := blockedImport(path); reason != "" {
+			return fmt.Sprintf("import %q is not allowed: %s", path, reason)
+		}
+		if path != "os" {
+			continue
+		}
+		osName = "os"
+		if spec.Name != nil {
+			osName = spec.Name.Name
+		}
+		if osName == "." || osName == "_" {
+			return fmt.Sprintf("import %s \"os\" is not allowed: import it by name", osName)
+		}
+	}
+	if osName == "" {
+		return ""
+	}
+	// Every use of os is a selector, os.Name, since a package can't be
+	// used any other way
+	var reason string
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok || reason != "" {
+			return reason == ""
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == osName && !allowedOS[sel.Sel.Name] {
+			reason = fmt.Sprintf("os.%s is not allowed: snippets can only use os.Args, os.Exit, os.Getenv and the standard streams", sel.Sel.Name)
+		}
+		return true
+	})
+	return reason
+}
+
+// buildEnv gives the go command what it needs and nothing else: no
+// network for modules, no cgo, and only the standard library
+func (s *snippetRunner) buildEnv(dir string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"GOCACHE=" + s.cache,
+		"GOPATH=" + filepath.Join(dir, "gopath"),
+		"GOPROXY=off",
+		"GOTOOLCHAIN=local",
+		"GOWORK=off",
+		"GOFLAGS=",
+		"CGO_ENABLED=0",
+	}
+	return append(env, windowsEnv()...)
+}
+
+// runEnv is the snippet's whole environment
+func (s *snippetRunner) runEnv(dir string) []string {
+	return append([]string{"HOME=" + dir, "TMPDIR=" + dir}, windowsEnv()...)
+}
+
+// windowsEnv keeps the variables Windows programs can't start without
+func windowsEnv() []string {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	var env []string
+	for _, name := range []string{"SystemRoot", "TEMP", "TMP", "LOCALAPPDATA"} {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// cappedBuffer keeps the first max bytes written to it and quietly drops
+// the rest, so a snippet printing in a loop can't fill the hub's memory
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	if room := b.max - len(b.buf); n > room {
+		p = p[:max(room, 0)]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil // a short write would make exec give up on the pipe
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return string(completeUTF8(b.buf)) + "\n[output truncated]\n"
+	}
+	return string(b.buf)
+}
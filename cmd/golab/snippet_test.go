@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSnippet(t *testing.T) {
+	tests := []struct {
+		name, source string
+		wantReason   string // a part of it; "" means the snippet is allowed
+	}{
+		{"hello", `package main; import "fmt"; func main() { fmt.Println("hi") }`, ""},
+		{"not main", `package lesson; func F() {}`, "must be package main"},
+		{"syntax error", `package main; func main() {`, ""},
+		{"os/exec", `package main; import "os/exec"; func main() { exec.Command("ls").Run() }`, `import "os/exec" is not allowed`},
+		{"net/http", `package main; import "net/http"; func main() { http.Get("http://example.com") }`, "network"},
+		{"net", `package main; import "net"; func main() { net.Dial("tcp", "example.com:80") }`, "network"},
+		{"net/smtp", `package main; import "net/smtp"; func main() { smtp.SendMail("example.com:25", nil, "a@example.com", nil, nil) }`, "network"},
+		{"net/rpc", `package main; import "net/rpc"; func main() { rpc.Dial("tcp", "example.com:1234") }`, "network"},
+		{"net/http/httptest", `package main; import "net/http/httptest"; func main() { httptest.NewServer(nil) }`, "network"},
+		{"net/http/httputil", `package main; import "net/http/httputil"; func main() { httputil.NewSingleHostReverseProxy(nil) }`, "network"},
+		{"log/syslog", `package main; import "log/syslog"; func main() { syslog.Dial("udp", "example.com:514", syslog.LOG_INFO, "x") }`, "network"},
+		{"io/ioutil", `package main; import "io/ioutil"; func main() { ioutil.WriteFile("x", nil, 0o644) }`, "files"},
+		{"unsafe", `package main; import "unsafe"; func main() { _ = unsafe.Sizeof(0) }`, "unsafe"},
+		{"cgo", `package main; import "C"; func main() {}`, "cgo"},
+		{"os streams", `package main; import ("fmt"; "os"); func main() { fmt.Fprintln(os.Stderr, os.Args, os.Getenv("HOME")); os.Exit(2) }`, ""},
+		{"os.StartProcess", `package main; import "os"; func main() { os.StartProcess("/bin/sh", nil, &os.ProcAttr{}) }`, "os.StartProcess is not allowed"},
+		{"os.Remove", `package main; import "os"; func main() { os.Remove("x") }`, "os.Remove is not allowed"},
+		{"os renamed", `package main; import sys "os"; func main() { sys.StartProcess("/bin/sh", nil, nil) }`, "os.StartProcess is not allowed"},
+		{"os dot import", `package main; import . "os"; func main() { StartProcess("/bin/sh", nil, nil) }`, `import . "os" is not allowed`},
+		{"os blank import", `package main; import _ "os"; func main() {}`, `import _ "os" is not allowed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkSnippet(tt.source)
+			if tt.wantReason == "" && got != "" {
+				t.Errorf("checkSnippet rejected it: %s", got)
+			}
+			if tt.wantReason != "" && !strings.Contains(got, tt.wantReason) {
+				t.Errorf("checkSnippet = %q, want a reason containing %q", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 8}
+	for _, s := range []string{"abc", "def", "ghijkl"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("Write(%q) = %d, %v; want the whole of it, so exec keeps reading", s, n, err)
+		}
+	}
+	if !b.truncated || b.String() != "abcdefgh\n[output truncated]\n" {
+		t.Errorf("got %q, truncated %v; want the first 8 bytes and a note", b.String(), b.truncated)
+	}
+
+	// A character cut in half at the limit is left out, not mangled
+	b = &cappedBuffer{max: 4}
+	b.Write([]byte("abcé"))
+	if got := b.String(); got != "abc\n[output truncated]\n" {
+		t.Errorf("cut at a multi-byte character: %q", got)
+	}
+
+	b = &cappedBuffer{max: 8}
+	b.Write([]byte("short"))
+	if b.truncated || b.String() != "short" {
+		t.Errorf("under the limit: %q, truncated %v", b.String(), b.truncated)
+	}
+}
+
+// TestSnippetTimeout runs a snippet that never finishes, and checks it's
+// killed once its time is up, with what it printed before
+func TestSnippetTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles a snippet with the go command")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	s, err := newSnippetRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.runTimeout = 500 * time.Millisecond
+
+	start := time.Now()
+	result, err := s.run(context.Background(), `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("started")
+	for {
+	}
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "timed out" || result.ExitCode != -1 {
+		t.Errorf("status %q, exit code %d; want timed out, -1", result.Status, result.ExitCode)
+	}
+	if result.Stdout != "started\n" || !strings.Contains(result.Stderr, "ran longer than 500ms and was stopped") {
+		t.Errorf("stdout %q, stderr %q", result.Stdout, result.Stderr)
+	}
+	if elapsed := time.Since(start); elapsed > snippetCompile {
+		t.Errorf("run took %v; the program wasn't stopped", elapsed)
+	}
+
+	result, err = s.run(context.Background(), `package main; import "os"; func main() { os.Exit(3) }`)
+	if err != nil || result.Status != "exited" || result.ExitCode != 3 {
+		t.Errorf("os.Exit(3): %+v, %v; want exited with 3", result, err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/soak"
+)
+
+// soakTag is the build tag on every soak test file, so the long-running
+// stress tests stay out of go test ./...
+const soakTag = "soak"
+
+// soakPackage is a package with soak tests
+type soakPackage struct {
+	Dir   string // relative to the root, e.g. "capstone"
+	Tests int    // how many TestSoak functions it has
+}
+
+// runSoak implements golab soak
+func runSoak(args []string) error {
+	flags := flag.NewFlagSet("soak", flag.ContinueOnError)
+	duration := flags.Duration("duration", time.Minute, "how long to run each soak test")
+	seed := flags.Int64("seed", 0, "seed for the random schedules; 0 picks one, printed so the run can be repeated")
+	profiles := flags.String("profiles", os.TempDir(), "directory for goroutine profiles of failed tests")
+	race := flags.Bool("race", true, "run with the race detector (needs cgo)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: golab soak [flags] [lesson... | ./package...]")
+		fmt.Fprintln(flags.Output(), "\nRuns the soak tests of each package given (every package with some if none")
+		fmt.Fprintln(flags.Output(), "are): many goroutines calling the code at random, with invariants checked as")
+		fmt.Fprintln(flags.Output(), "they go. A failure saves every goroutine's stack to a file in -profiles.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *duration <= 0 {
+		return fmt.Errorf("-duration must be positive")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	found, err := discoverSoakPackages(root)
+	if err != nil {
+		return err
+	}
+	selected, err := selectSoakPackages(root, found, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	// Each test gets the whole duration, so a package needs as long as
+	// all of its tests together, and some time to build
+	longest := 0
+	testArgs := []string{"test", "-tags", soakTag, "-run", "^TestSoak", "-count=1", "-v", "-p=1"}
+	if *race {
+		testArgs = append(testArgs, "-race")
+	}
+	for _, pkg := range selected {
+		longest = max(longest, pkg.Tests)
+	}
+	testArgs = append(testArgs, "-timeout", (time.Duration(longest)*(*duration) + 5*time.Minute).String())
+	for _, pkg := range selected {
+		testArgs = append(testArgs, "./"+pkg.Dir)
+	}
+
+	fmt.Printf("Soaking %d package(s) for %v per test, seed %d\n", len(selected), *duration, *seed)
+	cmd := exec.Command("go", testArgs...)
+	cmd.Dir = root
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		soak.DurationEnv+"="+duration.String(),
+		soak.SeedEnv+"="+strconv.FormatInt(*seed, 10),
+		soak.ProfileDirEnv+"="+*profiles,
+	)
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			fmt.Printf("\nSoak failed; repeat it with golab soak -seed %d\n", *seed)
+			return exitError{code: 1}
+		}
+		return fmt.Errorf("running go test: %w", err)
+	}
+	return nil
+}
+
+// discoverSoakPackages finds every package under root with a test file
+// tagged soak, sorted by directory
+func discoverSoakPackages(root string) ([]soakPackage, error) {
+	tests := make(map[string]int)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != root && (name == "testdata" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(data, []byte("//go:build "+soakTag+"\n")) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		tests[filepath.ToSlash(rel)] += bytes.Count(data, []byte("\nfunc TestSoak"))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := make([]soakPackage, 0, len(tests))
+	for dir, n := range tests {
+		pkgs = append(pkgs, soakPackage{Dir: dir, Tests: n})
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Dir < pkgs[j].Dir })
+	return pkgs, nil
+}
+
+// selectSoakPackages picks the packages named by args, as lessons or as
+// paths like ./capstone, or all of them if there are no args
+func selectSoakPackages(root string, found []soakPackage, args []string) ([]soakPackage, error) {
+	if len(args) == 0 {
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no soak tests found")
+		}
+		return found, nil
+	}
+
+	var lessons []Lesson
+	var selected []soakPackage
+	for _, arg := range args {
+		var dir string
+		if strings.HasPrefix(arg, ".") {
+			pattern, err := rootPattern(root, arg)
+			if err != nil {
+				return nil, err
+			}
+			dir = strings.TrimPrefix(pattern, "./")
+		} else {
+			if lessons == nil {
+				var err error
+				if lessons, err = discoverLessons(root); err != nil {
+					return nil, err
+				}
+			}
+			lesson, err := findLesson(lessons, arg)
+			if err != nil {
+				return nil, err
+			}
+			dir = lesson.Dir
+		}
+
+		i := sort.Search(len(found), func(i int) bool { return found[i].Dir >= dir })
+		if i == len(found) || found[i].Dir != dir {
+			return nil, fmt.Errorf("%s has no soak tests", arg)
+		}
+		selected = append(selected, found[i])
+	}
+	return selected, nil
+}
@@ -0,0 +1,18 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("terminal control is not supported on this system")
+
+func makeRaw(f *os.File) (func() error, error) {
+	return nil, errNoTerminal
+}
+
+func terminalSize(f *os.File) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
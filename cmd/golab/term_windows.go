@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// makeRaw switches the console to reading one key at a time without
+// echoing it, with arrow keys sent as ANSI sequences like other terminals,
+// and returns a function that undoes it. Ctrl+C arrives as a key.
+func makeRaw(f *os.File) (func() error, error) {
+	in := windows.Handle(f.Fd())
+	var inMode uint32
+	if err := windows.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	raw := inMode&^(windows.ENABLE_ECHO_INPUT|windows.ENABLE_PROCESSED_INPUT|windows.ENABLE_LINE_INPUT) |
+		windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(in, raw); err != nil {
+		return nil, err
+	}
+
+	// The screen is drawn with ANSI escape codes too
+	out := windows.Handle(os.Stdout.Fd())
+	var outMode uint32
+	if err := windows.GetConsoleMode(out, &outMode); err == nil {
+		windows.SetConsoleMode(out, outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	}
+
+	return func() error {
+		windows.SetConsoleMode(out, outMode)
+		return windows.SetConsoleMode(in, inMode)
+	}, nil
+}
+
+// terminalSize returns the window size in columns and rows
+func terminalSize(f *os.File) (width, height int, err error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(f.Fd()), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ANSI escape sequences used to draw the TUI
+const (
+	altScreenOn  = "\x1b[?1049h"
+	altScreenOff = "\x1b[?1049l"
+	cursorHide   = "\x1b[?25l"
+	cursorShow   = "\x1b[?25h"
+	clearScreen  = "\x1b[2J"
+	clearLine    = "\x1b[K"
+	inverse      = "\x1b[7m"
+	bold         = "\x1b[1m"
+	dim          = "\x1b[2m"
+	reset        = "\x1b[0m"
+)
+
+const tuiHelp = "↑/↓ move  enter run  v verify  esc back  q quit"
+
+// tui is the state behind golab tui: the lesson list on top and, below
+// it, details of the selected lesson or the output of the last verify
+type tui struct {
+	root     string
+	lessons  []Lesson
+	progress *Progress
+
+	selected int
+	top      int      // first lesson shown in the list
+	panel    []string // replaces the details until the selection moves
+	message  string   // status line at the bottom
+}
+
+// runTUI implements golab tui
+func runTUI(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	if len(lessons) == 0 {
+		return errors.New("no lessons found")
+	}
+
+	t := &tui{root: root, lessons: lessons, progress: loadProgressOrEmpty()}
+	restore, err := t.enter()
+	if err != nil {
+		return err
+	}
+	defer func() { t.leave(restore) }()
+
+	keys := make([]byte, 64)
+	for {
+		t.draw()
+		n, err := os.Stdin.Read(keys)
+		if err != nil {
+			return err
+		}
+		for _, key := range parseKeys(keys[:n]) {
+			switch key {
+			case "q", "ctrl+c":
+				return nil
+			case "up", "k":
+				t.move(-1)
+			case "down", "j":
+				t.move(1)
+			case "pgup":
+				t.move(-t.listHeight())
+			case "pgdown":
+				t.move(t.listHeight())
+			case "home", "g":
+				t.move(-len(t.lessons))
+			case "end", "G":
+				t.move(len(t.lessons))
+			case "esc":
+				t.panel, t.message = nil, ""
+			case "enter", "r":
+				if restore, err = t.runSelected(restore); err != nil {
+					return err
+				}
+			case "v":
+				t.verifySelected()
+			}
+		}
+	}
+}
+
+// enter takes over the terminal: raw keys, alternate screen, no cursor
+func (t *tui) enter() (func() error, error) {
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("golab tui needs an interactive terminal (%v); try golab list", err)
+	}
+	fmt.Print(altScreenOn + cursorHide)
+	return restore, nil
+}
+
+// leave gives the terminal back as it was
+func (t *tui) leave(restore func() error) {
+	fmt.Print(cursorShow + altScreenOff)
+	restore()
+}
+
+func (t *tui) selectedLesson() Lesson {
+	return t.lessons[t.selected]
+}
+
+func (t *tui) move(delta int) {
+	t.selected = min(max(t.selected+delta, 0), len(t.lessons)-1)
+	t.panel, t.message = nil, ""
+}
+
+// size falls back to a classic 80x24 if the terminal won't say
+func (t *tui) size() (width, height int) {
+	width, height, err := terminalSize(os.Stdout)
+	if err != nil || width < 20 || height < 10 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// listHeight gives the lesson list about half the screen
+func (t *tui) listHeight() int {
+	_, height := t.size()
+	return min(len(t.lessons), max((height-4)/2, 3))
+}
+
+// draw repaints the whole screen; it is small enough that there's no
+// need to track what changed
+func (t *tui) draw() {
+	width, height := t.size()
+	listHeight := t.listHeight()
+	if t.selected < t.top {
+		t.top = t.selected
+	}
+	if t.selected >= t.top+listHeight {
+		t.top = t.selected - listHeight + 1
+	}
+
+	var screen bytes.Buffer
+	screen.WriteString(clearScreen)
+	row := 1
+	line := func(style, text string) {
+		if row > height {
+			return
+		}
+		fmt.Fprintf(&screen, "\x1b[%d;1H%s%s%s%s", row, style, truncate(text, width), clearLine, reset)
+		row++
+	}
+
+	line(inverse+bold, fmt.Sprintf(" Go Lab %*s", width-8, tuiHelp+" "))
+	for i := t.top; i < t.top+listHeight; i++ {
+		lesson := t.lessons[i]
+		kind := "demo"
+		if lesson.Server != nil {
+			kind = "server"
+		}
+		if lesson.Exercises {
+			kind += ", exercises"
+		}
+		title := truncate(lesson.Title, max(width-41, 10))
+		text := fmt.Sprintf(" %02d  %-*s  %-18s %s", lesson.Number, max(width-41, 10), title, kind, t.progress.status(lesson))
+		style := ""
+		if i == t.selected {
+			style = inverse
+		}
+		line(style, text)
+	}
+	line(dim, strings.Repeat("─", width))
+
+	panel := t.panel
+	if panel == nil {
+		panel = t.details(t.selectedLesson(), width)
+	}
+	for _, text := range panel {
+		if row >= height {
+			break
+		}
+		line("", text)
+	}
+
+	fmt.Fprintf(&screen, "\x1b[%d;1H%s%s%s", height, bold, truncate(t.message, width), reset)
+	os.Stdout.Write(screen.Bytes())
+}
+
+// details describes a lesson in the lower half of the screen
+func (t *tui) details(lesson Lesson, width int) []string {
+	lines := []string{fmt.Sprintf("Lesson %02d: %s", lesson.Number, lesson.Title), ""}
+	lines = append(lines, wrap(lesson.Description, width-2)...)
+	lines = append(lines, "")
+
+	if lesson.Server != nil {
+		lines = append(lines, fmt.Sprintf("Starts a %s server on port %d; stop it with Ctrl+C.", lesson.Server.Scheme, lesson.Server.Port))
+	} else {
+		lines = append(lines, "Prints its examples and exits.")
+	}
+
+	entry := t.progress.Lessons[lesson.ID()]
+	switch {
+	case entry == nil:
+		lines = append(lines, "Not started yet: press enter to run it.")
+	case entry.CompletedAt != nil:
+		lines = append(lines, "Complete, finished "+ago(time.Now(), *entry.CompletedAt)+".")
+	case entry.LastRun != nil:
+		lines = append(lines, "Started, last run "+ago(time.Now(), *entry.LastRun)+".")
+	}
+	if lesson.Exercises {
+		if entry != nil && entry.LastVerify != nil {
+			verify := entry.LastVerify
+			lines = append(lines, fmt.Sprintf("Exercises: %d/%d passing, verified %s. Press v to verify again.",
+				verify.Passed, verify.Total, ago(time.Now(), verify.At)))
+		} else {
+			lines = append(lines, "Has exercises in "+lesson.Dir+"/exercises: press v to verify them.")
+		}
+	}
+	return lines
+}
+
+// runSelected hands the terminal to the lesson, exactly as golab run
+// would, and takes it back once the student has read the output
+func (t *tui) runSelected(restore func() error) (func() error, error) {
+	lesson := t.selectedLesson()
+	t.leave(restore)
+	fmt.Print(clearScreen + "\x1b[H")
+
+	if err := runRun([]string{lesson.ID()}); err != nil {
+		var exit exitError
+		if errors.As(err, &exit) {
+			fmt.Printf("\ngolab: lesson %02d exited with status %d\n", lesson.Number, exit.code)
+		} else {
+			fmt.Printf("\ngolab: %v\n", err)
+		}
+	}
+	fmt.Print("\nPress enter to go back to the lesson list...")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	t.progress = loadProgressOrEmpty()
+	t.message = fmt.Sprintf("Ran lesson %02d.", lesson.Number)
+	return t.enter()
+}
+
+// verifySelected runs the lesson's exercise tests and shows the results
+// in the panel
+func (t *tui) verifySelected() {
+	lesson := t.selectedLesson()
+	if !lesson.Exercises {
+		t.message = fmt.Sprintf("Lesson %02d has no exercises yet.", lesson.Number)
+		return
+	}
+	t.panel = nil
+	t.message = fmt.Sprintf("Verifying lesson %02d...", lesson.Number)
+	t.draw()
+
+	result, err := verifyLesson(t.root, lesson, false)
+	if err != nil {
+		t.message = err.Error()
+		return
+	}
+	updateProgress(func(p *Progress) { p.recordVerify(result, time.Now()) })
+	t.progress = loadProgressOrEmpty()
+
+	var out bytes.Buffer
+	printVerifyResult(&out, result)
+	t.panel = strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	t.message = fmt.Sprintf("%d/%d exercises passing. Esc goes back to the details.", result.Passed(), len(result.Exercises))
+}
+
+// parseKeys names the keys in one read from the terminal. Arrow and
+// paging keys arrive as escape sequences, usually all in one read.
+func parseKeys(input []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1bOA": "up", "\x1bOB": "down",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+		"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+	}
+
+	var keys []string
+	for len(input) > 0 {
+		if input[0] == 0x1b {
+			matched := false
+			for seq, name := range sequences {
+				if bytes.HasPrefix(input, []byte(seq)) {
+					keys = append(keys, name)
+					input = input[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if len(input) > 1 && input[1] == '[' {
+				// Some other sequence: skip to its final byte
+				end := bytes.IndexFunc(input[2:], func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+				if end < 0 {
+					return keys
+				}
+				input = input[end+3:]
+				continue
+			}
+			keys = append(keys, "esc")
+			input = input[1:]
+			continue
+		}
+
+		switch c := input[0]; c {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 3:
+			keys = append(keys, "ctrl+c")
+		default:
+			keys = append(keys, string(c))
+		}
+		input = input[1:]
+	}
+	return keys
+}
+
+// wrap breaks text into lines of at most width characters at spaces
+func wrap(text string, width int) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(text) {
+		if current != "" && len(current)+1+len(word) > width {
+			lines = append(lines, current)
+			current = ""
+		}
+		if current != "" {
+			current += " "
+		}
+		current += word
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/analysis"
+)
+
+// exercisesTag is the build tag on every exercises_test.go, so the failing
+// tests students start with stay out of go test ./...
+const exercisesTag = "exercises"
+
+// solutionTag swaps each exercises.go for its solution.go, which holds the
+// reference solutions, so golab verify --solutions can prove they pass
+const solutionTag = "solution"
+
+// testEvent is one line of go test -json output (see go doc test2json)
+type testEvent struct {
+	Action string
+	Test   string
+	Output string
+}
+
+// ExerciseResult is the outcome of one top-level test in exercises_test.go
+type ExerciseResult struct {
+	Name   string // test name without the "Test" prefix
+	Passed bool
+	Output []string // what the test logged, for failures
+}
+
+// VerifyResult is the outcome of verifying one lesson
+type VerifyResult struct {
+	Lesson    Lesson
+	Solutions bool // checked the reference solutions, not the student's code
+	Exercises []ExerciseResult
+	// BuildError holds compiler output when the exercises don't compile
+	BuildError string
+	// Coverage is the percentage of statements in the exercises package
+	// the tests ran, or -1 if go test didn't report it
+	Coverage float64
+	// Structure lists the //golab:require directives the code doesn't
+	// meet yet, such as a missing goroutine
+	Structure []analysis.Diagnostic
+}
+
+// Passed counts the exercises that pass
+func (r VerifyResult) Passed() int {
+	passed := 0
+	for _, exercise := range r.Exercises {
+		if exercise.Passed {
+			passed++
+		}
+	}
+	return passed
+}
+
+// Complete reports whether every exercise passes and is written the way
+// the lesson asks
+func (r VerifyResult) Complete() bool {
+	return r.BuildError == "" && len(r.Exercises) > 0 && r.Passed() == len(r.Exercises) && len(r.Structure) == 0
+}
+
+// runVerify implements golab verify
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	solutions := flags.Bool("solutions", false, "check the reference solutions instead of your code")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+	var selected []Lesson
+	if len(args) == 0 {
+		for _, lesson := range lessons {
+			if lesson.Exercises {
+				selected = append(selected, lesson)
+			}
+		}
+	}
+	for _, name := range args {
+		lesson, err := findLesson(lessons, name)
+		if err != nil {
+			return err
+		}
+		if !lesson.Exercises {
+			return fmt.Errorf("lesson %02d has no exercises yet", lesson.Number)
+		}
+		selected = append(selected, lesson)
+	}
+	// A lesson missing from the registry still verifies; golab path is
+	// what needs the entry
+	if err := checkRegistry(selected); err != nil {
+		fmt.Fprintf(os.Stderr, "golab: %v\n", err)
+	}
+
+	if len(args) > 0 && !*solutions {
+		warnPrereqs(os.Stderr, lessons, selected)
+	}
+
+	allComplete := true
+	passed, total := 0, 0
+	for i, lesson := range selected {
+		if i > 0 {
+			fmt.Println()
+		}
+		result, err := verifyLesson(root, lesson, *solutions)
+		if err != nil {
+			return err
+		}
+		printVerifyResult(os.Stdout, result)
+		if !*solutions {
+			updateProgress(func(p *Progress) { p.recordVerify(result, time.Now()) })
+		}
+		allComplete = allComplete && result.Complete()
+		passed += result.Passed()
+		total += len(result.Exercises)
+	}
+
+	if len(selected) > 1 {
+		fmt.Printf("\nOverall: %d/%d exercises passing %s\n", passed, total, progressBar(passed, total))
+	}
+	if !allComplete {
+		return exitError{code: 1}
+	}
+	return nil
+}
+
+// verifyLesson runs one lesson's exercise tests, against the reference
+// solutions if asked, and collects the results
+func verifyLesson(root string, lesson Lesson, solutions bool) (VerifyResult, error) {
+	result := VerifyResult{Lesson: lesson, Solutions: solutions, Coverage: -1}
+
+	tags := strings.Join(verifyTags(solutions), ",")
+	cmd := exec.Command("go", "test", "-tags", tags, "-json", "-count=1", "-cover", "./"+lesson.Dir+"/exercises")
+	cmd.Dir = root
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	if _, ok := runErr.(*exec.ExitError); runErr != nil && !ok {
+		return result, fmt.Errorf("running go test: %w", runErr)
+	}
+
+	index := make(map[string]int) // test name -> position in result.Exercises
+	var buildOutput strings.Builder
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		var event testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// Older Go versions print build errors as plain text
+			buildOutput.WriteString(scanner.Text() + "\n")
+			continue
+		}
+		if event.Action == "build-output" {
+			buildOutput.WriteString(event.Output)
+			continue
+		}
+		if event.Test == "" {
+			if match := coveragePattern.FindStringSubmatch(event.Output); match != nil {
+				result.Coverage, _ = strconv.ParseFloat(match[1], 64)
+			}
+			continue
+		}
+
+		// Subtest output belongs to the exercise it is part of
+		name, _, _ := strings.Cut(event.Test, "/")
+		i, ok := index[name]
+		if !ok {
+			i = len(result.Exercises)
+			index[name] = i
+			result.Exercises = append(result.Exercises, ExerciseResult{Name: strings.TrimPrefix(name, "Test")})
+		}
+		exercise := &result.Exercises[i]
+
+		switch event.Action {
+		case "output":
+			if line := testOutputLine(event.Output); line != "" {
+				exercise.Output = append(exercise.Output, line)
+			}
+		case "pass":
+			if event.Test == name {
+				exercise.Passed = true
+			}
+		}
+	}
+
+	if len(result.Exercises) == 0 && runErr != nil {
+		result.BuildError = strings.TrimSpace(buildOutput.String() + stderr.String())
+		return result, nil
+	}
+
+	// Tests say whether the answers are right; the requirements say
+	// whether they were reached the way the lesson teaches
+	pkgs, err := analysis.Load(root, verifyTags(solutions), "./"+lesson.Dir+"/exercises")
+	if err != nil {
+		return result, fmt.Errorf("checking the exercises' structure: %w", err)
+	}
+	result.Structure = analysis.Run(pkgs, analysis.Requirements)
+	for i := range result.Structure {
+		result.Structure[i].Pos.Filename = filepath.Base(result.Structure[i].Pos.Filename)
+	}
+	return result, nil
+}
+
+// verifyTags are the build tags for the exercise tests, with or without
+// the reference solutions
+func verifyTags(solutions bool) []string {
+	if solutions {
+		return []string{exercisesTag, solutionTag}
+	}
+	return []string{exercisesTag}
+}
+
+// coveragePattern matches the summary go test -cover prints for a package
+var coveragePattern = regexp.MustCompile(`coverage: ([\d.]+)% of statements`)
+
+// testOutputLine keeps what a test logged and drops go test's own
+// "=== RUN" and "--- FAIL" bookkeeping
+func testOutputLine(output string) string {
+	line := strings.TrimSpace(output)
+	if strings.HasPrefix(line, "=== ") || strings.HasPrefix(line, "--- ") {
+		return ""
+	}
+	return line
+}
+
+// printVerifyResult shows which exercises pass, with what the failing
+// ones logged
+func printVerifyResult(w io.Writer, result VerifyResult) {
+	lesson := result.Lesson
+	if result.Solutions {
+		fmt.Fprintf(w, "Lesson %02d: %s (reference solutions)\n", lesson.Number, lesson.Title)
+	} else {
+		fmt.Fprintf(w, "Lesson %02d: %s\n", lesson.Number, lesson.Title)
+	}
+
+	if result.BuildError != "" {
+		fmt.Fprintln(w, "  The exercises don't compile yet:")
+		for _, line := range strings.Split(result.BuildError, "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+		return
+	}
+
+	for _, exercise := range result.Exercises {
+		status := "FAIL"
+		if exercise.Passed {
+			status = "PASS"
+		}
+		fmt.Fprintf(w, "  %s  %s\n", status, exercise.Name)
+		if !exercise.Passed {
+			for _, line := range exercise.Output {
+				fmt.Fprintf(w, "          %s\n", line)
+			}
+		}
+	}
+
+	if len(result.Structure) > 0 {
+		fmt.Fprintln(w, "  Not written the way the lesson asks yet:")
+		for _, diagnostic := range result.Structure {
+			fmt.Fprintf(w, "    %s (%s:%d)\n", diagnostic.Message, diagnostic.Pos.Filename, diagnostic.Pos.Line)
+		}
+	}
+
+	passed, total := result.Passed(), len(result.Exercises)
+	fmt.Fprintf(w, "  %d/%d exercises passing %s\n", passed, total, progressBar(passed, total))
+	if result.Complete() && !result.Solutions {
+		fmt.Fprintf(w, "  Lesson %02d complete!\n", lesson.Number)
+	}
+}
+
+func progressBar(done, total int) string {
+	const width = 20
+	filled := 0
+	if total > 0 {
+		filled = done * width / total
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang-lab/lab/analysis"
+)
+
+// runVet implements golab vet
+func runVet(args []string) error {
+	flags := flag.NewFlagSet("vet", flag.ContinueOnError)
+	solutions := flags.Bool("solutions", false, "check the reference solutions instead of your code")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: golab vet [--solutions] [lesson... | ./package...]")
+		fmt.Fprintln(flags.Output(), "\nVets the exercises of each lesson given (all lessons if none are), or any")
+		fmt.Fprintln(flags.Output(), "packages named by path, such as ./lesson12-object-storage or ./...")
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "\nChecks:")
+		for _, analyzer := range analysis.All {
+			fmt.Fprintf(flags.Output(), "  %-16s %s\n", analyzer.Name, analyzer.Doc)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := findRoot()
+	if err != nil {
+		return err
+	}
+	lessons, err := discoverLessons(root)
+	if err != nil {
+		return err
+	}
+
+	var patterns []string
+	if flags.NArg() == 0 {
+		for _, lesson := range lessons {
+			if lesson.Exercises {
+				patterns = append(patterns, "./"+lesson.Dir+"/exercises")
+			}
+		}
+	}
+	for _, arg := range flags.Args() {
+		if strings.HasPrefix(arg, ".") {
+			pattern, err := rootPattern(root, arg)
+			if err != nil {
+				return err
+			}
+			patterns = append(patterns, pattern)
+			continue
+		}
+		lesson, err := findLesson(lessons, arg)
+		if err != nil {
+			return err
+		}
+		if !lesson.Exercises {
+			return fmt.Errorf("lesson %02d has no exercises; vet its code with golab vet ./%s", lesson.Number, lesson.Dir)
+		}
+		patterns = append(patterns, "./"+lesson.Dir+"/exercises")
+	}
+
+	diagnostics, err := vetPackages(root, *solutions, patterns...)
+	if err != nil {
+		return err
+	}
+	for _, diagnostic := range diagnostics {
+		fmt.Println(diagnostic)
+	}
+	switch len(diagnostics) {
+	case 0:
+		fmt.Println("golab vet: no problems found")
+		return nil
+	case 1:
+		fmt.Println("golab vet: 1 problem")
+	default:
+		fmt.Printf("golab vet: %d problems\n", len(diagnostics))
+	}
+	return exitError{code: 1}
+}
+
+// vetPackages runs every lab/analysis check on the packages matching
+// patterns, which are relative to root, and names files relative to root
+// too
+func vetPackages(root string, solutions bool, patterns ...string) ([]analysis.Diagnostic, error) {
+	pkgs, err := analysis.Load(root, verifyTags(solutions), patterns...)
+	if err != nil {
+		return nil, err
+	}
+	diagnostics := analysis.Run(pkgs, analysis.All...)
+	for i := range diagnostics {
+		if rel, err := filepath.Rel(root, diagnostics[i].Pos.Filename); err == nil {
+			diagnostics[i].Pos.Filename = rel
+		}
+	}
+	return diagnostics, nil
+}
+
+// rootPattern turns a package path relative to the working directory, like
+// ../lesson08-concurrency/..., into one relative to root
+func rootPattern(root, arg string) (string, error) {
+	dir, suffix := arg, ""
+	if strings.HasSuffix(arg, "/...") || arg == "..." {
+		dir, suffix = strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/"), "/..."
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is outside the repository", arg)
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return "", fmt.Errorf("no such package directory: %s", arg)
+	}
+	if rel == "." {
+		return "." + suffix, nil
+	}
+	return "./" + filepath.ToSlash(rel) + suffix, nil
+}
@@ -0,0 +1,8 @@
+// Command lesson01 runs Lesson 01: Hello World and Basic Syntax.
+package main
+
+import lesson01 "golang-lab/lesson01-hello-world"
+
+func main() {
+	lesson01.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson02 runs Lesson 02: Variables, Constants, and Data Types.
+package main
+
+import lesson02 "golang-lab/lesson02-variables-types"
+
+func main() {
+	lesson02.Run()
+}
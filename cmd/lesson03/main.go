@@ -0,0 +1,8 @@
+// Command lesson03 runs Lesson 03: Functions and Methods.
+package main
+
+import lesson03 "golang-lab/lesson03-functions-methods"
+
+func main() {
+	lesson03.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson04 runs Lesson 04: Structs and Interfaces.
+package main
+
+import lesson04 "golang-lab/lesson04-structs-interfaces"
+
+func main() {
+	lesson04.Run()
+}
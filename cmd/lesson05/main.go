@@ -0,0 +1,8 @@
+// Command lesson05 runs Lesson 05: Pointers and Memory Management.
+package main
+
+import lesson05 "golang-lab/lesson05-pointers-memory"
+
+func main() {
+	lesson05.Run()
+}
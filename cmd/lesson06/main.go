@@ -0,0 +1,8 @@
+// Command lesson06 runs Lesson 06: Control Structures.
+package main
+
+import lesson06 "golang-lab/lesson06-control-structures"
+
+func main() {
+	lesson06.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson07 runs Lesson 07: Error Handling.
+package main
+
+import lesson07 "golang-lab/lesson07-error-handling"
+
+func main() {
+	lesson07.Run()
+}
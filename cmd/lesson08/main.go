@@ -0,0 +1,8 @@
+// Command lesson08 runs Lesson 08: Concurrency with Goroutines and Channels.
+package main
+
+import lesson08 "golang-lab/lesson08-concurrency"
+
+func main() {
+	lesson08.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson09 runs Lesson 09: Web Server Basics with net/http.
+package main
+
+import lesson09 "golang-lab/lesson09-web-server"
+
+func main() {
+	lesson09.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson10 runs Lesson 10: JSON Handling and REST API.
+package main
+
+import lesson10 "golang-lab/lesson10-json-rest-api"
+
+func main() {
+	lesson10.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson11 runs Lesson 11: MongoDB Document Storage.
+package main
+
+import lesson11 "golang-lab/lesson11-mongodb-storage"
+
+func main() {
+	lesson11.Run()
+}
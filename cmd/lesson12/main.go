@@ -0,0 +1,8 @@
+// Command lesson12 runs Lesson 12: Object Storage (S3-Compatible).
+package main
+
+import lesson12 "golang-lab/lesson12-object-storage"
+
+func main() {
+	lesson12.Run()
+}
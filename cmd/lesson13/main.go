@@ -0,0 +1,8 @@
+// Command lesson13 runs Lesson 13: Containerizing the Go API.
+package main
+
+import lesson13 "golang-lab/lesson13-containerizing"
+
+func main() {
+	lesson13.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson14 runs Lesson 14: Kubernetes-Ready Server Behavior.
+package main
+
+import lesson14 "golang-lab/lesson14-kubernetes-ready"
+
+func main() {
+	lesson14.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson15 runs Lesson 15: WebSocket Chat.
+package main
+
+import lesson15 "golang-lab/lesson15-websocket-chat"
+
+func main() {
+	lesson15.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson16 runs Lesson 16: Mini-Project - URL Shortener.
+package main
+
+import lesson16 "golang-lab/lesson16-url-shortener"
+
+func main() {
+	lesson16.Run()
+}
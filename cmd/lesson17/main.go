@@ -0,0 +1,8 @@
+// Command lesson17 runs Lesson 17: Mutual TLS Authentication.
+package main
+
+import lesson17 "golang-lab/lesson17-mutual-tls"
+
+func main() {
+	lesson17.Run()
+}
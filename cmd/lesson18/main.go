@@ -0,0 +1,8 @@
+// Command lesson18 runs Lesson 18: OAuth2 Client and Token Management.
+package main
+
+import lesson18 "golang-lab/lesson18-oauth2-client"
+
+func main() {
+	lesson18.Run()
+}
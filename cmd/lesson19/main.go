@@ -0,0 +1,8 @@
+// Command lesson19 runs Lesson 19: Load Shedding and Adaptive Concurrency Limits.
+package main
+
+import lesson19 "golang-lab/lesson19-load-shedding"
+
+func main() {
+	lesson19.Run()
+}
@@ -0,0 +1,8 @@
+// Command lesson20 runs Lesson 20: Static Analysis.
+package main
+
+import lesson20 "golang-lab/lesson20-static-analysis"
+
+func main() {
+	lesson20.Run()
+}
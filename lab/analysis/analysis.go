@@ -0,0 +1,129 @@
+// Package analysis runs static checks over Go source: programs that read
+// code instead of running it. It is a small version of
+// golang.org/x/tools/go/analysis built on the standard library alone, so
+// lesson 20 can take it apart and golab vet can run it without any
+// downloads.
+//
+// An Analyzer is a named check. Its Run function gets a Pass holding one
+// package's syntax trees (go/ast) and type information (go/types), walks
+// the trees and reports what it finds:
+//
+//	pkgs, err := analysis.Load(root, nil, "./...")
+//	diagnostics := analysis.Run(pkgs, analysis.All...)
+//
+// The checks here are the sort a reviewer would otherwise leave as
+// comments on an exercise submission.
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Analyzer is one static check
+type Analyzer struct {
+	Name string // short and lowercase, shown after each diagnostic
+	Doc  string // what it reports and why
+	Run  func(*Pass)
+}
+
+// Pass is what an Analyzer sees of one package
+type Pass struct {
+	Analyzer  *Analyzer
+	Fset      *token.FileSet
+	Files     []*ast.File
+	Pkg       *types.Package
+	TypesInfo *types.Info
+
+	diagnostics *[]Diagnostic
+}
+
+// Reportf records a problem at pos
+func (p *Pass) Reportf(pos token.Pos, format string, args ...any) {
+	*p.diagnostics = append(*p.diagnostics, Diagnostic{
+		Analyzer: p.Analyzer.Name,
+		Pos:      p.Fset.Position(pos),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Diagnostic is one problem an Analyzer found
+type Diagnostic struct {
+	Analyzer string
+	Pos      token.Position
+	Message  string
+}
+
+// String formats the diagnostic like the compiler does, so editors and
+// terminals can jump to it
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Analyzer)
+}
+
+// Package is a parsed and type-checked package, ready to analyze
+type Package struct {
+	Path  string // import path
+	Fset  *token.FileSet
+	Files []*ast.File
+	Types *types.Package
+	Info  *types.Info
+}
+
+// All is every analyzer in this package, the set golab vet runs
+var All = []*Analyzer{IgnoredErrors, HandlerPrint, Requirements}
+
+// Run applies each analyzer to each package and returns what they found,
+// sorted by position
+func Run(pkgs []*Package, analyzers ...*Analyzer) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, pkg := range pkgs {
+		for _, analyzer := range analyzers {
+			analyzer.Run(&Pass{
+				Analyzer:    analyzer,
+				Fset:        pkg.Fset,
+				Files:       pkg.Files,
+				Pkg:         pkg.Types,
+				TypesInfo:   pkg.Info,
+				diagnostics: &diagnostics,
+			})
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// calledFunc returns the function or method a call expression calls, or
+// nil for calls of function values, conversions and builtins
+func calledFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	fun := call.Fun
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
+	var id *ast.Ident
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := info.Uses[id].(*types.Func)
+	return fn
+}
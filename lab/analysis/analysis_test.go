@@ -0,0 +1,161 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyzers(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer *Analyzer
+		src      string
+		want     []string
+	}{
+		{
+			name:     "dropped error",
+			analyzer: IgnoredErrors,
+			src: `package p
+import "os"
+func f() {
+	os.Remove("x")
+	defer os.Remove("y")
+}`,
+			want: []string{"x.go:4:2: the error returned by Remove is ignored (ignorederrors)"},
+		},
+		{
+			name:     "error assigned to blank",
+			analyzer: IgnoredErrors,
+			src: `package p
+import "strconv"
+func f() int {
+	n, _ := strconv.Atoi("1")
+	_, err := strconv.Atoi("2")
+	_ = err
+	return n
+}`,
+			want: []string{"x.go:4:5: the error returned by Atoi is assigned to _ (ignorederrors)"},
+		},
+		{
+			name:     "errors nobody checks",
+			analyzer: IgnoredErrors,
+			src: `package p
+import ("bytes"; "fmt"; "os"; "strings")
+func f() {
+	var b bytes.Buffer
+	var s strings.Builder
+	b.WriteString("x")
+	s.WriteString("y")
+	fmt.Println("z")
+	fmt.Fprintln(os.Stderr, "z")
+	println("a builtin")
+}`,
+		},
+		{
+			name:     "print in handler",
+			analyzer: HandlerPrint,
+			src: `package p
+import ("fmt"; "log"; "net/http")
+type server struct{}
+func (server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("%s\n", r.URL)
+}
+func routes() {
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println("hit")
+		log.Println("logging is fine")
+		fmt.Fprintln(w, "so is writing the response")
+	})
+}
+func notHandler(w http.ResponseWriter) {
+	fmt.Println("fine")
+}`,
+			want: []string{
+				"x.go:5:2: fmt.Printf in an HTTP handler prints on the server, not in the response; write to the ResponseWriter or use log (handlerprint)",
+				"x.go:9:3: fmt.Println in an HTTP handler prints on the server, not in the response; write to the ResponseWriter or use log (handlerprint)",
+			},
+		},
+		{
+			name:     "requirements met",
+			analyzer: Requirements,
+			src: `package p
+import ("errors"; "sync")
+var ErrEmpty = errors.New("empty")
+// Sum adds nums concurrently.
+//
+//golab:require go
+//golab:require uses sync.WaitGroup
+//golab:require calls (*sync.WaitGroup).Wait
+//golab:require no-globals
+func Sum(nums []int) int {
+	var wg sync.WaitGroup
+	total := make([]int, len(nums))
+	for i, n := range nums {
+		wg.Add(1)
+		go func() { defer wg.Done(); total[i] = n }()
+	}
+	wg.Wait()
+	return len(total)
+}
+//golab:require recursion
+//golab:require calls errors.Is
+func Fact(n int, err error) int {
+	if n <= 1 || errors.Is(err, ErrEmpty) {
+		return 1
+	}
+	return n * Fact(n-1, err)
+}`,
+		},
+		{
+			name:     "requirements not met",
+			analyzer: Requirements,
+			src: `package p
+var total int
+//golab:require go
+//golab:require no-globals
+//golab:require no-calls panic
+func Sum(nums []int) int {
+	for _, n := range nums {
+		total += n
+	}
+	if total < 0 {
+		panic("negative")
+	}
+	return total
+}
+type Counter struct{ n int }
+//golab:require defer
+//golab:require calls (*sync.Mutex).Lock
+//golab:require goroutine
+func (c *Counter) Inc() { c.n++ }`,
+			want: []string{
+				"x.go:6:6: Sum should start a goroutine with the go statement (requirements)",
+				"x.go:8:3: Sum must not use the package-level variable total; pass it in as a parameter instead (requirements)",
+				"x.go:10:5: Sum must not use the package-level variable total; pass it in as a parameter instead (requirements)",
+				"x.go:11:3: Sum must not call panic (requirements)",
+				"x.go:13:9: Sum must not use the package-level variable total; pass it in as a parameter instead (requirements)",
+				"x.go:18:1: unknown requirement \"goroutine\" (requirements)",
+				"x.go:19:19: Counter.Inc should use defer (requirements)",
+				"x.go:19:19: Counter.Inc should call (*sync.Mutex).Lock (requirements)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pkg, err := LoadSource("x.go", tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, diagnostic := range Run([]*Package{pkg}, tt.analyzer) {
+				got = append(got, diagnostic.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
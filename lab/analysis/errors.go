@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// IgnoredErrors reports calls whose error result is dropped, either by
+// calling the function as a statement or by assigning the error to _.
+//
+// Calls in defer and go statements are left alone, as are functions
+// whose errors are by convention not checked: fmt's printing functions
+// and writes to in-memory buffers, which can't fail.
+var IgnoredErrors = &Analyzer{
+	Name: "ignorederrors",
+	Doc:  "report calls that ignore the error they return",
+	Run:  runIgnoredErrors,
+}
+
+// uncheckedFuncs may return errors that nobody checks, named as
+// types.Func.FullName prints them
+var uncheckedFuncs = map[string]bool{
+	"fmt.Print":    true,
+	"fmt.Printf":   true,
+	"fmt.Println":  true,
+	"fmt.Fprint":   true,
+	"fmt.Fprintf":  true,
+	"fmt.Fprintln": true,
+
+	"(*bytes.Buffer).Write":          true,
+	"(*bytes.Buffer).WriteByte":      true,
+	"(*bytes.Buffer).WriteRune":      true,
+	"(*bytes.Buffer).WriteString":    true,
+	"(*strings.Builder).Write":       true,
+	"(*strings.Builder).WriteByte":   true,
+	"(*strings.Builder).WriteRune":   true,
+	"(*strings.Builder).WriteString": true,
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+func runIgnoredErrors(pass *Pass) {
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch stmt := n.(type) {
+			case *ast.ExprStmt:
+				// f() on its own line drops every result
+				call, ok := stmt.X.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if fn := ignoredCall(pass, call); fn != nil {
+					if errorResults(pass, call) != nil {
+						pass.Reportf(call.Pos(), "the error returned by %s is ignored", fn.Name())
+					}
+				}
+			case *ast.AssignStmt:
+				// x, _ := f() drops whichever results go to _
+				if len(stmt.Rhs) != 1 {
+					return true
+				}
+				call, ok := stmt.Rhs[0].(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn := ignoredCall(pass, call)
+				if fn == nil {
+					return true
+				}
+				results := errorResults(pass, call)
+				for i, lhs := range stmt.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok && id.Name == "_" && i < len(results) && results[i] {
+						pass.Reportf(id.Pos(), "the error returned by %s is assigned to _", fn.Name())
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// ignoredCall returns the function call calls, unless it is one whose
+// errors don't need checking
+func ignoredCall(pass *Pass, call *ast.CallExpr) *types.Func {
+	fn := calledFunc(pass.TypesInfo, call)
+	if fn == nil || uncheckedFuncs[fn.FullName()] {
+		return nil
+	}
+	return fn
+}
+
+// errorResults says which of the call's results are errors, or returns
+// nil if none are
+func errorResults(pass *Pass, call *ast.CallExpr) []bool {
+	var results []types.Type
+	switch t := pass.TypesInfo.TypeOf(call).(type) {
+	case nil:
+		return nil
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			results = append(results, t.At(i).Type())
+		}
+	default:
+		results = []types.Type{t}
+	}
+
+	var isError []bool
+	found := false
+	for _, result := range results {
+		ok := types.Identical(result, errorType)
+		isError = append(isError, ok)
+		found = found || ok
+	}
+	if !found {
+		return nil
+	}
+	return isError
+}
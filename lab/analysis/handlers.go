@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// HandlerPrint reports fmt.Print, Printf and Println calls inside HTTP
+// handlers. They write to the server's terminal, not to the client; a
+// handler should write its response to the http.ResponseWriter and its
+// diagnostics to a logger.
+//
+// A handler is any function or function literal taking exactly an
+// http.ResponseWriter and an *http.Request, including ServeHTTP methods.
+var HandlerPrint = &Analyzer{
+	Name: "handlerprint",
+	Doc:  "report fmt.Println and friends inside HTTP handlers",
+	Run:  runHandlerPrint,
+}
+
+var printFuncs = map[string]bool{
+	"fmt.Print":   true,
+	"fmt.Printf":  true,
+	"fmt.Println": true,
+}
+
+func runHandlerPrint(pass *Pass) {
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			var body *ast.BlockStmt
+			var funcType *ast.FuncType
+			switch fn := n.(type) {
+			case *ast.FuncDecl:
+				body, funcType = fn.Body, fn.Type
+			case *ast.FuncLit:
+				body, funcType = fn.Body, fn.Type
+			default:
+				return true
+			}
+			if body == nil || !isHandler(pass, funcType) {
+				return true
+			}
+
+			ast.Inspect(body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if fn := calledFunc(pass.TypesInfo, call); fn != nil && printFuncs[fn.FullName()] {
+					pass.Reportf(call.Pos(), "%s in an HTTP handler prints on the server, not in the response; write to the ResponseWriter or use log", fn.FullName())
+				}
+				return true
+			})
+			// Everything inside has been checked; don't report it twice
+			// for a handler literal inside a handler
+			return false
+		})
+	}
+}
+
+// isHandler reports whether a function's parameters are exactly
+// (http.ResponseWriter, *http.Request)
+func isHandler(pass *Pass, funcType *ast.FuncType) bool {
+	var params []types.Type
+	for _, field := range funcType.Params.List {
+		t := pass.TypesInfo.TypeOf(field.Type)
+		names := max(len(field.Names), 1)
+		for i := 0; i < names; i++ {
+			params = append(params, t)
+		}
+	}
+	if len(params) != 2 {
+		return false
+	}
+	return isNamed(params[0], "net/http", "ResponseWriter") && isPointerTo(params[1], "net/http", "Request")
+}
+
+func isNamed(t types.Type, pkg, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pkg && obj.Name() == name
+}
+
+func isPointerTo(t types.Type, pkg, name string) bool {
+	pointer, ok := t.(*types.Pointer)
+	return ok && isNamed(pointer.Elem(), pkg, name)
+}
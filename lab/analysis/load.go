@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// listedPackage is the part of go list -json output Load needs
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	GoFiles    []string
+	Export     string // compiled export data, for type-checking importers
+	DepOnly    bool
+	Error      *struct{ Err string }
+}
+
+// Load parses and type-checks the packages matching patterns, as the go
+// command in dir sees them with the given build tags. Only the packages'
+// own files are parsed; their imports are read from the export data go
+// list -export leaves in the build cache, the way go vet does it.
+func Load(dir string, tags []string, patterns ...string) ([]*Package, error) {
+	args := []string{"list", "-e", "-json=ImportPath,Dir,GoFiles,Export,DepOnly,Error", "-export", "-deps"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	cmd := exec.Command("go", append(args, patterns...)...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list: %v\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	exports := make(map[string]string) // import path -> export data file
+	var targets []listedPackage
+	decoder := json.NewDecoder(&stdout)
+	for {
+		var listed listedPackage
+		if err := decoder.Decode(&listed); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading go list output: %w", err)
+		}
+		exports[listed.ImportPath] = listed.Export
+		if !listed.DepOnly {
+			targets = append(targets, listed)
+		}
+	}
+
+	fset := token.NewFileSet()
+	imports := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		if exports[path] == "" {
+			return nil, fmt.Errorf("no export data for %s; does it compile?", path)
+		}
+		return os.Open(exports[path])
+	})
+
+	var pkgs []*Package
+	for _, listed := range targets {
+		if listed.Error != nil {
+			return nil, errors.New(listed.Error.Err)
+		}
+		if len(listed.GoFiles) == 0 {
+			continue // e.g. a directory of tests only
+		}
+		var files []*ast.File
+		for _, name := range listed.GoFiles {
+			file, err := parser.ParseFile(fset, filepath.Join(listed.Dir, name), nil, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		pkg, err := check(fset, listed.ImportPath, files, imports)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// LoadSource parses and type-checks a single file held in memory, which
+// is all lesson examples and tests need. It may import the standard
+// library only; like Load, it asks the go command where the compiled
+// packages are.
+func LoadSource(filename, src string) (*Package, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return check(fset, file.Name.Name, []*ast.File{file}, importer.ForCompiler(fset, "gc", nil))
+}
+
+// check type-checks files, recording what Analyzers need to know about
+// every expression and identifier
+func check(fset *token.FileSet, path string, files []*ast.File, imports types.Importer) (*Package, error) {
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	config := types.Config{Importer: imports}
+	pkg, err := config.Check(path, fset, files, info)
+	if err != nil {
+		return nil, err
+	}
+	return &Package{Path: path, Fset: fset, Files: files, Types: pkg, Info: info}, nil
+}
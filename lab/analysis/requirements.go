@@ -0,0 +1,203 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// RequireDirective marks a structural requirement in a function's doc
+// comment. Exercises use it to say how a function must be written, not
+// just what it must return, since tests can't tell a loop from a
+// goroutine:
+//
+//	// Exercise 2: ParallelSum adds nums using several goroutines.
+//	//
+//	//golab:require go
+//	//golab:require uses sync.WaitGroup
+//	func ParallelSum(nums []int, workers int) int {
+//
+// Like //go: directives, these lines don't show up in go doc.
+const RequireDirective = "//golab:require "
+
+// requirementRules are what may follow //golab:require. Names after calls,
+// uses and no-calls are qualified by import path, as in errors.Is or
+// (*sync.WaitGroup).Wait; builtins like panic are just their name.
+var requirementRules = map[string]string{
+	"go":         "start a goroutine with the go statement",
+	"defer":      "use defer",
+	"select":     "use a select statement",
+	"switch":     "use a switch statement",
+	"loop":       "use a for loop",
+	"recursion":  "call itself",
+	"calls":      "call NAME",
+	"uses":       "use NAME",
+	"no-calls":   "must not call NAME",
+	"no-globals": "must not use package-level variables",
+}
+
+// Requirements reports functions that don't meet the //golab:require
+// directives in their doc comments, such as an exercise that passes its
+// tests without the goroutine it was meant to practice
+var Requirements = &Analyzer{
+	Name: "requirements",
+	Doc:  "check functions against their //golab:require directives",
+	Run:  runRequirements,
+}
+
+func runRequirements(pass *Pass) {
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Doc == nil || fn.Body == nil {
+				continue
+			}
+			for _, comment := range fn.Doc.List {
+				if rule, ok := strings.CutPrefix(comment.Text, RequireDirective); ok {
+					checkRequirement(pass, fn, comment.Pos(), strings.Fields(rule))
+				}
+			}
+		}
+	}
+}
+
+// checkRequirement checks one directive against fn's body
+func checkRequirement(pass *Pass, fn *ast.FuncDecl, pos token.Pos, rule []string) {
+	name := funcName(fn)
+	if len(rule) == 0 {
+		pass.Reportf(pos, "empty //golab:require directive")
+		return
+	}
+	if _, ok := requirementRules[rule[0]]; !ok {
+		pass.Reportf(pos, "unknown requirement %q", rule[0])
+		return
+	}
+	wantsArg := rule[0] == "calls" || rule[0] == "uses" || rule[0] == "no-calls"
+	if wantsArg != (len(rule) == 2) || len(rule) > 2 {
+		pass.Reportf(pos, "malformed requirement %q", strings.Join(rule, " "))
+		return
+	}
+
+	switch rule[0] {
+	case "go", "defer", "select", "switch", "loop":
+		if !containsStmt(fn.Body, rule[0]) {
+			pass.Reportf(fn.Name.Pos(), "%s should %s", name, requirementRules[rule[0]])
+		}
+	case "recursion":
+		self := pass.TypesInfo.Defs[fn.Name]
+		found := false
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok && self != nil && calledFunc(pass.TypesInfo, call) == self {
+				found = true
+			}
+			return !found
+		})
+		if !found {
+			pass.Reportf(fn.Name.Pos(), "%s should call itself", name)
+		}
+	case "calls":
+		if len(findCalls(pass, fn.Body, rule[1])) == 0 {
+			pass.Reportf(fn.Name.Pos(), "%s should call %s", name, rule[1])
+		}
+	case "no-calls":
+		for _, call := range findCalls(pass, fn.Body, rule[1]) {
+			pass.Reportf(call.Pos(), "%s must not call %s", name, rule[1])
+		}
+	case "uses":
+		found := false
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && objectName(pass.TypesInfo.Uses[id]) == rule[1] {
+				found = true
+			}
+			return !found
+		})
+		if !found {
+			pass.Reportf(fn.Name.Pos(), "%s should use %s", name, rule[1])
+		}
+	case "no-globals":
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if v, ok := pass.TypesInfo.Uses[id].(*types.Var); ok && v.Parent() == pass.Pkg.Scope() {
+				pass.Reportf(id.Pos(), "%s must not use the package-level variable %s; pass it in as a parameter instead", name, id.Name)
+			}
+			return true
+		})
+	}
+}
+
+// containsStmt reports whether body has a go, defer, select, switch or
+// loop statement anywhere inside it, including in function literals
+func containsStmt(body *ast.BlockStmt, kind string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.GoStmt:
+			found = found || kind == "go"
+		case *ast.DeferStmt:
+			found = found || kind == "defer"
+		case *ast.SelectStmt:
+			found = found || kind == "select"
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			found = found || kind == "switch"
+		case *ast.ForStmt, *ast.RangeStmt:
+			found = found || kind == "loop"
+		}
+		return !found
+	})
+	return found
+}
+
+// findCalls returns the calls in body of the function or builtin named
+// name
+func findCalls(pass *Pass, body *ast.BlockStmt, name string) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if fn := calledFunc(pass.TypesInfo, call); fn != nil && fn.FullName() == name {
+			calls = append(calls, call)
+		}
+		if id, ok := call.Fun.(*ast.Ident); ok {
+			if builtin, ok := pass.TypesInfo.Uses[id].(*types.Builtin); ok && builtin.Name() == name {
+				calls = append(calls, call)
+			}
+		}
+		return true
+	})
+	return calls
+}
+
+// objectName qualifies a package-level object by import path, like
+// sync.WaitGroup; methods and fields are named as types.Func.FullName
+// does
+func objectName(obj types.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return ""
+	case *types.Func:
+		return obj.FullName()
+	}
+	if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// funcName is how feedback names a function: Deposit, or Account.Deposit
+// for a method
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	return types.ExprString(recv) + "." + fn.Name.Name
+}
@@ -0,0 +1,63 @@
+// Package clock puts the time behind an interface, so code that waits,
+// times out or expires things can be tested without waiting. Lessons hold
+// a Clock instead of calling the time package directly:
+//
+//	var clk clock.Clock = clock.Real{}
+//
+//	select {
+//	case msg := <-ch:
+//		// ...
+//	case <-clk.After(2 * time.Second):
+//		// timed out
+//	}
+//
+// and a test swaps in a Fake and moves it forward by hand:
+//
+//	fake := clock.NewFake(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+//	clk = fake
+//	fake.Advance(2 * time.Second) // the timeout fires at once
+package clock
+
+import "time"
+
+// Clock is the part of the time package that depends on the current time
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+	// Sleep pauses the calling goroutine for at least d
+	Sleep(d time.Duration)
+	// After sends the current time on the returned channel once d has
+	// passed
+	After(d time.Duration) <-chan time.Time
+	// NewTicker returns a Ticker that sends the time every d. It panics
+	// if d is not positive, like time.NewTicker.
+	NewTicker(d time.Duration) *Ticker
+}
+
+// Ticker delivers ticks on C until it is stopped. Like time.Ticker, it
+// drops ticks for a slow receiver instead of queueing them.
+type Ticker struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+// Stop turns off the ticker. It does not close C.
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+// Real is the system clock: every method calls its namesake in the time
+// package
+type Real struct{}
+
+func (Real) Now() time.Time                         { return time.Now() }
+func (Real) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (Real) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (Real) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop}
+}
@@ -0,0 +1,100 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// fired reports whether ch has a value ready, without waiting
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(start)
+	late := f.After(2 * time.Second)
+	early := f.After(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	if _, ok := fired(early); ok {
+		t.Fatal("After(1s) fired before a second passed")
+	}
+	f.Advance(time.Millisecond)
+	if at, ok := fired(early); !ok || !at.Equal(start.Add(time.Second)) {
+		t.Errorf("After(1s) = %v, %v; want it fired at %v", at, ok, start.Add(time.Second))
+	}
+	if _, ok := fired(late); ok {
+		t.Error("After(2s) fired after one second")
+	}
+
+	f.Advance(time.Hour)
+	if at, ok := fired(late); !ok || !at.Equal(start.Add(2*time.Second)) {
+		t.Errorf("After(2s) = %v, %v; want it fired at its deadline, not the end of Advance", at, ok)
+	}
+	if got := f.Since(start); got != time.Hour+time.Second {
+		t.Errorf("Since(start) = %v, want 1h0m1s", got)
+	}
+	if _, ok := fired(f.After(0)); !ok {
+		t.Error("After(0) didn't fire at once")
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := NewFake(start)
+	woke := make(chan time.Time)
+	go func() {
+		f.Sleep(time.Minute)
+		woke <- f.Now()
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	if at := <-woke; !at.Equal(start.Add(time.Minute)) {
+		t.Errorf("woke at %v, want %v", at, start.Add(time.Minute))
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(10 * time.Second)
+
+	f.Advance(10 * time.Second)
+	if _, ok := fired(ticker.C); !ok {
+		t.Fatal("no tick after one period")
+	}
+
+	// Three periods pass, but the channel holds one tick, like time.Ticker
+	f.Advance(30 * time.Second)
+	if at, ok := fired(ticker.C); !ok || !at.Equal(start.Add(20*time.Second)) {
+		t.Errorf("tick = %v, %v; want the first one missed, at %v", at, ok, start.Add(20*time.Second))
+	}
+	if _, ok := fired(ticker.C); ok {
+		t.Error("ticks queued up for a slow receiver")
+	}
+
+	ticker.Stop()
+	f.Advance(time.Minute)
+	if _, ok := fired(ticker.C); ok {
+		t.Error("ticked after Stop")
+	}
+}
+
+func TestReal(t *testing.T) {
+	var c Clock = Real{}
+	before := time.Now()
+	c.Sleep(time.Millisecond)
+	<-c.After(time.Millisecond)
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C
+	ticker.Stop()
+	if c.Since(before) < 3*time.Millisecond || c.Now().Before(before) {
+		t.Errorf("real clock moved %v in three milliseconds of waiting", c.Since(before))
+	}
+}
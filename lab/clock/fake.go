@@ -0,0 +1,138 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when told to. Sleep, After and tickers
+// wait for Advance to carry the fake time past their deadline, so a test
+// of a 30 second timeout takes no time at all.
+//
+// The zero value is not usable; call NewFake.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond // signalled when waiters are added
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a pending After, Sleep or ticker
+type waiter struct {
+	at     time.Time
+	period time.Duration // zero unless it is a ticker
+	ch     chan time.Time
+}
+
+// NewFake returns a Fake clock that stands at start until it is advanced
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until another goroutine advances the clock by d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.add(&waiter{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+func (f *Fake) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &waiter{at: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.add(w)
+	return &Ticker{C: w.ch, stop: func() { f.remove(w) }}
+}
+
+// Advance moves the clock forward by d, firing everything that falls due
+// on the way in order. A ticker fires once for each period that passes,
+// less any ticks its receiver hasn't taken yet.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		next := f.earliest()
+		if next == nil || next.at.After(end) {
+			break
+		}
+		f.now = next.at
+		select {
+		case next.ch <- f.now:
+		default: // a ticker nobody is reading; drop the tick
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			f.removeLocked(next)
+		}
+	}
+	f.now = end
+}
+
+// BlockUntil waits until n Sleep, After or ticker calls are waiting on the
+// clock. Tests call it before Advance, so a goroutine that is about to
+// sleep isn't left behind by an Advance that happens first.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
+
+func (f *Fake) add(w *waiter) {
+	f.waiters = append(f.waiters, w)
+	f.changed.Broadcast()
+}
+
+func (f *Fake) remove(w *waiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removeLocked(w)
+}
+
+func (f *Fake) removeLocked(w *waiter) {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// earliest returns the waiter due first, the one added first on a tie
+func (f *Fake) earliest() *waiter {
+	var first *waiter
+	for _, w := range f.waiters {
+		if first == nil || w.at.Before(first.at) {
+			first = w
+		}
+	}
+	return first
+}
@@ -0,0 +1,288 @@
+// Package config loads a server lesson's settings from four places, each
+// overriding the one before:
+//
+//	the defaults its flags were declared with
+//	a JSON or YAML file, named by -config
+//	environment variables, like LESSON10_PORT for -port
+//	the command line
+//
+// The flags are the schema: a lesson declares them as it would for
+// flag.Parse, and calls Load instead. A file's keys and the variables'
+// names come from the flags' names, so there's one list of settings, with
+// one help text each, and a setting can't be in the file but missing from
+// -help. Values go through the flag's own Set, so "10s" means the same in
+// all four places, and a bad one is reported as it would be on the
+// command line.
+//
+//	# lesson10.yaml
+//	port: 9090
+//	storage: sqlite
+//	cors-origin: [https://app.example.com, https://admin.example.com]
+//
+//	LESSON10_RATE=20 go run ./cmd/lesson10 -config lesson10.yaml -port 0
+//
+// Load collects every problem instead of stopping at the first, like
+// capstone's LoadConfig, and returns the Settings it ended up with, to
+// print at startup: "why is it on port 9090?" is answered by the source
+// next to the value.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileFlag is the flag that names the config file; Load declares it if
+// the lesson hasn't
+const FileFlag = "config"
+
+// Options says where Load looks besides the command line
+type Options struct {
+	// EnvPrefix comes before a flag's name, upper-cased with dashes as
+	// underscores, to make its environment variable: "LESSON10_" sets
+	// -read-timeout from LESSON10_READ_TIMEOUT. Empty reads no variables.
+	EnvPrefix string
+	// LookupEnv is os.LookupEnv unless set; tests set it
+	LookupEnv func(string) (string, bool)
+	// Secret are the flags whose values Print hides
+	Secret []string
+	// Check is called once every value is set, for rules that span
+	// settings or that a flag's type can't express, like a port's range.
+	// Each string it returns is a problem.
+	Check func() []string
+}
+
+// Source is where a setting's value came from
+type Source string
+
+// The sources, from lowest precedence to highest
+const (
+	Default Source = "default"
+	File    Source = "file"
+	Env     Source = "env"
+	Flag    Source = "flag"
+)
+
+// Setting is one flag's effective value
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+	// From is the file or variable the value came from, if not a default
+	// or the command line
+	From   string
+	secret bool
+}
+
+// Settings are every flag's effective value, by name
+type Settings []Setting
+
+// Load parses args into fs, after setting each flag that args doesn't
+// from the environment or, failing that, from the config file. With
+// fs.ErrorHandling ExitOnError, as flag.CommandLine has, a bad command
+// line exits as flag.Parse would; any other problem is returned, all of
+// them together.
+func Load(fs *flag.FlagSet, args []string, opts Options) (Settings, error) {
+	if fs.Lookup(FileFlag) == nil {
+		fs.String(FileFlag, "", "a JSON or YAML file of settings, keyed by flag name")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	sources := make(map[string]Setting)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = Setting{Source: Flag}
+	})
+
+	var problems []string
+	path := fs.Lookup(FileFlag).Value.String()
+	fromFile, err := readFile(path)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, name := range sortedKeys(fromFile) {
+		if fs.Lookup(name) == nil {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %q", path, name))
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, set := sources[f.Name]; set {
+			return
+		}
+		var values []string
+		var from Setting
+		if variable := EnvVar(opts.EnvPrefix, f.Name); opts.EnvPrefix != "" {
+			if value, ok := lookupEnv(variable); ok {
+				values, from = []string{value}, Setting{Source: Env, From: variable}
+			}
+		}
+		if values == nil {
+			raw, ok := fromFile[f.Name]
+			if !ok {
+				return
+			}
+			if values, err = fileValues(raw); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: %v", path, f.Name, err))
+				return
+			}
+			from = Setting{Source: File, From: path}
+		}
+		// A list in the file sets a repeatable flag once for each item
+		for _, value := range values {
+			if err := f.Value.Set(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid value %q for -%s: %v", from.From, value, f.Name, err))
+				return
+			}
+		}
+		sources[f.Name] = from
+	})
+
+	if opts.Check != nil {
+		problems = append(problems, opts.Check()...)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	var settings Settings
+	fs.VisitAll(func(f *flag.Flag) {
+		s := sources[f.Name]
+		if s.Source == "" {
+			s.Source = Default
+		}
+		s.Name, s.Value = f.Name, f.Value.String()
+		s.secret = slices.Contains(opts.Secret, f.Name)
+		settings = append(settings, s)
+	})
+	return settings, nil
+}
+
+// EnvVar is the environment variable that sets flag name, with prefix
+func EnvVar(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Get is the setting for flag name, if there is one
+func (s Settings) Get(name string) (Setting, bool) {
+	for _, setting := range s {
+		if setting.Name == name {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Print writes the settings as a table, one a line, with where each
+// value came from. Secrets that are set show as [hidden].
+func (s Settings) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Effective configuration:")
+	for _, setting := range s {
+		value := setting.Value
+		switch {
+		case setting.secret && value != "":
+			value = "[hidden]"
+		case value == "":
+			value = `""`
+		}
+		source := string(setting.Source)
+		if setting.From != "" {
+			source += " " + setting.From
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", setting.Name, value, source)
+	}
+	return tw.Flush()
+}
+
+// List is a flag of several strings, like -cors-origin: each use adds
+// to it, and so does each comma-separated item of one, so
+// LESSON10_CORS_ORIGIN="https://a.example,https://b.example" works too.
+type List []string
+
+// String joins the list with commas
+func (l *List) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds value's comma-separated items to the list
+func (l *List) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// readFile reads the settings in the JSON or YAML file at path, going by
+// its extension. An empty path is no file.
+func readFile(path string) (map[string]any, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the config file: %w", err)
+	}
+	var settings map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // so 1000000 isn't 1e+06
+		err = decoder.Decode(&settings)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	default:
+		return nil, fmt.Errorf("%s: a config file must be .json, .yaml or .yml, not %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// fileValues are the strings a file's value sets its flag to: one for a
+// scalar, one per item for a list
+func fileValues(raw any) ([]string, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		items = []any{raw}
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		switch item.(type) {
+		case nil:
+			return nil, errors.New("no value")
+		case map[string]any, []any:
+			return nil, errors.New("must be a value or a list of values")
+		}
+		values = append(values, fmt.Sprint(item))
+	}
+	return values, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
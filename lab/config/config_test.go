@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lessonFlags are a server lesson's flags, on a fresh FlagSet
+type lessonFlags struct {
+	fs      *flag.FlagSet
+	port    *int
+	timeout *time.Duration
+	storage *string
+	secret  *string
+	origins List
+}
+
+func newLessonFlags() *lessonFlags {
+	l := &lessonFlags{fs: flag.NewFlagSet("lesson", flag.ContinueOnError)}
+	l.fs.SetOutput(&bytes.Buffer{})
+	l.port = l.fs.Int("port", 8080, "port")
+	l.timeout = l.fs.Duration("read-timeout", 10*time.Second, "read timeout")
+	l.storage = l.fs.String("storage", "memory", "storage")
+	l.secret = l.fs.String("jwt-secret", "", "secret")
+	l.fs.Var(&l.origins, "cors-origin", "origins")
+	return l
+}
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	l := newLessonFlags()
+	settings, err := Load(l.fs, nil, Options{EnvPrefix: "LESSON_", LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *l.port != 8080 || *l.timeout != 10*time.Second || *l.storage != "memory" {
+		t.Errorf("port %d, read-timeout %v, storage %q; want the defaults", *l.port, *l.timeout, *l.storage)
+	}
+	if s, ok := settings.Get("port"); !ok || s.Source != Default || s.Value != "8080" {
+		t.Errorf("port setting = %+v, %v; want 8080 from the default", s, ok)
+	}
+	if _, ok := settings.Get(FileFlag); !ok {
+		t.Errorf("Load didn't declare -%s", FileFlag)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "lesson.yaml", `
+port: 9090
+read-timeout: 30s
+storage: sqlite
+cors-origin: [https://a.example, https://b.example]
+`)
+	l := newLessonFlags()
+	settings, err := Load(l.fs, []string{"-config", path, "-port", "7070"}, Options{
+		EnvPrefix: "LESSON_",
+		LookupEnv: env(map[string]string{"LESSON_READ_TIMEOUT": "5s", "LESSON_PORT": "6060"}),
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		source Source
+		from   string
+	}{
+		{"port", "7070", Flag, ""},                         // the command line beats the variable and the file
+		{"read-timeout", "5s", Env, "LESSON_READ_TIMEOUT"}, // the variable beats the file
+		{"storage", "sqlite", File, path},
+		{"cors-origin", "https://a.example,https://b.example", File, path},
+		{"jwt-secret", "", Default, ""},
+	}
+	for _, tt := range tests {
+		s, _ := settings.Get(tt.name)
+		if s.Value != tt.value || s.Source != tt.source || s.From != tt.from {
+			t.Errorf("%s = %q from %s %s, want %q from %s %s", tt.name, s.Value, s.Source, s.From, tt.value, tt.source, tt.from)
+		}
+	}
+	if *l.port != 7070 || *l.timeout != 5*time.Second || len(l.origins) != 2 {
+		t.Errorf("flags: port %d, read-timeout %v, origins %q", *l.port, *l.timeout, l.origins)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeFile(t, "lesson.json", `{"port": 1000000, "storage": "sqlite"}`)
+	l := newLessonFlags()
+	if _, err := Load(l.fs, []string{"-config", path}, Options{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *l.port != 1000000 || *l.storage != "sqlite" {
+		t.Errorf("port %d, storage %q; want the file's", *l.port, *l.storage)
+	}
+}
+
+func TestLoadListFromEnv(t *testing.T) {
+	l := newLessonFlags()
+	_, err := Load(l.fs, nil, Options{
+		EnvPrefix: "LESSON_",
+		LookupEnv: env(map[string]string{"LESSON_CORS_ORIGIN": "https://a.example, https://b.example"}),
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := l.origins.String(); got != "https://a.example,https://b.example" {
+		t.Errorf("origins = %q", got)
+	}
+}
+
+func TestLoadCollectsProblems(t *testing.T) {
+	path := writeFile(t, "lesson.yaml", `
+port: eighty
+colour: blue
+storage: {kind: sqlite}
+`)
+	l := newLessonFlags()
+	_, err := Load(l.fs, []string{"-config", path}, Options{
+		EnvPrefix: "LESSON_",
+		LookupEnv: env(map[string]string{"LESSON_READ_TIMEOUT": "soon"}),
+		Check: func() []string {
+			return []string{"the port must be between 0 and 65535"}
+		},
+	})
+	if err == nil {
+		t.Fatal("Load succeeded, want problems")
+	}
+	for _, want := range []string{
+		"invalid configuration:\n",
+		path + `: unknown setting "colour"`,
+		path + `: invalid value "eighty" for -port`,
+		`LESSON_READ_TIMEOUT: invalid value "soon" for -read-timeout`,
+		path + ": storage: must be a value or a list of values",
+		"the port must be between 0 and 65535",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error:\n%v\nwant it to contain %q", err, want)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownExtension(t *testing.T) {
+	path := writeFile(t, "lesson.toml", `port = 9090`)
+	_, err := Load(newLessonFlags().fs, []string{"-config", path}, Options{})
+	if err == nil || !strings.Contains(err.Error(), "must be .json, .yaml or .yml") {
+		t.Errorf("Load = %v, want an error about the extension", err)
+	}
+}
+
+func TestPrintHidesSecrets(t *testing.T) {
+	l := newLessonFlags()
+	settings, err := Load(l.fs, []string{"-jwt-secret", "hunter2"}, Options{Secret: []string{"jwt-secret"}})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var out bytes.Buffer
+	if err := settings.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("Print showed the secret:\n%s", out.String())
+	}
+	for _, want := range []string{"Effective configuration:\n", "jwt-secret    [hidden]", "port          8080", "default\n", "flag\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Print:\n%s\nwant it to contain %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package demo lets lessons run in deterministic mode, where what they
+// print is the same on every run: for golden tests, and for recording a
+// lesson without the numbers changing between takes.
+//
+// Turn it on with golab run -deterministic, by setting
+// GOLAB_DETERMINISTIC=1, or in a test with Deterministic. Lessons then get
+// their randomness, clock readings and random delays from this package:
+//
+//	n := demo.Rand().Intn(100)          // the same n every run
+//	hour := demo.Now().Hour()           // always 9 in the morning
+//	time.Sleep(demo.Jitter(time.Second)) // no delay at all
+//
+// Sleeps that put goroutines in order stay as they are. Removing them
+// would change what a lesson prints, not make it repeatable.
+package demo
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// EnvVar turns deterministic mode on for a whole process when set to a
+// true value such as 1
+const EnvVar = "GOLAB_DETERMINISTIC"
+
+// Seed is what Rand is seeded with in deterministic mode
+const Seed = 1
+
+// Clock is the time Now always returns in deterministic mode: a Monday
+// morning, so lessons that greet by time of day say good morning
+var Clock = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+var (
+	fromEnv = envEnabled()
+	// tests holds how many Deterministic calls haven't been undone yet,
+	// so parallel tests can't switch the mode off under each other
+	tests atomic.Int32
+)
+
+func envEnabled() bool {
+	on, err := strconv.ParseBool(os.Getenv(EnvVar))
+	return err == nil && on
+}
+
+// Enabled reports whether deterministic mode is on
+func Enabled() bool {
+	return fromEnv || tests.Load() > 0
+}
+
+// Deterministic turns deterministic mode on until the returned function
+// is called. Tests use it as
+//
+//	defer demo.Deterministic()()
+func Deterministic() (undo func()) {
+	tests.Add(1)
+	var once atomic.Bool
+	return func() {
+		if once.CompareAndSwap(false, true) {
+			tests.Add(-1)
+		}
+	}
+}
+
+// Rand returns a new random number generator for the caller to keep. In
+// deterministic mode it always produces the same numbers.
+func Rand() *rand.Rand {
+	if Enabled() {
+		return rand.New(rand.NewSource(Seed))
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// Now is time.Now, except that in deterministic mode the clock stands
+// still at Clock
+func Now() time.Time {
+	if Enabled() {
+		return Clock
+	}
+	return time.Now()
+}
+
+// Elapsed returns a measured duration, cut down to tenths of a second in
+// deterministic mode so a measured "took 1s" doesn't come out as 1.0012s
+// on one run and 1.0009s on the next
+func Elapsed(d time.Duration) time.Duration {
+	if Enabled() {
+		return d.Truncate(100 * time.Millisecond)
+	}
+	return d
+}
+
+// Jitter is a random duration below limit, for simulating work that
+// takes a varying time. In deterministic mode there is no jitter: it is
+// zero.
+func Jitter(limit time.Duration) time.Duration {
+	if Enabled() || limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
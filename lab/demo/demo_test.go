@@ -0,0 +1,44 @@
+package demo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	if fromEnv {
+		t.Skip(EnvVar + " is set")
+	}
+	if Enabled() {
+		t.Fatal("enabled before Deterministic")
+	}
+
+	undo := Deterministic()
+	inner := Deterministic()
+	inner()
+	inner() // a second undo must not switch off the outer one
+	if !Enabled() {
+		t.Fatal("an inner undo switched deterministic mode off")
+	}
+
+	if a, b := Rand().Int63(), Rand().Int63(); a != b {
+		t.Errorf("Rand gave %d then %d, want the same number", a, b)
+	}
+	if !Now().Equal(Clock) {
+		t.Errorf("Now = %v, want %v", Now(), Clock)
+	}
+	if d := Jitter(time.Second); d != 0 {
+		t.Errorf("Jitter = %v, want 0", d)
+	}
+	if d := Elapsed(1234 * time.Millisecond); d != 1200*time.Millisecond {
+		t.Errorf("Elapsed = %v, want 1.2s", d)
+	}
+
+	undo()
+	if Enabled() {
+		t.Error("still enabled after undo")
+	}
+	if d := Jitter(time.Second); d < 0 || d >= time.Second {
+		t.Errorf("Jitter = %v, want below 1s", d)
+	}
+}
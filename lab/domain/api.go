@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+)
+
+// CreateUserRequest is the payload for creating a user
+type CreateUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Age   int    `json:"age"`
+}
+
+// Validate returns every problem with the request, or nil if there are none
+func (req CreateUserRequest) Validate() []ValidationError {
+	var errors []ValidationError
+
+	if strings.TrimSpace(req.Name) == "" {
+		errors = append(errors, ValidationError{
+			Field:   "name",
+			Message: "Name is required",
+		})
+	}
+
+	if strings.TrimSpace(req.Email) == "" {
+		errors = append(errors, ValidationError{
+			Field:   "email",
+			Message: "Email is required",
+		})
+	} else if !ValidEmail(req.Email) {
+		errors = append(errors, ValidationError{
+			Field:   "email",
+			Message: "Invalid email format",
+		})
+	}
+
+	if req.Age < MinAge || req.Age > MaxAge {
+		errors = append(errors, ValidationError{
+			Field:   "age",
+			Message: "Age must be between 0 and 150",
+		})
+	}
+
+	return errors
+}
+
+// UpdateUserRequest is the payload for a partial update. Nil fields are
+// left unchanged. Version isn't a field to change: it's the version of
+// the user the update was made to, and Apply ignores it.
+type UpdateUserRequest struct {
+	Name    *string `json:"name,omitempty"`
+	Email   *string `json:"email,omitempty"`
+	Age     *int    `json:"age,omitempty"`
+	Version *int    `json:"version,omitempty"`
+}
+
+// Apply copies the fields that were sent onto user
+func (req UpdateUserRequest) Apply(user *User) {
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.Age != nil {
+		user.Age = *req.Age
+	}
+}
+
+// APIResponse is the envelope for successful API responses. In XML it's
+// a <response> element; Data is whatever the endpoint returns.
+type APIResponse struct {
+	XMLName xml.Name    `json:"-" xml:"response" yaml:"-"`
+	Success bool        `json:"success" xml:"success" yaml:"success"`
+	Message string      `json:"message,omitempty" xml:"message,omitempty" yaml:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty" xml:"data,omitempty" yaml:"data,omitempty"`
+	Error   string      `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+	// Meta describes the page Data is, for endpoints that paginate
+	Meta *PageMeta `json:"meta,omitempty" xml:"meta,omitempty" yaml:"meta,omitempty"`
+	// Links are what a client can do next from here, for hypermedia APIs
+	Links Links `json:"_links,omitempty" xml:"links,omitempty" yaml:"_links,omitempty"`
+}
+
+// Link is a hypermedia link: a URL, and the method to use on it
+type Link struct {
+	Href   string `json:"href" xml:"href,attr" yaml:"href"`
+	Method string `json:"method,omitempty" xml:"method,attr,omitempty" yaml:"method,omitempty"`
+}
+
+// Links are a resource's links by relation ("self", "next", ...), like
+// HAL's _links. XML has no maps, so there each is a <link rel="...">, in
+// order of relation.
+type Links map[string]Link
+
+// MarshalXML implements xml.Marshaler
+func (links Links) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	rels := make([]string, 0, len(links))
+	for rel := range links {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		link := xml.StartElement{Name: xml.Name{Local: "link"}, Attr: []xml.Attr{{Name: xml.Name{Local: "rel"}, Value: rel}}}
+		if err := e.EncodeElement(links[rel], link); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// PageMeta says where a page of results sits in the whole list. Next and
+// Prev are links to the neighbouring pages, with the same filters, and
+// are empty at either end. A page fetched by cursor has no number, and
+// NextCursor instead: what to send as ?cursor= for the next one.
+type PageMeta struct {
+	Total      int    `json:"total" xml:"total" yaml:"total"`                            // results across every page
+	Page       int    `json:"page,omitempty" xml:"page,omitempty" yaml:"page,omitempty"` // counting from 1
+	Limit      int    `json:"limit" xml:"limit" yaml:"limit"`                            // results per page
+	Pages      int    `json:"pages" xml:"pages" yaml:"pages"`
+	Next       string `json:"next,omitempty" xml:"next,omitempty" yaml:"next,omitempty"`
+	Prev       string `json:"prev,omitempty" xml:"prev,omitempty" yaml:"prev,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty" yaml:"next_cursor,omitempty"`
+}
+
+// ErrorResponse is the body of every API error, with per-field details
+// when validation failed
+type ErrorResponse struct {
+	Error   string            `json:"error"`
+	Details []ValidationError `json:"details,omitempty"`
+}
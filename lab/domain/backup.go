@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BackupVersion is the version of the Backup format this code writes.
+// Change it, and teach importers the old one, if the format changes.
+const BackupVersion = 1
+
+// Backup is a whole user store as one JSON document. Exporting from one
+// storage backend and importing into another moves the data between them.
+type Backup struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Users      []User    `json:"users"`
+}
+
+// NewBackup returns a backup of users in the current format
+func NewBackup(users []User, exportedAt time.Time) Backup {
+	if users == nil {
+		users = []User{} // an empty store is [], not null
+	}
+	return Backup{Version: BackupVersion, ExportedAt: exportedAt, Users: users}
+}
+
+// Validate returns every problem that would stop the backup being
+// restored, or nil if there are none. Fields are named like
+// "users[2].email".
+func (b Backup) Validate() []ValidationError {
+	var errors []ValidationError
+	if b.Version != BackupVersion {
+		errors = append(errors, ValidationError{
+			Field:   "version",
+			Message: fmt.Sprintf("Unsupported version %d; expected %d", b.Version, BackupVersion),
+		})
+	}
+	if b.Users == nil {
+		errors = append(errors, ValidationError{
+			Field:   "users",
+			Message: "Users are required; use [] for an empty store",
+		})
+	}
+
+	ids := make(map[int]int)
+	emails := make(map[string]int)
+	for i, user := range b.Users {
+		field := fmt.Sprintf("users[%d]", i)
+		if user.ID <= 0 {
+			errors = append(errors, ValidationError{Field: field + ".id", Message: "ID must be positive"})
+		} else if first, ok := ids[user.ID]; ok {
+			errors = append(errors, ValidationError{
+				Field:   field + ".id",
+				Message: fmt.Sprintf("ID %d is also used by users[%d]", user.ID, first),
+			})
+		} else {
+			ids[user.ID] = i
+		}
+
+		req := CreateUserRequest{Name: user.Name, Email: user.Email, Age: user.Age}
+		for _, problem := range req.Validate() {
+			problem.Field = field + "." + problem.Field
+			errors = append(errors, problem)
+		}
+
+		email := strings.ToLower(user.Email)
+		if first, ok := emails[email]; ok && email != "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".email",
+				Message: fmt.Sprintf("Email is also used by users[%d]", first),
+			})
+		} else {
+			emails[email] = i
+		}
+	}
+	return errors
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@example.com", true},
+		{"a@b", true},
+		{"first.last+tag@sub.example.co.uk", true},
+		{"a@b@c", true}, // loose: anything before and after the first @
+		{"", false},
+		{"@", false},
+		{"alice", false},
+		{"@example.com", false},
+		{"alice@", false},
+	}
+	for _, tt := range tests {
+		if got := ValidEmail(tt.email); got != tt.want {
+			t.Errorf("ValidEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
+
+// TestAgeLimits checks MinAge and MaxAge are both allowed, and one past
+// either isn't
+func TestAgeLimits(t *testing.T) {
+	for age, valid := range map[int]bool{MinAge - 1: false, MinAge: true, MaxAge: true, MaxAge + 1: false} {
+		errs := CreateUserRequest{Name: "Alice", Email: "alice@example.com", Age: age}.Validate()
+		if valid && len(errs) != 0 {
+			t.Errorf("age %d: %v, want no errors", age, errs)
+		}
+		if !valid && (len(errs) != 1 || errs[0].Field != "age") {
+			t.Errorf("age %d: %v, want one error for age", age, errs)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := CreateUserRequest{Name: "  ", Email: "alice"}.Validate()
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field+": "+err.Message)
+	}
+	want := []string{"name: Name is required", "email: Invalid email format"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Validate = %q, want %q", fields, want)
+	}
+}
+
+func TestValidationErrorError(t *testing.T) {
+	var err error = ValidationError{Field: "email", Message: "Email is required"}
+	if got, want := err.Error(), "validation error in field 'email': Email is required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+// TestUsersXMLRoundTrip marshals a list of users, each as a <user>, and
+// reads it back
+func TestUsersXMLRoundTrip(t *testing.T) {
+	created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	users := Users{
+		{ID: 1, Name: "Alice", Email: "alice@example.com", Age: 30, CreatedAt: created, UpdatedAt: created, Version: 1},
+		{ID: 2, Name: "Bob <admin>", Email: "bob@example.com", Age: 25, CreatedAt: created, UpdatedAt: created.Add(time.Hour)},
+	}
+	data, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"users"`
+		Users   Users
+	}{Users: users})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "<user>"); n != len(users) {
+		t.Errorf("%d <user> elements in %s, want %d", n, data, len(users))
+	}
+	if strings.Contains(string(data), "<version>0</version>") {
+		t.Errorf("a zero version was sent: %s", data)
+	}
+
+	var got struct {
+		Users []User `xml:"Users>user"`
+	}
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(Users(got.Users), users) {
+		t.Errorf("round trip gave %+v, want %+v", got.Users, users)
+	}
+
+	// An empty list is an empty element
+	data, err = xml.Marshal(struct {
+		XMLName xml.Name `xml:"users"`
+		Users   Users
+	}{Users: Users{}})
+	if err != nil || string(data) != "<users><Users></Users></users>" {
+		t.Errorf("empty list = %s, %v", data, err)
+	}
+}
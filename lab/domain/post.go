@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Post is something a User wrote, for lessons that need a second resource
+// that belongs to the first
+type Post struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,45 @@
+// Package domain holds the types that several lessons share: the User
+// model, validation errors, and the request/response shapes of the user
+// API. Lessons import it as "golang-lab/lab/domain" instead of each
+// declaring its own copy.
+package domain
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// User is the user record used throughout the lessons. Lessons that don't
+// track timestamps simply leave CreatedAt and UpdatedAt zero, and those
+// without optimistic locking leave Version zero, which isn't sent. The xml and
+// yaml tags give it the same field names in every format lesson 10 sends,
+// and the bson tags the same keys in MongoDB, where ID is the _id.
+type User struct {
+	ID        int       `json:"id" xml:"id" yaml:"id" bson:"_id"`
+	Name      string    `json:"name" xml:"name" yaml:"name" bson:"name"`
+	Email     string    `json:"email" xml:"email" yaml:"email" bson:"email"`
+	Age       int       `json:"age" xml:"age" yaml:"age" bson:"age"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at" yaml:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at" yaml:"updated_at" bson:"updated_at"`
+	// Version counts the user's changes: 1 when created, and one more
+	// with each update. Lesson 10 requires it on PUT and PATCH.
+	Version int `json:"version,omitempty" xml:"version,omitempty" yaml:"version,omitempty" bson:"version"`
+}
+
+// Users is a list of users. In JSON and YAML it's an ordinary list, but
+// XML has no lists, only repeated elements, so there each user is a
+// <user> inside the list's own element.
+type Users []User
+
+// MarshalXML implements xml.Marshaler
+func (users Users) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := e.EncodeElement(user, xml.StartElement{Name: xml.Name{Local: "user"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Age limits accepted by the validators
+const (
+	MinAge = 0
+	MaxAge = 150
+)
+
+// ValidationError describes one invalid field. It is both an error, for
+// code that returns it, and a JSON object, for APIs that send it back.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("validation error in field '%s': %s", e.Field, e.Message)
+}
+
+// ValidEmail is a deliberately loose check: something before and after an @
+func ValidEmail(email string) bool {
+	at := strings.Index(email, "@")
+	return at > 0 && at < len(email)-1
+}
@@ -0,0 +1,140 @@
+// Package fixtures generates seed data for demos, tests and benchmarks.
+// The data is deterministic: Users(n) returns the same users on every
+// run and every machine, so golden files and benchmark results stay
+// comparable. It is also stable as n grows, so Users(Small) is the first
+// ten of Users(Large).
+//
+//	for _, user := range fixtures.Users(fixtures.Small) {
+//		users[user.ID] = user
+//	}
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// Sizes for Users: a handful to read in a demo, enough to page through,
+// and enough to show up in a benchmark
+const (
+	Small  = 10
+	Medium = 1_000
+	Large  = 100_000
+)
+
+// Epoch is when the first seed user signed up. Later users follow an hour
+// apart, so CreatedAt is fixed too.
+var Epoch = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// The first two users are the ones lesson 10 has always started with
+var firstUsers = []domain.User{
+	{Name: "John Doe", Email: "john@example.com", Age: 25},
+	{Name: "Jane Smith", Email: "jane@example.com", Age: 30},
+}
+
+var (
+	firstNames = []string{"Ada", "Alan", "Barbara", "Dennis", "Edsger", "Frances", "Grace", "Ken", "Katherine", "Linus", "Margaret", "Niklaus", "Radia", "Rob", "Shafi", "Tim"}
+	lastNames  = []string{"Allen", "Cerf", "Hopper", "Kernighan", "Knuth", "Lamport", "Liskov", "Lovelace", "Pike", "Perlman", "Ritchie", "Thompson", "Turing", "Wirth"}
+	topics     = []string{"goroutines", "channels", "interfaces", "error handling", "generics", "testing", "JSON", "HTTP servers", "context", "pointers"}
+	verbs      = []string{"Understanding", "A tour of", "Mistakes I made with", "Notes on", "Getting started with", "Benchmarking"}
+)
+
+// seed makes every run produce the same data
+const seed = 20240101
+
+// Users returns n users with IDs 1 to n
+func Users(n int) []domain.User {
+	next := userSequence()
+	users := make([]domain.User, n)
+	for i := range users {
+		users[i] = next()
+	}
+	return users
+}
+
+// EachUser calls fn with the users Users(n) returns, one at a time, and
+// stops at the first error, which it returns. Only one user is in memory
+// at a time, so n can be as large as a streaming demo likes.
+func EachUser(n int, fn func(domain.User) error) error {
+	next := userSequence()
+	for i := 0; i < n; i++ {
+		if err := fn(next()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userSequence returns a function that returns user 1, then user 2, and
+// so on
+func userSequence() func() domain.User {
+	rng := rand.New(rand.NewSource(seed))
+	i := 0
+	return func() domain.User {
+		// Every user takes the same three draws, first two included, so
+		// the sequence doesn't depend on n
+		first := firstNames[rng.Intn(len(firstNames))]
+		last := lastNames[rng.Intn(len(lastNames))]
+		age := 18 + rng.Intn(60)
+
+		user := domain.User{
+			Name:  first + " " + last,
+			Email: fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), i+1),
+			Age:   age,
+		}
+		if i < len(firstUsers) {
+			user = firstUsers[i]
+		}
+		user.ID = i + 1
+		user.CreatedAt = Epoch.Add(time.Duration(i) * time.Hour)
+		user.UpdatedAt = user.CreatedAt
+		i++
+		return user
+	}
+}
+
+// Posts returns perUser posts written by each of users, with IDs counting
+// from 1 in order, each a few minutes after the last by the same author
+func Posts(users []domain.User, perUser int) []domain.Post {
+	rng := rand.New(rand.NewSource(seed))
+	posts := make([]domain.Post, 0, len(users)*perUser)
+	for _, user := range users {
+		for i := 0; i < perUser; i++ {
+			topic := topics[rng.Intn(len(topics))]
+			verb := verbs[rng.Intn(len(verbs))]
+			posts = append(posts, domain.Post{
+				ID:        len(posts) + 1,
+				UserID:    user.ID,
+				Title:     verb + " " + topic,
+				Body:      fmt.Sprintf("%s writes about %s.", user.Name, topic),
+				CreatedAt: user.CreatedAt.Add(time.Duration(i+1) * 10 * time.Minute),
+			})
+		}
+	}
+	return posts
+}
+
+// UserCreator is the one method Load needs. Any store that can add a
+// domain.User has it, whatever else its interface holds.
+type UserCreator interface {
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+}
+
+// Load adds users to store in order and returns them as the store saved
+// them, with whatever IDs it assigned. It stops at the first error.
+func Load(ctx context.Context, store UserCreator, users []domain.User) ([]domain.User, error) {
+	saved := make([]domain.User, 0, len(users))
+	for _, user := range users {
+		created, err := store.Create(ctx, user)
+		if err != nil {
+			return saved, fmt.Errorf("loading user %d (%s): %w", user.ID, user.Email, err)
+		}
+		saved = append(saved, created)
+	}
+	return saved, nil
+}
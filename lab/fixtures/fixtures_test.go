@@ -0,0 +1,125 @@
+package fixtures
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+func TestUsersDeterministic(t *testing.T) {
+	if !reflect.DeepEqual(Users(Small), Users(Small)) {
+		t.Fatal("Users(Small) differs between calls")
+	}
+	if !reflect.DeepEqual(Users(Small), Users(Medium)[:Small]) {
+		t.Error("Users(Small) isn't the start of Users(Medium)")
+	}
+
+	users := Users(3)
+	if users[0].Name != "John Doe" || users[1].Name != "Jane Smith" {
+		t.Errorf("first users = %q, %q, want lesson 10's John Doe and Jane Smith", users[0].Name, users[1].Name)
+	}
+	if users[2].CreatedAt != Epoch.Add(2*time.Hour) {
+		t.Errorf("third user created at %v, want two hours after Epoch", users[2].CreatedAt)
+	}
+}
+
+func TestEachUser(t *testing.T) {
+	var got []domain.User
+	err := EachUser(Small, func(user domain.User) error {
+		got = append(got, user)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(got, Users(Small)) {
+		t.Errorf("EachUser(Small) = %v, and users that aren't Users(Small)", err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = EachUser(Small, func(domain.User) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || calls != 3 {
+		t.Errorf("EachUser = %v after %d calls, want fn's error after 3", err, calls)
+	}
+}
+
+func TestUsersValid(t *testing.T) {
+	emails := make(map[string]bool)
+	for i, user := range Users(Medium) {
+		if user.ID != i+1 {
+			t.Fatalf("user %d has ID %d", i, user.ID)
+		}
+		req := domain.CreateUserRequest{Name: user.Name, Email: user.Email, Age: user.Age}
+		if problems := req.Validate(); len(problems) > 0 {
+			t.Fatalf("user %d is invalid: %v", user.ID, problems)
+		}
+		if emails[user.Email] {
+			t.Fatalf("user %d repeats email %s", user.ID, user.Email)
+		}
+		emails[user.Email] = true
+	}
+}
+
+func TestPosts(t *testing.T) {
+	users := Users(Small)
+	posts := Posts(users, 3)
+	if len(posts) != 3*Small {
+		t.Fatalf("got %d posts, want %d", len(posts), 3*Small)
+	}
+	for i, post := range posts {
+		author := users[i/3]
+		if post.ID != i+1 || post.UserID != author.ID || post.Title == "" || !post.CreatedAt.After(author.CreatedAt) {
+			t.Errorf("post %d = %+v, want ID %d by user %d after they signed up", i, post, i+1, author.ID)
+		}
+	}
+	if !reflect.DeepEqual(posts, Posts(Users(Medium), 3)[:len(posts)]) {
+		t.Error("Posts for the first users change when there are more users")
+	}
+}
+
+// sliceStore numbers users itself, like a real store would
+type sliceStore struct {
+	users []domain.User
+	full  int
+}
+
+var errFull = errors.New("store full")
+
+func (s *sliceStore) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	if len(s.users) == s.full {
+		return domain.User{}, errFull
+	}
+	user.ID = 100 + len(s.users)
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func TestLoad(t *testing.T) {
+	store := &sliceStore{full: Small}
+	saved, err := Load(context.Background(), store, Users(Small))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != Small || saved[0].ID != 100 || saved[0].Email != "john@example.com" {
+		t.Errorf("Load returned %d users starting with %+v, want the store's IDs", len(saved), saved[0])
+	}
+
+	saved, err = Load(context.Background(), &sliceStore{full: 2}, Users(Small))
+	if !errors.Is(err, errFull) || len(saved) != 2 {
+		t.Errorf("Load into a full store = %d users, %v; want 2 and errFull", len(saved), err)
+	}
+}
+
+func BenchmarkUsersLarge(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Users(Large)
+	}
+}
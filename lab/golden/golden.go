@@ -0,0 +1,116 @@
+// Package golden checks what lessons print against golden files checked
+// in under each lesson's testdata directory, so a refactor can't quietly
+// change what a lesson teaches.
+//
+// Lesson tests run a demo in deterministic mode: lab/demo fixes the
+// random numbers and the clock, output goes to a buffer that goroutines
+// can share, and scrubbers replace whatever still changes from run to run
+// (addresses, measured timings, goroutine order) with placeholders.
+// After an intended change, rewrite the golden files with
+//
+//	go test ./lesson06-control-structures -update
+//
+// and review the diff before committing it.
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang-lab/lab/demo"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// Scrubber rewrites the parts of some output that change between runs
+type Scrubber func(string) string
+
+// Replace is a Scrubber that replaces every match of pattern, which may
+// refer to submatches like regexp.ReplaceAllString
+func Replace(pattern, replacement string) Scrubber {
+	re := regexp.MustCompile(pattern)
+	return func(s string) string {
+		return re.ReplaceAllString(s, replacement)
+	}
+}
+
+// Timestamps replaces RFC 3339 times, like those time.Time marshals to JSON
+var Timestamps = Replace(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)`, "<timestamp>")
+
+// Check scrubs got and compares it with testdata/name, or writes it there
+// when the tests run with -update
+func Check(t testing.TB, name, got string, scrubbers ...Scrubber) {
+	t.Helper()
+	for _, scrub := range scrubbers {
+		got = scrub(got)
+	}
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s at %s; got:\n%s", path, firstDifference(string(want), got), got)
+	}
+}
+
+// Demo runs demo in deterministic mode and checks what it prints
+func Demo(t testing.TB, name string, run func(w io.Writer), scrubbers ...Scrubber) {
+	t.Helper()
+	defer demo.Deterministic()()
+	var out Buffer
+	run(&out)
+	Check(t, name, out.String(), scrubbers...)
+}
+
+// firstDifference names the first line where want and got disagree, which
+// is easier to find than the difference in a page of output
+func firstDifference(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := range gotLines {
+		if i >= len(wantLines) {
+			return fmt.Sprintf("line %d (extra output)", i+1)
+		}
+		if gotLines[i] != wantLines[i] {
+			return fmt.Sprintf("line %d (want %q)", i+1, wantLines[i])
+		}
+	}
+	return fmt.Sprintf("line %d (output ends early)", len(gotLines))
+}
+
+// Buffer is a bytes.Buffer that goroutines can print to at the same time
+type Buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *Buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,211 @@
+package httpmw
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultBodyLogBytes is how much of each body BodyLog keeps, unless
+// BodyLogOptions says otherwise
+const DefaultBodyLogBytes = 2048
+
+// DefaultRedact are the fields BodyLog blanks out, unless BodyLogOptions
+// says otherwise
+var DefaultRedact = []string{
+	"password", "secret", "client_secret", "token", "access_token", "refresh_token", "api_key", "authorization",
+}
+
+// BodyLogOptions says what BodyLog keeps
+type BodyLogOptions struct {
+	// Logger is where the bodies go; nil for the standard logger
+	Logger *log.Logger
+	// MaxBytes is how much of each body is logged; DefaultBodyLogBytes if 0
+	MaxBytes int
+	// Redact are the JSON fields and form values, by name, whose values
+	// are logged as [REDACTED], ignoring case; DefaultRedact if nil
+	Redact []string
+}
+
+// BodyLog logs the body of each request and of its response, two lines
+// a request, for debugging what a client really sent:
+//
+//	> POST /api/auth/login req=4f9c2b7e01d3a8f6 52B application/json {"email":"a@example.com","password":"[REDACTED]"}
+//	< POST /api/auth/login req=4f9c2b7e01d3a8f6 200 96B application/json {"token":"[REDACTED]",...}
+//
+// It copies the bodies as they go by rather than reading them first: the
+// request body as the handler reads it, and the response as the handler
+// writes it, each passed on at once. So a handler that streams still
+// streams, and one that never reads the body isn't made to wait for it.
+// Only the first MaxBytes of each are kept, and the lines are written
+// when the handler returns. Bodies that aren't text, or are compressed,
+// are logged by size alone; put BodyLog after Gzip in a chain, so it
+// sees what the handler wrote.
+//
+// Bodies carry passwords and tokens, and logs are read by more people
+// than the API is: BodyLog blanks out the fields Redact names, but it's
+// still meant to be turned on for a while, not left on.
+func BodyLog(opts BodyLogOptions) Middleware {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultBodyLogBytes
+	}
+	names := opts.Redact
+	if names == nil {
+		names = DefaultRedact
+	}
+	redact := newRedactor(names)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request := &capture{max: maxBytes}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &teeBody{ReadCloser: r.Body, capture: request}
+			}
+			rec := &bodyRecorder{responseRecorder: newResponseRecorder(w), capture: capture{max: maxBytes}}
+			next.ServeHTTP(rec, r)
+
+			line := r.Method + " " + r.URL.RequestURI()
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				line += " req=" + id
+			}
+			described := request.describe(r.Header, redact)
+			if request.n == 0 && r.ContentLength > 0 {
+				described = fmt.Sprintf("%dB, not read by the handler", r.ContentLength)
+			}
+			logger.Printf("> %s %s", line, described)
+			logger.Printf("< %s %d %s", line, rec.status, rec.capture.describe(rec.Header(), redact))
+		})
+	}
+}
+
+// capture keeps the first max bytes of a body, and counts all of them
+type capture struct {
+	max int
+	buf []byte
+	n   int
+}
+
+func (c *capture) keep(p []byte) {
+	if room := c.max - len(c.buf); room > 0 {
+		c.buf = append(c.buf, p[:min(room, len(p))]...)
+	}
+	c.n += len(p)
+}
+
+// describe is how the log shows the body: its size, its media type from
+// header, and the text of it, redacted
+func (c *capture) describe(header http.Header, redact *redactor) string {
+	if c.n == 0 {
+		return "no body"
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "" // there's none, or it's too malformed to go by
+	}
+	if encoding := header.Get("Content-Encoding"); encoding != "" {
+		return fmt.Sprintf("%dB %s, %s", c.n, mediaType, encoding)
+	}
+	if !textual(mediaType, c.buf) {
+		return fmt.Sprintf("%dB %s", c.n, mediaType)
+	}
+
+	text := redact.apply(strings.ToValidUTF8(string(c.buf), ""), mediaType)
+	// One line per body, without the newline encoding/json ends with
+	text = strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(strings.TrimRight(text, "\r\n"))
+	if more := c.n - len(c.buf); more > 0 {
+		text += fmt.Sprintf("... (%dB more)", more)
+	}
+	if mediaType == "" {
+		return fmt.Sprintf("%dB %s", c.n, text)
+	}
+	return fmt.Sprintf("%dB %s %s", c.n, mediaType, text)
+}
+
+// textual reports whether a body of mediaType is worth logging as text.
+// Without a media type, it's text if it's valid UTF-8; a body cut off
+// mid-character still is.
+func textual(mediaType string, body []byte) bool {
+	switch {
+	case mediaType == "":
+		for i := 0; i < utf8.UTFMax && len(body) > 0 && !utf8.Valid(body); i++ {
+			body = body[:len(body)-1]
+		}
+		return utf8.Valid(body)
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/x-www-form-urlencoded":
+		return true
+	}
+	for _, suffix := range []string{"json", "xml", "yaml"} {
+		if strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// teeBody keeps a copy of what's read from a request body
+type teeBody struct {
+	io.ReadCloser
+	capture *capture
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture.keep(p[:n])
+	return n, err
+}
+
+// bodyRecorder keeps a copy of what's written to a response. Flush and
+// Hijack come from responseRecorder.
+type bodyRecorder struct {
+	*responseRecorder
+	capture capture
+}
+
+func (rec *bodyRecorder) Write(p []byte) (int, error) {
+	n, err := rec.responseRecorder.Write(p)
+	rec.capture.keep(p[:n])
+	return n, err
+}
+
+// redactor blanks out the values of named fields: in JSON, "name": value,
+// and in a form, name=value. A value cut off by MaxBytes is still
+// blanked, as far as it goes.
+type redactor struct {
+	json, form *regexp.Regexp
+}
+
+func newRedactor(names []string) *redactor {
+	if len(names) == 0 {
+		return &redactor{}
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	alternatives := strings.Join(quoted, "|")
+	return &redactor{
+		json: regexp.MustCompile(`(?i)("(?:` + alternatives + `)"\s*:\s*)(?:"(?:[^"\\]|\\.)*"?|[^\s,}\]]+)`),
+		form: regexp.MustCompile(`(?i)((?:^|&)(?:` + alternatives + `)=)[^&]*`),
+	}
+}
+
+func (rd *redactor) apply(text, mediaType string) string {
+	switch {
+	case rd.json == nil:
+		return text
+	case mediaType == "application/x-www-form-urlencoded":
+		return rd.form.ReplaceAllString(text, "${1}[REDACTED]")
+	default:
+		return rd.json.ReplaceAllString(text, `${1}"[REDACTED]"`)
+	}
+}
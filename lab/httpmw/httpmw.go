@@ -0,0 +1,80 @@
+// Package httpmw is the HTTP middleware the server lessons share: access
+// logging, CORS, panic recovery, request IDs, gzip compression, Basic
+// auth, and body logging for debugging. Lesson 09 shows how middleware is written; later
+// lessons import these instead of copying it:
+//
+//	handler := httpmw.Chain(mux,
+//		httpmw.RequestID(),
+//		httpmw.Logging(nil),
+//		httpmw.Recover(nil),
+//		httpmw.CORS(httpmw.CORSOptions{}),
+//		httpmw.Gzip(gzip.DefaultCompression),
+//	)
+package httpmw
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Middleware wraps a handler to add behavior before or after it runs
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middleware so that the first one listed runs first:
+// Chain(h, a, b) is a(b(h))
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// responseRecorder remembers what a handler sent, for middleware that
+// needs to know after the fact
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the real ResponseWriter
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Flush and Hijack keep streaming responses and WebSockets working behind
+// the recorder
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("httpmw: ResponseWriter doesn't support hijacking")
+}
@@ -0,0 +1,402 @@
+package httpmw
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs one request through h and returns the recorded response
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+var hello = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "hello")
+})
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	serve(Chain(hello, tag("a"), tag("b"), tag("c")), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, ","); got != "a,b,c" {
+		t.Errorf("middleware ran in order %s, want a,b,c", got)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	h := Chain(http.NotFoundHandler(), RequestID(), Logging(logger))
+
+	r := httptest.NewRequest("GET", "/missing?x=1", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	serve(h, r)
+
+	want := regexp.MustCompile(`^GET /missing\?x=1 404 19B \S+ req=abc-123\n$`)
+	if !want.MatchString(buf.String()) {
+		t.Errorf("logged %q, want a line matching %s", buf.String(), want)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       CORSOptions
+		method     string
+		origin     string
+		preflight  bool
+		wantStatus int
+		wantOrigin string
+		wantVary   string
+	}{
+		{name: "any origin", method: "GET", origin: "https://a.example", wantStatus: 200, wantOrigin: "*"},
+		{name: "preflight answered", method: "OPTIONS", origin: "https://a.example", preflight: true, wantStatus: 204, wantOrigin: "*"},
+		{name: "plain OPTIONS reaches the handler", method: "OPTIONS", wantStatus: 200, wantOrigin: "*"},
+		{
+			name:       "listed origin",
+			opts:       CORSOptions{AllowedOrigins: []string{"https://a.example"}},
+			method:     "GET",
+			origin:     "https://a.example",
+			wantStatus: 200,
+			wantOrigin: "https://a.example",
+			wantVary:   "Origin",
+		},
+		{
+			name:       "unlisted origin",
+			opts:       CORSOptions{AllowedOrigins: []string{"https://a.example"}},
+			method:     "GET",
+			origin:     "https://evil.example",
+			wantStatus: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", "PUT")
+			}
+			rec := serve(CORS(tt.opts)(hello), r)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Vary"); got != tt.wantVary {
+				t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+			}
+		})
+	}
+
+	rec := serve(CORS(CORSOptions{AllowedMethods: []string{"GET"}, MaxAge: time.Hour})(hello), httptest.NewRequest("GET", "/", nil))
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET" {
+		t.Errorf("Access-Control-Allow-Methods = %q, want GET", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "3600" {
+		t.Errorf("Access-Control-Max-Age = %q, want 3600", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	h := Recover(log.New(&buf, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := serve(h, httptest.NewRequest("GET", "/explode", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if !strings.HasPrefix(buf.String(), "panic serving GET /explode: boom\n") || !strings.Contains(buf.String(), "goroutine") {
+		t.Errorf("logged %q, want the panic and a stack trace", buf.String())
+	}
+
+	// After the header is out, the only honest thing left is to abort
+	h = Recover(log.New(io.Discard, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "partial")
+		panic("boom")
+	}))
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+	}()
+	serve(h, httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "from-proxy_1")
+	if rec := serve(h, r); seen != "from-proxy_1" || rec.Header().Get(RequestIDHeader) != "from-proxy_1" {
+		t.Errorf("incoming ID not kept: handler saw %q, header %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+
+	for _, incoming := range []string{"", "has spaces", strings.Repeat("x", 65)} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(RequestIDHeader, incoming)
+		rec := serve(h, r)
+		if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(seen) || rec.Header().Get(RequestIDHeader) != seen {
+			t.Errorf("for incoming %q: handler saw %q, header %q, want a new 16-digit hex ID in both", incoming, seen, rec.Header().Get(RequestIDHeader))
+		}
+	}
+
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		t.Errorf("RequestIDFromContext outside the middleware = %q, want empty", id)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	h := BasicAuth(`Admin "area"`, "admin", "s3cret")(hello)
+
+	for _, tt := range []struct {
+		name       string
+		user, pass string
+		send       bool
+	}{
+		{"no credentials", "", "", false},
+		{"a wrong password", "admin", "wrong", true},
+		{"a wrong user", "root", "s3cret", true},
+		{"a password prefix", "admin", "s3c", true},
+		{"empty credentials", "", "", true},
+	} {
+		r := httptest.NewRequest("GET", "/admin", nil)
+		if tt.send {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		rec := serve(h, r)
+		if rec.Code != http.StatusUnauthorized || rec.Body.String() == "hello" {
+			t.Errorf("%s: status %d, want 401", tt.name, rec.Code)
+		}
+		if got, want := rec.Header().Get("WWW-Authenticate"), `Basic realm="Admin \"area\"", charset="UTF-8"`; got != want {
+			t.Errorf("%s: WWW-Authenticate = %s, want %s", tt.name, got, want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/admin", nil)
+	r.SetBasicAuth("admin", "s3cret")
+	if rec := serve(h, r); rec.Code != http.StatusOK || rec.Body.String() != "hello" || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("the right credentials got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGzip(t *testing.T) {
+	body := strings.Repeat("compress me ", 100)
+	h := Gzip(gzip.BestSpeed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "br")
+			fmt.Fprint(w, "already")
+		default:
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			fmt.Fprint(w, body)
+		}
+	}))
+
+	tests := []struct {
+		name, path, accept string
+		wantEncoding       string
+	}{
+		{name: "gzip accepted", path: "/", accept: "br, gzip", wantEncoding: "gzip"},
+		{name: "not accepted", path: "/", accept: "br"},
+		{name: "refused with q=0", path: "/", accept: "gzip;q=0"},
+		{name: "no body", path: "/empty", accept: "gzip"},
+		{name: "already encoded", path: "/encoded", accept: "gzip", wantEncoding: "br"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Accept-Encoding", tt.accept)
+			rec := serve(h, r)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if tt.wantEncoding != "gzip" {
+				return
+			}
+			if rec.Header().Get("Content-Length") != "" {
+				t.Error("Content-Length of the uncompressed body was kept")
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+				t.Errorf("Content-Type = %q, want it sniffed from the uncompressed body", got)
+			}
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Errorf("decompressed body = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestBodyLog(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"token": "eyJhbGciOi", "expires_in": 3600}`)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		default:
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}
+	})
+	tests := []struct {
+		name, path, contentType, body string
+		opts                          BodyLogOptions
+		want                          []string // the request's line, then the response's
+	}{
+		{
+			name: "JSON, redacted", path: "/login", contentType: "application/json",
+			body: `{"email":"a@example.com","Password":"hunter2"}`,
+			want: []string{
+				`> POST /login req=abc 46B application/json {"email":"a@example.com","Password":"[REDACTED]"}`,
+				`< POST /login req=abc 200 43B application/json {"token": "[REDACTED]", "expires_in": 3600}`,
+			},
+		},
+		{
+			name: "a form, redacted", path: "/echo", contentType: "application/x-www-form-urlencoded",
+			body: "user=ann&api_key=s3cr3t&next=%2F",
+			want: []string{
+				`> POST /echo req=abc 32B application/x-www-form-urlencoded user=ann&api_key=[REDACTED]&next=%2F`,
+				`< POST /echo req=abc 201 32B application/x-www-form-urlencoded user=ann&api_key=[REDACTED]&next=%2F`,
+			},
+		},
+		{
+			name: "cut off mid-secret", path: "/echo", contentType: "application/json",
+			body: `{"name":"ann","secret":"0123456789"}`, opts: BodyLogOptions{MaxBytes: 28},
+			want: []string{
+				`> POST /echo req=abc 36B application/json {"name":"ann","secret":"[REDACTED]"... (8B more)`,
+				`< POST /echo req=abc 201 36B application/json {"name":"ann","secret":"[REDACTED]"... (8B more)`,
+			},
+		},
+		{
+			name: "other fields redacted", path: "/echo", contentType: "application/json",
+			body: `{"password":"p","pin":1234}`, opts: BodyLogOptions{Redact: []string{"pin"}},
+			want: []string{
+				`> POST /echo req=abc 27B application/json {"password":"p","pin":"[REDACTED]"}`,
+				`< POST /echo req=abc 201 27B application/json {"password":"p","pin":"[REDACTED]"}`,
+			},
+		},
+		{
+			name: "lines kept whole", path: "/echo", contentType: "text/plain",
+			body: "one\ntwo\n",
+			want: []string{
+				`> POST /echo req=abc 8B text/plain one\ntwo`,
+				`< POST /echo req=abc 201 8B text/plain one\ntwo`,
+			},
+		},
+		{
+			name: "binary, by size", path: "/image",
+			want: []string{
+				`> POST /image req=abc no body`,
+				`< POST /image req=abc 200 4B image/png`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.opts.Logger = log.New(&buf, "", 0)
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Header.Set(RequestIDHeader, "abc")
+			rec := serve(Chain(echo, RequestID(), BodyLog(tt.opts)), r)
+
+			if tt.path == "/echo" && rec.Body.String() != tt.body {
+				t.Errorf("the handler got %q, want %q: logging mustn't change the body", rec.Body, tt.body)
+			}
+			if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logged\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	// A body the handler never reads is left unread, not read for the log
+	var buf bytes.Buffer
+	r := httptest.NewRequest("PUT", "/", strings.NewReader("ignored"))
+	serve(BodyLog(BodyLogOptions{Logger: log.New(&buf, "", 0)})(hello), r)
+	if want := "> PUT / 7B, not read by the handler\n< PUT / 200 5B text/plain hello\n"; buf.String() != want {
+		t.Errorf("logged %q, want %q", buf.String(), want)
+	}
+}
+
+// TestBodyLogStreams checks that a response still reaches the client as
+// it's written, with the body copied for the log on the way
+func TestBodyLogStreams(t *testing.T) {
+	next := make(chan struct{})
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	server := httptest.NewServer(BodyLog(BodyLogOptions{Logger: logger})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: one\n\n")
+		http.NewResponseController(w).Flush()
+		<-next
+		fmt.Fprint(w, "data: two\n\n")
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, len("data: one\n\n"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "data: one\n\n" {
+		t.Fatalf("first event = %q, %v; want it before the handler returns", first, err)
+	}
+	close(next)
+	if rest, err := io.ReadAll(resp.Body); err != nil || string(rest) != "data: two\n\n" {
+		t.Fatalf("then %q, %v", rest, err)
+	}
+	server.Close() // waits for the handler, and so the log
+	if want := `< GET / 200 22B text/event-stream data: one\n\ndata: two`; !strings.Contains(buf.String(), want) {
+		t.Errorf("logged %q, want it to contain %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,320 @@
+package httpmw
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logging writes one line per request to logger, or to the standard
+// logger if it is nil:
+//
+//	GET /users/2 200 57B 153µs req=4f9c2b7e01d3a8f6
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			line := r.Method + " " + r.URL.RequestURI() + " " + strconv.Itoa(rec.status) + " " +
+				strconv.Itoa(rec.bytes) + "B " + time.Since(start).String()
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				line += " req=" + id
+			}
+			logger.Println(line)
+		})
+	}
+}
+
+// CORSOptions says which cross-origin requests browsers may make. The
+// zero value allows any origin to use the usual REST methods.
+type CORSOptions struct {
+	// AllowedOrigins are origins like "https://example.com", or "*" for
+	// any. Empty means "*".
+	AllowedOrigins []string
+	// AllowedMethods default to GET, POST, PUT, PATCH, DELETE and OPTIONS
+	AllowedMethods []string
+	// AllowedHeaders default to Content-Type and Authorization
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache a preflight answer
+	MaxAge time.Duration
+}
+
+// CORS adds Cross-Origin Resource Sharing headers, and answers preflight
+// OPTIONS requests itself without calling the handler
+func CORS(opts CORSOptions) Middleware {
+	origins := opts.AllowedOrigins
+	if len(origins) == 0 {
+		origins = []string{"*"}
+	}
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	if methods == "" {
+		methods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	}
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	if headers == "" {
+		headers = "Content-Type, Authorization"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if origin := allowedOrigin(origins, r.Header.Get("Origin")); origin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				if origin != "*" {
+					// The answer depends on who asked, so caches must not
+					// share it between origins
+					w.Header().Add("Vary", "Origin")
+				}
+				if opts.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+				}
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowedOrigin is the Access-Control-Allow-Origin value for origin, or ""
+// if it isn't allowed
+func allowedOrigin(allowed []string, origin string) string {
+	for _, a := range allowed {
+		if a == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(a, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Recover turns a panic in a handler into a 500 response and logs it with
+// its stack trace, instead of net/http dropping the connection. The
+// logger may be nil for the standard logger.
+func Recover(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				// ErrAbortHandler is net/http's way of aborting a response
+				// on purpose; let it through
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logger.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+				if rec.wroteHeader {
+					// Too late for a 500; cut the connection so the client
+					// can tell the response is incomplete
+					panic(http.ErrAbortHandler)
+				}
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID: the one in its X-Request-ID header
+// if it has a reasonable one, so a proxy's ID is kept, or a new random
+// one. The ID is echoed in the response header and available to handlers
+// through RequestIDFromContext.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFromContext returns the ID RequestID assigned, or "" outside it
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts short IDs of letters, digits, - and _, so a
+// client can't put anything odd into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms; an ID is
+		// still better than none
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Gzip compresses responses for clients that send Accept-Encoding: gzip,
+// at a level from compress/gzip such as gzip.DefaultCompression. Responses
+// the handler already encoded, and ones with no body, are left alone.
+func Gzip(level int) Middleware {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		panic("httpmw: " + err.Error())
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipWriter{responseRecorder: newResponseRecorder(w), level: level}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header lists gzip
+// without q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipWriter decides whether to compress when the handler sends its
+// header, then compresses every Write
+type gzipWriter struct {
+	*responseRecorder
+	level    int
+	decided  bool
+	compress *gzip.Writer
+}
+
+func (gw *gzipWriter) WriteHeader(status int) {
+	if !gw.decided {
+		gw.decided = true
+		h := gw.Header()
+		bodyless := status < 200 || status == http.StatusNoContent || status == http.StatusNotModified
+		if h.Get("Content-Encoding") == "" && !bodyless {
+			// Gzip already checked the level, so this can't fail
+			if compress, err := gzip.NewWriterLevel(gw.responseRecorder, gw.level); err == nil {
+				h.Set("Content-Encoding", "gzip")
+				h.Del("Content-Length") // it was the uncompressed length
+				gw.compress = compress
+			}
+		}
+	}
+	gw.responseRecorder.WriteHeader(status)
+}
+
+func (gw *gzipWriter) Write(p []byte) (int, error) {
+	if !gw.decided {
+		if gw.Header().Get("Content-Type") == "" {
+			// Sniff from the uncompressed bytes, as net/http would have
+			gw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.compress == nil {
+		return gw.responseRecorder.Write(p)
+	}
+	return gw.compress.Write(p)
+}
+
+// Flush sends what has been compressed so far, for streaming responses
+func (gw *gzipWriter) Flush() {
+	if gw.compress != nil {
+		if err := gw.compress.Flush(); err != nil {
+			return // the client has gone; the handler's next Write will say so
+		}
+	}
+	gw.responseRecorder.Flush()
+}
+
+// close writes the end of the gzip stream. If that fails the client has
+// gone, and aborting makes sure no proxy mistakes the truncated stream
+// for a whole response.
+func (gw *gzipWriter) close() {
+	if gw.compress == nil {
+		return
+	}
+	if err := gw.compress.Close(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// BasicAuth lets through only requests with the username and password in
+// an HTTP Basic Authorization header. Anything else gets a 401 with a
+// WWW-Authenticate challenge naming realm, which makes a browser ask for
+// them; it then sends them with every request to the server until it's
+// closed, since Basic auth has no logging out.
+//
+// Both are compared in constant time, on SHA-256 hashes so their lengths
+// don't show either, and both always are: how long a wrong guess takes
+// says nothing about which part was wrong or how close it came. The
+// password goes over the network barely encoded, so use it with TLS.
+func BasicAuth(realm, username, password string) Middleware {
+	wantUser := sha256.Sum256([]byte(username))
+	wantPass := sha256.Sum256([]byte(password))
+	challenge := `Basic realm=` + strconv.Quote(realm) + `, charset="UTF-8"`
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			gotUser := sha256.Sum256([]byte(user))
+			gotPass := sha256.Sum256([]byte(pass))
+			userOK := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+			passOK := subtle.ConstantTimeCompare(gotPass[:], wantPass[:])
+			if !ok || userOK&passOK != 1 {
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
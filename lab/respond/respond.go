@@ -0,0 +1,44 @@
+// Package respond writes the JSON answers of the server lessons' APIs.
+// Lesson 09 uses it for its JSON routes and lesson 10 for all of its
+// own, so a response is encoded the same way everywhere:
+//
+//	respond.JSON(w, http.StatusCreated, user)
+//	respond.Error(w, http.StatusNotFound, "User not found") // {"error":"User not found"}
+//
+// Encoding with encoding/json, rather than writing the JSON by hand with
+// fmt, escapes what needs escaping: a name with a quote in it still
+// makes valid JSON.
+package respond
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"golang-lab/lab/domain"
+)
+
+// JSON sends data as JSON with statusCode. The status is written before
+// the body, so an encoding error can't change it; it's logged instead.
+func JSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+// Error sends message as a domain.ErrorResponse with statusCode
+func Error(w http.ResponseWriter, statusCode int, message string) {
+	JSON(w, statusCode, domain.ErrorResponse{Error: message})
+}
+
+// ValidationErrors sends a 400 listing what failed validation, as a
+// domain.ErrorResponse with details
+func ValidationErrors(w http.ResponseWriter, errors []domain.ValidationError) {
+	JSON(w, http.StatusBadRequest, domain.ErrorResponse{
+		Error:   "Validation failed",
+		Details: errors,
+	})
+}
@@ -0,0 +1,40 @@
+package respond
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang-lab/lab/domain"
+)
+
+func TestJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JSON(rec, http.StatusCreated, map[string]string{"name": `Bobby "Tables"`})
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if want := `{"name":"Bobby \"Tables\""}` + "\n"; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Error(rec, http.StatusNotFound, "User not found")
+	if rec.Code != http.StatusNotFound || rec.Body.String() != `{"error":"User not found"}`+"\n" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ValidationErrors(rec, []domain.ValidationError{{Field: "email", Message: "Email is required"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if want := `{"error":"Validation failed","details":[{"field":"email","message":"Email is required"}]}` + "\n"; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+}
@@ -0,0 +1,122 @@
+// Package smoke runs a server lesson end to end without a human: it serves
+// the lesson's handler on a free local port, sends it a fixed list of
+// requests over real HTTP, and reports which got the expected status.
+// Lessons use it for their -ci flag:
+//
+//	if *ci {
+//		if err := smoke.Run(os.Stdout, handler, smokeSteps); err != nil {
+//			log.Fatal(err)
+//		}
+//		return
+//	}
+package smoke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Step is one request and the status it should get back
+type Step struct {
+	Method string
+	Path   string
+	// Body is sent as is; ContentType says what it is
+	Body        string
+	ContentType string
+	// Header holds any other request headers, such as Authorization
+	Header map[string]string
+	// Want is the status the request itself should get. Redirects aren't
+	// followed, so a form post that redirects wants its 303.
+	Want int
+}
+
+// requestTimeout bounds each request, so a hung handler fails the run
+// instead of blocking it
+const requestTimeout = 10 * time.Second
+
+// Run serves handler on a free port on 127.0.0.1, sends it steps in
+// order, and writes one PASS or FAIL line per step to w. It returns an
+// error if any step failed or the server couldn't start.
+func Run(w io.Writer, handler http.Handler, steps []Step) error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("smoke: %w", err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: requestTimeout}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ln) }()
+
+	base := "http://" + ln.Addr().String()
+	fmt.Fprintf(w, "Smoke testing %s\n", base)
+	client := &http.Client{
+		Timeout:       requestTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	failed := 0
+	for _, step := range steps {
+		status, body, err := send(client, base, step)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "  FAIL  %s %s: %v\n", step.Method, step.Path, err)
+		case status != step.Want:
+			failed++
+			fmt.Fprintf(w, "  FAIL  %s %s -> %d, want %d: %s\n", step.Method, step.Path, status, step.Want, summarize(body))
+		default:
+			fmt.Fprintf(w, "  PASS  %s %s -> %d\n", step.Method, step.Path, status)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("smoke: stopping server: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("smoke: serving: %w", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("smoke: %d of %d requests failed", failed, len(steps))
+	}
+	fmt.Fprintf(w, "All %d requests passed\n", len(steps))
+	return nil
+}
+
+func send(client *http.Client, base string, step Step) (int, string, error) {
+	req, err := http.NewRequest(step.Method, base+step.Path, strings.NewReader(step.Body))
+	if err != nil {
+		return 0, "", err
+	}
+	if step.ContentType != "" {
+		req.Header.Set("Content-Type", step.ContentType)
+	}
+	for name, value := range step.Header {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", fmt.Errorf("reading response: %w", err)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// summarize shortens a response body to one line for a FAIL message
+func summarize(body string) string {
+	body = strings.Join(strings.Fields(body), " ")
+	if len(body) > 80 {
+		body = body[:77] + "..."
+	}
+	return body
+}
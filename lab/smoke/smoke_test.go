@@ -0,0 +1,79 @@
+package smoke
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/echo" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Type"), body)
+})
+
+func TestRunPasses(t *testing.T) {
+	var out bytes.Buffer
+	err := Run(&out, echo, []Step{
+		{Method: "POST", Path: "/echo", Body: "hi", ContentType: "text/plain", Want: 200},
+		{Method: "GET", Path: "/missing", Want: 404},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v\n%s", err, out.String())
+	}
+	want := regexp.MustCompile(`^Smoke testing http://127\.0\.0\.1:\d+
+  PASS  POST /echo -> 200
+  PASS  GET /missing -> 404
+All 2 requests passed
+$`)
+	if !want.MatchString(out.String()) {
+		t.Errorf("output:\n%s\nwant it to match:\n%s", out.String(), want)
+	}
+}
+
+func TestRunFails(t *testing.T) {
+	var out bytes.Buffer
+	err := Run(&out, echo, []Step{
+		{Method: "GET", Path: "/echo", Want: 200},
+		{Method: "GET", Path: "/missing", Want: 200},
+	})
+	if err == nil || err.Error() != "smoke: 1 of 2 requests failed" {
+		t.Errorf("Run = %v, want 1 of 2 failed", err)
+	}
+	if !strings.Contains(out.String(), "  FAIL  GET /missing -> 404, want 200: 404 page not found\n") {
+		t.Errorf("output:\n%s\nwant a FAIL line with the status and body", out.String())
+	}
+}
+
+func TestRunSendsHeaders(t *testing.T) {
+	authorized := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	err := Run(io.Discard, authorized, []Step{
+		{Method: "GET", Path: "/", Want: 401},
+		{Method: "GET", Path: "/", Header: map[string]string{"Authorization": "Bearer t0ken"}, Want: 200},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunDoesNotFollowRedirects(t *testing.T) {
+	redirect := http.RedirectHandler("/echo", http.StatusSeeOther)
+	if err := Run(io.Discard, redirect, []Step{{Method: "POST", Path: "/form", Want: http.StatusSeeOther}}); err != nil {
+		t.Errorf("Run = %v, want the 303 itself", err)
+	}
+}
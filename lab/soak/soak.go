@@ -0,0 +1,254 @@
+// Package soak stress-tests concurrent code for longer than a unit test
+// would. Many goroutines call the code under test at random, and every so
+// often the harness pauses them all and checks invariants that must hold
+// when nothing is running: every message published was delivered or
+// counted as dropped, a counter matches what was added to it. Bugs that
+// show up once in a million schedules need a lot of schedules, and the
+// race detector catches what the invariants don't.
+//
+// Soak tests are named TestSoak... and live in files tagged soak, so go
+// test ./... leaves them out:
+//
+//	//go:build soak
+//
+//	func TestSoakBroker(t *testing.T) {
+//		soak.Run(t, soak.MustConfig(t), soak.Target{
+//			Workers: 8,
+//			Step:    func(worker int, rng *rand.Rand) { ... },
+//			Check:   func() error { ... },
+//		})
+//	}
+//
+// golab soak finds and runs them with the race detector.
+package soak
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The environment variables golab soak passes its flags in
+const (
+	DurationEnv   = "GOLAB_SOAK_DURATION"
+	SeedEnv       = "GOLAB_SOAK_SEED"
+	ProfileDirEnv = "GOLAB_SOAK_PROFILES"
+)
+
+// Config says how long and how hard to soak
+type Config struct {
+	// Duration is how long the steps run, in total
+	Duration time.Duration
+	// CheckEvery is how long the steps run between checks
+	CheckEvery time.Duration
+	// Settle is how long a check may keep failing before it counts, for
+	// work that's still finishing when the steps pause, such as messages
+	// in a channel buffer
+	Settle time.Duration
+	// StepTimeout is how long the steps get to stop for a check; one that
+	// takes longer is taken to be deadlocked
+	StepTimeout time.Duration
+	// Seed seeds every worker's random choices. The same seed makes the
+	// same choices, but the scheduler still runs them in its own order,
+	// so a failure may take a few runs to repeat.
+	Seed int64
+	// ProfileDir is where goroutine profiles are written on failure
+	ProfileDir string
+}
+
+// DefaultConfig is a short soak, long enough to be worth running
+func DefaultConfig() Config {
+	return Config{
+		Duration:    10 * time.Second,
+		CheckEvery:  250 * time.Millisecond,
+		Settle:      5 * time.Second,
+		StepTimeout: 10 * time.Second,
+		Seed:        time.Now().UnixNano(),
+		ProfileDir:  os.TempDir(),
+	}
+}
+
+// ConfigFromEnv is DefaultConfig with what golab soak set in the
+// environment
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if s := os.Getenv(DurationEnv); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("%s=%q: want a positive duration such as 1m", DurationEnv, s)
+		}
+		cfg.Duration = d
+	}
+	if s := os.Getenv(SeedEnv); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("%s=%q: want an integer", SeedEnv, s)
+		}
+		cfg.Seed = seed
+	}
+	if dir := os.Getenv(ProfileDirEnv); dir != "" {
+		cfg.ProfileDir = dir
+	}
+	return cfg, nil
+}
+
+// MustConfig is ConfigFromEnv for a test, which fails if the environment
+// is wrong
+func MustConfig(t testing.TB) Config {
+	t.Helper()
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// Target is the code under test, as the harness sees it
+type Target struct {
+	// Workers is how many goroutines call Step
+	Workers int
+	// Step makes one random call, or a few, to the code under test. Each
+	// worker has its own rng.
+	Step func(worker int, rng *rand.Rand)
+	// Check returns an error if an invariant doesn't hold. It runs while
+	// no Step is running, and again until it passes or Settle is up.
+	Check func() error
+	// Reshuffle, if set, runs after each passing check, still with the
+	// steps paused, to change what they run against: add or remove a
+	// subscriber, resize a pool
+	Reshuffle func(rng *rand.Rand)
+}
+
+// Run soaks target for cfg.Duration, checking it every cfg.CheckEvery
+// and once more at the end. If a check fails or the steps deadlock, it
+// writes every goroutine's stack to a file in cfg.ProfileDir and fails
+// the test.
+func Run(t testing.TB, cfg Config, target Target) {
+	t.Helper()
+	t.Logf("seed %d (repeat with %s=%d)", cfg.Seed, SeedEnv, cfg.Seed)
+
+	// Steps hold pause for reading; a check takes it for writing, so it
+	// waits for the steps in progress and stops new ones starting
+	var pause sync.RWMutex
+	var stop atomic.Bool
+	var steps atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < max(target.Workers, 1); i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(cfg.Seed + int64(worker)))
+			for !stop.Load() {
+				pause.RLock()
+				target.Step(worker, rng)
+				pause.RUnlock()
+				steps.Add(1)
+			}
+		}(i)
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed - 1))
+	deadline := time.Now().Add(cfg.Duration)
+	checks := 0
+	for time.Now().Before(deadline) {
+		time.Sleep(min(cfg.CheckEvery, time.Until(deadline)))
+		if !waitFor(pause.Lock, cfg.StepTimeout) {
+			fail(t, cfg, "the steps didn't stop for a check within %v: deadlocked?", cfg.StepTimeout)
+		}
+		if err := settle(target.Check, cfg.Settle); err != nil {
+			fail(t, cfg, "check %d failed after %d steps: %v", checks+1, steps.Load(), err)
+		}
+		checks++
+		if target.Reshuffle != nil {
+			target.Reshuffle(rng)
+		}
+		pause.Unlock()
+	}
+
+	stop.Store(true)
+	if !waitFor(wg.Wait, cfg.StepTimeout) {
+		fail(t, cfg, "the workers didn't stop within %v: deadlocked?", cfg.StepTimeout)
+	}
+	if err := settle(target.Check, cfg.Settle); err != nil {
+		fail(t, cfg, "the final check failed after %d steps: %v", steps.Load(), err)
+	}
+	t.Logf("%d steps by %d workers in %v; all %d checks passed", steps.Load(), max(target.Workers, 1), cfg.Duration, checks+1)
+}
+
+// settle calls check until it passes or d is up, and returns its last
+// error
+func settle(check func() error, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		err := check()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitFor reports whether f returned within d. If it didn't, f is left
+// running: there's no stopping a goroutine stuck on a lock.
+func waitFor(f func(), d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// fail dumps the goroutines and fails the test
+func fail(t testing.TB, cfg Config, format string, args ...interface{}) {
+	t.Helper()
+	if path, err := DumpGoroutines(cfg.ProfileDir, t.Name()); err != nil {
+		t.Logf("couldn't save the goroutine profile: %v", err)
+	} else {
+		t.Logf("goroutine profile: %s", path)
+	}
+	t.Fatalf(format, args...)
+}
+
+// DumpGoroutines writes the stack of every goroutine to a new file in
+// dir, named after name, and returns its path. A stack stuck in a lock or
+// a channel operation is usually where a deadlock is.
+func DumpGoroutines(dir, name string) (string, error) {
+	name = strings.NewReplacer("/", "_", " ", "_").Replace(name)
+	f, err := os.CreateTemp(dir, "soak-"+name+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	err = pprof.Lookup("goroutine").WriteTo(f, 2)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return filepath.Clean(f.Name()), err
+}
+
+// Jitter perturbs the schedule at random: it yields to another
+// goroutine, sleeps a moment, or does nothing. Steps call it between
+// operations so that goroutines interleave in more ways than they would
+// running flat out.
+func Jitter(rng *rand.Rand) {
+	switch rng.Intn(8) {
+	case 0:
+		runtime.Gosched()
+	case 1:
+		time.Sleep(time.Duration(rng.Intn(100)) * time.Microsecond)
+	}
+}
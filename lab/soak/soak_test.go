@@ -0,0 +1,148 @@
+package soak
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a testing.TB that keeps what Run logs and how it failed,
+// so the failures can be tested
+type recorder struct {
+	testing.TB
+	logs   []string
+	failed string
+}
+
+func (r *recorder) Helper()      {}
+func (r *recorder) Name() string { return "TestSoakFake/sub" }
+
+func (r *recorder) Logf(format string, args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failed = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// run calls Run with a recorder, in a goroutine of its own so a failure
+// can Goexit
+func run(cfg Config, target Target) *recorder {
+	r := &recorder{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(r, cfg, target)
+	}()
+	<-done
+	return r
+}
+
+func quickConfig(t *testing.T) Config {
+	return Config{
+		Duration:    200 * time.Millisecond,
+		CheckEvery:  20 * time.Millisecond,
+		Settle:      50 * time.Millisecond,
+		StepTimeout: 200 * time.Millisecond,
+		Seed:        1,
+		ProfileDir:  t.TempDir(),
+	}
+}
+
+func TestRunPasses(t *testing.T) {
+	var mu sync.Mutex
+	total := 0
+	perWorker := make([]int, 4)
+	reshuffles := 0
+	r := run(quickConfig(t), Target{
+		Workers: 4,
+		Step: func(worker int, rng *rand.Rand) {
+			n := rng.Intn(3)
+			Jitter(rng)
+			mu.Lock()
+			total += n
+			perWorker[worker] += n
+			mu.Unlock()
+		},
+		Check: func() error {
+			sum := 0
+			for _, n := range perWorker {
+				sum += n
+			}
+			if sum != total {
+				return fmt.Errorf("total %d, workers added %d", total, sum)
+			}
+			return nil
+		},
+		Reshuffle: func(*rand.Rand) { reshuffles++ },
+	})
+	if r.failed != "" {
+		t.Fatalf("Run failed: %s", r.failed)
+	}
+	if reshuffles == 0 || total == 0 {
+		t.Errorf("%d reshuffles and a total of %d; want both above 0", reshuffles, total)
+	}
+	if last := r.logs[len(r.logs)-1]; !strings.Contains(last, "checks passed") {
+		t.Errorf("last log = %q", last)
+	}
+}
+
+func TestRunFailedCheck(t *testing.T) {
+	cfg := quickConfig(t)
+	r := run(cfg, Target{
+		Step:  func(int, *rand.Rand) {},
+		Check: func() error { return errors.New("lost a message") },
+	})
+	if !strings.Contains(r.failed, "check 1 failed") || !strings.Contains(r.failed, "lost a message") {
+		t.Errorf("failed with %q", r.failed)
+	}
+
+	// The goroutine profile is in ProfileDir, named after the test
+	entries, err := os.ReadDir(cfg.ProfileDir)
+	if err != nil || len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "soak-TestSoakFake_sub-") {
+		t.Fatalf("profile dir has %v, %v", entries, err)
+	}
+	profile, err := os.ReadFile(cfg.ProfileDir + "/" + entries[0].Name())
+	if err != nil || !strings.Contains(string(profile), "goroutine ") {
+		t.Errorf("profile doesn't list goroutines: %v\n%.200s", err, profile)
+	}
+}
+
+func TestRunDeadlock(t *testing.T) {
+	// The stuck worker, and the check waiting for it, are left behind
+	// when the test ends; that's what a deadlock does
+	stuck := make(chan struct{})
+	r := run(quickConfig(t), Target{
+		Step:  func(int, *rand.Rand) { <-stuck },
+		Check: func() error { return nil },
+	})
+	if !strings.Contains(r.failed, "deadlocked?") {
+		t.Errorf("failed with %q, want a deadlock", r.failed)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(DurationEnv, "90s")
+	t.Setenv(SeedEnv, "42")
+	t.Setenv(ProfileDirEnv, "/tmp/profiles")
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Duration != 90*time.Second || cfg.Seed != 42 || cfg.ProfileDir != "/tmp/profiles" {
+		t.Errorf("ConfigFromEnv = %+v, %v", cfg, err)
+	}
+
+	for env, value := range map[string]string{DurationEnv: "-1m", SeedEnv: "soon"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("%s=%s: error %v", env, value, err)
+			}
+		})
+	}
+}
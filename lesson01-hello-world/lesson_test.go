@@ -0,0 +1,52 @@
+package lesson01
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo)
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantOut    string // the start of what's printed to stdout
+		wantErr    string // part of what's printed to stderr
+	}{
+		{"no arguments", nil, "", 0, "Hello, World!\n", ""},
+		{"names", []string{"Alice", "Bob"}, "", 0, "Hello, Alice!\nHello, Bob!\n", ""},
+		{"name flag", []string{"-name", "Gopher"}, "", 0, "Hello, Gopher!\n", ""},
+		{"flag and name", []string{"-name=Ann", "Bo"}, "", 0, "Hello, Ann!\nHello, Bo!\n", ""},
+		{"echo", []string{"-echo"}, "first\nsecond\n", 0, "   1  first\n   2  second\n", ""},
+		{"echo without a final newline", []string{"-echo"}, "only", 0, "   1  only\n", ""},
+		{"echo nothing", []string{"-echo"}, "", 0, "", ""},
+		{"help", []string{"-h"}, "", 0, "", "Usage of lesson01"},
+		{"unknown flag", []string{"-loud"}, "", 2, "", "flag provided but not defined: -loud"},
+		{"echo with a name", []string{"-echo", "Alice"}, "", 2, "", "-echo doesn't take names"},
+		{"line too long", []string{"-echo"}, strings.Repeat("x", 70000), 1, "", "token too long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if status != tt.wantStatus {
+				t.Errorf("exit status %d, want %d (stderr: %q)", status, tt.wantStatus, stderr.String())
+			}
+			if !strings.HasPrefix(stdout.String(), tt.wantOut) || (tt.wantOut == "" && stdout.Len() > 0) {
+				t.Errorf("stdout = %q, want it to start with %q", stdout.String(), tt.wantOut)
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) || (tt.wantErr == "" && stderr.Len() > 0) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,25 +1,94 @@
 // Lesson 01: Hello World and Basic Syntax
 // This lesson covers the fundamental structure of a Go program
 
-package main
+package lesson01
 
-import "fmt"
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
 
 // main is the entry point of every Go program
-func main() {
+// Run is the lesson's entry point; cmd/lesson01 calls it
+func Run() {
+	// A program reports success or failure with its exit status: 0 means
+	// it worked, anything else that it didn't
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is the whole program, with its arguments, input and output passed
+// in instead of taken from os, so tests can call it. It returns the exit
+// status: 0 for success, 1 when something went wrong, and 2 when the
+// command line itself was wrong, as the flag package does.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lesson01", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("name", "", "who to greet")
+	echo := flags.Bool("echo", false, "echo standard input back with line numbers")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0 // -h asked for the usage, which isn't a failure
+		}
+		return 2 // the flag package has already said what was wrong
+	}
+
+	// Whatever is left after the flags are positional arguments
+	names := flags.Args()
+	if *name != "" {
+		names = append([]string{*name}, names...)
+	}
+
+	switch {
+	case *echo && len(names) > 0:
+		fmt.Fprintln(stderr, "lesson01: -echo doesn't take names")
+		return 2
+	case *echo:
+		if err := echoLines(stdin, stdout); err != nil {
+			fmt.Fprintf(stderr, "lesson01: reading input: %v\n", err)
+			return 1
+		}
+	case len(names) > 0:
+		for _, n := range names {
+			fmt.Fprintf(stdout, "Hello, %s!\n", n)
+		}
+	default:
+		Demo(stdout)
+	}
+	return 0
+}
+
+// echoLines copies r to w a line at a time, numbering each line
+func echoLines(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		fmt.Fprintf(w, "%4d  %s\n", n, scanner.Text())
+	}
+	// Scan returns false at the end of the input and on an error;
+	// Err tells them apart, and is nil at the end
+	return scanner.Err()
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
 	// Simple hello world
-	fmt.Println("Hello, World!")
+	fmt.Fprintln(w, "Hello, World!")
 	
 	// Different ways to print
-	fmt.Print("Hello ")
-	fmt.Print("from ")
-	fmt.Println("Go!")
+	fmt.Fprint(w, "Hello ")
+	fmt.Fprint(w, "from ")
+	fmt.Fprintln(w, "Go!")
 	
 	// Printf for formatted output
-	fmt.Printf("Hello %s!\n", "Gopher")
+	fmt.Fprintf(w, "Hello %s!\n", "Gopher")
 	
 	// Variables in action
 	name := "Golang"
 	year := 2009
-	fmt.Printf("%s was first released in %d\n", name, year)
-}
\ No newline at end of file
+	fmt.Fprintf(w, "%s was first released in %d\n", name, year)
+}
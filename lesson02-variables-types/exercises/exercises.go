@@ -0,0 +1,44 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 02 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson02
+package exercises
+
+// Kilometers and Miles are distances; Celsius and Kelvin are temperatures.
+// Each is its own type, so the compiler won't let them be mixed up.
+type (
+	Kilometers float64
+	Miles      float64
+	Celsius    float64
+	Kelvin     float64
+)
+
+// KilometersPerMile is how many kilometers make a mile
+const KilometersPerMile = 1.609344
+
+// Exercise 1: ToMiles converts k to miles
+func (k Kilometers) ToMiles() Miles {
+	// TODO: divide by KilometersPerMile, then convert to Miles
+	return 0
+}
+
+// Exercise 2: ToKilometers converts m to kilometers
+func (m Miles) ToKilometers() Kilometers {
+	// TODO: the opposite of ToMiles
+	return 0
+}
+
+// Exercise 3: ToKelvin converts c to kelvin: 0°C is 273.15K
+func (c Celsius) ToKelvin() Kelvin {
+	// TODO: add 273.15
+	return 0
+}
+
+// Exercise 4: TotalDistance adds up a run logged partly in kilometers and
+// partly in miles, and returns the total in kilometers
+func TotalDistance(km []Kilometers, mi []Miles) Kilometers {
+	// TODO: Kilometers and Miles can't be added directly; convert first
+	return 0
+}
@@ -0,0 +1,70 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-6
+}
+
+func TestToMiles(t *testing.T) {
+	tests := []struct {
+		km   Kilometers
+		want Miles
+	}{
+		{0, 0},
+		{1.609344, 1},
+		{42.195, 26.218757},
+	}
+	for _, tt := range tests {
+		if got := tt.km.ToMiles(); !near(float64(got), float64(tt.want)) {
+			t.Errorf("Kilometers(%v).ToMiles() = %v; want %v", tt.km, got, tt.want)
+		}
+	}
+}
+
+func TestToKilometers(t *testing.T) {
+	tests := []struct {
+		mi   Miles
+		want Kilometers
+	}{
+		{0, 0},
+		{1, 1.609344},
+		{26.2, 42.164813},
+	}
+	for _, tt := range tests {
+		if got := tt.mi.ToKilometers(); !near(float64(got), float64(tt.want)) {
+			t.Errorf("Miles(%v).ToKilometers() = %v; want %v", tt.mi, got, tt.want)
+		}
+	}
+}
+
+func TestToKelvin(t *testing.T) {
+	tests := []struct {
+		c    Celsius
+		want Kelvin
+	}{
+		{0, 273.15},
+		{-273.15, 0},
+		{100, 373.15},
+	}
+	for _, tt := range tests {
+		if got := tt.c.ToKelvin(); !near(float64(got), float64(tt.want)) {
+			t.Errorf("Celsius(%v).ToKelvin() = %v; want %v", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestTotalDistance(t *testing.T) {
+	got := TotalDistance([]Kilometers{5, 10}, []Miles{1, 2})
+	if want := 15 + 3*KilometersPerMile; !near(float64(got), want) {
+		t.Errorf("TotalDistance([5 10], [1 2]) = %v; want %v", got, want)
+	}
+	if got := TotalDistance(nil, nil); got != 0 {
+		t.Errorf("TotalDistance(nil, nil) = %v; want 0", got)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build solution
+
+// Reference solutions for the Lesson 02 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+type (
+	Kilometers float64
+	Miles      float64
+	Celsius    float64
+	Kelvin     float64
+)
+
+const KilometersPerMile = 1.609344
+
+func (k Kilometers) ToMiles() Miles {
+	return Miles(k / KilometersPerMile)
+}
+
+func (m Miles) ToKilometers() Kilometers {
+	return Kilometers(m * KilometersPerMile)
+}
+
+func (c Celsius) ToKelvin() Kelvin {
+	return Kelvin(c + 273.15)
+}
+
+func TotalDistance(km []Kilometers, mi []Miles) Kilometers {
+	var total Kilometers
+	for _, k := range km {
+		total += k
+	}
+	for _, m := range mi {
+		total += m.ToKilometers()
+	}
+	return total
+}
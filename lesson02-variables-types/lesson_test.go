@@ -0,0 +1,80 @@
+package lesson02
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo)
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"Meters(1).ToFeet()", float64(Meters(1).ToFeet()), 3.28084},
+		{"Feet(3.28084).ToMeters()", float64(Feet(3.28084).ToMeters()), 1},
+		{"Freezing.ToFahrenheit()", float64(Freezing.ToFahrenheit()), 32},
+		{"Boiling.ToFahrenheit()", float64(Boiling.ToFahrenheit()), 212},
+		{"Fahrenheit(-40).ToCelsius()", float64(Fahrenheit(-40).ToCelsius()), -40},
+		{"round trip", float64(Celsius(37).ToFahrenheit().ToCelsius()), 37},
+	}
+	for _, tt := range tests {
+		if math.Abs(tt.got-tt.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// TestUnitsDontMix type-checks code that mixes up the defined types in
+// units.go, to show the compiler really does reject it
+func TestUnitsDontMix(t *testing.T) {
+	if testing.Short() {
+		t.Skip("type-checks the standard library from source")
+	}
+	fset := token.NewFileSet()
+	units, err := parser.ParseFile(fset, "units.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+
+	tests := []struct {
+		code string
+		want string // part of the compiler's error, or "" if it compiles
+	}{
+		{"lookupUser(OrderID(7))", "as UserID value"},
+		{"clearance(Feet(13.5), Meters(4))", "as Meters value"},
+		{"_ = Meters(1) + Feet(1)", "mismatched types Meters and Feet"},
+		{"var c Celsius = Fahrenheit(451)", "as Celsius value"},
+		{"lookupUser(7)", ""},
+		{"clearance(Feet(13.5).ToMeters(), 4)", ""},
+	}
+	for _, tt := range tests {
+		src := "package lesson02\n\nfunc _() {\n\t" + tt.code + "\n}\n"
+		snippet, err := parser.ParseFile(fset, "snippet.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = conf.Check("lesson02", fset, []*ast.File{units, snippet}, nil)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: want it to compile, got %v", tt.code, err)
+		case tt.want != "" && err == nil:
+			t.Errorf("%s: compiled, want an error", tt.code)
+		case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+			t.Errorf("%s: error %q doesn't mention %q", tt.code, err, tt.want)
+		}
+	}
+}
@@ -1,12 +1,22 @@
 // Lesson 02: Variables, Constants, and Data Types
 // This lesson covers Go's type system and variable declarations
 
-package main
+package lesson02
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
-func main() {
-	fmt.Println("=== Lesson 02: Variables, Constants, and Data Types ===")
+// Run is the lesson's entry point; cmd/lesson02 calls it
+func Run() {
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 02: Variables, Constants, and Data Types ===")
 	
 	// Variable declarations
 	var name string = "Alice"
@@ -38,25 +48,28 @@ func main() {
 	)
 	
 	// Display values
-	fmt.Printf("Name: %s, Age: %d, Student: %t\n", name, age, isStudent)
-	fmt.Printf("Height: %.1f, City: %s\n", height, city)
-	fmt.Printf("Coordinates: (%d, %d, %d)\n", x, y, z)
-	fmt.Printf("Message: %s %s\n", a, b)
+	fmt.Fprintf(w, "Name: %s, Age: %d, Student: %t\n", name, age, isStudent)
+	fmt.Fprintf(w, "Height: %.1f, City: %s\n", height, city)
+	fmt.Fprintf(w, "Coordinates: (%d, %d, %d)\n", x, y, z)
+	fmt.Fprintf(w, "Message: %s %s\n", a, b)
 	
 	// Zero values
-	fmt.Printf("Default int: %d, string: '%s', bool: %t\n", defaultInt, defaultString, defaultBool)
+	fmt.Fprintf(w, "Default int: %d, string: '%s', bool: %t\n", defaultInt, defaultString, defaultBool)
 	
 	// Constants
-	fmt.Printf("Pi: %f\n", pi)
-	fmt.Printf("%s\n", greeting)
-	fmt.Printf("HTTP Status Codes: OK=%d, NotFound=%d, Error=%d\n", statusOK, statusNotFound, statusError)
+	fmt.Fprintf(w, "Pi: %f\n", pi)
+	fmt.Fprintf(w, "%s\n", greeting)
+	fmt.Fprintf(w, "HTTP Status Codes: OK=%d, NotFound=%d, Error=%d\n", statusOK, statusNotFound, statusError)
 	
 	// Data types demonstration
-	demonstrateTypes()
+	demonstrateTypes(w)
+	
+	// Types of your own, built on the basic ones
+	demonstrateDefinedTypes(w)
 }
 
-func demonstrateTypes() {
-	fmt.Println("\n=== Data Types Demo ===")
+func demonstrateTypes(w io.Writer) {
+	fmt.Fprintln(w, "\n=== Data Types Demo ===")
 	
 	// Integer types
 	var int8Val int8 = 127
@@ -79,10 +92,10 @@ func demonstrateTypes() {
 	// Byte type (alias for uint8)
 	var byteVal byte = 65 // ASCII value for 'A'
 	
-	fmt.Printf("Integer types: int8=%d, int16=%d, int32=%d, int64=%d\n", int8Val, int16Val, int32Val, int64Val)
-	fmt.Printf("Unsigned types: uint8=%d, uint16=%d\n", uint8Val, uint16Val)
-	fmt.Printf("Float types: float32=%f, float64=%f\n", float32Val, float64Val)
-	fmt.Printf("String: %s\n", str)
-	fmt.Printf("Rune (Unicode): %c (%d)\n", char, char)
-	fmt.Printf("Byte: %c (%d)\n", byteVal, byteVal)
+	fmt.Fprintf(w, "Integer types: int8=%d, int16=%d, int32=%d, int64=%d\n", int8Val, int16Val, int32Val, int64Val)
+	fmt.Fprintf(w, "Unsigned types: uint8=%d, uint16=%d\n", uint8Val, uint16Val)
+	fmt.Fprintf(w, "Float types: float32=%f, float64=%f\n", float32Val, float64Val)
+	fmt.Fprintf(w, "String: %s\n", str)
+	fmt.Fprintf(w, "Rune (Unicode): %c (%d)\n", char, char)
+	fmt.Fprintf(w, "Byte: %c (%d)\n", byteVal, byteVal)
 }
\ No newline at end of file
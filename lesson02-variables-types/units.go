@@ -0,0 +1,104 @@
+package lesson02
+
+import (
+	"fmt"
+	"io"
+)
+
+// Defined types: each of these has float64 or int64 underneath, but is a
+// type of its own. Go never converts between them implicitly, so mixing
+// up two IDs or two units is a compile error instead of a bug.
+
+// UserID and OrderID are both numbers, and must never be confused
+type UserID int64
+type OrderID int64
+
+// Meters and Feet are lengths in different units
+type Meters float64
+type Feet float64
+
+// Celsius and Fahrenheit are temperatures in different scales
+type Celsius float64
+type Fahrenheit float64
+
+const feetPerMeter = 3.28084
+
+// Typed constants: AbsoluteZero can only be used as a Celsius
+const (
+	AbsoluteZero Celsius = -273.15
+	Freezing     Celsius = 0
+	Boiling      Celsius = 100
+)
+
+// ToFeet converts m to feet. A method on the type keeps the conversion
+// factor in one place, next to the types it converts between.
+func (m Meters) ToFeet() Feet {
+	return Feet(m * feetPerMeter)
+}
+
+// ToMeters converts f to meters
+func (f Feet) ToMeters() Meters {
+	return Meters(f / feetPerMeter)
+}
+
+// ToFahrenheit converts c to Fahrenheit
+func (c Celsius) ToFahrenheit() Fahrenheit {
+	return Fahrenheit(c*9/5 + 32)
+}
+
+// ToCelsius converts f to Celsius
+func (f Fahrenheit) ToCelsius() Celsius {
+	return Celsius((f - 32) * 5 / 9)
+}
+
+// String methods print the unit with the number
+func (m Meters) String() string     { return fmt.Sprintf("%.2fm", float64(m)) }
+func (f Feet) String() string       { return fmt.Sprintf("%.2fft", float64(f)) }
+func (c Celsius) String() string    { return fmt.Sprintf("%.2f°C", float64(c)) }
+func (f Fahrenheit) String() string { return fmt.Sprintf("%.2f°F", float64(f)) }
+
+// lookupUser only accepts a UserID: passing an OrderID doesn't compile
+func lookupUser(id UserID) string {
+	return fmt.Sprintf("user #%d", id)
+}
+
+// clearance reports whether something height tall fits under a bridge
+// with the given clearance. Both must be Meters, so a height in feet has
+// to be converted first.
+func clearance(height, bridge Meters) bool {
+	return height <= bridge
+}
+
+func demonstrateDefinedTypes(w io.Writer) {
+	fmt.Fprintln(w, "\n=== Defined Types and Units ===")
+
+	user := UserID(42)
+	order := OrderID(42)
+	fmt.Fprintf(w, "Looking up %s\n", lookupUser(user))
+	// lookupUser(order) would not compile:
+	//   cannot use order (variable of type OrderID) as UserID value
+	fmt.Fprintf(w, "Order %d and user %d have the same number, but different types: %T, %T\n", order, user, order, user)
+
+	// Untyped constants fit any type with the right underlying type
+	var height Meters = 4
+	truck := Feet(13.5)
+	fmt.Fprintf(w, "Height %v is %v\n", height, height.ToFeet())
+	fmt.Fprintf(w, "Truck %v is %v\n", truck, truck.ToMeters())
+
+	// clearance(truck, height) would not compile:
+	//   cannot use truck (variable of type Feet) as Meters value
+	fmt.Fprintf(w, "Truck fits under a %v bridge: %t\n", height, clearance(truck.ToMeters(), height))
+
+	// A conversion compiles, but only changes the type, not the number:
+	// that's a bug the compiler can't catch, which is why the conversion
+	// methods exist
+	fmt.Fprintf(w, "Meters(truck) is %v, which is wrong\n", Meters(truck))
+
+	// Arithmetic works within a type, and the result keeps the type
+	fmt.Fprintf(w, "Two trucks end to end: %v\n", truck+truck)
+
+	for _, c := range []Celsius{AbsoluteZero, Freezing, 37, Boiling} {
+		fmt.Fprintf(w, "%v = %v\n", c, c.ToFahrenheit())
+	}
+	fmt.Fprintf(w, "451°F = %v\n", Fahrenheit(451).ToCelsius())
+}
@@ -0,0 +1,167 @@
+package lesson03
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Memoize wraps f so that each argument is computed once: later calls
+// with the same argument return the cached result. K must be comparable
+// to be a map key; for a function of several arguments, make K a struct
+// of them (see Memoized). The cache is a plain map, so the result must
+// only be called from one goroutine at a time; use MemoizeSync otherwise.
+func Memoize[K comparable, V any](f func(K) V) func(K) V {
+	cache := make(map[K]V)
+	return func(key K) V {
+		if v, ok := cache[key]; ok {
+			return v
+		}
+		v := f(key)
+		cache[key] = v
+		return v
+	}
+}
+
+// memoEntry is one MemoizeSync result; once makes sure it's computed by
+// exactly one caller while any others wait for it
+type memoEntry[V any] struct {
+	once  sync.Once
+	value V
+}
+
+// MemoizeSync is Memoize for functions called from many goroutines. The
+// mutex guards only the map; f runs outside it, so a slow key doesn't
+// hold up the others, and each key's sync.Once means f still runs once
+// per key even when goroutines ask for it at the same moment.
+func MemoizeSync[K comparable, V any](f func(K) V) func(K) V {
+	var mu sync.Mutex
+	cache := make(map[K]*memoEntry[V])
+	return func(key K) V {
+		mu.Lock()
+		e, ok := cache[key]
+		if !ok {
+			e = new(memoEntry[V])
+			cache[key] = e
+		}
+		mu.Unlock()
+		e.once.Do(func() { e.value = f(key) })
+		return e.value
+	}
+}
+
+// Operation is the kind of function calculate takes
+type Operation func(a, b int) int
+
+// Decorator wraps an Operation in another with the same signature, which
+// adds something before or after the call: timing, logging, caching.
+// Because the result is still an Operation, decorators stack.
+type Decorator func(Operation) Operation
+
+// Chain wraps op in decorators, the first outermost: Chain(op, a, b) is
+// a(b(op)), so a call goes through a, then b, then op
+func Chain(op Operation, decorators ...Decorator) Operation {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		op = decorators[i](op)
+	}
+	return op
+}
+
+// Timed reports to w how long each call took
+func Timed(w io.Writer, name string) Decorator {
+	return func(op Operation) Operation {
+		return func(a, b int) int {
+			start := time.Now()
+			result := op(a, b)
+			fmt.Fprintf(w, "  %s(%d, %d) took %v\n", name, a, b, time.Since(start))
+			return result
+		}
+	}
+}
+
+// Counted adds one to *calls for every call that reaches op
+func Counted(calls *int) Decorator {
+	return func(op Operation) Operation {
+		return func(a, b int) int {
+			*calls++
+			return op(a, b)
+		}
+	}
+}
+
+// Memoized caches op's results with Memoize, keyed by both arguments
+func Memoized() Decorator {
+	type args struct{ a, b int }
+	return func(op Operation) Operation {
+		cached := Memoize(func(k args) int { return op(k.a, k.b) })
+		return func(a, b int) int {
+			return cached(args{a, b})
+		}
+	}
+}
+
+// slowPower is an Operation worth caching: a to the power b, with a
+// pause standing in for real work
+func slowPower(a, b int) int {
+	time.Sleep(time.Millisecond)
+	result := 1
+	for i := 0; i < b; i++ {
+		result *= a
+	}
+	return result
+}
+
+func demonstrateDecorators(w io.Writer) {
+	// A decorated Operation is still an Operation, so calculate takes it
+	calls := 0
+	power := Chain(slowPower, Timed(w, "power"), Memoized(), Counted(&calls))
+	fmt.Fprintln(w, "Calculate with a timed, memoized, counted power:")
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(w, "2^10 = %d\n", calculate(2, 10, power))
+	}
+	fmt.Fprintf(w, "slowPower ran %d time(s) for 3 calls\n", calls)
+
+	// The order matters: with Memoized outside Timed, cached calls never
+	// reach the timer, so only the first one is reported
+	calls = 0
+	power = Chain(slowPower, Memoized(), Timed(w, "power"), Counted(&calls))
+	fmt.Fprintln(w, "Memoized outside Timed:")
+	for i := 0; i < 3; i++ {
+		calculate(3, 4, power)
+	}
+	fmt.Fprintf(w, "slowPower ran %d time(s) for 3 calls\n", calls)
+
+	// Memoizing a recursive function: fib calls the memoized version of
+	// itself, so each n is worked out once
+	fibCalls := 0
+	var fib func(int) int
+	fib = Memoize(func(n int) int {
+		fibCalls++
+		if n < 2 {
+			return n
+		}
+		return fib(n-1) + fib(n-2)
+	})
+	fmt.Fprintf(w, "fib(50) = %d in %d calls (about 40 billion without the cache)\n", fib(50), fibCalls)
+
+	// MemoizeSync is safe to share between goroutines
+	var mu sync.Mutex
+	squareCalls := 0
+	square := MemoizeSync(func(n int) int {
+		mu.Lock()
+		squareCalls++
+		mu.Unlock()
+		return n * n
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			square(12)
+		}()
+	}
+	wg.Wait()
+	fmt.Fprintf(w, "10 goroutines asked for square(12) = %d; it ran %d time(s)\n", square(12), squareCalls)
+}
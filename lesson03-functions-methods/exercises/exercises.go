@@ -0,0 +1,52 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 03 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson03
+package exercises
+
+// Exercise 1: MinMax returns the smallest and largest of nums using named
+// results. For an empty slice it returns 0, 0.
+func MinMax(nums ...int) (min, max int) {
+	// TODO: loop over nums, starting from the first element
+	return
+}
+
+// Exercise 2: Map returns a new slice with f applied to every element.
+// nums itself must not change.
+//
+//golab:require loop
+func Map(nums []int, f func(int) int) []int {
+	// TODO: make a result slice and fill it with f(n)
+	return nil
+}
+
+// Exercise 3: MakeAccumulator returns a function that adds its argument to
+// a running total and returns the new total. Each accumulator keeps its
+// own total.
+func MakeAccumulator(start int) func(int) int {
+	// TODO: capture a total variable in a closure
+	return func(n int) int {
+		return 0
+	}
+}
+
+// Account is a bank account
+type Account struct {
+	Owner   string
+	Balance int
+}
+
+// Exercise 4: Deposit adds amount to the balance. It needs a pointer
+// receiver, or the change would be made to a copy.
+func (a *Account) Deposit(amount int) {
+	// TODO: update a.Balance
+}
+
+// Withdraw, also part of exercise 4, takes amount from the balance and reports whether
+// there was enough money. A failed withdrawal leaves the balance alone.
+func (a *Account) Withdraw(amount int) bool {
+	// TODO: check the balance first
+	return false
+}
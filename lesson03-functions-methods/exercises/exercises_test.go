@@ -0,0 +1,71 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMinMax(t *testing.T) {
+	tests := []struct {
+		nums     []int
+		min, max int
+	}{
+		{[]int{3, 1, 4, 1, 5, 9, 2, 6}, 1, 9},
+		{[]int{-2, -8, -1}, -8, -1},
+		{[]int{7}, 7, 7},
+		{nil, 0, 0},
+	}
+	for _, tt := range tests {
+		min, max := MinMax(tt.nums...)
+		if min != tt.min || max != tt.max {
+			t.Errorf("MinMax(%v) = %d, %d; want %d, %d", tt.nums, min, max, tt.min, tt.max)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	nums := []int{1, 2, 3}
+	got := Map(nums, func(n int) int { return n * n })
+	if want := []int{1, 4, 9}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Map(%v, square) = %v; want %v", nums, got, want)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(nums, want) {
+		t.Errorf("Map changed its input to %v", nums)
+	}
+}
+
+func TestMakeAccumulator(t *testing.T) {
+	a := MakeAccumulator(10)
+	b := MakeAccumulator(0)
+
+	if got := a(5); got != 15 {
+		t.Errorf("a(5) = %d; want 15", got)
+	}
+	if got := a(-3); got != 12 {
+		t.Errorf("a(-3) = %d; want 12", got)
+	}
+	if got := b(1); got != 1 {
+		t.Errorf("b(1) = %d; want 1 (accumulators must not share a total)", got)
+	}
+}
+
+func TestAccount(t *testing.T) {
+	account := &Account{Owner: "Alice", Balance: 100}
+
+	account.Deposit(50)
+	if account.Balance != 150 {
+		t.Errorf("after Deposit(50) balance = %d; want 150", account.Balance)
+	}
+
+	if !account.Withdraw(30) || account.Balance != 120 {
+		t.Errorf("Withdraw(30) should succeed and leave 120, balance = %d", account.Balance)
+	}
+	if account.Withdraw(500) {
+		t.Error("Withdraw(500) succeeded with only 120 in the account")
+	}
+	if account.Balance != 120 {
+		t.Errorf("failed withdrawal changed the balance to %d", account.Balance)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build solution
+
+// Reference solutions for the Lesson 03 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+func MinMax(nums ...int) (min, max int) {
+	for i, n := range nums {
+		if i == 0 || n < min {
+			min = n
+		}
+		if i == 0 || n > max {
+			max = n
+		}
+	}
+	return
+}
+
+//golab:require loop
+func Map(nums []int, f func(int) int) []int {
+	result := make([]int, len(nums))
+	for i, n := range nums {
+		result[i] = f(n)
+	}
+	return result
+}
+
+func MakeAccumulator(start int) func(int) int {
+	total := start
+	return func(n int) int {
+		total += n
+		return total
+	}
+}
+
+type Account struct {
+	Owner   string
+	Balance int
+}
+
+func (a *Account) Deposit(amount int) {
+	a.Balance += amount
+}
+
+func (a *Account) Withdraw(amount int) bool {
+	if amount > a.Balance {
+		return false
+	}
+	a.Balance -= amount
+	return true
+}
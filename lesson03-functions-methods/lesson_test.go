@@ -0,0 +1,106 @@
+package lesson03
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden.
+// The timing decorator's durations change from run to run.
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo, golden.Replace(`took \S+`, "took <duration>"))
+}
+
+func TestMemoize(t *testing.T) {
+	calls := 0
+	double := Memoize(func(n int) int {
+		calls++
+		return n * 2
+	})
+	for _, n := range []int{1, 2, 1, 2, 3} {
+		if got := double(n); got != n*2 {
+			t.Errorf("double(%d) = %d, want %d", n, got, n*2)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("the function ran %d times for 3 distinct arguments, want 3", calls)
+	}
+}
+
+// TestMemoizeSync calls one key from many goroutines at once; run it
+// with -race
+func TestMemoizeSync(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := MemoizeSync(func(s string) int {
+		calls.Add(1)
+		<-release // hold every other caller of this key until the test says so
+		return len(s)
+	})
+
+	var wg sync.WaitGroup
+	results := make([]int, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = slow("gopher")
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+	for i, got := range results {
+		if got != 6 {
+			t.Errorf("caller %d got %d, want 6", i, got)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("the function ran %d times for one key, want 1", n)
+	}
+	if got := slow("go"); got != 2 || calls.Load() != 2 {
+		t.Errorf(`slow("go") = %d after %d calls, want 2 after 2`, got, calls.Load())
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Decorator {
+		return func(op Operation) Operation {
+			return func(a, b int) int {
+				order = append(order, name)
+				return op(a, b)
+			}
+		}
+	}
+	op := Chain(add, trace("outer"), trace("inner"))
+	if got := calculate(2, 3, op); got != 5 {
+		t.Errorf("calculate() = %d, want 5", got)
+	}
+	if got := strings.Join(order, ","); got != "outer,inner" {
+		t.Errorf("decorators ran in order %s, want outer,inner", got)
+	}
+	if Chain(add)(1, 1) != 2 {
+		t.Error("Chain with no decorators changed the operation")
+	}
+}
+
+func TestMemoizedTimed(t *testing.T) {
+	var out bytes.Buffer
+	calls := 0
+	op := Chain(add, Memoized(), Timed(&out, "add"), Counted(&calls))
+	for i := 0; i < 3; i++ {
+		op(1, 2)
+	}
+	op(2, 1)
+	if calls != 2 {
+		t.Errorf("add ran %d times, want 2 (once per distinct pair)", calls)
+	}
+	if n := strings.Count(out.String(), "took"); n != 2 {
+		t.Errorf("Timed reported %d calls, want 2:\n%s", n, out.String())
+	}
+}
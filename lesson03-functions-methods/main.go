@@ -1,11 +1,12 @@
 // Lesson 03: Functions and Methods
 // This lesson covers function definitions, parameters, return values, and methods
 
-package main
+package lesson03
 
 import (
 	"fmt"
-	"math"
+	"io"
+	"os"
 )
 
 // Person struct for demonstrating methods
@@ -20,9 +21,9 @@ func (p Person) Greet() string {
 }
 
 // Method with pointer receiver - can modify the struct
-func (p *Person) HaveBirthday() {
+func (p *Person) HaveBirthday(w io.Writer) {
 	p.Age++
-	fmt.Printf("%s just turned %d!\n", p.Name, p.Age)
+	fmt.Fprintf(w, "%s just turned %d!\n", p.Name, p.Age)
 }
 
 // Method that returns multiple values
@@ -30,67 +31,77 @@ func (p Person) GetInfo() (string, int) {
 	return p.Name, p.Age
 }
 
-func main() {
-	fmt.Println("=== Lesson 03: Functions and Methods ===")
+// Run is the lesson's entry point; cmd/lesson03 calls it
+func Run() {
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 03: Functions and Methods ===")
 	
 	// Simple function calls
 	greetings := sayHello("Alice")
-	fmt.Println(greetings)
+	fmt.Fprintln(w, greetings)
 	
 	// Function with multiple parameters
-	sum := add(10, 20)
-	fmt.Printf("10 + 20 = %d\n", sum)
+	addResult := add(10, 20)
+	fmt.Fprintf(w, "10 + 20 = %d\n", addResult)
 	
 	// Function with multiple return values
 	quotient, remainder := divide(17, 5)
-	fmt.Printf("17 / 5 = %d remainder %d\n", quotient, remainder)
+	fmt.Fprintf(w, "17 / 5 = %d remainder %d\n", quotient, remainder)
 	
 	// Using named return values
 	area, perimeter := rectangleStats(4, 6)
-	fmt.Printf("Rectangle (4x6): Area = %.2f, Perimeter = %.2f\n", area, perimeter)
+	fmt.Fprintf(w, "Rectangle (4x6): Area = %.2f, Perimeter = %.2f\n", area, perimeter)
 	
 	// Variadic function (variable number of arguments)
 	total := sum(1, 2, 3, 4, 5)
-	fmt.Printf("Sum of 1,2,3,4,5 = %d\n", total)
+	fmt.Fprintf(w, "Sum of 1,2,3,4,5 = %d\n", total)
 	
 	// Anonymous function (function literal)
 	multiply := func(a, b int) int {
 		return a * b
 	}
 	result := multiply(6, 7)
-	fmt.Printf("6 * 7 = %d\n", result)
+	fmt.Fprintf(w, "6 * 7 = %d\n", result)
 	
 	// Higher-order function (function that takes another function as parameter)
 	operationResult := calculate(10, 5, add)
-	fmt.Printf("Calculate with add: %d\n", operationResult)
+	fmt.Fprintf(w, "Calculate with add: %d\n", operationResult)
 	
 	operationResult = calculate(10, 5, func(a, b int) int {
 		return a * b
 	})
-	fmt.Printf("Calculate with multiply: %d\n", operationResult)
+	fmt.Fprintf(w, "Calculate with multiply: %d\n", operationResult)
 	
 	// Methods demonstration
-	fmt.Println("\n=== Methods Demo ===")
+	fmt.Fprintln(w, "\n=== Methods Demo ===")
 	
 	// Create a Person instance
 	person := Person{Name: "Bob", Age: 30}
 	
 	// Call method
-	fmt.Println(person.Greet())
+	fmt.Fprintln(w, person.Greet())
 	
 	// Method with multiple return values
 	name, age := person.GetInfo()
-	fmt.Printf("Person info: %s is %d years old\n", name, age)
+	fmt.Fprintf(w, "Person info: %s is %d years old\n", name, age)
 	
 	// Method with pointer receiver
-	person.HaveBirthday()
-	fmt.Println(person.Greet()) // Age should be incremented
+	person.HaveBirthday(w)
+	fmt.Fprintln(w, person.Greet()) // Age should be incremented
 	
 	// Closure example
 	counter := createCounter()
-	fmt.Printf("Counter: %d\n", counter())
-	fmt.Printf("Counter: %d\n", counter())
-	fmt.Printf("Counter: %d\n", counter())
+	fmt.Fprintf(w, "Counter: %d\n", counter())
+	fmt.Fprintf(w, "Counter: %d\n", counter())
+	fmt.Fprintf(w, "Counter: %d\n", counter())
+	
+	// Functions that wrap functions
+	fmt.Fprintln(w, "\n=== Decorators and Memoization ===")
+	demonstrateDecorators(w)
 }
 
 // Simple function with one parameter and one return value
@@ -149,11 +160,11 @@ func factorial(n int) int {
 }
 
 // Function demonstrating defer statement
-func demonstrateDefer() {
-	fmt.Println("Start")
-	defer fmt.Println("This will be printed last")
-	defer fmt.Println("This will be printed second to last")
-	fmt.Println("Middle")
-	fmt.Println("End")
+func demonstrateDefer(w io.Writer) {
+	fmt.Fprintln(w, "Start")
+	defer fmt.Fprintln(w, "This will be printed last")
+	defer fmt.Fprintln(w, "This will be printed second to last")
+	fmt.Fprintln(w, "Middle")
+	fmt.Fprintln(w, "End")
 	// Deferred functions are executed in LIFO (Last In, First Out) order
 }
\ No newline at end of file
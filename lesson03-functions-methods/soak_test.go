@@ -0,0 +1,67 @@
+//go:build soak
+
+package lesson03
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"golang-lab/lab/soak"
+)
+
+// TestSoakMemoizeSync hammers a small set of keys from many goroutines.
+// Each check starts a new, empty cache, so every round begins with all
+// the goroutines racing to fill the same keys. f must run once per key
+// however they collide, and every caller must get the right answer.
+func TestSoakMemoizeSync(t *testing.T) {
+	const keys = 32
+	var (
+		mu    sync.Mutex
+		calls map[int]int // key -> how often f ran for it
+		wrong error       // the first wrong answer any step got
+	)
+	var square func(int) int
+	reset := func() {
+		calls = make(map[int]int)
+		square = MemoizeSync(func(n int) int {
+			mu.Lock()
+			calls[n]++
+			mu.Unlock()
+			// f is slow, like anything worth caching, which leaves
+			// other goroutines time to ask for the same key
+			time.Sleep(50 * time.Microsecond)
+			return n * n
+		})
+	}
+	reset()
+
+	soak.Run(t, soak.MustConfig(t), soak.Target{
+		Workers: 16,
+		Step: func(worker int, rng *rand.Rand) {
+			n := rng.Intn(keys)
+			soak.Jitter(rng)
+			if got := square(n); got != n*n {
+				mu.Lock()
+				if wrong == nil {
+					wrong = fmt.Errorf("square(%d) = %d", n, got)
+				}
+				mu.Unlock()
+			}
+		},
+		Check: func() error {
+			if wrong != nil {
+				return wrong
+			}
+			for n, c := range calls {
+				if c != 1 {
+					return fmt.Errorf("f ran %d times for %d", c, n)
+				}
+			}
+			return nil
+		},
+		Reshuffle: func(*rand.Rand) { reset() },
+	})
+}
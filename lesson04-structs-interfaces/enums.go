@@ -0,0 +1,89 @@
+package lesson04
+
+import (
+	"fmt"
+	"io"
+)
+
+// Go has no enum keyword. An enum is a named integer type and a block of
+// constants numbered with iota; giving it a String method (the
+// fmt.Stringer interface) makes fmt print names instead of numbers.
+
+//go:generate stringer -type=Status -trimprefix=Status
+
+// Status is an account's state. Its String method is generated by
+// stringer into status_string.go: run go generate after changing the
+// constants below.
+type Status int
+
+const (
+	StatusPending   Status = iota // the zero value: a new account
+	StatusActive                  // 1
+	StatusSuspended               // 2
+	StatusClosed                  // 3
+)
+
+// CanBecome reports whether an account may move from s to next
+func (s Status) CanBecome(next Status) bool {
+	switch s {
+	case StatusPending:
+		return next == StatusActive || next == StatusClosed
+	case StatusActive:
+		return next == StatusSuspended || next == StatusClosed
+	case StatusSuspended:
+		return next == StatusActive || next == StatusClosed
+	default: // closed, or not a Status at all
+		return false
+	}
+}
+
+// WeekDay is a day of the week, Sunday first like time.Weekday
+type WeekDay int
+
+const (
+	Sunday WeekDay = iota
+	Monday
+	Tuesday
+	Wednesday
+	Thursday
+	Friday
+	Saturday
+)
+
+var weekDayNames = [...]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+// String is written by hand: what stringer generates for Status, without
+// the tool. It has to be kept in step with the constants, and an
+// out-of-range value gets a fallback rather than a panic.
+func (d WeekDay) String() string {
+	if d < Sunday || d > Saturday {
+		return fmt.Sprintf("WeekDay(%d)", int(d))
+	}
+	return weekDayNames[d]
+}
+
+// IsWeekend shows a case listing several values
+func (d WeekDay) IsWeekend() bool {
+	switch d {
+	case Saturday, Sunday:
+		return true
+	default:
+		return false
+	}
+}
+
+func demonstrateStringer(w io.Writer) {
+	// fmt calls String for %v and %s; %d still prints the number
+	s := StatusActive
+	fmt.Fprintf(w, "%%v: %v, %%s: %s, %%d: %d, %%q: %q\n", s, s, s, s)
+	fmt.Fprintf(w, "Inside a struct: %+v\n", struct{ Status Status }{StatusSuspended})
+	fmt.Fprintf(w, "Out of range: %v, %v\n", Status(9), WeekDay(-1))
+
+	// Switching on an enum
+	for _, next := range []Status{StatusActive, StatusClosed, StatusPending} {
+		fmt.Fprintf(w, "%v -> %v allowed: %t\n", StatusSuspended, next, StatusSuspended.CanBecome(next))
+	}
+	for _, d := range []WeekDay{Friday, Saturday, Sunday, Monday} {
+		fmt.Fprintf(w, "%-8v weekend: %t\n", d, d.IsWeekend())
+	}
+}
@@ -0,0 +1,71 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 04 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson04
+package exercises
+
+// Shape is anything with an area and a perimeter
+type Shape interface {
+	Area() float64
+	Perimeter() float64
+}
+
+// Square has sides of length Side
+type Square struct {
+	Side float64
+}
+
+// Exercise 1: make Square satisfy Shape.
+func (s Square) Area() float64 {
+	// TODO: side times side
+	return 0
+}
+
+// Perimeter is also part of exercise 1
+func (s Square) Perimeter() float64 {
+	// TODO: four sides
+	return 0
+}
+
+// Exercise 2: TotalArea adds up the area of every shape.
+//
+//golab:require loop
+func TotalArea(shapes []Shape) float64 {
+	// TODO: loop over shapes and call Area through the interface
+	return 0
+}
+
+// Exercise 3: Describe uses a type switch to describe v:
+//
+//	int     -> "int 5"
+//	string  -> `string "hi"` (use %q)
+//	Shape   -> "shape with area 4.00"
+//	nil     -> "nil"
+//	other   -> "unknown float64" (use %T)
+//
+//golab:require switch
+func Describe(v interface{}) string {
+	// TODO: switch x := v.(type) { ... }
+	return ""
+}
+
+// Contact is a person's name and email
+type Contact struct {
+	Name  string
+	Email string
+}
+
+// Customer embeds Contact, so c.Name and c.Email work directly
+type Customer struct {
+	Contact
+	Orders int
+}
+
+// Exercise 4: Label returns "Name <Email>, N orders" using the promoted
+// fields from the embedded Contact.
+func (c Customer) Label() string {
+	// TODO: use fmt.Sprintf with c.Name, c.Email and c.Orders
+	return ""
+}
@@ -0,0 +1,56 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSquare(t *testing.T) {
+	var shape Shape = Square{Side: 3}
+	if got := shape.Area(); got != 9 {
+		t.Errorf("Square{3}.Area() = %v; want 9", got)
+	}
+	if got := shape.Perimeter(); got != 12 {
+		t.Errorf("Square{3}.Perimeter() = %v; want 12", got)
+	}
+}
+
+func TestTotalArea(t *testing.T) {
+	shapes := []Shape{Square{Side: 1}, Square{Side: 2}, Square{Side: 0.5}}
+	if got := TotalArea(shapes); math.Abs(got-5.25) > 1e-9 {
+		t.Errorf("TotalArea = %v; want 5.25", got)
+	}
+	if got := TotalArea(nil); got != 0 {
+		t.Errorf("TotalArea(nil) = %v; want 0", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{5, "int 5"},
+		{"hi", `string "hi"`},
+		{Square{Side: 2}, "shape with area 4.00"},
+		{nil, "nil"},
+		{2.5, "unknown float64"},
+	}
+	for _, tt := range tests {
+		if got := Describe(tt.value); got != tt.want {
+			t.Errorf("Describe(%#v) = %q; want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCustomerLabel(t *testing.T) {
+	customer := Customer{
+		Contact: Contact{Name: "Ada", Email: "ada@example.com"},
+		Orders:  3,
+	}
+	if got, want := customer.Label(), "Ada <ada@example.com>, 3 orders"; got != want {
+		t.Errorf("Label() = %q; want %q", got, want)
+	}
+}
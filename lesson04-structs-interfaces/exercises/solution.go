@@ -0,0 +1,54 @@
+//go:build solution
+
+// Reference solutions for the Lesson 04 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+import "fmt"
+
+type Shape interface {
+	Area() float64
+	Perimeter() float64
+}
+
+type Square struct{ Side float64 }
+
+func (s Square) Area() float64      { return s.Side * s.Side }
+func (s Square) Perimeter() float64 { return 4 * s.Side }
+
+//golab:require loop
+func TotalArea(shapes []Shape) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	return total
+}
+
+//golab:require switch
+func Describe(v interface{}) string {
+	switch x := v.(type) {
+	case int:
+		return fmt.Sprintf("int %d", x)
+	case string:
+		return fmt.Sprintf("string %q", x)
+	case Shape:
+		return fmt.Sprintf("shape with area %.2f", x.Area())
+	case nil:
+		return "nil"
+	default:
+		return fmt.Sprintf("unknown %T", x)
+	}
+}
+
+type Contact struct{ Name, Email string }
+
+type Customer struct {
+	Contact
+	Orders int
+}
+
+func (c Customer) Label() string {
+	return fmt.Sprintf("%s <%s>, %d orders", c.Name, c.Email, c.Orders)
+}
@@ -0,0 +1,189 @@
+package lesson04
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Number is a constraint: the types Sum can add up. The ~ means any type
+// whose underlying type is one of these, so a `type Meters float64`
+// counts too.
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Sum adds up a slice of any Number. An interface can't do this: there's
+// no interface for "has a + operator".
+func Sum[T Number](values []T) T {
+	var total T
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// TotalArea adds up the areas of a slice of any one kind of Shape. It
+// takes a []Rectangle or a []Circle as it is; a function taking []Shape
+// would need the slice copied into a new one first.
+func TotalArea[S Shape](shapes []S) float64 {
+	areas := make([]float64, len(shapes))
+	for i, s := range shapes {
+		areas[i] = s.Area()
+	}
+	return Sum(areas)
+}
+
+// totalAreaOf is the interface version of TotalArea, for comparison
+func totalAreaOf(shapes []Shape) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	return total
+}
+
+// Largest returns the shape with the biggest area, as its own type: a
+// Rectangle from a []Rectangle, with no type assertion needed to get at
+// its Width. It reports false if shapes is empty.
+func Largest[S Shape](shapes []S) (S, bool) {
+	var best S
+	if len(shapes) == 0 {
+		return best, false
+	}
+	best = shapes[0]
+	for _, s := range shapes[1:] {
+		if s.Area() > best.Area() {
+			best = s
+		}
+	}
+	return best, true
+}
+
+// largestOf is the interface version of Largest: what comes back is a
+// Shape, and the caller has to assert it back to a Rectangle
+func largestOf(shapes []Shape) Shape {
+	var best Shape
+	for _, s := range shapes {
+		if best == nil || s.Area() > best.Area() {
+			best = s
+		}
+	}
+	return best
+}
+
+// Collection holds Describers of one type T. Collection[Rectangle] only
+// takes rectangles; Collection[Describer] takes anything that describes
+// itself, and is just a slice of interfaces again.
+type Collection[T Describer] struct {
+	items []T
+}
+
+// Add appends items to the collection
+func (c *Collection[T]) Add(items ...T) {
+	c.items = append(c.items, items...)
+}
+
+// Len returns how many items the collection holds
+func (c *Collection[T]) Len() int {
+	return len(c.items)
+}
+
+// Items returns the items, in the order they were added
+func (c *Collection[T]) Items() []T {
+	return c.items
+}
+
+// Describe describes every item, one per line
+func (c *Collection[T]) Describe() string {
+	lines := make([]string, len(c.items))
+	for i, item := range c.items {
+		lines[i] = item.Describe()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Filter returns a new collection of the items keep returns true for
+func (c *Collection[T]) Filter(keep func(T) bool) *Collection[T] {
+	out := &Collection[T]{}
+	for _, item := range c.items {
+		if keep(item) {
+			out.Add(item)
+		}
+	}
+	return out
+}
+
+// Map can't be a method: methods can't have type parameters of their
+// own, so turning a Collection[T] into a []U has to be a function
+func Map[T Describer, U any](c *Collection[T], f func(T) U) []U {
+	out := make([]U, 0, c.Len())
+	for _, item := range c.items {
+		out = append(out, f(item))
+	}
+	return out
+}
+
+// kindOf names the kind of shape s is. A type switch needs an interface
+// value, so generic code that wants to branch on its type argument has to
+// convert to any first, and give up the compile-time checks it had.
+func kindOf[S Shape](s S) string {
+	switch any(s).(type) {
+	case Rectangle:
+		return "rectangle"
+	case Circle:
+		return "circle"
+	default:
+		return fmt.Sprintf("%T", s)
+	}
+}
+
+// Meters is a named float64; ~float64 in Number lets Sum take it
+type Meters float64
+
+func demonstrateGenerics(w io.Writer) {
+	rects := []Rectangle{{Width: 5, Height: 3}, {Width: 2, Height: 8}, {Width: 1, Height: 1}}
+	circles := []Circle{{Radius: 1}, {Radius: 2}}
+
+	// A type parameter takes the slice as it is
+	fmt.Fprintf(w, "Total area of %d rectangles: %.2f\n", len(rects), TotalArea(rects))
+	fmt.Fprintf(w, "Total area of %d circles: %.2f\n", len(circles), TotalArea(circles))
+
+	// An interface needs a []Shape: a []Rectangle isn't one, so it has to
+	// be copied over, one element at a time
+	shapes := make([]Shape, len(rects))
+	for i, r := range rects {
+		shapes[i] = r
+	}
+	fmt.Fprintf(w, "The same through []Shape: %.2f\n", totalAreaOf(shapes))
+
+	// Sum works for any Number, including named types
+	fmt.Fprintf(w, "Sum of ints: %d, of Meters: %.1f\n", Sum([]int{1, 2, 3}), Sum([]Meters{1.5, 2.5}))
+
+	// Largest gives back a Rectangle; largestOf gives back a Shape
+	if r, ok := Largest(rects); ok {
+		fmt.Fprintf(w, "Largest rectangle is %.0f wide\n", r.Width)
+	}
+	if r, ok := largestOf(shapes).(Rectangle); ok {
+		fmt.Fprintf(w, "Through the interface, after an assertion: %.0f wide\n", r.Width)
+	}
+
+	// A collection of one type, and a filtered copy of it
+	var boxes Collection[Rectangle]
+	boxes.Add(rects...)
+	big := boxes.Filter(func(r Rectangle) bool { return r.Area() > 10 })
+	fmt.Fprintf(w, "Rectangles bigger than 10: %d of %d\n", big.Len(), boxes.Len())
+	fmt.Fprintln(w, big.Describe())
+	fmt.Fprintf(w, "Their widths: %v\n", Map(&boxes, func(r Rectangle) float64 { return r.Width }))
+
+	// Where generics break down: a Collection[Rectangle] can't hold a
+	// Circle. To mix them, the type argument has to be an interface, and
+	// that's interface polymorphism again.
+	var mixed Collection[ShapeDescriber]
+	mixed.Add(Rectangle{Width: 2, Height: 2}, Circle{Radius: 1})
+	fmt.Fprintln(w, "A mixed Collection[ShapeDescriber]:")
+	fmt.Fprintln(w, mixed.Describe())
+
+	// Nor can a generic function switch on T directly; see kindOf
+	fmt.Fprintf(w, "kindOf: %s, %s\n", kindOf(rects[0]), kindOf(circles[0]))
+}
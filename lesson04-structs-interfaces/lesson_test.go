@@ -0,0 +1,102 @@
+package lesson04
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo)
+}
+
+func TestTotalArea(t *testing.T) {
+	rects := []Rectangle{{Width: 2, Height: 3}, {Width: 4, Height: 5}}
+	if got := TotalArea(rects); got != 26 {
+		t.Errorf("TotalArea(rectangles) = %v, want 26", got)
+	}
+	if got, want := TotalArea([]Circle{{Radius: 1}}), math.Pi; got != want {
+		t.Errorf("TotalArea(circles) = %v, want %v", got, want)
+	}
+	if got := TotalArea([]Shape{rects[0], Circle{Radius: 1}}); got != 6+math.Pi {
+		t.Errorf("TotalArea(shapes) = %v, want %v", got, 6+math.Pi)
+	}
+	if got := TotalArea[Rectangle](nil); got != 0 {
+		t.Errorf("TotalArea(nil) = %v, want 0", got)
+	}
+}
+
+func TestLargest(t *testing.T) {
+	r, ok := Largest([]Rectangle{{Width: 1, Height: 1}, {Width: 3, Height: 3}, {Width: 2, Height: 2}})
+	if !ok || r.Width != 3 {
+		t.Errorf("Largest() = %v, %t; want the 3x3 rectangle", r, ok)
+	}
+	if _, ok := Largest([]Circle{}); ok {
+		t.Error("Largest(empty) reported a shape")
+	}
+}
+
+func TestCollection(t *testing.T) {
+	var c Collection[Rectangle]
+	c.Add(Rectangle{Width: 1, Height: 2}, Rectangle{Width: 3, Height: 4})
+	wide := c.Filter(func(r Rectangle) bool { return r.Width > 2 })
+	if wide.Len() != 1 || c.Len() != 2 {
+		t.Fatalf("Filter() kept %d of %d, want 1 of 2", wide.Len(), c.Len())
+	}
+	if got, want := wide.Describe(), "Rectangle with width 3.00 and height 4.00"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+	if got := Map(&c, Rectangle.Area); !reflect.DeepEqual(got, []float64{2, 12}) {
+		t.Errorf("Map(Area) = %v, want [2 12]", got)
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	tests := map[Status]string{
+		StatusPending:   "Pending",
+		StatusActive:    "Active",
+		StatusSuspended: "Suspended",
+		StatusClosed:    "Closed",
+		Status(-1):      "Status(-1)",
+		Status(4):       "Status(4)",
+	}
+	for s, want := range tests {
+		if got := s.String(); got != want {
+			t.Errorf("Status(%d).String() = %q, want %q", int(s), got, want)
+		}
+	}
+}
+
+func TestWeekDayString(t *testing.T) {
+	for d := Sunday; d <= Saturday; d++ {
+		if got, want := d.String(), time.Weekday(d).String(); got != want {
+			t.Errorf("WeekDay(%d).String() = %q, want %q", int(d), got, want)
+		}
+	}
+	if got := WeekDay(7).String(); got != "WeekDay(7)" {
+		t.Errorf("WeekDay(7).String() = %q, want %q", got, "WeekDay(7)")
+	}
+}
+
+func TestCanBecome(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusPending, StatusActive, true},
+		{StatusPending, StatusSuspended, false},
+		{StatusActive, StatusSuspended, true},
+		{StatusSuspended, StatusActive, true},
+		{StatusClosed, StatusActive, false},
+		{Status(9), StatusActive, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanBecome(tt.to); got != tt.want {
+			t.Errorf("%v.CanBecome(%v) = %t, want %t", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 // Lesson 04: Structs and Interfaces
 // This lesson covers Go's approach to object-oriented programming
 
-package main
+package lesson04
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"os"
+
+	"golang-lab/lab/domain"
 )
 
 // Basic struct definition
@@ -98,12 +102,12 @@ func (e Employee) GetDetails() string {
 }
 
 // Function that works with any Shape
-func printShapeInfo(s Shape) {
-	fmt.Printf("Area: %.2f, Perimeter: %.2f\n", s.Area(), s.Perimeter())
+func printShapeInfo(w io.Writer, s Shape) {
+	fmt.Fprintf(w, "Area: %.2f, Perimeter: %.2f\n", s.Area(), s.Perimeter())
 	
 	// Type assertion to check if shape also implements Describer
 	if describer, ok := s.(Describer); ok {
-		fmt.Printf("Description: %s\n", describer.Describe())
+		fmt.Fprintf(w, "Description: %s\n", describer.Describe())
 	}
 }
 
@@ -113,11 +117,17 @@ type ShapeDescriber interface {
 	Describer // Embedded interface
 }
 
-func main() {
-	fmt.Println("=== Lesson 04: Structs and Interfaces ===")
+// Run is the lesson's entry point; cmd/lesson04 calls it
+func Run() {
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 04: Structs and Interfaces ===")
 	
 	// Creating struct instances
-	fmt.Println("\n--- Basic Structs ---")
+	fmt.Fprintln(w, "\n--- Basic Structs ---")
 	
 	// Different ways to create structs
 	person1 := Person{
@@ -138,12 +148,12 @@ func main() {
 	// Positional initialization (must match field order)
 	person3 := Person{"Bob", "Johnson", 35, "bob.johnson@example.com"}
 	
-	fmt.Printf("Person 1: %s, Age: %d, Adult: %t\n", person1.FullName(), person1.Age, person1.IsAdult())
-	fmt.Printf("Person 2: %s, Age: %d, Adult: %t\n", person2.FullName(), person2.Age, person2.IsAdult())
-	fmt.Printf("Person 3: %s, Age: %d, Adult: %t\n", person3.FullName(), person3.Age, person3.IsAdult())
+	fmt.Fprintf(w, "Person 1: %s, Age: %d, Adult: %t\n", person1.FullName(), person1.Age, person1.IsAdult())
+	fmt.Fprintf(w, "Person 2: %s, Age: %d, Adult: %t\n", person2.FullName(), person2.Age, person2.IsAdult())
+	fmt.Fprintf(w, "Person 3: %s, Age: %d, Adult: %t\n", person3.FullName(), person3.Age, person3.IsAdult())
 	
 	// Embedded structs (composition)
-	fmt.Println("\n--- Embedded Structs ---")
+	fmt.Fprintln(w, "\n--- Embedded Structs ---")
 	
 	employee := Employee{
 		Person: Person{
@@ -163,11 +173,11 @@ func main() {
 		Department: "Engineering",
 	}
 	
-	fmt.Println(employee.GetDetails())
-	fmt.Printf("Lives in: %s, %s\n", employee.City, employee.Country)
+	fmt.Fprintln(w, employee.GetDetails())
+	fmt.Fprintf(w, "Lives in: %s, %s\n", employee.City, employee.Country)
 	
 	// Can access embedded fields directly
-	fmt.Printf("Employee's full name: %s\n", employee.FullName())
+	fmt.Fprintf(w, "Employee's full name: %s\n", employee.FullName())
 	
 	// Anonymous struct
 	product := struct {
@@ -177,10 +187,10 @@ func main() {
 		Name:  "Laptop",
 		Price: 999.99,
 	}
-	fmt.Printf("Product: %s, Price: $%.2f\n", product.Name, product.Price)
+	fmt.Fprintf(w, "Product: %s, Price: $%.2f\n", product.Name, product.Price)
 	
 	// Interfaces demonstration
-	fmt.Println("\n--- Interfaces ---")
+	fmt.Fprintln(w, "\n--- Interfaces ---")
 	
 	// Creating shapes
 	rectangle := Rectangle{Width: 5, Height: 3}
@@ -190,60 +200,93 @@ func main() {
 	shapes := []Shape{rectangle, circle}
 	
 	for i, shape := range shapes {
-		fmt.Printf("\nShape %d:\n", i+1)
-		printShapeInfo(shape)
+		fmt.Fprintf(w, "\nShape %d:\n", i+1)
+		printShapeInfo(w, shape)
 	}
 	
 	// Type assertion and type switch
-	fmt.Println("\n--- Type Assertions and Switches ---")
+	fmt.Fprintln(w, "\n--- Type Assertions and Switches ---")
 	
 	var shape Shape = Rectangle{Width: 10, Height: 5}
 	
 	// Type assertion
 	if rect, ok := shape.(Rectangle); ok {
-		fmt.Printf("It's a rectangle with width: %.2f\n", rect.Width)
+		fmt.Fprintf(w, "It's a rectangle with width: %.2f\n", rect.Width)
 	}
 	
 	// Type switch
-	identifyShape(rectangle)
-	identifyShape(circle)
-	identifyShape("not a shape")
+	identifyShape(w, rectangle)
+	identifyShape(w, circle)
+	identifyShape(w, "not a shape")
 	
 	// Empty interface
-	fmt.Println("\n--- Empty Interface ---")
-	demonstrateEmptyInterface()
+	fmt.Fprintln(w, "\n--- Empty Interface ---")
+	demonstrateEmptyInterface(w)
+	
+	// Types from another package
+	fmt.Fprintln(w, "\n--- Types from Another Package ---")
+	demonstrateSharedTypes(w)
+
+	// Enums and the fmt.Stringer interface
+	fmt.Fprintln(w, "\n--- Enums and Stringer ---")
+	demonstrateStringer(w)
+
+	// Type parameters as another kind of polymorphism
+	fmt.Fprintln(w, "\n--- Generics ---")
+	demonstrateGenerics(w)
 }
 
 // Function demonstrating type switch
-func identifyShape(s interface{}) {
+func identifyShape(w io.Writer, s interface{}) {
 	switch v := s.(type) {
 	case Rectangle:
-		fmt.Printf("Rectangle: %.2f x %.2f\n", v.Width, v.Height)
+		fmt.Fprintf(w, "Rectangle: %.2f x %.2f\n", v.Width, v.Height)
 	case Circle:
-		fmt.Printf("Circle with radius: %.2f\n", v.Radius)
+		fmt.Fprintf(w, "Circle with radius: %.2f\n", v.Radius)
 	default:
-		fmt.Printf("Unknown type: %T\n", v)
+		fmt.Fprintf(w, "Unknown type: %T\n", v)
 	}
 }
 
 // Demonstrating empty interface (interface{})
-func demonstrateEmptyInterface() {
+func demonstrateEmptyInterface(w io.Writer) {
 	// Empty interface can hold any type
 	var anything interface{}
 	
 	anything = 42
-	fmt.Printf("anything = %v (type: %T)\n", anything, anything)
+	fmt.Fprintf(w, "anything = %v (type: %T)\n", anything, anything)
 	
 	anything = "hello"
-	fmt.Printf("anything = %v (type: %T)\n", anything, anything)
+	fmt.Fprintf(w, "anything = %v (type: %T)\n", anything, anything)
 	
 	anything = []int{1, 2, 3}
-	fmt.Printf("anything = %v (type: %T)\n", anything, anything)
+	fmt.Fprintf(w, "anything = %v (type: %T)\n", anything, anything)
 	
 	// Slice of empty interfaces
 	mixedSlice := []interface{}{1, "hello", 3.14, true, Rectangle{2, 3}}
-	fmt.Println("Mixed slice:")
+	fmt.Fprintln(w, "Mixed slice:")
 	for i, item := range mixedSlice {
-		fmt.Printf("  [%d]: %v (type: %T)\n", i, item, item)
+		fmt.Fprintf(w, "  [%d]: %v (type: %T)\n", i, item, item)
 	}
-}
\ No newline at end of file
+}
+
+// Member embeds a struct declared in another package
+type Member struct {
+	domain.User
+	Plan string
+}
+
+// Demonstrating structs and interfaces across package boundaries
+func demonstrateSharedTypes(w io.Writer) {
+	// Only exported (capitalized) fields can be set from outside the package
+	member := Member{
+		User: domain.User{ID: 7, Name: "Dana", Email: "dana@example.com", Age: 41},
+		Plan: "pro",
+	}
+	fmt.Fprintf(w, "Member: %s (%s), plan: %s\n", member.Name, member.Email, member.Plan)
+
+	// domain.ValidationError has an Error() method, so it satisfies the
+	// built-in error interface without ever mentioning it
+	var err error = domain.ValidationError{Field: "email", Message: "invalid email format"}
+	fmt.Fprintf(w, "As an error: %v\n", err)
+}
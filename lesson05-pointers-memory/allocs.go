@@ -0,0 +1,116 @@
+package lesson05
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// allocsPerRun reports how many heap allocations f makes per call,
+// averaged over runs calls, like testing.AllocsPerRun
+func allocsPerRun(runs int, f func()) float64 {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1)) // fewer other goroutines to count
+	f()                                             // warm up
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		f()
+	}
+	runtime.ReadMemStats(&after)
+	return float64(after.Mallocs-before.Mallocs) / float64(runs)
+}
+
+// escapeExamples are the pairs in escape.go, for the demo and the tests
+var escapeExamples = []struct {
+	id    string // for benchmark names
+	name  string
+	stack func()
+	heap  func()
+}{
+	{"pointer", "return a value / a pointer", func() { _ = counterValue(1) }, func() { _ = counterPointer(1) }},
+	{"slice", "use a slice / return a slice", func() { _ = sumFixed() }, func() { _ = makeSlice(8) }},
+	{"interface", "concrete call / interface call", func() { _ = getDirect(1) }, func() { _ = getInterface(1) }},
+	{"closure", "call a closure / return a closure", func() { _ = applyLocal(1) }, func() { _ = makeAdder(1) }},
+}
+
+func demonstrateEscapeAnalysis(w io.Writer) {
+	fmt.Fprintln(w, "Heap allocations per call (stack version, heap version):")
+	for _, ex := range escapeExamples {
+		fmt.Fprintf(w, "  %-38s %.0f, %.0f\n", ex.name, allocsPerRun(100, ex.stack), allocsPerRun(100, ex.heap))
+	}
+	fmt.Fprintln(w, "Ask the compiler why with: go run ./cmd/lesson05 -escape")
+}
+
+// EscapeNote is one escape analysis decision the compiler reported
+type EscapeNote struct {
+	Line    int
+	Message string // e.g. "moved to heap: c"
+}
+
+// escapeNoteLine matches -gcflags=-m output like
+// "./lesson05-pointers-memory/escape.go:42:2: moved to heap: c"
+var escapeNoteLine = regexp.MustCompile(`^(.+\.go):(\d+):\d+: (.*)$`)
+
+// EscapeAnalysis compiles this package with go build -gcflags=-m and
+// returns the compiler's notes about escape.go, by line. It needs the go
+// command and the lesson's source, so it only works from the repository.
+func EscapeAnalysis() ([]EscapeNote, error) {
+	_, self, _, ok := runtime.Caller(0)
+	if !ok {
+		return nil, fmt.Errorf("can't find the lesson's source")
+	}
+	dir := filepath.Dir(self)
+	cmd := exec.Command("go", "build", "-gcflags=-m", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput() // the notes go to stderr
+	if err != nil {
+		return nil, fmt.Errorf("go build -gcflags=-m: %w\n%s", err, out)
+	}
+	return parseEscapeNotes(bytes.NewReader(out), "escape.go")
+}
+
+// parseEscapeNotes picks the notes about file out of -gcflags=-m output,
+// keeping only escape decisions (not inlining), sorted by line
+func parseEscapeNotes(r io.Reader, file string) ([]EscapeNote, error) {
+	var notes []EscapeNote
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := escapeNoteLine.FindStringSubmatch(scanner.Text())
+		if m == nil || filepath.Base(m[1]) != file {
+			continue
+		}
+		msg := m[3]
+		if !strings.Contains(msg, "escape") && !strings.HasPrefix(msg, "moved to heap") {
+			continue
+		}
+		line, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		notes = append(notes, EscapeNote{Line: line, Message: msg})
+	}
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Line < notes[j].Line })
+	return notes, scanner.Err()
+}
+
+// printEscapeAnalysis implements -escape
+func printEscapeAnalysis(w io.Writer) error {
+	notes, err := EscapeAnalysis()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "What go build -gcflags=-m says about escape.go:")
+	for _, note := range notes {
+		fmt.Fprintf(w, "  escape.go:%d: %s\n", note.Line, note.Message)
+	}
+	return nil
+}
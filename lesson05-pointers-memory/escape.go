@@ -0,0 +1,110 @@
+package lesson05
+
+// The functions below come in pairs, one whose values stay on the stack
+// and one whose values escape to the heap. The compiler decides which by
+// escape analysis: a value must live on the heap if anything can still
+// reach it after the function that made it returns. Ask it with
+//
+//	go build -gcflags=-m ./lesson05-pointers-memory
+//
+// or run the lesson with -escape, which does that and shows the lines for
+// this file.
+
+// counterValue returns a Counter by value: the caller gets a copy, so the
+// original can stay in this function's stack frame
+//
+//go:noinline
+func counterValue(n int) Counter {
+	c := Counter{Value: n}
+	return c
+}
+
+// counterPointer returns a pointer to a local. The caller can use it
+// after this function returns, so c is "moved to heap".
+//
+//go:noinline
+func counterPointer(n int) *Counter {
+	c := Counter{Value: n}
+	return &c
+}
+
+// sumFixed uses a slice whose size the compiler knows, so the backing
+// array fits in the stack frame
+//
+//go:noinline
+func sumFixed() int {
+	nums := make([]int, 8)
+	for i := range nums {
+		nums[i] = i
+	}
+	return sum(nums)
+}
+
+// makeSlice returns the slice it makes, so the backing array has to
+// outlive the call and goes to the heap
+//
+//go:noinline
+func makeSlice(n int) []int {
+	return make([]int, n)
+}
+
+func sum(nums []int) int {
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// Getter is satisfied by *Counter, for the interface example
+type Getter interface {
+	Get() int
+}
+
+// Get returns the counter's value
+func (c *Counter) Get() int {
+	return c.Value
+}
+
+// getDirect calls the method on the concrete type: the compiler can see
+// Get doesn't keep c, so c stays on the stack
+//
+//go:noinline
+func getDirect(n int) int {
+	c := Counter{Value: n}
+	return c.Get()
+}
+
+// getVia calls Get through an interface. The compiler can't tell which
+// method that will run, so it assumes it might keep g.
+//
+//go:noinline
+func getVia(g Getter) int {
+	return g.Get()
+}
+
+// getInterface passes &c as a Getter, so c escapes to the heap: the same
+// work as getDirect, one allocation more
+//
+//go:noinline
+func getInterface(n int) int {
+	c := Counter{Value: n}
+	return getVia(&c)
+}
+
+// applyLocal calls a closure right where it's made; it never outlives
+// the call, so neither does what it captures
+//
+//go:noinline
+func applyLocal(n int) int {
+	double := func(x int) int { return x * 2 }
+	return double(n)
+}
+
+// makeAdder returns a closure. The closure and the n it captures have to
+// survive makeAdder returning, so both go to the heap.
+//
+//go:noinline
+func makeAdder(n int) func(int) int {
+	return func(x int) int { return x + n }
+}
@@ -0,0 +1,210 @@
+package lesson05
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden.
+// Addresses change from run to run, so they are numbered in the order they
+// first appear; the golden file still shows which pointers are equal.
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo, numberAddresses)
+}
+
+var addressPattern = regexp.MustCompile(`0x[0-9a-f]{6,}|\b\d{10,}\b`)
+
+func numberAddresses(s string) string {
+	labels := make(map[uint64]string)
+	return addressPattern.ReplaceAllStringFunc(s, func(match string) string {
+		addr, err := strconv.ParseUint(match, 0, 64) // the uintptr demo prints it in decimal too
+		if err != nil {
+			return match
+		}
+		if _, ok := labels[addr]; !ok {
+			labels[addr] = fmt.Sprintf("<address %d>", len(labels)+1)
+		}
+		return labels[addr]
+	})
+}
+
+func TestWriteLinePooled(t *testing.T) {
+	var plain, pooled bytes.Buffer
+	for i := 0; i < 3; i++ { // the same pooled buffer comes back each time
+		if err := writeLine(&plain, "warn", `disk "almost" full`, "used", "91%"); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeLinePooled(&pooled, "warn", `disk "almost" full`, "used", "91%"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := strings.Repeat(`level=warn msg="disk \"almost\" full" used=91%`+"\n", 3)
+	if plain.String() != want || pooled.String() != want {
+		t.Errorf("writeLine wrote\n%s\nwriteLinePooled wrote\n%s\nwant\n%s", plain.String(), pooled.String(), want)
+	}
+}
+
+func TestPutBuffer(t *testing.T) {
+	if !putBuffer(bytes.NewBuffer(make([]byte, 0, maxPooledBuffer))) {
+		t.Error("a buffer at the limit wasn't pooled")
+	}
+	if putBuffer(bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))) {
+		t.Error("a buffer over the limit was pooled")
+	}
+	if got := getBuffer(); got.Len() != 0 {
+		t.Errorf("getBuffer returned %q, want an empty buffer", got.String())
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	big := bytes.Repeat([]byte{1}, 10000) // more than the pooled slice holds
+	for _, tt := range []struct {
+		data []byte
+		want int
+	}{{nil, 0}, {[]byte("ab"), 97 + 98}, {big, 10000}, {[]byte("ab"), 97 + 98}} {
+		if got := checksum(tt.data); got != tt.want {
+			t.Errorf("checksum of %d bytes = %d, want %d", len(tt.data), got, tt.want)
+		}
+	}
+}
+
+// TestEscapeExamples checks each pair in escape.go really does what it
+// says: the stack version allocates nothing, the heap version allocates
+func TestEscapeExamples(t *testing.T) {
+	for _, ex := range escapeExamples {
+		if n := testing.AllocsPerRun(100, ex.stack); n != 0 {
+			t.Errorf("%s: stack version makes %.0f allocations, want 0", ex.name, n)
+		}
+		if n := testing.AllocsPerRun(100, ex.heap); n < 1 {
+			t.Errorf("%s: heap version makes %.0f allocations, want at least 1", ex.name, n)
+		}
+	}
+}
+
+func TestParseEscapeNotes(t *testing.T) {
+	output := `# golang-lab/lesson05-pointers-memory
+./escape.go:17:6: can inline counterValue
+./escape.go:28:9: &c escapes to heap
+./escape.go:27:2: moved to heap: c
+./main.go:40:13: ... argument does not escape
+./escape.go:109:9: func literal escapes to heap
+`
+	notes, err := parseEscapeNotes(strings.NewReader(output), "escape.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []EscapeNote{
+		{27, "moved to heap: c"},
+		{28, "&c escapes to heap"},
+		{109, "func literal escapes to heap"},
+	}
+	if fmt.Sprint(notes) != fmt.Sprint(want) {
+		t.Errorf("parseEscapeNotes() = %v, want %v", notes, want)
+	}
+}
+
+// TestEscapeAnalysis asks the compiler itself, so it needs the go command
+// and is skipped with -short
+func TestEscapeAnalysis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	notes, err := EscapeAnalysis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	for _, note := range notes {
+		all = append(all, note.Message)
+	}
+	got := strings.Join(all, "\n")
+	for _, want := range []string{"moved to heap: c", "make([]int, n) escapes to heap", "func literal escapes to heap"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("escape analysis doesn't mention %q; got:\n%s", want, got)
+		}
+	}
+}
+
+// BenchmarkEscape runs each pair in escape.go; allocs/op is 0 for every
+// stack version and 1 for every heap version
+func BenchmarkEscape(b *testing.B) {
+	for _, ex := range escapeExamples {
+		b.Run(ex.id+"/stack", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ex.stack()
+			}
+		})
+		b.Run(ex.id+"/heap", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ex.heap()
+			}
+		})
+	}
+}
+
+// BenchmarkWriteLine compares a new buffer per line with a pooled one;
+// run with go run ./tasks bench ./lesson05-pointers-memory to see
+// allocs/op drop to zero
+func BenchmarkWriteLine(b *testing.B) {
+	b.Run("new buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := writeLine(io.Discard, "info", "request served", "status", "200", "path", "/api/users"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pooled buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := writeLinePooled(io.Discard, "info", "request served", "status", "200", "path", "/api/users"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// point is small, and used where it's declared, so it lives on the stack
+// and costs nothing to allocate
+type point struct{ X, Y int }
+
+var (
+	pointPool = sync.Pool{New: func() any { return new(point) }}
+	total     int
+)
+
+// BenchmarkTinyObject is where pooling hurts: a value that would have
+// lived on the stack is free, and pooling it forces it onto the heap and
+// adds a Get and a Put to every use, to save nothing
+func BenchmarkTinyObject(b *testing.B) {
+	b.Run("stack", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := point{X: i, Y: i}
+			total += p.X + p.Y
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := pointPool.Get().(*point)
+			p.X, p.Y = i, i
+			total += p.X + p.Y
+			pointPool.Put(p)
+		}
+	})
+}
@@ -1,10 +1,14 @@
 // Lesson 05: Pointers and Memory Management
 // This lesson covers Go's pointer system and memory management
 
-package main
+package lesson05
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"log"
+	"os"
 	"unsafe"
 )
 
@@ -14,144 +18,166 @@ type Counter struct {
 }
 
 // Method with value receiver
-func (c Counter) IncrementValue() {
+func (c Counter) IncrementValue(w io.Writer) {
 	c.Value++ // This won't modify the original
-	fmt.Printf("Inside IncrementValue (value receiver): %d\n", c.Value)
+	fmt.Fprintf(w, "Inside IncrementValue (value receiver): %d\n", c.Value)
 }
 
 // Method with pointer receiver
-func (c *Counter) IncrementPointer() {
+func (c *Counter) IncrementPointer(w io.Writer) {
 	c.Value++ // This modifies the original
-	fmt.Printf("Inside IncrementPointer (pointer receiver): %d\n", c.Value)
+	fmt.Fprintf(w, "Inside IncrementPointer (pointer receiver): %d\n", c.Value)
 }
 
-func main() {
-	fmt.Println("=== Lesson 05: Pointers and Memory Management ===")
+// Run is the lesson's entry point; cmd/lesson05 calls it
+func Run() {
+	escape := flag.Bool("escape", false, "show the compiler's escape analysis of escape.go and exit")
+	flag.Parse()
+	if *escape {
+		if err := printEscapeAnalysis(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 05: Pointers and Memory Management ===")
 	
 	// Basic pointer operations
-	fmt.Println("\n--- Basic Pointers ---")
+	fmt.Fprintln(w, "\n--- Basic Pointers ---")
 	
 	// Declare a variable
 	x := 42
-	fmt.Printf("x = %d\n", x)
-	fmt.Printf("Address of x: %p\n", &x)
+	fmt.Fprintf(w, "x = %d\n", x)
+	fmt.Fprintf(w, "Address of x: %p\n", &x)
 	
 	// Declare a pointer
 	var p *int
-	fmt.Printf("Zero value of pointer: %v\n", p)
+	fmt.Fprintf(w, "Zero value of pointer: %v\n", p)
 	
 	// Assign address to pointer
 	p = &x
-	fmt.Printf("p points to address: %p\n", p)
-	fmt.Printf("Value at address p points to: %d\n", *p)
+	fmt.Fprintf(w, "p points to address: %p\n", p)
+	fmt.Fprintf(w, "Value at address p points to: %d\n", *p)
 	
 	// Modify value through pointer
 	*p = 100
-	fmt.Printf("After modifying through pointer: x = %d\n", x)
+	fmt.Fprintf(w, "After modifying through pointer: x = %d\n", x)
 	
 	// Pointer to pointer
 	pp := &p
-	fmt.Printf("Address of p: %p\n", &p)
-	fmt.Printf("pp points to: %p\n", pp)
-	fmt.Printf("Value pp points to: %p\n", *pp)
-	fmt.Printf("Value of what pp ultimately points to: %d\n", **pp)
+	fmt.Fprintf(w, "Address of p: %p\n", &p)
+	fmt.Fprintf(w, "pp points to: %p\n", pp)
+	fmt.Fprintf(w, "Value pp points to: %p\n", *pp)
+	fmt.Fprintf(w, "Value of what pp ultimately points to: %d\n", **pp)
 	
 	// Array and slice pointers
-	fmt.Println("\n--- Array and Slice Pointers ---")
+	fmt.Fprintln(w, "\n--- Array and Slice Pointers ---")
 	
 	arr := [3]int{10, 20, 30}
-	fmt.Printf("Array: %v\n", arr)
-	fmt.Printf("Address of array: %p\n", &arr)
-	fmt.Printf("Address of first element: %p\n", &arr[0])
+	fmt.Fprintf(w, "Array: %v\n", arr)
+	fmt.Fprintf(w, "Address of array: %p\n", &arr)
+	fmt.Fprintf(w, "Address of first element: %p\n", &arr[0])
 	
 	// Pointer to array
 	arrPtr := &arr
-	fmt.Printf("Through pointer: %v\n", *arrPtr)
+	fmt.Fprintf(w, "Through pointer: %v\n", *arrPtr)
 	(*arrPtr)[1] = 200
-	fmt.Printf("Modified array: %v\n", arr)
+	fmt.Fprintf(w, "Modified array: %v\n", arr)
 	
 	// Slices (already reference types)
 	slice := []int{1, 2, 3}
-	fmt.Printf("Slice: %v\n", slice)
+	fmt.Fprintf(w, "Slice: %v\n", slice)
 	modifySlice(slice)
-	fmt.Printf("After function call: %v\n", slice)
+	fmt.Fprintf(w, "After function call: %v\n", slice)
 	
 	// Struct pointers
-	fmt.Println("\n--- Struct Pointers ---")
+	fmt.Fprintln(w, "\n--- Struct Pointers ---")
 	
 	counter := Counter{Value: 5}
-	fmt.Printf("Initial counter: %d\n", counter.Value)
+	fmt.Fprintf(w, "Initial counter: %d\n", counter.Value)
 	
 	// Method with value receiver
-	counter.IncrementValue()
-	fmt.Printf("After IncrementValue: %d\n", counter.Value)
+	counter.IncrementValue(w)
+	fmt.Fprintf(w, "After IncrementValue: %d\n", counter.Value)
 	
 	// Method with pointer receiver
-	counter.IncrementPointer()
-	fmt.Printf("After IncrementPointer: %d\n", counter.Value)
+	counter.IncrementPointer(w)
+	fmt.Fprintf(w, "After IncrementPointer: %d\n", counter.Value)
 	
 	// Direct pointer operations
 	counterPtr := &counter
 	counterPtr.Value = 10 // Go automatically dereferences
-	fmt.Printf("After direct modification: %d\n", counter.Value)
+	fmt.Fprintf(w, "After direct modification: %d\n", counter.Value)
 	
 	// Function parameter passing
-	fmt.Println("\n--- Function Parameter Passing ---")
+	fmt.Fprintln(w, "\n--- Function Parameter Passing ---")
 	
 	a := 5
 	b := 10
-	fmt.Printf("Before: a=%d, b=%d\n", a, b)
+	fmt.Fprintf(w, "Before: a=%d, b=%d\n", a, b)
 	
 	// Pass by value
-	swapValues(a, b)
-	fmt.Printf("After swapValues: a=%d, b=%d\n", a, b)
+	swapValues(w, a, b)
+	fmt.Fprintf(w, "After swapValues: a=%d, b=%d\n", a, b)
 	
 	// Pass by pointer
-	swapPointers(&a, &b)
-	fmt.Printf("After swapPointers: a=%d, b=%d\n", a, b)
+	swapPointers(w, &a, &b)
+	fmt.Fprintf(w, "After swapPointers: a=%d, b=%d\n", a, b)
 	
 	// Dynamic memory allocation
-	fmt.Println("\n--- Dynamic Memory Allocation ---")
+	fmt.Fprintln(w, "\n--- Dynamic Memory Allocation ---")
 	
 	// Using new() - returns pointer to zero value
 	numPtr := new(int)
-	fmt.Printf("new(int): %p, value: %d\n", numPtr, *numPtr)
+	fmt.Fprintf(w, "new(int): %p, value: %d\n", numPtr, *numPtr)
 	*numPtr = 42
-	fmt.Printf("After assignment: %d\n", *numPtr)
+	fmt.Fprintf(w, "After assignment: %d\n", *numPtr)
 	
 	// Using make() for slices, maps, channels
 	slicePtr := make([]int, 3, 5)
-	fmt.Printf("make([]int, 3, 5): %v, len=%d, cap=%d\n", slicePtr, len(slicePtr), cap(slicePtr))
+	fmt.Fprintf(w, "make([]int, 3, 5): %v, len=%d, cap=%d\n", slicePtr, len(slicePtr), cap(slicePtr))
 	
 	// Struct allocation
 	counter2 := new(Counter)
 	counter2.Value = 15
-	fmt.Printf("New counter: %d\n", counter2.Value)
+	fmt.Fprintf(w, "New counter: %d\n", counter2.Value)
 	
 	// Address allocation with &
 	counter3 := &Counter{Value: 20}
-	fmt.Printf("Address operator allocation: %d\n", counter3.Value)
+	fmt.Fprintf(w, "Address operator allocation: %d\n", counter3.Value)
 	
 	// Memory size and alignment
-	fmt.Println("\n--- Memory Information ---")
-	demonstrateSizes()
+	fmt.Fprintln(w, "\n--- Memory Information ---")
+	demonstrateSizes(w)
 	
 	// Nil pointers
-	fmt.Println("\n--- Nil Pointers ---")
+	fmt.Fprintln(w, "\n--- Nil Pointers ---")
 	var nilPtr *int
-	fmt.Printf("Nil pointer: %v\n", nilPtr)
-	fmt.Printf("Is nil? %t\n", nilPtr == nil)
+	fmt.Fprintf(w, "Nil pointer: %v\n", nilPtr)
+	fmt.Fprintf(w, "Is nil? %t\n", nilPtr == nil)
 	
 	// Checking for nil before dereferencing
 	if nilPtr != nil {
-		fmt.Printf("Value: %d\n", *nilPtr)
+		fmt.Fprintf(w, "Value: %d\n", *nilPtr)
 	} else {
-		fmt.Println("Cannot dereference nil pointer")
+		fmt.Fprintln(w, "Cannot dereference nil pointer")
 	}
 	
+	// Stack or heap: the compiler decides
+	fmt.Fprintln(w, "\n--- Escape Analysis ---")
+	demonstrateEscapeAnalysis(w)
+	
+	// Reusing memory instead of allocating it
+	fmt.Fprintln(w, "\n--- sync.Pool and Buffer Reuse ---")
+	demonstratePooling(w)
+	
 	// Pointer arithmetic (limited in Go)
-	fmt.Println("\n--- Unsafe Pointers (Advanced) ---")
-	unsafePointerDemo()
+	fmt.Fprintln(w, "\n--- Unsafe Pointers (Advanced) ---")
+	unsafePointerDemo(w)
 }
 
 // Function that modifies slice (reference type)
@@ -162,35 +188,35 @@ func modifySlice(s []int) {
 }
 
 // Function with value parameters (doesn't modify originals)
-func swapValues(x, y int) {
+func swapValues(w io.Writer, x, y int) {
 	x, y = y, x
-	fmt.Printf("Inside swapValues: x=%d, y=%d\n", x, y)
+	fmt.Fprintf(w, "Inside swapValues: x=%d, y=%d\n", x, y)
 }
 
 // Function with pointer parameters (modifies originals)
-func swapPointers(x, y *int) {
+func swapPointers(w io.Writer, x, y *int) {
 	*x, *y = *y, *x
-	fmt.Printf("Inside swapPointers: x=%d, y=%d\n", *x, *y)
+	fmt.Fprintf(w, "Inside swapPointers: x=%d, y=%d\n", *x, *y)
 }
 
 // Demonstrate type sizes
-func demonstrateSizes() {
-	fmt.Printf("Size of int: %d bytes\n", unsafe.Sizeof(int(0)))
-	fmt.Printf("Size of float64: %d bytes\n", unsafe.Sizeof(float64(0)))
-	fmt.Printf("Size of string: %d bytes\n", unsafe.Sizeof(string("")))
-	fmt.Printf("Size of []int: %d bytes\n", unsafe.Sizeof([]int{}))
-	fmt.Printf("Size of Counter struct: %d bytes\n", unsafe.Sizeof(Counter{}))
-	fmt.Printf("Size of pointer: %d bytes\n", unsafe.Sizeof(&Counter{}))
+func demonstrateSizes(w io.Writer) {
+	fmt.Fprintf(w, "Size of int: %d bytes\n", unsafe.Sizeof(int(0)))
+	fmt.Fprintf(w, "Size of float64: %d bytes\n", unsafe.Sizeof(float64(0)))
+	fmt.Fprintf(w, "Size of string: %d bytes\n", unsafe.Sizeof(string("")))
+	fmt.Fprintf(w, "Size of []int: %d bytes\n", unsafe.Sizeof([]int{}))
+	fmt.Fprintf(w, "Size of Counter struct: %d bytes\n", unsafe.Sizeof(Counter{}))
+	fmt.Fprintf(w, "Size of pointer: %d bytes\n", unsafe.Sizeof(&Counter{}))
 	
 	// Alignment
 	counter := Counter{}
-	fmt.Printf("Alignment of Counter: %d\n", unsafe.Alignof(counter))
-	fmt.Printf("Offset of Value field: %d\n", unsafe.Offsetof(counter.Value))
+	fmt.Fprintf(w, "Alignment of Counter: %d\n", unsafe.Alignof(counter))
+	fmt.Fprintf(w, "Offset of Value field: %d\n", unsafe.Offsetof(counter.Value))
 }
 
 // Unsafe pointer operations (advanced topic)
-func unsafePointerDemo() {
-	fmt.Println("\nWarning: This demonstrates unsafe operations!")
+func unsafePointerDemo(w io.Writer) {
+	fmt.Fprintln(w, "\nWarning: This demonstrates unsafe operations!")
 	
 	// Convert between different pointer types using unsafe.Pointer
 	x := int64(42)
@@ -198,12 +224,12 @@ func unsafePointerDemo() {
 	
 	// Convert to *int32 (this is unsafe!)
 	int32Ptr := (*int32)(ptr)
-	fmt.Printf("Original int64: %d\n", x)
-	fmt.Printf("As int32: %d\n", *int32Ptr)
+	fmt.Fprintf(w, "Original int64: %d\n", x)
+	fmt.Fprintf(w, "As int32: %d\n", *int32Ptr)
 	
 	// Convert pointer to uintptr for arithmetic
 	addr := uintptr(ptr)
-	fmt.Printf("Memory address as uintptr: %d (0x%x)\n", addr, addr)
+	fmt.Fprintf(w, "Memory address as uintptr: %d (0x%x)\n", addr, addr)
 	
 	// Note: In real applications, avoid unsafe operations unless absolutely necessary
 	// They break Go's type safety and can lead to undefined behavior
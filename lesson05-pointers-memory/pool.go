@@ -0,0 +1,129 @@
+package lesson05
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// maxPooledBuffer is the biggest buffer putBuffer keeps. A pool holds on
+// to whatever it's given, so one huge request would otherwise leave a
+// huge buffer behind for every later small one.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool reuses bytes.Buffers between calls to writeLinePooled. Get
+// returns a buffer someone Put back, or a new one from New; the pool may
+// drop its buffers at any garbage collection, so it's a cache, not a
+// free list.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset() // whatever the last user wrote is still in it
+	return buf
+}
+
+// putBuffer returns buf to the pool, unless it has grown too big to be
+// worth keeping; it reports whether it did
+func putBuffer(buf *bytes.Buffer) bool {
+	if buf.Cap() > maxPooledBuffer {
+		return false
+	}
+	bufferPool.Put(buf)
+	return true
+}
+
+// writeLine formats a log line like `level=info msg="started" port=8080`
+// and writes it to w, with a new buffer every call. In a hot path that's
+// an allocation, and soon garbage, per line.
+func writeLine(w io.Writer, level, msg string, attrs ...string) error {
+	var buf bytes.Buffer
+	formatLine(&buf, level, msg, attrs)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeLinePooled writes the same line with a buffer from bufferPool.
+// Once the pool is warm it allocates nothing at all.
+func writeLinePooled(w io.Writer, level, msg string, attrs ...string) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	formatLine(buf, level, msg, attrs)
+	// w must not keep buf.Bytes(): after putBuffer, someone else will
+	// write over it. io.Writer promises not to retain it, which is what
+	// makes this safe.
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatLine appends the line to buf; attrs are key, value pairs
+func formatLine(buf *bytes.Buffer, level, msg string, attrs []string) {
+	buf.WriteString("level=")
+	buf.WriteString(level)
+	buf.WriteString(" msg=")
+	// AppendQuote writes into the buffer's spare capacity instead of
+	// building a new string
+	buf.Write(strconv.AppendQuote(buf.AvailableBuffer(), msg))
+	for i := 0; i+1 < len(attrs); i += 2 {
+		buf.WriteByte(' ')
+		buf.WriteString(attrs[i])
+		buf.WriteByte('=')
+		buf.WriteString(attrs[i+1])
+	}
+	buf.WriteByte('\n')
+}
+
+// slicePool shows how to pool a []byte: store a pointer to it. Putting
+// the slice itself would copy its header into an interface, which
+// allocates on every Put and undoes the point of pooling.
+var slicePool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// checksum adds up data's bytes, copying it through a pooled scratch
+// slice the way a parser might
+func checksum(data []byte) int {
+	bp := slicePool.Get().(*[]byte)
+	scratch := append((*bp)[:0], data...)
+	sum := 0
+	for _, b := range scratch {
+		sum += int(b)
+	}
+	*bp = scratch // keep the slice if append grew it
+	slicePool.Put(bp)
+	return sum
+}
+
+func demonstratePooling(w io.Writer) {
+	fmt.Fprintln(w, "Log lines written with a pooled buffer:")
+	for i, msg := range []string{"started", "listening", "ready"} {
+		if err := writeLinePooled(w, "info", msg, "step", strconv.Itoa(i+1)); err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+		}
+	}
+	fmt.Fprintln(w, "Compare the allocations with: go run ./tasks bench ./lesson05-pointers-memory")
+
+	// Pitfall: a reused buffer that isn't Reset still holds the last
+	// line, which is why getBuffer always resets
+	fmt.Fprintln(w, "\nReusing a buffer without Reset:")
+	var buf bytes.Buffer
+	formatLine(&buf, "info", "first", nil)
+	formatLine(&buf, "info", "second", nil)
+	fmt.Fprint(w, buf.String())
+
+	// Pitfall: a big buffer in the pool is memory every later user keeps
+	// alive, however little of it they need
+	big := bytes.NewBuffer(make([]byte, 0, 1<<20))
+	fmt.Fprintf(w, "\nPooling a %dKB buffer: %t (the limit is %dKB)\n", big.Cap()>>10, putBuffer(big), maxPooledBuffer>>10)
+	small := new(bytes.Buffer)
+	fmt.Fprintf(w, "Pooling an empty buffer: %t\n", putBuffer(small))
+
+	fmt.Fprintf(w, "\nChecksum through a pooled []byte: %d\n", checksum([]byte("gopher")))
+}
@@ -0,0 +1,42 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 06 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson06
+package exercises
+
+// Exercise 1: FizzBuzz returns the numbers 1..n as strings, with "Fizz"
+// for multiples of 3, "Buzz" for multiples of 5 and "FizzBuzz" for both.
+//
+//golab:require loop
+func FizzBuzz(n int) []string {
+	// TODO: a for loop plus if/else or a tagless switch
+	return nil
+}
+
+// Exercise 2: Grade maps a score to a letter with a switch:
+// 90+ is "A", 80+ "B", 70+ "C", 60+ "D", anything lower "F".
+// Scores outside 0..100 are "invalid".
+//
+//golab:require switch
+func Grade(score int) string {
+	// TODO: switch { case score > 100: ... }
+	return ""
+}
+
+// Exercise 3: FirstNegative returns the index of the first negative number
+// in nums. Stop looping as soon as you find it.
+func FirstNegative(nums []int) (index int, found bool) {
+	// TODO: range over nums and return early
+	return -1, false
+}
+
+// Exercise 4: CountVowels counts a, e, i, o and u in s, in either case.
+// Accented letters like "é" are not counted.
+//
+//golab:require loop
+func CountVowels(s string) int {
+	// TODO: for _, r := range s { switch r { ... } }
+	return 0
+}
@@ -0,0 +1,65 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFizzBuzz(t *testing.T) {
+	want := []string{"1", "2", "Fizz", "4", "Buzz", "Fizz", "7", "8", "Fizz", "Buzz", "11", "Fizz", "13", "14", "FizzBuzz"}
+	if got := FizzBuzz(15); !reflect.DeepEqual(got, want) {
+		t.Errorf("FizzBuzz(15) = %v; want %v", got, want)
+	}
+	if got := FizzBuzz(0); len(got) != 0 {
+		t.Errorf("FizzBuzz(0) = %v; want an empty slice", got)
+	}
+}
+
+func TestGrade(t *testing.T) {
+	tests := map[int]string{
+		100: "A", 90: "A", 89: "B", 80: "B", 75: "C",
+		60: "D", 59: "F", 0: "F", -1: "invalid", 101: "invalid",
+	}
+	for score, want := range tests {
+		if got := Grade(score); got != want {
+			t.Errorf("Grade(%d) = %q; want %q", score, got, want)
+		}
+	}
+}
+
+func TestFirstNegative(t *testing.T) {
+	tests := []struct {
+		nums  []int
+		index int
+		found bool
+	}{
+		{[]int{4, 2, -3, -7}, 2, true},
+		{[]int{-1}, 0, true},
+		{[]int{1, 2, 3}, -1, false},
+		{nil, -1, false},
+	}
+	for _, tt := range tests {
+		index, found := FirstNegative(tt.nums)
+		if index != tt.index || found != tt.found {
+			t.Errorf("FirstNegative(%v) = %d, %t; want %d, %t", tt.nums, index, found, tt.index, tt.found)
+		}
+	}
+}
+
+func TestCountVowels(t *testing.T) {
+	tests := map[string]int{
+		"hello":     2,
+		"GOPHER":    2,
+		"rhythm":    0,
+		"café olé":  2,
+		"":          0,
+		"AeIoU xyz": 5,
+	}
+	for input, want := range tests {
+		if got := CountVowels(input); got != want {
+			t.Errorf("CountVowels(%q) = %d; want %d", input, got, want)
+		}
+	}
+}
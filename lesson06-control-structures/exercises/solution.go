@@ -0,0 +1,65 @@
+//go:build solution
+
+// Reference solutions for the Lesson 06 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+import "strconv"
+
+//golab:require loop
+func FizzBuzz(n int) []string {
+	result := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		switch {
+		case i%15 == 0:
+			result = append(result, "FizzBuzz")
+		case i%3 == 0:
+			result = append(result, "Fizz")
+		case i%5 == 0:
+			result = append(result, "Buzz")
+		default:
+			result = append(result, strconv.Itoa(i))
+		}
+	}
+	return result
+}
+
+//golab:require switch
+func Grade(score int) string {
+	switch {
+	case score < 0 || score > 100:
+		return "invalid"
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+func FirstNegative(nums []int) (index int, found bool) {
+	for i, n := range nums {
+		if n < 0 {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+//golab:require loop
+func CountVowels(s string) int {
+	count := 0
+	for _, r := range s {
+		switch r {
+		case 'a', 'e', 'i', 'o', 'u', 'A', 'E', 'I', 'O', 'U':
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,122 @@
+package lesson06
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden.
+// Deterministic mode fixes the random number and the time of day; only
+// the order Go randomizes on purpose needs evening out.
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo, sortUnordered)
+}
+
+// sortUnordered sorts the lines that come from ranging over a map or from
+// select picking between two ready channels, since Go deliberately
+// randomizes both
+func sortUnordered(s string) string {
+	lines := strings.Split(s, "\n")
+	for _, prefix := range []string{"Color: ", "Received from ch"} {
+		start := -1
+		for i, line := range lines {
+			if strings.HasPrefix(line, prefix) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 {
+				sort.Strings(lines[start:i])
+				start = -1
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestPhaseCycle(t *testing.T) {
+	p := NorthSouthGreen
+	for i := 0; i < 6; i++ {
+		if p.LightFor(North) != Red && p.LightFor(East) != Red {
+			t.Fatalf("%v lets crossing roads go together", p)
+		}
+		if p.LightFor(North) != p.LightFor(South) || p.LightFor(East) != p.LightFor(West) {
+			t.Fatalf("%v shows opposite approaches different lights", p)
+		}
+		p = p.Next()
+	}
+	if p != NorthSouthGreen {
+		t.Errorf("after six phases the light is at %v, want back at %v", p, NorthSouthGreen)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	x := NewIntersection(Timing{MinGreen: 3, MaxGreen: 5, Yellow: 2, AllRed: 1})
+	x.Queues[East] = 1
+
+	// The green is held for MinGreen even with nobody on the road
+	for i := 0; i < 2; i++ {
+		if reason := x.Advance(); reason != "" {
+			t.Fatalf("tick %d: changed before the minimum green (%s)", i+1, reason)
+		}
+	}
+	if reason := x.Advance(); x.Phase != NorthSouthYellow {
+		t.Fatalf("after the minimum green with an empty road, phase = %v (%q), want %v", x.Phase, reason, NorthSouthYellow)
+	}
+
+	// Yellow, then all red, then the other road's green
+	x.Advance()
+	x.Advance()
+	x.Advance()
+	if x.Phase != EastWestGreen {
+		t.Fatalf("phase = %v, want %v", x.Phase, EastWestGreen)
+	}
+
+	// A busy road keeps the green until MaxGreen, then has to give way
+	x.Queues[East], x.Queues[North] = 5, 5
+	for i := 0; i < 4; i++ {
+		x.Advance()
+	}
+	if x.Phase != EastWestGreen {
+		t.Fatalf("busy road lost the green early: phase = %v", x.Phase)
+	}
+	if reason := x.Advance(); x.Phase != EastWestYellow || !strings.HasPrefix(reason, "max green") {
+		t.Errorf("at max green, phase = %v (%q), want %v for max green", x.Phase, reason, EastWestYellow)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	run := func() (string, SimStats) {
+		var out bytes.Buffer
+		stats := Simulate(&out, trafficConfig(100, rand.New(rand.NewSource(7))))
+		return out.String(), stats
+	}
+	out1, stats := run()
+	out2, _ := run()
+	if out1 != out2 {
+		t.Error("two runs with the same seed printed different things")
+	}
+	if stats.Arrived == 0 || stats.Passed != stats.Arrived {
+		t.Errorf("%d cars arrived and %d passed, want every car through", stats.Arrived, stats.Passed)
+	}
+	if stats.Ticks < 100 {
+		t.Errorf("ran %d ticks, want at least the 100 cars arrive for", stats.Ticks)
+	}
+}
+
+func TestSimulateGivesUp(t *testing.T) {
+	cfg := trafficConfig(10, rand.New(rand.NewSource(1)))
+	cfg.Arrivals = [4]float64{North: 1}
+	cfg.CarsPerTick = 0 // nobody can ever leave
+	var out bytes.Buffer
+	stats := Simulate(&out, cfg)
+	if stats.Ticks != 20 || !strings.Contains(out.String(), "gave up with 10 cars") {
+		t.Errorf("ran %d ticks and printed:\n%s\nwant it to give up after 20", stats.Ticks, out.String())
+	}
+}
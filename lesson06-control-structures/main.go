@@ -1,253 +1,276 @@
 // Lesson 06: Control Structures
 // This lesson covers if/else, loops, switch statements, and control flow
 
-package main
+package lesson06
 
 import (
+	"flag"
 	"fmt"
-	"math/rand"
+	"io"
+	"os"
 	"time"
+
+	"golang-lab/lab/demo"
 )
 
-func main() {
-	fmt.Println("=== Lesson 06: Control Structures ===")
+// Run is the lesson's entry point; cmd/lesson06 calls it
+func Run() {
+	traffic := flag.Int("traffic", 0, "watch the traffic light simulator run live for this many ticks")
+	flag.Parse()
+	if *traffic > 0 {
+		cfg := trafficConfig(*traffic, demo.Rand())
+		cfg.Interval = 250 * time.Millisecond
+		cfg.Verbose = true
+		printSimStats(os.Stdout, Simulate(os.Stdout, cfg))
+		return
+	}
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 06: Control Structures ===")
 	
 	// If/else statements
-	fmt.Println("\n--- If/Else Statements ---")
-	demonstrateIfElse()
+	fmt.Fprintln(w, "\n--- If/Else Statements ---")
+	demonstrateIfElse(w)
 	
 	// For loops
-	fmt.Println("\n--- For Loops ---")
-	demonstrateForLoops()
+	fmt.Fprintln(w, "\n--- For Loops ---")
+	demonstrateForLoops(w)
 	
 	// Switch statements
-	fmt.Println("\n--- Switch Statements ---")
-	demonstrateSwitch()
+	fmt.Fprintln(w, "\n--- Switch Statements ---")
+	demonstrateSwitch(w)
 	
 	// Range loops
-	fmt.Println("\n--- Range Loops ---")
-	demonstrateRange()
+	fmt.Fprintln(w, "\n--- Range Loops ---")
+	demonstrateRange(w)
 	
 	// Control flow statements
-	fmt.Println("\n--- Control Flow (break, continue, goto) ---")
-	demonstrateControlFlow()
+	fmt.Fprintln(w, "\n--- Control Flow (break, continue, goto) ---")
+	demonstrateControlFlow(w)
 	
 	// Select statement (for channels)
-	fmt.Println("\n--- Select Statement ---")
-	demonstrateSelect()
+	fmt.Fprintln(w, "\n--- Select Statement ---")
+	demonstrateSelect(w)
+	
+	// All of the above in one program
+	fmt.Fprintln(w, "\n--- Traffic Light Simulator ---")
+	demonstrateTraffic(w)
 }
 
-func demonstrateIfElse() {
+func demonstrateIfElse(w io.Writer) {
 	// Basic if statement
 	x := 10
 	if x > 5 {
-		fmt.Println("x is greater than 5")
+		fmt.Fprintln(w, "x is greater than 5")
 	}
 	
 	// If-else
 	y := 3
 	if y%2 == 0 {
-		fmt.Println("y is even")
+		fmt.Fprintln(w, "y is even")
 	} else {
-		fmt.Println("y is odd")
+		fmt.Fprintln(w, "y is odd")
 	}
 	
 	// If-else if-else
 	score := 85
 	if score >= 90 {
-		fmt.Println("Grade: A")
+		fmt.Fprintln(w, "Grade: A")
 	} else if score >= 80 {
-		fmt.Println("Grade: B")
+		fmt.Fprintln(w, "Grade: B")
 	} else if score >= 70 {
-		fmt.Println("Grade: C")
+		fmt.Fprintln(w, "Grade: C")
 	} else if score >= 60 {
-		fmt.Println("Grade: D")
+		fmt.Fprintln(w, "Grade: D")
 	} else {
-		fmt.Println("Grade: F")
+		fmt.Fprintln(w, "Grade: F")
 	}
 	
 	// If with initialization statement
-	if num := rand.Intn(100); num < 50 {
-		fmt.Printf("Random number %d is less than 50\n", num)
+	if num := demo.Rand().Intn(100); num < 50 {
+		fmt.Fprintf(w, "Random number %d is less than 50\n", num)
 	} else {
-		fmt.Printf("Random number %d is 50 or greater\n", num)
+		fmt.Fprintf(w, "Random number %d is 50 or greater\n", num)
 	}
 	
 	// If with multiple conditions
 	age := 25
 	income := 50000
 	if age >= 18 && income > 30000 {
-		fmt.Println("Eligible for loan")
+		fmt.Fprintln(w, "Eligible for loan")
 	}
 	
 	// If with type assertion
 	var value interface{} = "hello"
 	if str, ok := value.(string); ok {
-		fmt.Printf("Value is a string: %s\n", str)
+		fmt.Fprintf(w, "Value is a string: %s\n", str)
 	}
 }
 
-func demonstrateForLoops() {
+func demonstrateForLoops(w io.Writer) {
 	// Traditional for loop
-	fmt.Println("Traditional for loop:")
+	fmt.Fprintln(w, "Traditional for loop:")
 	for i := 0; i < 5; i++ {
-		fmt.Printf("%d ", i)
+		fmt.Fprintf(w, "%d ", i)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 	
 	// For loop as while
-	fmt.Println("For loop as while:")
+	fmt.Fprintln(w, "For loop as while:")
 	counter := 0
 	for counter < 3 {
-		fmt.Printf("Counter: %d\n", counter)
+		fmt.Fprintf(w, "Counter: %d\n", counter)
 		counter++
 	}
 	
 	// Infinite loop (break to exit)
-	fmt.Println("Infinite loop with break:")
+	fmt.Fprintln(w, "Infinite loop with break:")
 	i := 0
 	for {
 		if i >= 3 {
 			break
 		}
-		fmt.Printf("Iteration: %d\n", i)
+		fmt.Fprintf(w, "Iteration: %d\n", i)
 		i++
 	}
 	
 	// Nested loops
-	fmt.Println("Nested loops (multiplication table):")
+	fmt.Fprintln(w, "Nested loops (multiplication table):")
 	for i := 1; i <= 3; i++ {
 		for j := 1; j <= 3; j++ {
-			fmt.Printf("%d*%d=%d ", i, j, i*j)
+			fmt.Fprintf(w, "%d*%d=%d ", i, j, i*j)
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 	
 	// Loop with continue
-	fmt.Println("Loop with continue (skip even numbers):")
+	fmt.Fprintln(w, "Loop with continue (skip even numbers):")
 	for i := 1; i <= 10; i++ {
 		if i%2 == 0 {
 			continue
 		}
-		fmt.Printf("%d ", i)
+		fmt.Fprintf(w, "%d ", i)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 }
 
-func demonstrateSwitch() {
+func demonstrateSwitch(w io.Writer) {
 	// Basic switch
 	day := "Monday"
 	switch day {
 	case "Monday":
-		fmt.Println("Start of work week")
+		fmt.Fprintln(w, "Start of work week")
 	case "Tuesday", "Wednesday", "Thursday":
-		fmt.Println("Middle of work week")
+		fmt.Fprintln(w, "Middle of work week")
 	case "Friday":
-		fmt.Println("TGIF!")
+		fmt.Fprintln(w, "TGIF!")
 	case "Saturday", "Sunday":
-		fmt.Println("Weekend!")
+		fmt.Fprintln(w, "Weekend!")
 	default:
-		fmt.Println("Invalid day")
+		fmt.Fprintln(w, "Invalid day")
 	}
 	
 	// Switch with initialization
-	switch hour := time.Now().Hour(); {
+	switch hour := demo.Now().Hour(); {
 	case hour < 12:
-		fmt.Println("Good morning!")
+		fmt.Fprintln(w, "Good morning!")
 	case hour < 17:
-		fmt.Println("Good afternoon!")
+		fmt.Fprintln(w, "Good afternoon!")
 	default:
-		fmt.Println("Good evening!")
+		fmt.Fprintln(w, "Good evening!")
 	}
 	
 	// Switch on type
 	var value interface{} = 42
 	switch v := value.(type) {
 	case int:
-		fmt.Printf("Integer: %d\n", v)
+		fmt.Fprintf(w, "Integer: %d\n", v)
 	case string:
-		fmt.Printf("String: %s\n", v)
+		fmt.Fprintf(w, "String: %s\n", v)
 	case bool:
-		fmt.Printf("Boolean: %t\n", v)
+		fmt.Fprintf(w, "Boolean: %t\n", v)
 	default:
-		fmt.Printf("Unknown type: %T\n", v)
+		fmt.Fprintf(w, "Unknown type: %T\n", v)
 	}
 	
 	// Switch without expression (like if-else)
 	num := 15
 	switch {
 	case num < 10:
-		fmt.Println("Single digit")
+		fmt.Fprintln(w, "Single digit")
 	case num < 100:
-		fmt.Println("Double digit")
+		fmt.Fprintln(w, "Double digit")
 	case num < 1000:
-		fmt.Println("Triple digit")
+		fmt.Fprintln(w, "Triple digit")
 	default:
-		fmt.Println("Big number")
+		fmt.Fprintln(w, "Big number")
 	}
 	
 	// Switch with fallthrough
 	grade := 'B'
 	switch grade {
 	case 'A':
-		fmt.Println("Excellent!")
+		fmt.Fprintln(w, "Excellent!")
 		fallthrough
 	case 'B':
-		fmt.Println("Good job!")
+		fmt.Fprintln(w, "Good job!")
 		fallthrough
 	case 'C':
-		fmt.Println("You passed!")
+		fmt.Fprintln(w, "You passed!")
 	case 'D':
-		fmt.Println("You barely passed")
+		fmt.Fprintln(w, "You barely passed")
 	case 'F':
-		fmt.Println("You failed")
+		fmt.Fprintln(w, "You failed")
 	default:
-		fmt.Println("Invalid grade")
+		fmt.Fprintln(w, "Invalid grade")
 	}
 }
 
-func demonstrateRange() {
+func demonstrateRange(w io.Writer) {
 	// Range over slice
 	numbers := []int{10, 20, 30, 40, 50}
-	fmt.Println("Range over slice:")
+	fmt.Fprintln(w, "Range over slice:")
 	for index, value := range numbers {
-		fmt.Printf("Index: %d, Value: %d\n", index, value)
+		fmt.Fprintf(w, "Index: %d, Value: %d\n", index, value)
 	}
 	
 	// Range with blank identifier (ignore index)
-	fmt.Println("\nRange ignoring index:")
+	fmt.Fprintln(w, "\nRange ignoring index:")
 	for _, value := range numbers {
-		fmt.Printf("%d ", value)
+		fmt.Fprintf(w, "%d ", value)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 	
 	// Range ignoring value
-	fmt.Println("\nRange ignoring value:")
+	fmt.Fprintln(w, "\nRange ignoring value:")
 	for index := range numbers {
-		fmt.Printf("Index: %d ", index)
+		fmt.Fprintf(w, "Index: %d ", index)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 	
 	// Range over string (iterates over runes)
-	fmt.Println("\nRange over string:")
+	fmt.Fprintln(w, "\nRange over string:")
 	str := "Hello, 世界!"
 	for index, char := range str {
-		fmt.Printf("Index: %d, Char: %c (Unicode: %U)\n", index, char, char)
+		fmt.Fprintf(w, "Index: %d, Char: %c (Unicode: %U)\n", index, char, char)
 	}
 	
 	// Range over map
-	fmt.Println("\nRange over map:")
+	fmt.Fprintln(w, "\nRange over map:")
 	colors := map[string]string{
 		"red":   "#FF0000",
 		"green": "#00FF00",
 		"blue":  "#0000FF",
 	}
 	for key, value := range colors {
-		fmt.Printf("Color: %s, Hex: %s\n", key, value)
+		fmt.Fprintf(w, "Color: %s, Hex: %s\n", key, value)
 	}
 	
 	// Range over channel (will block until channel is closed)
-	fmt.Println("\nRange over channel:")
+	fmt.Fprintln(w, "\nRange over channel:")
 	ch := make(chan int, 3)
 	ch <- 1
 	ch <- 2
@@ -255,52 +278,52 @@ func demonstrateRange() {
 	close(ch)
 	
 	for value := range ch {
-		fmt.Printf("Received: %d\n", value)
+		fmt.Fprintf(w, "Received: %d\n", value)
 	}
 }
 
-func demonstrateControlFlow() {
+func demonstrateControlFlow(w io.Writer) {
 	// Break and continue in nested loops
-	fmt.Println("Break and continue in nested loops:")
+	fmt.Fprintln(w, "Break and continue in nested loops:")
 	
 	outerLoop:
 	for i := 1; i <= 3; i++ {
 		for j := 1; j <= 3; j++ {
 			if i == 2 && j == 2 {
-				fmt.Println("Breaking out of outer loop")
+				fmt.Fprintln(w, "Breaking out of outer loop")
 				break outerLoop // Label to break out of outer loop
 			}
-			fmt.Printf("i=%d, j=%d\n", i, j)
+			fmt.Fprintf(w, "i=%d, j=%d\n", i, j)
 		}
 	}
 	
 	// Continue with label
-	fmt.Println("\nContinue with label:")
+	fmt.Fprintln(w, "\nContinue with label:")
 	
 	outerContinue:
 	for i := 1; i <= 3; i++ {
 		for j := 1; j <= 3; j++ {
 			if j == 2 {
-				fmt.Printf("Skipping inner loop for i=%d, j=%d\n", i, j)
+				fmt.Fprintf(w, "Skipping inner loop for i=%d, j=%d\n", i, j)
 				continue outerContinue // Continue outer loop
 			}
-			fmt.Printf("i=%d, j=%d\n", i, j)
+			fmt.Fprintf(w, "i=%d, j=%d\n", i, j)
 		}
 	}
 	
 	// Goto statement (use sparingly)
-	fmt.Println("\nGoto statement (not recommended):")
+	fmt.Fprintln(w, "\nGoto statement (not recommended):")
 	i := 0
 	
 loop:
-	fmt.Printf("i = %d\n", i)
+	fmt.Fprintf(w, "i = %d\n", i)
 	i++
 	if i < 3 {
 		goto loop
 	}
 }
 
-func demonstrateSelect() {
+func demonstrateSelect(w io.Writer) {
 	// Select statement for channel operations
 	ch1 := make(chan string, 1)
 	ch2 := make(chan string, 1)
@@ -313,11 +336,11 @@ func demonstrateSelect() {
 	for i := 0; i < 2; i++ {
 		select {
 		case msg1 := <-ch1:
-			fmt.Printf("Received from ch1: %s\n", msg1)
+			fmt.Fprintf(w, "Received from ch1: %s\n", msg1)
 		case msg2 := <-ch2:
-			fmt.Printf("Received from ch2: %s\n", msg2)
+			fmt.Fprintf(w, "Received from ch2: %s\n", msg2)
 		default:
-			fmt.Println("No channels ready")
+			fmt.Fprintln(w, "No channels ready")
 		}
 	}
 	
@@ -325,16 +348,16 @@ func demonstrateSelect() {
 	timeout := time.After(1 * time.Second)
 	select {
 	case <-ch1:
-		fmt.Println("Received from ch1")
+		fmt.Fprintln(w, "Received from ch1")
 	case <-timeout:
-		fmt.Println("Timeout occurred")
+		fmt.Fprintln(w, "Timeout occurred")
 	}
 	
 	// Non-blocking channel operation
 	select {
 	case ch1 <- "New message":
-		fmt.Println("Sent message to ch1")
+		fmt.Fprintln(w, "Sent message to ch1")
 	default:
-		fmt.Println("ch1 is full, cannot send")
+		fmt.Fprintln(w, "ch1 is full, cannot send")
 	}
 }
\ No newline at end of file
@@ -0,0 +1,327 @@
+package lesson06
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"golang-lab/lab/demo"
+)
+
+// A simulator for one intersection with a traffic light: everything the
+// lesson covers, working together. Each tick, cars arrive at random,
+// cars with a green light drive through, and the light decides whether
+// to change. The light is a state machine: a switch on the current phase
+// picks the next one.
+
+// Light is the color a signal shows
+type Light int
+
+const (
+	Red Light = iota
+	Yellow
+	Green
+)
+
+func (l Light) String() string {
+	switch l {
+	case Red:
+		return "red"
+	case Yellow:
+		return "yellow"
+	case Green:
+		return "green"
+	default:
+		return fmt.Sprintf("Light(%d)", int(l))
+	}
+}
+
+// Approach is a direction cars arrive from
+type Approach int
+
+const (
+	North Approach = iota
+	South
+	East
+	West
+)
+
+// approaches lists every Approach, in the order they're printed
+var approaches = [...]Approach{North, South, East, West}
+
+func (a Approach) String() string {
+	return [...]string{"N", "S", "E", "W"}[a]
+}
+
+// Phase is the state of the whole light
+type Phase int
+
+const (
+	NorthSouthGreen Phase = iota
+	NorthSouthYellow
+	AllRedBeforeEastWest
+	EastWestGreen
+	EastWestYellow
+	AllRedBeforeNorthSouth
+)
+
+func (p Phase) String() string {
+	switch p {
+	case NorthSouthGreen:
+		return "NS green"
+	case NorthSouthYellow:
+		return "NS yellow"
+	case EastWestGreen:
+		return "EW green"
+	case EastWestYellow:
+		return "EW yellow"
+	case AllRedBeforeEastWest, AllRedBeforeNorthSouth:
+		return "all red"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// Next is the phase that follows p: the whole state machine in one switch
+func (p Phase) Next() Phase {
+	switch p {
+	case NorthSouthGreen:
+		return NorthSouthYellow
+	case NorthSouthYellow:
+		return AllRedBeforeEastWest
+	case AllRedBeforeEastWest:
+		return EastWestGreen
+	case EastWestGreen:
+		return EastWestYellow
+	case EastWestYellow:
+		return AllRedBeforeNorthSouth
+	default: // AllRedBeforeNorthSouth, and anything unexpected
+		return NorthSouthGreen
+	}
+}
+
+// LightFor is the color cars arriving from a see during p
+func (p Phase) LightFor(a Approach) Light {
+	northSouth := a == North || a == South
+	switch {
+	case p == NorthSouthGreen && northSouth, p == EastWestGreen && !northSouth:
+		return Green
+	case p == NorthSouthYellow && northSouth, p == EastWestYellow && !northSouth:
+		return Yellow
+	default:
+		return Red
+	}
+}
+
+// Timing is how many ticks each phase lasts. A green phase is "actuated":
+// it lasts at least MinGreen ticks, ends early once its own queues are
+// empty and the other road has cars waiting, and never lasts more than
+// MaxGreen.
+type Timing struct {
+	MinGreen int
+	MaxGreen int
+	Yellow   int
+	AllRed   int
+}
+
+// SimConfig sets up a simulation
+type SimConfig struct {
+	Timing Timing
+	// Ticks is how long cars keep arriving. After that the simulation
+	// carries on until the queues are empty, for Ticks more at most.
+	Ticks int
+	// Arrivals is the chance, from 0 to 1, that a car arrives from each
+	// approach on each tick
+	Arrivals [4]float64
+	// CarsPerTick is how many cars can leave one queue per green tick
+	CarsPerTick int
+	// Rand decides when cars arrive; use the same seed for the same run
+	Rand *rand.Rand
+	// Interval is the real time between ticks, to watch the simulation
+	// run; 0 runs it as fast as possible
+	Interval time.Duration
+	// Verbose prints every tick, not just the light changing
+	Verbose bool
+}
+
+// SimStats is what a simulation measured
+type SimStats struct {
+	Ticks    int // how many ticks it ran
+	Arrived  int
+	Passed   int
+	Waited   int // car-ticks spent waiting in a queue
+	MaxQueue int // the longest any one queue got
+	Changes  int // how many times the phase changed
+}
+
+// AverageWait is the mean number of ticks a car spent waiting
+func (s SimStats) AverageWait() float64 {
+	if s.Passed == 0 {
+		return 0
+	}
+	return float64(s.Waited) / float64(s.Passed)
+}
+
+// Intersection is the simulation's state
+type Intersection struct {
+	Phase   Phase
+	Elapsed int    // ticks spent in Phase so far
+	Queues  [4]int // cars waiting at each approach
+	timing  Timing
+}
+
+// NewIntersection returns an empty intersection, green for north-south
+func NewIntersection(t Timing) *Intersection {
+	return &Intersection{Phase: NorthSouthGreen, timing: t}
+}
+
+// waiting returns how many cars wait on the road that's green in p (own)
+// and on the other road (cross)
+func (x *Intersection) waiting(p Phase) (own, cross int) {
+	ns := x.Queues[North] + x.Queues[South]
+	ew := x.Queues[East] + x.Queues[West]
+	if p == EastWestGreen || p == EastWestYellow {
+		return ew, ns
+	}
+	return ns, ew
+}
+
+// Advance counts one more tick in the current phase and moves to the next
+// phase if this one is over. It returns why it changed, or "" if it
+// didn't.
+func (x *Intersection) Advance() (reason string) {
+	x.Elapsed++
+	switch x.Phase {
+	case NorthSouthGreen, EastWestGreen:
+		own, cross := x.waiting(x.Phase)
+		switch {
+		case x.Elapsed < x.timing.MinGreen:
+			return ""
+		case own == 0 && cross > 0:
+			reason = fmt.Sprintf("road clear, %d waiting across", cross)
+		case x.Elapsed >= x.timing.MaxGreen:
+			reason = fmt.Sprintf("max green, %d still waiting", own)
+		default:
+			return "" // keep the green while it's in use, or nobody needs it
+		}
+	case NorthSouthYellow, EastWestYellow:
+		if x.Elapsed < x.timing.Yellow {
+			return ""
+		}
+		reason = "yellow over"
+	default: // all red
+		if x.Elapsed < x.timing.AllRed {
+			return ""
+		}
+		reason = "intersection clear"
+	}
+	x.Phase = x.Phase.Next()
+	x.Elapsed = 0
+	return reason
+}
+
+// Simulate runs cfg's simulation, printing to w as it goes
+func Simulate(w io.Writer, cfg SimConfig) SimStats {
+	x := NewIntersection(cfg.Timing)
+	var stats SimStats
+
+	var tick <-chan time.Time
+	if cfg.Interval > 0 {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+simulation:
+	for t := 1; ; t++ {
+		if tick != nil {
+			<-tick
+		}
+
+		// After Ticks, no more cars come; stop once everyone's through,
+		// or give up if they never will be
+		arriving := t <= cfg.Ticks
+		if !arriving {
+			own, cross := x.waiting(x.Phase)
+			switch {
+			case own+cross == 0:
+				break simulation
+			case t > 2*cfg.Ticks:
+				fmt.Fprintf(w, "t=%-3d gave up with %d cars still waiting\n", t, own+cross)
+				break simulation
+			}
+		}
+		stats.Ticks = t
+
+	approach:
+		for _, a := range approaches {
+			if arriving && cfg.Rand.Float64() < cfg.Arrivals[a] {
+				x.Queues[a]++
+				stats.Arrived++
+			}
+			// Only a green light lets cars go: a yellow means stop if
+			// you can, and every car here is waiting at the line
+			if x.Phase.LightFor(a) != Green {
+				continue
+			}
+			for moved := 0; moved < cfg.CarsPerTick; moved++ {
+				if x.Queues[a] == 0 {
+					continue approach
+				}
+				x.Queues[a]--
+				stats.Passed++
+			}
+		}
+
+		for _, a := range approaches {
+			stats.Waited += x.Queues[a]
+			stats.MaxQueue = max(stats.MaxQueue, x.Queues[a])
+		}
+		if cfg.Verbose {
+			fmt.Fprintf(w, "t=%-3d %-9v %s\n", t, x.Phase, x.queueString())
+		}
+		if reason := x.Advance(); reason != "" {
+			stats.Changes++
+			fmt.Fprintf(w, "t=%-3d -> %-9v (%s)\n", t, x.Phase, reason)
+		}
+	}
+	return stats
+}
+
+// queueString draws each queue as a row of cars
+func (x *Intersection) queueString() string {
+	var b strings.Builder
+	for _, a := range approaches {
+		fmt.Fprintf(&b, " %v:%-6s", a, strings.Repeat("#", min(x.Queues[a], 6)))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// defaultTiming is a short cycle, so a short simulation shows it all
+var defaultTiming = Timing{MinGreen: 4, MaxGreen: 10, Yellow: 2, AllRed: 1}
+
+// trafficConfig is the simulation the demo and -traffic run: a busy main
+// road north-south and a quiet side road east-west
+func trafficConfig(ticks int, rng *rand.Rand) SimConfig {
+	return SimConfig{
+		Timing:      defaultTiming,
+		Ticks:       ticks,
+		Arrivals:    [4]float64{North: 0.5, South: 0.4, East: 0.2, West: 0.1},
+		CarsPerTick: 1,
+		Rand:        rng,
+	}
+}
+
+func printSimStats(w io.Writer, stats SimStats) {
+	fmt.Fprintf(w, "%d ticks: %d cars arrived, %d passed, average wait %.1f ticks, longest queue %d, %d light changes\n",
+		stats.Ticks, stats.Arrived, stats.Passed, stats.AverageWait(), stats.MaxQueue, stats.Changes)
+}
+
+func demonstrateTraffic(w io.Writer) {
+	fmt.Fprintln(w, "40 ticks of a busy north-south road crossing a quiet east-west one:")
+	stats := Simulate(w, trafficConfig(40, demo.Rand()))
+	printSimStats(w, stats)
+	fmt.Fprintln(w, "Watch it tick by tick with: go run ./cmd/lesson06 -traffic 60")
+}
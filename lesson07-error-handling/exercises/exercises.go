@@ -0,0 +1,66 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 07 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson07
+package exercises
+
+import (
+	"errors"
+	"fmt"
+
+	"golang-lab/lab/domain"
+)
+
+// Sentinel errors the exercises return; callers check them with errors.Is
+var (
+	ErrDivideByZero = errors.New("divide by zero")
+	ErrNotFound     = errors.New("not found")
+)
+
+// AgeRangeError reports an age outside domain.MinAge..domain.MaxAge
+type AgeRangeError struct {
+	Age int
+}
+
+func (e *AgeRangeError) Error() string {
+	return fmt.Sprintf("age %d is out of range %d-%d", e.Age, domain.MinAge, domain.MaxAge)
+}
+
+// Exercise 1: SafeDivide returns a / b, or ErrDivideByZero when b is 0.
+func SafeDivide(a, b float64) (float64, error) {
+	// TODO: return ErrDivideByZero instead of dividing by zero
+	return 0, nil
+}
+
+// Exercise 2: ParseAge converts s to an age.
+//   - If s is not a number, return an error that wraps strconv's error
+//     with %w, so errors.As(err, new(*strconv.NumError)) still works.
+//   - If the number is out of range, return an *AgeRangeError.
+//
+//golab:require calls fmt.Errorf
+func ParseAge(s string) (int, error) {
+	// TODO: use strconv.Atoi, wrap its error, then check the range
+	return 0, nil
+}
+
+// Exercise 3: FindUser looks id up in users. When it is missing, return an
+// error that wraps ErrNotFound and mentions the id, e.g. "user 42: not found".
+//
+//golab:require calls fmt.Errorf
+func FindUser(users map[int]domain.User, id int) (domain.User, error) {
+	// TODO: look the user up and wrap ErrNotFound with fmt.Errorf
+	return domain.User{}, nil
+}
+
+// Exercise 4: SafeCall runs f and turns a panic into an error instead of
+// crashing. If f returns normally, SafeCall returns nil.
+//
+//golab:require defer
+//golab:require calls recover
+func SafeCall(f func()) (err error) {
+	// TODO: defer a function that calls recover() and sets err
+	f()
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/domain"
+)
+
+func TestSafeDivide(t *testing.T) {
+	got, err := SafeDivide(10, 4)
+	if err != nil || got != 2.5 {
+		t.Errorf("SafeDivide(10, 4) = %v, %v; want 2.5, nil", got, err)
+	}
+
+	_, err = SafeDivide(1, 0)
+	if !errors.Is(err, ErrDivideByZero) {
+		t.Errorf("SafeDivide(1, 0) error = %v; want ErrDivideByZero", err)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	got, err := ParseAge("42")
+	if err != nil || got != 42 {
+		t.Errorf(`ParseAge("42") = %d, %v; want 42, nil`, got, err)
+	}
+
+	_, err = ParseAge("forty")
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Errorf(`ParseAge("forty") error = %v; want one wrapping *strconv.NumError`, err)
+	}
+
+	for _, input := range []string{"-1", "151"} {
+		_, err := ParseAge(input)
+		var rangeErr *AgeRangeError
+		if !errors.As(err, &rangeErr) {
+			t.Errorf("ParseAge(%q) error = %v; want *AgeRangeError", input, err)
+		}
+	}
+}
+
+func TestFindUser(t *testing.T) {
+	users := map[int]domain.User{
+		1: {ID: 1, Name: "Alice", Email: "alice@example.com"},
+	}
+
+	user, err := FindUser(users, 1)
+	if err != nil || user.Name != "Alice" {
+		t.Errorf("FindUser(users, 1) = %q, %v; want Alice, nil", user.Name, err)
+	}
+
+	_, err = FindUser(users, 42)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindUser(users, 42) error = %v; want one wrapping ErrNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "42") {
+		t.Errorf("error %q should mention the id 42", err)
+	}
+}
+
+func TestSafeCall(t *testing.T) {
+	if err := SafeCall(func() {}); err != nil {
+		t.Errorf("SafeCall(no panic) = %v; want nil", err)
+	}
+
+	// Guard so that a missing recover fails this test instead of the
+	// whole test binary
+	var err error
+	panicked := func() (p bool) {
+		defer func() { p = recover() != nil }()
+		err = SafeCall(func() { panic("boom") })
+		return false
+	}()
+	if panicked {
+		t.Fatal("SafeCall let the panic escape")
+	}
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("SafeCall(panic) = %v; want an error mentioning boom", err)
+	}
+}
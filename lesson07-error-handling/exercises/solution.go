@@ -0,0 +1,63 @@
+//go:build solution
+
+// Reference solutions for the Lesson 07 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"golang-lab/lab/domain"
+)
+
+var (
+	ErrDivideByZero = errors.New("divide by zero")
+	ErrNotFound     = errors.New("not found")
+)
+
+type AgeRangeError struct{ Age int }
+
+func (e *AgeRangeError) Error() string { return "range" }
+
+func SafeDivide(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, ErrDivideByZero
+	}
+	return a / b, nil
+}
+
+//golab:require calls fmt.Errorf
+func ParseAge(s string) (int, error) {
+	age, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("parse age: %w", err)
+	}
+	if age < domain.MinAge || age > domain.MaxAge {
+		return 0, &AgeRangeError{Age: age}
+	}
+	return age, nil
+}
+
+//golab:require calls fmt.Errorf
+func FindUser(users map[int]domain.User, id int) (domain.User, error) {
+	user, ok := users[id]
+	if !ok {
+		return domain.User{}, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	return user, nil
+}
+
+//golab:require defer
+//golab:require calls recover
+func SafeCall(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered: %v", r)
+		}
+	}()
+	f()
+	return nil
+}
@@ -0,0 +1,38 @@
+package lesson07
+
+import (
+	"testing"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo)
+}
+
+// TestComplexOperation steps a fake clock through the three simulated
+// operations instead of sleeping
+func TestComplexOperation(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	clk = fake
+	defer func() { clk = clock.Real{} }()
+	start := fake.Now()
+
+	result := make(chan error)
+	go func() { result <- complexOperation() }()
+	for step := 0; step < 3; step++ {
+		fake.BlockUntil(1)
+		fake.Advance(10 * time.Millisecond)
+	}
+
+	err := <-result
+	if err == nil || err.Error() != "step 2 failed: step 2 always fails in demo" {
+		t.Errorf("complexOperation() = %v, want step 2 to fail", err)
+	}
+	if took := fake.Since(start); took != 30*time.Millisecond {
+		t.Errorf("took %v of fake time, want 30ms", took)
+	}
+}
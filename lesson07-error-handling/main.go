@@ -1,26 +1,21 @@
 // Lesson 07: Error Handling
 // This lesson covers Go's error handling patterns and best practices
 
-package main
+package lesson07
 
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
 	"time"
-)
 
-// Custom error types
-type ValidationError struct {
-	Field   string
-	Message string
-}
+	"golang-lab/lab/clock"
+	"golang-lab/lab/domain"
+)
 
-// Implement error interface
-func (e ValidationError) Error() string {
-	return fmt.Sprintf("validation error in field '%s': %s", e.Field, e.Message)
-}
+// clk is where the lesson gets the time; tests can swap in a clock.Fake
+var clk clock.Clock = clock.Real{}
 
 // Custom error with additional context
 type DatabaseError struct {
@@ -38,148 +33,146 @@ func (e DatabaseError) Unwrap() error {
 	return e.Err
 }
 
-// User struct for demonstration
-type User struct {
-	ID    int
-	Name  string
-	Email string
-	Age   int
+// Run is the lesson's entry point; cmd/lesson07 calls it
+func Run() {
+	Demo(os.Stdout)
 }
 
-func main() {
-	fmt.Println("=== Lesson 07: Error Handling ===")
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 07: Error Handling ===")
 	
 	// Basic error handling
-	fmt.Println("\n--- Basic Error Handling ---")
-	demonstrateBasicErrors()
+	fmt.Fprintln(w, "\n--- Basic Error Handling ---")
+	demonstrateBasicErrors(w)
 	
 	// Creating custom errors
-	fmt.Println("\n--- Custom Errors ---")
-	demonstrateCustomErrors()
+	fmt.Fprintln(w, "\n--- Custom Errors ---")
+	demonstrateCustomErrors(w)
 	
 	// Error wrapping and unwrapping
-	fmt.Println("\n--- Error Wrapping ---")
-	demonstrateErrorWrapping()
+	fmt.Fprintln(w, "\n--- Error Wrapping ---")
+	demonstrateErrorWrapping(w)
 	
 	// Panic and recover
-	fmt.Println("\n--- Panic and Recover ---")
-	demonstratePanicRecover()
+	fmt.Fprintln(w, "\n--- Panic and Recover ---")
+	demonstratePanicRecover(w)
 	
 	// Best practices
-	fmt.Println("\n--- Error Handling Best Practices ---")
-	demonstrateBestPractices()
+	fmt.Fprintln(w, "\n--- Error Handling Best Practices ---")
+	demonstrateBestPractices(w)
 }
 
-func demonstrateBasicErrors() {
+func demonstrateBasicErrors(w io.Writer) {
 	// Function that returns an error
 	result, err := divide(10, 2)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(w, "Error: %v\n", err)
 	} else {
-		fmt.Printf("10 / 2 = %.2f\n", result)
+		fmt.Fprintf(w, "10 / 2 = %.2f\n", result)
 	}
 	
 	// Division by zero error
 	result, err = divide(10, 0)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(w, "Error: %v\n", err)
 	} else {
-		fmt.Printf("Result: %.2f\n", result)
+		fmt.Fprintf(w, "Result: %.2f\n", result)
 	}
 	
 	// Multiple return values with error
 	user, err := findUser(1)
 	if err != nil {
-		fmt.Printf("Error finding user: %v\n", err)
+		fmt.Fprintf(w, "Error finding user: %v\n", err)
 	} else {
-		fmt.Printf("Found user: %+v\n", user)
+		fmt.Fprintf(w, "Found user: %+v\n", user)
 	}
 	
 	// File operations (common source of errors)
 	content, err := readFile("nonexistent.txt")
 	if err != nil {
-		fmt.Printf("Error reading file: %v\n", err)
+		fmt.Fprintf(w, "Error reading file: %v\n", err)
 	} else {
-		fmt.Printf("File content: %s\n", content)
+		fmt.Fprintf(w, "File content: %s\n", content)
 	}
 }
 
-func demonstrateCustomErrors() {
+func demonstrateCustomErrors(w io.Writer) {
 	// Using custom error types
-	user := User{ID: 1, Name: "", Email: "invalid-email", Age: -5}
+	user := domain.User{ID: 1, Name: "", Email: "invalid-email", Age: -5}
 	
 	err := validateUser(user)
 	if err != nil {
-		fmt.Printf("Validation failed: %v\n", err)
+		fmt.Fprintf(w, "Validation failed: %v\n", err)
 		
 		// Type assertion to get specific error type
-		if validationErr, ok := err.(ValidationError); ok {
-			fmt.Printf("Field with error: %s\n", validationErr.Field)
+		if validationErr, ok := err.(domain.ValidationError); ok {
+			fmt.Fprintf(w, "Field with error: %s\n", validationErr.Field)
 		}
 	}
 	
 	// Multiple validation errors
 	errors := validateUserComprehensive(user)
 	if len(errors) > 0 {
-		fmt.Println("Validation errors:")
+		fmt.Fprintln(w, "Validation errors:")
 		for _, err := range errors {
-			fmt.Printf("  - %v\n", err)
+			fmt.Fprintf(w, "  - %v\n", err)
 		}
 	}
 	
 	// Database error example
 	err = saveUser(user)
 	if err != nil {
-		fmt.Printf("Save failed: %v\n", err)
+		fmt.Fprintf(w, "Save failed: %v\n", err)
 	}
 }
 
-func demonstrateErrorWrapping() {
+func demonstrateErrorWrapping(w io.Writer) {
 	// Error wrapping with fmt.Errorf
 	err := processUserData(0)
 	if err != nil {
-		fmt.Printf("Process failed: %v\n", err)
+		fmt.Fprintf(w, "Process failed: %v\n", err)
 		
 		// Unwrap the error
 		originalErr := errors.Unwrap(err)
 		if originalErr != nil {
-			fmt.Printf("Original error: %v\n", originalErr)
+			fmt.Fprintf(w, "Original error: %v\n", originalErr)
 		}
 		
 		// Check if error is of specific type
 		var dbErr DatabaseError
 		if errors.As(err, &dbErr) {
-			fmt.Printf("Database operation: %s\n", dbErr.Operation)
+			fmt.Fprintf(w, "Database operation: %s\n", dbErr.Operation)
 		}
 		
 		// Check if error is a specific error
 		if errors.Is(err, ErrUserNotFound) {
-			fmt.Println("User not found error detected")
+			fmt.Fprintln(w, "User not found error detected")
 		}
 	}
 }
 
-func demonstratePanicRecover() {
+func demonstratePanicRecover(w io.Writer) {
 	// Safe function that recovers from panic
-	fmt.Println("Calling function that might panic...")
+	fmt.Fprintln(w, "Calling function that might panic...")
 	
-	result := safeOperation(func() interface{} {
+	result := safeOperation(w, func() interface{} {
 		return riskyOperation(10, 0)
 	})
 	
 	if result != nil {
-		fmt.Printf("Safe operation result: %v\n", result)
+		fmt.Fprintf(w, "Safe operation result: %v\n", result)
 	} else {
-		fmt.Println("Operation failed safely")
+		fmt.Fprintln(w, "Operation failed safely")
 	}
 	
 	// Demonstrate panic/recover in a goroutine
-	fmt.Println("\nDemonstrating panic handling in goroutine:")
+	fmt.Fprintln(w, "\nDemonstrating panic handling in goroutine:")
 	done := make(chan bool)
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				fmt.Printf("Recovered from panic in goroutine: %v\n", r)
+				fmt.Fprintf(w, "Recovered from panic in goroutine: %v\n", r)
 			}
 			done <- true
 		}()
@@ -188,18 +181,18 @@ func demonstratePanicRecover() {
 	}()
 	
 	<-done
-	fmt.Println("Goroutine completed")
+	fmt.Fprintln(w, "Goroutine completed")
 }
 
-func demonstrateBestPractices() {
+func demonstrateBestPractices(w io.Writer) {
 	// Don't ignore errors
 	user, err := findUser(2)
 	if err != nil {
 		// Handle error appropriately
-		fmt.Printf("Could not find user: %v\n", err)
+		fmt.Fprintf(w, "Could not find user: %v\n", err)
 		return
 	}
-	fmt.Printf("Found user: %s\n", user.Name)
+	fmt.Fprintf(w, "Found user: %s\n", user.Name)
 	
 	// Error handling in loops
 	userIDs := []int{1, 2, 3, 999}
@@ -207,16 +200,16 @@ func demonstrateBestPractices() {
 		user, err := findUser(id)
 		if err != nil {
 			// Log error but continue processing
-			fmt.Printf("Warning: Could not find user %d: %v\n", id, err)
+			fmt.Fprintf(w, "Warning: Could not find user %d: %v\n", id, err)
 			continue
 		}
-		fmt.Printf("Processing user: %s\n", user.Name)
+		fmt.Fprintf(w, "Processing user: %s\n", user.Name)
 	}
 	
 	// Returning errors early
 	err = complexOperation()
 	if err != nil {
-		fmt.Printf("Complex operation failed: %v\n", err)
+		fmt.Fprintf(w, "Complex operation failed: %v\n", err)
 	}
 }
 
@@ -235,20 +228,20 @@ var (
 )
 
 // Function that uses predefined errors
-func findUser(id int) (User, error) {
+func findUser(id int) (domain.User, error) {
 	if id <= 0 {
-		return User{}, ErrInvalidID
+		return domain.User{}, ErrInvalidID
 	}
 	
 	// Simulate database lookup
-	users := map[int]User{
+	users := map[int]domain.User{
 		1: {ID: 1, Name: "Alice", Email: "alice@example.com", Age: 30},
 		2: {ID: 2, Name: "Bob", Email: "bob@example.com", Age: 25},
 	}
 	
 	user, exists := users[id]
 	if !exists {
-		return User{}, ErrUserNotFound
+		return domain.User{}, ErrUserNotFound
 	}
 	
 	return user, nil
@@ -264,46 +257,41 @@ func readFile(filename string) (string, error) {
 }
 
 // Function with custom validation error
-func validateUser(user User) error {
+func validateUser(user domain.User) error {
 	if user.Name == "" {
-		return ValidationError{Field: "Name", Message: "name cannot be empty"}
+		return domain.ValidationError{Field: "Name", Message: "name cannot be empty"}
 	}
 	if user.Age < 0 {
-		return ValidationError{Field: "Age", Message: "age cannot be negative"}
+		return domain.ValidationError{Field: "Age", Message: "age cannot be negative"}
 	}
-	if !isValidEmail(user.Email) {
-		return ValidationError{Field: "Email", Message: "invalid email format"}
+	if !domain.ValidEmail(user.Email) {
+		return domain.ValidationError{Field: "Email", Message: "invalid email format"}
 	}
 	return nil
 }
 
 // Function that returns multiple errors
-func validateUserComprehensive(user User) []error {
+func validateUserComprehensive(user domain.User) []error {
 	var errors []error
 	
 	if user.Name == "" {
-		errors = append(errors, ValidationError{Field: "Name", Message: "name cannot be empty"})
+		errors = append(errors, domain.ValidationError{Field: "Name", Message: "name cannot be empty"})
 	}
 	if user.Age < 0 {
-		errors = append(errors, ValidationError{Field: "Age", Message: "age cannot be negative"})
+		errors = append(errors, domain.ValidationError{Field: "Age", Message: "age cannot be negative"})
 	}
-	if user.Age > 150 {
-		errors = append(errors, ValidationError{Field: "Age", Message: "age seems unrealistic"})
+	if user.Age > domain.MaxAge {
+		errors = append(errors, domain.ValidationError{Field: "Age", Message: "age seems unrealistic"})
 	}
-	if !isValidEmail(user.Email) {
-		errors = append(errors, ValidationError{Field: "Email", Message: "invalid email format"})
+	if !domain.ValidEmail(user.Email) {
+		errors = append(errors, domain.ValidationError{Field: "Email", Message: "invalid email format"})
 	}
 	
 	return errors
 }
 
-// Simple email validation
-func isValidEmail(email string) bool {
-	return len(email) > 0 && email != "invalid-email"
-}
-
 // Function that returns wrapped error
-func saveUser(user User) error {
+func saveUser(user domain.User) error {
 	// Simulate database error
 	originalErr := errors.New("connection timeout")
 	return DatabaseError{
@@ -337,10 +325,10 @@ func riskyOperation(a, b int) int {
 }
 
 // Safe wrapper that recovers from panic
-func safeOperation(operation func() interface{}) (result interface{}) {
+func safeOperation(w io.Writer, operation func() interface{}) (result interface{}) {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Recovered from panic: %v\n", r)
+			fmt.Fprintf(w, "Recovered from panic: %v\n", r)
 			result = nil
 		}
 	}()
@@ -361,7 +349,7 @@ func complexOperation() error {
 
 func stepOperation(step int) error {
 	// Simulate some operation that might fail
-	time.Sleep(10 * time.Millisecond)
+	clk.Sleep(10 * time.Millisecond)
 	if step == 2 {
 		return errors.New("step 2 always fails in demo")
 	}
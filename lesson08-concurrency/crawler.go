@@ -0,0 +1,328 @@
+package lesson08
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-lab/lab/clock"
+)
+
+// Fetcher fetches a page and returns the URLs it links to
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (links []string, err error)
+}
+
+// CrawlOptions bound how hard Crawl works
+type CrawlOptions struct {
+	// Workers is how many pages are fetched at once; 0 means 4
+	Workers int
+	// PerHost is the least time between two requests to the same host,
+	// so the crawl stays polite; 0 means no limit
+	PerHost time.Duration
+}
+
+// CrawlResult is what a crawl found
+type CrawlResult struct {
+	// Links maps every page fetched to the pages it links to
+	Links map[string][]string
+	// Errors holds the pages that couldn't be fetched, and why
+	Errors map[string]error
+}
+
+// Crawl fetches start, then the pages it links to, and so on for depth
+// levels in all (depth 1 fetches start alone), and returns the link
+// graph. Each level is fetched concurrently, by opts.Workers goroutines
+// at most, and the next level starts when it is done, so every page is
+// reached by its shortest path from start. If ctx is cancelled, Crawl
+// stops and returns what it found so far with ctx's error.
+func Crawl(ctx context.Context, fetcher Fetcher, start string, depth int, opts CrawlOptions) (*CrawlResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	result := &CrawlResult{Links: make(map[string][]string), Errors: make(map[string]error)}
+	var mu sync.Mutex // guards result
+	visited := newVisitedSet()
+	limiter := newHostLimiter(opts.PerHost, clk)
+	sem := make(chan struct{}, workers)
+
+	level := []string{start}
+	visited.Visit(start)
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var next []string
+		var wg sync.WaitGroup
+		for _, page := range level {
+			wg.Add(1)
+			go func(page string) {
+				defer wg.Done()
+				// Take a worker slot, unless the crawl is cancelled first
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-sem }()
+
+				links, err := fetchPolitely(ctx, fetcher, limiter, page)
+				if ctx.Err() != nil {
+					return // not the page's fault; don't record it
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					result.Errors[page] = err
+					return
+				}
+				result.Links[page] = links
+				for _, link := range links {
+					if visited.Visit(link) {
+						next = append(next, link)
+					}
+				}
+			}(page)
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		// Goroutines finish in any order; sorting keeps the next level's
+		// order, and so the crawl, the same every run
+		sort.Strings(next)
+		level = next
+	}
+	return result, nil
+}
+
+func fetchPolitely(ctx context.Context, fetcher Fetcher, limiter *hostLimiter, page string) ([]string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return nil, err
+	}
+	if err := limiter.Wait(ctx, u.Host); err != nil {
+		return nil, err
+	}
+	return fetcher.Fetch(ctx, page)
+}
+
+// visitedSet is a set of URLs that goroutines can share
+type visitedSet struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newVisitedSet() *visitedSet {
+	return &visitedSet{seen: make(map[string]bool)}
+}
+
+// Visit adds url to the set and reports whether it was new. Checking and
+// adding under one lock means two goroutines can't both claim a URL.
+func (v *visitedSet) Visit(url string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen[url] {
+		return false
+	}
+	v.seen[url] = true
+	return true
+}
+
+// hostLimiter spaces out requests to each host by at least interval
+type hostLimiter struct {
+	interval time.Duration
+	clock    clock.Clock
+	mu       sync.Mutex
+	next     map[string]time.Time // when each host may next be sent a request
+}
+
+func newHostLimiter(interval time.Duration, c clock.Clock) *hostLimiter {
+	return &hostLimiter{interval: interval, clock: c, next: make(map[string]time.Time)}
+}
+
+// Wait blocks until a request to host is allowed, or ctx is cancelled.
+// Each caller reserves the next free slot under the lock and then sleeps
+// without it, so waiting for one host never holds up another.
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := l.clock.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait := slot.Sub(now); wait > 0 {
+		select {
+		case <-l.clock.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
+
+// ErrNotFound is what the fake web returns for a page it doesn't have
+var ErrNotFound = errors.New("not found")
+
+// fakeWeb is a Fetcher over pages held in memory, each fetch taking
+// latency, so the crawler can be shown and tested without a network
+type fakeWeb struct {
+	pages   map[string][]string
+	latency time.Duration
+}
+
+func (f fakeWeb) Fetch(ctx context.Context, url string) ([]string, error) {
+	select {
+	case <-clk.After(f.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	links, ok := f.pages[url]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", url, ErrNotFound)
+	}
+	return links, nil
+}
+
+// hrefPattern finds links in HTML. A real crawler would use an HTML
+// parser such as golang.org/x/net/html; a regexp is enough for a lesson.
+var hrefPattern = regexp.MustCompile(`<a\s[^>]*href="([^"#]+)`)
+
+// maxPageSize is the most of a page HTTPFetcher reads
+const maxPageSize = 1 << 20
+
+// HTTPFetcher fetches real pages over HTTP with Client, or
+// http.DefaultClient if Client is nil
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// Fetch gets url and returns the absolute http(s) URLs it links to, each
+// once, in the order they first appear
+func (f HTTPFetcher) Fetch(ctx context.Context, page string) ([]string, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, page, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", page, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	base := resp.Request.URL // after any redirects
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range hrefPattern.FindAllSubmatch(body, -1) {
+		ref, err := url.Parse(string(match[1]))
+		if err != nil {
+			continue
+		}
+		link := base.ResolveReference(ref)
+		if link.Scheme != "http" && link.Scheme != "https" {
+			continue
+		}
+		if s := link.String(); !seen[s] {
+			seen[s] = true
+			links = append(links, s)
+		}
+	}
+	return links, nil
+}
+
+// sampleWeb is a small site for demonstrateCrawler to crawl
+var sampleWeb = fakeWeb{
+	latency: 20 * time.Millisecond,
+	pages: map[string][]string{
+		"https://go.dev/": {
+			"https://go.dev/learn/",
+			"https://go.dev/doc/",
+			"https://pkg.go.dev/",
+		},
+		"https://go.dev/learn/": {
+			"https://go.dev/",
+			"https://go.dev/tour/",
+			"https://go.dev/doc/",
+		},
+		"https://go.dev/doc/": {
+			"https://go.dev/",
+			"https://go.dev/doc/effective_go",
+			"https://go.dev/ref/spec",
+		},
+		"https://go.dev/doc/effective_go": {
+			"https://go.dev/doc/",
+		},
+		"https://pkg.go.dev/": {
+			"https://pkg.go.dev/std",
+			"https://go.dev/",
+		},
+		"https://pkg.go.dev/std": {
+			"https://pkg.go.dev/fmt",
+			"https://pkg.go.dev/sync",
+		},
+	},
+}
+
+func demonstrateCrawler(w io.Writer) {
+	fmt.Fprintln(w, "Crawling https://go.dev/ to depth 3, with 3 workers and 50ms between requests to a host:")
+	opts := CrawlOptions{Workers: 3, PerHost: 50 * time.Millisecond}
+	result, err := Crawl(context.Background(), sampleWeb, "https://go.dev/", 3, opts)
+	if err != nil {
+		fmt.Fprintf(w, "Crawl failed: %v\n", err)
+		return
+	}
+	printCrawl(w, result)
+
+	// The same crawl, cut short: every goroutine sees the deadline pass
+	// and stops, and Crawl returns what it found so far
+	fmt.Fprintln(w, "\nThe same crawl with a 60ms timeout:")
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	_, err = Crawl(ctx, sampleWeb, "https://go.dev/", 3, opts)
+	fmt.Fprintf(w, "Crawl stopped early: %v\n", err)
+}
+
+func printCrawl(w io.Writer, result *CrawlResult) {
+	pages := make([]string, 0, len(result.Links))
+	for page := range result.Links {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	for _, page := range pages {
+		fmt.Fprintf(w, "%s\n", page)
+		for _, link := range result.Links[page] {
+			fmt.Fprintf(w, "  -> %s\n", link)
+		}
+	}
+	failed := make([]string, 0, len(result.Errors))
+	for page := range result.Errors {
+		failed = append(failed, page)
+	}
+	sort.Strings(failed)
+	for _, page := range failed {
+		fmt.Fprintf(w, "Failed: %v\n", result.Errors[page])
+	}
+	fmt.Fprintf(w, "Fetched %d pages, %d failed\n", len(result.Links), len(result.Errors))
+}
@@ -0,0 +1,61 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 08 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson08
+package exercises
+
+import "sync"
+
+// Exercise 1: Generate returns a channel that yields 1..n and is then
+// closed. Send from a goroutine so Generate returns straight away.
+//
+//golab:require go
+func Generate(n int) <-chan int {
+	// TODO: make a channel, start a goroutine that sends and closes it
+	return nil
+}
+
+// Exercise 2: ParallelSum adds nums using the given number of goroutines,
+// each summing its own part of the slice. Use a sync.WaitGroup, or a
+// channel of partial sums.
+//
+//golab:require go
+//golab:require no-globals
+func ParallelSum(nums []int, workers int) int {
+	// TODO: split nums into workers chunks and combine the results
+	return 0
+}
+
+// Exercise 3: Merge forwards every value from all input channels to one
+// output channel, which is closed once every input is closed.
+//
+//golab:require go
+//golab:require uses sync.WaitGroup
+func Merge(inputs ...<-chan int) <-chan int {
+	// TODO: one goroutine per input, plus one that closes the output
+	// after a WaitGroup says they are all done
+	return nil
+}
+
+// Counter is safe to use from many goroutines at once
+type Counter struct {
+	mu    sync.Mutex
+	value int
+}
+
+// Exercise 4: Inc adds one to the counter while holding the lock.
+//
+//golab:require calls (*sync.Mutex).Lock
+func (c *Counter) Inc() {
+	// TODO: lock, increment, unlock (defer helps)
+}
+
+// Value is also part of exercise 4: read the count under the same lock.
+//
+//golab:require calls (*sync.Mutex).Lock
+func (c *Counter) Value() int {
+	// TODO: lock before reading
+	return 0
+}
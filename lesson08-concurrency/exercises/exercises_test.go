@@ -0,0 +1,83 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect drains ch, failing instead of hanging if it is never closed
+func collect(t *testing.T, ch <-chan int) []int {
+	t.Helper()
+	if ch == nil {
+		t.Fatal("got a nil channel")
+	}
+	var values []int
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return values
+			}
+			values = append(values, v)
+		case <-timeout:
+			t.Fatalf("channel not closed after 2s; received %v so far", values)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	if got, want := collect(t, Generate(5)), []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Generate(5) yielded %v; want %v", got, want)
+	}
+	if got := collect(t, Generate(0)); len(got) != 0 {
+		t.Errorf("Generate(0) yielded %v; want nothing", got)
+	}
+}
+
+func TestParallelSum(t *testing.T) {
+	nums := make([]int, 1000)
+	for i := range nums {
+		nums[i] = i + 1
+	}
+	for _, workers := range []int{1, 3, 8, 2000} {
+		if got := ParallelSum(nums, workers); got != 500500 {
+			t.Errorf("ParallelSum(1..1000, %d workers) = %d; want 500500", workers, got)
+		}
+	}
+	if got := ParallelSum(nil, 4); got != 0 {
+		t.Errorf("ParallelSum(nil, 4) = %d; want 0", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := collect(t, Merge(Generate(3), Generate(2), Generate(0)))
+	sort.Ints(got)
+	if want := []int{1, 1, 2, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge yielded %v; want %v in any order", got, want)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	var counter Counter
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				counter.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := counter.Value(); got != 10000 {
+		t.Errorf("after 100 goroutines x 100 Inc, Value() = %d; want 10000", got)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build solution
+
+// Reference solutions for the Lesson 08 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+import "sync"
+
+//golab:require go
+func Generate(n int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := 1; i <= n; i++ {
+			out <- i
+		}
+	}()
+	return out
+}
+
+//golab:require go
+//golab:require no-globals
+func ParallelSum(nums []int, workers int) int {
+	if workers < 1 {
+		workers = 1
+	}
+	chunk := (len(nums) + workers - 1) / workers
+	if chunk == 0 {
+		return 0
+	}
+	partials := make(chan int, workers)
+	var wg sync.WaitGroup
+	for start := 0; start < len(nums); start += chunk {
+		end := start + chunk
+		if end > len(nums) {
+			end = len(nums)
+		}
+		wg.Add(1)
+		go func(part []int) {
+			defer wg.Done()
+			sum := 0
+			for _, n := range part {
+				sum += n
+			}
+			partials <- sum
+		}(nums[start:end])
+	}
+	wg.Wait()
+	close(partials)
+	total := 0
+	for p := range partials {
+		total += p
+	}
+	return total
+}
+
+//golab:require go
+//golab:require uses sync.WaitGroup
+func Merge(inputs ...<-chan int) <-chan int {
+	out := make(chan int)
+	var wg sync.WaitGroup
+	for _, in := range inputs {
+		wg.Add(1)
+		go func(in <-chan int) {
+			defer wg.Done()
+			for v := range in {
+				out <- v
+			}
+		}(in)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+type Counter struct {
+	mu    sync.Mutex
+	value int
+}
+
+//golab:require calls (*sync.Mutex).Lock
+func (c *Counter) Inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value++
+}
+
+//golab:require calls (*sync.Mutex).Lock
+func (c *Counter) Value() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
@@ -0,0 +1,155 @@
+package lesson08
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+	"testing/fstest"
+)
+
+// HashResult is one file's SHA-256, or why it couldn't be read
+type HashResult struct {
+	Path string
+	Size int64
+	Sum  string // hex-encoded
+	Err  error
+}
+
+// HashFS hashes every regular file in fsys with a pool of workers and
+// sends each result as soon as it's ready, in whatever order the workers
+// finish. One goroutine walks the tree and feeds paths to the workers;
+// the channel is closed when they're all done, or soon after ctx is
+// cancelled. Pass os.DirFS(dir) to hash a directory on disk.
+func HashFS(ctx context.Context, fsys fs.FS, workers int) <-chan HashResult {
+	workers = max(workers, 1)
+	paths := make(chan string)
+	results := make(chan HashResult)
+	send := func(r HashResult) bool {
+		select {
+		case results <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(paths) // so the workers' range loops end
+		err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Report it and carry on with the rest of the tree
+				if !send(HashResult{Path: path, Err: err}) {
+					return ctx.Err()
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		// The walk only stops early when ctx is cancelled, and then
+		// nobody is listening
+		if err != nil && ctx.Err() == nil {
+			send(HashResult{Path: ".", Err: err})
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if !send(hashFile(fsys, path)) {
+					return
+				}
+			}
+		}()
+	}
+
+	// Close results only once nothing can send on it any more
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+func hashFile(fsys fs.FS, path string) HashResult {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return HashResult{Path: path, Err: err}
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return HashResult{Path: path, Err: err}
+	}
+	return HashResult{Path: path, Size: n, Sum: hex.EncodeToString(h.Sum(nil))}
+}
+
+// FindDuplicates groups the files with identical contents: each group
+// is sorted, and groups are in order of their first path. Files that
+// couldn't be hashed are left out.
+func FindDuplicates(results []HashResult) [][]string {
+	bySum := make(map[string][]string)
+	for _, r := range results {
+		if r.Err == nil {
+			bySum[r.Sum] = append(bySum[r.Sum], r.Path)
+		}
+	}
+	var groups [][]string
+	for _, paths := range bySum {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			groups = append(groups, paths)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+// sampleFiles is a small directory tree, in memory, for
+// demonstrateFileHashing to hash
+var sampleFiles = fstest.MapFS{
+	"README.md":               {Data: []byte("# Holiday photos\n")},
+	"notes/todo.txt":          {Data: []byte("book flights\npack\n")},
+	"notes/todo (copy).txt":   {Data: []byte("book flights\npack\n")},
+	"notes/packing.txt":       {Data: []byte("passport\ncharger\n")},
+	"photos/beach.jpg":        {Data: []byte("\xff\xd8\xff pretend this is a beach")},
+	"photos/sunset.jpg":       {Data: []byte("\xff\xd8\xff pretend this is a sunset")},
+	"backup/photos/beach.jpg": {Data: []byte("\xff\xd8\xff pretend this is a beach")},
+}
+
+func demonstrateFileHashing(w io.Writer) {
+	fmt.Fprintln(w, "Hashing every file with 3 workers, printing each as it finishes:")
+	var results []HashResult
+	for r := range HashFS(context.Background(), sampleFiles, 3) {
+		if r.Err != nil {
+			fmt.Fprintf(w, "  error: %v\n", r.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  %s  %s (%d bytes)\n", r.Sum[:12], r.Path, r.Size)
+		results = append(results, r)
+	}
+
+	fmt.Fprintf(w, "Hashed %d files. Duplicates:\n", len(results))
+	for _, group := range FindDuplicates(results) {
+		fmt.Fprintf(w, "  %v\n", group)
+	}
+}
@@ -0,0 +1,268 @@
+package lesson08
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/golden"
+)
+
+// The other demonstrations print in whatever order the scheduler runs
+// their goroutines, so only these have golden files. Each one is ordered
+// by channels (and, for select, generous sleeps); the concurrent tasks'
+// lines are sorted, and deterministic mode rounds their timings.
+func TestDemonstrations(t *testing.T) {
+	tests := []struct {
+		golden    string
+		demo      func(io.Writer)
+		scrubbers []golden.Scrubber
+	}{
+		{"basic_goroutines.golden", demonstrateBasicGoroutines, []golden.Scrubber{sortConcurrentTasks}},
+		{"channels.golden", demonstrateChannels, nil},
+		{"channel_directions.golden", demonstrateChannelDirections, nil},
+		{"select.golden", demonstrateSelect, nil},
+		{"file_hashing.golden", demonstrateFileHashing, []golden.Scrubber{sortHashes}},
+		{"crawler.golden", demonstrateCrawler, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.golden, func(t *testing.T) {
+			t.Parallel()
+			golden.Demo(t, tt.golden, tt.demo, tt.scrubbers...)
+		})
+	}
+}
+
+// sortConcurrentTasks sorts the Starting and the Completed lines of the
+// three concurrent tasks, which start and finish in any order
+func sortConcurrentTasks(s string) string {
+	lines := strings.Split(s, "\n")
+	for _, prefix := range []string{"Starting concurrent-task-", "Completed concurrent-task-"} {
+		var at []int
+		var found []string
+		for i, line := range lines {
+			if strings.HasPrefix(line, prefix) {
+				at = append(at, i)
+				found = append(found, line)
+			}
+		}
+		sort.Strings(found)
+		for i, line := range at {
+			lines[line] = found[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sortHashes sorts the hashed files' lines, which print in the order the
+// workers finish
+func sortHashes(s string) string {
+	lines := strings.Split(s, "\n")
+	var at []int
+	var found []string
+	for i, line := range lines {
+		if strings.HasSuffix(line, " bytes)") {
+			at = append(at, i)
+			found = append(found, line)
+		}
+	}
+	sort.Strings(found)
+	for i, line := range at {
+		lines[line] = found[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestHashFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":      {Data: []byte("hello\n")},
+		"dir/b.txt":  {Data: []byte("hello\n")},
+		"dir/c.txt":  {Data: []byte("")},
+		"dir/sub/d":  {Data: []byte("other")},
+		"link":       {Data: []byte("a.txt"), Mode: fs.ModeSymlink},
+		"dir/sub/e":  {Data: []byte("other")},
+		"dir/empty":  {Mode: fs.ModeDir},
+		"z/last.bin": {Data: bytes.Repeat([]byte{1}, 100000)},
+	}
+	for _, workers := range []int{0, 1, 4, 100} {
+		var results []HashResult
+		for r := range HashFS(context.Background(), fsys, workers) {
+			if r.Err != nil {
+				t.Fatalf("%d workers: %v", workers, r.Err)
+			}
+			results = append(results, r)
+		}
+		if len(results) != 6 {
+			t.Errorf("%d workers hashed %d files, want the 6 regular ones", workers, len(results))
+		}
+		for _, r := range results {
+			if r.Path == "a.txt" && r.Sum != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+				t.Errorf("sha256(a.txt) = %s", r.Sum)
+			}
+		}
+		want := [][]string{{"a.txt", "dir/b.txt"}, {"dir/sub/d", "dir/sub/e"}}
+		if got := FindDuplicates(results); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: duplicates = %q, want %q", workers, got, want)
+		}
+	}
+}
+
+// TestHashFSCancelled stops reading results early; cancelling the
+// context has to let every goroutine exit, or the channel never closes
+func TestHashFSCancelled(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	for i := 0; i < 100; i++ {
+		fsys[fmt.Sprintf("f%03d", i)] = &fstest.MapFile{Data: []byte{byte(i)}}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	results := HashFS(ctx, fsys, 4)
+	<-results
+	cancel()
+	for range results {
+	}
+}
+
+// BenchmarkHashFS hashes 64 files of 64KB with 1 to 8 workers. Hashing
+// is CPU-bound, so workers beyond the number of CPUs stop helping; compare
+// them with go run ./tasks bench ./lesson08-concurrency
+func BenchmarkHashFS(b *testing.B) {
+	fsys := make(fstest.MapFS)
+	data := bytes.Repeat([]byte("golang-lab"), 64<<10/10)
+	for i := 0; i < 64; i++ {
+		fsys[fmt.Sprintf("dir%d/file%d", i%8, i)] = &fstest.MapFile{Data: data}
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(64 * len(data)))
+			for i := 0; i < b.N; i++ {
+				for r := range HashFS(context.Background(), fsys, workers) {
+					if r.Err != nil {
+						b.Fatal(r.Err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	web := fakeWeb{pages: map[string][]string{
+		"http://a/":  {"http://a/1", "http://b/"},
+		"http://a/1": {"http://a/", "http://a/2"},
+		"http://b/":  {"http://a/1", "http://b/missing"},
+		"http://a/2": {"http://a/3"},
+	}}
+	tests := []struct {
+		depth  int
+		pages  int
+		failed int
+	}{
+		{depth: 0, pages: 0},
+		{depth: 1, pages: 1},
+		{depth: 2, pages: 3},
+		{depth: 3, pages: 4, failed: 1},
+		{depth: 10, pages: 4, failed: 2},
+	}
+	for _, tt := range tests {
+		result, err := Crawl(context.Background(), web, "http://a/", tt.depth, CrawlOptions{Workers: 2})
+		if err != nil {
+			t.Fatalf("depth %d: %v", tt.depth, err)
+		}
+		if len(result.Links) != tt.pages || len(result.Errors) != tt.failed {
+			t.Errorf("depth %d fetched %d pages with %d failures, want %d and %d",
+				tt.depth, len(result.Links), len(result.Errors), tt.pages, tt.failed)
+		}
+		for page, err := range result.Errors {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("depth %d: %s failed with %v, want ErrNotFound", tt.depth, page, err)
+			}
+		}
+	}
+}
+
+func TestCrawlCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := Crawl(ctx, sampleWeb, "https://go.dev/", 3, CrawlOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Crawl = %v, want context.Canceled", err)
+	}
+	if len(result.Links)+len(result.Errors) != 0 {
+		t.Errorf("a cancelled crawl recorded %d pages and %d errors", len(result.Links), len(result.Errors))
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := newHostLimiter(time.Second, fake)
+	ctx := context.Background()
+
+	// The first request to each host goes straight away
+	if err := limiter.Wait(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second to a has to wait out the interval
+	done := make(chan error)
+	go func() { done <- limiter.Wait(ctx, "a") }()
+	fake.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("second request to a went before the interval passed")
+	default:
+	}
+	fake.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling the context stops the wait
+	ctx, cancel := context.WithCancel(ctx)
+	go func() { done <- limiter.Wait(ctx, "a") }()
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Wait = %v, want context.Canceled", err)
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="/docs">Docs</a> <a class="x" href="https://example.com/">Out</a>
+			<a href="/docs">Again</a> <a href="#top">Top</a> <a href="mailto:me@example.com">Mail</a>`)
+	})
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	links, err := HTTPFetcher{Client: server.Client()}.Fetch(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/docs", "https://example.com/"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("links = %q, want %q", links, want)
+	}
+	if _, err := (HTTPFetcher{Client: server.Client()}).Fetch(context.Background(), server.URL+"/docs"); err == nil {
+		t.Error("fetching a 404 page succeeded")
+	}
+}
@@ -1,84 +1,105 @@
 // Lesson 08: Concurrency with Goroutines and Channels
 // This lesson covers Go's concurrency primitives and patterns
 
-package main
+package lesson08
 
 import (
 	"fmt"
-	"math/rand"
+	"io"
+	"os"
 	"sync"
 	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
 )
 
-func main() {
-	fmt.Println("=== Lesson 08: Concurrency with Goroutines and Channels ===")
+// clk is where the lesson gets the time; tests can swap in a clock.Fake
+var clk clock.Clock = clock.Real{}
+
+// Run is the lesson's entry point; cmd/lesson08 calls it
+func Run() {
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 08: Concurrency with Goroutines and Channels ===")
 	
 	// Basic goroutines
-	fmt.Println("\n--- Basic Goroutines ---")
-	demonstrateBasicGoroutines()
+	fmt.Fprintln(w, "\n--- Basic Goroutines ---")
+	demonstrateBasicGoroutines(w)
 	
 	// Channels
-	fmt.Println("\n--- Channels ---")
-	demonstrateChannels()
+	fmt.Fprintln(w, "\n--- Channels ---")
+	demonstrateChannels(w)
 	
 	// Channel directions
-	fmt.Println("\n--- Channel Directions ---")
-	demonstrateChannelDirections()
+	fmt.Fprintln(w, "\n--- Channel Directions ---")
+	demonstrateChannelDirections(w)
 	
 	// Select statement
-	fmt.Println("\n--- Select Statement ---")
-	demonstrateSelect()
+	fmt.Fprintln(w, "\n--- Select Statement ---")
+	demonstrateSelect(w)
 	
 	// Worker pools
-	fmt.Println("\n--- Worker Pools ---")
-	demonstrateWorkerPool()
+	fmt.Fprintln(w, "\n--- Worker Pools ---")
+	demonstrateWorkerPool(w)
 	
 	// Synchronization primitives
-	fmt.Println("\n--- Synchronization Primitives ---")
-	demonstrateSynchronization()
+	fmt.Fprintln(w, "\n--- Synchronization Primitives ---")
+	demonstrateSynchronization(w)
 	
 	// Context for cancellation
-	fmt.Println("\n--- Context and Cancellation ---")
-	demonstrateContext()
+	fmt.Fprintln(w, "\n--- Context and Cancellation ---")
+	demonstrateContext(w)
+	
+	// A worker pool over a directory tree
+	fmt.Fprintln(w, "\n--- Parallel File Hashing ---")
+	demonstrateFileHashing(w)
+	
+	// Everything together: a concurrent web crawler
+	fmt.Fprintln(w, "\n--- Web Crawler ---")
+	demonstrateCrawler(w)
 }
 
-func demonstrateBasicGoroutines() {
+func demonstrateBasicGoroutines(w io.Writer) {
 	// Sequential execution
-	fmt.Println("Sequential execution:")
-	start := time.Now()
+	fmt.Fprintln(w, "Sequential execution:")
+	start := clk.Now()
 	for i := 0; i < 3; i++ {
-		slowTask(fmt.Sprintf("task-%d", i))
+		slowTask(w, fmt.Sprintf("task-%d", i))
 	}
-	fmt.Printf("Sequential took: %v\n", time.Since(start))
+	fmt.Fprintf(w, "Sequential took: %v\n", demo.Elapsed(clk.Since(start)))
 	
 	// Concurrent execution with goroutines
-	fmt.Println("\nConcurrent execution:")
-	start = time.Now()
+	fmt.Fprintln(w, "\nConcurrent execution:")
+	start = clk.Now()
 	var wg sync.WaitGroup
 	
 	for i := 0; i < 3; i++ {
 		wg.Add(1)
 		go func(taskName string) {
 			defer wg.Done()
-			slowTask(taskName)
+			slowTask(w, taskName)
 		}(fmt.Sprintf("concurrent-task-%d", i))
 	}
 	
 	wg.Wait() // Wait for all goroutines to complete
-	fmt.Printf("Concurrent took: %v\n", time.Since(start))
+	fmt.Fprintf(w, "Concurrent took: %v\n", demo.Elapsed(clk.Since(start)))
 	
 	// Anonymous goroutine
 	go func() {
-		fmt.Println("Anonymous goroutine executed")
+		fmt.Fprintln(w, "Anonymous goroutine executed")
 	}()
 	
 	// Give goroutine time to execute
-	time.Sleep(100 * time.Millisecond)
+	clk.Sleep(100 * time.Millisecond)
 }
 
-func demonstrateChannels() {
+func demonstrateChannels(w io.Writer) {
 	// Unbuffered channel
-	fmt.Println("Unbuffered channel:")
+	fmt.Fprintln(w, "Unbuffered channel:")
 	ch := make(chan string)
 	
 	// Send in a goroutine (prevents blocking)
@@ -88,10 +109,10 @@ func demonstrateChannels() {
 	
 	// Receive from channel
 	message := <-ch
-	fmt.Printf("Received: %s\n", message)
+	fmt.Fprintf(w, "Received: %s\n", message)
 	
 	// Buffered channel
-	fmt.Println("\nBuffered channel:")
+	fmt.Fprintln(w, "\nBuffered channel:")
 	bufferedCh := make(chan int, 3)
 	
 	// Can send without blocking (up to buffer size)
@@ -99,16 +120,16 @@ func demonstrateChannels() {
 	bufferedCh <- 2
 	bufferedCh <- 3
 	
-	fmt.Println("Sent 3 values to buffered channel")
+	fmt.Fprintln(w, "Sent 3 values to buffered channel")
 	
 	// Receive values
 	for i := 0; i < 3; i++ {
 		value := <-bufferedCh
-		fmt.Printf("Received: %d\n", value)
+		fmt.Fprintf(w, "Received: %d\n", value)
 	}
 	
 	// Channel with range and close
-	fmt.Println("\nChannel with range:")
+	fmt.Fprintln(w, "\nChannel with range:")
 	numberCh := make(chan int, 5)
 	
 	// Send numbers in a goroutine
@@ -121,40 +142,40 @@ func demonstrateChannels() {
 	
 	// Range over channel (stops when closed)
 	for num := range numberCh {
-		fmt.Printf("Square: %d\n", num)
+		fmt.Fprintf(w, "Square: %d\n", num)
 	}
 }
 
-func demonstrateChannelDirections() {
+func demonstrateChannelDirections(w io.Writer) {
 	// Channel directions for function parameters
 	ch := make(chan string, 1)
 	
 	// Start producer and consumer
 	go producer(ch) // Send-only channel in function
-	go consumer(ch) // Receive-only channel in function
+	go consumer(w, ch) // Receive-only channel in function
 	
-	time.Sleep(2 * time.Second)
+	clk.Sleep(2 * time.Second)
 	
 	// Pipeline pattern
-	fmt.Println("\nPipeline pattern:")
+	fmt.Fprintln(w, "\nPipeline pattern:")
 	numbers := generateNumbers(5)
 	squares := squareNumbers(numbers)
-	printNumbers(squares)
+	printNumbers(w, squares)
 }
 
 // Send-only channel parameter
 func producer(ch chan<- string) {
 	for i := 0; i < 3; i++ {
 		ch <- fmt.Sprintf("Message %d", i+1)
-		time.Sleep(500 * time.Millisecond)
+		clk.Sleep(500 * time.Millisecond)
 	}
 	close(ch)
 }
 
 // Receive-only channel parameter
-func consumer(ch <-chan string) {
+func consumer(w io.Writer, ch <-chan string) {
 	for msg := range ch {
-		fmt.Printf("Consumed: %s\n", msg)
+		fmt.Fprintf(w, "Consumed: %s\n", msg)
 	}
 }
 
@@ -181,63 +202,63 @@ func squareNumbers(input <-chan int) <-chan int {
 	return ch
 }
 
-func printNumbers(input <-chan int) {
+func printNumbers(w io.Writer, input <-chan int) {
 	for num := range input {
-		fmt.Printf("Pipeline result: %d\n", num)
+		fmt.Fprintf(w, "Pipeline result: %d\n", num)
 	}
 }
 
-func demonstrateSelect() {
+func demonstrateSelect(w io.Writer) {
 	// Select with multiple channels
 	ch1 := make(chan string, 1)
 	ch2 := make(chan string, 1)
 	
 	// Send to channels with different timing
 	go func() {
-		time.Sleep(1 * time.Second)
+		clk.Sleep(1 * time.Second)
 		ch1 <- "Channel 1"
 	}()
 	
 	go func() {
-		time.Sleep(500 * time.Millisecond)
+		clk.Sleep(500 * time.Millisecond)
 		ch2 <- "Channel 2"
 	}()
 	
 	// Select receives from whichever channel is ready first
 	select {
 	case msg1 := <-ch1:
-		fmt.Printf("Received from ch1: %s\n", msg1)
+		fmt.Fprintf(w, "Received from ch1: %s\n", msg1)
 	case msg2 := <-ch2:
-		fmt.Printf("Received from ch2: %s\n", msg2)
+		fmt.Fprintf(w, "Received from ch2: %s\n", msg2)
 	}
 	
 	// Select with timeout
-	timeout := time.After(2 * time.Second)
+	timeout := clk.After(2 * time.Second)
 	select {
 	case msg := <-ch1:
-		fmt.Printf("Received: %s\n", msg)
+		fmt.Fprintf(w, "Received: %s\n", msg)
 	case <-timeout:
-		fmt.Println("Timeout occurred")
+		fmt.Fprintln(w, "Timeout occurred")
 	}
 	
 	// Non-blocking select with default
 	select {
 	case msg := <-ch1:
-		fmt.Printf("Received: %s\n", msg)
+		fmt.Fprintf(w, "Received: %s\n", msg)
 	default:
-		fmt.Println("No message available")
+		fmt.Fprintln(w, "No message available")
 	}
 }
 
-func demonstrateWorkerPool() {
+func demonstrateWorkerPool(w io.Writer) {
 	// Create job and result channels
 	jobs := make(chan int, 100)
 	results := make(chan int, 100)
 	
 	// Start workers
 	numWorkers := 3
-	for w := 1; w <= numWorkers; w++ {
-		go worker(w, jobs, results)
+	for id := 1; id <= numWorkers; id++ {
+		go worker(w, id, jobs, results)
 	}
 	
 	// Send jobs
@@ -250,25 +271,25 @@ func demonstrateWorkerPool() {
 	// Collect results
 	for r := 1; r <= numJobs; r++ {
 		result := <-results
-		fmt.Printf("Result: %d\n", result)
+		fmt.Fprintf(w, "Result: %d\n", result)
 	}
 }
 
-func worker(id int, jobs <-chan int, results chan<- int) {
+func worker(w io.Writer, id int, jobs <-chan int, results chan<- int) {
 	for job := range jobs {
-		fmt.Printf("Worker %d processing job %d\n", id, job)
+		fmt.Fprintf(w, "Worker %d processing job %d\n", id, job)
 		
-		// Simulate work
-		time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
+		// Simulate work that takes up to a second
+		clk.Sleep(demo.Jitter(time.Second))
 		
 		// Send result
 		results <- job * 2
 	}
 }
 
-func demonstrateSynchronization() {
+func demonstrateSynchronization(w io.Writer) {
 	// Mutex for protecting shared data
-	fmt.Println("Mutex example:")
+	fmt.Fprintln(w, "Mutex example:")
 	counter := &SafeCounter{}
 	var wg sync.WaitGroup
 	
@@ -280,18 +301,18 @@ func demonstrateSynchronization() {
 			for j := 0; j < 100; j++ {
 				counter.Increment()
 			}
-			fmt.Printf("Goroutine %d finished\n", n)
+			fmt.Fprintf(w, "Goroutine %d finished\n", n)
 		}(i)
 	}
 	
 	wg.Wait()
-	fmt.Printf("Final counter value: %d\n", counter.Value())
+	fmt.Fprintf(w, "Final counter value: %d\n", counter.Value())
 	
 	// Once example
-	fmt.Println("\nOnce example:")
+	fmt.Fprintln(w, "\nOnce example:")
 	var once sync.Once
 	initFunction := func() {
-		fmt.Println("This will only be printed once!")
+		fmt.Fprintln(w, "This will only be printed once!")
 	}
 	
 	// Call multiple times, but function executes only once
@@ -300,7 +321,7 @@ func demonstrateSynchronization() {
 	}
 	
 	// RWMutex example
-	fmt.Println("\nRWMutex example:")
+	fmt.Fprintln(w, "\nRWMutex example:")
 	data := &SafeData{data: make(map[string]string)}
 	
 	// Multiple readers
@@ -308,8 +329,8 @@ func demonstrateSynchronization() {
 		go func(id int) {
 			for j := 0; j < 3; j++ {
 				value := data.Read("key")
-				fmt.Printf("Reader %d read: %s\n", id, value)
-				time.Sleep(100 * time.Millisecond)
+				fmt.Fprintf(w, "Reader %d read: %s\n", id, value)
+				clk.Sleep(100 * time.Millisecond)
 			}
 		}(i)
 	}
@@ -317,12 +338,12 @@ func demonstrateSynchronization() {
 	// One writer
 	go func() {
 		for i := 0; i < 3; i++ {
-			data.Write("key", fmt.Sprintf("value-%d", i))
-			time.Sleep(200 * time.Millisecond)
+			data.Write(w, "key", fmt.Sprintf("value-%d", i))
+			clk.Sleep(200 * time.Millisecond)
 		}
 	}()
 	
-	time.Sleep(2 * time.Second)
+	clk.Sleep(2 * time.Second)
 }
 
 // Thread-safe counter using mutex
@@ -355,16 +376,16 @@ func (d *SafeData) Read(key string) string {
 	return d.data[key]
 }
 
-func (d *SafeData) Write(key, value string) {
+func (d *SafeData) Write(w io.Writer, key, value string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.data[key] = value
-	fmt.Printf("Wrote %s=%s\n", key, value)
+	fmt.Fprintf(w, "Wrote %s=%s\n", key, value)
 }
 
-func demonstrateContext() {
+func demonstrateContext(w io.Writer) {
 	// Context with cancellation
-	fmt.Println("Context with cancellation:")
+	fmt.Fprintln(w, "Context with cancellation:")
 	
 	// This is a simplified example - in real code you'd import "context"
 	// For this lesson, we'll simulate context behavior with channels
@@ -379,29 +400,29 @@ func demonstrateContext() {
 		for i := 0; i < 10; i++ {
 			select {
 			case <-cancel:
-				fmt.Println("Operation cancelled!")
+				fmt.Fprintln(w, "Operation cancelled!")
 				return
 			default:
-				fmt.Printf("Working... step %d\n", i+1)
-				time.Sleep(200 * time.Millisecond)
+				fmt.Fprintf(w, "Working... step %d\n", i+1)
+				clk.Sleep(200 * time.Millisecond)
 			}
 		}
-		fmt.Println("Operation completed!")
+		fmt.Fprintln(w, "Operation completed!")
 	}()
 	
 	// Cancel after 1 second
 	go func() {
-		time.Sleep(1 * time.Second)
+		clk.Sleep(1 * time.Second)
 		close(cancel)
 	}()
 	
 	<-done
-	fmt.Println("Context demonstration finished")
+	fmt.Fprintln(w, "Context demonstration finished")
 }
 
 // Helper function that simulates slow work
-func slowTask(name string) {
-	fmt.Printf("Starting %s\n", name)
-	time.Sleep(1 * time.Second)
-	fmt.Printf("Completed %s\n", name)
+func slowTask(w io.Writer, name string) {
+	fmt.Fprintf(w, "Starting %s\n", name)
+	clk.Sleep(1 * time.Second)
+	fmt.Fprintf(w, "Completed %s\n", name)
 }
\ No newline at end of file
@@ -0,0 +1,114 @@
+package lesson09
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/httpmw"
+)
+
+// The admin area is a group of routes behind the same middleware:
+// they're registered on a ServeMux of their own, and the lesson's mux
+// sends everything under /admin to it through httpmw.BasicAuth. A route
+// added to the group later is protected without anyone remembering to.
+
+// adminUser is the user name /admin asks for
+const adminUser = "admin"
+
+// adminRealm names the admin area in the browser's login prompt
+const adminRealm = "Lesson 09 admin"
+
+// adminPassword is the password /admin asks for: -admin-password, or a
+// random one each start, which Run prints
+var adminPassword = newAdminPassword()
+
+func newAdminPassword() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// started is when the server started, for the admin page's uptime
+var started = clk.Now()
+
+// adminRoutes returns the admin area's handler, with every route behind
+// Basic auth as adminUser with adminPassword, and every POST needing the
+// CSRF token too: the browser sends the Basic auth by itself, even with
+// a form on another site
+func adminRoutes() http.Handler {
+	admin := http.NewServeMux()
+	admin.HandleFunc("GET /admin", adminHandler)
+	admin.Handle("GET /admin/{$}", http.RedirectHandler("/admin", http.StatusFound))
+	// A form can only send GET or POST, so deleting is a POST to its own URL
+	admin.HandleFunc("POST /admin/users/{id}/delete", adminDeleteUserHandler)
+	return httpmw.Chain(admin, httpmw.BasicAuth(adminRealm, adminUser, adminPassword), csrfProtect)
+}
+
+// adminPage is the data for templates/admin.html
+type adminPage struct {
+	layoutData
+	Flash string
+	Stats []adminStat
+	Users []domain.User
+}
+
+// adminStat is one line of the admin page's server stats
+type adminStat struct {
+	Name, Value string
+}
+
+// GET /admin shows how the server is doing, and the users, each with a
+// button to delete them
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	files, err := listUploads(uploadDir)
+	if err != nil {
+		log.Printf("Listing uploads: %v", err)
+	}
+	var uploaded int64
+	for _, f := range files {
+		uploaded += f.Size
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	render(w, "admin.html", adminPage{
+		layoutData: layoutFor(w, r),
+		Flash:      popFlash(w, r),
+		Stats: []adminStat{
+			{"Uptime", clk.Now().Sub(started).Round(time.Second).String()},
+			{"Users", strconv.Itoa(userCount())},
+			{"Sessions", strconv.Itoa(sessions.Len())},
+			{"Uploads", fmt.Sprintf("%s, %s", pluralize(len(files), "file", "files"), formatSize(uploaded))},
+			{"Goroutines", strconv.Itoa(runtime.NumGoroutine())},
+			{"Heap in use", formatSize(int64(mem.HeapInuse))},
+			{"Go version", runtime.Version()},
+		},
+		Users: sortedUsers(),
+	})
+}
+
+// POST /admin/users/{id}/delete deletes a user, then goes back to the
+// admin page, which says so
+func adminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	user, exists := deleteUser(id)
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	sessions.Update(w, r, func(s *Session) { s.Flash = fmt.Sprintf("Deleted %s.", user.Name) })
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
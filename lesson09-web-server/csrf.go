@@ -0,0 +1,140 @@
+package lesson09
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// Cross-site request forgery: a page on another site can hold a form that
+// posts to this one, and the browser sends this site's cookies, and Basic
+// auth, along with it. Without a check, a visitor who opens that page
+// deletes a user from /admin, or gets logged in as the attacker, without
+// knowing.
+//
+// The check is a token only this site's pages know. Each session gets a
+// random one; every form carries it back in a hidden field, from
+// csrfField, and csrfProtect turns away any POST whose token isn't its
+// session's. The other site can make the browser send the cookie, but it
+// can't read this site's pages to find out the token.
+
+const (
+	// csrfFieldName is the form field csrfField adds
+	csrfFieldName = "csrf_token"
+	// csrfHeader carries the token instead, for requests made by a
+	// script, like fetch or XMLHttpRequest
+	csrfHeader = "X-CSRF-Token"
+	// maxCSRFPart is as much of a multipart body as csrfProtect reads
+	// looking for the token
+	maxCSRFPart = 8 << 10
+)
+
+// csrfToken returns r's session's CSRF token, starting a session with
+// one if r hasn't got one. Handlers pass it to a page for csrfField.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if token := sessionFrom(r.Context()).CSRFToken; token != "" {
+		return token
+	}
+	session := sessions.Update(w, r, func(s *Session) {
+		if s.CSRFToken == "" {
+			s.CSRFToken = newCSRFToken()
+		}
+	})
+	return session.CSRFToken
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// csrfField is the hidden form field that carries token back with the
+// form. The token is escaped, so an odd one can't break out of the
+// attribute. Put it first in the form: csrfProtect only looks at a
+// multipart form's first field.
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// csrfProtect is the middleware that turns away, with a 403, requests
+// that could change something (anything but GET, HEAD, OPTIONS and
+// TRACE) without their session's CSRF token. It wraps the routes forms
+// post to, rather than the whole server, so a route that doesn't exist
+// still gets its 404 or 405, and /admin's Basic auth its 401 first; the
+// session comes from sessions.Middleware, which wraps the whole server.
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		want := sessionFrom(r.Context()).CSRFToken
+		got, err := requestCSRFToken(r)
+		if err != nil || want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			http.Error(w, "Forbidden: the form's CSRF token is missing or out of date. Go back, reload the page, and try again.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestCSRFToken finds the token r sent: in the X-CSRF-Token header,
+// or in the csrf_token field of a form
+func requestCSRFToken(r *http.Request) (string, error) {
+	if token := r.Header.Get(csrfHeader); token != "" {
+		return token, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		// The handler's own ParseForm finds it done already
+		if err := r.ParseForm(); err != nil {
+			return "", err
+		}
+		return r.PostForm.Get(csrfFieldName), nil
+	case "multipart/form-data":
+		return firstPartCSRFToken(r, params["boundary"])
+	}
+	return "", errors.New("no CSRF token")
+}
+
+// firstPartCSRFToken reads the token from a multipart form's first
+// field, then puts back what it read, so the handler still gets the
+// whole body to stream through r.MultipartReader. Reading the form
+// with ParseMultipartForm instead would mean reading, and keeping, an
+// upload before knowing whether it's to be turned away.
+func firstPartCSRFToken(r *http.Request, boundary string) (string, error) {
+	var read bytes.Buffer
+	parts := multipart.NewReader(io.TeeReader(io.LimitReader(r.Body, maxCSRFPart), &read), boundary)
+	// Whatever happens, the handler gets the body as it came
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&read, r.Body), r.Body}
+	}()
+	part, err := parts.NextPart()
+	if err != nil {
+		return "", err
+	}
+	if part.FormName() != csrfFieldName {
+		return "", errors.New("the CSRF token isn't the form's first field")
+	}
+	token, err := io.ReadAll(part)
+	return string(token), err
+}
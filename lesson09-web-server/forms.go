@@ -0,0 +1,95 @@
+package lesson09
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang-lab/lab/domain"
+)
+
+// The form at /form shows the usual way to take input from a browser,
+// Post/Redirect/Get:
+//
+//	GET  /form         the empty form
+//	POST /form         invalid: 422 and the form again, with each field's
+//	                   error next to it and what was typed still in it
+//	                   valid: the user is created, then 303 See Other to...
+//	GET  /users/{id}   ...the new user's page
+//
+// The redirect is what makes it safe to reload the page you land on, or
+// to go back to it: the browser repeats the GET, not the POST that
+// created the user, so there's no "Confirm form resubmission" and no
+// second user.
+
+// maxNameLength is the longest name the form takes, in characters
+const maxNameLength = 100
+
+// formPage is the data for templates/form.html
+type formPage struct {
+	layoutData
+	Name   string // what was typed, so a form with errors needn't be retyped
+	Email  string
+	Errors map[string]string // by field name; empty when the form is new
+}
+
+// GET /form
+func formHandler(w http.ResponseWriter, r *http.Request) {
+	render(w, "form.html", formPage{layoutData: layoutFor(w, r)})
+}
+
+// POST /form creates a user from the form, or shows the form again with
+// what's wrong. The browser's required and type="email" checks are only
+// a convenience, since anything can send a POST; these are the ones
+// that count.
+func formSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.PostForm.Get("name"))
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	if errs := validateUserForm(name, email); len(errs) > 0 {
+		renderStatus(w, http.StatusUnprocessableEntity, "form.html", formPage{
+			layoutData: layoutFor(w, r), Name: name, Email: email, Errors: errs,
+		})
+		return
+	}
+
+	user := addUser(name, email)
+	// The new user's page says it was created, once; reloading it won't
+	sessions.Update(w, r, func(s *Session) { s.Flash = fmt.Sprintf("Created %s.", user.Name) })
+	http.Redirect(w, r, fmt.Sprintf("/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// validateUserForm returns the form's errors by field, with at most one
+// for each: the checks domain.CreateUserRequest makes for lesson 10's
+// API, then the ones only a form that stores users makes
+func validateUserForm(name, email string) map[string]string {
+	errs := make(map[string]string)
+	for _, e := range (domain.CreateUserRequest{Name: name, Email: email}).Validate() {
+		if _, ok := errs[e.Field]; !ok {
+			errs[e.Field] = e.Message
+		}
+	}
+	if _, ok := errs["name"]; !ok && utf8.RuneCountInString(name) > maxNameLength {
+		errs["name"] = fmt.Sprintf("Name must be at most %d characters", maxNameLength)
+	}
+	if _, ok := errs["email"]; !ok {
+		if _, taken := findUserByEmail(email); taken {
+			errs["email"] = "A user with that email already exists"
+		}
+	}
+	return errs
+}
+
+// popFlash returns r's session's flash message, and clears it so it's
+// shown only once. A visitor without one is left without a session.
+func popFlash(w http.ResponseWriter, r *http.Request) string {
+	flash := sessionFrom(r.Context()).Flash
+	if flash != "" {
+		sessions.Update(w, r, func(s *Session) { s.Flash = "" })
+	}
+	return flash
+}
@@ -0,0 +1,1465 @@
+package lesson09
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
+	"golang-lab/lab/golden"
+	"golang-lab/lab/httpmw"
+	"golang-lab/lab/smoke"
+	lesson10 "golang-lab/lesson10-json-rest-api/handlers"
+)
+
+// TestRoutes sends a fixed script of requests to the lesson's routes and
+// compares the responses with testdata/routes.golden
+func TestRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	requests := []struct{ method, target, form string }{
+		{"GET", "/hello", ""},
+		{"GET", "/hello?name=Gopher", ""},
+		{"POST", "/hello", ""},
+		{"GET", "/hello/Ada", ""},
+		{"GET", "/users", ""},
+		{"GET", "/users/2", ""},
+		{"GET", "/users/99", ""},
+		{"GET", "/users/abc", ""},
+		{"GET", "/users/2/extra", ""},
+		{"DELETE", "/users/2", ""},
+		{"GET", "/users/", ""},
+		{"POST", "/users", "name=Dana"},
+		{"POST", "/users", "name=Dana&email=dana%40example.com"},
+		{"GET", "/users/4", ""},
+		{"POST", "/users", "name=Dara+%22D%22+O%27Neill&email=dara%40example.com"},
+		{"GET", "/static/style.css", ""},
+		{"GET", "/missing", ""},
+	}
+
+	var transcript strings.Builder
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.form))
+		if req.form != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+
+		body := rec.Body.String()
+		if strings.HasPrefix(req.target, "/static/") {
+			body = fmt.Sprintf("(%d bytes)", len(body)) // just check it is served
+		}
+		fmt.Fprintf(&transcript, "%s %s\n%d %s\n%s\n\n", req.method, req.target,
+			rec.Code, rec.Header().Get("Content-Type"), strings.TrimSpace(body))
+	}
+	golden.Check(t, "routes.golden", transcript.String())
+}
+
+// TestSmoke makes sure -ci passes: every smoke step gets its status
+func TestSmoke(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	if err := smoke.Run(io.Discard, mux, smokeSteps); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestListenFreePort starts the real server the way -port 0 does and
+// reaches it at the URL the listener reports
+func TestListenFreePort(t *testing.T) {
+	listener, err := Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	server.ErrorLog = log.New(io.Discard, "", 0)
+	go server.Serve(listener)
+	defer server.Close()
+
+	resp, err := http.Get(URL(listener) + "/hello/Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "Hello, Port!") {
+		t.Errorf("GET /hello/Port = %d %q, want a greeting", resp.StatusCode, body)
+	}
+	if _, err := Listen(listener.Addr().(*net.TCPAddr).Port); err == nil {
+		t.Error("Listen on a port in use succeeded")
+	}
+}
+
+// startServing runs Serve on a free port with handler, and returns the
+// server's URL, a cancel that starts the shutdown, and Serve's result
+func startServing(t *testing.T, handler http.Handler) (string, context.CancelFunc, <-chan error) {
+	listener, err := Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: handler, ErrorLog: log.New(io.Discard, "", 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, server, listener) }()
+	return URL(listener), cancel, served
+}
+
+// TestServeDrains shuts down while a request is in flight: the request
+// still gets its answer, Serve waits for it, and then nobody else gets in
+func TestServeDrains(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	url, cancel, served := startServing(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		fmt.Fprint(w, "finished")
+	}))
+
+	answer := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			answer <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			answer <- err.Error()
+			return
+		}
+		answer <- string(body)
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned %v with a request still running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(finish)
+	if got := <-answer; got != "finished" {
+		t.Errorf("the request in flight got %q, want it finished", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve = %v, want nil after a clean shutdown", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("a new request succeeded after shutdown")
+	}
+}
+
+// TestServeTimeout shuts down with a request that outlasts
+// shutdownTimeout: Serve gives up on it and says so
+func TestServeTimeout(t *testing.T) {
+	defer func(d time.Duration) { shutdownTimeout = d }(shutdownTimeout)
+	shutdownTimeout = 20 * time.Millisecond
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	url, cancel, served := startServing(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	if err := <-served; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Serve = %v, want the shutdown deadline exceeded", err)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	at := time.Date(2024, 3, 5, 14, 30, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		layout string
+		t      time.Time
+		want   string
+	}{
+		{"2 Jan 2006", at, "5 Mar 2024"},
+		{time.RFC3339, at, "2024-03-05T13:30:00Z"}, // always in UTC
+		{"2 Jan 2006", time.Time{}, "never"},
+	}
+	for _, tt := range tests {
+		if got := formatDate(tt.layout, tt.t); got != tt.want {
+			t.Errorf("formatDate(%q, %v) = %q, want %q", tt.layout, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{10, "short", "short"},
+		{5, "exact", "exact"},
+		{8, "a longer sentence", "a longe…"},
+		{7, "cut at space", "cut at…"},
+		{4, "héllo wörld", "hél…"}, // counts characters, not bytes
+		{0, "anything", ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.n, tt.s); got != tt.want {
+			t.Errorf("truncate(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	for count, want := range map[int]string{0: "0 users", 1: "1 user", 2: "2 users"} {
+		if got := pluralize(count, "user", "users"); got != want {
+			t.Errorf("pluralize(%d) = %q, want %q", count, got, want)
+		}
+	}
+	if got := pluralize(3, "person", "people"); got != "3 people" {
+		t.Errorf("irregular plural = %q", got)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"**bold**, *italic* and `code`", "<p><strong>bold</strong>, <em>italic</em> and <code>code</code></p>\n"},
+		{"one\n\ntwo\nlines", "<p>one</p>\n<p>two<br>\nlines</p>\n"},
+		{"`a *literal* star`", "<p><code>a *literal* star</code></p>\n"},
+		{"[docs](https://go.dev/doc/?a=1&b=2)", "<p><a href=\"https://go.dev/doc/?a=1&amp;b=2\">docs</a></p>\n"},
+		{"[file](/static/x_*y*.css)", "<p><a href=\"/static/x_*y*.css\">file</a></p>\n"},
+		// Whatever the input, no HTML gets through
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"[click](javascript:alert`1`)", "<p>click</p>\n"},
+		{`[x](https://a/"onmouseover="alert(1))`, "<p><a href=\"https://a/&#34;onmouseover=&#34;alert(1\">x</a>)</p>\n"},
+		{"**<b>**", "<p><strong>&lt;b&gt;</strong></p>\n"},
+	}
+	for _, tt := range tests {
+		if got := string(markdown(tt.in)); got != tt.want {
+			t.Errorf("markdown(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	cookie, token := newCSRFSession(t)
+	if len(token) != 32 {
+		t.Fatalf("csrfToken = %q, want 32 hex digits", token)
+	}
+	// The session keeps it, so the next page's forms have the same one
+	r := httptest.NewRequest("GET", "/form", nil)
+	r.AddCookie(cookie)
+	if session, ok := sessions.lookup(r); !ok || session.CSRFToken != token {
+		t.Errorf("the session's token = %q, want %q", session.CSRFToken, token)
+	}
+	sessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := csrfToken(w, r); got != token || len(w.Header()["Set-Cookie"]) != 0 {
+			t.Errorf("csrfToken in the same session = %q, want %q and no new cookie", got, token)
+		}
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if _, other := newCSRFSession(t); other == token {
+		t.Error("two sessions got the same token")
+	}
+
+	want := `<input type="hidden" name="csrf_token" value="&#34;&gt;&lt;x">`
+	if got := string(csrfField(`"><x`)); got != want {
+		t.Errorf("csrfField = %s, want %s", got, want)
+	}
+}
+
+// TestCSRFProtect sends csrfProtect requests with and without their
+// session's token, in each place a token can be
+func TestCSRFProtect(t *testing.T) {
+	cookie, token := newCSRFSession(t)
+	otherCookie, otherToken := newCSRFSession(t)
+	var file string // what the handler read of a multipart form's file
+	handler := sessions.Middleware(csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if parts, err := r.MultipartReader(); err == nil {
+			for part, err := parts.NextPart(); err == nil; part, err = parts.NextPart() {
+				if part.FormName() == "file" {
+					data, _ := io.ReadAll(part)
+					file = string(data)
+				}
+			}
+		}
+		fmt.Fprint(w, "done")
+	})))
+	form := func(values url.Values) (string, io.Reader) {
+		return "application/x-www-form-urlencoded", strings.NewReader(values.Encode())
+	}
+	upload := func(fields ...string) (string, io.Reader) {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		for i := 0; i < len(fields); i += 2 {
+			if err := w.WriteField(fields[i], fields[i+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		part, err := w.CreateFormFile("file", "big.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(part, strings.Repeat("streamed ", 2000))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return w.FormDataContentType(), &body
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		cookie *http.Cookie
+		header string
+		body   func() (string, io.Reader)
+		want   int
+	}{
+		{"a GET", "GET", nil, "", nil, http.StatusOK},
+		{"a POST with the token", "POST", cookie, "", func() (string, io.Reader) { return form(url.Values{"csrf_token": {token}}) }, http.StatusOK},
+		{"a POST with the token in the header", "POST", cookie, token, nil, http.StatusOK},
+		{"a DELETE with the token in the header", "DELETE", cookie, token, nil, http.StatusOK},
+		{"an upload with the token first", "POST", cookie, "", func() (string, io.Reader) { return upload("csrf_token", token) }, http.StatusOK},
+		{"a POST without a token", "POST", cookie, "", func() (string, io.Reader) { return form(url.Values{"name": {"x"}}) }, http.StatusForbidden},
+		{"a POST with a wrong token", "POST", cookie, "", func() (string, io.Reader) { return form(url.Values{"csrf_token": {"guess"}}) }, http.StatusForbidden},
+		{"a POST with another session's token", "POST", cookie, otherToken, nil, http.StatusForbidden},
+		{"a POST with the token but no session", "POST", nil, token, nil, http.StatusForbidden},
+		{"a POST with an empty token and no session", "POST", nil, "", func() (string, io.Reader) { return form(url.Values{"csrf_token": {""}}) }, http.StatusForbidden},
+		{"a POST with its token but another session's cookie", "POST", otherCookie, token, nil, http.StatusForbidden},
+		{"a JSON POST without a token", "POST", cookie, "", func() (string, io.Reader) { return "application/json", strings.NewReader("{}") }, http.StatusForbidden},
+		{"an upload with the token second", "POST", cookie, "", func() (string, io.Reader) { return upload("name", "x", "csrf_token", token) }, http.StatusForbidden},
+		{"an upload without a token", "POST", cookie, "", func() (string, io.Reader) { return upload() }, http.StatusForbidden},
+	} {
+		file = ""
+		r := httptest.NewRequest(tt.method, "/", nil)
+		if tt.body != nil {
+			contentType, body := tt.body()
+			r = httptest.NewRequest(tt.method, "/", body)
+			r.Header.Set("Content-Type", contentType)
+		}
+		if tt.cookie != nil {
+			r.AddCookie(tt.cookie)
+		}
+		if tt.header != "" {
+			r.Header.Set(csrfHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	// The upload that got through was read whole by the handler, though
+	// csrfProtect had read its start
+	contentType, body := upload("csrf_token", token)
+	r := httptest.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", contentType)
+	r.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if want := strings.Repeat("streamed ", 2000); file != want {
+		t.Errorf("the handler read %d bytes of the file, want %d", len(file), len(want))
+	}
+}
+
+// newCSRFSession starts a session with a CSRF token, as showing a page
+// with a form does, and returns its cookie and the token
+func newCSRFSession(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	token := csrfToken(rec, httptest.NewRequest("GET", "/form", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("csrfToken set cookies %v, want a new session's", cookies)
+	}
+	return cookies[0], token
+}
+
+// csrfTokenInPage finds the token csrfField put in a page
+var csrfTokenInPage = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="([0-9a-f]+)">`)
+
+// pageCSRFToken is the CSRF token in a page's forms
+func pageCSRFToken(t *testing.T, page string) string {
+	t.Helper()
+	m := csrfTokenInPage.FindStringSubmatch(page)
+	if m == nil {
+		t.Fatalf("no CSRF token in the page:\n%s", page)
+	}
+	return m[1]
+}
+
+func TestAsset(t *testing.T) {
+	url, err := asset("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "/static/style.css?v=") || len(url) != len("/static/style.css?v=")+8 {
+		t.Errorf("asset(style.css) = %q, want a versioned URL", url)
+	}
+	if again, _ := asset("style.css"); again != url {
+		t.Errorf("asset changed between calls: %q then %q", url, again)
+	}
+	if _, err := asset("missing.css"); err == nil {
+		t.Error("asset of a missing file succeeded")
+	}
+
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	for target, want := range map[string]string{url: "public, max-age=31536000, immutable", "/static/style.css": ""} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if got := rec.Header().Get("Cache-Control"); rec.Code != http.StatusOK || got != want {
+			t.Errorf("GET %s = %d, Cache-Control %q; want 200 and %q", target, rec.Code, got, want)
+		}
+	}
+}
+
+// TestStaticDir serves /static/ from disk, as -static-dir does: an
+// edited file is served, and versioned, straight away
+func TestStaticDir(t *testing.T) {
+	staticDir = t.TempDir()
+	defer func() { staticDir = "" }()
+	file := filepath.Join(staticDir, "style.css")
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	var urls []string
+	for _, css := range []string{"body { color: red; }", "body { color: blue; }"} {
+		if err := os.WriteFile(file, []byte(css), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/static/style.css", nil))
+		if rec.Body.String() != css {
+			t.Errorf("GET /static/style.css = %q, want the file on disk, %q", rec.Body.String(), css)
+		}
+		url, err := asset("style.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, url)
+	}
+	if urls[0] == urls[1] {
+		t.Errorf("asset = %s before and after an edit; want a new version", urls[0])
+	}
+
+	// Without it, the embedded files are back, with their own version
+	staticDir = ""
+	url, err := asset("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url == urls[1] {
+		t.Errorf("asset = %s after turning -static-dir off; want the embedded file's version", url)
+	}
+}
+
+// TestPages renders the templated pages, which checks every function
+// they call is registered and gets the right arguments
+func TestPages(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	style, err := asset("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	for _, want := range []string{`href="` + style + `"`, "<code>templates/home.html</code>", "The server knows "} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET / = %d, missing %q", rec.Code, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("GET /form set cookies %v, want a session", cookies)
+	}
+	r := httptest.NewRequest("GET", "/form", nil)
+	r.AddCookie(cookies[0])
+	if session, ok := sessions.lookup(r); !ok || session.CSRFToken == "" || pageCSRFToken(t, rec.Body.String()) != session.CSRFToken {
+		t.Errorf("GET /form = %d, want the session's CSRF token in the form", rec.Code)
+	}
+	// The form's own styles go in the layout's head, before the nav
+	if body := rec.Body.String(); strings.Index(body, ".form-group") > strings.Index(body, `<nav class="nav">`) {
+		t.Error("GET /form: the form's styles aren't in the head")
+	}
+
+	// Every page is in the layout, with the nav and footer partials
+	for _, path := range []string{"/", "/form", "/users", "/users/1"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", "text/html")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		for _, want := range []string{"<!DOCTYPE html>", " · Go Web Server Tutorial</title>", `<nav class="nav">`, `<footer class="footer">`} {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("GET %s = %d, missing %q", path, rec.Code, want)
+			}
+		}
+	}
+}
+
+// TestUsersPage checks GET /users renders the users for a browser, in ID
+// order and escaped, and still sends JSON to anything else
+func TestUsersPage(t *testing.T) {
+	id := addUser("<script>Eve</script>", "eve@example.com").ID
+	t.Cleanup(func() { deleteUser(id) })
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	r := httptest.NewRequest("GET", "/users", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("GET /users as a browser = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if strings.Contains(body, "<script>Eve") || !strings.Contains(body, "&lt;script&gt;Eve") {
+		t.Error("GET /users didn't escape a user's name")
+	}
+	last := -1
+	for _, name := range []string{"Alice", "Bob", "Charlie", "Eve"} {
+		i := strings.Index(body, name)
+		if i < last {
+			t.Errorf("GET /users: %s is out of ID order", name)
+		}
+		last = i
+	}
+	if !strings.Contains(body, pluralize(userCount(), "user", "users")) || !strings.Contains(body, `<a href="mailto:eve@example.com">`) {
+		t.Errorf("GET /users is missing the count or a row:\n%s", body)
+	}
+	if rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("Vary = %q, want Accept", rec.Header().Get("Vary"))
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/users", nil))
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("GET /users without Accept: text/html = %s, want JSON", rec.Header().Get("Content-Type"))
+	}
+	var list []userJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("GET /users isn't valid JSON: %v\n%s", err, rec.Body.String())
+	}
+	if len(list) == 0 || list[len(list)-1] != (userJSON{ID: id, Name: "<script>Eve</script>", Email: "eve@example.com"}) {
+		t.Errorf("GET /users as JSON = %+v, want Eve last, as she was stored", list)
+	}
+}
+
+// TestForm submits /form as a browser would: an invalid form comes back
+// with its errors and what was typed, and a valid one redirects to the
+// new user's page, which says it was created only the first time
+func TestForm(t *testing.T) {
+	srv := httptest.NewServer(NewServer().Handler)
+	defer srv.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	send := func(method, path string, form url.Values) (*http.Response, string) {
+		t.Helper()
+		r, err := http.NewRequest(method, srv.URL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", "text/html") // kept on the redirect
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+	_, page := send("GET", "/form", nil)
+	token := pageCSRFToken(t, page)
+
+	resp, body := send("POST", "/form", url.Values{"name": {"<b>Frank</b>"}, "email": {"alice@example.com"}, "csrf_token": {token}})
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("a taken email = %d, want 422", resp.StatusCode)
+	}
+	for _, want := range []string{
+		"Please fix the 1 error below.",
+		`value="&lt;b&gt;Frank&lt;/b&gt;"`,
+		`value="alice@example.com" class="invalid"`,
+		`<p class="field-error" id="email-error">A user with that email already exists</p>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the form with errors is missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `id="name-error"`) {
+		t.Error("the form has an error for a name that's fine")
+	}
+
+	n := userCount()
+	resp, body = send("POST", "/form", url.Values{"name": {" Frank "}, "email": {"frank@example.com"}, "csrf_token": {token}})
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Request.URL.Path, "/users/") {
+		t.Fatalf("a valid form ended at %d %s, want the user's page", resp.StatusCode, resp.Request.URL.Path)
+	}
+	user, found := findUserByEmail("frank@example.com")
+	if !found || user.Name != "Frank" || userCount() != n+1 {
+		t.Fatalf("the form stored %+v, and %d users; want Frank, and %d", user, userCount(), n+1)
+	}
+	t.Cleanup(func() { deleteUser(user.ID) })
+	if resp.Request.URL.Path != fmt.Sprintf("/users/%d", user.ID) || !strings.Contains(body, `<p class="flash">Created Frank.</p>`) {
+		t.Errorf("the redirect went to %s, saying:\n%s", resp.Request.URL.Path, body)
+	}
+	// Reloading the page is a GET: no new user, and no message again
+	if _, body := send("GET", resp.Request.URL.Path, nil); strings.Contains(body, "Created Frank") || userCount() != n+1 {
+		t.Error("reloading the user's page showed the message again, or added a user")
+	}
+}
+
+// TestValidateUserForm checks each field gets the first of its errors
+func TestValidateUserForm(t *testing.T) {
+	for _, tt := range []struct {
+		name, email string
+		want        map[string]string
+	}{
+		{"Frank", "frank@example.com", map[string]string{}},
+		{"", "", map[string]string{"name": "Name is required", "email": "Email is required"}},
+		{"Frank", "dana", map[string]string{"email": "Invalid email format"}},
+		{"Frank", "BOB@example.com", map[string]string{"email": "A user with that email already exists"}},
+		{strings.Repeat("é", maxNameLength+1), "frank@example.com", map[string]string{"name": "Name must be at most 100 characters"}},
+		{strings.Repeat("é", maxNameLength), "frank@example.com", map[string]string{}},
+	} {
+		if got := validateUserForm(tt.name, tt.email); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateUserForm(%q, %q) = %v, want %v", truncate(20, tt.name), tt.email, got, tt.want)
+		}
+	}
+}
+
+// multipartBody is a form with a csrf_token field and, unless filename
+// is empty, a file field, as a browser sends it
+func multipartBody(t *testing.T, token, filename string, content []byte) (string, *bytes.Buffer) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("csrf_token", token); err != nil {
+		t.Fatal(err)
+	}
+	if filename != "" {
+		part, err := form.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return form.FormDataContentType(), &body
+}
+
+// TestUpload uploads files through the server as a browser would, then
+// gets them back
+func TestUpload(t *testing.T) {
+	old := uploadDir
+	uploadDir = t.TempDir()
+	defer func() { uploadDir = old }()
+	srv := httptest.NewServer(NewServer().Handler)
+	defer srv.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(srv.URL + "/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := pageCSRFToken(t, string(page))
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 2000)...)
+
+	// The name is cut down to something safe, with the extension of what
+	// the file is, and a second file of the same name doesn't replace it
+	for _, want := range []string{"evil_pic.png", "evil_pic-2.png"} {
+		contentType, body := multipartBody(t, token, `C:\Users\me/../evil pic.html`, png)
+		resp, err := client.Post(srv.URL+"/upload", contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The client followed the 303 back to the upload page
+		if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/upload" {
+			t.Fatalf("uploading ended at %d %s, want the upload page", resp.StatusCode, resp.Request.URL.Path)
+		}
+		flash := fmt.Sprintf(`<p class="flash">Uploaded %s (2.0 KB).</p>`, want)
+		if !strings.Contains(string(page), flash) || !strings.Contains(string(page), `<a href="/uploads/`+want+`">`) {
+			t.Errorf("the upload page doesn't say or list %s:\n%s", want, page)
+		}
+	}
+	files, err := listUploads(uploadDir)
+	if err != nil || len(files) != 2 || files[0].Size != int64(len(png)) {
+		t.Errorf("listUploads = %+v, %v; want the two files", files, err)
+	}
+
+	resp, err = client.Get(srv.URL + "/uploads/evil_pic.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !bytes.Equal(got, png) || resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("GET /uploads/evil_pic.png = %d %s, %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(got))
+	}
+	for _, path := range []string{"/uploads/missing.png", "/uploads/evil%20pic.png", "/uploads/..%2fsecret.txt", "/uploads/evil_pic.html"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
+
+// TestUploadRejected checks the files /upload turns away, and that none
+// of them is left on disk
+func TestUploadRejected(t *testing.T) {
+	old := uploadDir
+	uploadDir = t.TempDir()
+	defer func() { uploadDir = old }()
+	handler := NewServer().Handler
+	cookie, token := newCSRFSession(t)
+
+	for _, tt := range []struct {
+		name     string
+		filename string
+		content  []byte
+		want     int
+		message  string
+	}{
+		{"no file", "", nil, http.StatusBadRequest, "Choose a file to upload."},
+		{"an empty file", "empty.txt", nil, http.StatusBadRequest, "The file is empty."},
+		{"HTML", "page.txt", []byte("<html><script>alert(1)</script>"), http.StatusUnsupportedMediaType, "Only PNG, JPEG and GIF images"},
+		{"one byte too many", "big.txt", bytes.Repeat([]byte("a"), maxUploadSize+1), http.StatusRequestEntityTooLarge, "The file is larger than 5.0 MB."},
+		{"a body over the limit", "huge.txt", bytes.Repeat([]byte("a"), maxUploadSize+maxUploadOverhead), http.StatusRequestEntityTooLarge, "The file is larger than 5.0 MB."},
+	} {
+		contentType, body := multipartBody(t, token, tt.filename, tt.content)
+		r := httptest.NewRequest("POST", "/upload", body)
+		r.Header.Set("Content-Type", contentType)
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.want || !strings.Contains(rec.Body.String(), `<p class="error">`+tt.message) {
+			t.Errorf("%s = %d, want %d and %q", tt.name, rec.Code, tt.want, tt.message)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader("file=x"))
+	r.Header.Set(csrfHeader, token)
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("a body that isn't multipart = %d, want 400", rec.Code)
+	}
+	if files, err := listUploads(uploadDir); err != nil || len(files) != 0 {
+		t.Errorf("rejected uploads left %+v, %v", files, err)
+	}
+}
+
+func TestUploadName(t *testing.T) {
+	for _, tt := range []struct{ name, ext, want string }{
+		{"photo.jpeg", ".jpg", "photo.jpg"},
+		{"../../etc/passwd", ".txt", "passwd.txt"},
+		{`C:\Users\me\notes.md`, ".txt", "notes.txt"},
+		{"résumé 2024.pdf", ".pdf", "r_sum__2024.pdf"},
+		{".png", ".png", "upload.png"},
+		{"", ".txt", "upload.txt"},
+		{strings.Repeat("a", 200) + ".txt", ".txt", strings.Repeat("a", 100) + ".txt"},
+	} {
+		if got := uploadName(tt.name, tt.ext); got != tt.want {
+			t.Errorf("uploadName(%q, %q) = %q, want %q", tt.name, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KB", 5 << 20: "5.0 MB"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+// TestParsePages checks each page gets its own set, so two pages can both
+// define "content", and a page that doesn't parse is an error
+func TestParsePages(t *testing.T) {
+	files := fstest.MapFS{
+		"templates/layout.html":       {Data: []byte(`{{define "layout"}}[{{template "content" .}}]{{end}}`)},
+		"templates/partials/sig.html": {Data: []byte(`{{define "sig"}}-- {{.}}{{end}}`)},
+		"templates/a.html":            {Data: []byte(`{{define "content"}}a {{template "sig" .}}{{end}}`)},
+		"templates/b.html":            {Data: []byte(`{{define "content"}}b {{template "sig" .}}{{end}}`)},
+	}
+	sets, err := parsePages(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for page, want := range map[string]string{"a.html": "[a -- Go]", "b.html": "[b -- Go]"} {
+		var got strings.Builder
+		if err := sets[page].ExecuteTemplate(&got, "layout", "Go"); err != nil || got.String() != want {
+			t.Errorf("%s = %q, %v; want %q", page, got.String(), err, want)
+		}
+	}
+	if _, ok := sets["layout.html"]; ok {
+		t.Error("the layout is a page")
+	}
+
+	files["templates/c.html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}{{.Missing}`)}
+	if _, err := parsePages(files); err == nil {
+		t.Error("parsePages succeeded with a page that doesn't parse")
+	}
+}
+
+// TestServeTLS serves the lesson over HTTPS with a self-signed
+// certificate, to a client that trusts just that certificate
+func TestServeTLS(t *testing.T) {
+	cert, err := selfSignedCert(certHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range certHosts {
+		if err := cert.Leaf.VerifyHostname(host); err != nil {
+			t.Errorf("the certificate isn't good for %s: %v", host, err)
+		}
+	}
+
+	listener, err := Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	server.ErrorLog = log.New(io.Discard, "", 0)
+	UseTLS(server, cert)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, server, listener) }()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(SecureURL(listener) + "/hello/TLS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 || !strings.HasPrefix(string(body), "Hello, TLS!") {
+		t.Errorf("GET over HTTPS = %d %q, TLS %v", resp.StatusCode, body, resp.TLS)
+	}
+
+	// A client that doesn't know the certificate refuses it
+	if _, err := http.Get(SecureURL(listener)); err == nil {
+		t.Error("the default client accepted a self-signed certificate")
+	}
+	// Plain HTTP to the HTTPS port gets a 400 saying so
+	if resp, err := http.Get(URL(listener)); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("HTTP to the HTTPS port = %v, %v; want a 400", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve = %v, want nil after a clean shutdown", err)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	handler := redirectToHTTPS(8443)
+	for target, want := range map[string]string{
+		"http://localhost:8080/users/1?x=y": "https://localhost:8443/users/1?x=y",
+		"http://127.0.0.1/":                 "https://127.0.0.1:8443/",
+		"http://[::1]:8080/form":            "https://[::1]:8443/form",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", target, strings.NewReader("name=Dana")))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != want {
+			t.Errorf("POST %s = %d to %q, want 308 to %s", target, rec.Code, rec.Header().Get("Location"), want)
+		}
+	}
+}
+
+// TestSessions logs in and out through the server with a cookie jar, as
+// a browser would, counting visits on the way
+func TestSessions(t *testing.T) {
+	srv := httptest.NewServer(NewServer().Handler)
+	defer srv.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	// Each post sends the CSRF token of the last page with a form
+	var token string
+	get := func(path string) string {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := csrfTokenInPage.FindStringSubmatch(string(body)); m != nil {
+			token = m[1]
+		}
+		return string(body)
+	}
+	post := func(path string, form url.Values) *http.Response {
+		t.Helper()
+		if form == nil {
+			form = url.Values{}
+		}
+		form.Set("csrf_token", token)
+		resp, err := client.PostForm(srv.URL+path, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, want := range []string{"1 time", "2 times"} {
+		if body := get("/"); !strings.Contains(body, "You've been here "+want) || !strings.Contains(body, `href="/login"`) {
+			t.Errorf("GET / didn't say %q, logged out", want)
+		}
+	}
+	get("/login")
+	if resp := post("/login", url.Values{"email": {"bob@example.com"}, "password": {"wrong"}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("a wrong password = %d, want 401", resp.StatusCode)
+	}
+	before := sessionCookieIn(t, jar, srv.URL)
+	// The client follows the 303 home, which counts a third visit
+	if resp := post("/login", url.Values{"email": {"Bob@Example.com"}, "password": {loginPassword}}); resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/" {
+		t.Errorf("logging in ended at %d %s, want the home page", resp.StatusCode, resp.Request.URL.Path)
+	}
+	if after := sessionCookieIn(t, jar, srv.URL); before == after {
+		t.Errorf("the session cookie was %s before logging in and after; want a new one", before)
+	}
+	if body := get("/form"); !strings.Contains(body, "Logged in as Bob") {
+		t.Error("GET /form doesn't show who's logged in")
+	}
+	if body := get("/"); !strings.Contains(body, "You've been here 4 times, and you're logged in as Bob") {
+		t.Error("the visits didn't survive logging in")
+	}
+
+	// Logging out forgets the visits too: the 303 home is a new visitor's
+	// first, and this their second
+	post("/logout", nil)
+	if body := get("/"); !strings.Contains(body, "You've been here 2 times.") || strings.Contains(body, "Logged in as") {
+		t.Error("still logged in after logging out")
+	}
+}
+
+// TestAdmin checks the admin area needs Basic auth, then deletes a user
+// from it as a browser would
+func TestAdmin(t *testing.T) {
+	srv := httptest.NewServer(NewServer().Handler)
+	defer srv.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	user := addUser("Grace", "grace@example.com")
+	t.Cleanup(func() { deleteUser(user.ID) })
+	var token string // the admin page's CSRF token, once it's been shown
+	send := func(method, path, password string) (*http.Response, string) {
+		t.Helper()
+		r, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if method == "POST" && token != "" {
+			r.Header.Set(csrfHeader, token)
+		}
+		if password != "" {
+			r.SetBasicAuth(adminUser, password) // kept on the redirect, to the same host
+		}
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	deletePath := fmt.Sprintf("/admin/users/%d/delete", user.ID)
+	for _, req := range []struct{ method, path, password string }{
+		{"GET", "/admin", ""},
+		{"GET", "/admin", "wrong"},
+		{"GET", "/admin/", ""},
+		{"POST", deletePath, ""},
+		{"POST", deletePath, "wrong"},
+	} {
+		resp, _ := send(req.method, req.path, req.password)
+		if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), `Basic realm="`+adminRealm+`"`) {
+			t.Errorf("%s %s with password %q = %d, WWW-Authenticate %q; want a 401 challenge",
+				req.method, req.path, req.password, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+	if _, ok := getUser(user.ID); !ok {
+		t.Fatal("a POST without the password deleted the user")
+	}
+
+	// Basic auth alone isn't enough to POST: a form on another site would
+	// get the browser to send it too
+	if resp, _ := send("POST", deletePath, adminPassword); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST %s without a CSRF token = %d, want 403", deletePath, resp.StatusCode)
+	}
+	if _, ok := getUser(user.ID); !ok {
+		t.Fatal("a POST without the CSRF token deleted the user")
+	}
+
+	resp, body := send("GET", "/admin", adminPassword)
+	token = pageCSRFToken(t, body)
+	for _, want := range []string{"<th>Uptime</th>", "<th>Users</th><td>" + strconv.Itoa(userCount()) + "</td>", `action="` + deletePath + `"`} {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, want) {
+			t.Errorf("GET /admin = %d, missing %q", resp.StatusCode, want)
+		}
+	}
+
+	// The client follows the 303 back to the admin page
+	resp, body = send("POST", deletePath, adminPassword)
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/admin" || !strings.Contains(body, `<p class="flash">Deleted Grace.</p>`) {
+		t.Errorf("deleting ended at %d %s, want the admin page saying so", resp.StatusCode, resp.Request.URL.Path)
+	}
+	if _, ok := getUser(user.ID); ok || strings.Contains(body, deletePath) {
+		t.Error("the user is still there after deleting them")
+	}
+	for path, want := range map[string]int{deletePath: http.StatusNotFound, "/admin/users/x/delete": http.StatusBadRequest} {
+		if resp, _ := send("POST", path, adminPassword); resp.StatusCode != want {
+			t.Errorf("POST %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+// sessionCookieIn is the session cookie jar holds for base
+func sessionCookieIn(t *testing.T, jar http.CookieJar, base string) string {
+	t.Helper()
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range jar.Cookies(u) {
+		if c.Name == sessionCookie {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// TestSlow checks /slow waits for its delay on the lesson's clock, so a
+// fake one decides when it answers
+func TestSlow(t *testing.T) {
+	fake := clock.NewFake(demo.Clock)
+	clk = fake
+	defer func() { clk = clock.Real{} }()
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		slowHandler(rec, httptest.NewRequest("GET", "/slow?delay=3s", nil))
+		close(done)
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("/slow?delay=3s answered after 2s")
+	default:
+	}
+	fake.Advance(time.Second)
+	<-done
+	if rec.Body.String() != "Done after 3s\n" {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+// TestSessionCookies checks the store turns away cookies it didn't sign,
+// and sessions that have expired
+func TestSessionCookies(t *testing.T) {
+	fake := clock.NewFake(demo.Clock)
+	clk = fake
+	defer func() { clk = clock.Real{} }()
+	store := newSessionStore([]byte("test key"), time.Minute)
+
+	// A request without a session gets a new one from Update
+	rec := httptest.NewRecorder()
+	session := store.Update(rec, httptest.NewRequest("GET", "/", nil), func(s *Session) { s.UserID = 2 })
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != sessionCookie || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != 60 {
+		t.Errorf("cookie = %+v", cookie)
+	}
+	lookup := func(value string) (Session, bool) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+		return store.lookup(r)
+	}
+	if got, ok := lookup(cookie.Value); !ok || got.UserID != 2 || got.ID != session.ID {
+		t.Errorf("lookup = %+v, %v; want the session", got, ok)
+	}
+
+	other := newSessionStore([]byte("another key"), time.Minute)
+	for name, value := range map[string]string{
+		"no signature":       session.ID,
+		"edited ID":          "x" + cookie.Value[1:], // not hex, so never the ID
+		"another key's":      other.sign(session.ID),
+		"a bad signature":    session.ID + ".!!!",
+		"an unknown session": store.sign("nosuchsession"),
+	} {
+		if _, ok := lookup(value); ok {
+			t.Errorf("%s cookie was accepted", name)
+		}
+	}
+
+	fake.Advance(time.Minute)
+	if _, ok := lookup(cookie.Value); ok {
+		t.Error("an expired session was accepted")
+	}
+	if n := store.Len(); n != 0 {
+		t.Errorf("%d sessions stored after the only one expired", n)
+	}
+}
+
+// TestRouter checks the Router's matching, parameters, middleware order
+// and its answers when no route fits
+func TestRouter(t *testing.T) {
+	var order []string
+	tag := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	reply := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s id=%s file=%s", name, r.PathValue("id"), r.PathValue("file"))
+		}
+	}
+
+	rt := NewRouter()
+	rt.Use(tag("router"))
+	rt.Get("/users/:id", reply("user"), tag("route"))
+	// Added after /users/:id, but more literal, so it wins for /users/new
+	rt.Get("/users/new", reply("new"))
+	rt.Delete("/users/:id", reply("delete"))
+	rt.Get("/files/*file", reply("files"))
+	rt.Group("/api", func(api *Router) {
+		api.Use(tag("group"))
+		api.Get("/users/:id", reply("api user"), tag("route"))
+		api.Group("/v2", func(v2 *Router) {
+			v2.Post("/users", reply("v2 create"))
+		})
+	})
+	// Use only applies to routes added after it
+	rt.Use(tag("late"))
+
+	tests := []struct {
+		method, path string
+		wantCode     int
+		wantBody     string
+		wantOrder    []string
+		wantAllow    string
+	}{
+		{"GET", "/users/7", 200, "user id=7 file=", []string{"router", "route"}, ""},
+		{"HEAD", "/users/7", 200, "", []string{"router", "route"}, ""},
+		{"GET", "/users/new", 200, "new id= file=", []string{"router"}, ""},
+		{"DELETE", "/users/7", 200, "delete id=7 file=", []string{"router"}, ""},
+		{"GET", "/files/a/b.txt", 200, "files id= file=a/b.txt", []string{"router"}, ""},
+		{"GET", "/files/", 200, "files id= file=", []string{"router"}, ""},
+		{"GET", "/api/users/3", 200, "api user id=3 file=", []string{"router", "group", "route"}, ""},
+		{"POST", "/api/v2/users", 200, "v2 create id= file=", []string{"router", "group"}, ""},
+		{"POST", "/users/7", 405, "Method Not Allowed", nil, "DELETE, GET, HEAD"},
+		{"GET", "/api/v2/users", 405, "Method Not Allowed", nil, "POST"},
+		{"GET", "/users/", 404, "404 page not found", nil, ""},
+		{"GET", "/users/7/extra", 404, "404 page not found", nil, ""},
+	}
+	for _, tt := range tests {
+		order = nil
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		body := strings.TrimSpace(rec.Body.String())
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.wantCode)
+		}
+		if tt.method != "HEAD" && body != tt.wantBody {
+			t.Errorf("%s %s: body %q, want %q", tt.method, tt.path, body, tt.wantBody)
+		}
+		if tt.wantOrder != nil && !reflect.DeepEqual(order, tt.wantOrder) {
+			t.Errorf("%s %s: middleware ran %v, want %v", tt.method, tt.path, order, tt.wantOrder)
+		}
+		if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+			t.Errorf("%s %s: Allow %q, want %q", tt.method, tt.path, got, tt.wantAllow)
+		}
+	}
+
+	// NotFound and MethodNotAllowed replace the plain answers
+	rt.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nothing at "+r.URL.Path, http.StatusNotFound)
+	}))
+	rt.MethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try "+w.Header().Get("Allow"), http.StatusMethodNotAllowed)
+	}))
+	for path, want := range map[string]string{"/nowhere": "nothing at /nowhere", "/api/v2/users": "try POST"} {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := strings.TrimSpace(rec.Body.String()); got != want {
+			t.Errorf("GET %s: body %q, want %q", path, got, want)
+		}
+	}
+}
+
+// TestMiniRoutes sends requests to the lesson's handlers through the
+// Router mounted at /mini/
+func TestMiniRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	for _, req := range []struct {
+		method, path string
+		want         int
+		wantBody     string
+	}{
+		{"GET", "/mini/hello/Ada", 200, "Hello, Ada!"},
+		{"GET", "/mini/users/1", 200, `"name":"Alice"`},
+		{"GET", "/mini/users/abc", 400, "Invalid user ID"},
+		{"DELETE", "/mini/users/1", 405, "DELETE isn't allowed here, only GET, HEAD"},
+		{"GET", "/mini/static/style.css", 200, ".flash"},
+		{"GET", "/mini/admin", 401, "Unauthorized"},
+		{"GET", "/mini/nowhere", 404, "The mini router has no route for /nowhere"},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(req.method, req.path, nil))
+		if rec.Code != req.want || !strings.Contains(rec.Body.String(), req.wantBody) {
+			t.Errorf("%s %s: %d %q, want %d containing %q", req.method, req.path, rec.Code, rec.Body.String(), req.want, req.wantBody)
+		}
+		// Middleware is for routes, so a 404 or 405 isn't marked
+		routed := rec.Header().Get("X-Router") == "mini"
+		if routed != (req.want != 404 && req.want != 405) {
+			t.Errorf("%s %s: X-Router %q", req.method, req.path, rec.Header().Get("X-Router"))
+		}
+	}
+}
+
+// TestProxy sends requests through /proxy/api/ to a stand-in for lesson
+// 10's API, checking what the API gets and what comes back
+func TestProxy(t *testing.T) {
+	var got *http.Request
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(httpmw.RequestIDHeader, r.Header.Get(httpmw.RequestIDHeader))
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/api/users/5")
+			w.WriteHeader(http.StatusCreated)
+		}
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+	}))
+	defer api.Close()
+	old := proxyTarget
+	proxyTarget = api.URL + "/"
+	t.Cleanup(func() { proxyTarget = old })
+	srv := httptest.NewServer(NewServer().Handler)
+	defer srv.Close()
+
+	r, err := http.NewRequest("GET", srv.URL+"/proxy/api/users?limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("Origin", "https://example.com")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "GET /api/users?limit=2" {
+		t.Errorf("GET /proxy/api/users = %d %q, want the API's answer for /api/users", resp.StatusCode, body)
+	}
+	apiURL, err := url.Parse(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for header, want := range map[string]string{
+		"Host":              apiURL.Host,
+		"X-Forwarded-Host":  strings.TrimPrefix(srv.URL, "http://"),
+		"X-Forwarded-Proto": "http",
+		"X-Forwarded-For":   "127.0.0.1",
+		"Via":               "1.1 lesson09",
+		"Authorization":     "Bearer token",
+		"Cookie":            "",
+	} {
+		value := got.Header.Get(header)
+		if header == "Host" {
+			value = got.Host
+		}
+		if value != want {
+			t.Errorf("the API got %s: %q, want %q", header, value, want)
+		}
+	}
+	if ids := resp.Header.Values(httpmw.RequestIDHeader); len(ids) != 1 || ids[0] != got.Header.Get(httpmw.RequestIDHeader) {
+		t.Errorf("request IDs: the response has %q, the API got %q; want the same one, once", ids, got.Header.Get(httpmw.RequestIDHeader))
+	}
+	if origins := resp.Header.Values("Access-Control-Allow-Origin"); len(origins) != 1 {
+		t.Errorf("Access-Control-Allow-Origin = %q, want lesson 09's only", origins)
+	}
+	if resp.Header.Get("Via") != "1.1 lesson09" {
+		t.Errorf("Via = %q, want 1.1 lesson09", resp.Header.Get("Via"))
+	}
+
+	// A redirect from the API points back through the gateway
+	resp, err = http.Post(srv.URL+"/proxy/api/users", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/proxy/api/users/5" {
+		t.Errorf("POST /proxy/api/users = %d, Location %q; want 201 and /proxy/api/users/5", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// Only the API is behind the gateway
+	resp, err = http.Get(srv.URL + "/proxy/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /proxy/metrics = %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestProxyDown checks the gateway answers 502, in JSON, when the API
+// doesn't
+func TestProxyDown(t *testing.T) {
+	api := httptest.NewServer(http.NotFoundHandler())
+	target, err := url.Parse(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Close()
+
+	rec := httptest.NewRecorder()
+	newProxy(target).ServeHTTP(rec, httptest.NewRequest("GET", "/proxy/api/users", nil))
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), `"error":"Lesson 10's API isn't answering at `+api.URL) {
+		t.Errorf("with the API down: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestProxyLesson10 sends a request through the gateway to lesson 10's
+// real API
+func TestProxyLesson10(t *testing.T) {
+	api := httptest.NewServer(lesson10.NewServer().Handler)
+	defer api.Close()
+	target, err := url.Parse(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newProxy(target).ServeHTTP(rec, httptest.NewRequest("GET", "/proxy/api/health", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" || !strings.Contains(rec.Body.String(), `"status"`) {
+		t.Errorf("GET /proxy/api/health = %d %s %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
+
+// TestUsersConcurrently creates, reads and deletes users from several
+// goroutines at once, as the server's requests do; go test -race fails
+// it if any route touches the map without usersMu
+func TestUsersConcurrently(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := addUser(fmt.Sprintf("Racer %d", i), fmt.Sprintf("racer%d@example.com", i))
+			for _, path := range []string{"/users", "/users/" + strconv.Itoa(user.ID), "/health"} {
+				mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+			}
+			if _, ok := findUserByEmail(user.Email); !ok {
+				t.Errorf("racer%d@example.com wasn't found", i)
+			}
+			if _, ok := deleteUser(user.ID); !ok {
+				t.Errorf("user %d was already deleted", user.ID)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
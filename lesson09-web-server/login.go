@@ -0,0 +1,68 @@
+package lesson09
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"golang-lab/lab/domain"
+)
+
+// loginPassword is the password every user logs in with, as in lesson
+// 10: the lesson is about the session a login starts, not about storing
+// passwords
+var loginPassword = "golab"
+
+// loginPage is the data for templates/login.html
+type loginPage struct {
+	layoutData
+	Email string // what was typed, so a failed login needn't retype it
+	Error string
+}
+
+// GET /login
+func loginFormHandler(w http.ResponseWriter, r *http.Request) {
+	render(w, "login.html", loginPage{layoutData: layoutFor(w, r)})
+}
+
+// POST /login logs a user in by email, starting a session with a new ID
+// that remembers who they are, then sends the browser home. A GET after
+// the POST means reloading the page doesn't log in again.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	user, found := findUserByEmail(email)
+	// The same answer for an unknown email and a wrong password, so the
+	// form can't be used to find out who has an account
+	passwordOK := subtle.ConstantTimeCompare([]byte(r.PostForm.Get("password")), []byte(loginPassword)) == 1
+	if !found || !passwordOK {
+		renderStatus(w, http.StatusUnauthorized, "login.html", loginPage{
+			layoutData: layoutFor(w, r), Email: email, Error: "Wrong email or password",
+		})
+		return
+	}
+	sessions.Renew(w, r, func(s *Session) { s.UserID = user.ID })
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// POST /logout ends the session. It's a POST, not a link, so another
+// site can't log visitors out with an <img src="/logout">.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessions.Destroy(w, r)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// findUserByEmail looks email up, ignoring case
+func findUserByEmail(email string) (domain.User, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for _, user := range users {
+		if email != "" && strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return domain.User{}, false
+}
@@ -1,156 +1,489 @@
 // Lesson 09: Web Server Basics with net/http
 // This lesson covers building HTTP servers, handling requests, and middleware
 
-package main
+package lesson09
 
 import (
+	"compress/gzip"
+	"context"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
-	"html/template"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/config"
+	"golang-lab/lab/domain"
+	"golang-lab/lab/httpmw"
+	"golang-lab/lab/respond"
+	"golang-lab/lab/smoke"
 )
 
-// User struct for demonstration
-type User struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-}
+// clk is where the lesson gets the time; tests can swap in a clock.Fake
+var clk clock.Clock = clock.Real{}
+
+// Simple in-memory "database". The server runs each request on its own
+// goroutine, so users and nextUserID are only touched with usersMu held,
+// through the functions below: a map read while another goroutine writes
+// it can crash the whole program.
+var (
+	usersMu sync.RWMutex
+	users   = map[int]domain.User{
+		1: {ID: 1, Name: "Alice", Email: "alice@example.com"},
+		2: {ID: 2, Name: "Bob", Email: "bob@example.com"},
+		3: {ID: 3, Name: "Charlie", Email: "charlie@example.com"},
+	}
+	nextUserID = 4
+)
+
+// staticFiles is compiled into the binary, so /static/ works no matter
+// which directory the server is started from
+//
+//go:embed static
+var staticFiles embed.FS
+
+// staticDir, set by -static-dir, serves the static files from a
+// directory on disk instead of staticFiles. An edit to an embedded file
+// only shows after a rebuild; one to a file on disk shows on the next
+// request, which is what you want while working on them.
+var staticDir string
 
-// Simple in-memory "database"
-var users = map[int]User{
-	1: {ID: 1, Name: "Alice", Email: "alice@example.com"},
-	2: {ID: 2, Name: "Bob", Email: "bob@example.com"},
-	3: {ID: 3, Name: "Charlie", Email: "charlie@example.com"},
+// staticFS is where /static/ and asset find the static files: staticDir
+// if it's set, otherwise the embedded static/, with the "static/" prefix
+// taken off so both look the same
+func staticFS() fs.FS {
+	if staticDir != "" {
+		return os.DirFS(staticDir)
+	}
+	sub, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// Only a malformed path fails, and "static" isn't one
+		panic(err)
+	}
+	return sub
 }
-var nextUserID = 4
 
-func main() {
+// Run is the lesson's entry point; cmd/lesson09 calls it
+func Run() {
 	fmt.Println("=== Lesson 09: Web Server Basics ===")
 	
-	// Create a new ServeMux (router)
-	mux := http.NewServeMux()
+	port := flag.Int("port", 8080, "port to listen on; 0 picks a free one")
+	useTLS := flag.Bool("tls", false, "serve HTTPS on -tls-port with a self-signed certificate, and redirect -port to it")
+	tlsPort := flag.Int("tls-port", 8443, "port to serve HTTPS on, with -tls; 0 picks a free one")
+	ci := flag.Bool("ci", false, "serve on a free port, send a smoke test of requests, and exit")
+	flag.BoolVar(ci, "once", false, "same as -ci")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "how long Ctrl+C waits for requests in flight before cutting them off")
+	flag.StringVar(&uploadDir, "upload-dir", uploadDir, "directory /upload keeps files in")
+	adminPass := flag.String("admin-password", "", "password for /admin, as user admin; empty picks a random one each start")
+	flag.StringVar(&proxyTarget, "proxy-target", proxyTarget, "lesson 10's API, which /proxy/api/ forwards to")
+	flag.StringVar(&staticDir, "static-dir", "", "serve /static/ from this directory, like lesson09-web-server/static, instead of the files built in; edits show without a rebuild")
 	
-	// Register routes
-	registerRoutes(mux)
+	// Every flag can also come from -config's file, or $LESSON09_<FLAG>;
+	// lab/config explains the order
+	settings, err := config.Load(flag.CommandLine, os.Args[1:], config.Options{
+		EnvPrefix: "LESSON09_",
+		Secret:    []string{"admin-password"},
+		Check: func() (problems []string) {
+			for _, p := range []int{*port, *tlsPort} {
+				if p < 0 || p > 65535 {
+					problems = append(problems, fmt.Sprintf("a port must be between 0 and 65535, not %d", p))
+				}
+			}
+			if staticDir != "" {
+				if info, err := os.Stat(staticDir); err != nil || !info.IsDir() {
+					problems = append(problems, fmt.Sprintf("the static dir %q isn't a directory", staticDir))
+				}
+			}
+			if u, err := url.Parse(proxyTarget); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("the proxy target %q isn't an http:// or https:// URL", proxyTarget))
+			}
+			if shutdownTimeout <= 0 {
+				problems = append(problems, "the shutdown timeout must be positive")
+			}
+			return problems
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := settings.Print(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if *adminPass != "" {
+		adminPassword = *adminPass
+	}
 	
-	// Apply middleware
-	handler := loggingMiddleware(corsMiddleware(mux))
+	server := NewServer()
 	
-	// Create server with configuration
-	server := &http.Server{
-		Addr:         ":8080",
-		Handler:      handler,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// In CI mode, check every route over real HTTP instead of waiting for
+	// someone with curl
+	if *ci {
+		if err := smoke.Run(os.Stdout, server.Handler, smokeSteps); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 	
-	fmt.Println("Starting server on http://localhost:8080")
+	listener, err := Listen(*port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	// With -tls the lesson's server moves to the HTTPS port, and a
+	// server that only redirects takes its place on the HTTP one
+	servers := []*http.Server{server}
+	listeners := []net.Listener{listener}
+	if *useTLS {
+		cert, err := selfSignedCert(certHosts)
+		if err != nil {
+			log.Fatalf("Failed to make a certificate: %v", err)
+		}
+		UseTLS(server, cert)
+		tlsListener, err := Listen(*tlsPort)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpsPort := tlsListener.Addr().(*net.TCPAddr).Port
+		servers = []*http.Server{server, NewRedirectServer(httpsPort)}
+		listeners = []net.Listener{tlsListener, listener}
+		
+		fmt.Printf("Starting server on %s, with a self-signed certificate\n", SecureURL(tlsListener))
+		fmt.Printf("  (browsers will warn; with curl, use -k) SHA-256 fingerprint %s\n", fingerprint(cert))
+		fmt.Printf("%s redirects there\n", URL(listener))
+	} else {
+		fmt.Printf("Starting server on %s\n", URL(listener))
+	}
+	if staticDir != "" {
+		fmt.Printf("Static files from %s, on disk\n", staticDir)
+	} else {
+		fmt.Println("Static files built into the binary (-static-dir serves them from disk)")
+	}
 	fmt.Println("Available endpoints:")
 	fmt.Println("  GET  /              - Home page")
 	fmt.Println("  GET  /hello         - Simple greeting")
 	fmt.Println("  GET  /hello/{name}  - Personalized greeting")
-	fmt.Println("  GET  /users         - List all users")
-	fmt.Println("  GET  /users/{id}    - Get specific user")
+	fmt.Println("  GET  /users         - List all users (a page for a browser, JSON otherwise)")
+	fmt.Println("  GET  /users/{id}    - Get specific user (a page for a browser, JSON otherwise)")
 	fmt.Println("  POST /users         - Create new user (form data)")
 	fmt.Println("  GET  /form          - User creation form")
+	fmt.Println("  POST /form          - Create a user from the form, or show it again with errors")
+	fmt.Println("  GET  /upload        - Upload a file, and list the uploads")
+	fmt.Println("  POST /upload        - Upload a file (multipart/form-data, up to 5 MB)")
+	fmt.Println("  GET  /uploads/{name} - An uploaded file")
+	fmt.Println("  GET  /login         - Log in for a session cookie")
+	fmt.Println("  POST /login         - Log in with a user's email and the password golab")
+	fmt.Println("  GET  /mini/...      - Some of the above again, through the lesson's own Router")
+	fmt.Printf("  *    /proxy/api/...  - Lesson 10's API, at %s, through a reverse proxy\n", proxyTarget)
+	fmt.Println("  POST /logout        - End the session")
+	fmt.Println("  GET  /admin         - Server stats and users, with Basic auth")
+	fmt.Println("  POST /admin/users/{id}/delete - Delete a user, with Basic auth")
 	fmt.Println("  GET  /static/*      - Static files")
+	fmt.Println("  GET  /slow?delay=3s - Answer after a delay, to watch Ctrl+C wait for it")
+	if *adminPass == "" {
+		fmt.Printf("\n/admin's user is %s, and its password this time is %s\n", adminUser, adminPassword)
+	}
 	fmt.Println("\nPress Ctrl+C to stop the server")
 	
-	// Start server
-	log.Fatal(server.ListenAndServe())
+	// Serve until Ctrl+C or SIGTERM (what docker stop and Kubernetes send)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serveAll(ctx, servers, listeners); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Server stopped")
+}
+
+// shutdownTimeout is how long Serve waits for requests in flight once
+// it's told to stop; -shutdown-timeout sets it, and tests shorten it
+var shutdownTimeout = 10 * time.Second
+
+// Serve serves on listener until ctx is done, then shuts down gracefully:
+// it stops accepting connections, closes idle ones, and waits up to
+// shutdownTimeout for the requests already being handled to finish. It
+// returns nil if they all did.
+//
+// log.Fatal(server.ListenAndServe()) has no such path: the process dies
+// mid-request, and clients see their connections reset.
+func Serve(ctx context.Context, server *http.Server, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			// The certificate is in TLSConfig, so no files to name
+			serveErr <- server.ServeTLS(listener, "", "")
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+	
+	select {
+	case err := <-serveErr:
+		return err // never ErrServerClosed: only Shutdown below causes that
+	case <-ctx.Done():
+	}
+	
+	log.Println("Shutting down, waiting for requests in flight...")
+	// ctx is already done, so the deadline needs a fresh context
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// Some requests were still running; cut them off
+		return errors.Join(fmt.Errorf("shutting down: %w", err), server.Close())
+	}
+	// Serve returns ErrServerClosed as soon as Shutdown starts
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveAll runs Serve for each server on its listener, until ctx is done
+// or one of them fails, which stops the others too
+func serveAll(ctx context.Context, servers []*http.Server, listeners []net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(servers))
+	for i := range servers {
+		go func() {
+			err := Serve(ctx, servers[i], listeners[i])
+			cancel()
+			errs <- err
+		}()
+	}
+	var all []error
+	for range servers {
+		all = append(all, <-errs)
+	}
+	return errors.Join(all...)
+}
+
+// NewServer returns the lesson's server with its routes and middleware,
+// ready to Serve on a listener from Listen
+func NewServer() *http.Server {
+	// Create a new ServeMux (router)
+	mux := http.NewServeMux()
+	
+	// Register routes
+	registerRoutes(mux)
+	
+	// Apply middleware from lab/httpmw; the first listed runs first
+	handler := httpmw.Chain(mux,
+		httpmw.RequestID(),
+		httpmw.Logging(nil),
+		httpmw.Recover(nil),
+		sessions.Middleware,
+		httpmw.CORS(httpmw.CORSOptions{}),
+		httpmw.Gzip(gzip.DefaultCompression),
+	)
+	
+	// Create server with configuration
+	return &http.Server{
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
 }
 
+// Listen listens on port, or on any free port if port is 0. Pass the
+// listener to URL to find out which port it got.
+func Listen(port int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, fmt.Errorf("listening on port %d (try -port 0 for a free one): %w", port, err)
+	}
+	return listener, nil
+}
+
+// URL is where a browser reaches the server on listener
+func URL(listener net.Listener) string {
+	return fmt.Sprintf("http://localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+}
+
+// smokeSteps are the requests -ci sends, one or more for every route
+var smokeSteps = []smoke.Step{
+	{Method: "GET", Path: "/", Want: http.StatusOK},
+	{Method: "GET", Path: "/hello?name=CI", Want: http.StatusOK},
+	{Method: "POST", Path: "/hello", Want: http.StatusMethodNotAllowed},
+	{Method: "GET", Path: "/hello/Ada", Want: http.StatusOK},
+	{Method: "GET", Path: "/users", Want: http.StatusOK},
+	{Method: "GET", Path: "/users", Header: map[string]string{"Accept": "text/html"}, Want: http.StatusOK},
+	{Method: "GET", Path: "/users/1", Want: http.StatusOK},
+	{Method: "GET", Path: "/users/1", Header: map[string]string{"Accept": "text/html"}, Want: http.StatusOK},
+	{Method: "GET", Path: "/users/99", Want: http.StatusNotFound},
+	{Method: "POST", Path: "/users", Body: "name=CI&email=ci%40example.com", ContentType: "application/x-www-form-urlencoded", Want: http.StatusCreated},
+	{Method: "POST", Path: "/users", Body: "name=CI", ContentType: "application/x-www-form-urlencoded", Want: http.StatusBadRequest},
+	{Method: "GET", Path: "/form", Want: http.StatusOK},
+	{Method: "POST", Path: "/form", Body: "name=Form&email=form%40example.com", ContentType: "application/x-www-form-urlencoded", Want: http.StatusForbidden},
+	{Method: "GET", Path: "/upload", Want: http.StatusOK},
+	{Method: "POST", Path: "/upload", Body: "csrf_token=guess", ContentType: "application/x-www-form-urlencoded", Want: http.StatusForbidden},
+	{Method: "GET", Path: "/uploads/missing.txt", Want: http.StatusNotFound},
+	{Method: "GET", Path: "/login", Want: http.StatusOK},
+	{Method: "POST", Path: "/login", Body: "email=alice%40example.com&password=golab", ContentType: "application/x-www-form-urlencoded", Want: http.StatusForbidden},
+	{Method: "POST", Path: "/logout", Want: http.StatusForbidden},
+	{Method: "GET", Path: "/admin", Want: http.StatusUnauthorized},
+	{Method: "GET", Path: "/admin", Header: map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:wrong"))}, Want: http.StatusUnauthorized},
+	{Method: "GET", Path: "/static/style.css", Want: http.StatusOK},
+	{Method: "GET", Path: "/mini/hello/Ada", Want: http.StatusOK},
+	{Method: "GET", Path: "/mini/users/1", Want: http.StatusOK},
+	{Method: "DELETE", Path: "/mini/users/1", Want: http.StatusMethodNotAllowed},
+	{Method: "GET", Path: "/mini/static/style.css", Want: http.StatusOK},
+	{Method: "GET", Path: "/mini/admin", Want: http.StatusUnauthorized},
+	{Method: "GET", Path: "/mini/missing", Want: http.StatusNotFound},
+	// Only lesson 10's /api/ is behind the gateway. Whether that answers
+	// depends on lesson 10 running, so -ci doesn't ask.
+	{Method: "GET", Path: "/proxy/metrics", Want: http.StatusNotFound},
+	{Method: "GET", Path: "/health", Want: http.StatusOK},
+	{Method: "GET", Path: "/slow?delay=10ms", Want: http.StatusOK},
+	{Method: "GET", Path: "/slow?delay=1h", Want: http.StatusBadRequest},
+}
+
+// registerRoutes uses Go 1.22 patterns: a method, then a path whose
+// {name} wildcards a handler reads with r.PathValue. Before 1.22 a
+// pattern was only a path, or a prefix ending in /, so a handler checked
+// the method and cut its parameter out of the path itself:
+//
+//	// Before: any method, and any path under /users/
+//	mux.HandleFunc("/users/", userHandler)
+//
+//	func userHandler(w http.ResponseWriter, r *http.Request) {
+//		if r.Method != http.MethodGet {
+//			w.Header().Set("Allow", "GET")
+//			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+//			return
+//		}
+//		path := strings.TrimPrefix(r.URL.Path, "/users/")
+//		userID, err := strconv.Atoi(path)
+//		...
+//	}
+//
+//	// After: GET (and so HEAD) of /users/ and one segment
+//	mux.HandleFunc("GET /users/{id}", userHandler)
+//
+//	func userHandler(w http.ResponseWriter, r *http.Request) {
+//		userID, err := strconv.Atoi(r.PathValue("id"))
+//		...
+//	}
+//
+// Any other method now gets a 405 from the mux, Allow header and all, and
+// /users/1/extra no longer reaches the handler. {$} matches the end of
+// the path only, so "GET /{$}" is the home page alone, where "/" would be
+// every path nothing else matched.
 func registerRoutes(mux *http.ServeMux) {
-	// Static file server
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
+	// Static file server, embedded or from -static-dir
+	fileServer := http.FileServer(http.FS(staticFS()))
+	mux.Handle("GET /static/", cacheVersionedAssets(http.StripPrefix("/static/", fileServer)))
 	
 	// Basic routes
-	mux.HandleFunc("/", homeHandler)
-	mux.HandleFunc("/hello", helloHandler)
-	mux.HandleFunc("/hello/", helloNameHandler)
+	mux.HandleFunc("GET /{$}", homeHandler)
+	mux.HandleFunc("GET /hello", helloHandler)
+	mux.Handle("GET /hello/{$}", http.RedirectHandler("/hello", http.StatusFound))
+	mux.HandleFunc("GET /hello/{name}", helloNameHandler)
 	
 	// User routes
-	mux.HandleFunc("/users", usersHandler)
-	mux.HandleFunc("/users/", userHandler)
+	mux.HandleFunc("GET /users", getAllUsers)
+	mux.HandleFunc("POST /users", createUser)
+	mux.Handle("GET /users/{$}", http.RedirectHandler("/users", http.StatusFound))
+	mux.HandleFunc("GET /users/{id}", userHandler)
+	
+	// Form routes: the form posts back to /form, and a valid one is
+	// redirected to the new user's page. Every route a page's form posts
+	// to is wrapped in csrfProtect, which turns away a POST without the
+	// session's CSRF token; POST /users is for curl, and isn't.
+	mux.HandleFunc("GET /form", formHandler)
+	mux.Handle("POST /form", csrfProtect(http.HandlerFunc(formSubmitHandler)))
 	
-	// Form routes
-	mux.HandleFunc("/form", formHandler)
+	// Uploading files, and getting them back
+	mux.HandleFunc("GET /upload", uploadFormHandler)
+	mux.Handle("POST /upload", csrfProtect(http.HandlerFunc(uploadHandler)))
+	mux.HandleFunc("GET /uploads/{name}", uploadedFileHandler)
+	
+	// The admin area: its own group of routes, all behind Basic auth and
+	// csrfProtect
+	admin := adminRoutes()
+	mux.Handle("/admin", admin)
+	mux.Handle("/admin/", admin)
+	
+	// Logging in and out, with a session cookie
+	mux.HandleFunc("GET /login", loginFormHandler)
+	mux.Handle("POST /login", csrfProtect(http.HandlerFunc(loginHandler)))
+	mux.Handle("POST /logout", csrfProtect(http.HandlerFunc(logoutHandler)))
+	
+	// Some of the same routes again, through the lesson's own Router, to
+	// show how a router like chi's works inside
+	mux.Handle("/mini/", http.StripPrefix("/mini", miniRoutes()))
+	
+	// A gateway to lesson 10's API, on -proxy-target
+	mux.Handle("/proxy/api/", proxyHandler())
 	
 	// Health check
-	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("GET /health", healthHandler)
+	
+	// A slow request, for watching a graceful shutdown wait
+	mux.HandleFunc("GET /slow", slowHandler)
 }
 
-// Home page handler
+// homePage is the data for templates/home.html
+type homePage struct {
+	layoutData
+	Intro      string // Markdown
+	Endpoints  []endpoint
+	Method     string
+	URL        string
+	UserAgent  string
+	RemoteAddr string
+	Now        time.Time
+	UserCount  int
+	Visits     int // this visitor's, counting this one
+}
+
+type endpoint struct {
+	Path        string
+	Description string
+}
+
+// Home page handler. It counts the visitor's visits in their session.
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-	
-	html := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Go Web Server Tutorial</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 40px; }
-        .endpoint { background: #f4f4f4; padding: 10px; margin: 10px 0; border-radius: 5px; }
-        a { color: #007bff; text-decoration: none; }
-        a:hover { text-decoration: underline; }
-    </style>
-</head>
-<body>
-    <h1>Welcome to Go Web Server Tutorial!</h1>
-    <p>This is a demonstration of various HTTP server features in Go.</p>
-    
-    <h2>Available Endpoints:</h2>
-    <div class="endpoint">
-        <strong>GET <a href="/hello">/hello</a></strong> - Simple greeting
-    </div>
-    <div class="endpoint">
-        <strong>GET <a href="/hello/World">/hello/World</a></strong> - Personalized greeting
-    </div>
-    <div class="endpoint">
-        <strong>GET <a href="/users">/users</a></strong> - List all users (JSON)
-    </div>
-    <div class="endpoint">
-        <strong>GET <a href="/users/1">/users/1</a></strong> - Get specific user (JSON)
-    </div>
-    <div class="endpoint">
-        <strong>GET <a href="/form">/form</a></strong> - User creation form
-    </div>
-    <div class="endpoint">
-        <strong>GET <a href="/health">/health</a></strong> - Health check
-    </div>
-    
-    <h2>Request Information:</h2>
-    <p><strong>Method:</strong> %s</p>
-    <p><strong>URL:</strong> %s</p>
-    <p><strong>User Agent:</strong> %s</p>
-    <p><strong>Remote Address:</strong> %s</p>
-    <p><strong>Timestamp:</strong> %s</p>
-</body>
-</html>
-`
-	
-	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprintf(w, html, r.Method, r.URL.String(), r.UserAgent(), r.RemoteAddr, time.Now().Format(time.RFC3339))
+	session := sessions.Update(w, r, func(s *Session) { s.Visits++ })
+	render(w, "home.html", homePage{
+		layoutData: layoutFor(w, r),
+		Intro: "This is a demonstration of various HTTP server features in Go. " +
+			"The page is rendered from `templates/home.html` with **html/template**; " +
+			"see the [package docs](https://pkg.go.dev/html/template).",
+		Endpoints: []endpoint{
+			{"/hello", "Simple greeting"},
+			{"/hello/World", "Personalized greeting"},
+			{"/users", "List all users (a page here, JSON for curl)"},
+			{"/users/1", "Get specific user (a page here, JSON for curl)"},
+			{"/form", "User creation form"},
+			{"/upload", "Upload a file"},
+			{"/health", "Health check"},
+		},
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: r.RemoteAddr,
+		Now:        clk.Now(),
+		UserCount:  userCount(),
+		Visits:     session.Visits,
+	})
 }
 
 // Simple hello handler
 func helloHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
 	name := r.URL.Query().Get("name")
 	if name == "" {
 		name = "World"
@@ -162,51 +495,66 @@ func helloHandler(w http.ResponseWriter, r *http.Request) {
 
 // Hello with name from URL path
 func helloNameHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
-	// Extract name from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/hello/")
-	if path == "" {
-		http.Redirect(w, r, "/hello", http.StatusFound)
-		return
-	}
+	// {name} in the route's pattern
+	name := r.PathValue("name")
 	
 	w.Header().Set("Content-Type", "text/plain")
-	fmt.Fprintf(w, "Hello, %s! Nice to meet you.\n", path)
+	fmt.Fprintf(w, "Hello, %s! Nice to meet you.\n", name)
 }
 
-// Users handler (handles both GET /users and POST /users)
-func usersHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		getAllUsers(w, r)
-	case http.MethodPost:
-		createUser(w, r)
-	default:
-		w.Header().Set("Allow", "GET, POST")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
+// usersPage is the data for templates/users.html
+type usersPage struct {
+	layoutData
+	Users []domain.User // in ID order
 }
 
-// Get all users
+// Get all users: a page for a browser, or JSON for anything else
 func getAllUsers(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	// The page and the JSON are different answers to the same URL
+	w.Header().Set("Vary", "Accept")
+	if wantsHTML(r) {
+		render(w, "users.html", usersPage{layoutData: layoutFor(w, r), Users: sortedUsers()})
+		return
+	}
 	
-	// Simple JSON response (in a real app, use json.Marshal)
-	fmt.Fprint(w, "[")
-	first := true
+	list := []userJSON{}
+	for _, user := range sortedUsers() {
+		list = append(list, newUserJSON(user))
+	}
+	respond.JSON(w, http.StatusOK, list)
+}
+
+// userJSON is a user as the JSON routes send one. Lesson 09's users
+// have only these of domain.User's fields, so the rest are left out
+// rather than sent empty.
+type userJSON struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func newUserJSON(user domain.User) userJSON {
+	return userJSON{ID: user.ID, Name: user.Name, Email: user.Email}
+}
+
+// wantsHTML reports whether r is from a browser, which lists text/html in
+// its Accept header; curl sends */*, and gets JSON
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// sortedUsers lists the users in ID order, for a page that should read
+// the same every time; ranging over the map gives a different order
+// each time
+func sortedUsers() []domain.User {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	list := make([]domain.User, 0, len(users))
 	for _, user := range users {
-		if !first {
-			fmt.Fprint(w, ",")
-		}
-		fmt.Fprintf(w, `{"id":%d,"name":"%s","email":"%s"}`, user.ID, user.Name, user.Email)
-		first = false
+		list = append(list, user)
 	}
-	fmt.Fprint(w, "]")
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
 }
 
 // Create a new user
@@ -214,7 +562,7 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	// Parse form data
 	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		respond.Error(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 	
@@ -222,160 +570,135 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	email := r.Form.Get("email")
 	
 	if name == "" || email == "" {
-		http.Error(w, "Name and email are required", http.StatusBadRequest)
+		respond.Error(w, http.StatusBadRequest, "Name and email are required")
 		return
 	}
 	
 	// Create new user
-	user := User{
+	user := addUser(name, email)
+	
+	// Return created user as JSON
+	respond.JSON(w, http.StatusCreated, newUserJSON(user))
+}
+
+// addUser stores a new user with the next ID
+func addUser(name, email string) domain.User {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	user := domain.User{
 		ID:    nextUserID,
 		Name:  name,
 		Email: email,
 	}
 	users[nextUserID] = user
 	nextUserID++
-	
-	// Return created user as JSON
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, `{"id":%d,"name":"%s","email":"%s"}`, user.ID, user.Name, user.Email)
+	return user
 }
 
-// Individual user handler
+// getUser looks a user up by ID
+func getUser(id int) (domain.User, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	user, ok := users[id]
+	return user, ok
+}
+
+// deleteUser removes a user, returning who it was
+func deleteUser(id int) (domain.User, bool) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	user, ok := users[id]
+	delete(users, id)
+	return user, ok
+}
+
+// userCount is how many users there are
+func userCount() int {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return len(users)
+}
+
+// userPage is the data for templates/user.html
+type userPage struct {
+	layoutData
+	Profile domain.User // not User, which is who's logged in
+	Flash   string      // what the last page did, like creating the user
+}
+
+// Individual user handler: a page for a browser, or JSON for anything else
 func userHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// {id} in the route's pattern
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		userError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	
-	// Extract user ID from URL
-	path := strings.TrimPrefix(r.URL.Path, "/users/")
-	if path == "" {
-		http.Redirect(w, r, "/users", http.StatusFound)
+	user, exists := getUser(userID)
+	if !exists {
+		userError(w, r, http.StatusNotFound, "User not found")
 		return
 	}
 	
-	userID, err := strconv.Atoi(path)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	w.Header().Set("Vary", "Accept")
+	if wantsHTML(r) {
+		render(w, "user.html", userPage{layoutData: layoutFor(w, r), Profile: user, Flash: popFlash(w, r)})
 		return
 	}
 	
-	user, exists := users[userID]
-	if !exists {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"id":%d,"name":"%s","email":"%s"}`, user.ID, user.Name, user.Email)
+	respond.JSON(w, http.StatusOK, newUserJSON(user))
 }
 
-// Form handler for creating users
-func formHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// userError sends an error from a route that answers browsers and curl
+// alike: plain text for a browser, JSON like the route's other answers
+// for anything else
+func userError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	w.Header().Set("Vary", "Accept")
+	if wantsHTML(r) {
+		http.Error(w, message, statusCode)
 		return
 	}
-	
-	tmpl := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Create User</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 40px; }
-        .form-group { margin-bottom: 15px; }
-        label { display: block; margin-bottom: 5px; font-weight: bold; }
-        input[type="text"], input[type="email"] {
-            width: 100%;
-            padding: 8px;
-            border: 1px solid #ddd;
-            border-radius: 4px;
-            box-sizing: border-box;
-        }
-        button {
-            background-color: #007bff;
-            color: white;
-            padding: 10px 20px;
-            border: none;
-            border-radius: 4px;
-            cursor: pointer;
-        }
-        button:hover { background-color: #0056b3; }
-        .back-link { margin-top: 20px; }
-    </style>
-</head>
-<body>
-    <h1>Create New User</h1>
-    <form action="/users" method="POST">
-        <div class="form-group">
-            <label for="name">Name:</label>
-            <input type="text" id="name" name="name" required>
-        </div>
-        <div class="form-group">
-            <label for="email">Email:</label>
-            <input type="email" id="email" name="email" required>
-        </div>
-        <button type="submit">Create User</button>
-    </form>
-    <div class="back-link">
-        <a href="/">← Back to Home</a>
-    </div>
-</body>
-</html>
-`
-	
-	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprint(w, tmpl)
+	respond.Error(w, statusCode, message)
 }
 
 // Health check handler
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"healthy","timestamp":"%s","users_count":%d}`, 
-		time.Now().Format(time.RFC3339), len(users))
+	respond.JSON(w, http.StatusOK, healthResponse{
+		Status:     "healthy",
+		Timestamp:  clk.Now().Format(time.RFC3339),
+		UsersCount: userCount(),
+	})
 }
 
-// Middleware for logging requests
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		
-		// Log request
-		log.Printf("Started %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		
-		// Call the next handler
-		next.ServeHTTP(w, r)
-		
-		// Log completion
-		log.Printf("Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
-	})
+// healthResponse is the body of GET /health
+type healthResponse struct {
+	Status     string `json:"status"`
+	Timestamp  string `json:"timestamp"`
+	UsersCount int    `json:"users_count"`
 }
 
-// Middleware for CORS headers
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+// maxSlowDelay keeps /slow under the server's WriteTimeout
+const maxSlowDelay = 5 * time.Second
+
+// Slow handler: answers after ?delay= (1s by default). Start one, press
+// Ctrl+C, and the server waits for it before exiting. If the client gives
+// up first, so does the handler.
+func slowHandler(w http.ResponseWriter, r *http.Request) {
+	delay := time.Second
+	if s := r.URL.Query().Get("delay"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 || d > maxSlowDelay {
+			http.Error(w, fmt.Sprintf("delay must be a duration up to %v", maxSlowDelay), http.StatusBadRequest)
 			return
 		}
-		
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
-}
\ No newline at end of file
+		delay = d
+	}
+	
+	select {
+	case <-clk.After(delay):
+		fmt.Fprintf(w, "Done after %v\n", delay)
+	case <-r.Context().Done():
+		// The client went away; nobody is left to answer
+	}
+}
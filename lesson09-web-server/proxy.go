@@ -0,0 +1,102 @@
+package lesson09
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"golang-lab/lab/httpmw"
+	"golang-lab/lab/respond"
+)
+
+// /proxy/api/ is a gateway in front of lesson 10's API: a request for
+// /proxy/api/users is sent on to the API as /api/users, and its answer
+// comes back as if lesson 09 had made it. httputil.ReverseProxy does the
+// forwarding, copying the request, dropping hop-by-hop headers like
+// Connection, and streaming the bodies both ways, and calls hooks where a
+// gateway does its own work:
+//
+//	Rewrite         changes the request on its way to the API
+//	ModifyResponse  changes the response on its way back
+//	ErrorHandler    answers when the API doesn't
+//
+// Only the API is behind the gateway: lesson 10's other routes, like
+// /metrics, aren't under /proxy/api/, so the mux answers them with a 404.
+// Run lesson 10 where -proxy-target says to try it:
+//
+//	go run ./cmd/lesson10 -port 8081
+//	curl -i http://localhost:8080/proxy/api/users
+
+// proxyPrefix is the part of the path the gateway takes off
+const proxyPrefix = "/proxy"
+
+// proxyTarget is where lesson 10's API is; -proxy-target sets it
+var proxyTarget = "http://localhost:8081"
+
+// proxyHandler returns the gateway to proxyTarget
+func proxyHandler() http.Handler {
+	target, err := url.Parse(proxyTarget)
+	if err != nil {
+		// Run's Check turns away a -proxy-target that doesn't parse
+		panic(err)
+	}
+	return newProxy(target)
+}
+
+// newProxy returns a ReverseProxy that sends requests under /proxy/ to
+// target, without the /proxy
+func newProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// pr.In is the request as it came; pr.Out, a copy, is what's sent
+			pr.Out.URL.Path = strings.TrimPrefix(pr.In.URL.Path, proxyPrefix)
+			pr.Out.URL.RawPath = strings.TrimPrefix(pr.In.URL.RawPath, proxyPrefix)
+			// The scheme and host, target's path in front of the request's,
+			// and a Host header naming the API rather than lesson 09
+			pr.SetURL(target)
+			// X-Forwarded-For, -Host and -Proto: who asked, and where
+			pr.SetXForwarded()
+			pr.Out.Header.Add("Via", "1.1 lesson09")
+			// One ID for the request in both servers' logs
+			if id := httpmw.RequestIDFromContext(pr.In.Context()); id != "" {
+				pr.Out.Header.Set(httpmw.RequestIDHeader, id)
+			}
+			// Lesson 09's session cookie is none of the API's business. The
+			// Authorization header is: it carries the API's own token or key.
+			pr.Out.Header.Del("Cookie")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Add("Via", "1.1 lesson09")
+			// Lesson 09's middleware has already set its own request ID and
+			// CORS headers, and a second copy would confuse a browser
+			resp.Header.Del(httpmw.RequestIDHeader)
+			for name := range resp.Header {
+				if strings.HasPrefix(name, "Access-Control-") {
+					resp.Header.Del(name)
+				}
+			}
+			if location, ok := proxyLocation(resp, target); ok {
+				resp.Header.Set("Location", location)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Proxying %s %s to %s: %v", r.Method, r.URL.Path, target, err)
+			respond.Error(w, http.StatusBadGateway, "Lesson 10's API isn't answering at "+target.String())
+		},
+	}
+}
+
+// proxyLocation is where a Location header from the API points through
+// the gateway: /api/users/5 there is /proxy/api/users/5 here. A
+// Location on another site is left as it is.
+func proxyLocation(resp *http.Response, target *url.URL) (string, bool) {
+	location, err := resp.Location()
+	if err != nil || location.Host != target.Host {
+		return "", false
+	}
+	path := strings.TrimPrefix(location.RequestURI(), strings.TrimSuffix(target.Path, "/"))
+	return proxyPrefix + path, true
+}
@@ -0,0 +1,276 @@
+package lesson09
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang-lab/lab/httpmw"
+)
+
+// Router is a small router of the kind packages like chi, gorilla/mux and
+// httprouter provide, to show what they do under the hood. The lesson's
+// server uses http.ServeMux, which since Go 1.22 does most of it too;
+// /mini/ serves the same handlers through a Router (see miniRoutes).
+//
+//	rt := NewRouter()
+//	rt.Use(httpmw.Logging(nil))                // every route after this
+//	rt.Get("/users/:id", userHandler)          // r.PathValue("id")
+//	rt.Get("/files/*path", fileHandler)        // the rest of the path
+//	rt.Group("/admin", func(admin *Router) {   // /admin/...
+//		admin.Use(httpmw.BasicAuth(...))       // only the group's routes
+//		admin.Post("/users/:id/delete", deleteHandler, csrfProtect)
+//	})
+//	rt.NotFound(http.HandlerFunc(notFound))
+//
+// A request is matched segment by segment: a literal segment must be the
+// same, a :name segment matches any one segment, and a *name segment, at
+// the end, the rest of the path. When more than one route matches, the
+// one with the most literal segments wins, so /users/new beats
+// /users/:id whichever was added first. The segments the parameters
+// matched are set with r.SetPathValue, so a handler reads them with
+// r.PathValue, just as it would behind a ServeMux.
+type Router struct {
+	routes     *routeTable // shared with the router's groups
+	prefix     string
+	middleware []httpmw.Middleware
+}
+
+// routeTable is every route of a router and its groups, and what to do
+// when none fits
+type routeTable struct {
+	routes           []route
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.Handler // with its middleware
+}
+
+// NewRouter returns a router with no routes, which answers every request
+// with a 404
+func NewRouter() *Router {
+	return &Router{routes: &routeTable{
+		notFound:         http.NotFoundHandler(),
+		methodNotAllowed: http.HandlerFunc(methodNotAllowed),
+	}}
+}
+
+// Use adds middleware to the routes added after it, on this router and
+// its groups. The first added runs first, as with httpmw.Chain.
+func (rt *Router) Use(middleware ...httpmw.Middleware) {
+	rt.middleware = append(rt.middleware, middleware...)
+}
+
+// Handle adds a route for method and pattern. The middleware runs after
+// the router's and the group's, and only for this route.
+func (rt *Router) Handle(method, pattern string, handler http.Handler, middleware ...httpmw.Middleware) {
+	pattern = rt.prefix + pattern
+	if !strings.HasPrefix(pattern, "/") {
+		panic("router: pattern " + pattern + " doesn't start with /")
+	}
+	for _, route := range rt.routes.routes {
+		if route.method == method && route.pattern == pattern {
+			panic("router: " + method + " " + pattern + " is already a route")
+		}
+	}
+	segments := strings.Split(pattern[1:], "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "*") && i != len(segments)-1 {
+			panic("router: " + segment + " isn't the last segment of " + pattern)
+		}
+	}
+	all := append(append([]httpmw.Middleware{}, rt.middleware...), middleware...)
+	rt.routes.routes = append(rt.routes.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  httpmw.Chain(handler, all...),
+	})
+}
+
+// Get, Post and Delete are Handle for their method, with a HandlerFunc
+func (rt *Router) Get(pattern string, handler http.HandlerFunc, middleware ...httpmw.Middleware) {
+	rt.Handle(http.MethodGet, pattern, handler, middleware...)
+}
+
+func (rt *Router) Post(pattern string, handler http.HandlerFunc, middleware ...httpmw.Middleware) {
+	rt.Handle(http.MethodPost, pattern, handler, middleware...)
+}
+
+func (rt *Router) Delete(pattern string, handler http.HandlerFunc, middleware ...httpmw.Middleware) {
+	rt.Handle(http.MethodDelete, pattern, handler, middleware...)
+}
+
+// Group calls fn with a router whose routes all start with prefix, and
+// which has its own middleware on top of this router's so far. Its
+// routes are this router's: ServeHTTP here serves them.
+func (rt *Router) Group(prefix string, fn func(*Router)) {
+	fn(&Router{
+		routes:     rt.routes,
+		prefix:     rt.prefix + prefix,
+		middleware: append([]httpmw.Middleware{}, rt.middleware...),
+	})
+}
+
+// NotFound sets what answers a request whose path no route matches. No
+// middleware runs for it, since there's no route; wrap handler in any it
+// needs.
+func (rt *Router) NotFound(handler http.Handler) {
+	rt.routes.notFound = handler
+}
+
+// MethodNotAllowed sets what answers a request whose path a route
+// matches, but not with its method. The Allow header, listing the
+// methods that would have worked, is set before it's called; as with
+// NotFound, no middleware runs.
+func (rt *Router) MethodNotAllowed(handler http.Handler) {
+	rt.routes.methodNotAllowed = handler
+}
+
+// ServeHTTP finds the route for r, sets its path parameters, and calls
+// its handler
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	var best *route
+	var bestParams map[string]string
+	bestScore := -1
+	var allowed []string
+	for i := range rt.routes.routes {
+		route := &rt.routes.routes[i]
+		params, score, ok := route.match(path)
+		if !ok {
+			continue
+		}
+		// GET routes answer HEAD too, as ServeMux's do
+		if route.method != r.Method && !(route.method == http.MethodGet && r.Method == http.MethodHead) {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		if score > bestScore {
+			best, bestParams, bestScore = route, params, score
+		}
+	}
+
+	switch {
+	case best != nil:
+		for name, value := range bestParams {
+			r.SetPathValue(name, value)
+		}
+		best.handler.ServeHTTP(w, r)
+	case allowed != nil:
+		w.Header().Set("Allow", allowHeader(allowed))
+		rt.routes.methodNotAllowed.ServeHTTP(w, r)
+	default:
+		rt.routes.notFound.ServeHTTP(w, r)
+	}
+}
+
+// match reports whether path, split at its slashes, fits the route, with
+// the parameters it sets and how many literal segments it matched
+func (rt *route) match(path []string) (map[string]string, int, bool) {
+	params := make(map[string]string)
+	score := 0
+	for i, segment := range rt.segments {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			params[segment[1:]] = strings.Join(path[i:], "/")
+			return params, score, true
+		case i >= len(path):
+			return nil, 0, false
+		case strings.HasPrefix(segment, ":"):
+			if path[i] == "" {
+				return nil, 0, false
+			}
+			params[segment[1:]] = path[i]
+		case segment == path[i]:
+			score++
+		default:
+			return nil, 0, false
+		}
+	}
+	if len(path) != len(rt.segments) {
+		return nil, 0, false
+	}
+	return params, score, true
+}
+
+// allowHeader lists methods once each, in order, with HEAD wherever GET
+// is
+func allowHeader(methods []string) string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, method := range methods {
+		for _, m := range []string{method, http.MethodHead} {
+			if !seen[m] && (m == method || method == http.MethodGet) {
+				seen[m] = true
+				list = append(list, m)
+			}
+		}
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// methodNotAllowed is a Router's 405 unless MethodNotAllowed changes it
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// miniRoutes serves some of the lesson's routes through a Router, as
+// registerRoutes mounts it under /mini/. The handlers are the ones the
+// ServeMux calls, reading the same r.PathValue.
+func miniRoutes() *Router {
+	rt := NewRouter()
+	// Middleware for every route. NewServer's chain already gives every
+	// request its ID, logging and so on, so this only adds what's the
+	// Router's own.
+	rt.Use(routedBy("mini"))
+	rt.Get("/hello/:name", helloNameHandler)
+	rt.Group("/users", func(users *Router) {
+		users.Get("", getAllUsers)
+		users.Post("", createUser)
+		users.Get("/:id", userHandler)
+	})
+	// Middleware for one route only
+	rt.Get("/static/*path", miniStaticHandler, cacheVersionedAssets)
+	// Middleware for a group of routes
+	rt.Group("/admin", func(admin *Router) {
+		admin.Use(httpmw.BasicAuth(adminRealm, adminUser, adminPassword))
+		admin.Get("", adminHandler)
+		admin.Post("/users/:id/delete", adminDeleteUserHandler, csrfProtect)
+	})
+	rt.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "The mini router has no route for "+r.URL.Path, http.StatusNotFound)
+	}))
+	rt.MethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, r.Method+" isn't allowed here, only "+w.Header().Get("Allow"), http.StatusMethodNotAllowed)
+	}))
+	return rt
+}
+
+// routedBy is middleware that names the router that found the route, in
+// an X-Router header
+func routedBy(name string) httpmw.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Router", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GET /mini/static/*path serves a static file, *path being the rest of
+// the URL's path
+func miniStaticHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, staticFS(), path)
+}
@@ -0,0 +1,248 @@
+package lesson09
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP forgets everything between requests. A session is how a server
+// remembers a visitor anyway: it gives the browser a cookie with a
+// random ID, keeps what it knows about the visitor under that ID, and
+// looks it up again when the cookie comes back:
+//
+//	Set-Cookie: lesson09_session=3f9c...e1.kW2x...; Path=/; HttpOnly; SameSite=Lax
+//
+// The part after the dot is an HMAC of the ID with a key only the server
+// knows, so a cookie the server didn't issue, or one with the ID edited,
+// is turned away before the store is even asked. The IDs are random
+// enough not to be guessed anyway; the signature is what lets a server
+// trust a cookie it can't look up, which is how sessions that live in
+// the cookie itself work.
+//
+// Sessions are kept in memory, so they're gone when the server stops,
+// and each lasts sessionTTL after its last use.
+
+const (
+	// sessionCookie names the cookie that carries the session ID
+	sessionCookie = "lesson09_session"
+	// sessionTTL is how long a session lasts without being used
+	sessionTTL = 30 * time.Minute
+)
+
+// Session is what the server knows about one visitor
+type Session struct {
+	ID      string
+	UserID  int    // who logged in, or 0
+	Visits  int    // how many times they've loaded the home page
+	Flash   string // a message for the next page, shown once
+	Expires time.Time
+
+	// CSRFToken is what this visitor's forms must send back; see csrf.go
+	CSRFToken string
+}
+
+// sessions is the lesson's session store; NewServer puts its Middleware
+// in front of every route
+var sessions = newSessionStore(newSessionKey(), sessionTTL)
+
+// sessionStore keeps the sessions in memory, and signs and checks their
+// cookies with key
+type sessionStore struct {
+	key []byte
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func newSessionStore(key []byte, ttl time.Duration) *sessionStore {
+	return &sessionStore{key: key, ttl: ttl, sessions: make(map[string]*Session)}
+}
+
+// newSessionKey makes a random signing key. A new one every start is
+// fine while the sessions themselves don't outlive the process.
+func newSessionKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic(err)
+	}
+	return key
+}
+
+type sessionKey struct{}
+
+// Middleware looks up the session whose cookie came with the request, and
+// puts a copy of it in the request's context for sessionFrom. A request
+// without one, or with one that's forged or expired, gets an empty
+// Session; nothing is stored, and no cookie set, until a handler changes
+// it with Update.
+func (s *sessionStore) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := s.lookup(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, &session)))
+	})
+}
+
+// sessionFrom is r's session, as Middleware found it and as Update,
+// Renew and Destroy have left it since, or an empty one
+func sessionFrom(ctx context.Context) Session {
+	if session, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		return *session
+	}
+	return Session{}
+}
+
+// remember makes session what sessionFrom returns for r from now on, so
+// a second Update in the same request changes the session the first one
+// started, rather than starting another
+func remember(r *http.Request, session Session) {
+	if current, ok := r.Context().Value(sessionKey{}).(*Session); ok {
+		*current = session
+	}
+}
+
+// lookup finds the session r's cookie names, if it's signed, stored and
+// not expired
+func (s *sessionStore) lookup(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return Session{}, false
+	}
+	id, ok := s.verify(cookie.Value)
+	if !ok {
+		return Session{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	if !clk.Now().Before(session.Expires) {
+		delete(s.sessions, id)
+		return Session{}, false
+	}
+	return *session, true
+}
+
+// Update changes r's session with fn, starting one if r hasn't got one,
+// and sends the cookie with its new expiry. Call it before writing the
+// response, since it sets a header. It returns the session as fn left it.
+func (s *sessionStore) Update(w http.ResponseWriter, r *http.Request, fn func(*Session)) Session {
+	id := sessionFrom(r.Context()).ID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !clk.Now().Before(session.Expires) {
+		session = s.start()
+	}
+	fn(session)
+	saved := s.save(w, r, session)
+	remember(r, saved)
+	return saved
+}
+
+// Renew is Update with a new ID, for logging in: an ID an attacker got
+// the browser to use before (session fixation) is worth nothing after.
+// What the old session held is carried over, except its CSRF token: the
+// new session gets its own.
+func (s *sessionStore) Renew(w http.ResponseWriter, r *http.Request, fn func(*Session)) Session {
+	old := sessionFrom(r.Context())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, old.ID)
+	session := s.start()
+	session.UserID, session.Visits, session.Flash = old.UserID, old.Visits, old.Flash
+	fn(session)
+	saved := s.save(w, r, session)
+	remember(r, saved)
+	return saved
+}
+
+// Destroy forgets r's session, and tells the browser to drop the cookie
+func (s *sessionStore) Destroy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delete(s.sessions, sessionFrom(r.Context()).ID)
+	s.mu.Unlock()
+	remember(r, Session{})
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// Len is how many sessions are stored, expired ones included until
+// they're swept
+func (s *sessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// start stores a new, empty session, after sweeping out the expired ones
+// so the store doesn't grow with every visitor who never comes back.
+// s.mu must be held.
+func (s *sessionStore) start() *Session {
+	now := clk.Now()
+	for id, session := range s.sessions {
+		if !now.Before(session.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	session := &Session{ID: hex.EncodeToString(b)}
+	s.sessions[session.ID] = session
+	return session
+}
+
+// save pushes session's expiry out by the TTL, and sets its cookie.
+// s.mu must be held.
+func (s *sessionStore) save(w http.ResponseWriter, r *http.Request, session *Session) Session {
+	session.Expires = clk.Now().Add(s.ttl)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.sign(session.ID),
+		Path:     "/",
+		MaxAge:   int(s.ttl.Seconds()),
+		HttpOnly: true,                 // no JavaScript, so no stealing it with XSS
+		Secure:   r.TLS != nil,         // with -tls, never sent over plain HTTP
+		SameSite: http.SameSiteLaxMode, // not sent with other sites' POSTs
+	})
+	return *session
+}
+
+// sign returns id with its signature: id, a dot, and the HMAC
+func (s *sessionStore) sign(id string) string {
+	return id + "." + base64.RawURLEncoding.EncodeToString(s.mac(id))
+}
+
+// verify returns the ID in a cookie value from sign, if the signature is
+// right. hmac.Equal takes as long whatever the bytes, so the time it
+// takes says nothing about how close a forgery came.
+func (s *sessionStore) verify(value string) (string, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(id)) {
+		return "", false
+	}
+	return id, true
+}
+
+func (s *sessionStore) mac(id string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprint(mac, id)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,268 @@
+package lesson09
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang-lab/lab/domain"
+)
+
+// templateFiles holds the HTML pages, parsed once at startup
+//
+//go:embed templates
+var templateFiles embed.FS
+
+// pages are the parsed templates, one set per page, with funcMap
+// available to all of them. Like template.Must, a page that doesn't
+// parse stops the lesson at startup rather than on its first request.
+var pages = func() map[string]*template.Template {
+	sets, err := parsePages(templateFiles)
+	if err != nil {
+		panic(err)
+	}
+	return sets
+}()
+
+// parsePages parses each page in templates/ with the layout and the
+// partials. Every page defines "title" and "content" for the layout to
+// fill in, and two pages' "content" can't share a set, so each page gets
+// its own: a clone of the layout and partials, with the page added. The
+// sets are keyed by the page's file name.
+func parsePages(files fs.FS) (map[string]*template.Template, error) {
+	base, err := template.New("").Funcs(funcMap).ParseFS(files, "templates/layout.html", "templates/partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+	names, err := fs.Glob(files, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	sets := make(map[string]*template.Template)
+	for _, name := range names {
+		page := path.Base(name)
+		if page == "layout.html" {
+			continue
+		}
+		set, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if sets[page], err = set.ParseFS(files, name); err != nil {
+			return nil, err
+		}
+	}
+	return sets, nil
+}
+
+// funcMap is the lesson's library of template functions. Each is an
+// ordinary Go function, tested on its own in lesson_test.go; arguments
+// come first and the value last, so they work at the end of a pipeline:
+//
+//	{{.CreatedAt | formatDate "2 Jan 2006"}}
+//	{{.Bio | truncate 40}}
+var funcMap = template.FuncMap{
+	"formatDate": formatDate,
+	"truncate":   truncate,
+	"pluralize":  pluralize,
+	"formatSize": formatSize,
+	"markdown":   markdown,
+	"csrfField":  csrfField,
+	"asset":      asset,
+}
+
+// layoutData is what the layout shows on every page, whichever it is;
+// each page's data embeds it
+type layoutData struct {
+	User      *domain.User // who's logged in, or nil
+	CSRFToken string       // for csrfField, in the page's forms and the nav's
+}
+
+// layoutFor is the layoutData for r, from its session. It starts one if
+// r hasn't got one, for the CSRF token, so call it before writing the
+// response.
+func layoutFor(w http.ResponseWriter, r *http.Request) layoutData {
+	data := layoutData{CSRFToken: csrfToken(w, r)}
+	if user, ok := getUser(sessionFrom(r.Context()).UserID); ok {
+		data.User = &user
+	}
+	return data
+}
+
+// render executes the named page in the layout, into a buffer first, so
+// a template error becomes a clean 500 instead of half a page
+func render(w http.ResponseWriter, name string, data interface{}) {
+	renderStatus(w, http.StatusOK, name, data)
+}
+
+// renderStatus is render with a status other than 200 OK
+func renderStatus(w http.ResponseWriter, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	page, ok := pages[name]
+	if !ok {
+		log.Printf("Error rendering %s: no such page", name)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := page.ExecuteTemplate(&buf, "layout", data); err != nil {
+		log.Printf("Error rendering %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error writing %s: %v", name, err)
+	}
+}
+
+// formatDate formats t with a time.Format layout, in UTC so pages read
+// the same wherever the server runs. The zero time is "never".
+func formatDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format(layout)
+}
+
+// truncate shortens s to at most n characters, ending with "…" if it cut
+// anything. It counts runes, not bytes, so it never splits a character.
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	return strings.TrimRight(string(runes[:n-1]), " ") + "…"
+}
+
+// pluralize returns "1 user" or "3 users": the count, then the singular
+// or plural word to match
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
+
+// The Markdown syntax markdown understands, matched after HTML escaping
+// so the patterns only ever see text
+var (
+	markdownBold   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownItalic = regexp.MustCompile(`\*([^*]+)\*`)
+	markdownCode   = regexp.MustCompile("`([^`]+)`")
+	markdownLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// markdown renders a small, safe subset of Markdown: paragraphs,
+// **bold**, *italic*, `code` and [links](https://...). It escapes the
+// text before adding any tags, so user input can't inject HTML, and only
+// links to http, https and mailto URLs, so it can't inject javascript:.
+// That makes its output safe to return as template.HTML, which the
+// template then inserts without escaping it again.
+func markdown(s string) template.HTML {
+	var out strings.Builder
+	for _, para := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		// Code spans and links are set aside behind placeholders while
+		// the rest is formatted, so a * in them stays a *
+		var saved []string
+		save := func(html string) string {
+			saved = append(saved, html)
+			return fmt.Sprintf("\x00%d\x00", len(saved)-1)
+		}
+		text := template.HTMLEscapeString(strings.ReplaceAll(para, "\x00", ""))
+		text = markdownCode.ReplaceAllStringFunc(text, func(m string) string {
+			return save("<code>" + markdownCode.FindStringSubmatch(m)[1] + "</code>")
+		})
+		text = markdownLink.ReplaceAllStringFunc(text, func(m string) string {
+			parts := markdownLink.FindStringSubmatch(m)
+			if !safeLink(parts[2]) {
+				return parts[1]
+			}
+			return save(`<a href="` + parts[2] + `">` + parts[1] + `</a>`)
+		})
+		text = markdownBold.ReplaceAllString(text, "<strong>$1</strong>")
+		text = markdownItalic.ReplaceAllString(text, "<em>$1</em>")
+		for i := len(saved) - 1; i >= 0; i-- {
+			text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), saved[i], 1)
+		}
+		text = strings.ReplaceAll(text, "\n", "<br>\n")
+		out.WriteString("<p>" + text + "</p>\n")
+	}
+	return template.HTML(out.String())
+}
+
+// safeLink reports whether an (already escaped) link target is a URL a
+// page may link to: http, https, mailto, or relative
+func safeLink(target string) bool {
+	u, err := url.Parse(html.UnescapeString(target))
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// assetVersions caches each static file's content hash for asset
+var (
+	assetMu       sync.Mutex
+	assetVersions = make(map[string]string)
+)
+
+// asset returns the URL of a file in static/ with a version taken from
+// its contents, like /static/style.css?v=1a2b3c4d. Editing the file
+// changes the URL, so browsers can cache assets forever (see
+// cacheVersionedAssets) and still never show a stale one. Embedded
+// files can't change, so their versions are worked out once; files from
+// -static-dir are hashed every time, so an edit gets a new URL at once.
+func asset(path string) (string, error) {
+	assetMu.Lock()
+	defer assetMu.Unlock()
+	version, ok := assetVersions[path]
+	if !ok || staticDir != "" {
+		data, err := fs.ReadFile(staticFS(), path)
+		if err != nil {
+			return "", fmt.Errorf("asset %q: %w", path, err)
+		}
+		sum := sha256.Sum256(data)
+		version = hex.EncodeToString(sum[:4])
+		if staticDir == "" {
+			assetVersions[path] = version
+		}
+	}
+	return "/static/" + path + "?v=" + version, nil
+}
+
+// cacheVersionedAssets lets browsers keep a static file for a year when
+// the URL has a version, since a new version gets a new URL
+func cacheVersionedAssets(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") != "" {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,139 @@
+package lesson09
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// With -tls the server speaks HTTPS, with a certificate it makes for
+// itself at startup, and the plain HTTP port only redirects there:
+//
+//	http://localhost:8080/users/1  →  308  →  https://localhost:8443/users/1
+//
+// A certificate made this way is signed by its own key rather than by a
+// certificate authority, so nothing trusts it: browsers warn, and curl
+// needs -k (or --cacert with the certificate). That's fine for learning
+// how a TLS server is put together, and for local development. A real
+// server loads a certificate a CA issued, like Let's Encrypt's, with
+// tls.LoadX509KeyPair or golang.org/x/crypto/acme/autocert.
+
+// certHosts are the names the certificate is good for: the server is
+// reached on this machine, so localhost and its addresses
+var certHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// certValidity is how long a self-signed certificate lasts. A new one is
+// made every start, so a day is plenty.
+const certValidity = 24 * time.Hour
+
+// selfSignedCert makes a new key and a certificate for hosts, signed by
+// that key
+func selfSignedCert(hosts []string) (tls.Certificate, error) {
+	// ECDSA P-256: small, fast, and supported by every TLS client
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	// Serials have to be unique per issuer, so a random 128 bits
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"Golang Lab"}},
+		NotBefore:    now.Add(-time.Minute), // in case the client's clock is a little behind
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	// Clients check the name they dialed against these, not CommonName
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	// The template is both the certificate and its issuer: self-signed
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// fingerprint is the certificate's SHA-256, as a browser shows it, for
+// checking that the certificate it warns about is this server's
+func fingerprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+// UseTLS makes server speak HTTPS with cert, from then on: Serve calls
+// ServeTLS rather than Serve for a server with a TLSConfig.
+//
+// On its own port, with the certificate in files, all of it is one line:
+// server.ListenAndServeTLS("cert.pem", "key.pem"). With the certificate in
+// TLSConfig already, the file names are left empty.
+func UseTLS(server *http.Server, cert tls.Certificate) {
+	server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12, // 1.0 and 1.1 are broken, and deprecated
+	}
+}
+
+// NewRedirectServer returns a server that sends every request to the
+// same URL over HTTPS, on httpsPort. 308 rather than 301 keeps the method
+// and body, so a form POSTed over HTTP is POSTed again over HTTPS.
+//
+// There's no Strict-Transport-Security header on the HTTPS side, which
+// would tell browsers to skip the HTTP step next time: they'd remember it
+// for localhost, and every other server on localhost would have to speak
+// HTTPS too.
+func NewRedirectServer(httpsPort int) *http.Server {
+	return &http.Server{
+		Handler:      redirectToHTTPS(httpsPort),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
+
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Trim(r.Host, "[]") // an IPv6 address without a port
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h // the HTTP port's; the HTTPS one replaces it
+		}
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(httpsPort)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// SecureURL is where a browser reaches the HTTPS server on listener
+func SecureURL(listener net.Listener) string {
+	return fmt.Sprintf("https://localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+}
@@ -0,0 +1,292 @@
+package lesson09
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// /upload takes a file from a browser's form and keeps it on disk, in
+// uploadDir. The request body is read as a stream: r.MultipartReader
+// hands over the form's parts one at a time, and the file part is copied
+// straight to its file, so a 5 MB upload never sits in memory whole, as
+// it would with r.ParseMultipartForm.
+
+// maxUploadSize is the largest file /upload keeps
+const maxUploadSize = 5 << 20
+
+// maxUploadOverhead is what the rest of a multipart body may add to the
+// file: the boundaries, each part's headers, and the CSRF field
+const maxUploadOverhead = 64 << 10
+
+// uploadDir is where uploads are kept; -upload-dir sets it
+var uploadDir = filepath.Join(os.TempDir(), "lesson09-uploads")
+
+// uploadTypes are the types /upload keeps, as http.DetectContentType
+// finds them from the file's first 512 bytes, with the extension each
+// is saved under. The browser's own Content-Type for the part is
+// whatever the file was called, so it isn't asked.
+var uploadTypes = map[string]string{
+	"image/png":                 ".png",
+	"image/jpeg":                ".jpg",
+	"image/gif":                 ".gif",
+	"application/pdf":           ".pdf",
+	"text/plain; charset=utf-8": ".txt",
+}
+
+// What's wrong with an upload, for uploadStatus to turn into a response
+var (
+	errNoFile       = errors.New("no file in the form")
+	errEmptyUpload  = errors.New("empty file")
+	errUploadTooBig = errors.New("file too large")
+	errUploadType   = errors.New("file type not allowed")
+	errNotMultipart = errors.New("body isn't multipart/form-data")
+)
+
+// uploadedFile is one file in uploadDir, as the upload page lists it
+type uploadedFile struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// uploadPage is the data for templates/upload.html
+type uploadPage struct {
+	layoutData
+	Files   []uploadedFile
+	MaxSize int64
+	Flash   string
+	Error   string
+}
+
+// GET /upload
+func uploadFormHandler(w http.ResponseWriter, r *http.Request) {
+	renderUploadPage(w, r, http.StatusOK, "")
+}
+
+// renderUploadPage renders the upload page with status, and message as
+// its error if there is one
+func renderUploadPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	files, err := listUploads(uploadDir)
+	if err != nil {
+		log.Printf("Listing uploads: %v", err)
+	}
+	page := uploadPage{
+		layoutData: layoutFor(w, r),
+		Files:      files,
+		MaxSize:    maxUploadSize,
+		Error:      message,
+	}
+	if status == http.StatusOK {
+		page.Flash = popFlash(w, r)
+	}
+	renderStatus(w, status, "upload.html", page)
+}
+
+// POST /upload saves the form's file, then redirects back to the upload
+// page, which lists it; a file that isn't kept gets the page again with
+// why
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	name, size, err := receiveUpload(w, r, uploadDir)
+	if err != nil {
+		status, message := uploadStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Upload failed: %v", err)
+		}
+		renderUploadPage(w, r, status, message)
+		return
+	}
+	sessions.Update(w, r, func(s *Session) { s.Flash = fmt.Sprintf("Uploaded %s (%s).", name, formatSize(size)) })
+	http.Redirect(w, r, "/upload", http.StatusSeeOther)
+}
+
+// receiveUpload reads r's multipart body as a stream, skipping parts
+// until the one named "file", and saves that in dir. It returns the
+// name the file was saved under, and its size.
+func receiveUpload(w http.ResponseWriter, r *http.Request, dir string) (string, int64, error) {
+	// The limit is on the whole body, so an upload that's far too big is
+	// cut off there; saveUpload holds the file itself to maxUploadSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+maxUploadOverhead)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return "", 0, errNotMultipart
+	}
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return "", 0, errNoFile
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		if part.FileName() == "" {
+			return "", 0, errNoFile
+		}
+		return saveUpload(dir, part.FileName(), part)
+	}
+}
+
+// saveUpload checks the type of the file body holds, from its first 512
+// bytes, then copies it into dir under a safe version of name, with the
+// extension of the type it is. A file that turns out to be too big is
+// removed again.
+func saveUpload(dir, name string, body io.Reader) (string, int64, error) {
+	buffered := bufio.NewReader(body)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	if len(head) == 0 {
+		return "", 0, errEmptyUpload
+	}
+	ext, ok := uploadTypes[http.DetectContentType(head)]
+	if !ok {
+		return "", 0, errUploadType
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	f, err := createUpload(dir, uploadName(name, ext))
+	if err != nil {
+		return "", 0, err
+	}
+	// One byte past the limit is enough to know it's over
+	size, err := io.Copy(f, io.LimitReader(buffered, maxUploadSize+1))
+	if err == nil && size > maxUploadSize {
+		err = errUploadTooBig
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, errors.Join(err, os.Remove(f.Name()))
+	}
+	return filepath.Base(f.Name()), size, nil
+}
+
+// createUpload creates name in dir, or, if that's taken, name-2, name-3
+// and so on: an upload never replaces another
+func createUpload(dir, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// uploadName makes the name a browser sent safe to use as a file name:
+// only its last element, whichever slashes the browser's system uses,
+// only letters, digits, '-' and '_' in the rest, and ext at the end, so
+// the extension the file is served with matches what's in it
+func uploadName(name, ext string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	if strings.Trim(name, "_") == "" {
+		name = "upload"
+	}
+	if len(name) > 100 {
+		name = name[:100] // all ASCII now, so no character is split
+	}
+	return name + ext
+}
+
+// uploadStatus is the status and message for an error from
+// receiveUpload
+func uploadStatus(err error) (int, string) {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr), errors.Is(err, errUploadTooBig):
+		return http.StatusRequestEntityTooLarge, "The file is larger than " + formatSize(maxUploadSize) + "."
+	case errors.Is(err, errUploadType):
+		return http.StatusUnsupportedMediaType, "Only PNG, JPEG and GIF images, PDFs and plain text can be uploaded."
+	case errors.Is(err, errEmptyUpload):
+		return http.StatusBadRequest, "The file is empty."
+	case errors.Is(err, errNoFile), errors.Is(err, errNotMultipart):
+		return http.StatusBadRequest, "Choose a file to upload."
+	}
+	return http.StatusInternalServerError, "The upload failed. Try again."
+}
+
+// listUploads lists the files in dir, by name. A dir that doesn't exist
+// yet has none.
+func listUploads(dir string) ([]uploadedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []uploadedFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		files = append(files, uploadedFile{Name: entry.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return files, nil
+}
+
+// GET /uploads/{name} serves an uploaded file. Its extension came from
+// its contents when it was saved, so the Content-Type ServeFile picks
+// from it is right, and nosniff stops a browser guessing another.
+func uploadedFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	ext := filepath.Ext(name)
+	if name != uploadName(name, ext) || !isUploadExt(ext) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filepath.Join(uploadDir, name))
+}
+
+// isUploadExt reports whether ext is one saveUpload gives files
+func isUploadExt(ext string) bool {
+	for _, e := range uploadTypes {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSize is a byte count for people: 512 B, 1.5 KB, 5.0 MB
+func formatSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
@@ -0,0 +1,289 @@
+// Package client is a typed Go client for the lesson's user API: the
+// other side of the handlers, as a program that uses the API would write
+// it. A UserClient turns method calls into requests, and responses back
+// into domain.Users, or into an *APIError that errors.Is can tell apart:
+//
+//	users := client.New("http://localhost:8080/api/v1")
+//	if err := users.Login(ctx, "john@example.com", "golab"); err != nil { ... }
+//	user, err := users.CreateUser(ctx, domain.CreateUserRequest{Name: "Ada", Email: "ada@example.com", Age: 36})
+//	if errors.Is(err, client.ErrValidation) { ... }
+//
+// Requests that are safe to send twice are retried when the server is
+// briefly unable to answer them, and every attempt has a timeout. A 429
+// is always retried, after the Retry-After the server sent: the retries
+// back off, with jitter, so clients turned away together don't all come
+// back together and get turned away again.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// UserClient calls one version of the user API. Its fields can be
+// changed after New, before its first request.
+type UserClient struct {
+	// BaseURL is the API's, with the version: http://localhost:8080/api/v1.
+	// The client speaks v1, whose users are domain.Users.
+	BaseURL string
+	// HTTPClient sends the requests; its Timeout is each attempt's
+	HTTPClient *http.Client
+	// Token goes in an Authorization: Bearer header; Login sets it
+	Token string
+	// APIKey goes in an X-API-Key header, instead of a token
+	APIKey string
+	// Retries is how many more times a request is sent after it fails in
+	// a way worth retrying (see retryable)
+	Retries int
+	// Backoff is the wait before the first retry, doubling for each one
+	// after it up to MaxBackoff, and then jittered (see retryWait). A
+	// Retry-After header from the server overrides it.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// OnRetry, if set, is called before each retry's wait, with the
+	// retry's number from 1, the wait, and why the last attempt failed
+	OnRetry func(retry int, wait time.Duration, err error)
+}
+
+// New returns a client of the API at baseURL, with a 10 second timeout
+// and two retries
+func New(baseURL string) *UserClient {
+	return &UserClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Retries:    2,
+		Backoff:    200 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+	}
+}
+
+// maxRetryWait is the longest Retry-After the client waits out. A daily
+// quota says to come back tomorrow, which is an error, not a retry.
+const maxRetryWait = 30 * time.Second
+
+// ListOptions picks a page of users, filtered and sorted; zero values
+// leave the server's defaults
+type ListOptions struct {
+	Page          int
+	Limit         int
+	Sort          string // a field, - in front for descending: -age
+	MinAge        int
+	EmailContains string
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.MinAge > 0 {
+		q.Set("min_age", strconv.Itoa(o.MinAge))
+	}
+	if o.EmailContains != "" {
+		q.Set("email_contains", o.EmailContains)
+	}
+	return q
+}
+
+// Login signs in as the user with email, and sends the token it gets
+// with every request after
+func (c *UserClient) Login(ctx context.Context, email, password string) error {
+	var token models.TokenResponse
+	if err := c.do(ctx, http.MethodPost, "/auth/login", models.LoginRequest{Email: email, Password: password}, &token, nil); err != nil {
+		return err
+	}
+	c.Token = token.Token
+	return nil
+}
+
+// ListUsers returns a page of users, and where it is among the pages
+func (c *UserClient) ListUsers(ctx context.Context, opts ListOptions) ([]domain.User, domain.PageMeta, error) {
+	path := "/users"
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var users []domain.User
+	var meta domain.PageMeta
+	if err := c.do(ctx, http.MethodGet, path, nil, &users, &meta); err != nil {
+		return nil, domain.PageMeta{}, err
+	}
+	return users, meta, nil
+}
+
+// GetUser returns the user with id
+func (c *UserClient) GetUser(ctx context.Context, id int) (domain.User, error) {
+	var user domain.User
+	err := c.do(ctx, http.MethodGet, "/users/"+strconv.Itoa(id), nil, &user, nil)
+	return user, err
+}
+
+// CreateUser creates a user, and returns it with the ID the server gave it
+func (c *UserClient) CreateUser(ctx context.Context, req domain.CreateUserRequest) (domain.User, error) {
+	var user domain.User
+	err := c.do(ctx, http.MethodPost, "/users", req, &user, nil)
+	return user, err
+}
+
+// UpdateUser changes the fields of req that are set, and returns the user
+// as it is now. req.Version has to be the version of the user the change
+// was made to: if someone changed it since, the error is ErrConflict, and
+// the user should be fetched again.
+func (c *UserClient) UpdateUser(ctx context.Context, id int, req domain.UpdateUserRequest) (domain.User, error) {
+	var user domain.User
+	err := c.do(ctx, http.MethodPut, "/users/"+strconv.Itoa(id), req, &user, nil)
+	return user, err
+}
+
+// DeleteUser deletes the user with id
+func (c *UserClient) DeleteUser(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/users/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+// envelope is the part of a domain.APIResponse the client reads, with
+// Data as the type the call expects
+type envelope struct {
+	Data any              `json:"data"`
+	Meta *domain.PageMeta `json:"meta"`
+}
+
+// do sends a request, retrying it if it's worth another try, and decodes
+// the response's data into data and its page into meta, either of which
+// may be nil
+func (c *UserClient) do(ctx context.Context, method, path string, body, data any, meta *domain.PageMeta) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+		if err == nil && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if err := json.NewDecoder(resp.Body).Decode(&envelope{Data: data, Meta: meta}); err != nil {
+				return fmt.Errorf("%s %s: decoding the response: %w", method, path, err)
+			}
+			return nil
+		}
+		if err == nil {
+			err = readAPIError(resp)
+		}
+		// Out of tries, or the caller gave up
+		if attempt == c.Retries || ctx.Err() != nil || !retryable(method, err) {
+			return err
+		}
+
+		wait, ok := c.retryWait(attempt+1, err)
+		if !ok {
+			return err
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(attempt+1, wait, err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// retryWait is how long to wait before retry number retry, after err: as
+// long as a Retry-After said, or else Backoff doubled for each retry
+// before this one, up to MaxBackoff. Either way it's jittered, as a
+// thousand clients turned away in the same second would otherwise all
+// retry in the same instant. A backoff is "equal jitter": half of it,
+// plus up to the other half at random. A Retry-After is never cut short,
+// only spread out by up to Backoff more. ok is false if the server said
+// to wait longer than maxRetryWait.
+func (c *UserClient) retryWait(retry int, err error) (wait time.Duration, ok bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > maxRetryWait {
+			return 0, false
+		}
+		return apiErr.RetryAfter + randomDuration(c.Backoff), true
+	}
+	backoff := c.Backoff << min(retry-1, 30)
+	if c.MaxBackoff > 0 && (backoff > c.MaxBackoff || backoff < c.Backoff) {
+		backoff = c.MaxBackoff
+	}
+	return backoff/2 + randomDuration(backoff-backoff/2), true
+}
+
+// randomDuration is a random duration from 0 up to, but not including, d
+func randomDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// send makes one attempt at a request
+func (c *UserClient) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// retryable reports whether a request that failed with err is worth
+// sending again. A 429 is: the server turned the request away before
+// doing anything with it. A lost connection, a timeout or a 502, 503 or
+// 504 is only for a method that is safe to repeat, as the first try may
+// have done its work before the answer went missing, and a second POST
+// would create a second user.
+func retryable(method string, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return false
+		}
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
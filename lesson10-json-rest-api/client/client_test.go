@@ -0,0 +1,262 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/handlers"
+)
+
+// TestUserClient drives the real API over HTTP: log in, then every call,
+// and the errors that come back typed
+func TestUserClient(t *testing.T) {
+	stop, err := handlers.Start(handlers.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	server := httptest.NewServer(handlers.NewServer().Handler)
+	defer server.Close()
+	ctx := context.Background()
+	users := New(server.URL + "/api/v1")
+
+	// Writes need a token
+	_, err = users.CreateUser(ctx, domain.CreateUserRequest{Name: "Ada", Email: "ada@example.com", Age: 36})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("CreateUser without logging in = %v, want ErrUnauthorized", err)
+	}
+	if err := users.Login(ctx, "john@example.com", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Login with the wrong password = %v, want ErrUnauthorized", err)
+	}
+	if err := users.Login(ctx, "john@example.com", "golab"); err != nil || users.Token == "" {
+		t.Fatalf("Login = %v, token %q", err, users.Token)
+	}
+
+	page, meta, err := users.ListUsers(ctx, ListOptions{Page: 2, Limit: 3, Sort: "age"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 3 || meta.Page != 2 || meta.Limit != 3 || meta.Total == 0 {
+		t.Errorf("ListUsers(page 2 of 3) = %d users, %+v", len(page), meta)
+	}
+
+	created, err := users.CreateUser(ctx, domain.CreateUserRequest{Name: "Ada", Email: "ada@example.com", Age: 36})
+	if err != nil || created.ID == 0 || created.Name != "Ada" {
+		t.Fatalf("CreateUser = %+v, %v", created, err)
+	}
+	name := "Ada Lovelace"
+	updated, err := users.UpdateUser(ctx, created.ID, domain.UpdateUserRequest{Name: &name, Version: &created.Version})
+	if err != nil || updated.Name != name || updated.Age != 36 || updated.Version != created.Version+1 {
+		t.Errorf("UpdateUser = %+v, %v; want the name changed, the age kept, and the next version", updated, err)
+	}
+	if _, err := users.UpdateUser(ctx, created.ID, domain.UpdateUserRequest{Name: &name, Version: &created.Version}); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateUser(an old version) = %v, want ErrConflict", err)
+	}
+	got, err := users.GetUser(ctx, created.ID)
+	if err != nil || got.Name != name {
+		t.Errorf("GetUser = %+v, %v", got, err)
+	}
+	if err := users.DeleteUser(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = users.GetUser(ctx, created.ID)
+	var apiErr *APIError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("GetUser(deleted) = %v, want a 404 APIError", err)
+	}
+	_, err = users.CreateUser(ctx, domain.CreateUserRequest{Email: "not an email", Age: 36})
+	if !errors.Is(err, ErrValidation) || errors.Is(err, ErrBadRequest) || !errors.As(err, &apiErr) || len(apiErr.Details) != 2 {
+		t.Errorf("CreateUser(invalid) = %v, want ErrValidation with 2 details", err)
+	}
+	if _, err := users.GetUser(ctx, -1); err == nil {
+		t.Error("GetUser(-1) succeeded")
+	}
+}
+
+// flaky answers with statuses in turn, then 200, counting the requests
+type flaky struct {
+	statuses []int
+	header   http.Header
+	calls    atomic.Int32
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := int(f.calls.Add(1))
+	if n <= len(f.statuses) {
+		for key, values := range f.header {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.statuses[n-1])
+		fmt.Fprintf(w, `{"error":"try %d"}`, n)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"success":true,"data":{"id":1,"name":"John Doe"}}`)
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	newClient := func(t *testing.T, f *flaky) *UserClient {
+		server := httptest.NewServer(f)
+		t.Cleanup(server.Close)
+		c := New(server.URL)
+		c.Backoff = time.Millisecond
+		return c
+	}
+
+	t.Run("GET is retried after a 503", func(t *testing.T) {
+		f := &flaky{statuses: []int{503, 502}}
+		user, err := newClient(t, f).GetUser(ctx, 1)
+		if err != nil || user.Name != "John Doe" || f.calls.Load() != 3 {
+			t.Errorf("GetUser = %+v, %v after %d calls; want John Doe after 3", user, err, f.calls.Load())
+		}
+	})
+	t.Run("until the retries run out", func(t *testing.T) {
+		f := &flaky{statuses: []int{503, 503, 503, 503}}
+		_, err := newClient(t, f).GetUser(ctx, 1)
+		if !errors.Is(err, ErrServer) || f.calls.Load() != 3 {
+			t.Errorf("GetUser = %v after %d calls; want ErrServer after 3", err, f.calls.Load())
+		}
+	})
+	t.Run("POST isn't retried after a 503", func(t *testing.T) {
+		f := &flaky{statuses: []int{503}}
+		_, err := newClient(t, f).CreateUser(ctx, domain.CreateUserRequest{Name: "Ada"})
+		if !errors.Is(err, ErrServer) || f.calls.Load() != 1 {
+			t.Errorf("CreateUser = %v after %d calls; want ErrServer after 1", err, f.calls.Load())
+		}
+	})
+	t.Run("POST is retried after a 429", func(t *testing.T) {
+		f := &flaky{statuses: []int{429}, header: http.Header{"Retry-After": {"0"}}}
+		if _, err := newClient(t, f).CreateUser(ctx, domain.CreateUserRequest{Name: "Ada"}); err != nil || f.calls.Load() != 2 {
+			t.Errorf("CreateUser = %v after %d calls; want success after 2", err, f.calls.Load())
+		}
+	})
+	t.Run("a Retry-After too long is an error", func(t *testing.T) {
+		f := &flaky{statuses: []int{429}, header: http.Header{"Retry-After": {"86400"}}}
+		_, err := newClient(t, f).GetUser(ctx, 1)
+		var apiErr *APIError
+		if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 24*time.Hour || f.calls.Load() != 1 {
+			t.Errorf("GetUser = %v after %d calls; want ErrRateLimited for a day after 1", err, f.calls.Load())
+		}
+	})
+	t.Run("a Retry-After date is waited out", func(t *testing.T) {
+		at := time.Now().Add(1500 * time.Millisecond).UTC().Format(http.TimeFormat)
+		f := &flaky{statuses: []int{429}, header: http.Header{"Retry-After": {at}}}
+		c := newClient(t, f)
+		var waits []time.Duration
+		c.OnRetry = func(retry int, wait time.Duration, err error) {
+			if retry != len(waits)+1 || !errors.Is(err, ErrRateLimited) {
+				t.Errorf("OnRetry(%d, %v, %v)", retry, wait, err)
+			}
+			waits = append(waits, wait)
+		}
+		// The date is in whole seconds, so it's between 0.5 and 1.5s away
+		if _, err := c.GetUser(ctx, 1); err != nil || len(waits) != 1 || waits[0] < 500*time.Millisecond || waits[0] > 1500*time.Millisecond+c.Backoff {
+			t.Errorf("GetUser = %v after waits %v; want success after one wait of about a second", err, waits)
+		}
+	})
+	t.Run("a 404 isn't retried", func(t *testing.T) {
+		f := &flaky{statuses: []int{404}}
+		_, err := newClient(t, f).GetUser(ctx, 1)
+		if !errors.Is(err, ErrNotFound) || f.calls.Load() != 1 {
+			t.Errorf("GetUser = %v after %d calls; want ErrNotFound after 1", err, f.calls.Load())
+		}
+	})
+	t.Run("a cancelled wait stops", func(t *testing.T) {
+		f := &flaky{statuses: []int{503, 503}}
+		c := newClient(t, f)
+		c.Backoff = time.Hour
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := c.GetUser(ctx, 1); !errors.Is(err, context.DeadlineExceeded) || f.calls.Load() != 1 {
+			t.Errorf("GetUser = %v after %d calls; want the deadline after 1", err, f.calls.Load())
+		}
+	})
+}
+
+// TestRetryWait checks the backoff doubles up to its cap, with jitter, and
+// that a Retry-After is never cut short
+func TestRetryWait(t *testing.T) {
+	c := New("http://localhost")
+	c.Backoff = 100 * time.Millisecond
+	c.MaxBackoff = time.Second
+	busy := &APIError{StatusCode: http.StatusServiceUnavailable}
+	for retry, backoff := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second, // capped
+		64: time.Second,
+	} {
+		for range 50 {
+			wait, ok := c.retryWait(retry, busy)
+			if !ok || wait < backoff/2 || wait >= backoff {
+				t.Fatalf("retry %d: retryWait = %v, %t; want [%v, %v)", retry, wait, ok, backoff/2, backoff)
+			}
+		}
+	}
+
+	limited := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second}
+	for range 50 {
+		if wait, ok := c.retryWait(3, limited); !ok || wait < 2*time.Second || wait >= 2*time.Second+c.Backoff {
+			t.Fatalf("retryWait after Retry-After 2s = %v, %t; want [2s, 2.1s)", wait, ok)
+		}
+	}
+	limited.RetryAfter = time.Hour
+	if _, ok := c.retryWait(1, limited); ok {
+		t.Error("retryWait after Retry-After 1h is ok, want an error instead")
+	}
+}
+
+// TestTimeout checks that an attempt that takes too long is cut off, and
+// retried like a lost connection
+func TestTimeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := New(server.URL)
+	c.HTTPClient.Timeout = 20 * time.Millisecond
+	c.Backoff = time.Millisecond
+	c.Retries = 1
+	if _, err := c.GetUser(context.Background(), 1); err == nil || calls.Load() != 2 {
+		t.Errorf("GetUser = %v after %d calls; want a timeout after 2", err, calls.Load())
+	}
+	if err := c.DeleteUser(context.Background(), 1); err == nil {
+		t.Error("DeleteUser from a server that never answers succeeded")
+	}
+}
+
+// TestAPIErrorFromProxy checks an error that isn't the API's JSON keeps
+// its status
+func TestAPIErrorFromProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>Bad Gateway</html>", http.StatusForbidden)
+	}))
+	defer server.Close()
+	_, err := New(server.URL).GetUser(context.Background(), 1)
+	if !errors.Is(err, ErrForbidden) || err.Error() != "403 Forbidden" {
+		t.Errorf("GetUser = %v, want 403 Forbidden", err)
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// The kinds of error the API answers with, for errors.Is:
+//
+//	if errors.Is(err, client.ErrNotFound) { ... }
+var (
+	ErrValidation   = errors.New("validation failed") // 400 with field errors
+	ErrBadRequest   = errors.New("bad request")       // any other 400
+	ErrUnauthorized = errors.New("unauthorized")      // 401: no token, or a bad one
+	ErrForbidden    = errors.New("forbidden")         // 403
+	ErrNotFound     = errors.New("not found")         // 404
+	ErrConflict     = errors.New("conflict")          // 409, or 412 for a stale If-Match
+	ErrRateLimited  = errors.New("rate limited")      // 429
+	ErrServer       = errors.New("server error")      // 5xx
+)
+
+// APIError is a response the API sent instead of what was asked for.
+// errors.As finds it for the details; errors.Is matches its kind.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Details are the fields that failed validation, with why
+	Details []domain.ValidationError
+	// RetryAfter is how long the server said to wait before trying again
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+	for _, detail := range e.Details {
+		msg += fmt.Sprintf("; %s: %s", detail.Field, detail.Message)
+	}
+	return msg
+}
+
+// Is matches e's status code to one of the Err values
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest && len(e.Details) > 0
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest && len(e.Details) == 0
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// maxErrorBody caps how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// readAPIError reads an error response, and closes it. The body is the
+// API's domain.ErrorResponse; from anything else in front of the API,
+// like a proxy's HTML page, the status alone is kept.
+func readAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	// Retry-After is a number of seconds, or else a date
+	retryAfter := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(retryAfter); err == nil {
+		apiErr.RetryAfter = max(time.Until(at), 0)
+	}
+	var body domain.ErrorResponse
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") || json.Unmarshal(data, &body) != nil {
+		return apiErr
+	}
+	if body.Error != "" {
+		apiErr.Message = body.Error
+	}
+	apiErr.Details = body.Details
+	return apiErr
+}
@@ -0,0 +1,66 @@
+package lesson10
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/client"
+)
+
+// demonstrateClient drives the API at baseURL with the client package, as
+// another Go program would: log in, page through users, create one,
+// change it, read it back and delete it, then get some errors on purpose
+// to show how they come back
+func demonstrateClient(ctx context.Context, w io.Writer, baseURL, email, password string) error {
+	fmt.Fprintln(w, "\n--- Client Demonstration ---")
+	users := client.New(baseURL)
+
+	if err := users.Login(ctx, email, password); err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+	fmt.Fprintf(w, "Logged in as %s\n", email)
+
+	page, meta, err := users.ListUsers(ctx, client.ListOptions{Limit: 3, Sort: "-age"})
+	if err != nil {
+		return fmt.Errorf("listing users: %w", err)
+	}
+	fmt.Fprintf(w, "Oldest %d of %d users:\n", len(page), meta.Total)
+	for _, user := range page {
+		fmt.Fprintf(w, "  #%d %s, %d\n", user.ID, user.Name, user.Age)
+	}
+
+	created, err := users.CreateUser(ctx, domain.CreateUserRequest{Name: "Grace Hopper", Email: "grace@example.com", Age: 85})
+	if err != nil {
+		return fmt.Errorf("creating a user: %w", err)
+	}
+	fmt.Fprintf(w, "Created #%d %s\n", created.ID, created.Name)
+
+	age := 86
+	if _, err := users.UpdateUser(ctx, created.ID, domain.UpdateUserRequest{Age: &age, Version: &created.Version}); err != nil {
+		return fmt.Errorf("updating user %d: %w", created.ID, err)
+	}
+	fetched, err := users.GetUser(ctx, created.ID)
+	if err != nil {
+		return fmt.Errorf("getting user %d: %w", created.ID, err)
+	}
+	fmt.Fprintf(w, "Updated #%d: %s is %d now\n", fetched.ID, fetched.Name, fetched.Age)
+
+	if err := users.DeleteUser(ctx, created.ID); err != nil {
+		return fmt.Errorf("deleting user %d: %w", created.ID, err)
+	}
+	fmt.Fprintf(w, "Deleted #%d\n", created.ID)
+
+	// Errors are *client.APIError, which errors.Is sorts by kind
+	fmt.Fprintln(w, "Errors:")
+	_, err = users.GetUser(ctx, created.ID)
+	fmt.Fprintf(w, "  get the deleted user: %v (not found: %t)\n", err, errors.Is(err, client.ErrNotFound))
+	_, err = users.CreateUser(ctx, domain.CreateUserRequest{Name: "", Email: "not an email", Age: -1})
+	fmt.Fprintf(w, "  create a bad user: %v (validation: %t)\n", err, errors.Is(err, client.ErrValidation))
+	users.Token = ""
+	err = users.DeleteUser(ctx, 1)
+	fmt.Fprintf(w, "  delete without logging in: %v (unauthorized: %t)\n", err, errors.Is(err, client.ErrUnauthorized))
+	return nil
+}
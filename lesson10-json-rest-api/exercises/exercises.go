@@ -0,0 +1,51 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 10 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson10
+package exercises
+
+import (
+	"io"
+	"net/http"
+
+	"golang-lab/lab/domain"
+)
+
+// Exercise 1: add struct tags so Product marshals as
+//
+//	{"id":1,"name":"Pen","price":1.5}
+//
+// Leave "note" out when it is empty, and never include Cost.
+type Product struct {
+	ID    int     // TODO: `json:"..."`
+	Name  string  // TODO
+	Price float64 // TODO
+	Note  string  // TODO: omitted when empty
+	Cost  float64 // TODO: never in JSON
+}
+
+// Exercise 2: DecodeUsers reads a JSON array of users from r. Invalid JSON
+// must return an error, not an empty slice.
+//
+//golab:require calls encoding/json.NewDecoder
+func DecodeUsers(r io.Reader) ([]domain.User, error) {
+	// TODO: json.NewDecoder(r).Decode(&users)
+	return nil, nil
+}
+
+// Exercise 3: WriteJSON sets Content-Type to application/json, writes
+// status, and encodes v as the body.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	// TODO: header first, then WriteHeader, then the body
+}
+
+// Exercise 4: UpdateEmail applies a JSON body like {"email":"..."} to user
+// using domain.UpdateUserRequest. Fields missing from the body stay as
+// they are. Return the validation errors for the updated user, if any.
+func UpdateEmail(user *domain.User, body io.Reader) ([]domain.ValidationError, error) {
+	// TODO: decode into domain.UpdateUserRequest, Apply it, then validate
+	// with domain.CreateUserRequest{...}.Validate()
+	return nil, nil
+}
@@ -0,0 +1,78 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/domain"
+)
+
+func TestProductTags(t *testing.T) {
+	data, err := json.Marshal(Product{ID: 1, Name: "Pen", Price: 1.5, Cost: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"id":1,"name":"Pen","price":1.5}`; got != want {
+		t.Errorf("json.Marshal = %s; want %s", got, want)
+	}
+
+	data, _ = json.Marshal(Product{ID: 2, Name: "Ink", Price: 3, Note: "blue"})
+	if got, want := string(data), `{"id":2,"name":"Ink","price":3,"note":"blue"}`; got != want {
+		t.Errorf("json.Marshal = %s; want %s", got, want)
+	}
+}
+
+func TestDecodeUsers(t *testing.T) {
+	users, err := DecodeUsers(strings.NewReader(`[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]`))
+	if err != nil {
+		t.Fatalf("DecodeUsers returned %v", err)
+	}
+	if len(users) != 2 || users[1].Name != "Bob" {
+		t.Errorf("DecodeUsers = %+v; want Alice and Bob", users)
+	}
+
+	if _, err := DecodeUsers(strings.NewReader(`[{"id":1,`)); err == nil {
+		t.Error("DecodeUsers accepted truncated JSON")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	WriteJSON(recorder, http.StatusCreated, map[string]int{"id": 7})
+
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("status = %d; want %d", recorder.Code, http.StatusCreated)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q; want application/json", got)
+	}
+	if got := strings.TrimSpace(recorder.Body.String()); got != `{"id":7}` {
+		t.Errorf("body = %s; want {\"id\":7}", got)
+	}
+}
+
+func TestUpdateEmail(t *testing.T) {
+	user := domain.User{ID: 1, Name: "Alice", Email: "alice@example.com", Age: 30}
+
+	problems, err := UpdateEmail(&user, strings.NewReader(`{"email":"alice@work.example"}`))
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("UpdateEmail = %v, %v; want no problems", problems, err)
+	}
+	if user.Email != "alice@work.example" || user.Name != "Alice" || user.Age != 30 {
+		t.Errorf("user after update = %+v; only the email should change", user)
+	}
+
+	problems, err = UpdateEmail(&user, strings.NewReader(`{"email":"nope"}`))
+	if err != nil || len(problems) != 1 || problems[0].Field != "email" {
+		t.Errorf("UpdateEmail(bad email) = %v, %v; want one email problem", problems, err)
+	}
+
+	if _, err := UpdateEmail(&user, strings.NewReader(`not json`)); err == nil {
+		t.Error("UpdateEmail accepted a body that isn't JSON")
+	}
+}
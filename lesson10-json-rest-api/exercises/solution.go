@@ -0,0 +1,49 @@
+//go:build solution
+
+// Reference solutions for the Lesson 10 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"golang-lab/lab/domain"
+)
+
+type Product struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+	Note  string  `json:"note,omitempty"`
+	Cost  float64 `json:"-"`
+}
+
+//golab:require calls encoding/json.NewDecoder
+func DecodeUsers(r io.Reader) ([]domain.User, error) {
+	var users []domain.User
+	if err := json.NewDecoder(r).Decode(&users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func UpdateEmail(user *domain.User, body io.Reader) ([]domain.ValidationError, error) {
+	var req domain.UpdateUserRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.Apply(user)
+	return domain.CreateUserRequest{Name: user.Name, Email: user.Email, Age: user.Age}.Validate(), nil
+}
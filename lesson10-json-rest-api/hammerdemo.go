@@ -0,0 +1,90 @@
+package lesson10
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang-lab/lesson10-json-rest-api/client"
+)
+
+// hammerResult is what one of demonstrateRateLimits' clients saw
+type hammerResult struct {
+	ok, failed, retries int
+	waited              time.Duration
+}
+
+// demonstrateRateLimits sends requests GETs from each of workers clients
+// at once, all from one address, so they share one rate limit bucket and
+// most are turned away with 429. Each client waits out the Retry-After
+// it gets, with jitter, and tries again, so every request gets through
+// in the end, at the rate the server allows. Then a client with a short
+// deadline shows a wait being cut off by its context. It's an error if
+// any request failed for good.
+func demonstrateRateLimits(ctx context.Context, w io.Writer, baseURL string, workers, requests int) error {
+	fmt.Fprintln(w, "\n--- Rate Limits from the Client's Side ---")
+	fmt.Fprintf(w, "%d clients send %d requests each, all at once\n", workers, requests)
+
+	results := make([]hammerResult, workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range results {
+		wg.Add(1)
+		go func(result *hammerResult) {
+			defer wg.Done()
+			users := client.New(baseURL)
+			users.Retries = 10
+			users.OnRetry = func(retry int, wait time.Duration, err error) {
+				result.retries++
+				result.waited += wait
+			}
+			for range requests {
+				if _, _, err := users.ListUsers(ctx, client.ListOptions{Limit: 1}); err != nil {
+					result.failed++
+				} else {
+					result.ok++
+				}
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := hammerResult{}
+	for i, result := range results {
+		fmt.Fprintf(w, "  client %d: %d ok, %d failed, %d retries after waiting %v in all\n",
+			i+1, result.ok, result.failed, result.retries, result.waited.Round(time.Millisecond))
+		total.ok += result.ok
+		total.failed += result.failed
+	}
+	fmt.Fprintf(w, "%d of %d requests got through in %v, %.1f a second\n",
+		total.ok, workers*requests, elapsed.Round(time.Millisecond), float64(total.ok)/elapsed.Seconds())
+
+	// Empty the bucket, so the next request gets a 429 with a Retry-After
+	// longer than this client is willing to wait
+	impatient := client.New(baseURL)
+	impatient.Retries = 0
+	for range 1000 {
+		_, _, err := impatient.ListUsers(ctx, client.ListOptions{Limit: 1})
+		if errors.Is(err, client.ErrRateLimited) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	impatient.Retries = 1
+	impatient.OnRetry = func(retry int, wait time.Duration, err error) {
+		fmt.Fprintf(w, "A client with a 100ms deadline got %v, and would wait %v\n", err, wait.Round(time.Millisecond))
+	}
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, _, err := impatient.ListUsers(shortCtx, client.ListOptions{Limit: 1})
+	fmt.Fprintf(w, "  but gave up at its deadline instead: %v (deadline exceeded: %t)\n", err, errors.Is(err, context.DeadlineExceeded))
+	if total.failed > 0 {
+		return fmt.Errorf("%d requests failed even with retries", total.failed)
+	}
+	return nil
+}
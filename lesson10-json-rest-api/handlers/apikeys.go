@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// An API key is a long random secret a program sends in X-API-Key, for
+// clients that can't log in the way a person does. Each key has a role:
+//
+//	reader  reads users, as anyone can
+//	writer  also creates, changes and deletes users, as a logged-in user can
+//	admin   also uses /api/admin: backups, metrics, quotas and keys
+//
+// An admin issues keys at POST /api/admin/keys, and revokes them at
+// DELETE /api/admin/keys/{id}. The store keeps only a SHA-256 hash of
+// each key, so a leaked database doesn't leak working keys. A key is
+// shown once, when it's issued. A plain hash is enough for 192 random
+// bits; it's passwords, which can be guessed, that need a slow one.
+
+// apiKeyPrefix starts every key, so one that turns up in a log or a
+// repository is easy to recognise
+const apiKeyPrefix = "golab_"
+
+// APIKeyHeader carries a request's API key
+const APIKeyHeader = "X-API-Key"
+
+// ErrKeyRevoked is a key that was issued, and has since been revoked
+var ErrKeyRevoked = errors.New("API key revoked")
+
+// hashKey is what the store keeps of key
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex is n random bytes in hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// issueKey stores a new key for name with role, and returns the key
+// along with what's stored of it
+func issueKey(ctx context.Context, name string, role models.Role) (string, models.APIKey, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("generating an API key: %w", err)
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("generating an API key: %w", err)
+	}
+	secret = apiKeyPrefix + secret
+	key := models.APIKey{ID: id, Name: name, Role: role, Hash: hashKey(secret), CreatedAt: clk.Now()}
+	if err := db.CreateKey(ctx, key); err != nil {
+		return "", models.APIKey{}, err
+	}
+	return secret, key, nil
+}
+
+// BootstrapAdminKey issues an admin key if the store has no admin key
+// that works, so a new server can be administered at all. It returns ""
+// if there already is one.
+func BootstrapAdminKey(ctx context.Context) (string, error) {
+	keys, err := db.ListKeys(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		if key.Role == models.RoleAdmin && key.RevokedAt == nil {
+			return "", nil
+		}
+	}
+	secret, _, err := issueKey(ctx, "bootstrap", models.RoleAdmin)
+	return secret, err
+}
+
+// apiKeyKey is the context key apiKeyMiddleware stores the APIKey under
+type apiKeyKey struct{}
+
+// APIKeyFrom returns the key the request was sent with, if it had a
+// valid one and went through apiKeyMiddleware
+func APIKeyFrom(ctx context.Context) (models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(models.APIKey)
+	return key, ok
+}
+
+// requestKey is the key r was sent with; ok is false if it had none.
+// apiKeyMiddleware looks it up once for the whole request; behind a bare
+// mux, without the middleware, it's looked up here.
+func requestKey(r *http.Request) (key models.APIKey, ok bool, err error) {
+	if key, ok := APIKeyFrom(r.Context()); ok {
+		return key, true, nil
+	}
+	secret := r.Header.Get(APIKeyHeader)
+	if secret == "" {
+		return models.APIKey{}, false, nil
+	}
+	key, err = db.KeyByHash(r.Context(), hashKey(secret))
+	if err != nil {
+		return models.APIKey{}, false, err
+	}
+	if key.RevokedAt != nil {
+		return models.APIKey{}, false, ErrKeyRevoked
+	}
+	return key, true, nil
+}
+
+// respondWithKeyError answers a request whose key requestKey refused
+func respondWithKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrKeyNotFound):
+		respondWithError(w, r, http.StatusUnauthorized, "Unknown API key")
+	case errors.Is(err, ErrKeyRevoked):
+		respondWithError(w, r, http.StatusUnauthorized, "API key revoked")
+	default:
+		respondWithStoreError(w, r, err)
+	}
+}
+
+// apiKeyMiddleware refuses a request with a key that doesn't work, and
+// puts a good one in the request's context. It comes before the rate
+// limit and the quota, so they count keys by ID, and a made-up key
+// never gets a bucket of its own.
+func apiKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok, err := requestKey(r)
+		if err != nil {
+			respondWithKeyError(w, r, err)
+			return
+		}
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole answers 401 to a request without a key that works, and 403
+// to one whose key's role doesn't allow role
+func requireRole(role models.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok, err := requestKey(r)
+		switch {
+		case err != nil:
+			respondWithKeyError(w, r, err)
+		case !ok:
+			respondWithError(w, r, http.StatusUnauthorized, fmt.Sprintf("This needs an API key with the %s role, in an %s header", role, APIKeyHeader))
+		case !key.Role.Allows(role):
+			respondWithError(w, r, http.StatusForbidden, fmt.Sprintf("This API key is a %s; this needs %s", key.Role, role))
+		default:
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+		}
+	})
+}
+
+// GET /api/admin/keys
+func listKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := db.ListKeys(r.Context())
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    keys,
+		Message: fmt.Sprintf("Found %d API keys", len(keys)),
+	})
+}
+
+// POST /api/admin/keys
+func createKey(w http.ResponseWriter, r *http.Request) {
+	var req models.IssueKeyRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+	secret, key, err := issueKey(r.Context(), strings.TrimSpace(req.Name), req.Role)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	log.Printf("Issued %s API key %s (%s)", key.Role, key.ID, key.Name)
+	respond.JSON(w, http.StatusCreated, domain.APIResponse{
+		Success: true,
+		Data:    models.IssuedKey{APIKey: key, Key: secret},
+		Message: "API key issued; save it now, as it can't be shown again",
+	})
+}
+
+// GET /api/admin/keys/{id}
+func getKey(w http.ResponseWriter, r *http.Request) {
+	key, err := db.GetKey(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrKeyNotFound) {
+		respondWithError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, domain.APIResponse{Success: true, Data: key})
+}
+
+// DELETE /api/admin/keys/{id} revokes the key, and answers with it as
+// GET would, revoked
+func revokeKey(w http.ResponseWriter, r *http.Request) {
+	err := db.RevokeKey(r.Context(), r.PathValue("id"), clk.Now())
+	if errors.Is(err, store.ErrKeyNotFound) {
+		respondWithError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	getKey(w, r)
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// A JSON Web Token (RFC 7519) is three base64url parts joined by dots: a
+// header naming the signing algorithm, the claims, and a signature over
+// the first two. The server signs a token when someone logs in and
+// checks the signature on every request after, so it needs no session
+// table: the token itself says who the client is, and nobody without
+// the secret can forge or edit one. The catch is that a token can't be
+// taken back; it's good until it expires, so tokens should be short-lived.
+
+// tokenIssuer is the iss claim of every token the API signs
+const tokenIssuer = "golab-lesson10"
+
+var (
+	// jwtSecret signs and checks tokens. Start replaces it with
+	// Config.JWTSecret if set; otherwise every start gets a new one, and
+	// old tokens stop working.
+	jwtSecret = newSecret()
+	// tokenTTL is how long a token is good for; Start sets it
+	tokenTTL = time.Hour
+	// loginPassword is the password every user logs in with; Start sets
+	// it. A real API stores a slow hash (bcrypt, argon2) per user.
+	loginPassword = "golab"
+)
+
+// newSecret returns 32 random bytes, the size of an HS256 key
+func newSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err) // crypto/rand doesn't fail on any supported platform
+	}
+	return secret
+}
+
+// The ways a token can be refused; parseToken wraps them with details
+var (
+	ErrTokenMalformed = errors.New("malformed token")
+	ErrTokenSignature = errors.New("bad token signature")
+	ErrTokenExpired   = errors.New("token expired")
+)
+
+// jwtHeader is the same for every token: HMAC-SHA256
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// newClaims are the claims of a token for user, issued at now
+func newClaims(user domain.User, now time.Time) models.Claims {
+	return models.Claims{
+		Subject:   strconv.Itoa(user.ID),
+		Email:     user.Email,
+		Name:      user.Name,
+		Issuer:    tokenIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(tokenTTL).Unix(),
+	}
+}
+
+// signToken encodes claims as a JWT signed with secret
+func signToken(claims models.Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(unsigned, secret), nil
+}
+
+func signature(unsigned string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprint(mac, unsigned)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseToken checks token's signature and expiry at now and returns its
+// claims. The header must name HS256: trusting whatever algorithm a
+// token asks for is how "alg":"none" tokens get accepted.
+func parseToken(token string, secret []byte, now time.Time) (models.Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return models.Claims{}, fmt.Errorf("%w: want 3 parts, got %d", ErrTokenMalformed, len(parts))
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return models.Claims{}, fmt.Errorf("%w: header: %v", ErrTokenMalformed, err)
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil {
+		return models.Claims{}, fmt.Errorf("%w: header: %v", ErrTokenMalformed, err)
+	}
+	if h.Alg != "HS256" {
+		return models.Claims{}, fmt.Errorf("%w: algorithm %q, want HS256", ErrTokenMalformed, h.Alg)
+	}
+	// Compare in constant time, so the response time doesn't tell an
+	// attacker how much of a forged signature was right
+	want := signature(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(parts[2]), []byte(want)) {
+		return models.Claims{}, ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return models.Claims{}, fmt.Errorf("%w: claims: %v", ErrTokenMalformed, err)
+	}
+	var claims models.Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return models.Claims{}, fmt.Errorf("%w: claims: %v", ErrTokenMalformed, err)
+	}
+	if _, err := strconv.Atoi(claims.Subject); err != nil || claims.Issuer != tokenIssuer {
+		return models.Claims{}, fmt.Errorf("%w: not a token this API issued", ErrTokenMalformed)
+	}
+	if expires := time.Unix(claims.ExpiresAt, 0); !now.Before(expires) {
+		return models.Claims{}, fmt.Errorf("%w at %s", ErrTokenExpired, expires.UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+// claimsKey is the context key requireAuth stores Claims under
+type claimsKey struct{}
+
+// ClaimsFrom returns the claims of the token, or session, the request was
+// made with, if it had one; handlers behind requireAuth call it
+func ClaimsFrom(ctx context.Context) (models.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(models.Claims)
+	return claims, ok
+}
+
+// bearerToken is the token in an "Authorization: Bearer ..." header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// safeMethod reports whether method only reads, so anyone may send it
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// requireAuth lets reads through and answers 401 to any other request
+// without a valid token or API key. A request with a token, valid or
+// not, has it checked, and the claims go in the request's context for
+// next. Without a token, a writer or admin API key will do instead (see
+// apikeys.go); a reader key gets 403 for anything but a read. Without
+// either, so will a GitHub login's session cookie (see github.go), its
+// claims going in the context as a token's do.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, hasKey, err := requestKey(r)
+		if err != nil {
+			respondWithKeyError(w, r, err)
+			return
+		}
+		if hasKey && r.Header.Get("Authorization") == "" {
+			if !safeMethod(r.Method) && !key.Role.Allows(models.RoleWriter) {
+				respondWithError(w, r, http.StatusForbidden, fmt.Sprintf("This API key is a %s; changing users needs %s", key.Role, models.RoleWriter))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			if claims, ok := sessionClaims(r); ok {
+				if !tenantMatches(w, r, claims) {
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+				return
+			}
+			if safeMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			respondWithError(w, r, http.StatusUnauthorized, "Authentication required: log in at /api/auth/login and send the token in an Authorization: Bearer header")
+			return
+		}
+		claims, err := parseToken(token, jwtSecret, clk.Now())
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="api", error="invalid_token", error_description=%q`, err.Error()))
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid token: "+err.Error())
+			return
+		}
+		if !tenantMatches(w, r, claims) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+// tenantMatches reports whether claims are for a user of the tenant r is
+// for, and answers r with 401 if not: user 1 of one tenant isn't user 1
+// of another, so a token is only good with the X-Tenant-ID it was issued
+// under. API keys are the server's, and work for any tenant.
+func tenantMatches(w http.ResponseWriter, r *http.Request, claims models.Claims) bool {
+	issued := claims.Tenant
+	if issued == "" {
+		issued = store.DefaultTenant
+	}
+	if tenant := middleware.TenantFrom(r.Context()); issued != tenant {
+		respondWithError(w, r, http.StatusUnauthorized, fmt.Sprintf("This token is for tenant %q, not %q; log in again with its %s", issued, tenant, middleware.TenantHeader))
+		return false
+	}
+	return true
+}
+
+// Handle logging in (POST /api/auth/login)
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	user, err := findUserByEmail(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, store.ErrUserNotFound) {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	// The same answer for an unknown email and a wrong password, so the
+	// endpoint can't be used to find out who has an account
+	passwordOK := subtle.ConstantTimeCompare([]byte(req.Password), []byte(loginPassword)) == 1
+	if err != nil || !passwordOK {
+		respondWithError(w, r, http.StatusUnauthorized, "Wrong email or password")
+		return
+	}
+
+	now := clk.Now()
+	claims := newClaims(user, now)
+	if tenant := middleware.TenantFrom(r.Context()); tenant != store.DefaultTenant {
+		claims.Tenant = tenant
+	}
+	token, err := signToken(claims, jwtSecret)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data: models.TokenResponse{
+			Token:     token,
+			TokenType: "Bearer",
+			ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+		},
+	})
+}
+
+// findUserByEmail looks email up, ignoring case
+func findUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	list, err := db.List(ctx)
+	if err != nil {
+		return domain.User{}, err
+	}
+	for _, user := range list {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return domain.User{}, store.ErrUserNotFound
+}
+
+// Handle who the token belongs to (GET /api/auth/me)
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	claims, ok := ClaimsFrom(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		respondWithError(w, r, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    claims,
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// A bulk request creates or deletes many users at once, and some of them
+// can fail while the rest succeed. There's no one status code for that,
+// so the answer is 207 Multi-Status, borrowed from WebDAV: the request as
+// a whole was processed, and each item has its own status in the body.
+//
+//	POST /api/v1/users/bulk    [{"name":"Ann",...}, {"name":"",...}]
+//	DELETE /api/v1/users/bulk  [3, 99]
+//
+//	207 {"success":false,"message":"Created 1 of 2 users","data":[
+//	      {"index":0,"status":201,"id":11,"data":{...}},
+//	      {"index":1,"status":400,"error":"Validation failed","details":[...]}]}
+//
+// Items aren't all-or-nothing: the ones that succeed stay done. A body
+// that isn't a list of the right size fails as a whole, with 400.
+
+// maxBulkItems caps the items in one bulk request, so one request can't
+// hold the store's lock for long
+const maxBulkItems = 100
+
+// POST and DELETE /api/{version}/users/bulk
+func (v *apiVersion) handleBulk(w http.ResponseWriter, r *http.Request) {
+	var items []json.RawMessage
+	if !decodeBody(w, r, &items) {
+		return
+	}
+	if len(items) == 0 || len(items) > maxBulkItems {
+		respondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("Send from 1 to %d items", maxBulkItems))
+		return
+	}
+
+	var results []models.BulkResult
+	var verb string
+	if r.Method == http.MethodPost {
+		results, verb = v.bulkCreate(r, items), "Created"
+	} else {
+		results, verb = bulkDelete(r, items), "Deleted"
+	}
+	succeeded := 0
+	for _, result := range results {
+		if result.Status < 300 {
+			succeeded++
+		}
+	}
+	if succeeded > 0 {
+		snapshots.changed()
+	}
+
+	respond.JSON(w, http.StatusMultiStatus, domain.APIResponse{
+		Success: succeeded == len(results),
+		Data:    results,
+		Message: fmt.Sprintf("%s %d of %d users", verb, succeeded, len(results)),
+	})
+}
+
+// bulkCreate creates a user from each item, as createUser would
+func (v *apiVersion) bulkCreate(r *http.Request, items []json.RawMessage) []models.BulkResult {
+	results := make([]models.BulkResult, len(items))
+	now := clk.Now()
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	for i, item := range items {
+		results[i].Index = i
+		newUser, errs, err := v.decodeCreate(item)
+		switch {
+		case err != nil:
+			results[i].Status = http.StatusBadRequest
+			results[i].Error, results[i].Details = describeDecodeError(err)
+			if results[i].Details != nil {
+				results[i].Error = "Validation failed"
+			}
+			continue
+		case len(errs) > 0:
+			results[i].Status, results[i].Error, results[i].Details = http.StatusBadRequest, "Validation failed", errs
+			continue
+		}
+		newUser.CreatedAt, newUser.UpdatedAt = now, now
+		user, err := db.Create(r.Context(), newUser)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			results[i].Status, results[i].Error = http.StatusInternalServerError, "Internal server error"
+			continue
+		}
+		suggestions.For(r.Context()).Add(user)
+		events.Publish(r.Context(), userCreated, user)
+		jobs.Enqueue(r.Context(), welcomeEmail, user)
+		results[i].Status, results[i].ID, results[i].Data = http.StatusCreated, user.ID, v.resource(r, user)
+	}
+	return results
+}
+
+// bulkDelete deletes the user each item names by ID, as deleteUser would
+func bulkDelete(r *http.Request, items []json.RawMessage) []models.BulkResult {
+	results := make([]models.BulkResult, len(items))
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	for i, item := range items {
+		results[i].Index = i
+		var id int
+		if err := json.Unmarshal(item, &id); err != nil {
+			results[i].Status, results[i].Error = http.StatusBadRequest, "Invalid user ID"
+			continue
+		}
+		results[i].ID = id
+		user, err := db.Get(r.Context(), id)
+		if err == nil {
+			err = db.Delete(r.Context(), id)
+		}
+		switch {
+		case errors.Is(err, store.ErrUserNotFound):
+			results[i].Status, results[i].Error = http.StatusNotFound, "User not found"
+		case err != nil:
+			log.Printf("Error: %v", err)
+			results[i].Status, results[i].Error = http.StatusInternalServerError, "Internal server error"
+		default:
+			suggestions.For(r.Context()).Remove(user)
+			events.Publish(r.Context(), userDeleted, user)
+			results[i].Status = http.StatusOK
+		}
+	}
+	return results
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"golang-lab/lab/domain"
+)
+
+// Request bodies are decoded strictly. json.Unmarshal quietly drops a
+// field it doesn't know, so a client that sends "emial" or "first_name"
+// to v1 gets a 201 and never finds out the field was ignored. Here an
+// unknown field, a value of the wrong type or a body that's too big is
+// a 400 (or 413) that says exactly what was wrong.
+
+// maxBodySize caps a JSON request body. A user or a key is a few hundred
+// bytes, so a megabyte leaves room for a full bulk request while keeping
+// a client from making the server buffer gigabytes. Imports have their
+// own, larger limit (maxImportSize).
+const maxBodySize = 1 << 20
+
+// errTrailingData is decodeJSON's error for a body with more after its
+// JSON value, like two objects one after the other
+var errTrailingData = errors.New("the body has more after its JSON value")
+
+// readBody reads r's body, refusing one longer than limit. If it can't,
+// it has already sent the error, 413 for a body that's too long.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, r, http.StatusRequestEntityTooLarge, "Request body is larger than "+byteSize(tooLarge.Limit))
+			return nil, false
+		}
+		respondWithError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeJSON decodes data, which must be exactly one JSON value, into v.
+// A field v has no place for is an error.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// decodeBody reads r's body, up to maxBodySize, into v. If it can't, it
+// has already sent the error.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, ok := readBody(w, r, maxBodySize)
+	if !ok {
+		return false
+	}
+	if err := decodeJSON(body, v); err != nil {
+		respondWithDecodeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// respondWithDecodeError sends a 400 saying why decodeJSON refused a
+// body: field errors for an unknown field or a wrong type, like any
+// other validation failure, and a message for the rest
+func respondWithDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	message, errs := describeDecodeError(err)
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+	respondWithError(w, r, http.StatusBadRequest, message)
+}
+
+// describeDecodeError explains a decoding error to the client. An error
+// about one field comes back as a field error; anything else, such as a
+// syntax error, as a message.
+func describeDecodeError(err error) (string, []domain.ValidationError) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Invalid JSON at byte %d: %v", syntaxErr.Offset, syntaxErr), nil
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return "Expected a JSON " + jsonTypeName(typeErr.Type), nil
+		}
+		return "", []domain.ValidationError{{Field: typeErr.Field, Message: "Must be a " + jsonTypeName(typeErr.Type)}}
+	case errors.Is(err, io.EOF):
+		return "The request body is empty", nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "Invalid JSON: the body ends in the middle of a value", nil
+	case errors.Is(err, errTrailingData):
+		return "Invalid JSON: " + err.Error(), nil
+	}
+	// encoding/json has no type for this one, only the message
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return "", []domain.ValidationError{{Field: strings.Trim(field, `"`), Message: "Unknown field"}}
+	}
+	return "Invalid JSON format", nil
+}
+
+// jsonTypeName is what JSON calls values of a Go type
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Struct, reflect.Map:
+		if t == timeType {
+			return "date-time string"
+		}
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	default:
+		return "number"
+	}
+}
+
+// byteSize writes a body limit for people: 1 MB rather than 1048576
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
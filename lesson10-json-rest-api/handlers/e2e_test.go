@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// e2eCase is one request of TestEndToEnd and what should come back
+type e2eCase struct {
+	name   string
+	method string
+	path   string
+	header map[string]string
+	body   string // sent as application/json unless header says otherwise
+
+	status      int
+	contentType string // if set, the response's media type, without parameters
+	want        string // if set, something the body must contain
+}
+
+// TestEndToEnd serves the whole API, middleware and all, on a real port
+// with httptest.NewServer, and sends every endpoint its requests over
+// HTTP: what each one is for, then the ways it fails. The cases run in
+// order against one server, so later ones see what earlier ones changed.
+func TestEndToEnd(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	invitations = newInvitationStore()
+	t.Cleanup(func() { invitations = newInvitationStore() })
+	limiter = middleware.NewRateLimiter(middleware.DefaultRate, middleware.DefaultBurst)
+
+	token := map[string]string{"Authorization": "Bearer " + testToken(t)}
+	admin := map[string]string{APIKeyHeader: testKey(t, models.RoleAdmin)}
+	reader := map[string]string{APIKeyHeader: testKey(t, models.RoleReader)}
+	expired, err := invitations.Create("old@example.com", time.Minute, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(2 * time.Minute)
+	invitation, err := invitations.Create("eve@example.com", time.Hour, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(h map[string]string, key, value string) map[string]string {
+		merged := map[string]string{key: value}
+		for k, v := range h {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	server := httptest.NewServer(NewServer().Handler)
+	defer server.Close()
+
+	for _, tc := range []e2eCase{
+		// Health and documentation
+		{name: "health", method: "GET", path: "/api/health", status: http.StatusOK, want: `"status":"healthy"`},
+		{name: "health through v2", method: "GET", path: "/api/v2/health", status: http.StatusOK},
+		{name: "health refuses POST", method: "POST", path: "/api/health", status: http.StatusMethodNotAllowed},
+		{name: "liveness", method: "GET", path: "/healthz", status: http.StatusOK, want: `"status":"alive"`},
+		{name: "readiness", method: "GET", path: "/readyz", status: http.StatusOK, want: `"name":"store","status":"ok"`},
+		{name: "readiness refuses POST", method: "POST", path: "/readyz", status: http.StatusMethodNotAllowed},
+		{name: "OpenAPI document", method: "GET", path: "/api/openapi.json", status: http.StatusOK, contentType: "application/json", want: `"openapi":"3.0.3"`},
+		{name: "OpenAPI at /api", method: "GET", path: "/api", status: http.StatusOK, contentType: "application/json"},
+		{name: "Swagger UI", method: "GET", path: "/api/docs", status: http.StatusOK, contentType: "text/html"},
+		{name: "problem type", method: "GET", path: "/api/problems/not-found", status: http.StatusOK, want: `"title":"Not found"`},
+		{name: "unknown problem type", method: "GET", path: "/api/problems/nonsense", status: http.StatusNotFound},
+		{name: "unknown path", method: "GET", path: "/api/nothing-here", status: http.StatusNotFound},
+
+		// Reading users
+		{name: "list", method: "GET", path: "/api/v1/users", status: http.StatusOK, want: `"name":"John Doe"`},
+		{name: "list unversioned", method: "GET", path: "/api/users", status: http.StatusOK},
+		{name: "page", method: "GET", path: "/api/v1/users?page=2&limit=3&sort=-age", status: http.StatusOK, want: `"page":2`},
+		{name: "first cursor page", method: "GET", path: "/api/v1/users?cursor=&limit=3", status: http.StatusOK, want: `"next_cursor":"`},
+		{name: "bad cursor", method: "GET", path: "/api/v1/users?cursor=nonsense", status: http.StatusBadRequest, want: `cursor isn't one this API gave out`},
+		{name: "cursor with page", method: "GET", path: "/api/v1/users?cursor=&page=2", status: http.StatusBadRequest},
+		{name: "bad sort field", method: "GET", path: "/api/v1/users?sort=password", status: http.StatusBadRequest},
+		{name: "bad limit", method: "GET", path: "/api/v1/users?limit=-1", status: http.StatusBadRequest},
+		{name: "get", method: "GET", path: "/api/v1/users/1", status: http.StatusOK, want: `"email":"john@example.com"`},
+		{name: "get v2", method: "GET", path: "/api/v2/users/1", status: http.StatusOK, want: `"first_name":"John"`},
+		{name: "get missing", method: "GET", path: "/api/v1/users/99", status: http.StatusNotFound},
+		{name: "get bad ID", method: "GET", path: "/api/v1/users/abc", status: http.StatusBadRequest},
+		{name: "get as XML", method: "GET", path: "/api/v1/users/1", header: map[string]string{"Accept": "application/xml"}, status: http.StatusOK, contentType: "application/xml"},
+		{name: "get as YAML", method: "GET", path: "/api/v1/users/1", header: map[string]string{"Accept": "application/yaml"}, status: http.StatusOK, contentType: "application/yaml"},
+		{name: "get as CSV", method: "GET", path: "/api/v1/users/1", header: map[string]string{"Accept": "text/csv"}, status: http.StatusNotAcceptable},
+		{name: "get as a problem", method: "GET", path: "/api/v1/users/99", header: map[string]string{"Accept": "application/problem+json"}, status: http.StatusNotFound, contentType: "application/problem+json"},
+		{name: "suggest", method: "GET", path: "/api/v1/users/suggest?prefix=jo", status: http.StatusOK, want: "John Doe"},
+		{name: "suggest without a prefix", method: "GET", path: "/api/v1/users/suggest", status: http.StatusBadRequest},
+		{name: "search", method: "GET", path: "/api/v1/users/search?q=age%3E25", status: http.StatusOK},
+		{name: "search a hidden field", method: "GET", path: "/api/v1/users/search?q=password:x", status: http.StatusBadRequest},
+
+		// Logging in
+		{name: "log in", method: "POST", path: "/api/auth/login", body: `{"email":"john@example.com","password":"golab"}`, status: http.StatusOK, want: `"token_type":"Bearer"`},
+		{name: "log in with the wrong password", method: "POST", path: "/api/auth/login", body: `{"email":"john@example.com","password":"wrong"}`, status: http.StatusUnauthorized},
+		{name: "log in with a bad body", method: "POST", path: "/api/auth/login", body: `{`, status: http.StatusBadRequest},
+		{name: "who am I", method: "GET", path: "/api/auth/me", header: token, status: http.StatusOK, want: `"sub":"1"`},
+		{name: "who am I without a token", method: "GET", path: "/api/auth/me", status: http.StatusUnauthorized},
+		{name: "who am I with a bad token", method: "GET", path: "/api/auth/me", header: map[string]string{"Authorization": "Bearer nonsense"}, status: http.StatusUnauthorized},
+
+		// Changing users
+		{name: "create without a token", method: "POST", path: "/api/v1/users", body: `{"name":"Alice","email":"alice@example.com","age":30}`, status: http.StatusUnauthorized},
+		{name: "create with a reader key", method: "POST", path: "/api/v1/users", header: reader, body: `{"name":"Alice","email":"alice@example.com","age":30}`, status: http.StatusForbidden},
+		{name: "create", method: "POST", path: "/api/v1/users", header: token, body: `{"name":"Alice","email":"alice@example.com","age":30}`, status: http.StatusCreated, want: `"id":11`},
+		{name: "create invalid", method: "POST", path: "/api/v1/users", header: token, body: `{"name":"","email":"alice","age":200}`, status: http.StatusBadRequest, want: `"field":"email"`},
+		{name: "create malformed", method: "POST", path: "/api/v1/users", header: token, body: `{"name":`, status: http.StatusBadRequest},
+		{name: "create with an unknown field", method: "POST", path: "/api/v1/users", header: token, body: `{"name":"Bob","email":"bob@example.com","age":30,"nickname":"B"}`, status: http.StatusBadRequest, want: `{"field":"nickname","message":"Unknown field"}`},
+		{name: "create with a wrong type", method: "POST", path: "/api/v1/users", header: token, body: `{"name":"Bob","email":"bob@example.com","age":"30"}`, status: http.StatusBadRequest, want: `{"field":"age","message":"Must be a number"}`},
+		{name: "update", method: "PUT", path: "/api/v1/users/11", header: token, body: `{"age":31,"version":1}`, status: http.StatusOK, want: `"version":2`},
+		{name: "update an old version", method: "PUT", path: "/api/v1/users/11", header: with(token, "If-Match", "1"), body: `{"age":32}`, status: http.StatusConflict, want: `at version 2, not 1`},
+		{name: "update without a version", method: "PUT", path: "/api/v1/users/11", header: token, body: `{"age":32}`, status: http.StatusPreconditionRequired},
+		{name: "update a stale ETag", method: "PUT", path: "/api/v1/users/11", header: with(token, "If-Match", `"stale"`), body: `{"age":32}`, status: http.StatusPreconditionFailed},
+		{name: "update missing", method: "PUT", path: "/api/v1/users/99", header: token, body: `{"age":32}`, status: http.StatusNotFound},
+		{name: "merge patch", method: "PATCH", path: "/api/v1/users/11", header: with(token, "Content-Type", "application/merge-patch+json"), body: `{"name":"Alicia","version":2}`, status: http.StatusOK, want: `"name":"Alicia"`},
+		{name: "JSON patch", method: "PATCH", path: "/api/v1/users/11", header: with(token, "Content-Type", "application/json-patch+json"), body: `[{"op":"test","path":"/version","value":3},{"op":"replace","path":"/age","value":33}]`, status: http.StatusOK, want: `"age":33`},
+		{name: "JSON patch whose test fails", method: "PATCH", path: "/api/v1/users/11", header: with(with(token, "Content-Type", "application/json-patch+json"), "If-Match", "4"), body: `[{"op":"test","path":"/age","value":1}]`, status: http.StatusConflict},
+		{name: "patch as plain JSON", method: "PATCH", path: "/api/v1/users/11", header: token, body: `{"age":34}`, status: http.StatusUnsupportedMediaType},
+		{name: "create v2", method: "POST", path: "/api/v2/users", header: token, body: `{"first_name":"Bea","last_name":"Lee","email":"bea@example.com","age":41}`, status: http.StatusCreated, want: `"last_name":"Lee"`},
+		{name: "create v2 with a v1 body", method: "POST", path: "/api/v2/users", header: token, body: `{"name":"Bea Lee","email":"bea@example.com","age":41}`, status: http.StatusBadRequest},
+		{name: "bulk create", method: "POST", path: "/api/v1/users/bulk", header: token, body: `[{"name":"Cal","email":"cal@example.com","age":22},{"name":"","email":"x","age":1}]`, status: http.StatusMultiStatus, want: `"status":400`},
+		{name: "bulk create with one user", method: "POST", path: "/api/v1/users/bulk", header: token, body: `{"name":"Cal"}`, status: http.StatusBadRequest},
+		{name: "bulk delete", method: "DELETE", path: "/api/v1/users/bulk", header: token, body: `[13, 99]`, status: http.StatusMultiStatus, want: `"status":404`},
+		{name: "welcome emails queued", method: "GET", path: "/api/jobs", status: http.StatusOK, want: `"kind":"welcome_email","user_id":11,"to":"alice@example.com","subject":"Welcome, Alice"`},
+		{name: "delete", method: "DELETE", path: "/api/v1/users/11", header: token, status: http.StatusOK},
+		{name: "get deleted", method: "GET", path: "/api/v1/users/11", status: http.StatusNotFound},
+		{name: "delete again", method: "DELETE", path: "/api/v1/users/11", header: token, status: http.StatusNotFound},
+		{name: "export CSV", method: "GET", path: "/api/v1/users/export", status: http.StatusOK, contentType: "text/csv", want: "id,name,email,age,created_at,updated_at\n1,John Doe,"},
+		{name: "export NDJSON", method: "GET", path: "/api/v2/users/export?format=ndjson", status: http.StatusOK, contentType: "application/x-ndjson", want: `{"id":1,"first_name":"John"`},
+		{name: "import NDJSON", method: "POST", path: "/api/v1/users/import", header: with(token, "Content-Type", "application/x-ndjson"), body: `{"name":"Dee","email":"dee@example.com","age":35}` + "\n" + `{"name":""}`, status: http.StatusOK, want: `"rows":2,"imported":1`},
+		{name: "import JSON", method: "POST", path: "/api/v1/users/import", header: with(token, "Content-Type", "application/json"), body: `[]`, status: http.StatusUnsupportedMediaType},
+		{name: "unsupported method", method: "TRACE", path: "/api/v1/users", header: token, status: http.StatusMethodNotAllowed},
+
+		// Invitations
+		{name: "invite", method: "POST", path: "/api/invitations", body: `{"email":"bob@example.com","ttl":"24h"}`, header: token, status: http.StatusCreated, want: `"email":"bob@example.com"`},
+		{name: "invite invalid", method: "POST", path: "/api/invitations", body: `{"email":"bob","ttl":"-1h"}`, header: token, status: http.StatusBadRequest},
+		{name: "invite without a token", method: "POST", path: "/api/invitations", body: `{"email":"bob@example.com","ttl":"24h"}`, status: http.StatusUnauthorized},
+		{name: "list invitations without a token", method: "GET", path: "/api/invitations", status: http.StatusUnauthorized},
+		{name: "list invitations with a reader key", method: "GET", path: "/api/invitations", header: reader, status: http.StatusForbidden},
+		{name: "list invitations", method: "GET", path: "/api/invitations", header: token, status: http.StatusOK, want: "eve@example.com"},
+		{name: "list expired invitations", method: "GET", path: "/api/invitations?status=expired", header: token, status: http.StatusOK, want: "old@example.com"},
+		{name: "get invitation", method: "GET", path: "/api/invitations/" + invitation.Token, status: http.StatusOK},
+		{name: "get expired invitation", method: "GET", path: "/api/invitations/" + expired.Token, status: http.StatusGone},
+		{name: "get missing invitation", method: "GET", path: "/api/invitations/nosuchtoken", status: http.StatusNotFound},
+		{name: "revoke invitation without a token", method: "DELETE", path: "/api/invitations/" + invitation.Token, status: http.StatusUnauthorized},
+		{name: "revoke invitation", method: "DELETE", path: "/api/invitations/" + invitation.Token, header: token, status: http.StatusOK},
+		{name: "revoke it again", method: "DELETE", path: "/api/invitations/" + invitation.Token, header: token, status: http.StatusNotFound},
+
+		// Administration
+		{name: "export without a key", method: "GET", path: "/api/admin/export", status: http.StatusUnauthorized},
+		{name: "export with a reader key", method: "GET", path: "/api/admin/export", header: reader, status: http.StatusForbidden},
+		{name: "export with a bad key", method: "GET", path: "/api/admin/export", header: map[string]string{APIKeyHeader: "golab_nosuchkey"}, status: http.StatusUnauthorized},
+		{name: "export", method: "GET", path: "/api/admin/export", header: admin, status: http.StatusOK, want: `"version":1`},
+		{name: "import a bad version", method: "POST", path: "/api/admin/import", header: admin, body: `{"version":99,"users":[]}`, status: http.StatusBadRequest},
+		{name: "metrics", method: "GET", path: "/api/admin/metrics", header: admin, status: http.StatusOK, want: `"route":"GET /api/v1/users/{id}"`},
+		{name: "Prometheus metrics", method: "GET", path: "/metrics", status: http.StatusOK, contentType: "text/plain", want: "golab_http_requests_total"},
+		{name: "quotas", method: "GET", path: "/api/admin/quotas", header: admin, status: http.StatusOK},
+		{name: "reset a quota never used", method: "DELETE", path: "/api/admin/quotas/nosuchkey", header: admin, status: http.StatusNotFound},
+		{name: "issue a key", method: "POST", path: "/api/admin/keys", header: admin, body: `{"name":"ci","role":"writer"}`, status: http.StatusCreated, want: `"key":"golab_`},
+		{name: "issue a key with no such role", method: "POST", path: "/api/admin/keys", header: admin, body: `{"name":"ci","role":"root"}`, status: http.StatusBadRequest},
+		{name: "list keys", method: "GET", path: "/api/admin/keys", header: admin, status: http.StatusOK, want: `"role":"writer"`},
+		{name: "revoke a missing key", method: "DELETE", path: "/api/admin/keys/nosuchkey", header: admin, status: http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := send(t, server, tc)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("%s %s = %d, want %d: %s", tc.method, tc.path, resp.StatusCode, tc.status, body)
+			}
+			if tc.contentType != "" {
+				if got, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";"); got != tc.contentType {
+					t.Errorf("Content-Type = %q, want %s", resp.Header.Get("Content-Type"), tc.contentType)
+				}
+			}
+			if !strings.Contains(body, tc.want) {
+				t.Errorf("body doesn't contain %s:\n%s", tc.want, body)
+			}
+		})
+	}
+}
+
+// send sends tc to server with its own client, as any client would, and
+// returns the response with its body read
+func send(t *testing.T, server *httptest.Server, tc e2eCase) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range tc.header {
+		req.Header.Set(key, value)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang-lab/lab/domain"
+)
+
+// An entity tag names one version of a representation. A GET sends it in
+// ETag, and the client hands it back to make the next request
+// conditional:
+//
+//	If-None-Match on a GET: "send it only if it changed since this
+//	version". The answer is 304 Not Modified with no body, and the client
+//	uses its cached copy.
+//	If-Match on a PUT, PATCH or DELETE: "change it only if it's still
+//	this version". Otherwise 412 Precondition Failed, so two clients
+//	editing the same user can't silently overwrite each other (the lost
+//	update problem).
+//
+// The tags here are strong: a hash of the exact bytes of the response.
+// XML and YAML bytes differ from JSON's, so each format gets its own tag,
+// as RFC 9110 wants. A weak tag (W/"...") would only promise the same
+// meaning, and If-Match never accepts one.
+
+// etagOf is the strong entity tag of a response body
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// userResponse is what GET /api/{version}/users/{id} sends for user, in
+// every format; the tags If-Match checks are computed from it. The links
+// are absolute, so the bytes, and the tags, depend on the Host r was
+// sent to.
+func (v *apiVersion) userResponse(r *http.Request, user domain.User) domain.APIResponse {
+	return domain.APIResponse{Success: true, Data: v.resource(r, user)}
+}
+
+// userETags are the tags of user's representation in v in every format,
+// the first JSON's. Each version's tags are its own, since its bytes are.
+func (v *apiVersion) userETags(r *http.Request, user domain.User) ([]string, error) {
+	tags := make([]string, len(formats))
+	for i, f := range formats {
+		body, err := f.marshal(v.userResponse(r, user))
+		if err != nil {
+			return nil, err
+		}
+		tags[i] = etagOf(body)
+	}
+	return tags, nil
+}
+
+// etagList reads a comma-separated list of entity tags, like an
+// If-Match or If-None-Match header, keeping any W/ prefixes
+func etagList(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// notModified reports whether r's If-None-Match already has etag, so the
+// client's copy is current. It compares weakly: a W/ prefix on either
+// side doesn't matter, because a cached copy only has to mean the same.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range etagList(header) {
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch answers 412 and returns false if r has an If-Match header
+// that no representation of user matches. It compares strongly, so a
+// weak tag never matches. A bare number in If-Match is a version rather
+// than a tag (see locking.go), and one that isn't user's is a 409.
+// Handlers call it after reading the user and before changing it, under
+// the same lock, so nothing can change the user in between.
+func (v *apiVersion) checkIfMatch(w http.ResponseWriter, r *http.Request, user domain.User) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true // unconditional, or "if it exists", which it does
+	}
+	current, err := v.userETags(r, user)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return false
+	}
+	var versions []string
+	for _, tag := range etagList(header) {
+		if isVersionTag(tag) {
+			if tag == strconv.Itoa(user.Version) {
+				return true
+			}
+			versions = append(versions, tag)
+			continue
+		}
+		for _, etag := range current {
+			if tag == etag {
+				return true
+			}
+		}
+	}
+	w.Header().Set("ETag", current[0])
+	if len(versions) > 0 {
+		respondWithVersionConflict(w, r, user, strings.Join(versions, " or "))
+		return false
+	}
+	respondWithError(w, r, http.StatusPreconditionFailed, "The user has changed since that ETag; GET it again and retry")
+	return false
+}
+
+// setUserETag sends the tag a GET of user in JSON would have, after a
+// change, so the client can make its next change conditional without
+// fetching the user again
+func (v *apiVersion) setUserETag(w http.ResponseWriter, r *http.Request, user domain.User) {
+	if tags, err := v.userETags(r, user); err == nil {
+		w.Header().Set("ETag", tags[0])
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/middleware"
+)
+
+// GET /api/users/events streams every change to the users as it happens,
+// as Server-Sent Events: one long response, text/event-stream, that the
+// server keeps writing to. In a browser it's just
+//
+//	new EventSource("/api/v1/users/events").addEventListener("user.created", ...)
+//
+// and EventSource reconnects by itself if the connection drops. Each
+// event is a few lines and a blank one:
+//
+//	id: 7
+//	event: user.updated
+//	data: {"id":1,"name":"John Doe",...}
+//
+// The handlers that change users publish to events, an in-process bus,
+// and every open stream is a subscriber that gets its own copy (fan-out).
+// Events aren't kept, so a client that reconnects gets only what happens
+// after; Last-Event-ID would need a replay buffer. A stream gets only its
+// tenant's events, like a list gets only its tenant's users.
+
+// The kinds of UserEvent
+const (
+	userCreated = "user.created"
+	userUpdated = "user.updated"
+	userDeleted = "user.deleted"
+)
+
+const (
+	// eventBuffer is how many events a subscriber can fall behind by
+	// before it's dropped
+	eventBuffer = 64
+	// heartbeatInterval is how often an idle stream sends a comment, so
+	// proxies don't close it for being quiet and a gone client is noticed
+	heartbeatInterval = 15 * time.Second
+)
+
+// UserEvent is one change to a user
+type UserEvent struct {
+	ID     int64 // counts up from 1, for the id: line
+	Type   string
+	User   domain.User // as it is after the change; before it, for a delete
+	Tenant string      // whose user it is
+}
+
+// events is the bus the user handlers publish to. Like suggestions, it's
+// published to under storeMu, so events arrive in the order the store
+// changed.
+var events = newEventBus()
+
+// allTenants subscribes to every tenant's events
+const allTenants = ""
+
+// eventBus fans each published event out to every subscriber
+type eventBus struct {
+	mu     sync.Mutex
+	nextID int64
+	subs   map[chan UserEvent]string // the tenant each subscribed to
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[chan UserEvent]string)}
+}
+
+// Subscribe returns a channel of every event for tenant published from
+// now on, or every tenant's for allTenants, and a function to
+// unsubscribe. The channel is closed on unsubscribing, or if the
+// subscriber falls eventBuffer events behind.
+func (b *eventBus) Subscribe(tenant string) (<-chan UserEvent, func()) {
+	ch := make(chan UserEvent, eventBuffer)
+	b.mu.Lock()
+	b.subs[ch] = tenant
+	b.mu.Unlock()
+	return ch, func() { b.drop(ch) }
+}
+
+// drop unsubscribes ch, if it still is subscribed
+func (b *eventBus) drop(ch chan UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Publish sends an event about a user of ctx's tenant to every
+// subscriber to that tenant. It never blocks: a subscriber whose buffer
+// is full is dropped, so one slow client can't hold up the handler
+// publishing (and the store's lock with it). Its stream ends, and
+// EventSource reconnects.
+func (b *eventBus) Publish(ctx context.Context, eventType string, user domain.User) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	e := UserEvent{ID: b.nextID, Type: eventType, User: user, Tenant: middleware.TenantFrom(ctx)}
+	for ch, tenant := range b.subs {
+		if tenant != allTenants && tenant != e.Tenant {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+			log.Printf("Dropped a user event subscriber that fell %d events behind", eventBuffer)
+		}
+	}
+}
+
+// CloseAll ends every subscription, so the streams end and the server
+// can shut down without waiting them out. The bus still works after.
+func (b *eventBus) CloseAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Subscribers is how many streams are open
+func (b *eventBus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// GET /api/{version}/users/events
+func (v *apiVersion) handleEvents(w http.ResponseWriter, r *http.Request) {
+	// Every event has to reach the client as soon as it's written, not
+	// when a buffer fills; the controller reaches past middleware
+	// wrappers to the connection's Flush
+	rc := http.NewResponseController(w)
+
+	ch, unsubscribe := events.Subscribe(middleware.TenantFrom(r.Context()))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // and nginx shouldn't buffer it either
+	w.WriteHeader(http.StatusOK)
+	// retry: tells EventSource how long to wait before reconnecting
+	if _, err := fmt.Fprint(w, "retry: 3000\n: connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("Error flushing event stream: %v", err)
+		return
+	}
+
+	heartbeat := clk.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			// The client went away; its request's context says so
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return // dropped, or the server is shutting down
+			}
+			err = v.writeEvent(w, r, e)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return // a write to a gone client fails
+		}
+	}
+}
+
+// writeEvent writes e as an SSE event, with the user as v sends it. Data
+// is one line of JSON, since a newline would end the data: field.
+func (v *apiVersion) writeEvent(w http.ResponseWriter, r *http.Request, e UserEvent) error {
+	data, err := json.Marshal(v.resource(r, e.User))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	githuboauth "golang.org/x/oauth2/github"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// Logging in with GitHub is OAuth 2's authorization-code flow, lesson 18's
+// client side, against a real provider. The API never sees a password:
+//
+//	browser → GET /auth/github/login     → 302 to github.com, with a state
+//	browser → github.com: log in, approve the app
+//	github  → 302 to /auth/github/callback?code=...&state=...
+//	API     → POST the code to GitHub for an access token, GET /user with it
+//	API     → 303 to /api/auth/me, with a session cookie
+//
+// The state, also kept in a cookie, ties the callback to the browser that
+// started the login, so nobody can log someone into an account of theirs.
+// PKCE ties the code to the server that asked for it, so a code leaked on
+// the way back is no use to anyone else.
+//
+// GitHub's access token is only used to ask who the user is, and then
+// dropped. What the API keeps is a session: a random ID in an HttpOnly
+// cookie, standing for the GitHub account's claims on the server. A write
+// with that cookie is allowed as one with a token is (see requireAuth),
+// and a session can be ended at once, by logging out, as a token can't.
+// The cookie is SameSite=Lax, so other sites' pages can't send writes
+// with it; and CORS doesn't allow credentials, so their scripts can't
+// either.
+//
+// The routes are there without GitHub too, but answer 404 until the
+// server has a client ID and secret: register an OAuth app at
+// https://github.com/settings/developers, with the callback URL
+// http://localhost:8080/auth/github/callback. Sessions are in memory,
+// so a restart logs everyone out.
+
+const (
+	// SessionCookie is the cookie a GitHub login's session is in
+	SessionCookie = "golab_session"
+	// githubStateCookie holds a login's state between login and callback
+	githubStateCookie = "golab_github_state"
+	// githubLoginTimeout is how long someone has to approve the app
+	githubLoginTimeout = 10 * time.Minute
+	// githubIssuer is the Issuer of a GitHub login's claims
+	githubIssuer = "github.com"
+	// sessionTTL is how long a session is good for
+	sessionTTL = 8 * time.Hour
+)
+
+// GitHubConfig is an OAuth app registered with GitHub. Endpoint and
+// APIURL are GitHub's own unless set; tests point them at a fake.
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL; empty uses the one the app was
+	// registered with
+	RedirectURL string
+	Endpoint    oauth2.Endpoint
+	APIURL      string
+}
+
+// githubUser is the part of GitHub's GET /user the API uses
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"` // empty if the user keeps it private
+}
+
+// githubLogin runs the flow for one OAuth app
+type githubLogin struct {
+	config *oauth2.Config
+	apiURL string
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin // by state
+}
+
+// pendingLogin is a login sent to GitHub that hasn't come back yet
+type pendingLogin struct {
+	verifier  string // PKCE's
+	expiresAt time.Time
+}
+
+var (
+	// github is the GitHub login, or nil without one; Start sets it
+	github *githubLogin
+	// sessions are the logged-in GitHub users' claims, by session ID
+	sessions = newSessionStore()
+)
+
+// newGitHubLogin returns the flow for cfg, or nil if cfg has no client ID
+func newGitHubLogin(cfg GitHubConfig) *githubLogin {
+	if cfg.ClientID == "" {
+		return nil
+	}
+	endpoint, apiURL := cfg.Endpoint, cfg.APIURL
+	if endpoint.AuthURL == "" {
+		endpoint = githuboauth.Endpoint
+	}
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	return &githubLogin{
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     endpoint,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+		},
+		apiURL:  strings.TrimSuffix(apiURL, "/"),
+		pending: make(map[string]pendingLogin),
+	}
+}
+
+// GET /auth/github/login
+func handleGitHubLogin(w http.ResponseWriter, r *http.Request) {
+	if github == nil {
+		respondWithError(w, r, http.StatusNotFound, "GitHub login isn't set up: start the server with -github-client-id and GITHUB_CLIENT_SECRET")
+		return
+	}
+	state, err := randomHex(16)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+	now := clk.Now()
+
+	github.mu.Lock()
+	for s, p := range github.pending { // drop abandoned logins
+		if !now.Before(p.expiresAt) {
+			delete(github.pending, s)
+		}
+	}
+	github.pending[state] = pendingLogin{verifier: verifier, expiresAt: now.Add(githubLoginTimeout)}
+	github.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     githubStateCookie,
+		Value:    state,
+		Path:     "/auth/github",
+		MaxAge:   int(githubLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, // Strict wouldn't come back from github.com
+	})
+	http.Redirect(w, r, github.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), http.StatusFound)
+}
+
+// GET /auth/github/callback
+func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
+	if github == nil {
+		respondWithError(w, r, http.StatusNotFound, "GitHub login isn't set up")
+		return
+	}
+	q := r.URL.Query()
+	if reason := q.Get("error"); reason != "" {
+		if description := q.Get("error_description"); description != "" {
+			reason = description
+		}
+		respondWithError(w, r, http.StatusUnauthorized, "GitHub didn't log you in: "+reason)
+		return
+	}
+
+	// The state must be the one this browser was sent off with
+	cookie, err := r.Cookie(githubStateCookie)
+	if err != nil || cookie.Value != q.Get("state") {
+		respondWithError(w, r, http.StatusBadRequest, "The login's state doesn't match this browser's; start again at /auth/github/login")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: githubStateCookie, Path: "/auth/github", MaxAge: -1})
+
+	github.mu.Lock()
+	login, ok := github.pending[cookie.Value]
+	delete(github.pending, cookie.Value)
+	github.mu.Unlock()
+	if !ok || !clk.Now().Before(login.expiresAt) {
+		respondWithError(w, r, http.StatusBadRequest, "The login expired; start again at /auth/github/login")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	token, err := github.config.Exchange(ctx, q.Get("code"), oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		log.Printf("GitHub code exchange failed: %v", err)
+		respondWithError(w, r, http.StatusBadGateway, "GitHub refused the code: "+describeOAuthError(err))
+		return
+	}
+	user, err := github.user(ctx, token)
+	if err != nil {
+		log.Printf("Fetching the GitHub user failed: %v", err)
+		respondWithError(w, r, http.StatusBadGateway, "Couldn't ask GitHub who you are")
+		return
+	}
+
+	id, err := sessions.create(githubClaims(user, clk.Now()))
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/api/auth/me", http.StatusSeeOther)
+}
+
+// POST /auth/github/logout
+func handleGitHubLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		sessions.delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Path: "/", MaxAge: -1})
+	respond.JSON(w, http.StatusOK, domain.APIResponse{Success: true, Message: "Logged out"})
+}
+
+// user asks GitHub who token belongs to
+func (g *githubLogin) user(ctx context.Context, token *oauth2.Token) (githubUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.apiURL+"/user", nil)
+	if err != nil {
+		return githubUser{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := g.config.Client(ctx, token).Do(req)
+	if err != nil {
+		return githubUser{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return githubUser{}, fmt.Errorf("GET /user: %s", resp.Status)
+	}
+	var user githubUser
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&user); err != nil {
+		return githubUser{}, fmt.Errorf("GET /user: %w", err)
+	}
+	if user.Login == "" {
+		return githubUser{}, errors.New("GET /user: no login")
+	}
+	return user, nil
+}
+
+// githubClaims are the claims of a session for user, started at now. The
+// subject isn't a user ID, so Claims.UserID is 0: a GitHub account needn't
+// be one of the API's users.
+func githubClaims(user githubUser, now time.Time) models.Claims {
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+	return models.Claims{
+		Subject:   "github:" + strconv.FormatInt(user.ID, 10),
+		Email:     user.Email,
+		Name:      name,
+		Issuer:    githubIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(sessionTTL).Unix(),
+	}
+}
+
+// describeOAuthError is the OAuth error code of a failed exchange, like
+// bad_verification_code, if the token endpoint sent one
+func describeOAuthError(err error) string {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode != "" {
+		return retrieveErr.ErrorCode
+	}
+	return err.Error()
+}
+
+// sessionStore keeps sessions' claims by ID, until they expire
+type sessionStore struct {
+	mu   sync.Mutex
+	byID map[string]models.Claims
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{byID: make(map[string]models.Claims)}
+}
+
+// create starts a session with claims, and returns its ID. Expired
+// sessions are dropped as new ones start.
+func (s *sessionStore) create(claims models.Claims) (string, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	now := clk.Now().Unix()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for old, c := range s.byID {
+		if c.ExpiresAt <= now {
+			delete(s.byID, old)
+		}
+	}
+	s.byID[id] = claims
+	return id, nil
+}
+
+// get is the claims of session id, if it exists and hasn't expired
+func (s *sessionStore) get(id string) (models.Claims, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims, ok := s.byID[id]
+	if !ok || claims.ExpiresAt <= clk.Now().Unix() {
+		return models.Claims{}, false
+	}
+	return claims, true
+}
+
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byID, id)
+}
+
+// sessionClaims are the claims of r's session cookie, if it has a live one
+func sessionClaims(r *http.Request) (models.Claims, bool) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return models.Claims{}, false
+	}
+	return sessions.get(cookie.Value)
+}
@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// /graphql serves the same users as the REST routes, from the same store,
+// as GraphQL. Where REST has a URL per resource and a method per action,
+// GraphQL has one endpoint, and the request says what it wants:
+//
+//	REST                                  GraphQL
+//	GET /api/v1/users/1                   { user(id: 1) { name email } }
+//	GET /api/v1/users?sort=-age&limit=3   { users(sort: "-age", limit: 3) { total users { name age } } }
+//	POST /api/v1/users                    mutation { createUser(name: "Ann", email: "ann@example.com", age: 30) { id } }
+//	PUT /api/v1/users/1, If-Match: 3      mutation { updateUser(id: 1, version: 3, age: 31) { version } }
+//	DELETE /api/v1/users/1                mutation { deleteUser(id: 1) { id } }
+//	GET /api/v1/users/events              subscription { userEvents { type user { id name } } }
+//
+// A client gets exactly the fields it asks for, nothing more, and one
+// request can ask for several things at once. That's why GraphQL needs no
+// /api/v2: firstName and lastName are just more fields, next to name, for
+// the clients that want them. What it gives up is HTTP's own machinery:
+// every request goes to the same URL, mostly as a POST, so there are no
+// ETags and no caching by URL, and an error is a 200 with "errors" in the
+// body, rather than a status code.
+//
+// Queries are open, as GETs are. A mutation needs what a REST write does,
+// a token, a writer API key or a session; it's refused with the same 401
+// or 403. A subscription is answered as Server-Sent Events, a "next"
+// event for each change and "complete" at the end, the way graphql-sse
+// does it; with GET, so EventSource can open one:
+//
+//	GET /graphql?query=subscription{userEvents{type user{id name}}}
+//
+// The schema is built with github.com/graphql-go/graphql. A real API
+// would write it in the schema language and generate the resolvers, with
+// gqlgen; here it's Go, so every resolver is in sight.
+
+// graphQLRequest is a GraphQL request, in a POST body or a GET's query
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"` // ignored
+}
+
+// graphQLError is a resolver's error, with a code in its extensions that
+// says what kind of failure it is, as a REST status would
+type graphQLError struct {
+	message string
+	code    string                   // BAD_REQUEST, NOT_FOUND, CONFLICT, VALIDATION_FAILED or INTERNAL
+	details []domain.ValidationError // for VALIDATION_FAILED
+}
+
+func (e *graphQLError) Error() string { return e.message }
+
+// Extensions implements gqlerrors.ExtendedError
+func (e *graphQLError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.code}
+	if e.details != nil {
+		ext["details"] = e.details
+	}
+	return ext
+}
+
+// graphQLStoreError is what a mutation answers for a store error: like
+// respondWithStoreError, the details of anything but a missing user go to
+// the log
+func graphQLStoreError(err error) error {
+	if errors.Is(err, store.ErrUserNotFound) {
+		return &graphQLError{message: "User not found", code: "NOT_FOUND"}
+	}
+	log.Printf("Error: %v", err)
+	return &graphQLError{message: "Internal server error", code: "INTERNAL"}
+}
+
+// graphQLSchema is built once, on first use
+var graphQLSchema = sync.OnceValue(func() graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:        graphQLQuery,
+		Mutation:     graphQLMutation,
+		Subscription: graphQLSubscription,
+	})
+	if err != nil {
+		panic(err) // the schema below is wrong
+	}
+	return schema
+})
+
+// timeField resolves a time of a user to RFC 3339, as the REST API sends it
+func timeField(of func(domain.User) time.Time) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			return of(p.Source.(domain.User)).UTC().Format(time.RFC3339), nil
+		},
+	}
+}
+
+// nameField resolves one part of a user's name, as v2 splits it
+func nameField(last bool) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			first, rest := models.SplitName(p.Source.(domain.User).Name)
+			if last {
+				return rest, nil
+			}
+			return first, nil
+		},
+	}
+}
+
+// The rest of the fields resolve by their json tags, from domain.User
+var graphQLUser = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"firstName": nameField(false),
+		"lastName":  nameField(true),
+		"email":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"age":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"createdAt": timeField(func(u domain.User) time.Time { return u.CreatedAt }),
+		"updatedAt": timeField(func(u domain.User) time.Time { return u.UpdatedAt }),
+	},
+})
+
+// graphQLUserPage is a page of users, as users returns it
+type graphQLUserPage struct {
+	Users []domain.User `json:"users"`
+	domain.PageMeta
+}
+
+var graphQLUserPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserPage",
+	Fields: graphql.Fields{
+		"users": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphQLUser))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(graphQLUserPage).Users, nil
+			},
+		},
+		"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: pageField(func(m domain.PageMeta) int { return m.Total })},
+		"page":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: pageField(func(m domain.PageMeta) int { return m.Page })},
+		"pages": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: pageField(func(m domain.PageMeta) int { return m.Pages })},
+	},
+})
+
+func pageField(of func(domain.PageMeta) int) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return of(p.Source.(graphQLUserPage).PageMeta), nil
+	}
+}
+
+var graphQLUserEvent = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserEvent",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (any, error) {
+			return int(p.Source.(UserEvent).ID), nil
+		}},
+		"type": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+			return p.Source.(UserEvent).Type, nil
+		}},
+		"user": &graphql.Field{Type: graphql.NewNonNull(graphQLUser), Resolve: func(p graphql.ResolveParams) (any, error) {
+			return p.Source.(UserEvent).User, nil
+		}},
+	},
+})
+
+var graphQLQuery = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"user": &graphql.Field{
+			Type: graphQLUser,
+			Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				user, err := db.Get(p.Context, p.Args["id"].(int))
+				if errors.Is(err, store.ErrUserNotFound) {
+					return nil, nil // null, as GraphQL has it
+				}
+				if err != nil {
+					return nil, graphQLStoreError(err)
+				}
+				return user, nil
+			},
+		},
+		"users": &graphql.Field{
+			Type:        graphql.NewNonNull(graphQLUserPageType),
+			Description: "A page of users, with GET /api/users's parameters",
+			Args: graphql.FieldConfigArgument{
+				"page":          {Type: graphql.Int},
+				"limit":         {Type: graphql.Int},
+				"sort":          {Type: graphql.String},
+				"minAge":        {Type: graphql.Int},
+				"emailContains": {Type: graphql.String},
+			},
+			Resolve: resolveUsers,
+		},
+	},
+})
+
+// resolveUsers answers users as GET /api/users answers its query string
+func resolveUsers(p graphql.ResolveParams) (any, error) {
+	values := url.Values{}
+	for arg, param := range map[string]string{"page": "page", "limit": "limit", "sort": "sort", "minAge": "min_age", "emailContains": "email_contains"} {
+		if value, ok := p.Args[arg]; ok {
+			values.Set(param, fmt.Sprint(value))
+		}
+	}
+	query, err := parseUserQuery(values)
+	if err != nil {
+		return nil, &graphQLError{message: err.Error(), code: "BAD_REQUEST"}
+	}
+	list, err := db.List(p.Context)
+	if err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	page, meta := query.paginate(query.filter(list), &url.URL{Path: "/graphql"})
+	return graphQLUserPage{Users: page, PageMeta: meta}, nil
+}
+
+var graphQLMutation = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Mutation",
+	Fields: graphql.Fields{
+		"createUser": &graphql.Field{
+			Type: graphql.NewNonNull(graphQLUser),
+			Args: graphql.FieldConfigArgument{
+				"name":  {Type: graphql.NewNonNull(graphql.String)},
+				"email": {Type: graphql.NewNonNull(graphql.String)},
+				"age":   {Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: resolveCreateUser,
+		},
+		"updateUser": &graphql.Field{
+			Type:        graphql.NewNonNull(graphQLUser),
+			Description: "Change the fields given, if the user is still at version",
+			Args: graphql.FieldConfigArgument{
+				"id":      {Type: graphql.NewNonNull(graphql.Int)},
+				"version": {Type: graphql.NewNonNull(graphql.Int)},
+				"name":    {Type: graphql.String},
+				"email":   {Type: graphql.String},
+				"age":     {Type: graphql.Int},
+			},
+			Resolve: resolveUpdateUser,
+		},
+		"deleteUser": &graphql.Field{
+			Type:        graphql.NewNonNull(graphQLUser),
+			Description: "Delete a user, and return it as it was; with a version, only if it's still at that one",
+			Args: graphql.FieldConfigArgument{
+				"id":      {Type: graphql.NewNonNull(graphql.Int)},
+				"version": {Type: graphql.Int},
+			},
+			Resolve: resolveDeleteUser,
+		},
+	},
+})
+
+// validationError is a VALIDATION_FAILED error for errs, or nil if errs
+// is empty
+func validationError(errs []domain.ValidationError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return &graphQLError{message: "Validation failed: " + strings.Join(messages, "; "), code: "VALIDATION_FAILED", details: errs}
+}
+
+// createUser, as POST /api/users does it
+func resolveCreateUser(p graphql.ResolveParams) (any, error) {
+	req := domain.CreateUserRequest{Name: p.Args["name"].(string), Email: p.Args["email"].(string), Age: p.Args["age"].(int)}
+	if err := validationError(req.Validate()); err != nil {
+		return nil, err
+	}
+
+	now := clk.Now()
+	storeMu.Lock()
+	user, err := db.Create(p.Context, domain.User{Name: req.Name, Email: req.Email, Age: req.Age, CreatedAt: now, UpdatedAt: now})
+	if err == nil {
+		suggestions.For(p.Context).Add(user)
+		events.Publish(p.Context, userCreated, user)
+	}
+	storeMu.Unlock()
+	if err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	snapshots.changed()
+	jobs.Enqueue(p.Context, welcomeEmail, user)
+	return user, nil
+}
+
+// updateUser, as PUT /api/users/{id} does it. version is required, as
+// If-Match is for PUT.
+func resolveUpdateUser(p graphql.ResolveParams) (any, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	old, err := db.Get(p.Context, p.Args["id"].(int))
+	if err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	if version := p.Args["version"].(int); version != old.Version {
+		return nil, &graphQLError{
+			message: fmt.Sprintf("The user is at version %d, not %d: someone changed it first. Query it again and retry", old.Version, version),
+			code:    "CONFLICT",
+		}
+	}
+
+	user := old
+	if name, ok := p.Args["name"].(string); ok {
+		user.Name = name
+	}
+	if email, ok := p.Args["email"].(string); ok {
+		user.Email = email
+	}
+	if age, ok := p.Args["age"].(int); ok {
+		user.Age = age
+	}
+	req := domain.CreateUserRequest{Name: user.Name, Email: user.Email, Age: user.Age}
+	if err := validationError(req.Validate()); err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = clk.Now()
+	user.Version++
+
+	if err := db.Update(p.Context, user); err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	suggestions.For(p.Context).Remove(old)
+	suggestions.For(p.Context).Add(user)
+	events.Publish(p.Context, userUpdated, user)
+	snapshots.changed()
+	return user, nil
+}
+
+// deleteUser, as DELETE /api/users/{id} does it
+func resolveDeleteUser(p graphql.ResolveParams) (any, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	user, err := db.Get(p.Context, p.Args["id"].(int))
+	if err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	if version, ok := p.Args["version"].(int); ok && version != user.Version {
+		return nil, &graphQLError{message: fmt.Sprintf("The user is at version %d, not %d", user.Version, version), code: "CONFLICT"}
+	}
+	if err := db.Delete(p.Context, user.ID); err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	suggestions.For(p.Context).Remove(user)
+	events.Publish(p.Context, userDeleted, user)
+	snapshots.changed()
+	return user, nil
+}
+
+var graphQLSubscription = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Subscription",
+	Fields: graphql.Fields{
+		"userEvents": &graphql.Field{
+			Type:        graphql.NewNonNull(graphQLUserEvent),
+			Description: "Every create, update and delete from now on, as GET /api/users/events streams them",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source, nil // the UserEvent subscribeUserEvents sent
+			},
+			Subscribe: subscribeUserEvents,
+		},
+	},
+})
+
+// subscribeUserEvents passes the event bus on to graphql-go, which wants a
+// chan any, until the request's context ends or the bus drops it
+func subscribeUserEvents(p graphql.ResolveParams) (any, error) {
+	ch, unsubscribe := events.Subscribe(middleware.TenantFrom(p.Context))
+	out := make(chan any)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- e:
+				case <-p.Context.Done():
+					return
+				}
+			case <-p.Context.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// operationType is "query", "mutation" or "subscription": the kind of the
+// operation in query that a request with operationName runs. It's empty if
+// query doesn't parse, or has no such operation; executing it says why.
+func operationType(query, operationName string) string {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		return ""
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation
+		}
+	}
+	return ""
+}
+
+// GET and POST /graphql
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if r.Method == http.MethodPost {
+		if !decodeBody(w, r, &req) {
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				respondWithError(w, r, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		respondWithError(w, r, http.StatusBadRequest, "A GraphQL request needs a query")
+		return
+	}
+	params := graphql.Params{
+		Schema:         graphQLSchema(),
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	}
+
+	switch operationType(req.Query, req.OperationName) {
+	case ast.OperationTypeMutation:
+		if r.Method != http.MethodPost {
+			// A GET must be safe to repeat, and to follow from a link
+			w.Header().Set("Allow", http.MethodPost)
+			respondWithError(w, r, http.StatusMethodNotAllowed, "Mutations need POST")
+			return
+		}
+		requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params.Context = r.Context()
+			respond.JSON(w, http.StatusOK, graphql.Do(params))
+		})).ServeHTTP(w, r)
+	case ast.OperationTypeSubscription:
+		streamGraphQL(w, r, params)
+	default:
+		respond.JSON(w, http.StatusOK, graphql.Do(params))
+	}
+}
+
+// streamGraphQL runs a subscription, writing each result as a "next"
+// Server-Sent Event until the client goes away or the server shuts down,
+// and then a "complete" one
+func streamGraphQL(w http.ResponseWriter, r *http.Request, params graphql.Params) {
+	rc := http.NewResponseController(w)
+	ctx, cancel := context.WithCancel(r.Context())
+	params.Context = ctx
+	results := graphql.Subscribe(params)
+	defer func() {
+		// graphql-go's goroutine stops when ctx does, but may be sending
+		// a result first; take it, so the goroutine isn't left blocked
+		cancel()
+		for range results {
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("Error flushing GraphQL stream: %v", err)
+		return
+	}
+
+	heartbeat := clk.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case result, ok := <-results:
+			if !ok {
+				_, err = fmt.Fprint(w, "event: complete\ndata:\n\n")
+				if err == nil {
+					err = rc.Flush()
+				}
+				if err != nil {
+					log.Printf("Error ending GraphQL stream: %v", err)
+				}
+				return
+			}
+			var data []byte
+			if data, err = json.Marshal(result); err == nil {
+				_, err = fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			}
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-ctx.Done():
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return // a write to a gone client fails
+		}
+	}
+}
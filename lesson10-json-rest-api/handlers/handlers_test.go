@@ -0,0 +1,3570 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
+	"golang-lab/lab/domain"
+	"golang-lab/lab/fixtures"
+	"golang-lab/lab/golden"
+	"golang-lab/lab/smoke"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+// useFakeClock stops the lesson's clock at demo.Clock for one test
+func useFakeClock(t *testing.T) *clock.Fake {
+	fake := clock.NewFake(demo.Clock)
+	clk = fake
+	t.Cleanup(func() { clk = clock.Real{} })
+	return fake
+}
+
+// countUsers is how many users the store has
+func countUsers(t *testing.T) int {
+	t.Helper()
+	list, err := db.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(list)
+}
+
+// newRequest is httptest.NewRequest with a token for user 1 on anything
+// but a read, as the API wants for changing users, and an admin API key
+// for anything under /api/admin
+func newRequest(t *testing.T, method, target, body string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if strings.HasPrefix(r.URL.Path, "/api/admin/") {
+		r.Header.Set(APIKeyHeader, testKey(t, models.RoleAdmin))
+	} else if !safeMethod(method) {
+		r.Header.Set("Authorization", "Bearer "+testToken(t))
+	}
+	return r
+}
+
+// ifMatchCurrent makes r a change to user id as the store has it now, by
+// its version in If-Match
+func ifMatchCurrent(t *testing.T, r *http.Request, id int) *http.Request {
+	t.Helper()
+	if user, err := db.Get(context.Background(), id); err == nil {
+		r.Header.Set("If-Match", strconv.Itoa(user.Version))
+	}
+	return r
+}
+
+// testKey issues an API key with role in the current store
+func testKey(t *testing.T, role models.Role) string {
+	t.Helper()
+	secret, _, err := issueKey(context.Background(), "test "+string(role), role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// testToken signs a token for user 1, John Doe, at the lesson's clock
+func testToken(t *testing.T) string {
+	t.Helper()
+	token, err := signToken(newClaims(domain.User{ID: 1, Name: "John Doe", Email: "john@example.com"}, clk.Now()), jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// TestAPI sends a fixed script of requests to the API and compares the
+// responses with testdata/api.golden
+func TestAPI(t *testing.T) {
+	db = store.NewMemory()
+	golden.Check(t, "api.golden", apiTranscript(t))
+}
+
+// apiTranscript seeds store and sends it the script of requests. The
+// clock moves a minute between requests, so updates show in the
+// timestamps. Tokens are signed with a fixed secret, so they're the same
+// on every run too.
+func apiTranscript(t *testing.T) string {
+	fake := useFakeClock(t)
+	secret := jwtSecret
+	jwtSecret = []byte("api.golden")
+	t.Cleanup(func() { jwtSecret = secret })
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	// Requests with signedIn send a token; those without are anonymous
+	const signedIn, anonymous = true, false
+	requests := []struct {
+		method, target, body string
+		token                bool
+	}{
+		{"GET", "/api/users/1", "", anonymous},
+		{"GET", "/api/users/99", "", anonymous},
+		{"GET", "/api/users/abc", "", anonymous},
+		{"POST", "/api/auth/login", `{"email":"john@example.com","password":"golab"}`, anonymous},
+		{"POST", "/api/auth/login", `{"email":"john@example.com","password":"wrong"}`, anonymous},
+		{"GET", "/api/auth/me", "", signedIn},
+		{"POST", "/api/users", `{"name":"Alice","email":"alice@example.com","age":30}`, anonymous},
+		{"POST", "/api/users", `{"name":"Alice","email":"alice@example.com","age":30}`, signedIn},
+		{"POST", "/api/users", `{"name":"","email":"alice","age":200}`, signedIn},
+		{"POST", "/api/users", `{"name":`, signedIn},
+		{"PUT", "/api/users/11", `{"email":"alice@example.org","version":1}`, signedIn},
+		{"PUT", "/api/users/11", `{"email":"alice@example.net","version":1}`, signedIn},
+		{"PUT", "/api/users/11", `{"email":"alice@example.net"}`, signedIn},
+		{"DELETE", "/api/users/2", "", signedIn},
+		{"GET", "/api/users/2", "", anonymous},
+		{"PATCH", "/api/users", "", signedIn},
+		{"GET", "/api/health", "", anonymous},
+		{"GET", "/api/users?page=2&limit=3&sort=-age", "", anonymous},
+		{"GET", "/api/users?min_age=40&email_contains=EXAMPLE.COM&sort=name", "", anonymous},
+		{"GET", "/api/users?limit=0", "", anonymous},
+		{"GET", "/api/users", "", anonymous},
+	}
+
+	var transcript strings.Builder
+	for _, req := range requests {
+		fake.Advance(time.Minute)
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+		if req.token {
+			r.Header.Set("Authorization", "Bearer "+testToken(t))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		request := strings.TrimSpace(req.method + " " + req.target + " " + req.body)
+		if req.token {
+			request += " (signed in)"
+		}
+		fmt.Fprintf(&transcript, "%s\n%d %s\n%s\n\n", request,
+			rec.Code, rec.Header().Get("Content-Type"), strings.TrimSpace(rec.Body.String()))
+	}
+	return transcript.String()
+}
+
+// TestSmoke makes sure -ci passes against freshly seeded data
+func TestSmoke(t *testing.T) {
+	db = tenantStore(store.NewMemory())
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	handler := middleware.Tenant(respondInvalidTenant)(mux)
+	token, err := smokeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminKey, err := smokeAdminKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := smoke.Run(io.Discard, handler, smokeSteps(token, adminKey)); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestBackup exports the store, empties it, restores the export, and
+// checks that bad backups are refused without touching the data
+func TestBackup(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, method, target, body))
+		return rec
+	}
+
+	export := send("GET", "/api/admin/export", "")
+	if export.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", export.Code, export.Body)
+	}
+	var backup domain.Backup
+	if err := json.Unmarshal(export.Body.Bytes(), &backup); err != nil {
+		t.Fatal(err)
+	}
+	if backup.Version != domain.BackupVersion || len(backup.Users) != fixtures.Small || backup.Users[0].ID != 1 {
+		t.Fatalf("export has version %d and %d users, want version %d and the %d seed users in ID order",
+			backup.Version, len(backup.Users), domain.BackupVersion, fixtures.Small)
+	}
+
+	for _, bad := range []string{
+		`{"version":2,"users":[]}`,
+		`{"version":1}`,
+		`{"version":1,"users":[{"id":1,"name":"A","email":"a@example.com"},{"id":1,"name":"B","email":"A@example.com"}]}`,
+		`{"version":1,"users":[`,
+	} {
+		if rec := send("POST", "/api/admin/import", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("importing %s = %d, want 400", bad, rec.Code)
+		}
+	}
+	if n := countUsers(t); n != fixtures.Small {
+		t.Fatalf("a refused import changed the store to %d users", n)
+	}
+
+	db = store.NewMemory()
+	if rec := send("POST", "/api/admin/import", export.Body.String()); rec.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", rec.Code, rec.Body)
+	}
+	if again := send("GET", "/api/admin/export", ""); again.Body.String() != export.Body.String() {
+		t.Errorf("export after restoring differs:\n%s\nwant\n%s", again.Body, export.Body)
+	}
+	if rec := send("POST", "/api/users", `{"name":"New","email":"new@example.com","age":20}`); !strings.Contains(rec.Body.String(), `"id":11`) {
+		t.Errorf("user created after import = %s, want ID 11, after the restored ones", rec.Body)
+	}
+}
+
+// TestMetrics sends requests through the full middleware chain and checks
+// both the Server-Timing header and what /api/admin/metrics reports
+func TestMetrics(t *testing.T) {
+	useFakeClock(t) // every duration is zero, so the output is exact
+	db = store.NewMemory()
+	initializeData()
+	metrics = middleware.NewMetrics()
+	handler := NewServer().Handler
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/99", nil))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(t, "POST", "/api/users", `{"name":"","email":"x","age":1}`))
+	if got := rec.Header().Get("Server-Timing"); got != "decode;dur=0.000, total;dur=0.000" {
+		t.Errorf("Server-Timing = %q, want the decode phase and the total", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(t, "GET", "/api/admin/metrics", ""))
+	want := `{"routes":[` +
+		`{"route":"GET /api/users/{id}","requests":2,"client_errors":1,"server_errors":0,"error_rate":0,"avg_ms":0,"max_ms":0},` +
+		`{"route":"POST /api/users","requests":1,"client_errors":1,"server_errors":0,"error_rate":0,"avg_ms":0,"max_ms":0}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("metrics = %s\nwant      %s", got, want)
+	}
+}
+
+// fixedStats is a store.StatsStore that answers with stats, or err
+type fixedStats struct {
+	stats models.UserStats
+	err   error
+}
+
+func (f fixedStats) Stats(ctx context.Context) (models.UserStats, error) {
+	return f.stats, f.err
+}
+
+// TestAdminStats checks GET /api/admin/stats is only there with a store
+// that works stats out itself, and only for admins
+func TestAdminStats(t *testing.T) {
+	t.Cleanup(func() { statsStore = nil })
+	handler := NewServer().Handler
+	get := func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	statsStore = nil
+	if rec := get(newRequest(t, "GET", "/api/admin/stats", "")); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "-storage mongo") {
+		t.Errorf("without a StatsStore: %d %s, want 404 naming -storage mongo", rec.Code, rec.Body.String())
+	}
+
+	statsStore = fixedStats{stats: models.UserStats{Total: 2, AverageAge: 35, MinAge: 30, MaxAge: 40, AgeBuckets: map[string]int{"30-49": 2}}}
+	rec := get(newRequest(t, "GET", "/api/admin/stats", ""))
+	want := `{"total":2,"average_age":35,"min_age":30,"max_age":40,"age_buckets":{"30-49":2}}`
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != want {
+		t.Errorf("GET /api/admin/stats = %d %s, want 200 %s", rec.Code, rec.Body.String(), want)
+	}
+
+	r := httptest.NewRequest("GET", "/api/admin/stats", nil)
+	if rec := get(r); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: %d, want 401", rec.Code)
+	}
+	r.Header.Set(APIKeyHeader, testKey(t, models.RoleWriter))
+	if rec := get(r); rec.Code != http.StatusForbidden {
+		t.Errorf("with a writer key: %d, want 403", rec.Code)
+	}
+	r = newRequest(t, "GET", "/api/admin/stats", "")
+	r.Header.Set(middleware.TenantHeader, "acme")
+	if rec := get(r); rec.Code != http.StatusNotFound {
+		t.Errorf("for another tenant: %d, want 404", rec.Code)
+	}
+
+	statsStore = fixedStats{err: errors.New("the server went away")}
+	if rec := get(newRequest(t, "GET", "/api/admin/stats", "")); rec.Code != http.StatusInternalServerError {
+		t.Errorf("when the store fails: %d, want 500", rec.Code)
+	}
+}
+
+// TestDuplicateEmail checks a store's ErrDuplicateEmail is a 409
+func TestDuplicateEmail(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondWithStoreError(rec, httptest.NewRequest("POST", "/api/users", nil), fmt.Errorf("inserting: %w", store.ErrDuplicateEmail))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "Email already in use") {
+		t.Errorf("ErrDuplicateEmail = %d %s, want 409", rec.Code, rec.Body.String())
+	}
+}
+
+// TestPrometheus checks GET /metrics against requests whose durations
+// are known, and that a request is in flight while it runs
+func TestPrometheus(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	metrics = middleware.NewMetrics()
+	handler := NewServer().Handler
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/99", nil))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != middleware.PrometheusContentType {
+		t.Fatalf("GET /metrics = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		`# TYPE golab_http_requests_total counter`,
+		`golab_http_requests_total{method="GET",route="/api/users/{id}",code="200"} 1`,
+		`golab_http_requests_total{method="GET",route="/api/users/{id}",code="404"} 1`,
+		`golab_http_request_errors_total{method="GET",route="/api/users/{id}",class="client"} 1`,
+		`golab_http_request_errors_total{method="GET",route="/api/users/{id}",class="server"} 0`,
+		`# TYPE golab_http_request_duration_seconds histogram`,
+		`golab_http_request_duration_seconds_bucket{method="GET",route="/api/users/{id}",le="0.005"} 2`,
+		`golab_http_request_duration_seconds_bucket{method="GET",route="/api/users/{id}",le="+Inf"} 2`,
+		`golab_http_request_duration_seconds_count{method="GET",route="/api/users/{id}"} 2`,
+		`golab_http_requests_in_flight 1`, // the scrape itself
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("GET /metrics is missing %s", line)
+		}
+	}
+
+}
+
+// TestHealthChecks checks GET /healthz and GET /readyz: readiness fails
+// with any check, a check that hangs times out, and the checks run at
+// the same time
+func TestHealthChecks(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	startedAt = fake.Now()
+	fake.Advance(90 * time.Second)
+	t.Cleanup(func() { readyChecks = []Check{storeCheck} })
+	handler := NewServer().Handler
+	get := func(path string, v any) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return rec
+	}
+
+	var live models.Liveness
+	if rec := get("/healthz", &live); rec.Code != http.StatusOK || live.Status != "alive" || live.Uptime != "1m30s" {
+		t.Errorf("GET /healthz = %d %+v, want 200, alive for 1m30s", rec.Code, live)
+	}
+
+	var ready models.Readiness
+	if rec := get("/readyz", &ready); rec.Code != http.StatusOK || ready.Status != "ready" ||
+		len(ready.Checks) != 1 || ready.Checks[0].Name != "store" || ready.Checks[0].Status != "ok" {
+		t.Errorf("GET /readyz = %d %+v, want 200, ready with the store ok", rec.Code, ready)
+	}
+
+	// A failure, and a check that ignores its context, make it unready
+	hang := make(chan struct{})
+	t.Cleanup(func() { close(hang) })
+	readyChecks = []Check{
+		storeCheck,
+		{Name: "broken", Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+		{Name: "hangs", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) error { <-hang; return nil }},
+	}
+	rec := get("/readyz", &ready)
+	if rec.Code != http.StatusServiceUnavailable || ready.Status != "unready" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("GET /readyz = %d %s %+v, want 503, unready, not cached", rec.Code, rec.Header().Get("Cache-Control"), ready)
+	}
+	want := []models.CheckResult{
+		{Name: "store", Status: "ok"},
+		{Name: "broken", Status: "failed", Error: "connection refused"},
+		{Name: "hangs", Status: "timeout", Error: "no answer within 20ms"},
+	}
+	for i := range ready.Checks {
+		ready.Checks[i].DurationMS = 0 // the fake clock stands still anyway
+	}
+	if !reflect.DeepEqual(ready.Checks, want) {
+		t.Errorf("checks = %+v\nwant     %+v", ready.Checks, want)
+	}
+
+	// Three checks of 50ms take 50ms together, not 150ms
+	clk = clock.Real{}
+	slow := Check{Name: "slow", Run: func(ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+	start := time.Now()
+	results := runChecks(context.Background(), []Check{slow, slow, slow})
+	if elapsed := time.Since(start); elapsed >= 140*time.Millisecond {
+		t.Errorf("three 50ms checks took %s; they should run at once", elapsed)
+	}
+	for _, result := range results {
+		if result.Status != "ok" || result.DurationMS < 50 {
+			t.Errorf("slow check = %+v, want ok after 50ms or more", result)
+		}
+	}
+}
+
+// TestUserCache checks GET /api/users/{id} is served from the cache the
+// second time, a PUT drops the user from it, and GET /api/health counts
+// the hits and misses
+func TestUserCache(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewCached(store.NewMemory(), 10, time.Minute, fake)
+	initializeData()
+	handler := NewServer().Handler
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send("GET", "/api/v1/users/1", "")
+	send("GET", "/api/v1/users/1", "")
+	if rec := send("PUT", "/api/v1/users/1", `{"name":"Johnny","version":1}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+	}
+	if rec := send("GET", "/api/v1/users/1", ""); !strings.Contains(rec.Body.String(), `"name":"Johnny"`) {
+		t.Errorf("GET after PUT = %s, want the new name", rec.Body)
+	}
+
+	var health models.HealthStatus
+	if err := json.Unmarshal(send("GET", "/api/health", "").Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	// GET, GET: a miss then a hit. The PUT reads the user too, a hit, and
+	// drops it, so the last GET is a miss.
+	want := models.CacheStats{Hits: 2, Misses: 2, Size: 1, Capacity: 10}
+	if health.Cache == nil || *health.Cache != want {
+		t.Errorf("health cache = %+v, want %+v", health.Cache, want)
+	}
+}
+
+// TestDependencyChecks checks DiskCheck and HTTPCheck, which Start adds
+// for the data file and -ready-url
+func TestDependencyChecks(t *testing.T) {
+	ctx := context.Background()
+	if err := DiskCheck(t.TempDir()).Run(ctx); err != nil {
+		t.Errorf("DiskCheck(a temp dir) = %v", err)
+	}
+	if err := DiskCheck(filepath.Join(t.TempDir(), "missing")).Run(ctx); err == nil {
+		t.Error("DiskCheck(a missing dir) passed")
+	}
+
+	status := http.StatusNoContent
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }))
+	defer upstream.Close()
+	if err := HTTPCheck(upstream.URL).Run(ctx); err != nil {
+		t.Errorf("HTTPCheck(a 204) = %v", err)
+	}
+	status = http.StatusInternalServerError
+	if err := HTTPCheck(upstream.URL).Run(ctx); err == nil || err.Error() != "answered 500 Internal Server Error" {
+		t.Errorf("HTTPCheck(a 500) = %v", err)
+	}
+	upstream.Close()
+	if err := HTTPCheck(upstream.URL).Run(ctx); err == nil {
+		t.Error("HTTPCheck(a closed server) passed")
+	}
+}
+
+// TestSnapshot drives the snapshot writer with a fake clock: changes wait
+// out the delay and are saved together, and Close saves the rest
+func TestSnapshot(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	path := filepath.Join(t.TempDir(), "users.json")
+	snapshots = startSnapshots(path, time.Second)
+	t.Cleanup(func() { snapshots = nil })
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, body string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, method, target, body))
+		if rec.Code >= 400 {
+			t.Fatalf("%s %s = %d %s", method, target, rec.Code, rec.Body)
+		}
+	}
+	savedUsers := func() int {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var backup domain.Backup
+		if err := json.Unmarshal(data, &backup); err != nil {
+			t.Fatal(err)
+		}
+		return len(backup.Users)
+	}
+
+	send("POST", "/api/users", `{"name":"A","email":"a@example.com","age":20}`)
+	fake.BlockUntil(1) // the writer is waiting out the delay
+	send("POST", "/api/users", `{"name":"B","email":"b@example.com","age":20}`)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("snapshot written before the delay passed (stat: %v)", err)
+	}
+	fake.Advance(time.Second)
+
+	// The rename makes the file appear all at once, already complete
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot not written after the delay")
+		}
+	}
+	if n := savedUsers(); n != fixtures.Small+2 {
+		t.Errorf("first snapshot has %d users, want both new ones: %d", n, fixtures.Small+2)
+	}
+
+	send("DELETE", "/api/users/11", "")
+	if err := snapshots.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := savedUsers(); n != fixtures.Small+1 {
+		t.Errorf("snapshot after Close has %d users, want the delete saved: %d", n, fixtures.Small+1)
+	}
+
+	db = store.NewMemory()
+	if loaded, err := loadSnapshot(path); !loaded || err != nil {
+		t.Fatalf("loadSnapshot = %v, %v", loaded, err)
+	}
+	next, err := db.Create(context.Background(), domain.User{Name: "Next"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countUsers(t); n != fixtures.Small+2 || next.ID != 13 {
+		t.Errorf("loaded %d users and then created ID %d, want %d and 13", n-1, next.ID, fixtures.Small+1)
+	}
+
+	if loaded, err := loadSnapshot(filepath.Join(t.TempDir(), "missing.json")); loaded || err != nil {
+		t.Errorf("loading a missing file = %v, %v; want false and no error", loaded, err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":1,"users":[{"id":0}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSnapshot(path); err == nil {
+		t.Error("loading an invalid snapshot succeeded")
+	}
+}
+
+// TestInvitations walks invitations through their life on a fake clock:
+// listed while active, 410 once expired, and finally swept away
+func TestInvitations(t *testing.T) {
+	fake := useFakeClock(t)
+	invitations = newInvitationStore()
+	t.Cleanup(func() { invitations = newInvitationStore() })
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, body string) (int, domain.APIResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, method, target, body))
+		var resp domain.APIResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+		return rec.Code, resp
+	}
+	// Listing needs a token too, GET or not
+	listed := func(target string) []string {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Authorization", "Bearer "+testToken(t))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", target, rec.Code)
+		}
+		var resp struct{ Data []models.Invitation }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var emails []string
+		for _, inv := range resp.Data {
+			emails = append(emails, inv.Email)
+		}
+		return emails
+	}
+
+	if code, _ := send("POST", "/api/invitations", `{"email":"short@example.com","ttl":"1h"}`); code != http.StatusCreated {
+		t.Fatalf("creating an invitation = %d", code)
+	}
+	_, resp := send("POST", "/api/invitations", `{"email":"long@example.com"}`)
+	token := resp.Data.(map[string]interface{})["token"].(string)
+	for _, body := range []string{`{"email":"x","ttl":"1h"}`, `{"email":"x@example.com","ttl":"-1h"}`, `{"email":"x@example.com","ttl":"9999h"}`} {
+		if code, _ := send("POST", "/api/invitations", body); code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, code)
+		}
+	}
+
+	if got := fmt.Sprint(listed("/api/invitations")); got != "[short@example.com long@example.com]" {
+		t.Errorf("active invitations = %s, soonest to expire first", got)
+	}
+	if got := fmt.Sprint(listed("/api/invitations?expires_within=2h")); got != "[short@example.com]" {
+		t.Errorf("invitations expiring within 2h = %s", got)
+	}
+
+	fake.Advance(time.Hour)
+	if got := fmt.Sprint(listed("/api/invitations")); got != "[long@example.com]" {
+		t.Errorf("active invitations after an hour = %s", got)
+	}
+	if got := fmt.Sprint(listed("/api/invitations?status=expired")); got != "[short@example.com]" {
+		t.Errorf("expired invitations = %s", got)
+	}
+	if code, _ := send("GET", "/api/invitations/"+token, ""); code != http.StatusOK {
+		t.Errorf("GET of an active invitation = %d", code)
+	}
+
+	// The sweeper deletes the expired invitation on its next tick
+	stop := startSweeper(invitations, sweepInterval)
+	defer stop()
+	fake.BlockUntil(1)
+	fake.Advance(sweepInterval)
+	for deadline := time.Now().Add(5 * time.Second); len(listed("/api/invitations?status=expired")) > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the sweeper didn't delete the expired invitation")
+		}
+	}
+	stop()
+
+	fake.Advance(models.DefaultInvitationTTL)
+	if code, _ := send("GET", "/api/invitations/"+token, ""); code != http.StatusGone {
+		t.Errorf("GET of an expired invitation = %d, want 410", code)
+	}
+	if n := invitations.Sweep(clk.Now()); n != 1 {
+		t.Errorf("Sweep deleted %d invitations, want 1", n)
+	}
+	if code, _ := send("DELETE", "/api/invitations/"+token, ""); code != http.StatusNotFound {
+		t.Errorf("DELETE of a swept invitation = %d, want 404", code)
+	}
+}
+
+// TestInvitationsNeedAuth checks that listing, making or revoking
+// invitations without a token is turned away, and changes nothing
+func TestInvitationsNeedAuth(t *testing.T) {
+	invitations = newInvitationStore()
+	t.Cleanup(func() { invitations = newInvitationStore() })
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, newRequest(t, "POST", "/api/invitations", `{"email":"kept@example.com"}`))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/invitations with a token = %d, want 201", rec.Code)
+	}
+	var created domain.APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	token := created.Data.(map[string]interface{})["token"].(string)
+
+	for _, req := range []struct{ method, target, body string }{
+		{"GET", "/api/invitations", ""},
+		{"GET", "/api/invitations?status=expired", ""},
+		{"POST", "/api/invitations", `{"email":"mallory@example.com"}`},
+		{"DELETE", "/api/invitations/" + token, ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(req.method, req.target, strings.NewReader(req.body)))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token = %d, want 401", req.method, req.target, rec.Code)
+		}
+	}
+	if list := invitations.List(invitationFilter{}, clk.Now()); len(list) != 1 || list[0].Email != "kept@example.com" {
+		t.Errorf("invitations after the refused requests = %+v, want only kept@example.com", list)
+	}
+}
+
+// flakyMailer fails the first few sends to each address it has a count
+// for, and records the sends that work
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures map[string]int
+	sent     []string
+}
+
+func (m *flakyMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures[to] > 0 {
+		m.failures[to]--
+		return fmt.Errorf("the mail server refused %s", to)
+	}
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+// TestJobs creates users whose welcome emails work, fail once, and always
+// fail, and follows the jobs through their retries on a fake clock
+func TestJobs(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mailer := &flakyMailer{failures: map[string]int{"ada@example.com": 1, "nobody@example.com": 99}}
+	old := jobs
+	jobs = newJobQueue(welcomeJob(mailer), 3, time.Second)
+	stop := jobs.start(2)
+	t.Cleanup(func() {
+		stop()
+		jobs = old
+	})
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	for _, email := range []string{"bob@example.com", "ada@example.com", "nobody@example.com"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, "POST", "/api/users", fmt.Sprintf(`{"name":"Someone","email":%q,"age":30}`, email)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("creating %s = %d %s", email, rec.Code, rec.Body)
+		}
+	}
+	waitFor(t, "one email sent and two to retry", func() bool {
+		status := jobs.Status()
+		return status.Done == 1 && status.Retrying == 2
+	})
+	for _, job := range jobs.Status().Pending {
+		if job.Attempts != 1 || job.RetryAt == nil || !job.RetryAt.Equal(clk.Now().Add(time.Second)) || job.Error == "" {
+			t.Errorf("after one failure, job = %+v; want a retry in 1s, and why", job)
+		}
+	}
+
+	// The first retry is a second later, and works for ada; the next is
+	// two seconds after that
+	fake.BlockUntil(2)
+	fake.Advance(time.Second)
+	waitFor(t, "ada's retry to work", func() bool {
+		status := jobs.Status()
+		return status.Done == 2 && status.Retrying == 1 && status.Pending[0].Attempts == 2
+	})
+	if job := jobs.Status().Pending[0]; job.To != "nobody@example.com" || !job.RetryAt.Equal(clk.Now().Add(2*time.Second)) {
+		t.Errorf("after two failures, job = %+v; want a retry in 2s", job)
+	}
+
+	// The third failure is the last: the job is a dead letter
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Second)
+	waitFor(t, "a dead letter", func() bool { return jobs.Status().Dead == 1 })
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/jobs", nil))
+	var resp struct{ Data models.JobQueueStatus }
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/jobs = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	status := resp.Data
+	if status.Workers != 2 || status.Done != 2 || status.Dead != 1 || len(status.Pending) != 0 {
+		t.Errorf("GET /api/jobs = %+v; want 2 workers, 2 done, 1 dead and none pending", status)
+	}
+	if len(status.Finished) != 2 || status.Finished[0].To != "ada@example.com" || status.Finished[0].Status != models.JobDone {
+		t.Errorf("finished = %+v; want ada's job first, as the latest", status.Finished)
+	}
+	if len(status.DeadLetters) != 1 || status.DeadLetters[0].Attempts != 3 ||
+		status.DeadLetters[0].Error != "the mail server refused nobody@example.com" {
+		t.Errorf("dead letters = %+v; want nobody's job, after 3 attempts, and why", status.DeadLetters)
+	}
+	if !slices.Equal(mailer.sent, []string{"bob@example.com", "ada@example.com"}) {
+		t.Errorf("sent to %v", mailer.sent)
+	}
+}
+
+// TestQuotas uses up a key's quota, checks the headers and the 429, and
+// resets it both through the admin endpoint and by waiting for midnight
+func TestQuotas(t *testing.T) {
+	fake := useFakeClock(t) // 09:00 UTC
+	db = store.NewMemory()
+	initializeData()
+	quotas = middleware.NewQuotas(2)
+	t.Cleanup(func() { quotas = middleware.NewQuotas(middleware.DefaultDailyQuota) })
+	handler := NewServer().Handler
+	get := func(target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	// Alice's key is an admin's, so she can check her own quota
+	alice, aliceKey, err := issueKey(context.Background(), "alice", models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, bobKey, err := issueKey(context.Background(), "bob", models.RoleReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"1", "0"} {
+		rec := get("/api/users", alice)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != want {
+			t.Errorf("request %d = %d with %q remaining, want 200 and %s", i+1, rec.Code, rec.Header().Get("X-Quota-Remaining"), want)
+		}
+	}
+	rec := get("/api/users", alice)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "54000" {
+		t.Errorf("request over quota = %d, Retry-After %q; want 429 and the 15h until midnight", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("X-Quota-Reset") != "2024-01-02T00:00:00Z" {
+		t.Errorf("X-Quota-Reset = %q", rec.Header().Get("X-Quota-Reset"))
+	}
+	if rec := get("/api/users", bob); rec.Code != http.StatusOK {
+		t.Errorf("another key = %d, want its own quota", rec.Code)
+	}
+	if rec := get("/api/users", ""); rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != "" {
+		t.Errorf("request without a key = %d, X-Quota-Remaining %q; want it uncounted", rec.Code, rec.Header().Get("X-Quota-Remaining"))
+	}
+
+	// Admin endpoints still work for an exhausted key
+	rec = get("/api/admin/quotas/"+aliceKey.ID, alice)
+	want := `{"key":"` + aliceKey.ID + `","limit":2,"used":2,"remaining":0,"resets_at":"2024-01-02T00:00:00Z"}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("alice's quota = %s\nwant            %s", got, want)
+	}
+	req := httptest.NewRequest("DELETE", "/api/admin/quotas/"+aliceKey.ID, nil)
+	req.Header.Set(APIKeyHeader, alice)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if rec := get("/api/users", alice); rec.Code != http.StatusOK {
+		t.Errorf("request after a reset = %d, want 200", rec.Code)
+	}
+
+	fake.Advance(15 * time.Hour)
+	if got := quotas.Get(bobKey.ID, clk.Now()); got.Used != 0 || got.Remaining != 2 {
+		t.Errorf("bob's quota the next day = %+v, want it back in full", got)
+	}
+}
+
+// TestRateLimit empties a client's bucket, checks the 429 and
+// Retry-After, waits for it to refill, and has the evictor forget it
+func TestRateLimit(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	limiter = middleware.NewRateLimiter(2, 3) // 2 a second, in bursts of 3
+	t.Cleanup(func() { limiter = middleware.NewRateLimiter(middleware.DefaultRate, middleware.DefaultBurst) })
+	handler := NewServer().Handler
+	get := func(remoteAddr, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		req.Header.Set("Accept", problemContentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The burst goes through at once, then the bucket is empty
+	for i, want := range []string{"2", "1", "0"} {
+		rec := get("192.0.2.1:1000", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != want {
+			t.Errorf("request %d = %d with %q remaining, want 200 and %s", i+1, rec.Code, rec.Header().Get("X-RateLimit-Remaining"), want)
+		}
+	}
+	rec := get("192.0.2.1:2000", "") // another port, the same client
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("request over the limit = %d, Retry-After %q; want 429 and 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var problem models.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem.Type != problemTypesPath+"rate-limited" {
+		t.Errorf("429 body = %s, want a rate-limited problem", rec.Body)
+	}
+
+	// Other clients have their own buckets: another address, or an API key
+	if rec := get("192.0.2.2:1000", ""); rec.Code != http.StatusOK {
+		t.Errorf("another address = %d, want its own bucket", rec.Code)
+	}
+	if rec := get("192.0.2.1:1000", testKey(t, models.RoleReader)); rec.Code != http.StatusOK {
+		t.Errorf("an API key from the same address = %d, want its own bucket", rec.Code)
+	}
+
+	// A token every half second
+	fake.Advance(400 * time.Millisecond)
+	if rec := get("192.0.2.1:1000", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("after 0.4s = %d, want still 429", rec.Code)
+	}
+	fake.Advance(100 * time.Millisecond)
+	if rec := get("192.0.2.1:1000", ""); rec.Code != http.StatusOK {
+		t.Errorf("after 0.5s = %d, want a token", rec.Code)
+	}
+
+}
+
+// TestSuggest looks users up by prefix, and checks the index follows
+// creates, updates and deletes
+func TestSuggest(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		req := newRequest(t, method, target, body)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	suggest := func(query string) []int {
+		t.Helper()
+		rec := send("GET", "/api/users/suggest?"+query, "")
+		var resp struct{ Data []domain.User }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("suggest?%s = %d %s", query, rec.Code, rec.Body)
+		}
+		ids := make([]int, len(resp.Data))
+		for i, user := range resp.Data {
+			ids[i] = user.ID
+		}
+		return ids
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"prefix=j", []int{2, 1}}, // jane, then john
+		{"prefix=J&limit=1", []int{2}},
+		{"prefix=AL", []int{9}},
+		{"prefix=turing", []int{3}},
+		{"prefix=ada.knuth", []int{7}},
+		{"prefix=xyz", []int{}},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("suggest?%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	send("POST", "/api/users", `{"name":"Alice Zephyr","email":"alice@example.com","age":30}`)
+	if got := suggest("prefix=zep"); !reflect.DeepEqual(got, []int{11}) {
+		t.Errorf("after create, suggest zep = %v, want [11]", got)
+	}
+	send("PUT", "/api/users/11", `{"name":"Alice Young","version":1}`)
+	if got := suggest("prefix=zep"); len(got) != 0 {
+		t.Errorf("after renaming, suggest zep = %v, want nothing", got)
+	}
+	if got := suggest("prefix=you"); !reflect.DeepEqual(got, []int{11}) {
+		t.Errorf("after renaming, suggest you = %v, want [11]", got)
+	}
+	send("DELETE", "/api/users/11", "")
+	if got := suggest("prefix=alice"); len(got) != 0 {
+		t.Errorf("after delete, suggest alice = %v, want nothing", got)
+	}
+
+	for _, bad := range []string{"", "prefix=%20", "prefix=a&limit=0", "prefix=a&limit=51", "prefix=a&limit=ten"} {
+		if rec := send("GET", "/api/users/suggest?"+bad, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("suggest?%s = %d, want 400", bad, rec.Code)
+		}
+	}
+	if rec := send("POST", "/api/users/suggest?prefix=a", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST suggest = %d, want 405", rec.Code)
+	}
+}
+
+// TestSuggestIndex checks the index finds what a scan of every user
+// finds, whether it was built all at once or a user at a time
+func TestSuggestIndex(t *testing.T) {
+	list := fixtures.Users(fixtures.Medium)
+	all := make(map[int]domain.User, len(list))
+	var built, added suggestIndex
+	built.Rebuild(list)
+	for _, user := range list {
+		all[user.ID] = user
+		added.Add(user)
+	}
+	if !reflect.DeepEqual(built.entries, added.entries) {
+		t.Fatal("adding users one at a time built a different index from Rebuild")
+	}
+
+	check := func(when string) {
+		for _, prefix := range []string{"a", "al", "ALAN", "ada.", "k", "radia.perlman", "zz", ""} {
+			got, want := added.Lookup(prefix, 20), naiveSuggest(all, prefix, 20)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: Lookup(%q) = %v, want %v", when, prefix, got, want)
+			}
+		}
+	}
+	check("all users")
+	for id := 1; id <= len(list); id += 2 {
+		added.Remove(all[id])
+		delete(all, id)
+	}
+	check("after removing half")
+}
+
+// BenchmarkSuggest compares the index with scanning every user, as the
+// number of users grows: the index stays about the same, the scan grows
+// with it
+func BenchmarkSuggest(b *testing.B) {
+	for _, n := range []int{fixtures.Medium, fixtures.Large} {
+		list := fixtures.Users(n)
+		all := make(map[int]domain.User, n)
+		for _, user := range list {
+			all[user.ID] = user
+		}
+		var ix suggestIndex
+		ix.Rebuild(list)
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ix.Lookup("ada", defaultSuggestions)
+			}
+		})
+		b.Run(fmt.Sprintf("naive/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				naiveSuggest(all, "ada", defaultSuggestions)
+			}
+		})
+	}
+}
+
+// TestProblems checks errors come as RFC 7807 problems to clients that
+// ask for them, and as before to everyone else
+func TestProblems(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, accept, body string) *httptest.ResponseRecorder {
+		req := newRequest(t, method, target, body)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	problemOf := func(rec *httptest.ResponseRecorder) models.Problem {
+		t.Helper()
+		if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+			t.Fatalf("Content-Type = %q, want %q; body %s", ct, problemContentType, rec.Body)
+		}
+		var p models.Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// Without asking, errors are the usual ErrorResponse
+	rec := send("GET", "/api/users/99", "", "")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" || !strings.Contains(rec.Body.String(), `"error":"User not found"`) {
+		t.Errorf("plain 404 = %s %s", ct, rec.Body)
+	}
+
+	want := models.Problem{Type: "/api/problems/not-found", Title: "Not found", Status: 404, Detail: "User not found", Instance: "/api/users/99"}
+	for _, accept := range []string{problemContentType, "application/json, application/problem+json;q=0.5"} {
+		rec := send("GET", "/api/users/99", accept, "")
+		if got := problemOf(rec); rec.Code != 404 || !reflect.DeepEqual(got, want) {
+			t.Errorf("Accept %q: %d %+v, want %+v", accept, rec.Code, got, want)
+		}
+	}
+	if rec := send("GET", "/api/users/99", "application/problem+json;q=0", ""); rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("q=0 still got %s", rec.Header().Get("Content-Type"))
+	}
+
+	rec = send("POST", "/api/users", problemContentType, `{"name":"","email":"alice","age":200}`)
+	if p := problemOf(rec); p.Type != "/api/problems/validation-failed" || p.Status != 400 || len(p.Errors) != 3 {
+		t.Errorf("validation problem = %+v", p)
+	}
+
+	// Status codes missing from the catalog are about:blank
+	if p := newProblem(http.StatusTeapot, "short and stout"); p.Type != "about:blank" || p.Title != "I'm a teapot" {
+		t.Errorf("uncatalogued problem = %+v", p)
+	}
+
+	// Every type in the catalog is documented at its URI
+	types := []problemType{validationFailed}
+	for _, pt := range problemCatalog {
+		types = append(types, pt)
+	}
+	for _, pt := range types {
+		p := pt.problem("")
+		rec := send("GET", p.Type, "", "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), pt.title) {
+			t.Errorf("GET %s = %d %s", p.Type, rec.Code, rec.Body)
+		}
+	}
+	if rec := send("GET", "/api/problems/nosuchtype", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET unknown problem type = %d, want 404", rec.Code)
+	}
+
+	// -problems sends them to everyone
+	problemsAlways = true
+	t.Cleanup(func() { problemsAlways = false })
+	if p := problemOf(send("DELETE", "/api/users/99", "", "")); p.Status != 404 {
+		t.Errorf("with -problems, DELETE 99 = %+v", p)
+	}
+}
+
+// TestLogBodies logs in and issues an API key with bodies logged, and
+// checks the password, token and key never reach the log
+func TestLogBodies(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	logBodies = true
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		logBodies = false
+	})
+	handler := NewServer().Handler
+
+	var secrets []string
+	for _, tt := range []struct{ target, body, header, secret string }{
+		{"/api/auth/login", `{"email":"john@example.com","password":"` + loginPassword + `"}`, "", "token"},
+		{"/api/admin/keys", `{"name":"ci","role":"reader"}`, testKey(t, models.RoleAdmin), "key"},
+	} {
+		r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		if tt.header != "" {
+			r.Header.Set(APIKeyHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		var resp struct{ Data map[string]any }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Data[tt.secret] == nil {
+			t.Fatalf("POST %s = %d %s", tt.target, rec.Code, rec.Body)
+		}
+		secrets = append(secrets, resp.Data[tt.secret].(string))
+	}
+
+	logged := buf.String()
+	for _, want := range []string{`"password":"[REDACTED]"`, `"token":"[REDACTED]"`, `"key":"[REDACTED]"`, `"name":"ci"`} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("the log doesn't have %s:\n%s", want, logged)
+		}
+	}
+	for _, secret := range append(secrets, loginPassword) {
+		if strings.Contains(logged, secret) {
+			t.Errorf("the log has the secret %q:\n%s", secret, logged)
+		}
+	}
+}
+
+// TestCORSOrigins checks that -cors-origin limits which origins are
+// allowed, and that none allows any
+func TestCORSOrigins(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	t.Cleanup(func() { corsOrigins = nil })
+
+	for _, tt := range []struct {
+		origins     []string
+		origin      string
+		allowOrigin string
+	}{
+		{nil, "https://anywhere.example", "*"},
+		{[]string{"https://app.example.com"}, "https://app.example.com", "https://app.example.com"},
+		{[]string{"https://app.example.com"}, "https://evil.example", ""},
+	} {
+		corsOrigins = tt.origins
+		r := httptest.NewRequest("GET", "/api/health", nil)
+		r.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		NewServer().Handler.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("origins %q, Origin %s: Access-Control-Allow-Origin = %q, want %q", tt.origins, tt.origin, got, tt.allowOrigin)
+		}
+	}
+}
+
+// TestTenants checks that each X-Tenant-ID sees its own users, and none
+// of another tenant's: lists, gets, deletes, suggestions, events and
+// tokens
+func TestTenants(t *testing.T) {
+	useFakeClock(t)
+	db = tenantStore(store.NewMemory())
+	suggestions = &tenantIndexes{}
+	initializeData()
+	handler := NewServer().Handler
+	key := testKey(t, models.RoleWriter) // API keys work for every tenant
+	send := func(tenant, method, target, auth, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if tenant != "" {
+			r.Header.Set(middleware.TenantHeader, tenant)
+		}
+		if strings.HasPrefix(auth, "Bearer ") {
+			r.Header.Set("Authorization", auth)
+		} else if auth != "" {
+			r.Header.Set(APIKeyHeader, auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	names := func(tenant string) []string {
+		t.Helper()
+		rec := send(tenant, "GET", "/api/users?limit=100", "", "")
+		var resp struct{ Data []domain.User }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("%s: GET /api/users = %d %s", tenant, rec.Code, rec.Body)
+		}
+		var names []string
+		for _, user := range resp.Data {
+			names = append(names, user.Name)
+		}
+		return names
+	}
+
+	acmeEvents, unsubscribe := events.Subscribe("acme")
+	defer unsubscribe()
+	for _, c := range []struct{ tenant, body string }{
+		{"acme", `{"name":"Ann Acme","email":"ann@acme.example","age":30}`},
+		{"globex", `{"name":"Gus Globex","email":"gus@globex.example","age":40}`},
+	} {
+		rec := send(c.tenant, "POST", "/api/users", key, c.body)
+		var resp struct{ Data domain.User }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusCreated || err != nil || resp.Data.ID != 1 {
+			t.Fatalf("%s: POST /api/users = %d %s; want user 1, the tenant's first", c.tenant, rec.Code, rec.Body)
+		}
+	}
+
+	if got := names("acme"); !slices.Equal(got, []string{"Ann Acme"}) {
+		t.Errorf("acme's users = %q, want only Ann", got)
+	}
+	if got := names("globex"); !slices.Equal(got, []string{"Gus Globex"}) {
+		t.Errorf("globex's users = %q, want only Gus", got)
+	}
+	if got := names(""); len(got) != 10 || slices.Contains(got, "Ann Acme") || slices.Contains(got, "Gus Globex") {
+		t.Errorf("the default tenant's users = %q, want the 10 samples", got)
+	}
+	if got := names(store.DefaultTenant); len(got) != 10 {
+		t.Errorf("X-Tenant-ID: default got %d users, want the same 10", len(got))
+	}
+	if rec := send("acme", "GET", "/api/users/2", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("acme: GET /api/users/2 = %d, want 404: user 2 is the default tenant's", rec.Code)
+	}
+	if rec := send("acme", "GET", "/api/users/suggest?prefix=j", "", ""); !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Errorf("acme: suggest?prefix=j = %s, want none of the default tenant's Johns and Janes", rec.Body)
+	}
+	if rec := send("", "GET", "/api/users/suggest?prefix=ann", "", ""); strings.Contains(rec.Body.String(), "Ann Acme") {
+		t.Errorf("suggest?prefix=ann = %s, found acme's Ann", rec.Body)
+	}
+	select {
+	case e := <-acmeEvents:
+		if e.Tenant != "acme" || e.User.Name != "Ann Acme" {
+			t.Errorf("acme's stream got %+v, want Ann's creation", e)
+		}
+	default:
+		t.Error("acme's stream got no event for Ann")
+	}
+	select {
+	case e := <-acmeEvents:
+		t.Errorf("acme's stream got %+v, another tenant's event", e)
+	default:
+	}
+
+	// A token is for the tenant it was issued under
+	login := send("acme", "POST", "/api/auth/login", "", `{"email":"ann@acme.example","password":"`+loginPassword+`"}`)
+	var resp struct{ Data models.TokenResponse }
+	if err := json.Unmarshal(login.Body.Bytes(), &resp); login.Code != http.StatusOK || err != nil {
+		t.Fatalf("acme: login = %d %s", login.Code, login.Body)
+	}
+	token := "Bearer " + resp.Data.Token
+	if rec := send("", "DELETE", "/api/users/1", token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("acme's token without X-Tenant-ID: DELETE = %d, want 401", rec.Code)
+	}
+	if rec := send("globex", "DELETE", "/api/users/1", "Bearer "+testToken(t), ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("the default tenant's token for globex: DELETE = %d, want 401", rec.Code)
+	}
+	if rec := send("acme", "DELETE", "/api/users/1", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("acme: DELETE /api/users/1 = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if got := names("acme"); len(got) != 0 {
+		t.Errorf("acme's users after the delete = %q, want none", got)
+	}
+	if got := names("globex"); len(got) != 1 || countUsers(t) != 10 {
+		t.Errorf("acme's delete reached another tenant: globex has %q, the default tenant %d", got, countUsers(t))
+	}
+
+	rec := send("not a tenant!", "GET", "/api/users", "", "")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), middleware.TenantHeader) {
+		t.Errorf("a bad X-Tenant-ID = %d %s, want 400", rec.Code, rec.Body)
+	}
+	if vary := rec.Header().Values("Vary"); !slices.Contains(vary, middleware.TenantHeader) {
+		t.Errorf("Vary = %q, want it to include %s", vary, middleware.TenantHeader)
+	}
+}
+
+// TestTokens signs tokens and checks every way parseToken refuses one
+func TestTokens(t *testing.T) {
+	fake := useFakeClock(t)
+	secret := []byte("test secret")
+	claims := newClaims(domain.User{ID: 7, Name: "Ada", Email: "ada@example.com"}, fake.Now())
+	token, err := signToken(claims, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parseToken(token, secret, fake.Now()); err != nil || got != claims || got.UserID() != 7 {
+		t.Fatalf("parseToken = %+v, %v; want %+v", got, err, claims)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := newClaims(domain.User{ID: 1, Name: "Ada", Email: "ada@example.com"}, fake.Now())
+	forgedPayload, _ := json.Marshal(forged)
+	none := `{"alg":"none","typ":"JWT"}`
+	for _, tt := range []struct {
+		name, token string
+		want        error
+	}{
+		{"another secret", token, ErrTokenSignature},
+		{"edited claims", parts[0] + "." + base64URL(string(forgedPayload)) + "." + parts[2], ErrTokenSignature},
+		{"alg none", base64URL(none) + "." + parts[1] + ".", ErrTokenMalformed},
+		{"two parts", parts[0] + "." + parts[1], ErrTokenMalformed},
+		{"not base64", "!!." + parts[1] + "." + parts[2], ErrTokenMalformed},
+	} {
+		key := secret
+		if tt.name == "another secret" {
+			key = []byte("another secret")
+		}
+		if _, err := parseToken(tt.token, key, fake.Now()); !errors.Is(err, tt.want) {
+			t.Errorf("%s: parseToken = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Good until the second it expires
+	fake.Advance(tokenTTL - time.Second)
+	if _, err := parseToken(token, secret, fake.Now()); err != nil {
+		t.Errorf("a second before expiry: %v", err)
+	}
+	fake.Advance(time.Second)
+	if _, err := parseToken(token, secret, fake.Now()); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("at expiry: parseToken = %v, want ErrTokenExpired", err)
+	}
+}
+
+func base64URL(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// TestAuth logs in over HTTP and checks which requests requireAuth lets
+// through
+func TestAuth(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	wrongPassword := send("POST", "/api/auth/login", "", `{"email":"jane@example.com","password":"nope"}`)
+	unknownEmail := send("POST", "/api/auth/login", "", `{"email":"nobody@example.com","password":"golab"}`)
+	if wrongPassword.Code != http.StatusUnauthorized || wrongPassword.Body.String() != unknownEmail.Body.String() {
+		t.Errorf("a wrong password gets %d %s and an unknown email %d %s; want the same 401",
+			wrongPassword.Code, wrongPassword.Body, unknownEmail.Code, unknownEmail.Body)
+	}
+
+	login := send("POST", "/api/auth/login", "", `{"email":"Jane@Example.com","password":"golab"}`)
+	var resp struct{ Data models.TokenResponse }
+	if err := json.Unmarshal(login.Body.Bytes(), &resp); login.Code != http.StatusOK || err != nil {
+		t.Fatalf("login = %d %s", login.Code, login.Body)
+	}
+	token := resp.Data.Token
+	if !resp.Data.ExpiresAt.Equal(fake.Now().Add(tokenTTL)) {
+		t.Errorf("token expires at %v, want %v", resp.Data.ExpiresAt, fake.Now().Add(tokenTTL))
+	}
+
+	me := send("GET", "/api/auth/me", token, "")
+	var claims struct{ Data models.Claims }
+	if err := json.Unmarshal(me.Body.Bytes(), &claims); err != nil || claims.Data.UserID() != 2 || claims.Data.Email != "jane@example.com" {
+		t.Errorf("/api/auth/me = %d %s, want Jane's claims", me.Code, me.Body)
+	}
+
+	for _, tt := range []struct {
+		method, target, token string
+		want                  int
+	}{
+		{"GET", "/api/users/1", "", http.StatusOK},
+		{"GET", "/api/auth/me", "", http.StatusUnauthorized},
+		{"GET", "/api/users/1", "garbage", http.StatusUnauthorized},
+		{"DELETE", "/api/users/3", "", http.StatusUnauthorized},
+		{"DELETE", "/api/users/3", "garbage", http.StatusUnauthorized},
+		{"DELETE", "/api/users/3", token, http.StatusOK},
+	} {
+		rec := send(tt.method, tt.target, tt.token, "")
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with token %q = %d, want %d", tt.method, tt.target, tt.token, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Errorf("%s %s: a 401 without a WWW-Authenticate: Bearer challenge", tt.method, tt.target)
+		}
+	}
+
+	fake.Advance(tokenTTL)
+	if rec := send("DELETE", "/api/users/4", token, ""); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "expired") {
+		t.Errorf("DELETE with an expired token = %d %s, want 401 saying it expired", rec.Code, rec.Body)
+	}
+}
+
+// TestGitHubLogin logs in through a fake GitHub, and changes users with the
+// session it gives
+func TestGitHubLogin(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+	cookie := func(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("no %s cookie in %v", name, rec.Header()["Set-Cookie"])
+		return nil
+	}
+
+	github = nil
+	if rec := send("GET", "/auth/github/login"); rec.Code != http.StatusNotFound {
+		t.Errorf("login without GitHub set up = %d, want 404", rec.Code)
+	}
+
+	// GitHub's side: it takes the code it gave out, with the PKCE verifier
+	// of the challenge it was sent, for a token that /user takes
+	var challenge string
+	gh := http.NewServeMux()
+	gh.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good" || oauth2.S256ChallengeFromVerifier(r.FormValue("code_verifier")) != challenge {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"error":"bad_verification_code"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"gho_test","token_type":"bearer","scope":"read:user"}`)
+	})
+	gh.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"id":583231,"login":"octocat","name":"The Octocat","email":"octocat@example.com"}`)
+	})
+	server := httptest.NewServer(gh)
+	defer server.Close()
+	github = newGitHubLogin(GitHubConfig{
+		ClientID: "golab", ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{AuthURL: server.URL + "/login/oauth/authorize", TokenURL: server.URL + "/login/oauth/access_token"},
+		APIURL:   server.URL,
+	})
+	t.Cleanup(func() { github = nil })
+
+	// login sends the browser to GitHub, and returns the state it went with
+	login := func() (string, *http.Cookie) {
+		t.Helper()
+		rec := send("GET", "/auth/github/login")
+		location, err := url.Parse(rec.Header().Get("Location"))
+		if rec.Code != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), server.URL+"/login/oauth/authorize") {
+			t.Fatalf("login = %d to %q, want a redirect to GitHub", rec.Code, rec.Header().Get("Location"))
+		}
+		q := location.Query()
+		if q.Get("client_id") != "golab" || q.Get("code_challenge_method") != "S256" || q.Get("state") == "" {
+			t.Errorf("GitHub is sent %v, want the client ID, a state and a PKCE challenge", q)
+		}
+		challenge = q.Get("code_challenge")
+		return q.Get("state"), cookie(rec, githubStateCookie)
+	}
+
+	state, stateCookie := login()
+	for _, tt := range []struct {
+		name, query string
+		cookies     []*http.Cookie
+		want        int
+	}{
+		{"refused", "?error=access_denied&state=" + state, []*http.Cookie{stateCookie}, http.StatusUnauthorized},
+		{"without the state cookie", "?code=good&state=" + state, nil, http.StatusBadRequest},
+		{"with another state", "?code=good&state=forged", []*http.Cookie{stateCookie}, http.StatusBadRequest},
+		{"with a bad code", "?code=bad&state=" + state, []*http.Cookie{stateCookie}, http.StatusBadGateway},
+		{"with the code again", "?code=good&state=" + state, []*http.Cookie{stateCookie}, http.StatusBadRequest},
+	} {
+		if rec := send("GET", "/auth/github/callback"+tt.query, tt.cookies...); rec.Code != tt.want {
+			t.Errorf("callback %s = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	fake.Advance(githubLoginTimeout)
+	state, stateCookie = login()
+	if _, ok := github.pending[state]; !ok || len(github.pending) != 1 {
+		t.Errorf("pending logins = %v, want only the new one: the old expired", github.pending)
+	}
+	callback := send("GET", "/auth/github/callback?code=good&state="+state, stateCookie)
+	if callback.Code != http.StatusSeeOther || callback.Header().Get("Location") != "/api/auth/me" {
+		t.Fatalf("callback = %d %s, want a redirect to /api/auth/me", callback.Code, callback.Body)
+	}
+	session := cookie(callback, SessionCookie)
+	if !session.HttpOnly || session.SameSite != http.SameSiteLaxMode {
+		t.Errorf("session cookie %v isn't HttpOnly and SameSite=Lax", session)
+	}
+
+	me := send("GET", "/api/auth/me", session)
+	var claims struct{ Data models.Claims }
+	if err := json.Unmarshal(me.Body.Bytes(), &claims); err != nil || claims.Data.Subject != "github:583231" ||
+		claims.Data.Name != "The Octocat" || claims.Data.Issuer != githubIssuer {
+		t.Errorf("/api/auth/me with the session = %d %s, want the Octocat's claims", me.Code, me.Body)
+	}
+	if rec := send("DELETE", "/api/users/3", session); rec.Code != http.StatusOK {
+		t.Errorf("DELETE with the session = %d %s, want 200", rec.Code, rec.Body)
+	}
+	forged := &http.Cookie{Name: SessionCookie, Value: "forged"}
+	if rec := send("DELETE", "/api/users/4", forged); rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE with a made-up session = %d, want 401", rec.Code)
+	}
+
+	if rec := send("POST", "/auth/github/logout", session); rec.Code != http.StatusOK || cookie(rec, SessionCookie).MaxAge >= 0 {
+		t.Errorf("logout = %d, %v; want 200, deleting the cookie", rec.Code, rec.Header()["Set-Cookie"])
+	}
+	if rec := send("DELETE", "/api/users/4", session); rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE after logging out = %d, want 401", rec.Code)
+	}
+
+	state, stateCookie = login()
+	session = cookie(send("GET", "/auth/github/callback?code=good&state="+state, stateCookie), SessionCookie)
+	fake.Advance(sessionTTL)
+	if rec := send("DELETE", "/api/users/4", session); rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE with an expired session = %d, want 401", rec.Code)
+	}
+}
+
+// TestAPIKeys issues keys of each role through the admin endpoint, checks
+// what each may do, and revokes one
+func TestAPIKeys(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	handler := NewServer().Handler
+	send := func(method, target, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	admin, err := BootstrapAdminKey(context.Background())
+	if err != nil || !strings.HasPrefix(admin, apiKeyPrefix) {
+		t.Fatalf("BootstrapAdminKey = %q, %v", admin, err)
+	}
+	if again, err := BootstrapAdminKey(context.Background()); again != "" || err != nil {
+		t.Errorf("bootstrapping again = %q, %v; want nothing, as there's an admin key", again, err)
+	}
+	issue := func(role models.Role) models.IssuedKey {
+		t.Helper()
+		rec := send("POST", "/api/admin/keys", admin, `{"name":"test","role":"`+string(role)+`"}`)
+		var resp struct{ Data models.IssuedKey }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusCreated || err != nil {
+			t.Fatalf("issuing a %s key = %d %s", role, rec.Code, rec.Body)
+		}
+		return resp.Data
+	}
+	reader, writer := issue(models.RoleReader), issue(models.RoleWriter)
+	if reader.ID == "" || reader.Key == writer.Key {
+		t.Errorf("issued %+v and %+v, want distinct keys with IDs", reader, writer)
+	}
+	if stored, err := db.GetKey(context.Background(), reader.ID); err != nil || stored.Hash != hashKey(reader.Key) {
+		t.Errorf("the store has %+v, %v; want the key's hash", stored, err)
+	}
+
+	for _, tt := range []struct {
+		method, target, key, body string
+		want                      int
+	}{
+		{"GET", "/api/users/1", "", "", http.StatusOK},
+		{"GET", "/api/users/1", reader.Key, "", http.StatusOK},
+		{"GET", "/api/users/1", "golab_nosuchkey", "", http.StatusUnauthorized},
+		{"DELETE", "/api/users/3", reader.Key, "", http.StatusForbidden},
+		{"DELETE", "/api/users/3", writer.Key, "", http.StatusOK},
+		{"DELETE", "/api/users/4", admin, "", http.StatusOK},
+		{"GET", "/api/admin/keys", "", "", http.StatusUnauthorized},
+		{"GET", "/api/admin/keys", writer.Key, "", http.StatusForbidden},
+		{"GET", "/api/admin/keys", admin, "", http.StatusOK},
+		{"GET", "/api/admin/export", reader.Key, "", http.StatusForbidden},
+		{"POST", "/api/admin/keys", admin, `{"name":"","role":"root"}`, http.StatusBadRequest},
+		{"GET", "/api/admin/keys/nosuchkey", admin, "", http.StatusNotFound},
+	} {
+		if rec := send(tt.method, tt.target, tt.key, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s with key %q = %d %s, want %d", tt.method, tt.target, tt.key, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	rec := send("GET", "/api/admin/keys", admin, "")
+	if strings.Contains(rec.Body.String(), writer.Key) || strings.Contains(rec.Body.String(), hashKey(writer.Key)) {
+		t.Errorf("listing keys sent a key or its hash: %s", rec.Body)
+	}
+	if rec := send("DELETE", "/api/admin/keys/"+writer.ID, admin, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "revoked_at") {
+		t.Errorf("revoking = %d %s, want 200 and the key, revoked", rec.Code, rec.Body)
+	}
+	if rec := send("DELETE", "/api/users/5", writer.Key, ""); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "revoked") {
+		t.Errorf("a revoked key = %d %s, want 401 saying it's revoked", rec.Code, rec.Body)
+	}
+}
+
+// TestPagination checks the query parameters of GET /api/users against a
+// list small enough to work out by hand
+func TestPagination(t *testing.T) {
+	at := demo.Clock
+	list := []domain.User{
+		{ID: 1, Name: "carol", Email: "carol@example.com", Age: 40, CreatedAt: at.Add(3 * time.Hour)},
+		{ID: 2, Name: "Alice", Email: "alice@EXAMPLE.org", Age: 30, CreatedAt: at.Add(2 * time.Hour)},
+		{ID: 3, Name: "bob", Email: "bob@example.com", Age: 30, CreatedAt: at.Add(time.Hour)},
+		{ID: 4, Name: "Dave", Email: "dave@example.org", Age: 20, CreatedAt: at},
+	}
+	ids := func(users []domain.User) []int {
+		ids := []int{}
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []int
+		meta  domain.PageMeta
+	}{
+		{"", []int{1, 2, 3, 4}, domain.PageMeta{Total: 4, Page: 1, Limit: defaultPageSize, Pages: 1}},
+		{"sort=name", []int{2, 3, 1, 4}, domain.PageMeta{Total: 4, Page: 1, Limit: defaultPageSize, Pages: 1}},
+		// Equal ages keep ID order, whichever way the sort goes
+		{"sort=age", []int{4, 2, 3, 1}, domain.PageMeta{Total: 4, Page: 1, Limit: defaultPageSize, Pages: 1}},
+		{"sort=-age", []int{1, 2, 3, 4}, domain.PageMeta{Total: 4, Page: 1, Limit: defaultPageSize, Pages: 1}},
+		{"sort=created_at&limit=3", []int{4, 3, 2},
+			domain.PageMeta{Total: 4, Page: 1, Limit: 3, Pages: 2, Next: "/api/users?limit=3&page=2&sort=created_at"}},
+		{"sort=created_at&limit=3&page=2", []int{1},
+			domain.PageMeta{Total: 4, Page: 2, Limit: 3, Pages: 2, Prev: "/api/users?limit=3&page=1&sort=created_at"}},
+		{"limit=1&page=2", []int{2},
+			domain.PageMeta{Total: 4, Page: 2, Limit: 1, Pages: 4, Next: "/api/users?limit=1&page=3", Prev: "/api/users?limit=1&page=1"}},
+		// Past the end is empty, and prev goes back to the last page
+		{"limit=3&page=9", []int{}, domain.PageMeta{Total: 4, Page: 9, Limit: 3, Pages: 2, Prev: "/api/users?limit=3&page=2"}},
+		{"min_age=30", []int{1, 2, 3}, domain.PageMeta{Total: 3, Page: 1, Limit: defaultPageSize, Pages: 1}},
+		{"email_contains=example.ORG", []int{2, 4}, domain.PageMeta{Total: 2, Page: 1, Limit: defaultPageSize, Pages: 1}},
+		{"email_contains=nobody", []int{}, domain.PageMeta{Total: 0, Page: 1, Limit: defaultPageSize, Pages: 0}},
+	} {
+		u, err := url.Parse("/api/users?" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := parseUserQuery(u.Query())
+		if err != nil {
+			t.Errorf("?%s: %v", tt.query, err)
+			continue
+		}
+		page, meta := q.paginate(q.filter(list), u)
+		if got := ids(page); !reflect.DeepEqual(got, tt.want) || meta != tt.meta {
+			t.Errorf("?%s = %v %+v, want %v %+v", tt.query, got, meta, tt.want, tt.meta)
+		}
+	}
+
+	for _, bad := range []string{"page=0", "page=x", "limit=0", "limit=101", "sort=email", "sort=--age", "min_age=-1", "min_age=old"} {
+		values, err := url.ParseQuery(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseUserQuery(values); err == nil {
+			t.Errorf("?%s was accepted", bad)
+		}
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	at := demo.Clock
+	// IDs 2 and 3 were created at the same moment, so ID breaks the tie
+	list := []domain.User{
+		{ID: 1, Name: "carol", Age: 40, CreatedAt: at.Add(3 * time.Hour)},
+		{ID: 2, Name: "Alice", Age: 30, CreatedAt: at.Add(time.Hour)},
+		{ID: 3, Name: "bob", Age: 30, CreatedAt: at.Add(time.Hour)},
+		{ID: 4, Name: "Dave", Age: 20, CreatedAt: at},
+		{ID: 5, Name: "Erin", Age: 50, CreatedAt: at.Add(4 * time.Hour)},
+	}
+	// fetch gets the page target asks for out of list
+	fetch := func(list []domain.User, target string) ([]int, domain.PageMeta) {
+		t.Helper()
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := parseUserQuery(u.Query())
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		page, meta := q.paginate(q.filter(list), u)
+		ids := []int{}
+		for _, user := range page {
+			ids = append(ids, user.ID)
+		}
+		return ids, meta
+	}
+
+	// Following next_cursor walks the list in (created_at, id) order
+	var walked []int
+	target := "/api/users?cursor=&limit=2"
+	for pages := 0; target != ""; pages++ {
+		if pages == 5 {
+			t.Fatalf("still paging at %s", target)
+		}
+		ids, meta := fetch(list, target)
+		if meta.Total != 5 || meta.Limit != 2 || meta.Pages != 3 || meta.Page != 0 || meta.Prev != "" {
+			t.Errorf("%s: meta = %+v", target, meta)
+		}
+		if (meta.Next == "") != (meta.NextCursor == "") || meta.Next != "" && !strings.Contains(meta.Next, "cursor="+meta.NextCursor) {
+			t.Errorf("%s: next %q doesn't match next_cursor %q", target, meta.Next, meta.NextCursor)
+		}
+		walked = append(walked, ids...)
+		target = meta.Next
+	}
+	if want := []int{4, 2, 3, 1, 5}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("walked %v, want %v", walked, want)
+	}
+
+	// Filters still apply, and the cursor keeps them
+	ids, meta := fetch(list, "/api/users?cursor=&limit=1&min_age=30")
+	if !reflect.DeepEqual(ids, []int{2}) || meta.Next != "/api/users?cursor="+meta.NextCursor+"&limit=1&min_age=30" {
+		t.Errorf("filtered = %v %+v", ids, meta)
+	}
+
+	// The difference: a user before the current page is deleted while a
+	// client is paging. The offsets all shift down one, so page 2 skips a
+	// user; the cursor still starts after the last user the client saw.
+	shrunk := slices.DeleteFunc(slices.Clone(list), func(user domain.User) bool { return user.ID == 4 })
+	firstByCursor, cursorMeta := fetch(list, "/api/users?cursor=&limit=2")
+	firstByPage, _ := fetch(list, "/api/users?limit=2&sort=created_at")
+	secondByCursor, _ := fetch(shrunk, cursorMeta.Next)
+	secondByPage, _ := fetch(shrunk, "/api/users?limit=2&page=2&sort=created_at")
+	if got := append(firstByCursor, secondByCursor...); !reflect.DeepEqual(got, []int{4, 2, 3, 1}) {
+		t.Errorf("by cursor = %v, want [4 2 3 1]", got)
+	}
+	if got := append(firstByPage, secondByPage...); !reflect.DeepEqual(got, []int{4, 2, 1, 5}) {
+		t.Errorf("by page = %v, want [4 2 1 5], skipping 3", got)
+	}
+
+	// A cursor past the end gives an empty last page
+	last := userCursor{createdAt: at.Add(5 * time.Hour), id: 1}
+	if ids, meta := fetch(list, "/api/users?cursor="+last.String()); len(ids) != 0 || meta.Next != "" {
+		t.Errorf("past the end = %v %+v", ids, meta)
+	}
+
+	// Cursors round-trip, and nothing else parses as one
+	c := userCursor{createdAt: at.Add(90 * time.Minute), id: 7}
+	if got, err := parseCursor(c.String()); err != nil || !got.createdAt.Equal(c.createdAt) || got.id != c.id {
+		t.Errorf("parseCursor(%q) = %+v, %v, want %+v", c.String(), got, err, c)
+	}
+	notBase64 := "not*base64"
+	noComma := base64.RawURLEncoding.EncodeToString([]byte("2024-01-01T00:00:00Z"))
+	badID := base64.RawURLEncoding.EncodeToString([]byte("2024-01-01T00:00:00Z,0"))
+	for _, bad := range []string{"cursor=" + notBase64, "cursor=" + noComma, "cursor=" + badID, "cursor=&page=2", "cursor=&sort=name"} {
+		values, err := url.ParseQuery(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseUserQuery(values); err == nil {
+			t.Errorf("?%s was accepted", bad)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	for _, tt := range []struct {
+		name, contentType, body string
+		want                    int
+		user                    domain.User // John Doe after, if the patch applied
+	}{
+		{"merge", mergePatchType, `{"name":"Johnny","age":26}`, http.StatusOK,
+			domain.User{Name: "Johnny", Email: "john@example.com", Age: 26}},
+		{"merge charset", mergePatchType + "; charset=utf-8", `{"email":"johnny@example.com"}`, http.StatusOK,
+			domain.User{Name: "Johnny", Email: "johnny@example.com", Age: 26}},
+		{"merge removes a required field", mergePatchType, `{"email":null}`, http.StatusBadRequest, domain.User{}},
+		{"merge read-only", mergePatchType, `{"id":7}`, http.StatusBadRequest, domain.User{}},
+		{"merge unknown field", mergePatchType, `{"password":"x"}`, http.StatusBadRequest, domain.User{}},
+		{"merge invalid result", mergePatchType, `{"age":200}`, http.StatusBadRequest, domain.User{}},
+		{"merge wrong type", mergePatchType, `{"age":"old"}`, http.StatusBadRequest, domain.User{}},
+		{"merge not an object", mergePatchType, `[1]`, http.StatusBadRequest, domain.User{}},
+
+		{"json patch", jsonPatchType,
+			`[{"op":"test","path":"/age","value":26},{"op":"replace","path":"/age","value":27},{"op":"copy","from":"/email","path":"/name"}]`,
+			http.StatusOK, domain.User{Name: "johnny@example.com", Email: "johnny@example.com", Age: 27}},
+		{"json patch add replaces", jsonPatchType, `[{"op":"add","path":"/name","value":"John"}]`, http.StatusOK,
+			domain.User{Name: "John", Email: "johnny@example.com", Age: 27}},
+		// A failed test, or any illegal operation, leaves the user as it was
+		{"json patch test fails", jsonPatchType,
+			`[{"op":"replace","path":"/name","value":"Jo"},{"op":"test","path":"/age","value":99}]`, http.StatusConflict, domain.User{}},
+		{"json patch remove required", jsonPatchType, `[{"op":"remove","path":"/email"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch move", jsonPatchType, `[{"op":"move","from":"/email","path":"/name"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch read-only", jsonPatchType, `[{"op":"replace","path":"/created_at","value":"2000-01-01T00:00:00Z"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch unknown op", jsonPatchType, `[{"op":"frobnicate","path":"/name"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch missing value", jsonPatchType, `[{"op":"replace","path":"/name"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch nested path", jsonPatchType, `[{"op":"add","path":"/name/first","value":"J"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch missing member", jsonPatchType, `[{"op":"remove","path":"/nickname"}]`, http.StatusBadRequest, domain.User{}},
+		{"json patch not a list", jsonPatchType, `{"op":"remove","path":"/name"}`, http.StatusBadRequest, domain.User{}},
+
+		{"plain json", "application/json", `{"age":30}`, http.StatusUnsupportedMediaType, domain.User{}},
+		{"no content type", "", `{"age":30}`, http.StatusUnsupportedMediaType, domain.User{}},
+	} {
+		r := ifMatchCurrent(t, newRequest(t, "PATCH", "/api/users/1", tt.body), 1)
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d; body %s", tt.name, rec.Code, tt.want, rec.Body)
+			continue
+		}
+		if tt.want == http.StatusUnsupportedMediaType && rec.Header().Get("Accept-Patch") != acceptPatch {
+			t.Errorf("%s: Accept-Patch = %q, want %q", tt.name, rec.Header().Get("Accept-Patch"), acceptPatch)
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		user, err := db.Get(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != 1 || user.Name != tt.user.Name || user.Email != tt.user.Email || user.Age != tt.user.Age {
+			t.Errorf("%s: user = %+v, want %+v", tt.name, user, tt.user)
+		}
+	}
+
+	r := newRequest(t, "PATCH", "/api/users/99", `{"age":30}`)
+	r.Header.Set("Content-Type", mergePatchType)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("patching a missing user = %d, want 404", rec.Code)
+	}
+	r = httptest.NewRequest("PATCH", "/api/users/1", strings.NewReader(`{"age":30}`))
+	r.Header.Set("Content-Type", mergePatchType)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("patching without a token = %d, want 401", rec.Code)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		accept string
+		want   int
+		format string // Content-Type of a 200
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"*/*", http.StatusOK, "application/json"},
+		{"application/xml", http.StatusOK, "application/xml"},
+		{"text/xml", http.StatusOK, "application/xml"},
+		{"application/x-yaml", http.StatusOK, "application/yaml"},
+		{"application/json;q=0.5, application/yaml", http.StatusOK, "application/yaml"},
+		// The most specific range decides, whatever order they're in
+		{"*/*;q=0.1, application/xml", http.StatusOK, "application/xml"},
+		{"application/*, application/json;q=0", http.StatusOK, "application/xml"},
+		{"text/*", http.StatusOK, "application/xml"},
+		{"text/csv", http.StatusNotAcceptable, ""},
+		{"application/json;q=0", http.StatusNotAcceptable, ""},
+	} {
+		rec := get("/api/users/1", tt.accept)
+		if rec.Code != tt.want || tt.want == http.StatusOK && rec.Header().Get("Content-Type") != tt.format {
+			t.Errorf("Accept: %s gets %d %s, want %d %s", tt.accept, rec.Code, rec.Header().Get("Content-Type"), tt.want, tt.format)
+		}
+		if rec.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept: %s: Vary = %q, want Accept", tt.accept, rec.Header().Get("Vary"))
+		}
+	}
+
+	// Each format decodes back to the same page of users
+	var asJSON struct {
+		Data []domain.User
+		Meta domain.PageMeta
+	}
+	if err := json.Unmarshal(get("/api/users?limit=3&page=2", "").Body.Bytes(), &asJSON); err != nil {
+		t.Fatal(err)
+	}
+	var asXML struct {
+		Data struct {
+			Users []domain.User `xml:"user"`
+		} `xml:"data"`
+		Meta domain.PageMeta `xml:"meta"`
+	}
+	if err := xml.Unmarshal(get("/api/users?limit=3&page=2", "application/xml").Body.Bytes(), &asXML); err != nil {
+		t.Fatal(err)
+	}
+	var asYAML struct {
+		Data []domain.User   `yaml:"data"`
+		Meta domain.PageMeta `yaml:"meta"`
+	}
+	if err := yaml.Unmarshal(get("/api/users?limit=3&page=2", "application/yaml").Body.Bytes(), &asYAML); err != nil {
+		t.Fatal(err)
+	}
+	if len(asJSON.Data) != 3 || asJSON.Meta.Next == "" {
+		t.Fatalf("JSON page = %+v", asJSON)
+	}
+	if !reflect.DeepEqual(asXML.Data.Users, asJSON.Data) || asXML.Meta != asJSON.Meta {
+		t.Errorf("XML page = %+v, want %+v", asXML, asJSON)
+	}
+	if !reflect.DeepEqual(asYAML.Data, asJSON.Data) || asYAML.Meta != asJSON.Meta {
+		t.Errorf("YAML page = %+v, want %+v", asYAML, asJSON)
+	}
+}
+
+// TestETags makes GETs conditional with If-None-Match, and changes
+// conditional with If-Match, including one that lost a race
+func TestETags(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	send := func(method, target, body string, header ...string) *httptest.ResponseRecorder {
+		r := newRequest(t, method, target, body)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	first := send("GET", "/api/users/1", "")
+	etag := first.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 3 {
+		t.Fatalf("ETag = %q, want a strong tag", etag)
+	}
+	if again := send("GET", "/api/users/1", "").Header().Get("ETag"); again != etag {
+		t.Errorf("the same user got ETags %s and %s", etag, again)
+	}
+	xmlTag := send("GET", "/api/users/1", "", "Accept", "application/xml").Header().Get("ETag")
+	if xmlTag == etag {
+		t.Errorf("XML and JSON share the ETag %s; each representation needs its own", etag)
+	}
+
+	for _, tt := range []struct {
+		ifNoneMatch, accept string
+		want                int
+	}{
+		{etag, "", http.StatusNotModified},
+		{"W/" + etag, "", http.StatusNotModified}, // If-None-Match compares weakly
+		{`"other", ` + etag, "", http.StatusNotModified},
+		{"*", "", http.StatusNotModified},
+		{`"other"`, "", http.StatusOK},
+		{etag, "application/xml", http.StatusOK},
+		{xmlTag, "application/xml", http.StatusNotModified},
+	} {
+		rec := send("GET", "/api/users/1", "", "If-None-Match", tt.ifNoneMatch, "Accept", tt.accept)
+		if rec.Code != tt.want {
+			t.Errorf("If-None-Match: %s, Accept: %s = %d, want %d", tt.ifNoneMatch, tt.accept, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") == "") {
+			t.Errorf("If-None-Match: %s: 304 with body %q and ETag %q, want no body and the tag", tt.ifNoneMatch, rec.Body, rec.Header().Get("ETag"))
+		}
+	}
+	list := send("GET", "/api/users?limit=2", "")
+	if rec := send("GET", "/api/users?limit=2", "", "If-None-Match", list.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("a current list = %d, want 304", rec.Code)
+	}
+
+	// Two clients fetched the user; the first change wins, and the second,
+	// still holding the old ETag, is refused instead of overwriting it
+	put := send("PUT", "/api/users/1", `{"age":26}`, "If-Match", xmlTag) // any representation's tag will do
+	if put.Code != http.StatusOK {
+		t.Fatalf("PUT with a current If-Match = %d %s", put.Code, put.Body)
+	}
+	newTag := put.Header().Get("ETag")
+	if got := send("GET", "/api/users/1", "").Header().Get("ETag"); newTag != got || newTag == etag {
+		t.Errorf("PUT sent ETag %s, GET then has %s, before it was %s", newTag, got, etag)
+	}
+	for _, tt := range []struct {
+		method, body, contentType, ifMatch string
+	}{
+		{"PUT", `{"age":99}`, "application/json", etag},
+		{"PATCH", `{"age":99}`, mergePatchType, etag},
+		{"DELETE", "", "", etag},
+		{"DELETE", "", "", "W/" + newTag}, // If-Match compares strongly
+	} {
+		rec := send(tt.method, "/api/users/1", tt.body, "If-Match", tt.ifMatch, "Content-Type", tt.contentType)
+		if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("ETag") != newTag {
+			t.Errorf("%s with If-Match: %s = %d, ETag %s; want 412 and the current %s", tt.method, tt.ifMatch, rec.Code, rec.Header().Get("ETag"), newTag)
+		}
+	}
+	if user, err := db.Get(context.Background(), 1); err != nil || user.Age != 26 {
+		t.Errorf("after the refused changes, user 1 = %+v, %v; want age 26", user, err)
+	}
+
+	// "*" only says the user exists; a PATCH has to say which version
+	if rec := send("PATCH", "/api/users/1", `{"age":27}`, "If-Match", "*", "Content-Type", mergePatchType); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("PATCH with If-Match: * = %d, want 428", rec.Code)
+	}
+	if rec := send("PATCH", "/api/users/1", `{"age":27}`, "If-Match", newTag, "Content-Type", mergePatchType); rec.Code != http.StatusOK {
+		t.Errorf("PATCH with a current If-Match = %d, want 200", rec.Code)
+	}
+	current := send("GET", "/api/users/1", "").Header().Get("ETag")
+	if rec := send("DELETE", "/api/users/1", "", "If-Match", current); rec.Code != http.StatusOK {
+		t.Errorf("DELETE with a current If-Match = %d, want 200", rec.Code)
+	}
+}
+
+// TestOptimisticLocking has clients read a user and change it at the same
+// time. Each says which version it read, so a change made to an old one is
+// refused, and no client's change is lost to another's.
+func TestOptimisticLocking(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	token := "Bearer " + testToken(t)
+	get := func() domain.User {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/users/1", nil))
+		var resp struct{ Data domain.User }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("GET = %d %s: %v", rec.Code, rec.Body, err)
+		}
+		return resp.Data
+	}
+	put := func(body string, version int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PUT", "/api/users/1", strings.NewReader(body))
+		r.Header.Set("Authorization", token)
+		r.Header.Set("If-Match", strconv.Itoa(version))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// Two clients read version 1. Without versions the second PUT would
+	// quietly undo the first; with them it's refused, and says why.
+	a, b := get(), get()
+	if rec := put(`{"name":"Ada"}`, a.Version); rec.Code != http.StatusOK {
+		t.Fatalf("the first PUT = %d %s", rec.Code, rec.Body)
+	}
+	rec := put(`{"email":"bob@example.com"}`, b.Version)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "at version 2, not 1") {
+		t.Errorf("a PUT to the old version = %d %s, want 409", rec.Code, rec.Body)
+	}
+	if user := get(); user.Name != "Ada" || user.Email != a.Email || user.Version != 2 {
+		t.Errorf("after the refused PUT, user 1 = %+v; want the first change, at version 2", user)
+	}
+
+	// Many clients each add one to the age, all reading it before any
+	// writes, and reading it again whenever they lose: every increment
+	// lands, however they interleave
+	const clients = 20
+	start := get()
+	var wg, read sync.WaitGroup
+	var conflicts atomic.Int64
+	read.Add(clients)
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for first := true; ; first = false {
+				user := get()
+				if first {
+					read.Done()
+					read.Wait()
+				}
+				rec := put(fmt.Sprintf(`{"age":%d}`, user.Age+1), user.Version)
+				if rec.Code != http.StatusConflict {
+					if rec.Code != http.StatusOK {
+						t.Errorf("PUT = %d %s", rec.Code, rec.Body)
+					}
+					return
+				}
+				conflicts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if user := get(); user.Age != start.Age+clients || user.Version != start.Version+clients {
+		t.Errorf("after %d increments, user 1 has age %d and version %d; want %d and %d",
+			clients, user.Age, user.Version, start.Age+clients, start.Version+clients)
+	}
+	if conflicts.Load() < clients-1 {
+		t.Errorf("%d conflicts; all but one of the first writes should have been refused", conflicts.Load())
+	}
+}
+
+// TestRoutes checks what the method and path patterns decide before any
+// handler runs: the API's own 405 with an Allow header, HEAD through GET,
+// a literal path over {id}, and no match for a path with more after it
+func TestRoutes(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	for _, tc := range []struct {
+		method, target string
+		status         int
+		allow, body    string
+	}{
+		{"DELETE", "/api/users", http.StatusMethodNotAllowed, "GET, POST, HEAD", `{"error":"Method not allowed"}`},
+		{"POST", "/api/v2/users/1", http.StatusMethodNotAllowed, "GET, PUT, PATCH, DELETE, HEAD", `{"error":"Method not allowed"}`},
+		{"PUT", "/api/v2/health", http.StatusMethodNotAllowed, "GET, HEAD", `{"error":"Method not allowed"}`},
+		{"GET", "/api/auth/login", http.StatusMethodNotAllowed, "POST", `{"error":"Method not allowed"}`},
+		{"DELETE", "/api/users/suggest", http.StatusMethodNotAllowed, "GET, HEAD", `{"error":"Method not allowed"}`},
+		{"HEAD", "/api/users/1", http.StatusOK, "", ""},
+		{"GET", "/api/users/abc", http.StatusBadRequest, "", `{"error":"Invalid user ID"}`},
+		{"GET", "/api/users/1/extra", http.StatusNotFound, "", "404 page not found"},
+		{"GET", "/api/problems/not-found", http.StatusOK, "", `"title":"Not found"`},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.status || rec.Header().Get("Allow") != tc.allow || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Errorf("%s %s = %d, Allow %q, %s\nwant %d, Allow %q, %s", tc.method, tc.target,
+				rec.Code, rec.Header().Get("Allow"), rec.Body, tc.status, tc.allow, tc.body)
+		}
+	}
+
+	// The problem for a 405 too, for clients that ask
+	req := httptest.NewRequest("PATCH", "/api/users", nil)
+	req.Header.Set("Accept", problemContentType)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("PATCH /api/users asking for a problem = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+// TestOpenAPI compares the generated document with testdata/openapi.golden,
+// checks every $ref in it resolves, and sends the smoke test's requests to
+// check each response is documented and matches its schema
+func TestVersions(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder) map[string]any {
+		t.Helper()
+		var resp struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%v: %s", err, rec.Body)
+		}
+		return resp.Data
+	}
+
+	// v1 is the API as it was, at both paths
+	old := do(httptest.NewRequest("GET", "/api/users/1", nil))
+	v1Rec := do(httptest.NewRequest("GET", "/api/v1/users/1", nil))
+	if v1Rec.Code != http.StatusOK || v1Rec.Body.String() != old.Body.String() {
+		t.Errorf("GET /api/v1/users/1 = %d %s, want %s", v1Rec.Code, v1Rec.Body, old.Body)
+	}
+	v2User := decode(do(httptest.NewRequest("GET", "/api/v2/users/1", nil)))
+	if v2User["first_name"] != "John" || v2User["last_name"] != "Doe" || v2User["name"] != nil {
+		t.Errorf("v2 user 1 = %v, want first_name John, last_name Doe and no name", v2User)
+	}
+
+	// v2 writes its own fields, and v1 reads the result
+	rec := do(newRequest(t, "POST", "/api/v2/users", `{"first_name":"Alice","last_name":"Smith","email":"alice@example.com","age":30}`))
+	if rec.Code != http.StatusCreated || decode(rec)["first_name"] != "Alice" {
+		t.Fatalf("v2 create = %d %s", rec.Code, rec.Body)
+	}
+	id := int(decode(rec)["id"].(float64))
+	path := "/api/v2/users/" + strconv.Itoa(id)
+	for _, tt := range []struct {
+		method, contentType, body string
+		want                      int
+		name                      string // in the store after
+	}{
+		{"PUT", "application/json", `{"last_name":"Jones"}`, http.StatusOK, "Alice Jones"},
+		{"PATCH", mergePatchType, `{"first_name":"Alicia"}`, http.StatusOK, "Alicia Jones"},
+		{"PATCH", jsonPatchType, `[{"op":"replace","path":"/last_name","value":"Brown"}]`, http.StatusOK, "Alicia Brown"},
+		{"PATCH", mergePatchType, `{"first_name":null}`, http.StatusBadRequest, "Alicia Brown"},
+		{"PATCH", mergePatchType, `{"name":"Al"}`, http.StatusBadRequest, "Alicia Brown"}, // v1's field
+	} {
+		r := ifMatchCurrent(t, newRequest(t, tt.method, path, tt.body), id)
+		r.Header.Set("Content-Type", tt.contentType)
+		if rec := do(r); rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d; body %s", tt.method, tt.body, rec.Code, tt.want, rec.Body)
+		}
+		if user, err := db.Get(context.Background(), id); err != nil || user.Name != tt.name {
+			t.Errorf("%s %s: name = %q, %v, want %q", tt.method, tt.body, user.Name, err, tt.name)
+		}
+	}
+	if got := decode(do(httptest.NewRequest("GET", "/api/v1/users/"+strconv.Itoa(id), nil)))["name"]; got != "Alicia Brown" {
+		t.Errorf("v1 name = %v, want Alicia Brown", got)
+	}
+
+	// v2's validation errors name v2's fields
+	rec = do(newRequest(t, "POST", "/api/v2/users", `{"email":"bob@example.com","age":30}`))
+	var errResp domain.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || rec.Code != http.StatusBadRequest ||
+		len(errResp.Details) != 1 || errResp.Details[0].Field != "first_name" {
+		t.Errorf("v2 create without first_name = %d %s", rec.Code, rec.Body)
+	}
+
+	// Each version tags its own bytes, so a v1 ETag doesn't match in v2
+	etag := do(httptest.NewRequest("GET", "/api/v1/users/1", nil)).Header().Get("ETag")
+	r := newRequest(t, "PUT", "/api/v2/users/1", `{"age":26}`)
+	r.Header.Set("If-Match", etag)
+	if rec := do(r); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("v2 PUT with v1's ETag = %d, want 412", rec.Code)
+	}
+
+	// Lists and suggestions come in the version's shape too
+	for _, target := range []string{"/api/v2/users?limit=2", "/api/v2/users/suggest?prefix=john"} {
+		var resp struct {
+			Data []map[string]any `json:"data"`
+		}
+		rec := do(httptest.NewRequest("GET", target, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Data) == 0 || resp.Data[0]["first_name"] == nil {
+			t.Errorf("GET %s = %d %s", target, rec.Code, rec.Body)
+		}
+	}
+
+	// Everything else is the same in every version
+	for _, target := range []string{"/api/health", "/api/v1/health", "/api/v2/health", "/api/v2/problems/not-found"} {
+		if rec := do(httptest.NewRequest("GET", target, nil)); rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", target, rec.Code)
+		}
+	}
+	if rec := do(httptest.NewRequest("GET", "/api/v3/users", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /api/v3/users = %d, want 404", rec.Code)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	bulk := func(method, target, body string) (int, domain.APIResponse, []models.BulkResult) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, method, target, body))
+		var resp struct {
+			domain.APIResponse
+			Data []models.BulkResult `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, target, err, rec.Body)
+		}
+		return rec.Code, resp.APIResponse, resp.Data
+	}
+
+	code, resp, results := bulk("POST", "/api/v1/users/bulk",
+		`[{"name":"Ann","email":"ann@example.com","age":30}, {"name":"","email":"bad","age":30}, "not a user", {"name":"Ben","email":"ben@example.com","age":40}]`)
+	if code != http.StatusMultiStatus || resp.Success || resp.Message != "Created 2 of 4 users" {
+		t.Errorf("bulk create = %d %+v", code, resp)
+	}
+	want := []models.BulkResult{
+		{Index: 0, Status: http.StatusCreated, ID: 11},
+		{Index: 1, Status: http.StatusBadRequest, Error: "Validation failed"},
+		{Index: 2, Status: http.StatusBadRequest, Error: "Expected a JSON object"},
+		{Index: 3, Status: http.StatusCreated, ID: 12},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("bulk create results = %+v", results)
+	}
+	for i, result := range results {
+		if result.Index != want[i].Index || result.Status != want[i].Status || result.ID != want[i].ID || result.Error != want[i].Error {
+			t.Errorf("result %d = %+v, want %+v", i, result, want[i])
+		}
+	}
+	if fields := results[1].Details; len(fields) != 2 || fields[0].Field != "name" || fields[1].Field != "email" {
+		t.Errorf("validation details = %+v", fields)
+	}
+	if countUsers(t) != 12 {
+		t.Errorf("users after bulk create = %d, want 12", countUsers(t))
+	}
+	if got := suggestions.For(context.Background()).Lookup("ben", 10); len(got) != 1 || got[0] != 12 {
+		t.Errorf("suggestions for ben = %v, want [12]", got)
+	}
+
+	// v2 takes its own shape
+	_, _, results = bulk("POST", "/api/v2/users/bulk", `[{"first_name":"Cy","last_name":"Young","email":"cy@example.com","age":50}]`)
+	if len(results) != 1 || results[0].Status != http.StatusCreated || results[0].Data.(map[string]any)["last_name"] != "Young" {
+		t.Errorf("v2 bulk create = %+v", results)
+	}
+
+	code, resp, results = bulk("DELETE", "/api/v1/users/bulk", `[11, 99, 11, "x"]`)
+	if code != http.StatusMultiStatus || resp.Message != "Deleted 1 of 4 users" {
+		t.Errorf("bulk delete = %d %+v", code, resp)
+	}
+	statuses := make([]int, len(results))
+	for i, result := range results {
+		statuses[i] = result.Status
+	}
+	if !reflect.DeepEqual(statuses, []int{http.StatusOK, http.StatusNotFound, http.StatusNotFound, http.StatusBadRequest}) {
+		t.Errorf("bulk delete statuses = %v", statuses)
+	}
+	if _, err := db.Get(context.Background(), 11); !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("user 11 after bulk delete: %v", err)
+	}
+
+	// A body that isn't a list of the right size fails as a whole
+	for _, body := range []string{`{"name":"Ann"}`, `[]`, "[" + strings.Repeat("1,", maxBulkItems) + "1]"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, "POST", "/api/users/bulk", body))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("bulk create %.20s = %d, want 400", body, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/users/bulk", strings.NewReader("[1]")))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("bulk delete without a token = %d, want 401", rec.Code)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	tests := []struct {
+		name, method, target, body string
+		status                     int
+		error                      string
+		details                    []domain.ValidationError
+	}{
+		{"unknown field", "POST", "/api/v1/users", `{"name":"Ann","email":"ann@example.com","age":30,"nickname":"A"}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "nickname", Message: "Unknown field"}}},
+		{"v2 field in v1", "POST", "/api/v1/users", `{"first_name":"Ann","email":"ann@example.com","age":30}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "first_name", Message: "Unknown field"}}},
+		{"wrong type", "POST", "/api/v1/users", `{"name":"Ann","email":"ann@example.com","age":"30"}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "age", Message: "Must be a number"}}},
+		{"wrong type in an update", "PUT", "/api/v2/users/1", `{"first_name":42}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "first_name", Message: "Must be a string"}}},
+		{"not an object", "POST", "/api/v1/users", `["Ann"]`, http.StatusBadRequest, "Expected a JSON object", nil},
+		{"syntax error", "POST", "/api/v1/users", `{"name":"Ann",}`,
+			http.StatusBadRequest, "Invalid JSON at byte 15: invalid character '}' looking for beginning of object key string", nil},
+		{"cut short", "POST", "/api/v1/users", `{"name":"Ann"`, http.StatusBadRequest, "Invalid JSON: the body ends in the middle of a value", nil},
+		{"empty", "POST", "/api/v1/users", ``, http.StatusBadRequest, "The request body is empty", nil},
+		{"two values", "POST", "/api/v1/users", `{"name":"Ann","email":"ann@example.com","age":30} {}`,
+			http.StatusBadRequest, "Invalid JSON: the body has more after its JSON value", nil},
+		{"too large", "POST", "/api/v1/users", `{"name":"` + strings.Repeat("a", maxBodySize) + `"}`,
+			http.StatusRequestEntityTooLarge, "Request body is larger than 1 MB", nil},
+		{"login", "POST", "/api/auth/login", `{"email":"john@example.com","password":"password123","remember":true}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "remember", Message: "Unknown field"}}},
+		{"invitation", "POST", "/api/invitations", `{"email":"ann@example.com","ttl":3600}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "ttl", Message: "Must be a string"}}},
+		{"API key", "POST", "/api/admin/keys", `{"name":"ci","role":"reader","expires":"never"}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "expires", Message: "Unknown field"}}},
+		{"bulk", "POST", "/api/v1/users/bulk", `{"name":"Ann"}`, http.StatusBadRequest, "Expected a JSON list", nil},
+		{"import", "POST", "/api/admin/import", `{"version":1,"users":[],"checksum":"abc"}`,
+			http.StatusBadRequest, "Validation failed", []domain.ValidationError{{Field: "checksum", Message: "Unknown field"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, newRequest(t, tt.method, tt.target, tt.body))
+			var resp domain.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%v: %s", err, rec.Body)
+			}
+			if rec.Code != tt.status || resp.Error != tt.error || !reflect.DeepEqual(resp.Details, tt.details) {
+				t.Errorf("%s %s = %d %+v, want %d %q %+v", tt.method, tt.target, rec.Code, resp, tt.status, tt.error, tt.details)
+			}
+		})
+	}
+
+	// A bulk item gets the same explanation in its result
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, newRequest(t, "POST", "/api/v1/users/bulk", `[{"name":"Ann","email":"ann@example.com","age":30,"role":"admin"}]`))
+	var resp struct {
+		Data []models.BulkResult `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 {
+		t.Fatalf("bulk = %d %s", rec.Code, rec.Body)
+	}
+	if result := resp.Data[0]; result.Status != http.StatusBadRequest || result.Error != "Validation failed" ||
+		!reflect.DeepEqual(result.Details, []domain.ValidationError{{Field: "role", Message: "Unknown field"}}) {
+		t.Errorf("bulk result = %+v", result)
+	}
+}
+
+func TestUserTransfer(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	export := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+		}
+		return rec
+	}
+	upload := func(target, contentType, body string) (int, domain.APIResponse, models.ImportReport) {
+		t.Helper()
+		r := newRequest(t, "POST", target, body)
+		r.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		var resp struct {
+			domain.APIResponse
+			Data models.ImportReport `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("POST %s: %v: %s", target, err, rec.Body)
+		}
+		return rec.Code, resp.APIResponse, resp.Data
+	}
+
+	// CSV has a header, then a row per user in ID order
+	rec := export("/api/v1/users/export")
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("CSV Content-Type = %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 11 || lines[0] != "id,name,email,age,created_at,updated_at" ||
+		lines[1] != "1,John Doe,john@example.com,25,2024-01-01T09:00:00Z,2024-01-01T09:00:00Z" {
+		t.Errorf("CSV export = %d lines, starting %q", len(lines), lines[:min(len(lines), 2)])
+	}
+
+	// NDJSON is a user per line, as the version sends them
+	rec = export("/api/v2/users/export?format=ndjson")
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson; charset=utf-8" {
+		t.Errorf("NDJSON Content-Type = %q", got)
+	}
+	dec := json.NewDecoder(rec.Body)
+	var exported []models.UserV2
+	for dec.More() {
+		var user models.UserV2
+		if err := dec.Decode(&user); err != nil {
+			t.Fatal(err)
+		}
+		exported = append(exported, user)
+	}
+	if len(exported) != 10 || exported[0].FirstName != "John" || exported[0].LastName != "Doe" {
+		t.Errorf("NDJSON export = %+v", exported)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/export?format=xlsx", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("format=xlsx = %d", rec.Code)
+	}
+
+	// An export imports back into its version, as new users
+	csvExport := export("/api/v2/users/export").Body.String()
+	code, resp, report := upload("/api/v2/users/import", "text/csv", csvExport)
+	if code != http.StatusOK || !resp.Success || resp.Message != "Imported 10 of 10 rows" || report.Imported != 10 || len(report.Failed) != 0 {
+		t.Errorf("CSV round trip = %d %+v %+v", code, resp, report)
+	}
+	if user, err := db.Get(context.Background(), 11); err != nil || user.Name != "John Doe" || user.Email != "john@example.com" {
+		t.Errorf("user 11 = %+v, %v; want John Doe again", user, err)
+	}
+	code, resp, report = upload("/api/v2/users/import", "application/x-ndjson", export("/api/v2/users/export?format=ndjson").Body.String())
+	if code != http.StatusOK || !resp.Success || report.Rows != 20 || report.Imported != 20 {
+		t.Errorf("NDJSON round trip = %d %+v %+v", code, resp, report)
+	}
+	if n := countUsers(t); n != 40 {
+		t.Errorf("%d users after importing, want 40", n)
+	}
+
+	// Bad rows are reported by line and skipped; the rest go in
+	ndjson := strings.Join([]string{
+		`{"name":"Ann","email":"ann@example.com","age":30}`,
+		`{"name":"","email":"bob","age":30}`,
+		``,
+		`{"name":"Cat","email":"cat@example.com","age":30,"nickname":"C"}`,
+		`{"name":"Dan",`,
+		`["Eve"]`,
+		`{"name":"Fay","email":"fay@example.com","age":"thirty"}`,
+		`{"id":99,"name":"Gus","email":"gus@example.com","age":40,"created_at":"2020-01-01T00:00:00Z"}`,
+	}, "\n")
+	code, resp, report = upload("/api/v1/users/import", "application/x-ndjson", ndjson)
+	if code != http.StatusOK || resp.Success || resp.Message != "Imported 2 of 7 rows" {
+		t.Errorf("NDJSON with bad rows = %d %+v", code, resp)
+	}
+	want := []models.ImportRowError{
+		{Line: 2, Error: "Validation failed", Details: []domain.ValidationError{{Field: "name", Message: "Name is required"}, {Field: "email", Message: "Invalid email format"}}},
+		{Line: 4, Error: "Validation failed", Details: []domain.ValidationError{{Field: "nickname", Message: "Unknown field"}}},
+		{Line: 5, Error: "Invalid JSON: the body ends in the middle of a value"},
+		{Line: 6, Error: "Expected a JSON object"},
+		{Line: 7, Error: "Validation failed", Details: []domain.ValidationError{{Field: "age", Message: "Must be a number"}}},
+	}
+	if !reflect.DeepEqual(report.Failed, want) {
+		t.Errorf("failed rows = %+v, want %+v", report.Failed, want)
+	}
+	if user, err := db.Get(context.Background(), 42); err != nil || user.Name != "Gus" || !user.CreatedAt.Equal(demo.Clock) {
+		t.Errorf("user 42 = %+v, %v; want Gus, with a new ID and created_at", user, err)
+	}
+
+	csvFile := "email,age,name\nhal@example.com,50,Hal\nivy@example.com,old,Ivy\njo@example.com,20\n"
+	code, resp, report = upload("/api/v1/users/import", "text/csv; charset=utf-8", csvFile)
+	want = []models.ImportRowError{
+		{Line: 3, Error: "Validation failed", Details: []domain.ValidationError{{Field: "age", Message: "Must be a number"}}},
+		{Line: 4, Error: "The row has 2 fields, but the header has 3"},
+	}
+	if code != http.StatusOK || resp.Message != "Imported 1 of 3 rows" || !reflect.DeepEqual(report.Failed, want) {
+		t.Errorf("CSV with bad rows = %d %+v %+v", code, resp, report)
+	}
+
+	// A problem with the file as a whole stops it: before any row for a
+	// bad header, or where it is, keeping the rows before
+	for _, tt := range []struct {
+		name, contentType, body string
+		status                  int
+		error                   string
+		imported                int
+	}{
+		{"unknown column", "text/csv", "name,email,age,role\n", http.StatusBadRequest,
+			`Invalid CSV: v1 users have no column "role"; they have id, name, email, age, created_at, updated_at`, 0},
+		{"empty CSV", "text/csv", "", http.StatusBadRequest, "Invalid CSV: the file is empty; its first row must name the columns", 0},
+		{"too large", "text/csv", "name,email,age\nKim,kim@example.com,30\n\"" + strings.Repeat("a", maxImportSize), http.StatusRequestEntityTooLarge,
+			"Stopped at line 3: the file is larger than 10 MB; the 1 rows imported before it stay", 1},
+		{"line too long", "application/x-ndjson", `{"name":"Lee","email":"lee@example.com","age":30}` + "\n" + strings.Repeat(" ", 1<<16), http.StatusBadRequest,
+			"Stopped at line 2: the line is longer than 64 KB; the 1 rows imported before it stay", 1},
+		{"JSON", "application/json", `[]`, http.StatusUnsupportedMediaType, "Import takes text/csv or application/x-ndjson", 0},
+	} {
+		code, resp, report := upload("/api/v1/users/import", tt.contentType, tt.body)
+		if code != tt.status || resp.Error != tt.error || report.Imported != tt.imported {
+			t.Errorf("%s = %d %+v %+v, want %d %q", tt.name, code, resp, report, tt.status, tt.error)
+		}
+	}
+
+	// Importing needs a writer, like creating
+	r := httptest.NewRequest("POST", "/api/v1/users/import", strings.NewReader("name,email,age\n"))
+	r.Header.Set("Content-Type", "text/csv")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("import without a token = %d", rec.Code)
+	}
+}
+
+// disconnectingRecorder is a client that goes away after the first flush
+type disconnectingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (rec disconnectingRecorder) Flush() {
+	rec.ResponseRecorder.Flush()
+	rec.cancel()
+}
+
+func TestUserStream(t *testing.T) {
+	fake := useFakeClock(t)
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	// Every user, one a line, as the version sends them
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v2/users/stream?count=250", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson; charset=utf-8" {
+		t.Fatalf("GET stream = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	dec := json.NewDecoder(rec.Body)
+	var streamed []models.UserV2
+	for dec.More() {
+		var user models.UserV2
+		if err := dec.Decode(&user); err != nil {
+			t.Fatal(err)
+		}
+		streamed = append(streamed, user)
+	}
+	if len(streamed) != 250 || streamed[0].FirstName != "John" || streamed[249].ID != 250 {
+		t.Errorf("streamed %d users, starting %+v", len(streamed), streamed[:min(len(streamed), 1)])
+	}
+	if !rec.Flushed {
+		t.Error("the stream was never flushed")
+	}
+
+	for _, target := range []string{"?count=-1", "?count=1000001", "?count=lots", "?delay=2s", "?delay=soon"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/stream"+target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET stream%s = %d, want 400", target, rec.Code)
+		}
+	}
+
+	// A client that goes away stops the stream at the next user, instead
+	// of the server making the rest for nobody
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := disconnectingRecorder{httptest.NewRecorder(), cancel}
+	mux.ServeHTTP(gone, httptest.NewRequest("GET", "/api/v1/users/stream?count=1000000", nil).WithContext(ctx))
+	if lines := strings.Count(gone.Body.String(), "\n"); lines != streamFlushEvery {
+		t.Errorf("a client gone after the first flush got %d users, want %d", lines, streamFlushEvery)
+	}
+	if !strings.Contains(logged.String(), "Stopped streaming users after 100 of 1000000") {
+		t.Errorf("log = %q", logged.String())
+	}
+
+	// With a delay, each user is flushed before the pause
+	done := make(chan struct{})
+	rec = httptest.NewRecorder()
+	go func() {
+		defer close(done)
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/stream?count=3&delay=1s", nil))
+	}()
+	for range 3 {
+		fake.BlockUntil(1)
+		fake.Advance(time.Second)
+	}
+	<-done
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 3 {
+		t.Errorf("a delayed stream sent %d users, want 3", lines)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	users := []domain.User{
+		{ID: 1, Name: "John Doe", Email: "john@example.com", Age: 25},
+		{ID: 2, Name: "Jane Smith", Email: "jane@example.org", Age: 30},
+		{ID: 3, Name: "Mary Ann Smith", Email: "mary@example.com", Age: 41},
+	}
+	for _, tt := range []struct {
+		q    string
+		want []int // the IDs that match
+	}{
+		{"john", []int{1}},
+		{"EXAMPLE.COM", []int{1, 3}},
+		{"name:smith", []int{2, 3}},
+		{"last_name=smith", []int{2}}, // Mary's last name is Ann Smith
+		{`name="mary ann smith"`, []int{3}},
+		{`last_name="Ann Smith"`, []int{3}},
+		{"name~^j.*e$", []int{1}},
+		{"email:@example.com age>25", []int{3}},
+		{"age>=30 age<=40", []int{2}},
+		{"age:25", []int{1}},
+		{"id!=2", []int{1, 3}},
+		{"-email:example.org", []int{1, 3}},
+		{"-name~smith$ -john", nil},
+		{`"john doe"`, []int{1}},
+		{`"a:b"`, nil}, // quoted, so free text, not a field
+	} {
+		query, err := parseSearch(tt.q)
+		if err != nil {
+			t.Errorf("parseSearch(%q): %v", tt.q, err)
+			continue
+		}
+		var got []int
+		for _, user := range users {
+			if query.match(user) {
+				got = append(got, user.ID)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q matched %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	search := func(version, q string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/"+version+"/users/search?q="+url.QueryEscape(q), nil))
+		return rec
+	}
+
+	// Parse errors are 400s naming the term
+	for _, tt := range []struct{ q, want string }{
+		{"", "q is required"},
+		{"   ", "q is required"},
+		{"password:x", "password:x: no field password; search age, email, first_name, id, last_name, name"},
+		{"age>old", "age>old: age is a number, and old isn't"},
+		{"age~2", "age~2: age is a number"},
+		{"name>b", "name>b: name is text"},
+		{"name:", "name:: missing a value after :"},
+		{":john", ":john: missing a field before :"},
+		{"name~(", "name~(: bad pattern"},
+		{`name="john`, `name="john: unterminated quote`},
+	} {
+		rec := search("v1", tt.q)
+		var resp domain.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusBadRequest ||
+			!strings.HasPrefix(resp.Error, tt.want) {
+			t.Errorf("search %q = %d %s, want 400 %q", tt.q, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	// Results are the users that match, paged like GET /api/users
+	all, err := db.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for _, user := range all {
+		if user.Age > 30 && strings.HasSuffix(user.Email, "@example.com") {
+			want++
+		}
+	}
+	rec := search("v1", "age>30 email:@example.com")
+	var resp struct {
+		Data []domain.User   `json:"data"`
+		Meta domain.PageMeta `json:"meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || resp.Meta.Total != want || len(resp.Data) != want {
+		t.Fatalf("search = %d %s, want %d users", rec.Code, rec.Body, want)
+	}
+	for _, user := range resp.Data {
+		if user.Age <= 30 {
+			t.Errorf("search for age>30 found %+v", user)
+		}
+	}
+	rec = search("v2", `name="John Doe"`)
+	if !strings.Contains(rec.Body.String(), `"first_name":"John"`) || !strings.Contains(rec.Body.String(), `"total":1`) {
+		t.Errorf("v2 search = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	get := func(target string, out any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+		}
+	}
+	// hrefPath is the path of an absolute link on the test server
+	hrefPath := func(link domain.Link) string {
+		t.Helper()
+		path, ok := strings.CutPrefix(link.Href, "http://example.com")
+		if !ok {
+			t.Fatalf("link %+v isn't on http://example.com", link)
+		}
+		return path
+	}
+
+	// A user links to itself, and to what can be done to it, in its version
+	var user struct {
+		Data models.LinkedUserV2 `json:"data"`
+	}
+	get("/api/v2/users/1", &user)
+	want := domain.Links{
+		"self":       {Href: "http://example.com/api/v2/users/1", Method: "GET"},
+		"update":     {Href: "http://example.com/api/v2/users/1", Method: "PUT"},
+		"delete":     {Href: "http://example.com/api/v2/users/1", Method: "DELETE"},
+		"collection": {Href: "http://example.com/api/v2/users", Method: "GET"},
+	}
+	if !reflect.DeepEqual(user.Data.Links, want) || user.Data.FirstName != "John" {
+		t.Errorf("v2 user 1 = %+v, want links %v", user.Data, want)
+	}
+
+	// Following update does what it says, to the version the GET had
+	update := user.Data.Links["update"]
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, newRequest(t, update.Method, hrefPath(update), fmt.Sprintf(`{"age":26,"version":%d}`, user.Data.Version)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("following update = %d %s", rec.Code, rec.Body)
+	}
+
+	// Following next from the collection visits every user once
+	type page struct {
+		Data  []models.LinkedUser `json:"data"`
+		Links domain.Links        `json:"_links"`
+	}
+	var p page
+	get(hrefPath(user.Data.Links["collection"])+"?limit=3", &p)
+	if p.Links["create"].Method != "POST" || p.Links["self"].Href != "http://example.com/api/v2/users?limit=3" {
+		t.Errorf("page links = %v", p.Links)
+	}
+	seen := 0
+	for pages := 1; ; pages++ {
+		for _, u := range p.Data {
+			if u.Links["self"].Href != "http://example.com/api/v2/users/"+strconv.Itoa(u.ID) {
+				t.Errorf("user %d links to %v", u.ID, u.Links["self"])
+			}
+		}
+		seen += len(p.Data)
+		next, ok := p.Links["next"]
+		if !ok {
+			break
+		}
+		if pages > 10 {
+			t.Fatal("next never runs out")
+		}
+		p = page{}
+		get(hrefPath(next), &p)
+		if _, ok := p.Links["prev"]; !ok {
+			t.Errorf("page %d has no prev link", pages+1)
+		}
+	}
+	if seen != countUsers(t) {
+		t.Errorf("following next saw %d users, want %d", seen, countUsers(t))
+	}
+
+	// Links follow the scheme and host the request came in on
+	r := httptest.NewRequest("GET", "/api/users/1", nil)
+	r.Host = "api.example.org"
+	r.TLS = &tls.ConnectionState{}
+	if got := absoluteURL(r, "/api/v1/users/1"); got != "https://api.example.org/api/v1/users/1" {
+		t.Errorf("absoluteURL = %q", got)
+	}
+
+	// Links aren't part of the user, so they can't be patched
+	r = ifMatchCurrent(t, newRequest(t, "PATCH", "/api/v1/users/1", `{"_links":{}}`), 1)
+	r.Header.Set("Content-Type", mergePatchType)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("patching _links = %d, want 400", rec.Code)
+	}
+}
+
+// TestEvents streams from two subscribers at once, through the real
+// middleware so flushing has to get past it, and checks that each sees
+// every change in its own version, that a gone client is unsubscribed,
+// and that shutting down ends the streams
+func TestEvents(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	srv := httptest.NewServer(NewServer().Handler)
+	t.Cleanup(srv.Close) // after the streams' bodies are closed, or it waits for them
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	// subscribe opens a stream and reads up to the end of its preamble,
+	// by which time it's subscribed
+	subscribe := func(ctx context.Context, path string) *bufio.Reader {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("GET %s = %d %s", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		stream := bufio.NewReader(resp.Body)
+		if preamble := readEvent(t, stream); preamble != "retry: 3000\n: connected\n" {
+			t.Fatalf("preamble = %q", preamble)
+		}
+		return stream
+	}
+	change := func(method, target, body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, method, target, body))
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s = %d %s", method, target, rec.Code, rec.Body)
+		}
+	}
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	defer disconnect()
+	streamV1 := subscribe(context.Background(), "/api/v1/users/events")
+	streamV2 := subscribe(ctx, "/api/v2/users/events")
+	if n := events.Subscribers(); n != 2 {
+		t.Fatalf("%d subscribers, want 2", n)
+	}
+
+	// Every change reaches both, each in its own version
+	change("POST", "/api/v1/users", `{"name":"Ann Lee","email":"ann@example.com","age":30}`)
+	change("PUT", "/api/v1/users/11", `{"age":31,"version":1}`)
+	change("DELETE", "/api/v1/users/11", "")
+	for _, want := range []struct{ event, v1, v2 string }{
+		{"user.created", `"name":"Ann Lee"`, `"first_name":"Ann","last_name":"Lee"`},
+		{"user.updated", `"age":31`, `"age":31`},
+		{"user.deleted", `"id":11`, `"id":11`},
+	} {
+		for _, s := range []struct {
+			stream *bufio.Reader
+			want   string
+		}{{streamV1, want.v1}, {streamV2, want.v2}} {
+			event := readEvent(t, s.stream)
+			if !strings.Contains(event, "event: "+want.event+"\n") || !strings.Contains(event, s.want) {
+				t.Errorf("event = %q, want %s with %s", event, want.event, s.want)
+			}
+		}
+	}
+
+	// An idle stream sends a comment every heartbeatInterval
+	fake.BlockUntil(2)
+	fake.Advance(heartbeatInterval)
+	if ping := readEvent(t, streamV1); ping != ": ping\n" {
+		t.Errorf("heartbeat = %q", ping)
+	}
+
+	// A client that goes away is noticed through its request's context
+	disconnect()
+	waitFor(t, "the v2 stream to unsubscribe", func() bool { return events.Subscribers() == 1 })
+
+	// Shutting down ends the streams that are left
+	events.CloseAll()
+	if _, err := streamV1.ReadString('\n'); err != io.EOF {
+		t.Errorf("stream after CloseAll: %v, want EOF", err)
+	}
+}
+
+// readEvent reads one event, or comment, from an SSE stream: the lines up
+// to a blank one
+func readEvent(t *testing.T, stream *bufio.Reader) string {
+	t.Helper()
+	var event strings.Builder
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			return event.String()
+		}
+		if line == "\n" {
+			return event.String()
+		}
+		event.WriteString(line)
+	}
+}
+
+// waitFor polls cond until it's true, or fails the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// TestEventBus checks that a subscriber that falls behind is dropped
+// rather than holding up Publish
+func TestEventBus(t *testing.T) {
+	bus := newEventBus()
+	slow, _ := bus.Subscribe(allTenants)
+	fast, unsubscribe := bus.Subscribe(allTenants)
+	for i := 0; i < eventBuffer; i++ {
+		bus.Publish(context.Background(), userCreated, domain.User{ID: i})
+		<-fast
+	}
+	bus.Publish(context.Background(), userCreated, domain.User{ID: eventBuffer}) // one too many for slow
+	if n := bus.Subscribers(); n != 1 {
+		t.Errorf("%d subscribers after one fell behind, want 1", n)
+	}
+	if e := <-fast; e.ID != eventBuffer+1 || e.User.ID != eventBuffer {
+		t.Errorf("fast subscriber got %+v", e)
+	}
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != eventBuffer {
+		t.Errorf("slow subscriber got %d events before its channel closed, want %d", received, eventBuffer)
+	}
+
+	unsubscribe()
+	unsubscribe() // twice is fine
+	if _, ok := <-fast; ok || bus.Subscribers() != 0 {
+		t.Errorf("still subscribed after unsubscribing")
+	}
+}
+
+// TestWebSocket connects two clients through the real middleware, and
+// checks that both hear of every change, that they're pinged, that one
+// that hangs up is forgotten, and that stopping the hub says goodbye
+func TestWebSocket(t *testing.T) {
+	fake := useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	hub = newHub()
+	stopHub := startHub(hub)
+	defer stopHub()
+	srv := httptest.NewServer(NewServer().Handler)
+	t.Cleanup(srv.Close)
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	// connect dials /api/ws and reads the hello, by which time the hub
+	// has registered the client
+	connect := func() *websocket.Conn {
+		t.Helper()
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("dial = %d", resp.StatusCode)
+		}
+		var hello wsMessage
+		if err := conn.ReadJSON(&hello); err != nil || hello.Type != "hello" {
+			t.Fatalf("first message = %+v, %v", hello, err)
+		}
+		return conn
+	}
+	first, second := connect(), connect()
+	if n := hub.Clients(); n != 2 {
+		t.Fatalf("%d clients, want 2", n)
+	}
+
+	// Every change reaches both
+	change := func(method, target, body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, method, target, body))
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s = %d %s", method, target, rec.Code, rec.Body)
+		}
+	}
+	change("POST", "/api/v1/users", `{"name":"Ann Lee","email":"ann@example.com","age":30}`)
+	change("DELETE", "/api/v1/users/11", "")
+	for _, conn := range []*websocket.Conn{first, second} {
+		for _, want := range []string{userCreated, userDeleted} {
+			var msg wsMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type != want || msg.User == nil || msg.User.ID != 11 || msg.User.Name != "Ann Lee" {
+				t.Errorf("message = %+v, want %s of user 11", msg, want)
+			}
+		}
+	}
+
+	// Both are pinged every wsPingPeriod. The ping handler runs inside
+	// a read, which then waits for the next message.
+	pinged := make(chan bool, 1)
+	first.SetPingHandler(func(string) error { pinged <- true; return nil })
+	go first.ReadMessage() // returns once the hub says goodbye, below
+	fake.BlockUntil(2)
+	fake.Advance(wsPingPeriod)
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Error("no ping")
+	}
+
+	// A client that hangs up is forgotten
+	second.Close()
+	waitFor(t, "the hub to forget the second client", func() bool { return hub.Clients() == 1 })
+
+	// Stopping closes the rest with 1001 Going Away
+	first.SetPingHandler(nil)
+	closed := make(chan int, 1)
+	first.SetCloseHandler(func(code int, text string) error { closed <- code; return nil })
+	stopHub()
+	select {
+	case code := <-closed:
+		if code != websocket.CloseGoingAway {
+			t.Errorf("closed with %d, want %d", code, websocket.CloseGoingAway)
+		}
+	case <-time.After(time.Second):
+		t.Error("not closed on stop")
+	}
+
+	// A request that isn't a WebSocket handshake is a 400
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/ws", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("plain GET /api/ws = %d, want 400", rec.Code)
+	}
+}
+
+// TestWebSocketSlowClient checks that a client that stops reading is
+// TestGraphQL queries, changes and watches users through /graphql, and
+// checks mutations are guarded as REST writes are
+func TestGraphQL(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	// do sends query, with a token if token is set, and returns the data
+	// and the errors' messages and codes
+	do := func(query string, token bool) (map[string]any, []string) {
+		t.Helper()
+		body, err := json.Marshal(graphQLRequest{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		if token {
+			r.Header.Set("Authorization", "Bearer "+testToken(t))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		var resp struct {
+			Data   map[string]any
+			Errors []struct {
+				Message    string
+				Extensions struct{ Code string }
+			}
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("%s = %d %s", query, rec.Code, rec.Body)
+		}
+		var errs []string
+		for _, e := range resp.Errors {
+			errs = append(errs, e.Extensions.Code+": "+e.Message)
+		}
+		return resp.Data, errs
+	}
+	asJSON := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	for _, tt := range []struct{ query, want string }{
+		{`{ user(id: 1) { id name firstName lastName version } }`,
+			`{"user":{"firstName":"John","id":1,"lastName":"Doe","name":"John Doe","version":1}}`},
+		{`{ user(id: 99) { name } }`, `{"user":null}`},
+		{`{ users(sort: "-age", limit: 2) { total pages users { name age } } }`,
+			`{"users":{"pages":5,"total":10,"users":[{"age":67,"name":"Margaret Cerf"},{"age":54,"name":"Ada Knuth"}]}}`},
+		{`{ a: user(id: 1) { email } b: user(id: 2) { email } }`,
+			`{"a":{"email":"john@example.com"},"b":{"email":"jane@example.com"}}`},
+	} {
+		if data, errs := do(tt.query, false); asJSON(data) != tt.want || errs != nil {
+			t.Errorf("%s = %s %v, want %s", tt.query, asJSON(data), errs, tt.want)
+		}
+	}
+	if _, errs := do(`{ users(sort: "password") { total } }`, false); len(errs) != 1 || !strings.HasPrefix(errs[0], "BAD_REQUEST: sort must be") {
+		t.Errorf("a bad sort gets %v, want a BAD_REQUEST error", errs)
+	}
+	if _, errs := do(`{ user(id: 1) { password } }`, false); len(errs) != 1 || !strings.Contains(errs[0], `Cannot query field "password"`) {
+		t.Errorf("an unknown field gets %v", errs)
+	}
+
+	// Mutations need a token, over POST
+	create := `mutation { createUser(name: "Ann Lee", email: "ann@example.com", age: 30) { id version } }`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(asJSON(graphQLRequest{Query: create}))))
+	if rec.Code != http.StatusUnauthorized || countUsers(t) != 10 {
+		t.Errorf("a mutation without a token = %d, with %d users; want 401, and none created", rec.Code, countUsers(t))
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(create), nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("a mutation over GET = %d, want 405", rec.Code)
+	}
+	if data, errs := do(create, true); asJSON(data) != `{"createUser":{"id":11,"version":1}}` || errs != nil {
+		t.Errorf("createUser = %s %v", asJSON(data), errs)
+	}
+	if _, errs := do(`mutation { createUser(name: "", email: "ann", age: 30) { id } }`, true); len(errs) != 1 || !strings.HasPrefix(errs[0], "VALIDATION_FAILED") {
+		t.Errorf("an invalid createUser gets %v, want VALIDATION_FAILED", errs)
+	}
+
+	for _, tt := range []struct{ query, want, wantErr string }{
+		{`mutation { updateUser(id: 11, version: 1, age: 31) { age version } }`, `{"updateUser":{"age":31,"version":2}}`, ""},
+		{`mutation { updateUser(id: 11, version: 1, age: 32) { age } }`, `null`, "CONFLICT: The user is at version 2, not 1"},
+		{`mutation { updateUser(id: 11, version: 2, email: "ann") { age } }`, `null`, "VALIDATION_FAILED"},
+		{`mutation { updateUser(id: 99, version: 1, age: 32) { age } }`, `null`, "NOT_FOUND"},
+		{`mutation { deleteUser(id: 11, version: 1) { id } }`, `null`, "CONFLICT"},
+		{`mutation { deleteUser(id: 11) { name } }`, `{"deleteUser":{"name":"Ann Lee"}}`, ""},
+	} {
+		data, errs := do(tt.query, true)
+		if tt.wantErr == "" && (asJSON(data) != tt.want || errs != nil) ||
+			tt.wantErr != "" && (len(errs) != 1 || !strings.HasPrefix(errs[0], tt.wantErr)) {
+			t.Errorf("%s = %s %v, want %s %s", tt.query, asJSON(data), errs, tt.want, tt.wantErr)
+		}
+	}
+	if user, err := db.Get(context.Background(), 11); err == nil {
+		t.Errorf("user 11 is still there after deleteUser: %+v", user)
+	}
+}
+
+// TestGraphQLSubscription watches users change through a GraphQL
+// subscription, streamed as Server-Sent Events
+func TestGraphQLSubscription(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	srv := httptest.NewServer(NewServer().Handler)
+	t.Cleanup(srv.Close)
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	query := url.QueryEscape(`subscription { userEvents { type user { id firstName } } }`)
+	resp, err := http.Get(srv.URL + "/graphql?query=" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("subscription = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	waitFor(t, "the subscription", func() bool { return events.Subscribers() == 1 })
+
+	for _, change := range []struct{ method, target, body string }{
+		{"POST", "/api/v1/users", `{"name":"Ann Lee","email":"ann@example.com","age":30}`},
+		{"DELETE", "/api/v1/users/11", ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(t, change.method, change.target, change.body))
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s = %d %s", change.method, change.target, rec.Code, rec.Body)
+		}
+	}
+	stream := bufio.NewReader(resp.Body)
+	for _, want := range []string{
+		"event: next\ndata: {\"data\":{\"userEvents\":{\"type\":\"user.created\",\"user\":{\"firstName\":\"Ann\",\"id\":11}}}}\n",
+		"event: next\ndata: {\"data\":{\"userEvents\":{\"type\":\"user.deleted\",\"user\":{\"firstName\":\"Ann\",\"id\":11}}}}\n",
+	} {
+		if event := readEvent(t, stream); event != want {
+			t.Errorf("event = %q, want %q", event, want)
+		}
+	}
+
+	// Shutting down completes the stream
+	events.CloseAll()
+	if event := readEvent(t, stream); event != "event: complete\ndata:\n" {
+		t.Errorf("after CloseAll: %q, want a complete event", event)
+	}
+}
+
+// disconnected rather than holding up the hub
+func TestWebSocketSlowClient(t *testing.T) {
+	h := newHub()
+	c := &wsClient{hub: h, send: make(chan []byte, wsSendBuffer)}
+	h.clients[c] = struct{}{}
+	for i := 0; i <= wsSendBuffer; i++ {
+		h.sendTo(c, wsMessage{Type: userCreated, ID: int64(i)})
+	}
+	if len(h.clients) != 0 {
+		t.Error("a client that fell behind is still connected")
+	}
+	queued := 0
+	for range c.send {
+		queued++
+	}
+	if queued != wsSendBuffer {
+		t.Errorf("%d messages queued before disconnecting, want %d", queued, wsSendBuffer)
+	}
+	if code := binary.BigEndian.Uint16(c.closeMessage); code != websocket.CloseTryAgainLater {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseTryAgainLater)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	useFakeClock(t)
+	db = store.NewMemory()
+	initializeData()
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	var raw bytes.Buffer
+	if err := json.Indent(&raw, rec.Body.Bytes(), "", "  "); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("GET /api/openapi.json = %d, %v", rec.Code, err)
+	}
+	golden.Check(t, "openapi.golden", raw.String())
+
+	doc := buildOpenAPI()
+	var refs []string
+	var collect func(s *schema)
+	collect = func(s *schema) {
+		if s == nil {
+			return
+		}
+		if s.Ref != "" {
+			refs = append(refs, s.Ref)
+		}
+		collect(s.Items)
+		collect(s.AdditionalProperties)
+		for _, p := range s.Properties {
+			collect(p)
+		}
+		for _, a := range s.AllOf {
+			collect(a)
+		}
+	}
+	for _, s := range doc.Components.Schemas {
+		collect(s)
+	}
+	for _, ops := range doc.Paths {
+		for _, op := range ops {
+			for _, resp := range op.Responses {
+				for _, media := range resp.Content {
+					collect(media.Schema)
+				}
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					collect(media.Schema)
+				}
+			}
+		}
+	}
+	for _, ref := range refs {
+		if _, ok := doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			t.Errorf("%s doesn't resolve", ref)
+		}
+	}
+
+	token, err := smokeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminKey, err := smokeAdminKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range smokeSteps(token, adminKey) {
+		op, ok := findOperation(doc, step.Method, step.Path)
+		if !ok {
+			t.Errorf("%s %s isn't in the document", step.Method, step.Path)
+			continue
+		}
+		r := httptest.NewRequest(step.Method, step.Path, strings.NewReader(step.Body))
+		if step.ContentType != "" {
+			r.Header.Set("Content-Type", step.ContentType)
+		}
+		for name, value := range step.Header {
+			r.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		resp, ok := op.Responses[strconv.Itoa(rec.Code)]
+		if !ok {
+			t.Errorf("%s %s answered %d, which isn't documented", step.Method, step.Path, rec.Code)
+			continue
+		}
+		contentType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		media, ok := resp.Content[contentType]
+		if err != nil || !ok {
+			t.Errorf("%s %s answered %d with %q, which isn't documented", step.Method, step.Path, rec.Code, contentType)
+			continue
+		}
+		if !strings.HasSuffix(contentType, "json") || contentType == ndjsonType {
+			continue // like Swagger UI's page, or a stream of JSON lines
+		}
+		var body any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: %v", step.Method, step.Path, err)
+			continue
+		}
+		if err := checkSchema(doc, media.Schema, body, "body"); err != nil {
+			t.Errorf("%s %s -> %d: %v", step.Method, step.Path, rec.Code, err)
+		}
+	}
+}
+
+// findOperation matches a request against the document's path templates
+func findOperation(doc openAPIDoc, method, target string) (openAPIOperation, bool) {
+	path, _, _ := strings.Cut(target, "?")
+	parts := strings.Split(path, "/")
+	for template, ops := range doc.Paths {
+		templateParts := strings.Split(template, "/")
+		if len(templateParts) != len(parts) {
+			continue
+		}
+		matched := true
+		for i, part := range templateParts {
+			if part != parts[i] && !strings.HasPrefix(part, "{") {
+				matched = false
+				break
+			}
+		}
+		// A literal path wins over a template, as the suggest route does
+		if op, ok := ops[strings.ToLower(method)]; matched && ok {
+			if _, literal := doc.Paths[path]; !literal || template == path {
+				return op, true
+			}
+		}
+	}
+	return openAPIOperation{}, false
+}
+
+// checkSchema checks value has the fields s requires, of the right types,
+// and no fields s doesn't know about
+func checkSchema(doc openAPIDoc, s *schema, value any, at string) error {
+	if s.Ref != "" {
+		return checkSchema(doc, doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], value, at)
+	}
+	if len(s.AllOf) > 0 {
+		// Each part may narrow fields another declares, so check each
+		// part's own fields, and that every field is declared somewhere
+		fields := map[string]bool{}
+		for _, part := range s.AllOf {
+			resolved := part
+			if part.Ref != "" {
+				resolved = doc.Components.Schemas[strings.TrimPrefix(part.Ref, "#/components/schemas/")]
+			}
+			for name := range resolved.Properties {
+				fields[name] = true
+			}
+			object, _ := value.(map[string]any)
+			for _, name := range resolved.Required {
+				if _, ok := object[name]; !ok {
+					return fmt.Errorf("%s has no %s", at, name)
+				}
+			}
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is %T, want an object", at, value)
+		}
+		for name, field := range object {
+			if !fields[name] {
+				return fmt.Errorf("%s.%s isn't documented", at, name)
+			}
+			// The last part to declare a field is the narrowest
+			for i := len(s.AllOf) - 1; i >= 0; i-- {
+				part := s.AllOf[i]
+				if part.Ref != "" {
+					part = doc.Components.Schemas[strings.TrimPrefix(part.Ref, "#/components/schemas/")]
+				}
+				if fs, ok := part.Properties[name]; ok {
+					if err := checkSchema(doc, fs, field, at+"."+name); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is %T, want an object", at, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s has no %s", at, name)
+			}
+		}
+		for name, field := range object {
+			fs, ok := s.Properties[name]
+			if !ok && s.AdditionalProperties == nil {
+				return fmt.Errorf("%s.%s isn't documented", at, name)
+			}
+			if !ok {
+				fs = s.AdditionalProperties
+			}
+			if err := checkSchema(doc, fs, field, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s is %T, want an array", at, value)
+		}
+		for i, item := range list {
+			if err := checkSchema(doc, s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s is %T, want a string", at, value)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || s.Type == "integer" && n != float64(int64(n)) {
+			return fmt.Errorf("%s is %v, want an %s", at, value, s.Type)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s is %T, want a boolean", at, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// An orchestrator like Kubernetes asks a server two different questions.
+// Liveness, GET /healthz: is the process working at all? If not, restart
+// it. Readiness, GET /readyz: can it serve requests right now? If not,
+// stop sending it traffic until it can. The answers differ when a
+// dependency is down: the server is alive, and restarting it won't bring
+// the database back, but it isn't ready. So /healthz touches nothing but
+// the process, and /readyz runs a check of each dependency, at the same
+// time, each with its own timeout:
+//
+//	GET /readyz
+//
+//	503 {"status":"unready","checks":[
+//	      {"name":"store","status":"ok","duration_ms":0.2},
+//	      {"name":"http://localhost:9000/health","status":"timeout","error":"no answer within 2s","duration_ms":2000.4}]}
+//
+// GET /api/health is the older, single check, kept for the clients that
+// use it.
+
+// Check is a dependency GET /readyz checks. Run should return once ctx
+// is done; if it doesn't, /readyz stops waiting for it anyway.
+type Check struct {
+	Name    string
+	Timeout time.Duration // DefaultCheckTimeout if 0
+	Run     func(ctx context.Context) error
+}
+
+// DefaultCheckTimeout is how long a Check gets without a Timeout. Probes
+// usually time out after a few seconds, and a ready server answers well
+// within that.
+const DefaultCheckTimeout = 2 * time.Second
+
+var (
+	// storeCheck pings whichever store the API has
+	storeCheck = Check{Name: "store", Run: func(ctx context.Context) error { return db.Ping(ctx) }}
+	// readyChecks are the checks GET /readyz runs; Start adds to them
+	readyChecks = []Check{storeCheck}
+	// startedAt is when Start ran, for GET /healthz's uptime
+	startedAt time.Time
+)
+
+// DiskCheck checks files can be written in dir, by creating one and
+// removing it again: a full or read-only disk fails it
+func DiskCheck(dir string) Check {
+	return Check{Name: "disk " + dir, Run: func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString("ok")
+		return errors.Join(err, f.Close(), os.Remove(f.Name()))
+	}}
+}
+
+// HTTPCheck checks an API this one depends on answers GET url with a
+// 2xx status
+func HTTPCheck(url string) Check {
+	return Check{Name: url, Run: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("answered %s", resp.Status)
+		}
+		return nil
+	}}
+}
+
+// runChecks runs every check at once, so /readyz takes as long as the
+// slowest, not all of them added up, and returns their results in order
+func runChecks(ctx context.Context, checks []Check) []models.CheckResult {
+	results := make([]models.CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		i, check := i, check
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runCheck runs check within its timeout
+func runCheck(ctx context.Context, check Check) models.CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := clk.Now()
+	done := make(chan error, 1) // so a check that overruns can still finish, and exit
+	go func() { done <- check.Run(ctx) }()
+	result := models.CheckResult{Name: check.Name, Status: "ok"}
+	select {
+	case err := <-done:
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			result.Status, result.Error = "timeout", fmt.Sprintf("no answer within %s", timeout)
+		case err != nil:
+			result.Status, result.Error = "failed", err.Error()
+		}
+	case <-ctx.Done():
+		result.Status, result.Error = "timeout", fmt.Sprintf("no answer within %s", timeout)
+	}
+	result.DurationMS = float64(clk.Since(start).Microseconds()) / 1000
+	return result
+}
+
+// GET /healthz
+func handleLiveness(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, models.Liveness{
+		Status:    "alive",
+		Timestamp: clk.Now().Format(time.RFC3339),
+		Uptime:    clk.Since(startedAt).Round(time.Second).String(),
+	})
+}
+
+// GET /readyz: 200 if every check passed, or else 503, with the same body
+func handleReadiness(w http.ResponseWriter, r *http.Request) {
+	readiness := models.Readiness{Status: "ready", Checks: runChecks(r.Context(), readyChecks)}
+	status := http.StatusOK
+	for _, check := range readiness.Checks {
+		if check.Status != "ok" {
+			readiness.Status, status = "unready", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, status, readiness)
+}
+
+// GET /api/health
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	userList, err := db.List(r.Context())
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	count := len(userList)
+
+	health := models.HealthStatus{
+		Status:     "healthy",
+		Timestamp:  clk.Now().Format(time.RFC3339),
+		UsersCount: count,
+		Version:    "1.0.0",
+	}
+	base := db
+	if tenanted, ok := db.(*store.Tenanted); ok {
+		base = tenanted.UserStore
+	}
+	if cached, ok := base.(*store.Cached); ok {
+		stats := cached.Stats()
+		health.Cache = &stats
+	}
+	respond.JSON(w, http.StatusOK, health)
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// sweepInterval is how often the sweeper deletes expired invitations
+const sweepInterval = time.Minute
+
+// invitations holds the invitation tokens for /api/invitations
+var invitations = newInvitationStore()
+
+// Errors returned by invitationStore
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationExpired  = errors.New("invitation expired")
+)
+
+// invitationStore keeps invitations in memory. Expired ones linger until
+// the sweeper deletes them, so every read checks the expiry itself: the
+// sweeper only saves memory, it isn't what makes an invitation expire.
+type invitationStore struct {
+	mu      sync.Mutex
+	byToken map[string]models.Invitation
+}
+
+func newInvitationStore() *invitationStore {
+	return &invitationStore{byToken: make(map[string]models.Invitation)}
+}
+
+// Create stores a new invitation for email that expires ttl after now
+func (s *invitationStore) Create(email string, ttl time.Duration, now time.Time) (models.Invitation, error) {
+	token, err := newInvitationToken()
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	inv := models.Invitation{Token: token, Email: email, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byToken[token] = inv
+	return inv, nil
+}
+
+// Get returns an invitation, treating an expired one as gone even if the
+// sweeper hasn't deleted it yet
+func (s *invitationStore) Get(token string, now time.Time) (models.Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.byToken[token]
+	if !ok {
+		return models.Invitation{}, ErrInvitationNotFound
+	}
+	if inv.Expired(now) {
+		return models.Invitation{}, ErrInvitationExpired
+	}
+	return inv, nil
+}
+
+// Delete revokes an invitation
+func (s *invitationStore) Delete(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byToken[token]; !ok {
+		return ErrInvitationNotFound
+	}
+	delete(s.byToken, token)
+	return nil
+}
+
+// invitationFilter picks invitations for List
+type invitationFilter struct {
+	// Expired lists the expired invitations the sweeper hasn't deleted
+	// yet instead of the active ones
+	Expired bool
+	// Within, if set, keeps only the active invitations expiring within
+	// this long of now
+	Within time.Duration
+}
+
+// List returns the invitations that match filter, soonest to expire first
+func (s *invitationStore) List(filter invitationFilter, now time.Time) []models.Invitation {
+	s.mu.Lock()
+	list := make([]models.Invitation, 0, len(s.byToken))
+	for _, inv := range s.byToken {
+		if inv.Expired(now) != filter.Expired {
+			continue
+		}
+		if filter.Within > 0 && inv.ExpiresAt.After(now.Add(filter.Within)) {
+			continue
+		}
+		list = append(list, inv)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].ExpiresAt.Equal(list[j].ExpiresAt) {
+			return list[i].ExpiresAt.Before(list[j].ExpiresAt)
+		}
+		return list[i].Token < list[j].Token
+	})
+	return list
+}
+
+// Sweep deletes every invitation that has expired by now and returns how
+// many it deleted
+func (s *invitationStore) Sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for token, inv := range s.byToken {
+		if inv.Expired(now) {
+			delete(s.byToken, token)
+			removed++
+		}
+	}
+	return removed
+}
+
+// startSweeper sweeps store every interval until the returned stop
+// function is called. stop waits for a sweep in progress to finish, so
+// once it returns nothing touches the store in the background.
+func startSweeper(store *invitationStore, interval time.Duration) (stop func()) {
+	ticker := clk.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if n := store.Sweep(now); n > 0 {
+					log.Printf("Swept %d expired invitation(s)", n)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+func newInvitationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating invitation token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GET /api/invitations/{token}
+func getInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, err := invitations.Get(r.PathValue("token"), clk.Now())
+	if err != nil {
+		respondWithInvitationError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, domain.APIResponse{Success: true, Data: inv})
+}
+
+// DELETE /api/invitations/{token}
+func deleteInvitation(w http.ResponseWriter, r *http.Request) {
+	if err := invitations.Delete(r.PathValue("token")); err != nil {
+		respondWithInvitationError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, domain.APIResponse{Success: true, Message: "Invitation revoked"})
+}
+
+// GET /api/invitations?status=active|expired&expires_within=1h
+//
+// requireAuth lets reads through without a token, but the list has
+// every invitation's token in it, so this needs a login or a writer's
+// API key, as making one does
+func listInvitations(w http.ResponseWriter, r *http.Request) {
+	if _, ok := ClaimsFrom(r.Context()); !ok {
+		key, ok := APIKeyFrom(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			respondWithError(w, r, http.StatusUnauthorized, "Authentication required: listing invitations shows their tokens")
+			return
+		}
+		if !key.Role.Allows(models.RoleWriter) {
+			respondWithError(w, r, http.StatusForbidden, fmt.Sprintf("This API key is a %s; listing invitations needs %s", key.Role, models.RoleWriter))
+			return
+		}
+	}
+
+	var filter invitationFilter
+	switch status := r.URL.Query().Get("status"); status {
+	case "", "active":
+	case "expired":
+		filter.Expired = true
+	default:
+		respondWithError(w, r, http.StatusBadRequest, "status must be active or expired")
+		return
+	}
+	if within := r.URL.Query().Get("expires_within"); within != "" {
+		d, err := time.ParseDuration(within)
+		if err != nil || d <= 0 {
+			respondWithError(w, r, http.StatusBadRequest, "expires_within must be a positive duration, e.g. \"1h\"")
+			return
+		}
+		filter.Within = d
+	}
+
+	list := invitations.List(filter, clk.Now())
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    list,
+		Message: fmt.Sprintf("Found %d invitations", len(list)),
+	})
+}
+
+// POST /api/invitations
+func createInvitation(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateInvitationRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	ttl, errors := req.Validate()
+	if len(errors) > 0 {
+		respondWithValidationErrors(w, r, errors)
+		return
+	}
+	inv, err := invitations.Create(req.Email, ttl, clk.Now())
+	if err != nil {
+		log.Printf("Error creating invitation: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create invitation")
+		return
+	}
+	respond.JSON(w, http.StatusCreated, domain.APIResponse{
+		Success: true,
+		Data:    inv,
+		Message: "Invitation created successfully",
+	})
+}
+
+// respondWithInvitationError maps store errors onto HTTP status codes. An
+// expired invitation is 410 Gone rather than 404: it did exist, and the
+// client should ask for a new one rather than check the token.
+func respondWithInvitationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvitationNotFound):
+		respondWithError(w, r, http.StatusNotFound, "Invitation not found")
+	case errors.Is(err, ErrInvitationExpired):
+		respondWithError(w, r, http.StatusGone, "Invitation expired")
+	default:
+		log.Printf("Error: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// A new user gets a welcome email. Sending one can take seconds, or fail,
+// and whoever created the user shouldn't wait for either, so the handler
+// only puts a job on a queue and answers 201 at once. A pool of worker
+// goroutines, lesson 8's worker pool fed by a channel, takes jobs off the
+// queue and sends them:
+//
+//	POST /api/users → queue → worker → Mailer.Send
+//	                    ↑        │ fails
+//	                    └─ wait 1s, 2s, 4s...
+//	                             │ out of attempts
+//	                             ↓
+//	                        dead letters
+//
+// A job that fails goes back on the queue after a backoff that doubles
+// each time, until it has had JobAttempts tries. Then it's a dead letter:
+// kept for someone to look at, not retried forever. GET /api/jobs shows
+// what's pending and what finished.
+//
+// Users created one at a time or in bulk are welcomed; imported ones
+// exist elsewhere already, and aren't. The queue is in memory, so jobs
+// still pending when the server stops are lost. A real one would keep
+// them in the database, written in the same transaction as the user.
+
+const (
+	// welcomeEmail is the Kind of the job that welcomes a new user
+	welcomeEmail = "welcome_email"
+	// jobQueueSize is how many jobs can wait for a worker. Enqueue never
+	// blocks a request: a job that doesn't fit is a dead letter at once.
+	jobQueueSize = 1000
+	// keepJobs is how many finished jobs, and dead letters, are kept
+	keepJobs = 100
+	// jobTimeout is how long one attempt at a job may take
+	jobTimeout = 10 * time.Second
+
+	// DefaultWorkers, DefaultJobAttempts and DefaultJobBackoff are the
+	// queue's defaults: workers sending at once, tries at each job, and
+	// the wait before the first retry
+	DefaultWorkers     = 2
+	DefaultJobAttempts = 3
+	DefaultJobBackoff  = time.Second
+)
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogMailer pretends to send email, by logging it
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("Email to %s: %s", to, subject)
+	return nil
+}
+
+// jobs is the queue the user handlers add welcome emails to; Start
+// replaces it with one from Config, and starts its workers
+var jobs = newJobQueue(welcomeJob(LogMailer{}), DefaultJobAttempts, DefaultJobBackoff)
+
+// welcomeJob runs a welcome email job with mailer
+func welcomeJob(mailer Mailer) func(ctx context.Context, job models.Job) error {
+	return func(ctx context.Context, job models.Job) error {
+		body := fmt.Sprintf("Your account, #%d, is ready. Log in at /api/auth/login.", job.UserID)
+		return mailer.Send(ctx, job.To, job.Subject, body)
+	}
+}
+
+// jobQueue runs jobs in the background, retrying ones that fail
+type jobQueue struct {
+	handle   func(ctx context.Context, job models.Job) error
+	attempts int
+	backoff  time.Duration
+	ready    chan int // IDs of the jobs to run now
+
+	mu         sync.Mutex
+	workers    int
+	nextID     int
+	pending    map[int]*models.Job // queued, running or retrying
+	done, dead []models.Job        // the latest keepJobs of each, oldest first
+	doneCount  int
+	deadCount  int
+}
+
+// newJobQueue returns a queue that runs each job with handle, up to
+// attempts times, waiting backoff before the first retry and twice as
+// long before each one after
+func newJobQueue(handle func(ctx context.Context, job models.Job) error, attempts int, backoff time.Duration) *jobQueue {
+	return &jobQueue{
+		handle:   handle,
+		attempts: attempts,
+		backoff:  backoff,
+		ready:    make(chan int, jobQueueSize),
+		pending:  make(map[int]*models.Job),
+	}
+}
+
+// start runs jobs with n workers until the returned stop function is
+// called. stop cancels the jobs running, and waits for the workers to
+// finish.
+func (q *jobQueue) start(n int) (stop func()) {
+	q.mu.Lock()
+	q.workers = n
+	q.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case id := <-q.ready:
+					q.run(ctx, id, &wg)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+// Enqueue adds a kind of job for user, of ctx's tenant, and returns it
+func (q *jobQueue) Enqueue(ctx context.Context, kind string, user domain.User) models.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	now := clk.Now()
+	job := &models.Job{
+		ID: q.nextID, Kind: kind, Tenant: middleware.TenantFrom(ctx), UserID: user.ID, To: user.Email,
+		Subject: "Welcome, " + user.Name, Status: models.JobQueued, CreatedAt: now, UpdatedAt: now,
+	}
+	q.pending[job.ID] = job
+	select {
+	case q.ready <- job.ID:
+	default:
+		q.fail(job, "the queue is full")
+	}
+	return *job
+}
+
+// run makes one attempt at a job. If it fails, and has attempts left, a
+// goroutine that wg counts puts it back on the queue after the backoff.
+func (q *jobQueue) run(ctx context.Context, id int, wg *sync.WaitGroup) {
+	q.mu.Lock()
+	job := q.pending[id]
+	job.Status, job.RetryAt = models.JobRunning, nil
+	job.Attempts++
+	job.UpdatedAt = clk.Now()
+	attempt := *job
+	q.mu.Unlock()
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	err := q.handle(jobCtx, attempt)
+	cancel()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.UpdatedAt = clk.Now()
+	switch {
+	case err == nil:
+		job.Status, job.Error = models.JobDone, ""
+		delete(q.pending, id)
+		q.done = keepLatest(q.done, *job)
+		q.doneCount++
+	case ctx.Err() != nil:
+		// The server is stopping; the job is lost with the rest of the queue
+	case job.Attempts >= q.attempts:
+		q.fail(job, err.Error())
+		log.Printf("Job %d (%s to %s) failed %d times; it's a dead letter: %v", id, job.Kind, job.To, job.Attempts, err)
+	default:
+		delay := q.backoff << (job.Attempts - 1)
+		retryAt := job.UpdatedAt.Add(delay)
+		job.Status, job.Error, job.RetryAt = models.JobRetrying, err.Error(), &retryAt
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-clk.After(delay):
+				q.retry(ctx, id)
+			case <-ctx.Done():
+			}
+		}()
+	}
+}
+
+// retry puts a job that's waited out its backoff back on the queue
+func (q *jobQueue) retry(ctx context.Context, id int) {
+	q.mu.Lock()
+	job := q.pending[id]
+	job.Status, job.RetryAt = models.JobQueued, nil
+	job.UpdatedAt = clk.Now()
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- id:
+	case <-ctx.Done():
+	}
+}
+
+// fail makes job a dead letter. The caller holds q.mu.
+func (q *jobQueue) fail(job *models.Job, reason string) {
+	job.Status, job.Error, job.RetryAt = models.JobDead, reason, nil
+	delete(q.pending, job.ID)
+	q.dead = keepLatest(q.dead, *job)
+	q.deadCount++
+}
+
+// keepLatest appends job to jobs, dropping the oldest past keepJobs
+func keepLatest(jobs []models.Job, job models.Job) []models.Job {
+	jobs = append(jobs, job)
+	if len(jobs) > keepJobs {
+		jobs = slices.Delete(jobs, 0, len(jobs)-keepJobs)
+	}
+	return jobs
+}
+
+// Status counts the jobs in each state, and lists them
+func (q *jobQueue) Status() models.JobQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := models.JobQueueStatus{
+		Workers:     q.workers,
+		Done:        q.doneCount,
+		Dead:        q.deadCount,
+		Pending:     []models.Job{},
+		Finished:    slices.Clone(q.done),
+		DeadLetters: slices.Clone(q.dead),
+	}
+	for _, job := range q.pending {
+		status.Pending = append(status.Pending, *job)
+		switch job.Status {
+		case models.JobQueued:
+			status.Queued++
+		case models.JobRunning:
+			status.Running++
+		case models.JobRetrying:
+			status.Retrying++
+		}
+	}
+	slices.SortFunc(status.Pending, func(a, b models.Job) int { return a.ID - b.ID })
+	slices.Reverse(status.Finished)
+	slices.Reverse(status.DeadLetters)
+	if status.Finished == nil {
+		status.Finished = []models.Job{}
+	}
+	if status.DeadLetters == nil {
+		status.DeadLetters = []models.Job{}
+	}
+	return status
+}
+
+// GET /api/jobs
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	status := jobs.Status()
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    status,
+		Message: fmt.Sprintf("%d pending, %d done, %d dead", len(status.Pending), status.Done, status.Dead),
+	})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+)
+
+var (
+	// limiter rate-limits every request, by rateLimitKey
+	limiter = middleware.NewRateLimiter(middleware.DefaultRate, middleware.DefaultBurst)
+	// quotas counts requests per API key ID, by quotaKey
+	quotas = middleware.NewQuotas(middleware.DefaultDailyQuota)
+)
+
+// rateLimitKey is who a request counts against: its API key if it has
+// one, so clients behind one address each get their own bucket, or else
+// its IP address. X-Forwarded-For isn't trusted, since any client can
+// set it to dodge the limit; behind a proxy, trust only the proxy's.
+func rateLimitKey(r *http.Request) string {
+	if key, ok := APIKeyFrom(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// respondInvalidTenant answers a request whose X-Tenant-ID isn't a
+// tenant ID
+func respondInvalidTenant(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, r, http.StatusBadRequest, middleware.TenantHeader+" must be 1 to 63 letters, digits, - or _, starting with a letter or digit")
+}
+
+// respondRateLimited answers a client whose bucket is empty
+func respondRateLimited(w http.ResponseWriter, r *http.Request) {
+	respondWithProblemType(w, r, rateLimited, "Too many requests; slow down")
+}
+
+// quotaKey is the API key a request counts against. Requests without a
+// key, and the admin endpoints (so an admin can always reset a quota),
+// aren't counted. Keys are counted by ID, which apiKeyMiddleware has
+// checked, so the secret itself never ends up in the admin endpoints.
+func quotaKey(r *http.Request) (string, bool) {
+	key, ok := APIKeyFrom(r.Context())
+	if !ok || strings.HasPrefix(r.URL.Path, "/api/admin/") {
+		return "", false
+	}
+	return key.ID, true
+}
+
+// respondQuotaExceeded answers a key that has used its quota up
+func respondQuotaExceeded(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, r, http.StatusTooManyRequests, "Daily quota exceeded")
+}
+
+// GET /api/admin/quotas
+func handleQuotas(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"quotas": quotas.List(clk.Now()),
+	})
+}
+
+// GET /api/admin/quotas/{key}, by the key's ID
+func getQuota(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, quotas.Get(r.PathValue("key"), clk.Now()))
+}
+
+// DELETE /api/admin/quotas/{key} resets the key's quota
+func resetQuota(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !quotas.Reset(key) {
+		respondWithError(w, r, http.StatusNotFound, "No requests counted for this key")
+		return
+	}
+	respond.JSON(w, http.StatusOK, quotas.Get(key, clk.Now()))
+}
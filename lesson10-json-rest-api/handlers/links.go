@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+
+	"golang-lab/lab/domain"
+)
+
+// Responses carry hypermedia links (HATEOAS: hypermedia as the engine of
+// application state). Each user says where it lives and what can be done
+// to it, and a page of users where the next page is, so a client follows
+// links instead of building URLs from rules it had to be told:
+//
+//	{"id":1,"name":"John Doe",...,"_links":{
+//	  "self":{"href":"http://localhost:8080/api/v1/users/1","method":"GET"},
+//	  "update":{"href":"http://localhost:8080/api/v1/users/1","method":"PUT"},
+//	  "delete":{"href":"http://localhost:8080/api/v1/users/1","method":"DELETE"},
+//	  "collection":{"href":"http://localhost:8080/api/v1/users","method":"GET"}}}
+//
+// The links stay in the version the client asked for, and the unversioned
+// paths link to v1's. Patch documents are the user without its links, so
+// _links can't be patched.
+
+// absoluteURL is path on the server r was sent to. The scheme is the
+// connection's: X-Forwarded-Proto isn't trusted, for the same reason
+// rateLimitKey doesn't trust X-Forwarded-For.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// collectionPath is where v's users live, like /api/v2/users
+func (v *apiVersion) collectionPath() string {
+	return "/api/" + v.name + "/users"
+}
+
+// userLinks are the links of one user
+func (v *apiVersion) userLinks(r *http.Request, user domain.User) domain.Links {
+	self := absoluteURL(r, v.collectionPath()+"/"+strconv.Itoa(user.ID))
+	return domain.Links{
+		"self":       {Href: self, Method: http.MethodGet},
+		"update":     {Href: self, Method: http.MethodPut},
+		"delete":     {Href: self, Method: http.MethodDelete},
+		"collection": {Href: absoluteURL(r, v.collectionPath()), Method: http.MethodGet},
+	}
+}
+
+// pageLinks are the links of a page of users: itself, its neighbours, and
+// where to create a user
+func (v *apiVersion) pageLinks(r *http.Request, meta domain.PageMeta) domain.Links {
+	links := domain.Links{
+		"self":   {Href: absoluteURL(r, r.URL.RequestURI()), Method: http.MethodGet},
+		"create": {Href: absoluteURL(r, v.collectionPath()), Method: http.MethodPost},
+	}
+	if meta.Next != "" {
+		links["next"] = domain.Link{Href: absoluteURL(r, meta.Next), Method: http.MethodGet}
+	}
+	if meta.Prev != "" {
+		links["prev"] = domain.Link{Href: absoluteURL(r, meta.Prev), Method: http.MethodGet}
+	}
+	return links
+}
+
+// resource is user as v sends it, with its links
+func (v *apiVersion) resource(r *http.Request, user domain.User) any {
+	return v.linked(user, v.userLinks(r, user))
+}
+
+// resources are users as v sends them, with their links
+func (v *apiVersion) resources(r *http.Request, users []domain.User) resourceList {
+	list := make(resourceList, len(users))
+	for i, user := range users {
+		list[i] = v.resource(r, user)
+	}
+	return list
+}
+
+// resourceList is a list of users with links. In XML each is a <user>,
+// as in domain.Users.
+type resourceList []any
+
+// MarshalXML implements xml.Marshaler
+func (list resourceList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, item := range list {
+		if err := e.EncodeElement(item, xml.StartElement{Name: xml.Name{Local: "user"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
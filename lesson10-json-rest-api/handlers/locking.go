@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang-lab/lab/domain"
+)
+
+// Optimistic locking: every user has a version, 1 when it's created and
+// one more with each change, and a PUT or PATCH has to say which version
+// it was made to. If that's no longer the current one, someone else
+// changed the user in between, and the request is refused with 409
+// Conflict instead of overwriting their change:
+//
+//	client A: GET /api/users/1          → version 3
+//	client B: GET /api/users/1          → version 3
+//	client A: PUT ... If-Match: 3       → 200, version 4
+//	client B: PUT ... If-Match: 3       → 409: it's at 4 now
+//
+// Without it, B's PUT would succeed and A's change would be gone without
+// either of them knowing: the lost update. B fetches the user again, and
+// decides what to do with A's change. It's optimistic because nothing is
+// locked while a client edits: conflicts are assumed rare, and caught
+// when they happen.
+//
+// The version goes in If-Match, bare: If-Match: 3. Or in the body: a PUT
+// sends "version": 3 with its fields, a merge patch the same, and a JSON
+// Patch tests it, [{"op":"test","path":"/version","value":3}, ...]. A
+// quoted If-Match is an ETag, as before (see etag.go), and names a version
+// as well as a number does. A PUT or PATCH with none of them gets 428
+// Precondition Required. DELETE may send a version too, but needn't.
+
+// isVersionTag reports whether tag, from If-Match, is a version rather
+// than an ETag: digits, without the quotes an entity tag always has
+func isVersionTag(tag string) bool {
+	_, err := strconv.Atoi(tag)
+	return err == nil && !strings.HasPrefix(tag, "+") && !strings.HasPrefix(tag, "-")
+}
+
+// requireVersion is checkIfMatch for PUT and PATCH, which must name the
+// version they change. sent is the version in the body, if there was one.
+// Handlers call it under the store lock, with the user as it is now.
+func (v *apiVersion) requireVersion(w http.ResponseWriter, r *http.Request, user domain.User, sent *int) bool {
+	if sent != nil && *sent != user.Version {
+		respondWithVersionConflict(w, r, user, strconv.Itoa(*sent))
+		return false
+	}
+	if header := strings.TrimSpace(r.Header.Get("If-Match")); sent == nil && (header == "" || header == "*") {
+		respondWithError(w, r, http.StatusPreconditionRequired, fmt.Sprintf(
+			`Say which version of the user this changes: If-Match: %d, or "version": %d in the body`, user.Version, user.Version))
+		return false
+	}
+	return v.checkIfMatch(w, r, user)
+}
+
+// respondWithVersionConflict answers a request made to version sent of
+// user, which has changed since
+func respondWithVersionConflict(w http.ResponseWriter, r *http.Request, user domain.User, sent string) {
+	respondWithError(w, r, http.StatusConflict, fmt.Sprintf(
+		"The user is at version %d, not %s: someone changed it first. GET it again and retry", user.Version, sent))
+}
+
+// bodyVersion is the "version" of a PUT body, if it has one. The body is
+// decoded strictly by decodeUpdate too, so a version that isn't a number
+// is reported there.
+func bodyVersion(body []byte) *int {
+	var req struct {
+		Version *int `json:"version"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return nil
+	}
+	return req.Version
+}
+
+// patchVersion is the version a PATCH body was made to, if it names one:
+// a merge patch's "version", or the value a JSON Patch tests /version for
+func patchVersion(contentType string, body []byte) *int {
+	if contentType == mergePatchType {
+		return bodyVersion(body)
+	}
+	var ops []struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	if json.Unmarshal(body, &ops) != nil {
+		return nil
+	}
+	for _, op := range ops {
+		if value, ok := op.Value.(float64); ok && op.Op == "test" && op.Path == "/version" {
+			version := int(value)
+			return &version
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+)
+
+// metrics holds per-route timings for GET /api/admin/metrics and
+// GET /metrics
+var metrics = middleware.NewMetrics()
+
+// GET /api/admin/metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"routes": metrics.Snapshot(),
+	})
+}
+
+// GET /metrics
+func handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	// Written to a buffer first, so the lock isn't held while a slow
+	// scraper reads
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf)
+	w.Header().Set("Content-Type", middleware.PrometheusContentType)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build mongo
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/fixtures"
+	"golang-lab/lab/golden"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// These tests need a MongoDB server: go test -tags mongo, with
+// MONGO_URL naming it if it isn't on localhost
+
+// openTestMongo opens the store in a database of its own, which it
+// drops at the end
+func openTestMongo(t *testing.T) *store.Mongo {
+	t.Helper()
+	server := os.Getenv("MONGO_URL")
+	if server == "" {
+		server = "mongodb://localhost:27017"
+	}
+	s, err := store.OpenMongo(strings.TrimSuffix(server, "/") + "/golang_lab_" + t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.Database().Drop(context.Background()); err != nil {
+			t.Error(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+// TestAPIWithMongo runs TestAPI's script against MongoDB, as
+// TestAPIWithSQLite does against SQLite
+func TestAPIWithMongo(t *testing.T) {
+	db = openTestMongo(t)
+	t.Cleanup(func() { db = store.NewMemory() })
+	golden.Check(t, "api.golden", apiTranscript(t))
+}
+
+// TestStatsWithMongo checks GET /api/admin/stats serves the pipeline's
+// result when the store is MongoDB
+func TestStatsWithMongo(t *testing.T) {
+	s := openTestMongo(t)
+	db, statsStore = s, s
+	t.Cleanup(func() { db, statsStore = store.NewMemory(), nil })
+	if err := s.Replace(context.Background(), fixtures.Users(fixtures.Small)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewServer().Handler.ServeHTTP(rec, newRequest(t, "GET", "/api/admin/stats", ""))
+	var stats models.UserStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("GET /api/admin/stats = %d %s, %v", rec.Code, rec.Body.String(), err)
+	}
+	if stats.Total != fixtures.Small {
+		t.Errorf("total %d, want %d", stats.Total, fixtures.Small)
+	}
+}
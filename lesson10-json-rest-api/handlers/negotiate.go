@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The user endpoints answer in JSON, XML or YAML, whichever the client's
+// Accept header prefers, so the same response can be compared in all
+// three. Errors stay JSON (or problem+json); only successes are
+// negotiated.
+
+// format is a media type respondNegotiated can write, and how
+type format struct {
+	mediaType string
+	aliases   []string // other names clients use for it
+	marshal   func(v any) ([]byte, error)
+}
+
+// formats are the formats on offer, in the server's order of preference:
+// a client that accepts several equally gets the first
+var formats = []format{
+	{"application/json", nil, marshalJSON},
+	{"application/xml", []string{"text/xml"}, marshalXML},
+	{"application/yaml", []string{"application/x-yaml", "text/yaml"}, yaml.Marshal},
+}
+
+// marshalJSON writes what respond.JSON does, newline and all
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+// marshalXML writes an XML document: the declaration, then v
+func marshalXML(v any) ([]byte, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(xml.Header), data...), '\n'), nil
+}
+
+// acceptRange is one media range of an Accept header, like text/* or
+// application/xml;q=0.9
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept reads r's Accept headers; ranges it can't parse are skipped
+func parseAccept(r *http.Request) []acceptRange {
+	var ranges []acceptRange
+	for _, accept := range r.Header.Values("Accept") {
+		for _, s := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(s)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			ranges = append(ranges, acceptRange{mediaType, q})
+		}
+	}
+	return ranges
+}
+
+// quality is how much ranges accept mediaType, from 0 to 1. The most
+// specific range that matches decides (RFC 9110, section 12.5.1), so
+// "*/*;q=0.1, application/xml" accepts XML fully and JSON barely.
+func quality(ranges []acceptRange, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, ar := range ranges {
+		s := -1
+		switch {
+		case ar.mediaType == mediaType:
+			s = 2
+		case ar.mediaType == "*/*":
+			s = 0
+		case strings.HasSuffix(ar.mediaType, "/*") &&
+			strings.HasPrefix(mediaType, strings.TrimSuffix(ar.mediaType, "*")):
+			s = 1
+		}
+		if s > specificity {
+			q, specificity = ar.q, s
+		}
+	}
+	return q
+}
+
+// negotiate picks the format r's client prefers. No Accept header means
+// anything will do, so it's JSON; an Accept header that rules every
+// format out means there's no format to pick.
+func negotiate(r *http.Request) (format, bool) {
+	ranges := parseAccept(r)
+	if len(ranges) == 0 {
+		return formats[0], true
+	}
+	var best format
+	bestQ := 0.0
+	for _, f := range formats {
+		q := quality(ranges, f.mediaType)
+		for _, alias := range f.aliases {
+			q = max(q, quality(ranges, alias))
+		}
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// offered lists the media types on offer, for a 406's message
+func offered() string {
+	types := make([]string, len(formats))
+	for i, f := range formats {
+		types[i] = f.mediaType
+	}
+	return strings.Join(types, ", ")
+}
+
+// respondNegotiated sends data in the format the client prefers, or 406
+// Not Acceptable if it accepts none of them. The response varies with
+// Accept, so caches have to keep one copy per Accept header. A 200 is
+// tagged with an ETag, and is 304 Not Modified to a client that already
+// has it.
+func respondNegotiated(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Add("Vary", "Accept")
+	f, ok := negotiate(r)
+	if !ok {
+		respondWithError(w, r, http.StatusNotAcceptable, "This resource is available as "+offered())
+		return
+	}
+	// Marshal before writing anything, so a failure can still be a 500
+	body, err := f.marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s: %v", f.mediaType, err)
+		respondWithError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	// A successful read gets an ETag, and the client's copy may already be
+	// current (see etag.go)
+	if statusCode == http.StatusOK {
+		etag := etagOf(body)
+		w.Header().Set("ETag", etag)
+		if notModified(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", f.mediaType)
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
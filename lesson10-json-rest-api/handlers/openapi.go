@@ -0,0 +1,608 @@
+package handlers
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// The API describes itself in OpenAPI 3, the format Swagger UI, client
+// generators and API gateways all read. Writing the document by hand means
+// it drifts from the code; here it's generated from apiOperations, a table
+// of every endpoint, and the request and response schemas are reflected
+// from the same Go types the handlers encode, json tags and all.
+
+// openAPIPath serves the generated document; /api serves it too
+const openAPIPath = "/api/openapi.json"
+
+// swaggerUI is the page at /api/docs. It's compiled into the binary, but
+// loads Swagger UI's scripts from a CDN, so the browser needs internet.
+//
+//go:embed swagger.html
+var swaggerUI []byte
+
+// apiOperation is one method on one path, as the OpenAPI document
+// describes it
+type apiOperation struct {
+	method, path string
+	tag          string // groups operations in Swagger UI
+	summary      string
+	auth         bool        // needs a bearer token or a session
+	role         models.Role // needs an API key with this role; with auth, either will do
+	params       []apiParam
+	request      any            // a value of the body's type, or nil for no body
+	requests     map[string]any // bodies by media type, when it takes more than JSON
+	status       int            // the success status
+	data         any            // what APIResponse.Data holds on success, or nil
+	body         any            // a success body that isn't an APIResponse, instead
+	html         bool           // the success body is a web page, not JSON
+	stream       bool           // the success body is Server-Sent Events, not JSON
+	text         bool           // the success body is plain text, not JSON
+	files        []string       // the success body is a file of one of these media types, not JSON
+	upgrade      bool           // the success is a switch to a WebSocket, with no body
+	redirect     bool           // the success is a redirect to Location, with no body
+	negotiated   bool           // the success body also comes as XML or YAML, by Accept
+	conditional  bool           // the success has an ETag, and If-None-Match can make it 304
+	errors       []int          // the error statuses it can send
+}
+
+// apiParam is a path, query or header parameter
+type apiParam struct {
+	name, in    string // in is "path", "query" or "header"
+	schema      *schema
+	description string
+	required    bool // path parameters always are
+}
+
+func pathParam(name string, s *schema, description string) apiParam {
+	return apiParam{name: name, in: "path", schema: s, description: description}
+}
+
+func queryParam(name string, s *schema, description string) apiParam {
+	return apiParam{name: name, in: "query", schema: s, description: description}
+}
+
+func headerParam(name, description string) apiParam {
+	return apiParam{name: name, in: "header", schema: &schema{Type: "string"}, description: description}
+}
+
+// apiOperations is every endpoint the API serves, in the order Swagger UI
+// lists them. Adding a route to registerAPIRoutes means adding it here.
+var apiOperations = append(append(userOperations(v1), userOperations(v2)...), []apiOperation{
+	{method: "POST", path: "/api/auth/login", tag: "auth", summary: "Log in for a bearer token",
+		request: models.LoginRequest{},
+		status:  http.StatusOK, data: models.TokenResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge}},
+	{method: "GET", path: "/api/auth/me", tag: "auth", summary: "The claims of the token sent", auth: true,
+		status: http.StatusOK, data: models.Claims{}, errors: []int{http.StatusUnauthorized}},
+	{method: "GET", path: "/auth/github/login", tag: "auth", summary: "Log in with GitHub: redirects there, to approve this app",
+		status: http.StatusFound, redirect: true, errors: []int{http.StatusNotFound}},
+	{method: "GET", path: "/auth/github/callback", tag: "auth", summary: "Where GitHub sends the browser back; starts a session, and redirects to /api/auth/me",
+		params: []apiParam{
+			queryParam("code", &schema{Type: "string"}, "The code to exchange for GitHub's access token"),
+			queryParam("state", &schema{Type: "string"}, "The state the login was sent off with"),
+			queryParam("error", &schema{Type: "string"}, "Why GitHub didn't log the user in, instead of a code"),
+		},
+		status: http.StatusSeeOther, redirect: true,
+		errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusBadGateway}},
+	{method: "POST", path: "/auth/github/logout", tag: "auth", summary: "End the session",
+		status: http.StatusOK},
+
+	{method: "GET", path: "/api/invitations", tag: "invitations", summary: "List invitations", auth: true, role: models.RoleWriter,
+		params: []apiParam{
+			queryParam("status", &schema{Type: "string", Enum: []string{"active", "expired"}}, "active by default"),
+			queryParam("expires_within", &schema{Type: "string"}, `Only ones expiring within this Go duration, e.g. "1h"`),
+		},
+		status: http.StatusOK, data: []models.Invitation{}, errors: []int{http.StatusBadRequest}},
+	{method: "POST", path: "/api/invitations", tag: "invitations", summary: "Invite an email address", auth: true, role: models.RoleWriter,
+		request: models.CreateInvitationRequest{},
+		status:  http.StatusCreated, data: models.Invitation{}, errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge}},
+	{method: "GET", path: "/api/invitations/{token}", tag: "invitations", summary: "Get an invitation",
+		params: []apiParam{invitationTokenParam},
+		status: http.StatusOK, data: models.Invitation{}, errors: []int{http.StatusNotFound, http.StatusGone}},
+	{method: "DELETE", path: "/api/invitations/{token}", tag: "invitations", summary: "Revoke an invitation", auth: true, role: models.RoleWriter,
+		params: []apiParam{invitationTokenParam},
+		status: http.StatusOK, errors: []int{http.StatusNotFound}},
+
+	{method: "GET", path: "/graphql", tag: "graphql", summary: "Run a GraphQL query; a subscription streams as Server-Sent Events, next and complete",
+		params: []apiParam{
+			queryParam("query", &schema{Type: "string"}, "The GraphQL document"),
+			queryParam("operationName", &schema{Type: "string"}, "Which of its operations to run, if it has more than one"),
+			queryParam("variables", &schema{Type: "string"}, "The variables, as a JSON object"),
+		},
+		status: http.StatusOK, body: graphql.Result{}, errors: []int{http.StatusBadRequest, http.StatusMethodNotAllowed}},
+	{method: "POST", path: "/graphql", tag: "graphql", summary: "Run a GraphQL query, mutation or subscription; mutations need a token, session or writer key, as REST writes do",
+		request: graphQLRequest{},
+		status:  http.StatusOK, body: graphql.Result{},
+		errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge}},
+
+	{method: "GET", path: "/api/ws", tag: "users v1", summary: "Send every change to users over a WebSocket, as JSON messages",
+		status: http.StatusSwitchingProtocols, upgrade: true, errors: []int{http.StatusBadRequest, http.StatusForbidden}},
+
+	{method: "GET", path: "/api/jobs", tag: "meta", summary: "Background jobs: welcome emails pending, and the latest done and dead",
+		status: http.StatusOK, data: models.JobQueueStatus{}},
+	{method: "GET", path: "/api/health", tag: "meta", summary: "Health check",
+		status: http.StatusOK, body: models.HealthStatus{}},
+	{method: "GET", path: "/healthz", tag: "meta", summary: "Liveness: whether the process is up",
+		status: http.StatusOK, body: models.Liveness{}},
+	{method: "GET", path: "/readyz", tag: "meta", summary: "Readiness: whether the store and every other dependency answer; 503, with the same body, if any doesn't",
+		status: http.StatusOK, body: models.Readiness{}},
+	{method: "GET", path: "/metrics", tag: "meta", summary: "Request counts, latency histograms and errors, in the Prometheus text format",
+		status: http.StatusOK, text: true},
+	{method: "GET", path: "/api/problems/{type}", tag: "meta", summary: "What a problem type means",
+		params: []apiParam{pathParam("type", &schema{Type: "string"}, "The end of a problem's type URI, e.g. not-found")},
+		status: http.StatusOK, body: models.ProblemTypeDoc{}, errors: []int{http.StatusNotFound}},
+
+	{method: "GET", path: "/api/openapi.json", tag: "meta", summary: "This document",
+		status: http.StatusOK, body: map[string]any{}},
+	{method: "GET", path: "/api/docs", tag: "meta", summary: "Swagger UI, for reading this document and trying the API",
+		status: http.StatusOK, html: true},
+
+	{method: "GET", path: "/api/admin/export", tag: "admin", role: models.RoleAdmin, summary: "Download every user as a backup",
+		status: http.StatusOK, body: domain.Backup{}},
+	{method: "POST", path: "/api/admin/import", tag: "admin", role: models.RoleAdmin, summary: "Replace every user with a backup",
+		request: domain.Backup{},
+		status:  http.StatusOK, errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge}},
+	{method: "GET", path: "/api/admin/metrics", tag: "admin", role: models.RoleAdmin, summary: "Latency and error counts per route",
+		status: http.StatusOK, body: struct {
+			Routes []middleware.RouteMetrics `json:"routes"`
+		}{}},
+	{method: "GET", path: "/api/admin/stats", tag: "admin", role: models.RoleAdmin, summary: "How many users there are, and how old; only with -storage mongo",
+		status: http.StatusOK, body: models.UserStats{}, errors: []int{http.StatusNotFound}},
+	{method: "GET", path: "/api/admin/quotas", tag: "admin", role: models.RoleAdmin, summary: "Requests used today by each API key",
+		status: http.StatusOK, body: struct {
+			Quotas []middleware.QuotaStatus `json:"quotas"`
+		}{}},
+	{method: "GET", path: "/api/admin/quotas/{key}", tag: "admin", role: models.RoleAdmin, summary: "One API key's quota",
+		params: []apiParam{quotaKeyParam},
+		status: http.StatusOK, body: middleware.QuotaStatus{}, errors: []int{http.StatusBadRequest}},
+	{method: "DELETE", path: "/api/admin/quotas/{key}", tag: "admin", role: models.RoleAdmin, summary: "Give an API key its whole quota back",
+		params: []apiParam{quotaKeyParam},
+		status: http.StatusOK, body: middleware.QuotaStatus{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: "GET", path: "/api/admin/keys", tag: "admin", role: models.RoleAdmin, summary: "List API keys, revoked ones too",
+		status: http.StatusOK, data: []models.APIKey{}},
+	{method: "POST", path: "/api/admin/keys", tag: "admin", role: models.RoleAdmin, summary: "Issue an API key; the key is only ever sent this once",
+		request: models.IssueKeyRequest{},
+		status:  http.StatusCreated, data: models.IssuedKey{}, errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge}},
+	{method: "GET", path: "/api/admin/keys/{id}", tag: "admin", role: models.RoleAdmin, summary: "Get an API key",
+		params: []apiParam{apiKeyIDParam},
+		status: http.StatusOK, data: models.APIKey{}, errors: []int{http.StatusNotFound}},
+	{method: "DELETE", path: "/api/admin/keys/{id}", tag: "admin", role: models.RoleAdmin, summary: "Revoke an API key",
+		params: []apiParam{apiKeyIDParam},
+		status: http.StatusOK, data: models.APIKey{}, errors: []int{http.StatusNotFound}},
+}...)
+
+// userOperations are v's user endpoints. They're the same in every
+// version but for the users they send and take, and all of them are for
+// the tenant X-Tenant-ID names.
+func userOperations(v *apiVersion) []apiOperation {
+	prefix, tag := "/api/"+v.name, "users "+v.name
+	ops := []apiOperation{
+		{method: "GET", path: prefix + "/users", tag: tag, summary: "List users a page at a time",
+			params: []apiParam{
+				queryParam("page", &schema{Type: "integer", Minimum: ptr(1)}, "Page to return, from 1"),
+				queryParam("cursor", &schema{Type: "string"}, "Page by cursor instead: empty for the first page, then meta.next_cursor. In created_at order; not with page or sort"),
+				queryParam("limit", &schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(maxPageSize)}, "Users per page; 20 by default"),
+				queryParam("sort", &schema{Type: "string", Enum: []string{"name", "-name", "age", "-age", "created_at", "-created_at"}}, "Order; - for descending. ID order by default"),
+				queryParam("min_age", &schema{Type: "integer", Minimum: ptr(domain.MinAge), Maximum: ptr(domain.MaxAge)}, "Only users at least this old"),
+				queryParam("email_contains", &schema{Type: "string"}, "Only users whose email contains this, ignoring case"),
+				ifNoneMatchParam,
+			},
+			status: http.StatusOK, data: resourceList{v.linked(domain.User{}, nil)}, negotiated: true, conditional: true,
+			errors: []int{http.StatusBadRequest, http.StatusNotAcceptable}},
+		{method: "POST", path: prefix + "/users", tag: tag, summary: "Create a user", auth: true, role: models.RoleWriter,
+			request: v.create,
+			status:  http.StatusCreated, data: v.linked(domain.User{}, nil), errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusRequestEntityTooLarge}},
+		{method: "GET", path: prefix + "/users/{id}", tag: tag, summary: "Get a user",
+			params: []apiParam{userIDParam, ifNoneMatchParam},
+			status: http.StatusOK, data: v.linked(domain.User{}, nil), negotiated: true, conditional: true,
+			errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable}},
+		{method: "PUT", path: prefix + "/users/{id}", tag: tag, summary: "Update the fields sent, leaving the rest", auth: true, role: models.RoleWriter,
+			params: []apiParam{userIDParam, ifMatchParam}, request: v.update,
+			status: http.StatusOK, data: v.linked(domain.User{}, nil),
+			errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict,
+				http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusPreconditionRequired}},
+		{method: "PATCH", path: prefix + "/users/{id}", tag: tag, summary: "Patch a user with a JSON Merge Patch or a JSON Patch", auth: true, role: models.RoleWriter,
+			params: []apiParam{userIDParam, ifMatchParam}, requests: map[string]any{mergePatchType: v.update, jsonPatchType: []models.JSONPatchOp{}},
+			status: http.StatusOK, data: v.linked(domain.User{}, nil),
+			errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict,
+				http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusPreconditionRequired}},
+		{method: "DELETE", path: prefix + "/users/{id}", tag: tag, summary: "Delete a user", auth: true, role: models.RoleWriter,
+			params: []apiParam{userIDParam},
+			status: http.StatusOK, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+		{method: "GET", path: prefix + "/users/search", tag: tag, summary: "Users matching a query, a page at a time",
+			params: []apiParam{
+				{name: "q", in: "query", schema: &schema{Type: "string"}, required: true,
+					description: `Terms that all have to match, e.g. name~^a age>25 email:@example.com -id=3. ` +
+						`: contains, ~ regular expression, = != < <= > >= compare; quote values with spaces`},
+				queryParam("page", &schema{Type: "integer", Minimum: ptr(1)}, "Page to return, from 1"),
+				queryParam("cursor", &schema{Type: "string"}, "Page by cursor instead: empty for the first page, then meta.next_cursor. In created_at order; not with page or sort"),
+				queryParam("limit", &schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(maxPageSize)}, "Users per page; 20 by default"),
+				queryParam("sort", &schema{Type: "string", Enum: []string{"name", "-name", "age", "-age", "created_at", "-created_at"}}, "Order; - for descending. ID order by default"),
+				ifNoneMatchParam,
+			},
+			status: http.StatusOK, data: resourceList{v.linked(domain.User{}, nil)}, negotiated: true, conditional: true,
+			errors: []int{http.StatusBadRequest, http.StatusNotAcceptable}},
+		{method: "POST", path: prefix + "/users/bulk", tag: tag, summary: "Create many users, with a result for each", auth: true, role: models.RoleWriter,
+			request: sliceOf(v.create),
+			status:  http.StatusMultiStatus, data: []models.BulkResult{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge}},
+		{method: "DELETE", path: prefix + "/users/bulk", tag: tag, summary: "Delete many users by ID, with a result for each", auth: true, role: models.RoleWriter,
+			request: []int{},
+			status:  http.StatusMultiStatus, data: []models.BulkResult{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge}},
+		{method: "GET", path: prefix + "/users/export", tag: tag, summary: "Download every user as CSV or NDJSON, streamed",
+			params: []apiParam{queryParam("format", &schema{Type: "string", Enum: []string{"csv", "ndjson"}}, "csv by default")},
+			status: http.StatusOK, files: []string{csvType, ndjsonType}, errors: []int{http.StatusBadRequest}},
+		{method: "GET", path: prefix + "/users/stream", tag: tag, summary: "Stream made-up users as NDJSON, one a line, to show a streamed response",
+			params: []apiParam{
+				queryParam("count", &schema{Type: "integer", Minimum: ptr(0), Maximum: ptr(maxStreamUsers)}, "How many users; 10000 by default"),
+				queryParam("delay", &schema{Type: "string"}, "A pause after each user, like 10ms, up to 1s; none by default"),
+			},
+			status: http.StatusOK, files: []string{ndjsonType}, errors: []int{http.StatusBadRequest}},
+		{method: "POST", path: prefix + "/users/import", tag: tag, summary: "Create a user from each row of a CSV or NDJSON file, reporting the rows that fail", auth: true, role: models.RoleWriter,
+			requests: map[string]any{csvType: "", ndjsonType: ""},
+			status:   http.StatusOK, data: models.ImportReport{},
+			errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType}},
+		{method: "GET", path: prefix + "/users/suggest", tag: tag, summary: "Users with a name or email starting with prefix",
+			params: []apiParam{
+				{name: "prefix", in: "query", schema: &schema{Type: "string"}, description: "What the user has typed so far", required: true},
+				queryParam("limit", &schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(maxSuggestions)}, "At most this many; 10 by default"),
+			},
+			status: http.StatusOK, data: resourceList{v.linked(domain.User{}, nil)}, errors: []int{http.StatusBadRequest}},
+		{method: "GET", path: prefix + "/users/events", tag: tag,
+			summary: "Stream user.created, user.updated and user.deleted events, each with the user, as Server-Sent Events",
+			status:  http.StatusOK, stream: true},
+	}
+	for i := range ops {
+		ops[i].params = append(ops[i].params, tenantParam)
+		if !slices.Contains(ops[i].errors, http.StatusBadRequest) {
+			ops[i].errors = append(ops[i].errors, http.StatusBadRequest)
+		}
+	}
+	return ops
+}
+
+var (
+	userIDParam          = pathParam("id", &schema{Type: "integer"}, "The user's ID")
+	invitationTokenParam = pathParam("token", &schema{Type: "string"}, "The invitation's token")
+	quotaKeyParam        = pathParam("key", &schema{Type: "string"}, "The API key's ID")
+	apiKeyIDParam        = pathParam("id", &schema{Type: "string"}, "The API key's ID")
+	tenantParam          = headerParam(middleware.TenantHeader, "The tenant whose users these are; the default tenant's without it. 400 if it isn't 1 to 63 letters, digits, - or _")
+	ifNoneMatchParam     = headerParam("If-None-Match", "ETags of copies the client has; 304 Not Modified if one is current")
+	ifMatchParam         = headerParam("If-Match", "Change the user only if this is still its version, as a bare number (409 if it isn't), or its ETag (412 if it isn't). A PUT or PATCH needs this or a version in the body: 428 without")
+)
+
+func ptr(n int) *int { return &n }
+
+// sliceOf is an empty slice of v's type, for a body that's a list of them
+func sliceOf(v any) any {
+	return reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(v)), 0, 0).Interface()
+}
+
+// openAPIDoc and the types below are the parts of OpenAPI 3 the API uses
+type openAPIDoc struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type openAPIOperation struct {
+	Tags        []string                   `json:"tags"`
+	Summary     string                     `json:"summary"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]openAPIMedia `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                   `json:"description"`
+	Headers     map[string]openAPIHeader `json:"headers,omitempty"`
+	Content     map[string]openAPIMedia  `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type openAPIMedia struct {
+	Schema *schema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema           `json:"schemas"`
+	SecuritySchemes map[string]map[string]string `json:"securitySchemes"`
+}
+
+// schema is a JSON Schema, as far as OpenAPI 3.0 and this API need one
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*schema          `json:"allOf,omitempty"`
+}
+
+// schemaRef points at a schema in components
+func schemaRef(name string) *schema {
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schemaGen reflects Go types into schemas, putting each named struct in
+// components once and referring to it everywhere else
+type schemaGen struct {
+	components map[string]*schema
+}
+
+func (g *schemaGen) schemaOf(t reflect.Type) *schema {
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &schema{} // any JSON value
+	case t.Kind() == reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := g.components[t.Name()]; !ok {
+			g.components[t.Name()] = nil // claim the name first, in case t refers to itself
+			g.components[t.Name()] = g.object(t)
+		}
+		return schemaRef(t.Name())
+	case t.Kind() == reflect.Struct:
+		return g.object(t)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		return &schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &schema{Type: "number"}
+	case t.Kind() == reflect.String:
+		return &schema{Type: "string"}
+	default:
+		return &schema{} // interface{}: anything
+	}
+}
+
+// object describes a struct's exported fields by their json names. A
+// field without omitempty is always sent, so it's required. An embedded
+// struct's fields are promoted, as encoding/json promotes them.
+func (g *schemaGen) object(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			embedded := g.object(field.Type)
+			for name, p := range embedded.Properties {
+				s.Properties[name] = p
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = g.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// buildOpenAPI generates the document from apiOperations
+func buildOpenAPI() openAPIDoc {
+	g := &schemaGen{components: map[string]*schema{}}
+	envelope := g.schemaOf(reflect.TypeOf(domain.APIResponse{}))
+	errorSchemas := map[string]openAPIMedia{
+		"application/json": {Schema: g.schemaOf(reflect.TypeOf(domain.ErrorResponse{}))},
+		problemContentType: {Schema: g.schemaOf(reflect.TypeOf(models.Problem{}))},
+	}
+
+	doc := openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   "User Management API",
+			Version: "2.0.0",
+			Description: "Lesson 10's REST API. Users come in two versions: /api/v1 sends a user's name " +
+				"whole, and /api/v2 splits it into first_name and last_name. The unversioned /api/users " +
+				"paths are v1's, and every other path is the same under /api/v1 and /api/v2 as without. " +
+				"Reads are open; creating, updating and deleting users " +
+				"need a token from POST /api/auth/login, a session from logging in with GitHub at " +
+				"/auth/github/login, or a writer API key in X-API-Key, and /api/admin " +
+				"needs an admin API key. A request with an unknown or revoked key gets 401. Errors are " +
+				"domain.ErrorResponse, or RFC 7807 problems with Accept: application/problem+json. Any " +
+				"request with an API key counts against that key's daily quota, and gets 429 once it's " +
+				"used up. Every client, by " +
+				"API key or else IP address, is also rate-limited, and gets 429 with Retry-After when " +
+				"it goes too fast; X-RateLimit-Remaining says how many requests it can still burst. " +
+				"Each tenant named in X-Tenant-ID has its own users, with their own IDs, and a token " +
+				"from logging in under one tenant is refused with another's.",
+		},
+		Paths: map[string]map[string]openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: g.components,
+			SecuritySchemes: map[string]map[string]string{
+				"bearerAuth":  {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKeyAuth":  {"type": "apiKey", "in": "header", "name": APIKeyHeader},
+				"sessionAuth": {"type": "apiKey", "in": "cookie", "name": SessionCookie},
+			},
+		},
+	}
+
+	for _, op := range apiOperations {
+		success := openAPIResponse{Description: http.StatusText(op.status)}
+		switch {
+		case op.html:
+			success.Content = map[string]openAPIMedia{"text/html": {Schema: &schema{Type: "string"}}}
+		case op.stream:
+			success.Content = map[string]openAPIMedia{"text/event-stream": {Schema: &schema{Type: "string"}}}
+		case op.text:
+			success.Content = map[string]openAPIMedia{"text/plain": {Schema: &schema{Type: "string"}}}
+		case op.files != nil:
+			success.Content = map[string]openAPIMedia{}
+			for _, mediaType := range op.files {
+				success.Content[mediaType] = openAPIMedia{Schema: &schema{Type: "string"}}
+			}
+		case op.upgrade:
+			// The messages go over the socket, where OpenAPI can't follow
+		case op.redirect:
+			success.Headers = map[string]openAPIHeader{"Location": {Description: "Where to go next", Schema: &schema{Type: "string"}}}
+		case op.body != nil:
+			success.Content = map[string]openAPIMedia{"application/json": {Schema: g.schemaOf(reflect.TypeOf(op.body))}}
+		case op.data != nil:
+			// The envelope, with data narrowed to what this operation sends
+			narrowed := &schema{Type: "object", Properties: map[string]*schema{"data": g.schemaOf(reflect.TypeOf(op.data))}}
+			success.Content = map[string]openAPIMedia{"application/json": {Schema: &schema{AllOf: []*schema{envelope, narrowed}}}}
+		default:
+			success.Content = map[string]openAPIMedia{"application/json": {Schema: envelope}}
+		}
+		if op.negotiated {
+			for _, f := range formats[1:] {
+				success.Content[f.mediaType] = success.Content["application/json"]
+			}
+		}
+		if op.conditional {
+			success.Headers = map[string]openAPIHeader{
+				"ETag": {Description: "The version of this representation, for If-None-Match and If-Match", Schema: &schema{Type: "string"}},
+			}
+		}
+		operation := openAPIOperation{
+			Tags:        []string{op.tag},
+			Summary:     op.summary,
+			OperationID: operationID(op),
+			Responses:   map[string]openAPIResponse{strconv.Itoa(op.status): success},
+		}
+		if op.conditional {
+			operation.Responses["304"] = openAPIResponse{Description: "The copy If-None-Match named is current; there's no body"}
+		}
+		for _, status := range op.errors {
+			description := http.StatusText(status)
+			if pt, ok := problemCatalog[status]; ok {
+				description = pt.description
+			}
+			operation.Responses[strconv.Itoa(status)] = openAPIResponse{Description: description, Content: errorSchemas}
+		}
+		for _, p := range op.params {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{
+				Name: p.name, In: p.in, Required: p.required || p.in == "path", Description: p.description, Schema: p.schema,
+			})
+		}
+		if op.request != nil {
+			operation.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]openAPIMedia{"application/json": {Schema: g.schemaOf(reflect.TypeOf(op.request))}},
+			}
+		}
+		if op.requests != nil {
+			operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMedia{}}
+			for mediaType, body := range op.requests {
+				operation.RequestBody.Content[mediaType] = openAPIMedia{Schema: g.schemaOf(reflect.TypeOf(body))}
+			}
+		}
+		if op.auth {
+			// A GitHub login's session will do as well as a token
+			operation.Security = append(operation.Security, map[string][]string{"bearerAuth": {}}, map[string][]string{"sessionAuth": {}})
+		}
+		if op.role != "" {
+			// Security entries are alternatives: with auth, a token or a key
+			operation.Security = append(operation.Security, map[string][]string{"apiKeyAuth": {}})
+			for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+				if _, ok := operation.Responses[strconv.Itoa(status)]; !ok {
+					operation.Responses[strconv.Itoa(status)] = openAPIResponse{Description: problemCatalog[status].description, Content: errorSchemas}
+				}
+			}
+		}
+
+		if doc.Paths[op.path] == nil {
+			doc.Paths[op.path] = map[string]openAPIOperation{}
+		}
+		doc.Paths[op.path][strings.ToLower(op.method)] = operation
+	}
+	return doc
+}
+
+// operationID names an operation for code generators, e.g. GET
+// /api/users/{id} is getUsersById
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.method)
+	for _, part := range strings.Split(strings.TrimPrefix(op.path, "/api/"), "/") {
+		if strings.HasPrefix(part, "{") {
+			part = "by_" + strings.Trim(part, "{}")
+		}
+		for _, word := range strings.Split(part, "_") {
+			if word != "" {
+				id += strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+	}
+	return id
+}
+
+// openAPISpec is built once, on first use; nothing it's built from
+// changes while the server runs
+var openAPISpec = sync.OnceValue(buildOpenAPI)
+
+// GET /api/openapi.json, and GET /api
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, openAPISpec())
+}
+
+// GET /api/docs: Swagger UI, reading /api/openapi.json
+func handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "swagger.html", time.Time{}, bytes.NewReader(swaggerUI))
+}
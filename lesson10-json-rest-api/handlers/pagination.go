@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// How many users a page of GET /api/users has by default, and at most
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// userSorts are the orders ?sort= accepts; a leading "-" reverses one.
+// Ties keep ID order, so every page of a sorted list is stable.
+var userSorts = map[string]func(a, b domain.User) bool{
+	"name":       func(a, b domain.User) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"age":        func(a, b domain.User) bool { return a.Age < b.Age },
+	"created_at": func(a, b domain.User) bool { return a.CreatedAt.Before(b.CreatedAt) },
+}
+
+// userQuery is what GET /api/users was asked for:
+//
+//	?page=2&limit=10             the second page of ten
+//	?cursor=&limit=10            the first ten, paged by cursor instead
+//	?cursor=MjAyNC0w...          the page after the one that gave the cursor
+//	?sort=name, ?sort=-age       ordered by a field, "-" for descending
+//	?min_age=30                  users at least 30
+//	?email_contains=example.org  emails containing that, ignoring case
+//
+// Page numbers are offsets, so a user created or deleted on an earlier
+// page shifts every later one: paging along, a client sees a user twice,
+// or never. A cursor names the last user a page had instead, and the next
+// page starts after it, wherever it has moved to. That needs an order in
+// which every user has a fixed place, so cursor pages are always in
+// (created_at, id) order, and can't be sorted.
+type userQuery struct {
+	page, limit   int
+	sort          string // a key of userSorts, or "" for ID order
+	descending    bool
+	minAge        int // -1 for no minimum
+	emailContains string
+
+	byCursor bool       // ?cursor= was sent, even empty
+	cursor   userCursor // zero for the first page
+}
+
+// parseUserQuery reads a userQuery from the query string, or says what's
+// wrong with it
+func parseUserQuery(values url.Values) (userQuery, error) {
+	q := userQuery{page: 1, limit: defaultPageSize, minAge: -1}
+	if values.Has("cursor") {
+		if values.Has("page") || values.Has("sort") {
+			return userQuery{}, errors.New("cursor pages are in created_at order, so cursor can't be used with page or sort")
+		}
+		cursor, err := parseCursor(values.Get("cursor"))
+		if err != nil {
+			return userQuery{}, err
+		}
+		q.byCursor, q.cursor, q.sort = true, cursor, "created_at"
+	}
+	if s := values.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return userQuery{}, errors.New("page must be a number from 1 up")
+		}
+		q.page = n
+	}
+	if s := values.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return userQuery{}, fmt.Errorf("limit must be a number from 1 to %d", maxPageSize)
+		}
+		q.limit = n
+	}
+	if s := values.Get("sort"); s != "" {
+		q.sort, q.descending = strings.CutPrefix(s, "-")
+		if _, ok := userSorts[q.sort]; !ok {
+			return userQuery{}, errors.New("sort must be name, age or created_at, with - in front for descending")
+		}
+	}
+	if s := values.Get("min_age"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < domain.MinAge || n > domain.MaxAge {
+			return userQuery{}, fmt.Errorf("min_age must be a number from %d to %d", domain.MinAge, domain.MaxAge)
+		}
+		q.minAge = n
+	}
+	q.emailContains = strings.ToLower(values.Get("email_contains"))
+	return q, nil
+}
+
+// filter returns the users in list, which is in ID order, that match q's
+// filters, in q's order
+func (q userQuery) filter(list []domain.User) []domain.User {
+	matched := make([]domain.User, 0, len(list))
+	for _, user := range list {
+		if user.Age < q.minAge {
+			continue
+		}
+		if q.emailContains != "" && !strings.Contains(strings.ToLower(user.Email), q.emailContains) {
+			continue
+		}
+		matched = append(matched, user)
+	}
+	if less, ok := userSorts[q.sort]; ok {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if q.descending {
+				return less(matched[j], matched[i])
+			}
+			return less(matched[i], matched[j])
+		})
+	}
+	return matched
+}
+
+// paginate cuts q's page out of matched and describes it, with links to
+// its neighbours in the listing at u. A page past the end is empty, not
+// an error, so a client paging along while users are deleted just finds
+// it has reached the end.
+func (q userQuery) paginate(matched []domain.User, u *url.URL) ([]domain.User, domain.PageMeta) {
+	if q.byCursor {
+		return q.paginateByCursor(matched, u)
+	}
+	meta := domain.PageMeta{
+		Total: len(matched),
+		Page:  q.page,
+		Limit: q.limit,
+		Pages: (len(matched) + q.limit - 1) / q.limit,
+	}
+	if q.page < meta.Pages {
+		meta.Next = pageLink(u, q.page+1)
+	}
+	if q.page > 1 {
+		meta.Prev = pageLink(u, min(q.page-1, max(meta.Pages, 1)))
+	}
+
+	start := min((q.page-1)*q.limit, len(matched))
+	end := min(start+q.limit, len(matched))
+	return matched[start:end], meta
+}
+
+// pageLink is the URL of page of the same listing as u, with every other
+// parameter kept
+func pageLink(u *url.URL, page int) string {
+	values := u.Query()
+	values.Set("page", strconv.Itoa(page))
+	return u.Path + "?" + values.Encode()
+}
+
+// paginateByCursor is paginate for cursor pages: the users after q's
+// cursor in matched, which filter has put in (created_at, id) order. Only
+// the next page is linked; a client going back keeps its own cursors.
+func (q userQuery) paginateByCursor(matched []domain.User, u *url.URL) ([]domain.User, domain.PageMeta) {
+	meta := domain.PageMeta{
+		Total: len(matched),
+		Limit: q.limit,
+		Pages: (len(matched) + q.limit - 1) / q.limit,
+	}
+	start := sort.Search(len(matched), func(i int) bool { return q.cursor.before(matched[i]) })
+	end := min(start+q.limit, len(matched))
+	if end < len(matched) {
+		last := matched[end-1]
+		meta.NextCursor = userCursor{createdAt: last.CreatedAt, id: last.ID}.String()
+		meta.Next = cursorLink(u, meta.NextCursor)
+	}
+	return matched[start:end], meta
+}
+
+// cursorLink is the URL of the cursor page of the same listing as u that
+// starts at cursor, with every other parameter kept
+func cursorLink(u *url.URL, cursor string) string {
+	values := u.Query()
+	values.Set("cursor", cursor)
+	return u.Path + "?" + values.Encode()
+}
+
+// userCursor marks a place in (created_at, id) order: just after the user
+// created then with that ID. Neither changes once a user exists, so the
+// place doesn't move when other users come and go.
+type userCursor struct {
+	createdAt time.Time
+	id        int
+}
+
+// before reports whether user comes after c
+func (c userCursor) before(user domain.User) bool {
+	if !c.createdAt.Equal(user.CreatedAt) {
+		return c.createdAt.Before(user.CreatedAt)
+	}
+	return c.id < user.ID
+}
+
+// String encodes c for a client. The base64 makes it opaque: clients pass
+// it back rather than build their own, so its format can change.
+func (c userCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.createdAt.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(c.id)))
+}
+
+// parseCursor decodes a cursor String made; "" is the start of the list
+func parseCursor(s string) (userCursor, error) {
+	if s == "" {
+		return userCursor{}, nil
+	}
+	invalid := errors.New("cursor isn't one this API gave out; start again with an empty cursor")
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return userCursor{}, invalid
+	}
+	at, id, ok := strings.Cut(string(data), ",")
+	if !ok {
+		return userCursor{}, invalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return userCursor{}, invalid
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 {
+		return userCursor{}, invalid
+	}
+	return userCursor{createdAt: createdAt, id: n}, nil
+}
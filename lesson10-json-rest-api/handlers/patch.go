@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// PATCH changes part of a resource, and RFC 5789 leaves the format of the
+// change to the Content-Type. The API takes the two standard ones:
+//
+//	application/merge-patch+json (RFC 7396): an object with the fields to
+//	set; null removes one. {"age": 31}
+//
+//	application/json-patch+json (RFC 6902): a list of operations, applied
+//	in order, all or nothing. [{"op": "test", "path": "/age", "value": 30},
+//	{"op": "replace", "path": "/age", "value": 31}]
+//
+// Both are applied to the user's JSON, and the result must still be a
+// valid user.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// acceptPatch is the Accept-Patch header (RFC 5789): what PATCH takes
+const acceptPatch = mergePatchType + ", " + jsonPatchType
+
+// readOnlyFields are the fields of a user's JSON a patch may not change
+var readOnlyFields = []string{"id", "created_at", "updated_at", "version"}
+
+// errPatchTestFailed is a JSON Patch "test" operation that didn't match.
+// The patch was fine, but the user isn't what the client thought, so it's
+// 409 Conflict rather than a bad request.
+var errPatchTestFailed = errors.New("test failed")
+
+// PATCH /api/{version}/users/{id}. The document patched is the user as
+// v sends it, so a v2 patch sets /first_name where a v1 patch sets /name.
+func (v *apiVersion) patchUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || contentType != mergePatchType && contentType != jsonPatchType {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		respondWithError(w, r, http.StatusUnsupportedMediaType, "PATCH takes "+mergePatchType+" or "+jsonPatchType)
+		return
+	}
+	body, ok := readBody(w, r, maxBodySize)
+	if !ok {
+		return
+	}
+
+	// Read, check the version, patch and write back under one lock, like
+	// updateUser
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	user, err := db.Get(r.Context(), userID)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	if !v.requireVersion(w, r, user, patchVersion(contentType, body)) {
+		return
+	}
+
+	// Patch one copy of the user's JSON, and keep the other to compare
+	original, err := v.userDocument(user)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	doc := maps.Clone(original)
+	var errs []domain.ValidationError
+	if contentType == mergePatchType {
+		errs, err = applyMergePatch(doc, body)
+	} else {
+		errs, err = applyJSONPatch(doc, body)
+	}
+	switch {
+	case errors.Is(err, errPatchTestFailed):
+		respondWithError(w, r, http.StatusConflict, "Patch not applied: "+err.Error())
+		return
+	case err != nil:
+		respondWithDecodeError(w, r, err)
+		return
+	}
+	if len(errs) == 0 {
+		errs = checkFields(doc, original)
+	}
+	var patched domain.User
+	if len(errs) == 0 {
+		patched, errs = v.userFromDocument(doc)
+	}
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+
+	patched.UpdatedAt = clk.Now()
+	patched.Version = user.Version + 1
+	if err := db.Update(r.Context(), patched); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	suggestions.For(r.Context()).Remove(user)
+	suggestions.For(r.Context()).Add(patched)
+	events.Publish(r.Context(), userUpdated, patched)
+	snapshots.changed()
+
+	v.setUserETag(w, r, patched)
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    v.resource(r, patched),
+		Message: "User updated successfully",
+	})
+}
+
+// userDocument is user's JSON in v as a map, for patching
+func (v *apiVersion) userDocument(user domain.User) (map[string]any, error) {
+	data, err := json.Marshal(v.user(user))
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// checkFields reports the fields of doc a patch may not have touched: a
+// read-only one changed, a required one removed, or one users don't have
+// added. Every user has exactly the fields of the original.
+func checkFields(doc, original map[string]any) []domain.ValidationError {
+	var errs []domain.ValidationError
+	fields := make([]string, 0, len(doc)+len(original))
+	for field := range original {
+		fields = append(fields, field)
+	}
+	for field := range doc {
+		if _, ok := original[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields) // maps have no order, and the errors should
+	for _, field := range fields {
+		value, inDoc := doc[field]
+		_, inOriginal := original[field]
+		switch {
+		case !inOriginal:
+			errs = append(errs, domain.ValidationError{Field: field, Message: "Users have no such field"})
+		case slices.Contains(readOnlyFields, field):
+			if !reflect.DeepEqual(value, original[field]) {
+				errs = append(errs, domain.ValidationError{Field: field, Message: "Read-only; the server sets it"})
+			}
+		case !inDoc:
+			errs = append(errs, domain.ValidationError{Field: field, Message: "Required; it can't be removed"})
+		}
+	}
+	return errs
+}
+
+// userFromDocument turns a patched document back into a user and
+// validates it as if it had been created that way
+func (v *apiVersion) userFromDocument(doc map[string]any) (domain.User, []domain.ValidationError) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return domain.User{}, []domain.ValidationError{{Field: "", Message: err.Error()}}
+	}
+	patched, errs, err := v.decodeUser(data)
+	if err != nil {
+		message, errs := describeDecodeError(err)
+		if errs == nil {
+			errs = []domain.ValidationError{{Field: "", Message: message}}
+		}
+		return domain.User{}, errs
+	}
+	return patched, errs
+}
+
+// applyMergePatch merges an RFC 7396 patch into doc. A user is flat, so
+// each member of the patch sets or, if null, removes one field. The
+// error is for a body that isn't a JSON object.
+func applyMergePatch(doc map[string]any, body []byte) ([]domain.ValidationError, error) {
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return nil, errors.New("a merge patch must be an object")
+	}
+	for field, value := range patch {
+		if value == nil {
+			delete(doc, field)
+		} else {
+			doc[field] = value
+		}
+	}
+	return nil, nil
+}
+
+// applyJSONPatch applies the operations of an RFC 6902 patch to doc in
+// order. The first illegal operation stops it, and since the handler only
+// saves a patch that succeeded, a patch applies entirely or not at all.
+// The error is for a body that isn't a list of operations, or a failed
+// test. Unlike other bodies, operations aren't decoded strictly: RFC 6902
+// says members an operation doesn't define are ignored.
+func applyJSONPatch(doc map[string]any, body []byte) ([]domain.ValidationError, error) {
+	var ops []models.JSONPatchOp
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		invalid := func(format string, args ...any) []domain.ValidationError {
+			return []domain.ValidationError{{
+				Field:   op.Path,
+				Message: fmt.Sprintf("Operation %d (%s): ", i, op.Op) + fmt.Sprintf(format, args...),
+			}}
+		}
+		field, err := pointerField(op.Path)
+		if err != nil {
+			return invalid("%v", err), nil
+		}
+		var value any
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if len(op.Value) == 0 {
+				return invalid("value is required"), nil
+			}
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return invalid("value is not JSON: %v", err), nil
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc[field] = value // adding a member that exists replaces it
+		case "remove", "replace":
+			if _, ok := doc[field]; !ok {
+				return invalid("%s doesn't exist", op.Path), nil
+			}
+			if op.Op == "remove" {
+				delete(doc, field)
+			} else {
+				doc[field] = value
+			}
+		case "move", "copy":
+			from, err := pointerField(op.From)
+			if err != nil {
+				return invalid("from: %v", err), nil
+			}
+			moved, ok := doc[from]
+			if !ok {
+				return invalid("%s doesn't exist", op.From), nil
+			}
+			if op.Op == "move" {
+				delete(doc, from)
+			}
+			doc[field] = moved
+		case "test":
+			if !reflect.DeepEqual(doc[field], value) {
+				return nil, fmt.Errorf("operation %d %w: %s is %s", i, errPatchTestFailed, op.Path, jsonString(doc[field]))
+			}
+		default:
+			return invalid("op must be add, remove, replace, move, copy or test"), nil
+		}
+	}
+	return nil, nil
+}
+
+// pointerField reads an RFC 6901 JSON Pointer to a member of the user.
+// A user is flat, so the pointer has exactly one token.
+func pointerField(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("path %q must start with /", pointer)
+	}
+	token := pointer[1:]
+	if token == "" || strings.Contains(token, "/") {
+		return "", fmt.Errorf("path %q must name one field, like /name", pointer)
+	}
+	// ~1 is an escaped /, and ~0 an escaped ~, in that order
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~"), nil
+}
+
+// jsonString formats a value from a document for an error message
+func jsonString(value any) string {
+	if value == nil {
+		return "missing"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return strconv.Quote(fmt.Sprint(value))
+	}
+	return string(data)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// RFC 7807 defines a standard JSON body for HTTP API errors, so clients
+// can handle errors from any API the same way. The API sends one instead
+// of its own domain.ErrorResponse when the request's Accept header asks
+// for application/problem+json, or for every error with -problems.
+
+// problemContentType is the media type of an RFC 7807 problem
+const problemContentType = "application/problem+json"
+
+// problemsAlways sends every error as a problem, whatever the client
+// asks for; Start sets it
+var problemsAlways = false
+
+// problemType is a catalog entry: what a kind of problem is called, and
+// what it means, for the documentation at its Type URI
+type problemType struct {
+	slug        string
+	title       string
+	status      int
+	description string
+}
+
+// problemTypesPath is where each problem type is documented:
+// /api/problems/not-found and so on, so every Type URI resolves
+const problemTypesPath = "/api/problems/"
+
+// validationFailed is the one problem type with its own extension member
+var validationFailed = problemType{"validation-failed", "Validation failed", http.StatusBadRequest,
+	"The request body was valid JSON, but some fields had bad values; errors lists them"}
+
+// rateLimited is a 429 that isn't about the quota: the client is simply
+// going too fast (see middleware/ratelimit.go)
+var rateLimited = problemType{"rate-limited", "Rate limited", http.StatusTooManyRequests,
+	"The client is sending requests faster than the API allows; Retry-After says when the next one will be accepted"}
+
+// problemCatalog maps each status code the API sends to the kind of
+// problem it means. Every handler already chooses its status code
+// carefully, so the code is enough to pick the type; the handler's
+// message becomes the detail.
+var problemCatalog = map[int]problemType{
+	http.StatusBadRequest:            {"bad-request", "Bad request", http.StatusBadRequest, "The request was malformed: bad JSON, a bad ID, or a bad query parameter or header"},
+	http.StatusUnauthorized:          {"unauthorized", "Unauthorized", http.StatusUnauthorized, "The request needs a valid token, from /api/auth/login in an Authorization: Bearer header, a session from /auth/github/login, or a valid API key in X-API-Key"},
+	http.StatusForbidden:             {"forbidden", "Forbidden", http.StatusForbidden, "The API key works, but its role (reader, writer or admin) doesn't allow this"},
+	http.StatusNotFound:              {"not-found", "Not found", http.StatusNotFound, "Nothing exists at this URL"},
+	http.StatusMethodNotAllowed:      {"method-not-allowed", "Method not allowed", http.StatusMethodNotAllowed, "The URL exists, but doesn't support this method"},
+	http.StatusNotAcceptable:         {"not-acceptable", "Not acceptable", http.StatusNotAcceptable, "The resource isn't available in any format the Accept header allows; the detail lists the ones it is"},
+	http.StatusConflict:              {"conflict", "Conflict", http.StatusConflict, "The request doesn't fit the resource as it is now: it was made to a version someone has changed since, a JSON Patch test failed, or the email is another user's in a store that keeps them unique; fetch it again and retry"},
+	http.StatusPreconditionFailed:    {"precondition-failed", "Precondition failed", http.StatusPreconditionFailed, "If-Match named a version that's no longer current; the ETag header has the current one"},
+	http.StatusPreconditionRequired:  {"precondition-required", "Precondition required", http.StatusPreconditionRequired, "PUT and PATCH must say which version of the resource they change: in If-Match, as a version or an ETag, or as version in the body"},
+	http.StatusGone:                  {"expired", "Expired", http.StatusGone, "It existed, but has expired; ask for a new one"},
+	http.StatusRequestEntityTooLarge: {"too-large", "Request too large", http.StatusRequestEntityTooLarge, "The request body is larger than the endpoint accepts"},
+	http.StatusUnsupportedMediaType:  {"unsupported-media-type", "Unsupported media type", http.StatusUnsupportedMediaType, "The endpoint doesn't take a body of this Content-Type; for PATCH, Accept-Patch lists the ones it does"},
+	http.StatusTooManyRequests:       {"quota-exceeded", "Quota exceeded", http.StatusTooManyRequests, "The API key has used its daily quota; Retry-After says when it resets"},
+	http.StatusInternalServerError:   {"internal", "Internal server error", http.StatusInternalServerError, "Something went wrong on the server; the request may work if retried"},
+}
+
+// problemTypeFor looks slug up in the catalog
+func problemTypeFor(slug string) (problemType, bool) {
+	for _, pt := range []problemType{validationFailed, rateLimited} {
+		if pt.slug == slug {
+			return pt, true
+		}
+	}
+	for _, pt := range problemCatalog {
+		if pt.slug == slug {
+			return pt, true
+		}
+	}
+	return problemType{}, false
+}
+
+func (pt problemType) problem(detail string) models.Problem {
+	return models.Problem{Type: problemTypesPath + pt.slug, Title: pt.title, Status: pt.status, Detail: detail}
+}
+
+// newProblem is the problem for an error with statusCode. A status code
+// missing from the catalog gets type about:blank, which RFC 7807 says
+// means the problem is no more than its status code, so the title is the
+// status text.
+func newProblem(statusCode int, detail string) models.Problem {
+	if pt, ok := problemCatalog[statusCode]; ok {
+		return pt.problem(detail)
+	}
+	return models.Problem{Type: "about:blank", Title: http.StatusText(statusCode), Status: statusCode, Detail: detail}
+}
+
+func newValidationProblem(errors []domain.ValidationError) models.Problem {
+	p := validationFailed.problem("")
+	p.Errors = errors
+	return p
+}
+
+// wantsProblem reports whether r's client should get errors as problems:
+// with -problems, or if its Accept header lists application/problem+json
+// without q=0
+func wantsProblem(r *http.Request) bool {
+	if problemsAlways {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == problemContentType && params["q"] != "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func respondWithProblem(w http.ResponseWriter, r *http.Request, p models.Problem) {
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+// respondWithProblemType sends an error of a type other than its status
+// code's catalog entry, as a problem or a domain.ErrorResponse like
+// respondWithError
+func respondWithProblemType(w http.ResponseWriter, r *http.Request, pt problemType, message string) {
+	if wantsProblem(r) {
+		respondWithProblem(w, r, pt.problem(message))
+		return
+	}
+	respond.Error(w, pt.status, message)
+}
+
+// GET /api/problems/{type} documents a problem type
+func handleProblemType(w http.ResponseWriter, r *http.Request) {
+	pt, ok := problemTypeFor(r.PathValue("type"))
+	if !ok {
+		respondWithError(w, r, http.StatusNotFound, "No such problem type")
+		return
+	}
+	respond.JSON(w, http.StatusOK, models.ProblemTypeDoc{
+		Description: pt.description,
+		Status:      pt.status,
+		Title:       pt.title,
+		Type:        problemTypesPath + pt.slug,
+	})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Routes are Go 1.22 ServeMux patterns: a method, then a path whose
+// {name} wildcards the handler reads with r.PathValue. Before 1.22 a
+// pattern was only a path, or a prefix ending in /, so every handler
+// checked the method itself and cut its IDs out of the path by hand:
+//
+//	// Before: one handler per path, for every method
+//	mux.Handle("/api/users/", requireAuth(http.HandlerFunc(v.handleUser)))
+//
+//	func (v *apiVersion) handleUser(w http.ResponseWriter, r *http.Request) {
+//		// split the path on /, find "users", and parse what follows
+//		userID, err := extractUserID(r.URL.Path)
+//		...
+//		switch r.Method {
+//		case http.MethodGet:
+//			v.getUser(w, r, userID)
+//		case http.MethodPut:
+//			v.updateUser(w, r, userID)
+//		...
+//		default:
+//			respondWithError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+//		}
+//	}
+//
+//	// After: a handler per method, and the ID by name
+//	mux.Handle("GET /api/users/{id}", requireAuth(http.HandlerFunc(v.getUser)))
+//	mux.Handle("PUT /api/users/{id}", requireAuth(http.HandlerFunc(v.updateUser)))
+//	...
+//
+//	func (v *apiVersion) getUser(w http.ResponseWriter, r *http.Request) {
+//		userID, ok := pathUserID(w, r) // r.PathValue("id"), as a number
+//		...
+//	}
+//
+// The mux does the matching now, and more strictly: /api/users/1/extra is
+// a 404 rather than user 1, and /api/users/suggest wins over
+// /api/users/{id} as the more specific pattern, whichever is registered
+// first. GET covers HEAD too.
+//
+// A method a path doesn't have is still a 405, but ServeMux's own is
+// plain text. So routes keeps it the API's JSON error, or problem: for
+// each path registered, it answers the API's other methods itself, with
+// an Allow header of the ones that work.
+
+// apiMethods are the methods the API answers a 405 for itself. Any other,
+// like OPTIONS, gets ServeMux's.
+var apiMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// routes is a ServeMux that remembers the methods registered on each path
+type routes struct {
+	*http.ServeMux
+	methods map[string][]string // by path, like /api/users/{id}
+}
+
+func newRoutes(mux *http.ServeMux) *routes {
+	return &routes{ServeMux: mux, methods: make(map[string][]string)}
+}
+
+// Handle registers handler for pattern, "METHOD /path", or a path alone
+// for every method
+func (rt *routes) Handle(pattern string, handler http.Handler) {
+	rt.ServeMux.Handle(pattern, handler)
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		rt.methods[path] = append(rt.methods[path], method)
+	}
+}
+
+func (rt *routes) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// refuseOtherMethods answers each of apiMethods a path wasn't registered
+// for with a 405. Call it once, after every route is registered.
+func (rt *routes) refuseOtherMethods() {
+	for path, methods := range rt.methods {
+		allow := slices.Clone(methods)
+		if slices.Contains(methods, http.MethodGet) {
+			allow = append(allow, http.MethodHead)
+		}
+		refuse := methodNotAllowed(strings.Join(allow, ", "))
+		for _, method := range apiMethods {
+			if !slices.Contains(methods, method) {
+				rt.ServeMux.Handle(method+" "+path, refuse)
+			}
+		}
+	}
+}
+
+// methodNotAllowed answers a method the path doesn't have
+func methodNotAllowed(allow string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		respondWithError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// GET /api/users/search?q= takes a small query language, for searches the
+// fixed ?min_age and ?email_contains parameters can't express. A query is
+// terms separated by spaces, and a user has to match all of them:
+//
+//	alice                  name or email contains alice
+//	name:alice             name contains alice (: is "contains" for text)
+//	name="Alice Johnson"   name is exactly that; quote values with spaces
+//	name~^a.*n$            name matches a regular expression
+//	age>25 age<=40         comparisons, for numbers (age:30 is age=30)
+//	-email:example.org     a leading - negates a term
+//
+// The fields are id, name, first_name, last_name, email and age, in
+// every version. Text comparisons ignore case. A query that doesn't
+// parse is a 400 saying which term is wrong and why.
+
+// searchOps are the comparisons, two-character ones first so that >=
+// isn't read as > followed by =
+var searchOps = []string{"!=", ">=", "<=", ":", "~", "=", ">", "<"}
+
+// textFields and numberFields are the fields a term can name, and how to
+// read them from a user
+var (
+	textFields = map[string]func(domain.User) string{
+		"name":       func(u domain.User) string { return u.Name },
+		"first_name": func(u domain.User) string { first, _ := models.SplitName(u.Name); return first },
+		"last_name":  func(u domain.User) string { _, last := models.SplitName(u.Name); return last },
+		"email":      func(u domain.User) string { return u.Email },
+	}
+	numberFields = map[string]func(domain.User) int{
+		"id":  func(u domain.User) int { return u.ID },
+		"age": func(u domain.User) int { return u.Age },
+	}
+)
+
+// searchTerm is one parsed term
+type searchTerm struct {
+	field  string // "" for free text, matching name or email
+	op     string // one of searchOps
+	value  string // lower-cased, for text
+	number int    // the value, for a number field
+	re     *regexp.Regexp
+	negate bool
+}
+
+// searchQuery is a parsed query: every term has to match
+type searchQuery []searchTerm
+
+// parseSearch parses q, or says which term is wrong
+func parseSearch(q string) (searchQuery, error) {
+	tokens, err := searchTokens(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("q is required")
+	}
+	query := make(searchQuery, len(tokens))
+	for i, token := range tokens {
+		if query[i], err = parseTerm(token); err != nil {
+			return nil, fmt.Errorf("%s: %w", token, err)
+		}
+	}
+	return query, nil
+}
+
+// searchTokens splits q at spaces outside double quotes, keeping the
+// quotes for parseTerm
+func searchTokens(q string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, c := range q {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			token.WriteRune(c)
+		case unicode.IsSpace(c) && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("%s: unterminated quote", token.String())
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+// parseTerm parses one token. The operator is the first one before any
+// quote, so "a:b" in quotes is free text.
+func parseTerm(token string) (searchTerm, error) {
+	var term searchTerm
+	if len(token) > 1 && token[0] == '-' {
+		term.negate, token = true, token[1:]
+	}
+	head := token
+	if i := strings.IndexByte(token, '"'); i >= 0 {
+		head = token[:i]
+	}
+	opAt, op := -1, ""
+	for _, candidate := range searchOps {
+		if i := strings.Index(head, candidate); i >= 0 && (opAt < 0 || i < opAt) {
+			opAt, op = i, candidate
+		}
+	}
+	if opAt < 0 {
+		// Free text
+		term.op, term.value = ":", strings.ToLower(strings.ReplaceAll(token, `"`, ""))
+		return term, nil
+	}
+
+	term.field, term.op = token[:opAt], op
+	value := strings.ReplaceAll(token[opAt+len(op):], `"`, "")
+	if term.field == "" {
+		return term, fmt.Errorf("missing a field before %s", op)
+	}
+	if value == "" {
+		return term, fmt.Errorf("missing a value after %s", op)
+	}
+	switch {
+	case textFields[term.field] != nil:
+		switch op {
+		case ":", "=", "!=":
+			term.value = strings.ToLower(value)
+		case "~":
+			re, err := regexp.Compile("(?i)" + value)
+			if err != nil {
+				return term, fmt.Errorf("bad pattern: %w", err)
+			}
+			term.re = re
+		default:
+			return term, fmt.Errorf("%s is text; compare it with :, =, != or ~", term.field)
+		}
+	case numberFields[term.field] != nil:
+		if op == "~" {
+			return term, fmt.Errorf("%s is a number; compare it with =, !=, <, <=, > or >=", term.field)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return term, fmt.Errorf("%s is a number, and %s isn't", term.field, value)
+		}
+		term.number = n
+	default:
+		return term, fmt.Errorf("no field %s; search %s", term.field, strings.Join(searchFieldNames(), ", "))
+	}
+	return term, nil
+}
+
+// searchFieldNames are the fields a term can name, sorted
+func searchFieldNames() []string {
+	var names []string
+	for name := range textFields {
+		names = append(names, name)
+	}
+	for name := range numberFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// match reports whether user matches every term of q
+func (q searchQuery) match(user domain.User) bool {
+	for _, term := range q {
+		if term.match(user) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t searchTerm) match(user domain.User) bool {
+	if t.field == "" {
+		return strings.Contains(strings.ToLower(user.Name), t.value) ||
+			strings.Contains(strings.ToLower(user.Email), t.value)
+	}
+	if get := numberFields[t.field]; get != nil {
+		n := get(user)
+		switch t.op {
+		case ":", "=":
+			return n == t.number
+		case "!=":
+			return n != t.number
+		case ">":
+			return n > t.number
+		case ">=":
+			return n >= t.number
+		case "<":
+			return n < t.number
+		default: // <=
+			return n <= t.number
+		}
+	}
+	s := textFields[t.field](user)
+	switch t.op {
+	case "~":
+		return t.re.MatchString(s)
+	case "=":
+		return strings.ToLower(s) == t.value
+	case "!=":
+		return strings.ToLower(s) != t.value
+	default: // :
+		return strings.Contains(strings.ToLower(s), t.value)
+	}
+}
+
+// GET /api/{version}/users/search?q=age>25 name~^a, paged and sorted
+// like GET /api/{version}/users
+func (v *apiVersion) handleSearch(w http.ResponseWriter, r *http.Request) {
+	search, err := parseSearch(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, err := parseUserQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userList, err := db.List(r.Context())
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	matched := make([]domain.User, 0, len(userList))
+	for _, user := range userList {
+		if search.match(user) {
+			matched = append(matched, user)
+		}
+	}
+	page, meta := query.paginate(query.filter(matched), r.URL)
+
+	respondNegotiated(w, r, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    v.resources(r, page),
+		Message: fmt.Sprintf("Found %d users", meta.Total),
+		Meta:    &meta,
+		Links:   v.pageLinks(r, meta),
+	})
+}
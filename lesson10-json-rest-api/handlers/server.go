@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/fixtures"
+	"golang-lab/lab/httpmw"
+	"golang-lab/lab/smoke"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+var (
+	// db is where users are kept: a map unless -storage says otherwise
+	db store.UserStore = store.NewMemory()
+	// storeMu keeps the suggestions index in step with store. Handlers
+	// that change a user hold it for writing across the store call and
+	// the index update, and readers of both hold it for reading.
+	storeMu sync.RWMutex
+	// snapshots saves the store to a file if -data is set; nil otherwise
+	snapshots *snapshotter
+	// clk is where the lesson gets the time; tests can swap in a clock.Fake
+	clk clock.Clock = clock.Real{}
+	// logBodies logs every request's and response's body; Start sets it
+	logBodies = false
+	// corsOrigins are the origins browsers may call from, or any if
+	// empty; Start sets it
+	corsOrigins []string
+)
+
+// NewServer returns the API server with its routes and middleware, ready
+// to Serve on a listener from Listen
+func NewServer() *http.Server {
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	
+	// Apply middleware from lab/httpmw
+	chain := []httpmw.Middleware{
+		httpmw.CORS(httpmw.CORSOptions{AllowedOrigins: corsOrigins}),
+		httpmw.RequestID(),
+		httpmw.Logging(nil),
+	}
+	if logBodies {
+		// An issued API key's secret is its "key"
+		redact := append(slices.Clone(httpmw.DefaultRedact), "key")
+		chain = append(chain, httpmw.BodyLog(httpmw.BodyLogOptions{Redact: redact}))
+	}
+	handler := httpmw.Chain(mux, append(chain,
+		middleware.Timing(metrics, clk),
+		middleware.Tenant(respondInvalidTenant),
+		apiKeyMiddleware, // before the limits, so they count keys that exist
+		// The rate limit before the quota, so a rejected request uses none of it
+		middleware.RateLimit(limiter, clk, rateLimitKey, respondRateLimited),
+		middleware.Quota(quotas, clk, quotaKey, respondQuotaExceeded),
+		httpmw.Recover(nil),
+	)...)
+	server := &http.Server{Handler: handler}
+	// Shutdown would wait for event streams, which never end by
+	// themselves, until it timed out; end them instead
+	server.RegisterOnShutdown(events.CloseAll)
+	return server
+}
+
+// smokeToken signs a token for the first user, for -ci's writes
+func smokeToken() (string, error) {
+	list, err := db.List(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("signing a token for the smoke test: %w", err)
+	}
+	if len(list) == 0 {
+		return "", errors.New("signing a token for the smoke test: there are no users to sign in as")
+	}
+	return signToken(newClaims(list[0], clk.Now()), jwtSecret)
+}
+
+// smokeAdminKey issues an admin API key for -ci's admin requests
+func smokeAdminKey() (string, error) {
+	secret, _, err := issueKey(context.Background(), "smoke test", models.RoleAdmin)
+	if err != nil {
+		return "", fmt.Errorf("issuing an API key for the smoke test: %w", err)
+	}
+	return secret, nil
+}
+
+// smokeSteps are the requests -ci sends: the curl examples Run prints and the
+// ways they can fail, in an order where each builds on the last. Writes
+// send token, and admin requests send adminKey.
+func smokeSteps(token, adminKey string) []smoke.Step {
+	auth := map[string]string{"Authorization": "Bearer " + token}
+	admin := map[string]string{APIKeyHeader: adminKey}
+	return []smoke.Step{
+		{Method: "GET", Path: "/api/health", Want: http.StatusOK},
+		{Method: "GET", Path: "/healthz", Want: http.StatusOK},
+		{Method: "GET", Path: "/readyz", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users?page=2&limit=3&sort=-age&min_age=30", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users?sort=password", Want: http.StatusBadRequest},
+		{Method: "GET", Path: "/api/v1/users/1", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/99", Want: http.StatusNotFound},
+		{Method: "GET", Path: "/api/v1/users/1", Header: map[string]string{"Accept": "application/xml"}, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users?limit=2", Header: map[string]string{"Accept": "application/yaml"}, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/1", Header: map[string]string{"Accept": "text/csv"}, Want: http.StatusNotAcceptable},
+		{Method: "GET", Path: "/api/problems/not-found", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/openapi.json", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/docs", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/suggest?prefix=a&limit=3", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/suggest", Want: http.StatusBadRequest},
+		{Method: "GET", Path: "/api/v1/users/search?q=" + url.QueryEscape("name~^j age>25 email:@example.com"), Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/search?q=" + url.QueryEscape("password:x"), Want: http.StatusBadRequest},
+		{Method: "GET", Path: "/api/v1/users/stream?count=500", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v2/users/stream?count=10", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/stream?count=-1", Want: http.StatusBadRequest},
+		{Method: "POST", Path: "/api/auth/login", Body: `{"email":"john@example.com","password":"wrong"}`, ContentType: "application/json", Want: http.StatusUnauthorized},
+		{Method: "POST", Path: "/api/v1/users", Body: `{"name":"Alice","email":"alice@example.com","age":30}`, ContentType: "application/json", Want: http.StatusUnauthorized},
+		{Method: "POST", Path: "/api/v1/users", Body: `{"name":"Alice","email":"alice@example.com","age":30}`, ContentType: "application/json", Header: auth, Want: http.StatusCreated},
+		{Method: "POST", Path: "/api/v1/users", Body: `{"name":"","email":"alice","age":200}`, ContentType: "application/json", Header: auth, Want: http.StatusBadRequest},
+		{Method: "PUT", Path: "/api/v1/users/11", Body: `{"email":"alice@example.org","version":1}`, ContentType: "application/json", Header: auth, Want: http.StatusOK},
+		{Method: "PUT", Path: "/api/v1/users/11", Body: `{"age":31,"version":1}`, ContentType: "application/json", Header: auth, Want: http.StatusConflict},
+		{Method: "PUT", Path: "/api/v1/users/11", Body: `{"age":31}`, ContentType: "application/json", Header: auth, Want: http.StatusPreconditionRequired},
+		{Method: "PUT", Path: "/api/v1/users/11", Body: `{"age":31}`, ContentType: "application/json",
+			Header: map[string]string{"Authorization": auth["Authorization"], "If-Match": `"stale"`}, Want: http.StatusPreconditionFailed},
+		{Method: "PATCH", Path: "/api/v1/users/11", Body: `{"age":31}`, ContentType: "application/merge-patch+json",
+			Header: map[string]string{"Authorization": auth["Authorization"], "If-Match": "2"}, Want: http.StatusOK},
+		{Method: "PATCH", Path: "/api/v1/users/11", Body: `[{"op":"test","path":"/version","value":3},{"op":"test","path":"/age","value":30},{"op":"replace","path":"/age","value":32}]`, ContentType: "application/json-patch+json", Header: auth, Want: http.StatusConflict},
+		{Method: "PATCH", Path: "/api/v1/users/11", Body: `[{"op":"test","path":"/version","value":3},{"op":"remove","path":"/email"}]`, ContentType: "application/json-patch+json", Header: auth, Want: http.StatusBadRequest},
+		{Method: "PATCH", Path: "/api/v1/users/11", Body: `{"age":31}`, ContentType: "application/json", Header: auth, Want: http.StatusUnsupportedMediaType},
+		{Method: "DELETE", Path: "/api/v1/users/11", Header: auth, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/11", Want: http.StatusNotFound},
+		{Method: "POST", Path: "/api/v1/users/bulk", Body: `[{"name":"Bea","email":"bea@example.com","age":41},{"name":"","email":"cal","age":30}]`, ContentType: "application/json", Header: auth, Want: http.StatusMultiStatus},
+		{Method: "POST", Path: "/api/v1/users/bulk", Body: `{"name":"Bea"}`, ContentType: "application/json", Header: auth, Want: http.StatusBadRequest},
+		{Method: "DELETE", Path: "/api/v1/users/bulk", Body: `[12, 99]`, ContentType: "application/json", Header: auth, Want: http.StatusMultiStatus},
+		{Method: "GET", Path: "/api/v2/users?limit=3", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v2/users/1", Want: http.StatusOK},
+		{Method: "POST", Path: "/api/v2/users", Body: `{"first_name":"Alice","last_name":"Smith","email":"alice@example.com","age":30}`, ContentType: "application/json", Header: auth, Want: http.StatusCreated},
+		{Method: "POST", Path: "/api/v2/users", Body: `{"name":"Alice Smith","email":"alice@example.com","age":30}`, ContentType: "application/json", Header: auth, Want: http.StatusBadRequest},
+		{Method: "PUT", Path: "/api/v2/users/13", Body: `{"last_name":"Jones","version":1}`, ContentType: "application/json", Header: auth, Want: http.StatusOK},
+		{Method: "PATCH", Path: "/api/v2/users/13", Body: `{"first_name":"Alicia","version":2}`, ContentType: "application/merge-patch+json", Header: auth, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/13", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v2/users/suggest?prefix=jon", Want: http.StatusOK},
+		{Method: "DELETE", Path: "/api/v2/users/13", Header: auth, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/auth/me", Header: auth, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users", Header: map[string]string{middleware.TenantHeader: "acme"}, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users/1", Header: map[string]string{middleware.TenantHeader: "acme"}, Want: http.StatusNotFound},
+		{Method: "POST", Path: "/api/v1/users", Body: `{"name":"Ann","email":"ann@acme.example","age":30}`, ContentType: "application/json",
+			Header: map[string]string{middleware.TenantHeader: "acme", "Authorization": auth["Authorization"]}, Want: http.StatusUnauthorized},
+		{Method: "POST", Path: "/api/v1/users", Body: `{"name":"Ann","email":"ann@acme.example","age":30}`, ContentType: "application/json",
+			Header: map[string]string{middleware.TenantHeader: "acme", APIKeyHeader: adminKey}, Want: http.StatusCreated},
+		{Method: "GET", Path: "/api/v1/users/1", Header: map[string]string{middleware.TenantHeader: "acme"}, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/v1/users", Header: map[string]string{middleware.TenantHeader: "not a tenant"}, Want: http.StatusBadRequest},
+		{Method: "POST", Path: "/graphql", Body: `{"query":"{ user(id: 1) { name email } users(limit: 2) { total users { id } } }"}`, ContentType: "application/json", Want: http.StatusOK},
+		{Method: "POST", Path: "/graphql", Body: `{"query":"mutation { createUser(name: \"Dee\", email: \"dee@example.com\", age: 28) { id } }"}`, ContentType: "application/json", Want: http.StatusUnauthorized},
+		{Method: "GET", Path: "/graphql?query=" + url.QueryEscape("{ user(id: 2) { firstName lastName } }"), Want: http.StatusOK},
+		{Method: "GET", Path: "/auth/github/login", Want: http.StatusNotFound},
+		{Method: "POST", Path: "/auth/github/logout", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/jobs", Want: http.StatusOK},
+		{Method: "POST", Path: "/api/invitations", Body: `{"email":"bob@example.com","ttl":"24h"}`, ContentType: "application/json", Header: auth, Want: http.StatusCreated},
+		{Method: "POST", Path: "/api/invitations", Body: `{"email":"bob@example.com","ttl":"24h"}`, ContentType: "application/json", Want: http.StatusUnauthorized},
+		{Method: "POST", Path: "/api/invitations", Body: `{"email":"bob","ttl":"-1h"}`, ContentType: "application/json", Header: auth, Want: http.StatusBadRequest},
+		{Method: "DELETE", Path: "/api/invitations/nosuchtoken", Want: http.StatusUnauthorized},
+		{Method: "GET", Path: "/api/invitations?expires_within=48h", Want: http.StatusUnauthorized},
+		{Method: "GET", Path: "/api/invitations?expires_within=48h", Header: auth, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/invitations/nosuchtoken", Want: http.StatusNotFound},
+		{Method: "GET", Path: "/api/admin/export", Header: admin, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/admin/export", Want: http.StatusUnauthorized},
+		{Method: "GET", Path: "/api/admin/metrics", Header: admin, Want: http.StatusOK},
+		{Method: "GET", Path: "/api/admin/stats", Want: http.StatusUnauthorized},
+		{Method: "GET", Path: "/api/admin/stats", Header: admin, Want: http.StatusNotFound},
+		{Method: "GET", Path: "/metrics", Want: http.StatusOK},
+		{Method: "GET", Path: "/api/admin/quotas", Header: admin, Want: http.StatusOK},
+		{Method: "DELETE", Path: "/api/admin/quotas/nosuchkey", Header: admin, Want: http.StatusNotFound},
+		{Method: "POST", Path: "/api/admin/import", Header: admin, Body: `{"version":99,"users":[]}`, ContentType: "application/json", Want: http.StatusBadRequest},
+		{Method: "POST", Path: "/api/admin/keys", Header: admin, Body: `{"name":"ci","role":"reader"}`, ContentType: "application/json", Want: http.StatusCreated},
+		{Method: "POST", Path: "/api/admin/keys", Header: admin, Body: `{"name":"ci","role":"root"}`, ContentType: "application/json", Want: http.StatusBadRequest},
+		{Method: "GET", Path: "/api/admin/keys", Header: admin, Want: http.StatusOK},
+		{Method: "DELETE", Path: "/api/admin/keys/nosuchkey", Header: admin, Want: http.StatusNotFound},
+		{Method: "GET", Path: "/api/admin/keys", Header: map[string]string{APIKeyHeader: "golab_nosuchkey"}, Want: http.StatusUnauthorized},
+	}
+}
+
+// initializeData seeds the store with lab/fixtures' sample users, the
+// same ones on every run
+func initializeData() {
+	if err := restoreUsers(context.Background(), fixtures.Users(fixtures.Small)); err != nil {
+		log.Fatalf("Failed to seed users: %v", err)
+	}
+}
+
+func registerAPIRoutes(serveMux *http.ServeMux) {
+	// Each route is a method and a path (see routes.go)
+	mux := newRoutes(serveMux)
+	
+	// User routes in each version (see versions.go); changing users needs
+	// a token
+	for _, v := range apiVersions {
+		registerUserRoutes(mux, "/api/"+v.name, v)
+	}
+	// The unversioned paths, from before there were versions, are v1's
+	registerUserRoutes(mux, "/api", v1)
+	
+	// Logging in, and who a token belongs to
+	mux.HandleFunc("POST /api/auth/login", handleLogin)
+	mux.Handle("GET /api/auth/me", requireAuth(http.HandlerFunc(handleMe)))
+	
+	// Logging in with GitHub instead, for a session cookie (see github.go)
+	mux.HandleFunc("GET /auth/github/login", handleGitHubLogin)
+	mux.HandleFunc("GET /auth/github/callback", handleGitHubCallback)
+	mux.HandleFunc("POST /auth/github/logout", handleGitHubLogout)
+	
+	// Invitations, which expire; listing, making or revoking them needs a
+	// token, since a list hands out every token
+	mux.Handle("GET /api/invitations", requireAuth(http.HandlerFunc(listInvitations)))
+	mux.Handle("POST /api/invitations", requireAuth(http.HandlerFunc(createInvitation)))
+	mux.HandleFunc("GET /api/invitations/{token}", getInvitation)
+	mux.Handle("DELETE /api/invitations/{token}", requireAuth(http.HandlerFunc(deleteInvitation)))
+	
+	// The same users as GraphQL: queries, mutations, and subscriptions as
+	// Server-Sent Events (see graphql.go)
+	mux.HandleFunc("GET /graphql", handleGraphQL)
+	mux.HandleFunc("POST /graphql", handleGraphQL)
+	
+	// Changes to users, live over a WebSocket
+	mux.HandleFunc("GET /api/ws", handleWebSocket)
+	
+	// Background jobs: welcome emails, pending, done and dead
+	mux.HandleFunc("GET /api/jobs", handleJobs)
+	
+	// Everything under /api/admin needs an admin API key
+	admin := func(handler http.HandlerFunc) http.Handler { return requireRole(models.RoleAdmin, handler) }
+	
+	// Backup and restore
+	mux.Handle("GET /api/admin/export", admin(handleExport))
+	mux.Handle("POST /api/admin/import", admin(handleImport))
+	
+	// Per-route latency and error counts
+	mux.Handle("GET /api/admin/metrics", admin(handleMetrics))
+	
+	// How many users there are, and how old, from MongoDB's aggregation
+	// pipeline (see stats.go); 404 with any other store
+	mux.Handle("GET /api/admin/stats", admin(handleStats))
+	
+	// Per-key daily quotas; DELETE resets one
+	mux.Handle("GET /api/admin/quotas", admin(handleQuotas))
+	mux.Handle("GET /api/admin/quotas/{key}", admin(getQuota))
+	mux.Handle("DELETE /api/admin/quotas/{key}", admin(resetQuota))
+	
+	// Issuing and revoking API keys
+	mux.Handle("GET /api/admin/keys", admin(listKeys))
+	mux.Handle("POST /api/admin/keys", admin(createKey))
+	mux.Handle("GET /api/admin/keys/{id}", admin(getKey))
+	mux.Handle("DELETE /api/admin/keys/{id}", admin(revokeKey))
+	
+	// Documentation for each RFC 7807 problem type
+	mux.HandleFunc("GET "+problemTypesPath+"{type}", handleProblemType)
+	
+	// Health checks: the original, and liveness and readiness probes
+	// where orchestrators look for them (see health.go)
+	mux.HandleFunc("GET /api/health", handleHealth)
+	mux.HandleFunc("GET /healthz", handleLiveness)
+	mux.HandleFunc("GET /readyz", handleReadiness)
+	
+	// The same metrics for Prometheus to scrape; where it looks by default,
+	// and open, as scrapers rarely send credentials
+	mux.HandleFunc("GET /metrics", handlePrometheus)
+	
+	// API documentation: the OpenAPI document, and Swagger UI to read it
+	mux.HandleFunc("GET /api", handleOpenAPI)
+	mux.HandleFunc("GET "+openAPIPath, handleOpenAPI)
+	mux.HandleFunc("GET /api/docs", handleSwaggerUI)
+	
+	// Everything but users is the same in every version
+	for _, v := range apiVersions {
+		mux.Handle("/api/"+v.name+"/", unversioned(mux, "/api/"+v.name))
+	}
+	mux.refuseOtherMethods()
+}
+
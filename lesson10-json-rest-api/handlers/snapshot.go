@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// snapshotDelay is how long the snapshotter waits after a change before
+// writing, so a burst of requests costs one write instead of one each
+const snapshotDelay = time.Second
+
+// snapshotter keeps a JSON file in step with the in-memory store. Handlers
+// call changed after every write; a goroutine waits out the delay and
+// saves the whole store, in the same format as GET /api/admin/export.
+//
+// Its methods do nothing on a nil *snapshotter, so handlers can call
+// snapshots.changed() whether or not -data was given.
+type snapshotter struct {
+	path    string
+	delay   time.Duration
+	dirty   chan struct{} // holds a token while there are unsaved changes
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// loadSnapshot restores the store from path. A missing file isn't an
+// error: it reports false, and the caller seeds the store instead.
+func loadSnapshot(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var backup domain.Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if problems := backup.Validate(); len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for i, problem := range problems {
+			errs[i] = problem
+		}
+		return false, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+	if err := restoreUsers(context.Background(), backup.Users); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// startSnapshots starts saving the store to path delay after each change
+func startSnapshots(path string, delay time.Duration) *snapshotter {
+	s := &snapshotter{
+		path:    path,
+		delay:   delay,
+		dirty:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// changed marks the store as having unsaved changes. It never blocks: if
+// a save is already pending, this change will be in it.
+func (s *snapshotter) changed() {
+	if s == nil {
+		return
+	}
+	select {
+	case s.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (s *snapshotter) run() {
+	defer close(s.stopped)
+	for {
+		select {
+		case <-s.dirty:
+		case <-s.done:
+			return
+		}
+		// Let more changes pile up before writing; Close cuts the wait
+		// short and writes itself
+		select {
+		case <-clk.After(s.delay):
+		case <-s.done:
+			return
+		}
+		// This write includes anything that changed during the wait
+		select {
+		case <-s.dirty:
+		default:
+		}
+		if err := s.write(); err != nil {
+			log.Printf("Error saving snapshot: %v", err)
+		}
+	}
+}
+
+// Close stops the background writer and saves the store one last time,
+// so nothing changed during the delay is lost on shutdown
+func (s *snapshotter) Close() error {
+	if s == nil {
+		return nil
+	}
+	close(s.done)
+	<-s.stopped
+	return s.write()
+}
+
+// write saves the store to a temporary file and renames it over the
+// snapshot, so a crash mid-write leaves the previous snapshot intact
+func (s *snapshotter) write() error {
+	backup, err := backupUsers(context.Background())
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	_, err = tmp.Write(append(data, '\n'))
+	if err := errors.Join(err, tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
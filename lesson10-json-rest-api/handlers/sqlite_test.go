@@ -0,0 +1,35 @@
+//go:build sqlite
+
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang-lab/lab/golden"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// These tests need the SQLite driver: go test -tags sqlite
+
+func openTestSQLite(t *testing.T, path string) *store.SQLite {
+	t.Helper()
+	s, err := store.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+// TestAPIWithSQLite runs TestAPI's script against SQLite: the handlers
+// only see a UserStore, so every response is the same
+func TestAPIWithSQLite(t *testing.T) {
+	db = openTestSQLite(t, filepath.Join(t.TempDir(), "users.db"))
+	t.Cleanup(func() { db = store.NewMemory() })
+	golden.Check(t, "api.golden", apiTranscript(t))
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/smoke"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// Config is how Start sets the API up; Run fills it in from its flags
+type Config struct {
+	// Store is where users and API keys are kept
+	Store store.UserStore
+	// DataFile keeps the memory store's users in a JSON file: loaded on
+	// Start, and saved after changes. Empty keeps them in memory only.
+	DataFile string
+	// Quota is how many requests each API key may make per day
+	Quota int
+	// Rate and Burst are each client's rate limit: requests per second,
+	// after a burst of up to Burst at once
+	Rate  float64
+	Burst int
+	// JWTSecret signs login tokens; nil picks a random one each start, so
+	// old tokens stop working
+	JWTSecret []byte
+	// TokenTTL is how long a login token is good for
+	TokenTTL time.Duration
+	// Password is the one every user logs in with
+	Password string
+	// Problems sends every error as application/problem+json, not just
+	// to clients that ask
+	Problems bool
+	// LogBodies logs the body of every request and response, with
+	// passwords, tokens and keys blanked out (see httpmw.BodyLog)
+	LogBodies bool
+	// Clock is where the API gets the time
+	Clock clock.Clock
+	// Checks are what GET /readyz checks besides the store, and the data
+	// file's directory if there is one
+	Checks []Check
+	// CacheSize is how many users GET /api/users/{id} keeps in memory in
+	// front of Store, each for CacheTTL (see store.Cached); 0 turns the
+	// cache off
+	CacheSize int
+	CacheTTL  time.Duration
+	// Mailer sends the welcome emails new users get, from Workers
+	// goroutines in the background (see jobs.go). A failed email is tried
+	// up to JobAttempts times in all, JobBackoff after the first failure
+	// and twice as long after each one since.
+	Mailer      Mailer
+	Workers     int
+	JobAttempts int
+	JobBackoff  time.Duration
+	// CORSOrigins are the origins browsers may call the API from, like
+	// "https://app.example.com"; empty allows any (see httpmw.CORS)
+	CORSOrigins []string
+	// GitHub lets people log in with their GitHub accounts, for a session
+	// that can change users as a token can (see github.go); without a
+	// ClientID, /auth/github answers 404
+	GitHub GitHubConfig
+}
+
+// DefaultConfig is the API as it runs without flags: users in memory,
+// and the default limits
+func DefaultConfig() Config {
+	return Config{
+		Store:    store.NewMemory(),
+		Quota:    middleware.DefaultDailyQuota,
+		Rate:     middleware.DefaultRate,
+		Burst:    middleware.DefaultBurst,
+		TokenTTL: time.Hour,
+		Password: "golab",
+		Clock:    clock.Real{},
+
+		CacheSize: 1000,
+		CacheTTL:  time.Minute,
+
+		Mailer:      LogMailer{},
+		Workers:     DefaultWorkers,
+		JobAttempts: DefaultJobAttempts,
+		JobBackoff:  DefaultJobBackoff,
+	}
+}
+
+// tenantStore keeps the default tenant's users in base, and every other
+// tenant's in memory: the server's store, or -data's file, only ever has
+// the default tenant's, and the others are gone when the server stops
+func tenantStore(base store.UserStore) *store.Tenanted {
+	return store.NewTenanted(base, middleware.TenantFrom, func(string) store.UserStore { return store.NewMemory() })
+}
+
+// Start sets the API up from cfg, then loads the saved users if there are
+// any, or else the samples. It starts the background work too: deleting
+// expired invitations, forgetting idle rate limit buckets, passing
+// changes on to WebSocket clients, and the workers that send emails.
+// stop ends it and saves the users one last time; call it once every
+// request has finished. Closing cfg.Store is up to the caller.
+func Start(cfg Config) (stop func() error, err error) {
+	_, memory := cfg.Store.(*store.Memory)
+	switch {
+	case cfg.Quota <= 0:
+		return nil, errors.New("the quota must be positive")
+	case cfg.Rate <= 0 || cfg.Burst <= 0:
+		return nil, errors.New("the rate and burst must be positive")
+	case cfg.TokenTTL <= 0:
+		return nil, errors.New("the token TTL must be positive")
+	case cfg.CacheSize < 0 || cfg.CacheTTL < 0:
+		return nil, errors.New("the cache size and TTL can't be negative")
+	case cfg.Mailer == nil:
+		return nil, errors.New("a mailer is needed for welcome emails")
+	case cfg.Workers <= 0 || cfg.JobAttempts <= 0 || cfg.JobBackoff <= 0:
+		return nil, errors.New("the workers, job attempts and job backoff must be positive")
+	case cfg.GitHub.ClientID != "" && cfg.GitHub.ClientSecret == "":
+		return nil, errors.New("GitHub login needs the OAuth app's client secret as well as its ID")
+	case cfg.DataFile != "" && !memory:
+		return nil, errors.New("a data file saves the memory store; SQLite and MongoDB save their own users")
+	}
+
+	clk = cfg.Clock
+	base := cfg.Store
+	if cfg.CacheSize > 0 {
+		base = store.NewCached(cfg.Store, cfg.CacheSize, cfg.CacheTTL, clk)
+	}
+	db = tenantStore(base)
+	quotas = middleware.NewQuotas(cfg.Quota)
+	limiter = middleware.NewRateLimiter(cfg.Rate, cfg.Burst)
+	if cfg.JWTSecret != nil {
+		jwtSecret = cfg.JWTSecret
+	}
+	tokenTTL = cfg.TokenTTL
+	loginPassword = cfg.Password
+	problemsAlways = cfg.Problems
+	logBodies = cfg.LogBodies
+	corsOrigins = cfg.CORSOrigins
+	github = newGitHubLogin(cfg.GitHub)
+	statsStore, _ = cfg.Store.(store.StatsStore)
+	startedAt = clk.Now()
+	readyChecks = []Check{storeCheck}
+	if cfg.DataFile != "" {
+		readyChecks = append(readyChecks, DiskCheck(filepath.Dir(cfg.DataFile)))
+	}
+	readyChecks = append(readyChecks, cfg.Checks...)
+
+	loaded, err := indexStore()
+	if err != nil {
+		return nil, fmt.Errorf("loading users: %w", err)
+	}
+	if cfg.DataFile != "" {
+		if loaded, err = loadSnapshot(cfg.DataFile); err != nil {
+			return nil, fmt.Errorf("loading users: %w", err)
+		}
+		snapshots = startSnapshots(cfg.DataFile, snapshotDelay)
+	}
+	if !loaded {
+		initializeData()
+		snapshots.changed() // save the samples too
+	}
+
+	stopSweeper := startSweeper(invitations, sweepInterval)
+	stopEvictor := middleware.StartEvictor(limiter, clk, middleware.EvictInterval)
+	// Shutdown doesn't wait for hijacked connections, so the hub says
+	// goodbye to WebSocket clients itself
+	stopHub := startHub(hub)
+	jobs = newJobQueue(welcomeJob(cfg.Mailer), cfg.JobAttempts, cfg.JobBackoff)
+	stopJobs := jobs.start(cfg.Workers)
+	return func() error {
+		stopSweeper()
+		stopEvictor()
+		stopHub()
+		stopJobs()
+		return snapshots.Close()
+	}, nil
+}
+
+// Smoke sends a request to every endpoint through handler, checking the
+// status of each, and reports them to w. It signs in as the first user
+// for the writes, and issues itself an admin key for /api/admin.
+func Smoke(w io.Writer, handler http.Handler) error {
+	token, err := smokeToken()
+	if err != nil {
+		return err
+	}
+	adminKey, err := smokeAdminKey()
+	if err != nil {
+		return err
+	}
+	return smoke.Run(w, handler, smokeSteps(token, adminKey))
+}
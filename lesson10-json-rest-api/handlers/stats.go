@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// statsStore works out GET /api/admin/stats: the server's store, if it
+// can (see store.StatsStore), or nil. Start sets it.
+var statsStore store.StatsStore
+
+// GET /api/admin/stats
+//
+// Only a store that can aggregate users itself answers; with the others
+// this would mean reading every user on each request. The stats are the
+// default tenant's users, the only ones the server's store keeps.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if statsStore == nil {
+		respondWithError(w, r, http.StatusNotFound, "User stats need a store that works them out itself: start the server with -storage mongo")
+		return
+	}
+	if middleware.TenantFrom(r.Context()) != store.DefaultTenant {
+		respondWithError(w, r, http.StatusNotFound, "User stats are only kept for the default tenant")
+		return
+	}
+	stats, err := statsStore.Stats(r.Context())
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/fixtures"
+)
+
+// GET /api/users/stream sends a result set too large to build in memory
+// and send as one JSON array: a million users, made up as they're sent
+// (see fixtures.EachUser), so the store needn't hold them. Each goes out
+// as a line of NDJSON as soon as it's encoded:
+//
+//	curl -N "http://localhost:8080/api/v1/users/stream?count=1000000" | head -3
+//
+//	{"id":1,"name":"John Doe","email":"john@example.com",...}
+//	{"id":2,"name":"Jane Smith",...}
+//
+// Three things make it a stream rather than a big response:
+//
+//   - Flushing. A ResponseWriter buffers what's written, and sends it when
+//     the buffer fills, 4 KB at a time. Flushing every streamFlushEvery
+//     users sends them sooner, so a client sees the first at once, and
+//     every one before a pause (?delay=) rather than after it.
+//   - Backpressure. Writing to a client that reads slowly blocks once the
+//     connection's buffers are full, so the handler only makes users as
+//     fast as the client takes them, and memory stays at one user however
+//     slow the client is, where building the whole array first would hold
+//     every user until the client had read them all.
+//   - Disconnects. When the client goes away, the request's context is
+//     cancelled, and the handler stops making users nobody will read, on
+//     the next one. Writes fail too, but only once the buffers fill.
+//
+// The 200 has gone before the first user, so, like an export, an error
+// part way aborts the connection rather than ending the stream cleanly:
+// a client that gets fewer users than it asked for knows it was cut off.
+
+const (
+	// defaultStreamUsers and maxStreamUsers are ?count='s default and limit
+	defaultStreamUsers = 10_000
+	maxStreamUsers     = 1_000_000
+	// maxStreamDelay caps ?delay=, the pause after each user
+	maxStreamDelay = time.Second
+	// streamFlushEvery is how many users are written between flushes
+	streamFlushEvery = 100
+)
+
+// errStreamClosed stops a stream whose client went away
+var errStreamClosed = errors.New("the client went away")
+
+// GET /api/{version}/users/stream?count=&delay=
+func (v *apiVersion) handleUserStream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	count := defaultStreamUsers
+	if s := q.Get("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > maxStreamUsers {
+			respondWithError(w, r, http.StatusBadRequest, "count must be a number from 0 to "+strconv.Itoa(maxStreamUsers))
+			return
+		}
+		count = n
+	}
+	var delay time.Duration
+	if s := q.Get("delay"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 || d > maxStreamDelay {
+			respondWithError(w, r, http.StatusBadRequest, "delay must be a duration from 0 to "+maxStreamDelay.String()+", like 10ms")
+			return
+		}
+		delay = d
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", ndjsonType+"; charset=utf-8")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx shouldn't hold it back either
+	w.WriteHeader(http.StatusOK)
+
+	ctx := r.Context()
+	enc := json.NewEncoder(w) // Encode ends each user with a newline
+	sent := 0
+	err := fixtures.EachUser(count, func(user domain.User) error {
+		if ctx.Err() != nil {
+			return errStreamClosed
+		}
+		// Blocks while the client isn't reading: the backpressure
+		if err := enc.Encode(v.user(user)); err != nil {
+			return err
+		}
+		sent++
+		if sent%streamFlushEvery != 0 && delay == 0 {
+			return nil
+		}
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+		if delay > 0 {
+			select {
+			case <-clk.After(delay):
+			case <-ctx.Done():
+				return errStreamClosed
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return // the server flushes the rest as the handler returns
+	}
+	if errors.Is(err, errStreamClosed) || ctx.Err() != nil {
+		log.Printf("Stopped streaming users after %d of %d: %v", sent, count, errStreamClosed)
+		return
+	}
+	log.Printf("Error streaming users after %d of %d: %v", sent, count, err)
+	panic(http.ErrAbortHandler)
+}
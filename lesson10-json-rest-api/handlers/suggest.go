@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+)
+
+// How many suggestions GET /api/users/suggest returns by default, and at
+// most
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+)
+
+// suggestions indexes the users for GET /api/users/suggest, an index per
+// tenant. The indexes are guarded by storeMu, and every handler that
+// changes a user updates its tenant's under the same lock, so they always
+// agree with the store.
+var suggestions = &tenantIndexes{}
+
+// tenantIndexes is a suggestIndex for each tenant, made when it's first
+// asked for
+type tenantIndexes struct {
+	mu      sync.Mutex // For is called under storeMu's read lock too
+	indexes map[string]*suggestIndex
+}
+
+// For is the index of the users of ctx's tenant
+func (t *tenantIndexes) For(ctx context.Context) *suggestIndex {
+	tenant := middleware.TenantFrom(ctx)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.indexes == nil {
+		t.indexes = make(map[string]*suggestIndex)
+	}
+	ix, ok := t.indexes[tenant]
+	if !ok {
+		ix = &suggestIndex{}
+		t.indexes[tenant] = ix
+	}
+	return ix
+}
+
+// suggestIndex finds users by the start of any word of their name, or of
+// their email. It keeps every such term in one sorted slice, so a lookup
+// is a binary search to the first term with the prefix and a walk along
+// the ones after it: O(log n + matches), where scanning every user would
+// be O(n) on every keystroke. Adding or removing a user touches only its
+// own few terms.
+type suggestIndex struct {
+	entries []indexEntry // sorted by term, then ID
+}
+
+type indexEntry struct {
+	term string
+	id   int
+}
+
+func (e indexEntry) less(other indexEntry) bool {
+	return e.term < other.term || e.term == other.term && e.id < other.id
+}
+
+// indexTerms are the strings a user can be found by, lowercased so
+// lookups ignore case
+func indexTerms(user domain.User) []string {
+	terms := strings.Fields(strings.ToLower(user.Name))
+	if user.Email != "" {
+		terms = append(terms, strings.ToLower(user.Email))
+	}
+	return terms
+}
+
+// find returns where e is, or where it would go
+func (ix *suggestIndex) find(e indexEntry) (int, bool) {
+	i := sort.Search(len(ix.entries), func(i int) bool { return !ix.entries[i].less(e) })
+	return i, i < len(ix.entries) && ix.entries[i] == e
+}
+
+// Add indexes user's terms
+func (ix *suggestIndex) Add(user domain.User) {
+	for _, term := range indexTerms(user) {
+		e := indexEntry{term, user.ID}
+		if i, found := ix.find(e); !found {
+			ix.entries = slices.Insert(ix.entries, i, e)
+		}
+	}
+}
+
+// Remove forgets user's terms. Pass the user as it was indexed: after an
+// update, remove the old version and add the new one.
+func (ix *suggestIndex) Remove(user domain.User) {
+	for _, term := range indexTerms(user) {
+		if i, found := ix.find(indexEntry{term, user.ID}); found {
+			ix.entries = slices.Delete(ix.entries, i, i+1)
+		}
+	}
+}
+
+// Rebuild replaces the whole index, for when the whole store is replaced.
+// Sorting once is much faster than adding users one at a time.
+func (ix *suggestIndex) Rebuild(list []domain.User) {
+	entries := make([]indexEntry, 0, 3*len(list))
+	for _, user := range list {
+		for _, term := range indexTerms(user) {
+			entries = append(entries, indexEntry{term, user.ID})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+	ix.entries = slices.Compact(entries)
+}
+
+// Lookup returns the IDs of up to limit users with a term starting with
+// prefix, in order of the term they matched, each user once
+func (ix *suggestIndex) Lookup(prefix string, limit int) []int {
+	prefix = strings.ToLower(prefix)
+	i := sort.Search(len(ix.entries), func(i int) bool { return ix.entries[i].term >= prefix })
+	var ids []int
+	seen := make(map[int]bool)
+	for ; i < len(ix.entries) && len(ids) < limit; i++ {
+		e := ix.entries[i]
+		if !strings.HasPrefix(e.term, prefix) {
+			break // sorted, so nothing further on can match
+		}
+		if !seen[e.id] {
+			seen[e.id] = true
+			ids = append(ids, e.id)
+		}
+	}
+	return ids
+}
+
+// naiveSuggest is what Lookup saves: look at every term of every user on
+// every request, then sort the matches. It returns the same IDs, and is
+// here for the benchmarks and tests to compare with.
+func naiveSuggest(all map[int]domain.User, prefix string, limit int) []int {
+	prefix = strings.ToLower(prefix)
+	var matches []indexEntry
+	for _, user := range all {
+		for _, term := range indexTerms(user) {
+			if strings.HasPrefix(term, prefix) {
+				matches = append(matches, indexEntry{term, user.ID})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].less(matches[j]) })
+	var ids []int
+	seen := make(map[int]bool)
+	for _, e := range matches {
+		if len(ids) == limit {
+			break
+		}
+		if !seen[e.id] {
+			seen[e.id] = true
+			ids = append(ids, e.id)
+		}
+	}
+	return ids
+}
+
+// GET /api/{version}/users/suggest?prefix=al&limit=5 returns the users
+// whose name has a word starting with prefix, or whose email does, for a
+// search box to offer as someone types
+func (v *apiVersion) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := strings.TrimSpace(query.Get("prefix"))
+	if prefix == "" {
+		respondWithError(w, r, http.StatusBadRequest, "prefix is required")
+		return
+	}
+	limit := defaultSuggestions
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSuggestions {
+			respondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be a number from 1 to %d", maxSuggestions))
+			return
+		}
+		limit = n
+	}
+
+	storeMu.RLock()
+	ids := suggestions.For(r.Context()).Lookup(prefix, limit)
+	matches := make([]domain.User, len(ids))
+	var err error
+	for i := 0; i < len(ids) && err == nil; i++ {
+		matches[i], err = db.Get(r.Context(), ids[i])
+	}
+	storeMu.RUnlock()
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    v.resources(r, matches),
+		Message: fmt.Sprintf("Found %d users matching %q", len(matches), prefix),
+	})
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// Exports and imports move users as a file rather than a request each:
+// CSV for spreadsheets, NDJSON (one JSON user per line) for scripts. Both
+// go a row at a time, so neither end holds the whole file. The export
+// writes each user as the store hands it over (see UserStore.Each), and
+// the import creates each user as soon as its row is read.
+//
+//	GET /api/v1/users/export?format=csv
+//
+//	id,name,email,age,created_at,updated_at
+//	1,John Doe,john@example.com,25,2024-01-01T09:00:00Z,2024-01-01T09:00:00Z
+//
+//	POST /api/v1/users/import  (Content-Type: text/csv or application/x-ndjson)
+//
+//	200 {"success":false,"message":"Imported 1 of 2 rows","data":{"rows":2,"imported":1,
+//	      "failed":[{"line":3,"error":"Validation failed","details":[...]}]}}
+//
+// Like a bulk create, rows aren't all-or-nothing: a bad one is reported
+// and skipped, and the rest go in. A version's export imports back into
+// it: the read-only columns, id, created_at and updated_at, are skipped,
+// and the imported users get new ones, as users created one at a time
+// do. Unlike /api/admin/import, an import adds users; it doesn't replace
+// them.
+
+// The media types of the two formats
+const (
+	csvType    = "text/csv"
+	ndjsonType = "application/x-ndjson"
+)
+
+// exportFormats are what ?format= takes, with the media type of each
+var exportFormats = map[string]string{"csv": csvType, "ndjson": ndjsonType}
+
+// GET /api/{version}/users/export?format=csv|ndjson
+func (v *apiVersion) handleUserExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportFormats[format]
+	if !ok {
+		respondWithError(w, r, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.%s"`, v.name, format))
+	w.WriteHeader(http.StatusOK)
+	var err error
+	if format == "csv" {
+		err = v.exportCSV(r, w)
+	} else {
+		err = v.exportNDJSON(r, w)
+	}
+	if err != nil {
+		// The 200 has gone, so the only way left to say the file is cut
+		// short is to abort the response rather than end it cleanly
+		log.Printf("Error exporting users: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportCSV writes a header of v's columns, then a row for each user
+func (v *apiVersion) exportCSV(r *http.Request, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(v.columns); err != nil {
+		return err
+	}
+	row := make([]string, len(v.columns))
+	err := db.Each(r.Context(), func(user domain.User) error {
+		doc, err := v.userDocument(user)
+		if err != nil {
+			return err
+		}
+		for i, column := range v.columns {
+			row[i] = csvValue(doc[column])
+		}
+		return cw.Write(row)
+	})
+	cw.Flush()
+	return errors.Join(err, cw.Error())
+}
+
+// csvValue writes a value of a user's JSON as a CSV field
+func csvValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// exportNDJSON writes each user as v sends it, one per line
+func (v *apiVersion) exportNDJSON(r *http.Request, w io.Writer) error {
+	enc := json.NewEncoder(w) // Encode ends each user with a newline
+	return db.Each(r.Context(), func(user domain.User) error {
+		return enc.Encode(v.user(user))
+	})
+}
+
+// badRow is an import row that can't become a user. The import reports
+// it and carries on, where any other error reading the file stops it.
+type badRow struct {
+	message string
+	details []domain.ValidationError
+}
+
+func (e badRow) Error() string { return e.message }
+
+// rowReader returns each row of an import in turn, as a user's JSON in
+// the version imported to, with the line it started on. After the last
+// it returns io.EOF.
+type rowReader func() (line int, doc map[string]any, err error)
+
+// POST /api/{version}/users/import
+func (v *apiVersion) handleUserImport(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	defer body.Close()
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "" // and so unsupported
+	}
+	var next rowReader
+	switch mediaType {
+	case csvType:
+		if next, err = v.csvRows(body); err != nil {
+			respondWithImportError(w, r, err)
+			return
+		}
+	case ndjsonType, "application/ndjson":
+		next = ndjsonRows(body)
+	default:
+		respondWithError(w, r, http.StatusUnsupportedMediaType, "Import takes "+csvType+" or "+ndjsonType)
+		return
+	}
+
+	report := models.ImportReport{}
+	defer func() {
+		if report.Imported > 0 {
+			snapshots.changed()
+		}
+	}()
+	for {
+		line, doc, err := next()
+		var bad badRow
+		switch {
+		case errors.Is(err, io.EOF):
+			respond.JSON(w, http.StatusOK, domain.APIResponse{
+				Success: len(report.Failed) == 0,
+				Data:    report,
+				Message: fmt.Sprintf("Imported %d of %d rows", report.Imported, report.Rows),
+			})
+			return
+		case errors.As(err, &bad):
+			report.Rows++
+			report.Failed = append(report.Failed, models.ImportRowError{Line: line, Error: bad.message, Details: bad.details})
+			continue
+		case err != nil:
+			respondWithImportStopped(w, r, report, line, err)
+			return
+		}
+
+		report.Rows++
+		user, errs := v.userFromDocument(doc)
+		if len(errs) > 0 {
+			report.Failed = append(report.Failed, models.ImportRowError{Line: line, Error: "Validation failed", Details: errs})
+			continue
+		}
+		now := clk.Now()
+		user.CreatedAt, user.UpdatedAt = now, now
+		storeMu.Lock()
+		user, err = db.Create(r.Context(), user)
+		if err == nil {
+			suggestions.For(r.Context()).Add(user)
+			events.Publish(r.Context(), userCreated, user)
+		}
+		storeMu.Unlock()
+		if err != nil {
+			respondWithImportStopped(w, r, report, line, err)
+			return
+		}
+		report.Imported++
+	}
+}
+
+// csvRows reads an import's CSV header and returns a reader of the rows
+// under it. The header names the columns, in any order, from v's; a
+// column it doesn't have fails the whole import, before any row.
+func (v *apiVersion) csvRows(body io.Reader) (rowReader, error) {
+	cr := csv.NewReader(body)
+	header, err := cr.Read() // and every row must now have as many fields
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty; its first row must name the columns")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range header {
+		if !slices.Contains(v.columns, column) {
+			return nil, fmt.Errorf("%s users have no column %q; they have %s", v.name, column, strings.Join(v.columns, ", "))
+		}
+	}
+
+	line := 1 // the header's
+	return func() (int, map[string]any, error) {
+		record, err := cr.Read()
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			line = parseErr.StartLine
+			if errors.Is(parseErr.Err, csv.ErrFieldCount) {
+				return line, nil, badRow{message: fmt.Sprintf("The row has %d fields, but the header has %d", len(record), len(header))}
+			}
+			return line, nil, badRow{message: "Invalid CSV: " + parseErr.Err.Error()}
+		case err != nil:
+			return line + 1, nil, err
+		}
+		line, _ = cr.FieldPos(0)
+		doc := make(map[string]any, len(header))
+		for i, column := range header {
+			if slices.Contains(readOnlyFields, column) {
+				continue
+			}
+			// Every field is text, and all but age are strings in JSON too
+			if column != "age" {
+				doc[column] = record[i]
+				continue
+			}
+			age, err := strconv.Atoi(strings.TrimSpace(record[i]))
+			if err != nil {
+				return line, nil, badRow{message: "Validation failed", details: []domain.ValidationError{{Field: "age", Message: "Must be a number"}}}
+			}
+			doc[column] = age
+		}
+		return line, doc, nil
+	}, nil
+}
+
+// ndjsonRows returns a reader of an import's NDJSON lines. Blank lines,
+// like one after the last user, are skipped.
+func ndjsonRows(body io.Reader) rowReader {
+	scanner := bufio.NewScanner(body) // a line may be up to 64 KB
+	line := 0
+	return func() (int, map[string]any, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			var doc map[string]any
+			if err := decodeJSON(text, &doc); err != nil {
+				message, details := describeDecodeError(err)
+				if details != nil {
+					message = "Validation failed"
+				}
+				return line, nil, badRow{message: message, details: details}
+			}
+			for _, field := range readOnlyFields {
+				delete(doc, field)
+			}
+			return line, doc, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return line + 1, nil, err
+		}
+		return line, nil, io.EOF
+	}
+}
+
+// respondWithImportError sends the error for an import that couldn't
+// start: a body that's too big, or a CSV header that's wrong
+func respondWithImportError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, r, http.StatusRequestEntityTooLarge, "Request body is larger than "+byteSize(tooLarge.Limit))
+		return
+	}
+	respondWithError(w, r, http.StatusBadRequest, "Invalid CSV: "+err.Error())
+}
+
+// respondWithImportStopped answers an import that stopped part way, at
+// line: the rows before it are in, so the report goes with the error
+func respondWithImportStopped(w http.ResponseWriter, r *http.Request, report models.ImportReport, line int, err error) {
+	var status int
+	var message string
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		status, message = http.StatusRequestEntityTooLarge, "the file is larger than "+byteSize(tooLarge.Limit)
+	case errors.Is(err, bufio.ErrTooLong):
+		status, message = http.StatusBadRequest, "the line is longer than 64 KB"
+	case r.Context().Err() != nil:
+		return // the client has gone
+	default:
+		log.Printf("Error importing users: %v", err)
+		status, message = http.StatusInternalServerError, "internal server error"
+	}
+	respond.JSON(w, status, domain.APIResponse{
+		Success: false,
+		Data:    report,
+		Error:   fmt.Sprintf("Stopped at line %d: %s; the %d rows imported before it stay", line, message, report.Imported),
+	})
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/respond"
+	"golang-lab/lesson10-json-rest-api/middleware"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// GET /api/{version}/users, a page at a time; see userQuery for the
+// parameters
+func (v *apiVersion) getAllUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := parseUserQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	
+	userList, err := db.List(r.Context())
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	page, meta := query.paginate(query.filter(userList), r.URL)
+	
+	respondNegotiated(w, r, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    v.resources(r, page),
+		Message: fmt.Sprintf("Found %d users", meta.Total),
+		Meta:    &meta,
+		Links:   v.pageLinks(r, meta),
+	})
+}
+
+// GET /api/{version}/users/{id}
+func (v *apiVersion) getUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	user, err := db.Get(r.Context(), userID)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	
+	respondNegotiated(w, r, http.StatusOK, v.userResponse(r, user))
+}
+
+// POST /api/{version}/users
+func (v *apiVersion) createUser(w http.ResponseWriter, r *http.Request) {
+	// Read and parse JSON body, timed for the Server-Timing header
+	decodeStart := clk.Now()
+	body, ok := readBody(w, r, maxBodySize)
+	if !ok {
+		return
+	}
+	
+	// Decode and validate the version's request
+	newUser, errors, err := v.decodeCreate(body)
+	if err != nil {
+		respondWithDecodeError(w, r, err)
+		return
+	}
+	middleware.TimePhase(r.Context(), "decode", decodeStart)
+	if len(errors) > 0 {
+		respondWithValidationErrors(w, r, errors)
+		return
+	}
+	
+	// Create user; the store picks the ID
+	now := clk.Now()
+	storeMu.Lock()
+	newUser.CreatedAt, newUser.UpdatedAt = now, now
+	user, err := db.Create(r.Context(), newUser)
+	if err == nil {
+		suggestions.For(r.Context()).Add(user)
+		events.Publish(r.Context(), userCreated, user)
+	}
+	storeMu.Unlock()
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	snapshots.changed()
+	jobs.Enqueue(r.Context(), welcomeEmail, user)
+	
+	respond.JSON(w, http.StatusCreated, domain.APIResponse{
+		Success: true,
+		Data:    v.resource(r, user),
+		Message: "User created successfully",
+	})
+}
+
+// PUT /api/{version}/users/{id}
+func (v *apiVersion) updateUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	body, ok := readBody(w, r, maxBodySize)
+	if !ok {
+		return
+	}
+	
+	// Look the user up and change it under one lock, so a concurrent
+	// update or delete can't slip in between
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	user, err := db.Get(r.Context(), userID)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	
+	// Update fields if provided, if the client had the current version
+	old := user
+	if err := v.decodeUpdate(body, &user); err != nil {
+		respondWithDecodeError(w, r, err)
+		return
+	}
+	if !v.requireVersion(w, r, old, bodyVersion(body)) {
+		return
+	}
+	user.UpdatedAt = clk.Now()
+	user.Version++
+	
+	if err := db.Update(r.Context(), user); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	suggestions.For(r.Context()).Remove(old)
+	suggestions.For(r.Context()).Add(user)
+	events.Publish(r.Context(), userUpdated, user)
+	snapshots.changed()
+	
+	v.setUserETag(w, r, user)
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Data:    v.resource(r, user),
+		Message: "User updated successfully",
+	})
+}
+
+// DELETE /api/{version}/users/{id}
+func (v *apiVersion) deleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	user, err := db.Get(r.Context(), userID)
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	if !v.checkIfMatch(w, r, user) {
+		return
+	}
+	if err := db.Delete(r.Context(), userID); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	suggestions.For(r.Context()).Remove(user)
+	events.Publish(r.Context(), userDeleted, user)
+	snapshots.changed()
+	
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Message: "User deleted successfully",
+	})
+}
+
+// respondWithStoreError maps store errors onto HTTP status codes. Anything
+// but a missing user is the server's problem, not the client's, so the
+// details go to the log rather than the response.
+func respondWithStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrUserNotFound) {
+		respondWithError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+	if errors.Is(err, store.ErrDuplicateEmail) {
+		respondWithError(w, r, http.StatusConflict, "Email already in use")
+		return
+	}
+	if errors.Is(err, store.ErrTooManyTenants) {
+		respondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("%s names a new tenant, but %v", middleware.TenantHeader, err))
+		return
+	}
+	log.Printf("Error: %v", err)
+	respondWithError(w, r, http.StatusInternalServerError, "Internal server error")
+}
+
+// maxImportSize caps an import body, so a mistaken upload can't exhaust
+// memory
+const maxImportSize = 10 << 20
+
+// GET /api/admin/export
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Disposition", `attachment; filename="users-backup.json"`)
+	backup, err := backupUsers(r.Context())
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, backup)
+}
+
+// backupUsers copies the store into a Backup, sorted by ID so the same
+// data always makes the same document
+func backupUsers(ctx context.Context) (domain.Backup, error) {
+	userList, err := db.List(ctx)
+	if err != nil {
+		return domain.Backup{}, err
+	}
+	return domain.NewBackup(userList, clk.Now()), nil
+}
+
+// POST /api/admin/import replaces every user with those in the backup
+func handleImport(w http.ResponseWriter, r *http.Request) {
+	var backup domain.Backup
+	decodeStart := clk.Now()
+	body, ok := readBody(w, r, maxImportSize)
+	if !ok {
+		return
+	}
+	if err := decodeJSON(body, &backup); err != nil {
+		respondWithDecodeError(w, r, err)
+		return
+	}
+	
+	// Check everything before touching the store, so a bad backup
+	// leaves the current data alone
+	errors := backup.Validate()
+	middleware.TimePhase(r.Context(), "decode", decodeStart)
+	if len(errors) > 0 {
+		respondWithValidationErrors(w, r, errors)
+		return
+	}
+	
+	if err := restoreUsers(r.Context(), backup.Users); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	snapshots.changed()
+	
+	respond.JSON(w, http.StatusOK, domain.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Imported %d users", len(backup.Users)),
+	})
+}
+
+// restoreUsers replaces the store with a validated backup's users. Users
+// without timestamps get the current time, and those without a version,
+// from before there were versions, version 1.
+func restoreUsers(ctx context.Context, list []domain.User) error {
+	now := clk.Now()
+	restored := make([]domain.User, len(list))
+	for i, user := range list {
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = now
+		}
+		if user.UpdatedAt.IsZero() {
+			user.UpdatedAt = user.CreatedAt
+		}
+		user.Version = max(user.Version, 1)
+		restored[i] = user
+	}
+	
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if err := db.Replace(ctx, restored); err != nil {
+		return err
+	}
+	suggestions.For(ctx).Rebuild(restored)
+	return nil
+}
+
+// indexStore builds the suggestions index from whatever the store holds
+// already, such as a SQLite file from the last run, and reports whether
+// it held any users
+func indexStore() (bool, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	ctx := context.Background() // the default tenant's; the others start empty
+	list, err := db.List(ctx)
+	if err != nil {
+		return false, err
+	}
+	suggestions.For(ctx).Rebuild(list)
+	return len(list) > 0, nil
+}
+
+// Helper functions
+
+// pathUserID reads {id} from /api/{version}/users/{id}. If it isn't a
+// number, it has already sent the 400.
+func pathUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return userID, true
+}
+
+// respondWithError sends an error as a domain.ErrorResponse, or as an
+// RFC 7807 problem to clients that ask for one (see problems.go)
+func respondWithError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	if wantsProblem(r) {
+		respondWithProblem(w, r, newProblem(statusCode, message))
+		return
+	}
+	respond.Error(w, statusCode, message)
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, r *http.Request, errors []domain.ValidationError) {
+	if wantsProblem(r) {
+		respondWithProblem(w, r, newValidationProblem(errors))
+		return
+	}
+	respond.ValidationErrors(w, errors)
+}
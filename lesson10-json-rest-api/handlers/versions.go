@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// The user API comes in two versions. v1 is the API as it always was: a
+// user has one name. v2 splits it into first_name and last_name, which
+// would break every v1 client that reads or sends name, so it's a new
+// version at a new path rather than a change to the old one. Both
+// versions share the handlers, the store and the rules; an apiVersion is
+// only how a version maps users to and from what it puts on the wire.
+//
+//	/api/v1/users/1  {"id":1,"name":"John Doe",...}
+//	/api/v2/users/1  {"id":1,"first_name":"John","last_name":"Doe",...}
+//
+// The unversioned /api/users paths are v1's, for clients from before
+// there were versions. The rest of the API didn't change in v2, so
+// /api/v1/health and /api/v2/health are both just /api/health.
+
+// apiVersion is one version of the user API: its name in the path, and
+// its DTO mapping
+type apiVersion struct {
+	name string // v1 or v2
+
+	// user is how the version sends a user, and linked the same with its
+	// links (see links.go)
+	user   func(domain.User) any
+	linked func(domain.User, domain.Links) any
+
+	// decodeCreate reads a POST body into a new user, and decodeUser a
+	// whole user as the version sends it, like a patched one. Both
+	// validate what they read; the error is for a body that isn't JSON of
+	// the right shape, unknown fields included (see decode.go).
+	decodeCreate func(body []byte) (domain.User, []domain.ValidationError, error)
+	decodeUser   func(data []byte) (domain.User, []domain.ValidationError, error)
+
+	// decodeUpdate reads a PUT body onto user, changing the fields sent
+	decodeUpdate func(body []byte, user *domain.User) error
+
+	// create and update are zero values of the POST and PUT bodies, for
+	// the OpenAPI document
+	create, update any
+
+	// columns are the fields of user's JSON in the order a CSV export
+	// writes them (see transfer.go)
+	columns []string
+}
+
+var (
+	v1 = &apiVersion{
+		name:         "v1",
+		user:         func(user domain.User) any { return user },
+		linked:       func(user domain.User, links domain.Links) any { return models.LinkedUser{User: user, Links: links} },
+		decodeCreate: decodeCreateV1,
+		decodeUser:   decodeUserV1,
+		decodeUpdate: decodeUpdateV1,
+		create:       domain.CreateUserRequest{},
+		update:       domain.UpdateUserRequest{},
+		columns:      []string{"id", "name", "email", "age", "created_at", "updated_at"},
+	}
+	v2 = &apiVersion{
+		name: "v2",
+		user: func(user domain.User) any { return models.NewUserV2(user) },
+		linked: func(user domain.User, links domain.Links) any {
+			return models.LinkedUserV2{UserV2: models.NewUserV2(user), Links: links}
+		},
+		decodeCreate: decodeCreateV2,
+		decodeUser:   decodeUserV2,
+		decodeUpdate: decodeUpdateV2,
+		create:       models.CreateUserRequestV2{},
+		update:       models.UpdateUserRequestV2{},
+		columns:      []string{"id", "first_name", "last_name", "email", "age", "created_at", "updated_at"},
+	}
+)
+
+// apiVersions are the versions served, oldest first
+var apiVersions = []*apiVersion{v1, v2}
+
+// registerUserRoutes serves v's user routes under prefix, like /api/v2
+func registerUserRoutes(mux *routes, prefix string, v *apiVersion) {
+	mux.Handle("GET "+prefix+"/users", requireAuth(http.HandlerFunc(v.getAllUsers)))
+	mux.Handle("POST "+prefix+"/users", requireAuth(http.HandlerFunc(v.createUser)))
+	mux.Handle("GET "+prefix+"/users/{id}", requireAuth(http.HandlerFunc(v.getUser)))
+	mux.Handle("PUT "+prefix+"/users/{id}", requireAuth(http.HandlerFunc(v.updateUser)))
+	mux.Handle("PATCH "+prefix+"/users/{id}", requireAuth(http.HandlerFunc(v.patchUser)))
+	mux.Handle("DELETE "+prefix+"/users/{id}", requireAuth(http.HandlerFunc(v.deleteUser)))
+	mux.HandleFunc("GET "+prefix+"/users/suggest", v.handleSuggest)
+	mux.HandleFunc("GET "+prefix+"/users/search", v.handleSearch)
+	mux.HandleFunc("GET "+prefix+"/users/events", v.handleEvents)
+	mux.Handle("POST "+prefix+"/users/bulk", requireAuth(http.HandlerFunc(v.handleBulk)))
+	mux.Handle("DELETE "+prefix+"/users/bulk", requireAuth(http.HandlerFunc(v.handleBulk)))
+	mux.HandleFunc("GET "+prefix+"/users/export", v.handleUserExport)
+	mux.HandleFunc("GET "+prefix+"/users/stream", v.handleUserStream)
+	mux.Handle("POST "+prefix+"/users/import", requireAuth(http.HandlerFunc(v.handleUserImport)))
+}
+
+// unversioned serves the routes every version shares from mux, by their
+// unversioned path: /api/v2/health is /api/health
+func unversioned(mux http.Handler, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shared := r.Clone(r.Context())
+		shared.URL.Path = "/api" + strings.TrimPrefix(r.URL.Path, prefix)
+		shared.URL.RawPath = ""
+		mux.ServeHTTP(w, shared)
+	})
+}
+
+// v1: users exactly as the store keeps them
+
+func decodeCreateV1(body []byte) (domain.User, []domain.ValidationError, error) {
+	var req domain.CreateUserRequest
+	if err := decodeJSON(body, &req); err != nil {
+		return domain.User{}, nil, err
+	}
+	return domain.User{Name: req.Name, Email: req.Email, Age: req.Age}, req.Validate(), nil
+}
+
+func decodeUserV1(data []byte) (domain.User, []domain.ValidationError, error) {
+	var user domain.User
+	if err := decodeJSON(data, &user); err != nil {
+		return domain.User{}, nil, err
+	}
+	req := domain.CreateUserRequest{Name: user.Name, Email: user.Email, Age: user.Age}
+	return user, req.Validate(), nil
+}
+
+func decodeUpdateV1(body []byte, user *domain.User) error {
+	var req domain.UpdateUserRequest
+	if err := decodeJSON(body, &req); err != nil {
+		return err
+	}
+	req.Apply(user)
+	return nil
+}
+
+// v2: the name in two parts
+
+func decodeCreateV2(body []byte) (domain.User, []domain.ValidationError, error) {
+	var req models.CreateUserRequestV2
+	if err := decodeJSON(body, &req); err != nil {
+		return domain.User{}, nil, err
+	}
+	user := domain.User{Name: models.JoinName(req.FirstName, req.LastName), Email: req.Email, Age: req.Age}
+	return user, req.Validate(), nil
+}
+
+func decodeUserV2(data []byte) (domain.User, []domain.ValidationError, error) {
+	var u models.UserV2
+	if err := decodeJSON(data, &u); err != nil {
+		return domain.User{}, nil, err
+	}
+	req := models.CreateUserRequestV2{FirstName: u.FirstName, LastName: u.LastName, Email: u.Email, Age: u.Age}
+	user := domain.User{
+		ID:        u.ID,
+		Name:      models.JoinName(u.FirstName, u.LastName),
+		Email:     u.Email,
+		Age:       u.Age,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+	return user, req.Validate(), nil
+}
+
+func decodeUpdateV2(body []byte, user *domain.User) error {
+	var req models.UpdateUserRequestV2
+	if err := decodeJSON(body, &req); err != nil {
+		return err
+	}
+	req.Apply(user)
+	return nil
+}
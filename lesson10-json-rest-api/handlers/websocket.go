@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/middleware"
+)
+
+// GET /api/ws sends the same changes as GET /api/users/events, over a
+// WebSocket instead. The socket goes both ways, which SSE can't, though
+// for now the server only talks; what a client sends is read and
+// ignored. Each change is one text message:
+//
+//	{"type":"hello"}
+//	{"type":"user.created","id":1,"user":{"id":11,"name":"Alice",...}}
+//
+// Lesson 15 builds a whole chat server this way; this is the same hub
+// and pumps, fed by the event bus. Users are v1's, and have no links. The
+// hub hears every tenant's changes, and sends each client its own
+// tenant's.
+
+const (
+	// wsWriteWait is how long one write to a client may take
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long a client may go without answering a ping
+	// before it's taken for gone
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod is how often the server pings, shorter than
+	// wsPongWait so a healthy client always has time to answer
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize limits what a client can send
+	wsMaxMessageSize = 512
+	// wsSendBuffer is how many messages a client can fall behind by
+	// before it's disconnected
+	wsSendBuffer = 64
+)
+
+// wsMessage is what /api/ws sends: hello once a client is registered,
+// then a user event per change
+type wsMessage struct {
+	Type string       `json:"type"` // hello, or a UserEvent's type
+	ID   int64        `json:"id,omitempty"`
+	User *domain.User `json:"user,omitempty"`
+}
+
+// wsUpgrader answers a request that isn't a WebSocket handshake, or
+// comes from another site's page, like any other bad request
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		respondWithError(w, r, status, reason.Error())
+	},
+}
+
+// hub is the WebSocket hub /api/ws registers clients with. Run starts
+// it, like the invitation sweeper.
+var hub = newHub()
+
+// wsHub keeps track of the connected clients. Only its run goroutine
+// touches clients, so it needs no mutex; everything else asks it over
+// channels.
+type wsHub struct {
+	clients    map[*wsClient]struct{}
+	register   chan *wsClient
+	unregister chan *wsClient
+	count      chan chan int
+	stop       chan struct{}
+	done       chan struct{} // closed once run has returned
+	pumps      sync.WaitGroup
+}
+
+func newHub() *wsHub {
+	return &wsHub{
+		clients:    make(map[*wsClient]struct{}),
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		count:      make(chan chan int),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// startHub runs h until the returned stop function is called. stop
+// closes every connection with 1001 Going Away, and waits for the close
+// messages to be sent.
+func startHub(h *wsHub) (stop func()) {
+	go h.run()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(h.stop)
+			<-h.done
+			h.pumps.Wait()
+		})
+	}
+}
+
+func (h *wsHub) run() {
+	defer close(h.done)
+	changes, unsubscribe := events.Subscribe(allTenants)
+	defer func() { unsubscribe() }()
+	for {
+		select {
+		case c := <-h.register:
+			h.clients[c] = struct{}{}
+			h.pumps.Add(1)
+			go func() {
+				defer h.pumps.Done()
+				c.writePump()
+			}()
+			h.sendTo(c, wsMessage{Type: "hello"})
+		case c := <-h.unregister:
+			h.disconnect(c, nil) // its connection has failed; nothing to say
+		case e, ok := <-changes:
+			if !ok {
+				// The bus dropped us, or the server is shutting down and
+				// stop is on its way; either way, listen again
+				changes, unsubscribe = events.Subscribe(allTenants)
+				continue
+			}
+			user := e.User
+			for c := range h.clients {
+				if c.tenant == e.Tenant {
+					h.sendTo(c, wsMessage{Type: e.Type, ID: e.ID, User: &user})
+				}
+			}
+		case reply := <-h.count:
+			reply <- len(h.clients)
+		case <-h.stop:
+			for c := range h.clients {
+				h.disconnect(c, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+			}
+			return
+		}
+	}
+}
+
+// Clients is how many clients are connected
+func (h *wsHub) Clients() int {
+	reply := make(chan int)
+	select {
+	case h.count <- reply:
+		return <-reply
+	case <-h.done:
+		return 0
+	}
+}
+
+// sendTo queues msg for c without blocking. A client whose buffer is
+// full isn't keeping up, and is disconnected rather than allowed to hold
+// up the hub for everyone else.
+func (h *wsHub) sendTo(c *wsClient, msg wsMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding WebSocket message: %v", err)
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		log.Printf("Disconnecting a WebSocket client that fell %d messages behind", wsSendBuffer)
+		h.disconnect(c, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "falling behind"))
+	}
+}
+
+// disconnect forgets c, and has its write pump close the connection,
+// sending closeMessage first if there is one
+func (h *wsHub) disconnect(c *wsClient, closeMessage []byte) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	c.closeMessage = closeMessage
+	close(c.send)
+}
+
+// wsClient is one connection. gorilla/websocket allows one reader and
+// one writer at a time, so each connection has a readPump and a
+// writePump.
+type wsClient struct {
+	hub          *wsHub
+	conn         *websocket.Conn
+	send         chan []byte
+	tenant       string // whose users' changes it's sent
+	closeMessage []byte // set by the hub before it closes send, if any
+}
+
+// readPump reads until the connection fails, handling pongs as it goes,
+// then unregisters c. It's the only reader of conn.
+func (c *wsClient) readPump() {
+	defer c.conn.Close()
+	defer func() {
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done: // already disconnected by stop
+		}
+	}()
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	if err := c.conn.SetReadDeadline(time.Now().Add(wsPongWait)); err != nil {
+		return
+	}
+	// Every pong pushes the deadline out again; a silent client times out
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket read error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// writePump sends what the hub queues, and pings every wsPingPeriod.
+// When the hub closes send, it sends the close message and closes the
+// connection. It's the only writer of conn.
+func (c *wsClient) writePump() {
+	ping := clk.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	defer c.conn.Close()
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				if c.closeMessage != nil {
+					if err := c.write(websocket.CloseMessage, c.closeMessage); err != nil {
+						log.Printf("Error closing a WebSocket: %v", err)
+					}
+				}
+				return
+			}
+			if err := c.write(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write writes one message, giving up after wsWriteWait
+func (c *wsClient) write(messageType int, data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// GET /api/ws
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has already answered, through wsUpgrader.Error
+	}
+	c := &wsClient{hub: hub, conn: conn, send: make(chan []byte, wsSendBuffer), tenant: middleware.TenantFrom(r.Context())}
+	select {
+	case hub.register <- c:
+	case <-hub.done:
+		defer conn.Close()
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		if err := conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(wsWriteWait)); err != nil {
+			log.Printf("Error closing a WebSocket: %v", err)
+		}
+		return
+	}
+	// The handler returns while the pumps keep the connection going
+	go c.readPump()
+}
@@ -0,0 +1,18 @@
+package lesson10
+
+import (
+	"testing"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
+	"golang-lab/lab/golden"
+)
+
+// The API itself is tested in handlers, store, middleware and models;
+// this is the lesson's JSON walkthrough
+
+func TestDemonstrateJSON(t *testing.T) {
+	clk = clock.NewFake(demo.Clock)
+	t.Cleanup(func() { clk = clock.Real{} })
+	golden.Demo(t, "json.golden", demonstratJSON)
+}
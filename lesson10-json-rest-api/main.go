@@ -1,170 +1,369 @@
 // Lesson 10: JSON Handling and REST API
 // This lesson covers JSON marshaling/unmarshaling and building RESTful APIs
 
-package main
+package lesson10
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
-)
-
-// User represents a user in our system
-type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Age       int       `json:"age"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
-// CreateUserRequest represents the request payload for creating a user
-type CreateUserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Age   int    `json:"age"`
-}
-
-// UpdateUserRequest represents the request payload for updating a user
-type UpdateUserRequest struct {
-	Name  *string `json:"name,omitempty"`
-	Email *string `json:"email,omitempty"`
-	Age   *int    `json:"age,omitempty"`
-}
-
-// APIResponse represents a standard API response
-type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-}
-
-// ValidationError represents validation errors
-type ValidationError struct {
-	Field   string `json:"field"`
-	Message string `json:"message"`
-}
 
-// ErrorResponse represents error response with details
-type ErrorResponse struct {
-	Error   string            `json:"error"`
-	Details []ValidationError `json:"details,omitempty"`
-}
+	"golang-lab/lab/clock"
+	"golang-lab/lab/config"
+	"golang-lab/lab/demo"
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/handlers"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
 
-// In-memory database
-var (
-	users      = make(map[int]User)
-	nextUserID = 1
+	"gopkg.in/yaml.v3"
 )
 
-func main() {
+// clk is where the lesson gets the time; in deterministic mode it's a
+// clock.Fake that stands still
+var clk clock.Clock = clock.Real{}
+
+// Run is the lesson's entry point; cmd/lesson10 calls it
+func Run() {
 	fmt.Println("=== Lesson 10: JSON Handling and REST API ===")
 	
-	// Initialize with some sample data
-	initializeData()
+	port := flag.Int("port", 8080, "port to listen on; 0 picks a free one")
+	storage := flag.String("storage", "memory", "where to keep users: memory, sqlite or mongo")
+	dbFile := flag.String("db", "users.db", "the SQLite database file, with -storage sqlite")
+	mongoURI := flag.String("mongo-uri", "mongodb://localhost:27017/golang_lab", "the MongoDB server and database, with -storage mongo")
+	cfg := handlers.DefaultConfig()
+	flag.StringVar(&cfg.DataFile, "data", "", "keep users in this JSON file: load it on startup, save changes to it")
+	flag.IntVar(&cfg.Quota, "quota", cfg.Quota, "requests each API key may make per day")
+	flag.Float64Var(&cfg.Rate, "rate", cfg.Rate, "requests per second each client may make, after a burst")
+	flag.IntVar(&cfg.Burst, "burst", cfg.Burst, "requests each client may make at once")
+	secret := flag.String("jwt-secret", "", "key that signs login tokens; empty picks a random one each start")
+	flag.DurationVar(&cfg.TokenTTL, "token-ttl", cfg.TokenTTL, "how long a login token is good for")
+	flag.StringVar(&cfg.Password, "password", cfg.Password, "the password every user logs in with")
+	flag.BoolVar(&cfg.Problems, "problems", false, "send every error as application/problem+json, not just to clients that ask")
+	flag.BoolVar(&cfg.LogBodies, "log-bodies", false, "log every request's and response's body, secrets blanked out, for debugging")
+	flag.IntVar(&cfg.CacheSize, "cache-size", cfg.CacheSize, "users GET /api/users/{id} keeps in memory; 0 turns the cache off")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "how long a cached user is good for")
+	flag.IntVar(&cfg.Workers, "workers", cfg.Workers, "goroutines sending welcome emails in the background")
+	flag.IntVar(&cfg.JobAttempts, "job-attempts", cfg.JobAttempts, "times to try a welcome email before it's a dead letter")
+	flag.DurationVar(&cfg.JobBackoff, "job-backoff", cfg.JobBackoff, "wait before retrying a failed email; doubles each time")
+	flag.Func("ready-url", "an API this one depends on: GET /readyz checks it answers GET with a 2xx (repeatable)", func(url string) error {
+		cfg.Checks = append(cfg.Checks, handlers.HTTPCheck(url))
+		return nil
+	})
+	flag.StringVar(&cfg.GitHub.ClientID, "github-client-id", "", "a GitHub OAuth app's client ID, for logging in with GitHub; its secret goes in $GITHUB_CLIENT_SECRET")
+	flag.StringVar(&cfg.GitHub.RedirectURL, "github-redirect-url", "", "the OAuth app's callback URL, if not the one it was registered with")
+	flag.Var((*config.List)(&cfg.CORSOrigins), "cors-origin", "an origin browsers may call the API from, like https://app.example.com (repeatable, or comma-separated); none allows any")
+	readTimeout := flag.Duration("read-timeout", 30*time.Second, "how long a client has to send a whole request, body and all")
+	writeTimeout := flag.Duration("write-timeout", 0, "how long the server has to answer; 0 for no limit, which event streams and WebSockets need")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "how long a keep-alive connection may wait for its next request")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "how long Ctrl+C waits for requests in flight before cutting them off")
+	ci := flag.Bool("ci", false, "serve on a free port, send a smoke test of requests, and exit")
+	flag.BoolVar(ci, "once", false, "same as -ci")
+	drive := flag.Bool("client", false, "serve on a free port, drive it with the client package, and exit")
+	hammer := flag.Bool("hammer", false, "serve on a free port, send it more requests than its rate limit allows from clients that back off, and exit")
+	
+	// Every flag can also come from -config's file, or $LESSON10_<FLAG>
+	settings, err := config.Load(flag.CommandLine, os.Args[1:], config.Options{
+		EnvPrefix: "LESSON10_",
+		Secret:    []string{"jwt-secret", "password"},
+		Check: func() (problems []string) {
+			if *port < 0 || *port > 65535 {
+				problems = append(problems, fmt.Sprintf("the port must be between 0 and 65535, not %d", *port))
+			}
+			if *storage != "memory" && *storage != "sqlite" && *storage != "mongo" {
+				problems = append(problems, fmt.Sprintf("the storage must be memory, sqlite or mongo, not %q", *storage))
+			}
+			if *readTimeout < 0 || *writeTimeout < 0 || *idleTimeout < 0 {
+				problems = append(problems, "the read, write and idle timeouts can't be negative")
+			}
+			if shutdownTimeout <= 0 {
+				problems = append(problems, "the shutdown timeout must be positive")
+			}
+			return problems
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := settings.Print(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if *secret != "" {
+		cfg.JWTSecret = []byte(*secret)
+	}
+	// Not a flag, so it stays out of ps and shell history
+	cfg.GitHub.ClientSecret = os.Getenv("GITHUB_CLIENT_SECRET")
 	
-	// Demonstrate JSON operations
-	demonstratJSON()
+	// -hammer is about being turned away, so unless -rate and -burst say
+	// otherwise, they're low enough for a few clients to hit
+	if *hammer {
+		if s, _ := settings.Get("rate"); s.Source == config.Default {
+			cfg.Rate = 10
+		}
+		if s, _ := settings.Get("burst"); s.Source == config.Default {
+			cfg.Burst = 5
+		}
+	}
 	
-	// Create HTTP server
-	mux := http.NewServeMux()
-	registerAPIRoutes(mux)
+	// In deterministic mode the clock stands still
+	if demo.Enabled() {
+		clk = clock.NewFake(demo.Clock)
+	}
+	cfg.Clock = clk
 	
-	// Apply middleware
-	handler := corsMiddleware(loggingMiddleware(mux))
+	if cfg.Store, err = store.Open(*storage, *dbFile, *mongoURI); err != nil {
+		log.Fatalf("Failed to open %s store: %v", *storage, err)
+	}
+	defer func() {
+		if err := cfg.Store.Close(); err != nil {
+			log.Printf("Failed to close the %s store: %v", *storage, err)
+		}
+	}()
 	
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: handler,
+	// Start with the saved users if there are any, or else the samples,
+	// and the background work that runs until shutdown
+	stopAPI, err := handlers.Start(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 	
-	fmt.Println("\nStarting REST API server on http://localhost:8080")
+	// Demonstrate JSON operations
+	demonstratJSON(os.Stdout)
+	
+	server := handlers.NewServer()
+	// A client that sends its request slowly, or not at all, would
+	// otherwise hold its connection, and a goroutine, forever
+	server.ReadHeaderTimeout = min(*readTimeout, 10*time.Second)
+	server.ReadTimeout = *readTimeout
+	server.WriteTimeout = *writeTimeout
+	server.IdleTimeout = *idleTimeout
+	
+	// In CI mode, exercise the whole API over real HTTP instead of waiting
+	// for someone with curl
+	if *ci {
+		if err := handlers.Smoke(os.Stdout, server.Handler); err != nil {
+			log.Fatal(err)
+		}
+		if err := stopAPI(); err != nil {
+			log.Fatalf("Failed to save users: %v", err)
+		}
+		return
+	}
+	
+	if *drive || *hammer {
+		*port = 0
+	}
+	listener, err := Listen(*port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	url := URL(listener)
+	
+	// In client mode, a Go program uses the API the way curl would, over
+	// HTTP, then the server stops; in hammer mode, several do, faster than
+	// they're allowed to
+	if *drive || *hammer {
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() { served <- Serve(ctx, server, listener) }()
+		var err error
+		if *hammer {
+			err = demonstrateRateLimits(context.Background(), os.Stdout, url+"/api/v1", 4, 8)
+		} else {
+			err = demonstrateClient(context.Background(), os.Stdout, url+"/api/v1", "john@example.com", cfg.Password)
+		}
+		cancel()
+		if err := <-served; err != nil {
+			log.Printf("Error during shutdown: %v", err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := stopAPI(); err != nil {
+			log.Fatalf("Failed to save users: %v", err)
+		}
+		return
+	}
+	
+	// A store without a working admin key gets one, shown just this once
+	adminKey, err := handlers.BootstrapAdminKey(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to issue an admin API key: %v", err)
+	}
+	
+	fmt.Printf("\nStarting REST API server on %s\n", url)
+	if adminKey != "" {
+		fmt.Printf("Admin API key, for X-API-Key (save it; it won't be shown again): %s\n", adminKey)
+	}
 	fmt.Println("Available endpoints:")
-	fmt.Println("  GET    /api/users       - Get all users")
-	fmt.Println("  GET    /api/users/{id}  - Get user by ID")
-	fmt.Println("  POST   /api/users       - Create new user")
-	fmt.Println("  PUT    /api/users/{id}  - Update user")
-	fmt.Println("  DELETE /api/users/{id}  - Delete user")
-	fmt.Println("  GET    /api/health      - API health check")
+	fmt.Println("  Users are versioned: /api/v1/users sends name, /api/v2/users first_name and last_name;")
+	fmt.Println("  /api/users is v1's. Every other path is the same with /api/v1 or /api/v2 in front.")
+	fmt.Println("  Send X-Tenant-ID: acme for tenant acme's own users; without it, the default tenant's.")
+	fmt.Println("  GET    /api/v1/users              - Get users (?page, ?limit, ?sort, ?min_age, ?email_contains)")
+	fmt.Println("  GET    /api/v1/users/{id}         - Get user by ID (Accept: application/xml or application/yaml too)")
+	fmt.Println("  GET    /api/v1/users/suggest      - Suggest users as someone types (?prefix, ?limit)")
+	fmt.Println("  GET    /api/v1/users/search?q=    - Search, e.g. q=name~alice age>25 email:@example.com")
+	fmt.Println("  POST   /api/v1/users              - Create new user (needs a token)")
+	fmt.Println("  PUT    /api/v1/users/{id}         - Update user (needs a token)")
+	fmt.Println("  PATCH  /api/v1/users/{id}         - Patch user: merge patch or JSON Patch (needs a token)")
+	fmt.Println("  DELETE /api/v1/users/{id}         - Delete user (needs a token)")
+	fmt.Println("  POST   /api/v1/users/bulk         - Create a list of users, 207 with a result each (needs a token)")
+	fmt.Println("  DELETE /api/v1/users/bulk         - Delete a list of user IDs, 207 with a result each (needs a token)")
+	fmt.Println("  GET    /api/v1/users/events       - Stream creates, updates and deletes as Server-Sent Events")
+	fmt.Println("  GET    /api/v1/users/stream       - Stream made-up users as NDJSON (?count up to a million, ?delay)")
+	fmt.Println("  GET    /api/ws                    - The same changes over a WebSocket")
+	fmt.Println("  POST   /graphql                   - The same users as GraphQL: queries, mutations (need a token)")
+	fmt.Println("  GET    /graphql?query=            - A query, or a subscription to changes as Server-Sent Events")
+	fmt.Println("  POST   /api/auth/login            - Log in with email and password for a token")
+	fmt.Println("  GET    /api/auth/me               - Who the token, or session, belongs to")
+	fmt.Println("  GET    /auth/github/login         - Log in with GitHub for a session cookie (with -github-client-id)")
+	fmt.Println("  GET    /auth/github/callback      - Where GitHub sends you back")
+	fmt.Println("  POST   /auth/github/logout        - End the session")
+	fmt.Println("  GET    /api/invitations           - List invitations (?status=expired, ?expires_within=1h)")
+	fmt.Println("  POST   /api/invitations           - Invite an email address, for a TTL (needs a token)")
+	fmt.Println("  GET    /api/invitations/{token}   - Get an invitation (410 once expired)")
+	fmt.Println("  DELETE /api/invitations/{token}   - Revoke an invitation (needs a token)")
+	fmt.Println("  GET    /api/jobs                  - Welcome emails: pending, done, and dead letters")
+	fmt.Println("  GET    /api/health                - API health check")
+	fmt.Println("  GET    /healthz                   - Liveness: is the process up")
+	fmt.Println("  GET    /readyz                    - Readiness: are the store and dependencies up (503 if not)")
+	fmt.Println("  GET    /metrics                   - Request counts, latency histograms and errors for Prometheus")
+	fmt.Println("  GET    /api/openapi.json          - OpenAPI 3 description of the API (also at /api)")
+	fmt.Println("  GET    /api/docs                  - Swagger UI for trying the API in a browser")
+	fmt.Println("  GET    /api/problems/{type}       - What an error's problem type means")
+	fmt.Println("  GET    /api/admin/export          - Back up every user as JSON")
+	fmt.Println("  POST   /api/admin/import          - Restore users from a backup")
+	fmt.Println("  GET    /api/admin/metrics         - Latency and errors per route")
+	fmt.Println("  GET    /api/admin/quotas          - Requests used today per API key")
+	fmt.Println("  GET    /api/admin/quotas/{key}    - One API key's quota")
+	fmt.Println("  DELETE /api/admin/quotas/{key}    - Reset an API key's quota")
+	fmt.Println("  GET    /api/admin/keys            - List API keys")
+	fmt.Println("  POST   /api/admin/keys            - Issue a reader, writer or admin API key")
+	fmt.Println("  GET    /api/admin/keys/{id}       - Get an API key")
+	fmt.Println("  DELETE /api/admin/keys/{id}       - Revoke an API key")
+	fmt.Println("  Everything under /api/admin needs an admin API key in X-API-Key.")
 	fmt.Println("\nTest with curl:")
-	fmt.Println(`  curl http://localhost:8080/api/users`)
-	fmt.Println(`  curl -X POST -H "Content-Type: application/json" -d '{"name":"Alice","email":"alice@example.com","age":30}' http://localhost:8080/api/users`)
+	fmt.Printf("  curl %s/api/v1/users\n", url)
+	fmt.Printf("  curl %s/api/v2/users/1\n", url)
+	fmt.Printf("  curl -X POST -H \"X-API-Key: $ADMIN_KEY\" -d '{\"name\":\"ci\",\"role\":\"writer\"}' %s/api/admin/keys\n", url)
+	fmt.Printf("  curl -i -H \"X-API-Key: $KEY\" %s/api/v1/users   # counts against the key's quota\n", url)
+	fmt.Printf("  curl -N %s/api/v1/users/events   # then change a user from another terminal\n", url)
+	fmt.Printf("  curl -X POST -d '{\"email\":\"john@example.com\",\"password\":\"%s\"}' %s/api/auth/login\n", cfg.Password, url)
+	fmt.Printf("  curl -X POST -H \"Authorization: Bearer $TOKEN\" -H \"Content-Type: application/json\" -d '{\"name\":\"Alice\",\"email\":\"alice@example.com\",\"age\":30}' %s/api/v1/users\n", url)
 	fmt.Println("\nPress Ctrl+C to stop the server")
 	
-	log.Fatal(server.ListenAndServe())
-}
-
-func initializeData() {
-	// Initialize with sample users
-	users[1] = User{
-		ID:        1,
-		Name:      "John Doe",
-		Email:     "john@example.com",
-		Age:       25,
-		CreatedAt: time.Now().Add(-24 * time.Hour),
-		UpdatedAt: time.Now().Add(-24 * time.Hour),
+	// Serve until Ctrl+C or SIGTERM, then shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := Serve(ctx, server, listener); err != nil {
+		log.Printf("Error during shutdown: %v", err)
 	}
 	
-	users[2] = User{
-		ID:        2,
-		Name:      "Jane Smith",
-		Email:     "jane@example.com",
-		Age:       30,
-		CreatedAt: time.Now().Add(-12 * time.Hour),
-		UpdatedAt: time.Now().Add(-12 * time.Hour),
+	// Every request has finished, so the last save has everything
+	if err := stopAPI(); err != nil {
+		log.Printf("Failed to save users: %v", err)
+	} else if cfg.DataFile != "" {
+		fmt.Printf("Saved users to %s\n", cfg.DataFile)
 	}
-	
-	nextUserID = 3
 }
 
-func demonstratJSON() {
-	fmt.Println("\n--- JSON Demonstration ---")
+// shutdownTimeout is how long Serve waits for requests in flight once
+// it's told to stop; -shutdown-timeout sets it
+var shutdownTimeout = 10 * time.Second
+
+// Serve serves on listener until ctx is done, then shuts down gracefully:
+// no new connections, and up to shutdownTimeout for the requests already
+// being handled to finish, after which they're cut off. It returns nil
+// if they all finished. Lesson 09 explains it step by step.
+func Serve(ctx context.Context, server *http.Server, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	
+	fmt.Println("\nShutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.Join(fmt.Errorf("shutting down: %w", err), server.Close())
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Listen listens on port, or on any free port if port is 0. Pass the
+// listener to URL to find out which port it got.
+func Listen(port int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, fmt.Errorf("listening on port %d (try -port 0 for a free one): %w", port, err)
+	}
+	return listener, nil
+}
+
+// URL is the base URL of the API on listener
+func URL(listener net.Listener) string {
+	return fmt.Sprintf("http://localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+}
+
+func demonstratJSON(w io.Writer) {
+	fmt.Fprintln(w, "\n--- JSON Demonstration ---")
 	
 	// Create a user
-	user := User{
+	user := domain.User{
 		ID:        100,
 		Name:      "Demo User",
 		Email:     "demo@example.com",
 		Age:       28,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: clk.Now(),
+		UpdatedAt: clk.Now(),
 	}
 	
 	// Marshal to JSON
 	jsonData, err := json.Marshal(user)
 	if err != nil {
-		fmt.Printf("Error marshaling: %v\n", err)
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
 		return
 	}
-	fmt.Printf("Marshaled JSON: %s\n", string(jsonData))
+	fmt.Fprintf(w, "Marshaled JSON: %s\n", string(jsonData))
 	
 	// Marshal with indentation (pretty print)
 	prettyJSON, err := json.MarshalIndent(user, "", "  ")
 	if err != nil {
-		fmt.Printf("Error marshaling: %v\n", err)
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
 		return
 	}
-	fmt.Printf("Pretty JSON:\n%s\n", string(prettyJSON))
+	fmt.Fprintf(w, "Pretty JSON:\n%s\n", string(prettyJSON))
 	
 	// Unmarshal from JSON
 	jsonString := `{"id":200,"name":"Test User","email":"test@example.com","age":35,"created_at":"2024-01-01T10:00:00Z","updated_at":"2024-01-01T10:00:00Z"}`
-	var unmarshaledUser User
+	var unmarshaledUser domain.User
 	err = json.Unmarshal([]byte(jsonString), &unmarshaledUser)
 	if err != nil {
-		fmt.Printf("Error unmarshaling: %v\n", err)
+		fmt.Fprintf(w, "Error unmarshaling: %v\n", err)
 		return
 	}
-	fmt.Printf("Unmarshaled user: %+v\n", unmarshaledUser)
+	fmt.Fprintf(w, "Unmarshaled user: %+v\n", unmarshaledUser)
 	
 	// Working with maps
-	fmt.Println("\n--- JSON with Maps ---")
+	fmt.Fprintln(w, "\n--- JSON with Maps ---")
 	data := map[string]interface{}{
 		"name":    "Dynamic User",
 		"age":     42,
@@ -174,15 +373,15 @@ func demonstratJSON() {
 	}
 	
 	mapJSON, _ := json.MarshalIndent(data, "", "  ")
-	fmt.Printf("Map as JSON:\n%s\n", string(mapJSON))
+	fmt.Fprintf(w, "Map as JSON:\n%s\n", string(mapJSON))
 	
 	// Parse JSON into map
 	var parsedData map[string]interface{}
 	json.Unmarshal(mapJSON, &parsedData)
-	fmt.Printf("Parsed back: %+v\n", parsedData)
+	fmt.Fprintf(w, "Parsed back: %+v\n", parsedData)
 	
 	// Custom JSON tags demonstration
-	fmt.Println("\n--- Custom JSON Tags ---")
+	fmt.Fprintln(w, "\n--- Custom JSON Tags ---")
 	type Product struct {
 		ID          int     `json:"id"`
 		Name        string  `json:"product_name"`
@@ -201,315 +400,54 @@ func demonstratJSON() {
 	}
 	
 	productJSON, _ := json.MarshalIndent(product, "", "  ")
-	fmt.Printf("Product JSON:\n%s\n", string(productJSON))
-}
-
-func registerAPIRoutes(mux *http.ServeMux) {
-	// User routes
-	mux.HandleFunc("/api/users", handleUsers)
-	mux.HandleFunc("/api/users/", handleUser)
+	fmt.Fprintf(w, "Product JSON:\n%s\n", string(productJSON))
 	
-	// Health check
-	mux.HandleFunc("/api/health", handleHealth)
-	
-	// API documentation
-	mux.HandleFunc("/api", handleAPIDoc)
-}
-
-// Handle multiple users (GET /api/users, POST /api/users)
-func handleUsers(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		getAllUsers(w, r)
-	case http.MethodPost:
-		createUser(w, r)
-	default:
-		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	// Custom marshalers: a type with a MarshalJSON or UnmarshalJSON
+	// method decides its own JSON (see models/date.go)
+	fmt.Fprintln(w, "\n--- Custom Marshalers ---")
+	type Member struct {
+		Name      string      `json:"name"`
+		Birthdate models.Date `json:"birthdate"`
 	}
-}
-
-// Handle single user (GET, PUT, DELETE /api/users/{id})
-func handleUser(w http.ResponseWriter, r *http.Request) {
-	userID, err := extractUserID(r.URL.Path)
+	memberJSON, err := json.Marshal(Member{Name: "Demo User", Birthdate: models.NewDate(1996, time.May, 17)})
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
 		return
 	}
+	fmt.Fprintf(w, "A Date is just the day: %s\n", string(memberJSON))
 	
-	switch r.Method {
-	case http.MethodGet:
-		getUser(w, r, userID)
-	case http.MethodPut:
-		updateUser(w, r, userID)
-	case http.MethodDelete:
-		deleteUser(w, r, userID)
-	default:
-		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
-	}
-}
-
-// GET /api/users
-func getAllUsers(w http.ResponseWriter, r *http.Request) {
-	userList := make([]User, 0, len(users))
-	for _, user := range users {
-		userList = append(userList, user)
-	}
-	
-	respondWithJSON(w, http.StatusOK, APIResponse{
-		Success: true,
-		Data:    userList,
-		Message: fmt.Sprintf("Found %d users", len(userList)),
-	})
-}
-
-// GET /api/users/{id}
-func getUser(w http.ResponseWriter, r *http.Request, userID int) {
-	user, exists := users[userID]
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "User not found")
+	var member Member
+	if err := json.Unmarshal([]byte(`{"name":"Test User","birthdate":"1989-12-31"}`), &member); err != nil {
+		fmt.Fprintf(w, "Error unmarshaling: %v\n", err)
 		return
 	}
+	fmt.Fprintf(w, "Unmarshaled birthdate: %s, a %s\n", member.Birthdate, member.Birthdate.Weekday())
+	err = json.Unmarshal([]byte(`{"name":"Test User","birthdate":"31/12/1989"}`), &member)
+	fmt.Fprintf(w, "A birthdate in the wrong format: %v\n", err)
 	
-	respondWithJSON(w, http.StatusOK, APIResponse{
-		Success: true,
-		Data:    user,
-	})
-}
-
-// POST /api/users
-func createUser(w http.ResponseWriter, r *http.Request) {
-	var req CreateUserRequest
-	
-	// Read and parse JSON body
-	body, err := io.ReadAll(r.Body)
+	// The same user, as someone who hasn't logged in would see them
+	publicJSON, err := json.Marshal(models.PublicUser(user))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to read request body")
-		return
-	}
-	defer r.Body.Close()
-	
-	if err := json.Unmarshal(body, &req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
-		return
-	}
-	
-	// Validate request
-	if errors := validateCreateUserRequest(req); len(errors) > 0 {
-		respondWithValidationErrors(w, errors)
-		return
-	}
-	
-	// Create user
-	now := time.Now()
-	user := User{
-		ID:        nextUserID,
-		Name:      req.Name,
-		Email:     req.Email,
-		Age:       req.Age,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-	
-	users[nextUserID] = user
-	nextUserID++
-	
-	respondWithJSON(w, http.StatusCreated, APIResponse{
-		Success: true,
-		Data:    user,
-		Message: "User created successfully",
-	})
-}
-
-// PUT /api/users/{id}
-func updateUser(w http.ResponseWriter, r *http.Request, userID int) {
-	user, exists := users[userID]
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "User not found")
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
 		return
 	}
+	fmt.Fprintf(w, "Public user: %s\n", string(publicJSON))
 	
-	var req UpdateUserRequest
-	
-	body, err := io.ReadAll(r.Body)
+	// The same user in the other formats the API speaks (see
+	// handlers/negotiate.go): each has its own struct tags on domain.User
+	fmt.Fprintln(w, "\n--- The Same User as XML and YAML ---")
+	xmlData, err := xml.MarshalIndent(user, "", "  ")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to read request body")
-		return
-	}
-	defer r.Body.Close()
-	
-	if err := json.Unmarshal(body, &req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
 		return
 	}
+	fmt.Fprintf(w, "XML (%d bytes):\n%s\n", len(xmlData), string(xmlData))
 	
-	// Update fields if provided
-	if req.Name != nil {
-		user.Name = *req.Name
-	}
-	if req.Email != nil {
-		user.Email = *req.Email
-	}
-	if req.Age != nil {
-		user.Age = *req.Age
-	}
-	user.UpdatedAt = time.Now()
-	
-	users[userID] = user
-	
-	respondWithJSON(w, http.StatusOK, APIResponse{
-		Success: true,
-		Data:    user,
-		Message: "User updated successfully",
-	})
-}
-
-// DELETE /api/users/{id}
-func deleteUser(w http.ResponseWriter, r *http.Request, userID int) {
-	_, exists := users[userID]
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "User not found")
-		return
-	}
-	
-	delete(users, userID)
-	
-	respondWithJSON(w, http.StatusOK, APIResponse{
-		Success: true,
-		Message: "User deleted successfully",
-	})
-}
-
-// GET /api/health
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
-	}
-	
-	health := map[string]interface{}{
-		"status":     "healthy",
-		"timestamp":  time.Now().Format(time.RFC3339),
-		"users_count": len(users),
-		"version":    "1.0.0",
-	}
-	
-	respondWithJSON(w, http.StatusOK, health)
-}
-
-// GET /api
-func handleAPIDoc(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	yamlData, err := yaml.Marshal(user)
+	if err != nil {
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
 		return
 	}
-	
-	doc := map[string]interface{}{
-		"name":        "User Management API",
-		"version":     "1.0.0",
-		"description": "RESTful API for managing users with JSON",
-		"endpoints": map[string]interface{}{
-			"GET /api/users":       "Get all users",
-			"GET /api/users/{id}":  "Get user by ID",
-			"POST /api/users":      "Create new user",
-			"PUT /api/users/{id}":  "Update user",
-			"DELETE /api/users/{id}": "Delete user",
-			"GET /api/health":      "API health check",
-		},
-	}
-	
-	respondWithJSON(w, http.StatusOK, doc)
-}
-
-// Helper functions
-
-func extractUserID(path string) (int, error) {
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) < 3 {
-		return 0, fmt.Errorf("invalid path")
-	}
-	return strconv.Atoi(parts[2])
-}
-
-func validateCreateUserRequest(req CreateUserRequest) []ValidationError {
-	var errors []ValidationError
-	
-	if strings.TrimSpace(req.Name) == "" {
-		errors = append(errors, ValidationError{
-			Field:   "name",
-			Message: "Name is required",
-		})
-	}
-	
-	if strings.TrimSpace(req.Email) == "" {
-		errors = append(errors, ValidationError{
-			Field:   "email",
-			Message: "Email is required",
-		})
-	} else if !strings.Contains(req.Email, "@") {
-		errors = append(errors, ValidationError{
-			Field:   "email",
-			Message: "Invalid email format",
-		})
-	}
-	
-	if req.Age < 0 || req.Age > 150 {
-		errors = append(errors, ValidationError{
-			Field:   "age",
-			Message: "Age must be between 0 and 150",
-		})
-	}
-	
-	return errors
-}
-
-func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON: %v", err)
-	}
+	fmt.Fprintf(w, "YAML (%d bytes):\n%s", len(yamlData), string(yamlData))
+	fmt.Fprintf(w, "JSON (%d bytes), for comparison: %s\n", len(jsonData), string(jsonData))
 }
-
-func respondWithError(w http.ResponseWriter, statusCode int, message string) {
-	errorResp := ErrorResponse{
-		Error: message,
-	}
-	respondWithJSON(w, statusCode, errorResp)
-}
-
-func respondWithValidationErrors(w http.ResponseWriter, errors []ValidationError) {
-	errorResp := ErrorResponse{
-		Error:   "Validation failed",
-		Details: errors,
-	}
-	respondWithJSON(w, http.StatusBadRequest, errorResp)
-}
-
-// Middleware
-
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		
-		next.ServeHTTP(w, r)
-		
-		log.Printf("Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
-	})
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		
-		next.ServeHTTP(w, r)
-	})
-}
\ No newline at end of file
@@ -0,0 +1,237 @@
+// Package middleware is lesson 10's own HTTP middleware: request timing
+// and metrics, per-client rate limits and per-key daily quotas. Unlike
+// lab/httpmw's, each takes what it counts into, and how to tell clients
+// apart, as arguments, so tests can give it their own.
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/httpmw"
+)
+
+// routeStats are the running totals for one route
+type routeStats struct {
+	requests     int64
+	clientErrors int64 // 4xx responses
+	serverErrors int64 // 5xx responses
+	total        time.Duration
+	max          time.Duration
+	statuses     map[int]int64 // requests by status code
+	buckets      []int64       // requests by the first of durationBuckets they took no longer than
+}
+
+// Metrics holds per-route timings. It's a mutex around a map: handlers
+// run concurrently, and every request updates it.
+type Metrics struct {
+	mu       sync.Mutex
+	routes   map[string]*routeStats
+	inFlight atomic.Int64 // requests started and not yet finished
+}
+
+// NewMetrics returns an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{routes: make(map[string]*routeStats)}
+}
+
+// Record counts one request to route that was answered with status after
+// elapsed
+func (m *Metrics) Record(route string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats, ok := m.routes[route]
+	if !ok {
+		stats = &routeStats{statuses: make(map[int]int64), buckets: make([]int64, len(durationBuckets))}
+		m.routes[route] = stats
+	}
+	stats.requests++
+	stats.total += elapsed
+	stats.max = max(stats.max, elapsed)
+	stats.statuses[status]++
+	for i, bound := range durationBuckets {
+		if elapsed <= bound {
+			stats.buckets[i]++
+			break
+		}
+	}
+	switch {
+	case status >= 500:
+		stats.serverErrors++
+	case status >= 400:
+		stats.clientErrors++
+	}
+}
+
+// RouteMetrics is one route's totals, as Snapshot reports them
+type RouteMetrics struct {
+	Route        string  `json:"route"`
+	Requests     int64   `json:"requests"`
+	ClientErrors int64   `json:"client_errors"`
+	ServerErrors int64   `json:"server_errors"`
+	ErrorRate    float64 `json:"error_rate"` // server errors per request
+	AvgMillis    float64 `json:"avg_ms"`
+	MaxMillis    float64 `json:"max_ms"`
+}
+
+// Snapshot copies the totals out, sorted by route
+func (m *Metrics) Snapshot() []RouteMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]RouteMetrics, 0, len(m.routes))
+	for route, stats := range m.routes {
+		list = append(list, RouteMetrics{
+			Route:        route,
+			Requests:     stats.requests,
+			ClientErrors: stats.clientErrors,
+			ServerErrors: stats.serverErrors,
+			ErrorRate:    float64(stats.serverErrors) / float64(stats.requests),
+			AvgMillis:    millis(stats.total / time.Duration(stats.requests)),
+			MaxMillis:    millis(stats.max),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Route < list[j].Route })
+	return list
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// pathParams names the segment after each collection whose members aren't
+// numbered, for RouteOf
+var pathParams = map[string]string{
+	"invitations": "{token}",
+	"quotas":      "{key}",
+	"keys":        "{id}",
+}
+
+// RouteOf names the route a request matched, with IDs, tokens and keys
+// replaced so that /api/users/1 and /api/users/2 count as one route
+func RouteOf(r *http.Request) string {
+	parts := strings.Split(r.URL.Path, "/")
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			parts[i] = "{id}"
+		} else if i > 0 && part != "" && pathParams[parts[i-1]] != "" {
+			parts[i] = pathParams[parts[i-1]]
+		}
+	}
+	return r.Method + " " + strings.Join(parts, "/")
+}
+
+// serverTiming collects the phases of one request for the Server-Timing
+// header, which browser devtools show under the request's Timing tab
+type serverTiming struct {
+	mu     sync.Mutex
+	clk    clock.Clock
+	start  time.Time
+	phases []string
+}
+
+type serverTimingKey struct{}
+
+// TimePhase records how long a phase of the request took, from start
+// until now, as a Server-Timing entry. Outside Timing it does nothing.
+func TimePhase(ctx context.Context, name string, start time.Time) {
+	timing, ok := ctx.Value(serverTimingKey{}).(*serverTiming)
+	if !ok {
+		return
+	}
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	timing.phases = append(timing.phases, fmt.Sprintf("%s;dur=%.3f", name, millis(timing.clk.Since(start))))
+}
+
+// header is the Server-Timing value: the recorded phases, then the
+// total so far
+func (t *serverTiming) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := append(append([]string(nil), t.phases...), fmt.Sprintf("total;dur=%.3f", millis(t.clk.Since(t.start))))
+	return strings.Join(entries, ", ")
+}
+
+// timingWriter adds the Server-Timing header just before the response
+// header goes out, the last moment it can, and remembers the status
+type timingWriter struct {
+	http.ResponseWriter
+	timing      *serverTiming
+	status      int
+	wroteHeader bool
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.status = status
+		tw.Header().Set("Server-Timing", tw.timing.header())
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(p []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController find the writer underneath
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// Hijack lets GET /api/ws take the connection over for a WebSocket. The
+// 101 Switching Protocols goes out on the hijacked connection, so it's
+// recorded here.
+func (tw *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: ResponseWriter doesn't support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		tw.status, tw.wroteHeader = http.StatusSwitchingProtocols, true
+	}
+	return conn, rw, err
+}
+
+// Flush keeps streams like GET /api/users/events streaming. Middleware
+// outside this one, like httpmw.Recover's, calls it directly rather than
+// through Unwrap.
+func (tw *timingWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Timing records every request's latency and status in m, counts it in
+// flight while it runs, and sends a Server-Timing header with its phases.
+// clk is where it gets the time.
+func Timing(m *Metrics, clk clock.Clock) httpmw.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.inFlight.Add(1)
+			defer m.inFlight.Add(-1)
+			timing := &serverTiming{clk: clk, start: clk.Now()}
+			tw := &timingWriter{ResponseWriter: w, timing: timing, status: http.StatusOK}
+			next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, timing)))
+			m.Record(RouteOf(r), tw.status, clk.Since(timing.start))
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+func TestRouteOf(t *testing.T) {
+	for target, want := range map[string]string{
+		"/api/users":              "GET /api/users",
+		"/api/v2/users/42":        "GET /api/v2/users/{id}",
+		"/api/invitations/abc123": "GET /api/invitations/{token}",
+		"/api/admin/quotas/k_1":   "GET /api/admin/quotas/{key}",
+		"/api/admin/keys/k_1":     "GET /api/admin/keys/{id}",
+		"/api/admin/keys/":        "GET /api/admin/keys/",
+	} {
+		if got := RouteOf(httptest.NewRequest("GET", target, nil)); got != want {
+			t.Errorf("RouteOf(%s) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Record("GET /slow", 500, 3*time.Millisecond)
+	m.Record("GET /slow", 200, time.Millisecond)
+	m.Record("GET /fast", 404, 0)
+	got := m.Snapshot()
+	if len(got) != 2 || got[0].Route != "GET /fast" || got[1].Route != "GET /slow" {
+		t.Fatalf("Snapshot = %+v, want GET /fast and GET /slow in order", got)
+	}
+	if got[0].ClientErrors != 1 || got[0].ErrorRate != 0 {
+		t.Errorf("GET /fast = %+v, want a client error and no server errors", got[0])
+	}
+	if slow := got[1]; slow.ErrorRate != 0.5 || slow.AvgMillis != 2 || slow.MaxMillis != 3 {
+		t.Errorf("GET /slow = %+v, want an error rate of 0.5, 2ms average and 3ms max", slow)
+	}
+}
+
+// TestTiming checks the Server-Timing header and that the request is
+// recorded under its route. The clock moves only when the handler says,
+// so the durations are exact.
+func TestTiming(t *testing.T) {
+	fake := clock.NewFake(demo.Clock)
+	m := NewMetrics()
+	handler := Timing(m, fake)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := fake.Now()
+		fake.Advance(2 * time.Millisecond)
+		TimePhase(r.Context(), "db", start)
+		fake.Advance(time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/users/7", nil))
+	if got := rec.Header().Get("Server-Timing"); got != "db;dur=2.000, total;dur=3.000" {
+		t.Errorf("Server-Timing = %q", got)
+	}
+	got := m.Snapshot()
+	if len(got) != 1 || got[0].Route != "POST /api/users/{id}" || got[0].MaxMillis != 3 {
+		t.Errorf("Snapshot = %+v, want one request to POST /api/users/{id} taking 3ms", got)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := NewMetrics()
+	m.Record("GET /a\"b", 200, 30*time.Millisecond)
+	m.Record("GET /a\"b", 200, time.Minute)
+	var buf strings.Builder
+	m.WritePrometheus(&buf)
+	for _, line := range []string{
+		`golab_http_request_duration_seconds_bucket{method="GET",route="/a\"b",le="0.025"} 0`,
+		`golab_http_request_duration_seconds_bucket{method="GET",route="/a\"b",le="0.05"} 1`,
+		`golab_http_request_duration_seconds_bucket{method="GET",route="/a\"b",le="10"} 1`,
+		`golab_http_request_duration_seconds_bucket{method="GET",route="/a\"b",le="+Inf"} 2`,
+		`golab_http_request_duration_seconds_sum{method="GET",route="/a\"b"} 60.03`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("the histogram is missing %s:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	fake := clock.NewFake(demo.Clock)
+	limiter := NewRateLimiter(2, 3) // 2 a second, in bursts of 3
+	for i := 0; i < 3; i++ {
+		if _, _, ok := limiter.Allow("a", fake.Now()); !ok {
+			t.Fatalf("request %d was refused, want the burst allowed", i+1)
+		}
+	}
+	if _, retryAfter, ok := limiter.Allow("a", fake.Now()); ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("request over the limit = %v, retry after %v; want refused for 0.5s", ok, retryAfter)
+	}
+	if _, _, ok := limiter.Allow("b", fake.Now()); !ok {
+		t.Error("another client was refused, want its own bucket")
+	}
+	// A clock that goes backwards earns no tokens
+	if _, _, ok := limiter.Allow("a", fake.Now().Add(-time.Hour)); ok {
+		t.Error("a request from the past got a token")
+	}
+
+	// Full buckets are evicted; a's isn't full yet
+	fake.Advance(time.Second)
+	if n := limiter.Evict(fake.Now()); n != 1 {
+		t.Errorf("Evict deleted %d buckets, want b's", n)
+	}
+	stop := StartEvictor(limiter, fake, EvictInterval)
+	defer stop()
+	fake.BlockUntil(1)
+	fake.Advance(EvictInterval)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		limiter.mu.Lock()
+		n := len(limiter.buckets)
+		limiter.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the evictor left %d buckets", n)
+		}
+	}
+	stop()
+}
+
+// TestRateLimit checks the middleware's headers, and that a refused
+// request goes to limited rather than the handler
+func TestRateLimit(t *testing.T) {
+	fake := clock.NewFake(demo.Clock)
+	limited := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) }
+	handler := RateLimit(NewRateLimiter(1, 1), fake, func(*http.Request) string { return "everyone" }, limited)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "1" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("first request = %d %v", rec.Code, rec.Header())
+	}
+	fake.Advance(100 * time.Millisecond)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("second request = %d, Retry-After %q; want 429 and 1, rounded up", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	now := demo.Clock // 09:00 UTC
+	quotas := NewQuotas(2)
+	for i, want := range []int{1, 0} {
+		if status, ok := quotas.Take("a", now); !ok || status.Remaining != want {
+			t.Errorf("request %d = %+v, %v; want allowed with %d remaining", i+1, status, ok, want)
+		}
+	}
+	status, ok := quotas.Take("a", now)
+	if ok || status.Used != 2 || !status.ResetsAt.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("request over quota = %+v, %v; want refused until midnight", status, ok)
+	}
+	if got := quotas.Get("b", now); got.Used != 0 || got.Remaining != 2 {
+		t.Errorf("an unused key = %+v, want its whole quota", got)
+	}
+	if got := quotas.List(now); len(got) != 1 || got[0].Key != "a" {
+		t.Errorf("List = %+v, want just a", got)
+	}
+
+	// The count starts over at midnight, or when an admin resets it
+	if got := quotas.Get("a", now.Add(15*time.Hour)); got.Used != 0 {
+		t.Errorf("a's quota the next day = %+v, want it back in full", got)
+	}
+	if !quotas.Reset("a") || quotas.Reset("a") {
+		t.Error("Reset = false for a used key, or true for one already reset")
+	}
+	if _, ok := quotas.Take("a", now); !ok {
+		t.Error("request after a reset was refused")
+	}
+}
+
+func TestTenant(t *testing.T) {
+	var got string
+	handler := Tenant(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad tenant", http.StatusBadRequest)
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = TenantFrom(r.Context())
+	}))
+	for _, tt := range []struct {
+		header, tenant string
+		status         int
+	}{
+		{"", store.DefaultTenant, http.StatusOK},
+		{"acme", "acme", http.StatusOK},
+		{"Acme_2-eu", "Acme_2-eu", http.StatusOK},
+		{"-acme", "", http.StatusBadRequest},
+		{"acme corp", "", http.StatusBadRequest},
+		{"../acme", "", http.StatusBadRequest},
+		{strings.Repeat("a", 64), "", http.StatusBadRequest},
+	} {
+		got = ""
+		r := httptest.NewRequest("GET", "/api/users", nil)
+		if tt.header != "" {
+			r.Header.Set(TenantHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.status || got != tt.tenant {
+			t.Errorf("%s %q: %d for tenant %q, want %d for %q", TenantHeader, tt.header, rec.Code, got, tt.status, tt.tenant)
+		}
+		if rec.Header().Get("Vary") != TenantHeader {
+			t.Errorf("%s %q: Vary = %q", TenantHeader, tt.header, rec.Header().Get("Vary"))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WritePrometheus writes the same numbers as Snapshot in the Prometheus
+// text format, for a Prometheus server to scrape every few seconds and
+// graph. The format is simple enough to write by hand, which
+// saves depending on the client library: a # HELP and # TYPE line per
+// metric, then one line per set of labels.
+//
+//	golab_http_requests_total{method="GET",route="/api/users/{id}",code="200"} 2
+//
+// Prometheus works out rates and percentiles itself, so the numbers are
+// running totals: request and error counts, and a latency histogram,
+// which counts requests by how long they took. Routes are the ones
+// RouteOf names, so a label can't take a value per user.
+
+// durationBuckets are the histogram's upper bounds, Prometheus's default
+// ones, from 5ms to 10s
+var durationBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// PrometheusContentType is version 0.0.4 of the text format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes every metric in m, routes sorted so the output
+// is the same from one scrape to the next
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	routes := make([]string, 0, len(m.routes))
+	for route := range m.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	fmt.Fprint(w, "# HELP golab_http_requests_total Requests handled, by route and status code.\n")
+	fmt.Fprint(w, "# TYPE golab_http_requests_total counter\n")
+	for _, route := range routes {
+		stats := m.routes[route]
+		codes := make([]int, 0, len(stats.statuses))
+		for code := range stats.statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "golab_http_requests_total{%s,code=\"%d\"} %d\n", routeLabels(route), code, stats.statuses[code])
+		}
+	}
+
+	fmt.Fprint(w, "# HELP golab_http_request_errors_total Requests answered with a 4xx (client) or 5xx (server) status.\n")
+	fmt.Fprint(w, "# TYPE golab_http_request_errors_total counter\n")
+	for _, route := range routes {
+		stats := m.routes[route]
+		fmt.Fprintf(w, "golab_http_request_errors_total{%s,class=\"client\"} %d\n", routeLabels(route), stats.clientErrors)
+		fmt.Fprintf(w, "golab_http_request_errors_total{%s,class=\"server\"} %d\n", routeLabels(route), stats.serverErrors)
+	}
+
+	fmt.Fprint(w, "# HELP golab_http_request_duration_seconds How long requests took to handle.\n")
+	fmt.Fprint(w, "# TYPE golab_http_request_duration_seconds histogram\n")
+	for _, route := range routes {
+		stats, labels := m.routes[route], routeLabels(route)
+		// Each bucket counts every request up to its bound, so they add up
+		var cumulative int64
+		for i, bound := range durationBuckets {
+			cumulative += stats.buckets[i]
+			fmt.Fprintf(w, "golab_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound.Seconds()), cumulative)
+		}
+		fmt.Fprintf(w, "golab_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, stats.requests)
+		fmt.Fprintf(w, "golab_http_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(stats.total.Seconds()))
+		fmt.Fprintf(w, "golab_http_request_duration_seconds_count{%s} %d\n", labels, stats.requests)
+	}
+
+	fmt.Fprint(w, "# HELP golab_http_requests_in_flight Requests being handled now, open event streams included.\n")
+	fmt.Fprint(w, "# TYPE golab_http_requests_in_flight gauge\n")
+	fmt.Fprintf(w, "golab_http_requests_in_flight %d\n", m.inFlight.Load())
+}
+
+// routeLabels turns a route like "GET /api/users/{id}" into its method
+// and route labels
+func routeLabels(route string) string {
+	method, path, _ := strings.Cut(route, " ")
+	return fmt.Sprintf("method=%s,route=%s", labelValue(method), labelValue(path))
+}
+
+// labelValue quotes s as the text format wants: only backslash, double
+// quote and newline are escaped, so it isn't quite Go's %q
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/httpmw"
+)
+
+// DefaultDailyQuota is how many requests an API key may make per day
+// unless -quota says otherwise
+const DefaultDailyQuota = 1000
+
+// Quotas counts each API key's requests in the current UTC day.
+//
+// A quota is not a rate limit: a rate limit smooths traffic over seconds
+// to protect the server, while a quota caps how much of the API one
+// client may use in a billing period, however evenly they spread it.
+type Quotas struct {
+	mu    sync.Mutex
+	limit int
+	usage map[string]*quotaUsage
+}
+
+type quotaUsage struct {
+	day  time.Time // midnight UTC at the start of the day counted
+	used int
+}
+
+// NewQuotas returns quotas of limit requests a day
+func NewQuotas(limit int) *Quotas {
+	return &Quotas{limit: limit, usage: make(map[string]*quotaUsage)}
+}
+
+// QuotaStatus is one API key's quota, as the admin endpoints report it
+// and the X-Quota-* headers send it
+type QuotaStatus struct {
+	Key       string    `json:"key"`
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// dayStart is midnight UTC on the day of t; every quota resets then
+func dayStart(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// status reports usage for key at now. Counts from an earlier day read as
+// zero; they're reset when the key is next used.
+func (s *Quotas) status(key string, now time.Time) QuotaStatus {
+	day := dayStart(now)
+	used := 0
+	if usage, ok := s.usage[key]; ok && usage.day.Equal(day) {
+		used = usage.used
+	}
+	return QuotaStatus{
+		Key:       key,
+		Limit:     s.limit,
+		Used:      used,
+		Remaining: max(s.limit-used, 0),
+		ResetsAt:  day.Add(24 * time.Hour),
+	}
+}
+
+// Take counts one request against key, unless its quota is used up, and
+// reports whether it was allowed along with the quota afterwards
+func (s *Quotas) Take(key string, now time.Time) (QuotaStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := dayStart(now)
+	usage, ok := s.usage[key]
+	if !ok || !usage.day.Equal(day) {
+		usage = &quotaUsage{day: day}
+		s.usage[key] = usage
+	}
+	if usage.used >= s.limit {
+		return s.status(key, now), false
+	}
+	usage.used++
+	return s.status(key, now), true
+}
+
+// Get returns key's quota without using any of it
+func (s *Quotas) Get(key string, now time.Time) QuotaStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status(key, now)
+}
+
+// List returns the quota of every key seen, sorted by key
+func (s *Quotas) List(now time.Time) []QuotaStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]QuotaStatus, 0, len(s.usage))
+	for key := range s.usage {
+		list = append(list, s.status(key, now))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Reset gives key its whole quota back and reports whether it had used any
+func (s *Quotas) Reset(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.usage[key]
+	delete(s.usage, key)
+	return ok
+}
+
+// Quota counts every request that key names a client for against the
+// client's daily quota in q, and answers with exceeded once it is used
+// up. Requests key returns false for aren't counted.
+func Quota(q *Quotas, clk clock.Clock, key func(*http.Request) (string, bool), exceeded http.HandlerFunc) httpmw.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := key(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := clk.Now()
+			status, ok := q.Take(id, now)
+			w.Header().Set("X-Quota-Limit", strconv.Itoa(status.Limit))
+			w.Header().Set("X-Quota-Remaining", strconv.Itoa(status.Remaining))
+			w.Header().Set("X-Quota-Reset", status.ResetsAt.Format(time.RFC3339))
+			if !ok {
+				// Round up, so a client that waits this long finds the quota reset
+				retryAfter := (status.ResetsAt.Sub(now) + time.Second - 1) / time.Second
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+				exceeded(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/httpmw"
+)
+
+// A rate limit protects the server from any one client sending requests
+// faster than it can serve everybody. Each client gets a token bucket:
+// it holds up to burst tokens, refills at rate tokens a second, and every
+// request takes one. A client can burst up to the bucket's size, then
+// keeps going only as fast as it refills; an empty bucket means 429 until
+// the next token arrives. (The daily quota in quota.go is the other kind
+// of limit: how much, rather than how fast.)
+const (
+	// DefaultRate and DefaultBurst are the limits unless -rate and
+	// -burst say otherwise: 50 requests a second, in bursts of up to 100
+	DefaultRate  = 50
+	DefaultBurst = 100
+	// EvictInterval is how often idle buckets are deleted
+	EvictInterval = time.Minute
+)
+
+// RateLimiter keeps a token bucket per client
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   int     // most tokens a bucket holds
+	buckets map[string]*bucket
+}
+
+// bucket is one client's tokens as of last; the refill since then is
+// worked out when the client next asks, so nothing has to tick
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter that refills each bucket at rate tokens
+// a second, up to burst
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{rate: rate, burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// refill adds the tokens b has earned by now. A clock that went backwards
+// earns nothing.
+func (l *RateLimiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+}
+
+// Allow takes a token from key's bucket at now if it has one. It returns
+// the whole tokens left and, if there was none to take, how long until
+// there will be.
+func (l *RateLimiter) Allow(key string, now time.Time) (remaining int, retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, found := l.buckets[key]
+	if !found {
+		// A new client starts with a full bucket
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return 0, wait, false
+	}
+	b.tokens--
+	return int(b.tokens), 0, true
+}
+
+// Evict deletes the buckets that have refilled completely by now and
+// returns how many it deleted. A full bucket is just what a new client
+// gets, so forgetting one changes nothing; without this the map would
+// keep every client that ever called.
+func (l *RateLimiter) Evict(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.burst) {
+			delete(l.buckets, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Burst is the most tokens a bucket holds, and so the most requests a
+// client can make at once
+func (l *RateLimiter) Burst() int {
+	return l.burst
+}
+
+// StartEvictor evicts idle buckets from l every interval of clk until the
+// returned stop function is called. stop waits for an eviction in
+// progress to finish.
+func StartEvictor(l *RateLimiter, clk clock.Clock, interval time.Duration) (stop func()) {
+	ticker := clk.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if n := l.Evict(now); n > 0 {
+					log.Printf("Evicted %d idle rate limit bucket(s)", n)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// RateLimit takes a token from l for every request, from the bucket key
+// names, and tells every client how many requests it has left. A client
+// whose bucket is empty gets a Retry-After header and limited instead of
+// the handler.
+func RateLimit(l *RateLimiter, clk clock.Clock, key func(*http.Request) string, limited http.HandlerFunc) httpmw.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remaining, retryAfter, ok := l.Allow(key(r), clk.Now())
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !ok {
+				// Retry-After is in whole seconds; round up, so a client that
+				// waits this long finds a token
+				w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+				limited(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
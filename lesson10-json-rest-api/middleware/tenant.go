@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"golang-lab/lab/httpmw"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// TenantHeader names the tenant a request is for. A request without it
+// is for store.DefaultTenant.
+const TenantHeader = "X-Tenant-ID"
+
+// validTenant is what a tenant ID may look like: short, and safe to put
+// in a log line or a file name
+var validTenant = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,62}$`)
+
+type tenantKey struct{}
+
+// Tenant reads the tenant a request is for from its X-Tenant-ID header,
+// and puts it in the request's context for TenantFrom, where the store
+// (see store.Tenanted) finds it. A request whose header isn't a tenant
+// ID is answered with invalid.
+//
+// The header is taken at its word, which is only right behind a gateway
+// that sets it from who the caller is, and drops any the caller sent.
+// Tokens carry their tenant too, so one can't be used with another
+// tenant's header (see requireAuth).
+func Tenant(invalid http.HandlerFunc) httpmw.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The same URL answers differently for each tenant, so caches
+			// must keep them apart
+			w.Header().Add("Vary", TenantHeader)
+			tenant := r.Header.Get(TenantHeader)
+			if tenant == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validTenant.MatchString(tenant) {
+				invalid(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+		})
+	}
+}
+
+// WithTenant returns a copy of ctx for tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom is the tenant ctx is for: the one Tenant or WithTenant put
+// there, or else store.DefaultTenant
+func TenantFrom(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return store.DefaultTenant
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Claims is what a token says about its holder
+type Claims struct {
+	// Subject is the user's ID; RFC 7519 makes it a string
+	Subject   string `json:"sub"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Issuer    string `json:"iss"`
+	IssuedAt  int64  `json:"iat"` // Unix seconds
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+	// Tenant is the tenant whose user Subject is, if not the default
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// UserID is the ID of the user the token was issued to, or 0 if the
+// subject isn't one. The handlers refuse tokens like that; a GitHub
+// login's claims, whose subject is "github:" and the account's ID, have
+// no token to refuse.
+func (c Claims) UserID() int {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// LoginRequest is the body of POST /api/auth/login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// TokenResponse is what a successful login returns
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateLayout is how a Date is written: the day alone, with no time or
+// zone
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day, like a birthday. A time.Time would marshal as
+// a whole RFC 3339 timestamp, 1990-05-17T00:00:00Z, and a client in
+// another zone could show it as the 16th; a Date is just "1990-05-17".
+// The zero Date is no date at all, and marshals as null.
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the given day
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate reads a day written as DateLayout
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("dates are YYYY-MM-DD: %w", err)
+	}
+	return Date{t}, nil
+}
+
+// String is the day as DateLayout
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+// MarshalJSON implements json.Marshaler. Without it, the time.Time
+// embedded in Date would marshal itself, time of day and all.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It takes a pointer, since it
+// changes d; null leaves d as it is, as it does for the built-in types.
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("a date is a string, like %q", DateLayout)
+	}
+	date, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+const (
+	// DefaultInvitationTTL is how long an invitation lasts if the request
+	// doesn't say
+	DefaultInvitationTTL = 72 * time.Hour
+	// MaxInvitationTTL caps how long an invitation may last
+	MaxInvitationTTL = 30 * 24 * time.Hour
+)
+
+// Invitation is a token that lets someone sign up, until it expires
+type Invitation struct {
+	Token     string    `json:"token"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the invitation's expiry time has passed
+func (inv Invitation) Expired(now time.Time) bool {
+	return !now.Before(inv.ExpiresAt)
+}
+
+// CreateInvitationRequest is the body of POST /api/invitations
+type CreateInvitationRequest struct {
+	Email string `json:"email"`
+	TTL   string `json:"ttl,omitempty"` // Go duration, e.g. "24h"
+}
+
+// Validate checks the request and returns the TTL it asks for
+func (req CreateInvitationRequest) Validate() (time.Duration, []domain.ValidationError) {
+	var errors []domain.ValidationError
+	if !domain.ValidEmail(req.Email) {
+		errors = append(errors, domain.ValidationError{Field: "email", Message: "Invalid email format"})
+	}
+
+	ttl := DefaultInvitationTTL
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > MaxInvitationTTL {
+			errors = append(errors, domain.ValidationError{
+				Field:   "ttl",
+				Message: "TTL must be a positive duration up to 720h, e.g. \"24h\"",
+			})
+		}
+	}
+	return ttl, errors
+}
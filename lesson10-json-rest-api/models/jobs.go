@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// The states of a Job
+const (
+	JobQueued   = "queued"   // waiting for a worker
+	JobRunning  = "running"  // a worker has it
+	JobRetrying = "retrying" // failed, and waiting until RetryAt to go back on the queue
+	JobDone     = "done"
+	JobDead     = "dead" // failed every attempt, or never got on the queue
+)
+
+// Job is work the API does in the background, after the request that
+// asked for it has been answered: for now, welcoming a new user by email
+type Job struct {
+	ID        int        `json:"id"`
+	Kind      string     `json:"kind"`
+	UserID    int        `json:"user_id"`
+	To        string     `json:"to"`
+	Subject   string     `json:"subject"`
+	Tenant    string     `json:"tenant"` // whose user UserID is
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"` // why the last attempt failed
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// JobQueueStatus is the data of GET /api/jobs. The counts cover every job
+// since the server started; the lists only the latest finished ones. The
+// queue is the server's, not a tenant's, so both cover every tenant.
+type JobQueueStatus struct {
+	Workers  int `json:"workers"`
+	Queued   int `json:"queued"`
+	Running  int `json:"running"`
+	Retrying int `json:"retrying"`
+	Done     int `json:"done"`
+	Dead     int `json:"dead"`
+
+	Pending     []Job `json:"pending"`      // queued, running or retrying, oldest first
+	Finished    []Job `json:"finished"`     // the latest done, newest first
+	DeadLetters []Job `json:"dead_letters"` // the latest dead, newest first
+}
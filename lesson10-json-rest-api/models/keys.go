@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// Role is what an API key may do. Each role may do everything the roles
+// before it may.
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleWriter Role = "writer"
+	RoleAdmin  Role = "admin"
+)
+
+// roles are the roles, least allowed first
+var roles = []Role{RoleReader, RoleWriter, RoleAdmin}
+
+// rank is where r comes in roles, or -1 for a role that doesn't exist
+func (r Role) rank() int {
+	for i, role := range roles {
+		if role == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Allows reports whether r may do what need may
+func (r Role) Allows(need Role) bool {
+	return r.rank() >= need.rank() && need.rank() >= 0
+}
+
+// APIKey is an issued key, without the key itself. The hash is never
+// sent, but the MongoDB store keeps it.
+type APIKey struct {
+	ID        string     `json:"id" bson:"_id"`
+	Name      string     `json:"name" bson:"name"` // who or what it's for
+	Role      Role       `json:"role" bson:"role"`
+	Hash      string     `json:"-" bson:"hash"` // hex SHA-256 of the key
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// IssueKeyRequest is the body of POST /api/admin/keys
+type IssueKeyRequest struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// Validate checks the request
+func (req IssueKeyRequest) Validate() []domain.ValidationError {
+	var errs []domain.ValidationError
+	if strings.TrimSpace(req.Name) == "" {
+		errs = append(errs, domain.ValidationError{Field: "name", Message: "Name is required"})
+	}
+	if req.Role.rank() < 0 {
+		errs = append(errs, domain.ValidationError{Field: "role", Message: "Role must be reader, writer or admin"})
+	}
+	return errs
+}
+
+// IssuedKey is an issued key with the key itself, which is only ever
+// sent this once
+type IssuedKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang-lab/lab/domain"
+)
+
+// fields are the fields errs complain about, in order
+func fields(errs []domain.ValidationError) []string {
+	var names []string
+	for _, e := range errs {
+		names = append(names, e.Field)
+	}
+	return names
+}
+
+func TestRoleAllows(t *testing.T) {
+	for _, tt := range []struct {
+		role, need Role
+		want       bool
+	}{
+		{RoleAdmin, RoleReader, true},
+		{RoleWriter, RoleWriter, true},
+		{RoleWriter, RoleAdmin, false},
+		{RoleReader, RoleWriter, false},
+		{Role("owner"), RoleReader, false},
+		{RoleAdmin, Role("owner"), false},
+	} {
+		if got := tt.role.Allows(tt.need); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.need, got, tt.want)
+		}
+	}
+}
+
+func TestIssueKeyRequest(t *testing.T) {
+	for _, tt := range []struct {
+		req  IssueKeyRequest
+		want []string
+	}{
+		{IssueKeyRequest{Name: "ci", Role: RoleWriter}, nil},
+		{IssueKeyRequest{Name: "  ", Role: RoleReader}, []string{"name"}},
+		{IssueKeyRequest{Name: "ci", Role: "root"}, []string{"role"}},
+		{IssueKeyRequest{}, []string{"name", "role"}},
+	} {
+		if got := fields(tt.req.Validate()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: errors for %v, want %v", tt.req, got, tt.want)
+		}
+	}
+}
+
+func TestCreateInvitationRequest(t *testing.T) {
+	for _, tt := range []struct {
+		req     CreateInvitationRequest
+		wantTTL time.Duration
+		want    []string
+	}{
+		{CreateInvitationRequest{Email: "ann@example.com"}, DefaultInvitationTTL, nil},
+		{CreateInvitationRequest{Email: "ann@example.com", TTL: "1h30m"}, 90 * time.Minute, nil},
+		{CreateInvitationRequest{Email: "ann@example.com", TTL: "720h"}, MaxInvitationTTL, nil},
+		{CreateInvitationRequest{Email: "ann@example.com", TTL: "721h"}, 0, []string{"ttl"}},
+		{CreateInvitationRequest{Email: "ann@example.com", TTL: "-1h"}, 0, []string{"ttl"}},
+		{CreateInvitationRequest{Email: "ann@example.com", TTL: "tomorrow"}, 0, []string{"ttl"}},
+		{CreateInvitationRequest{Email: "ann"}, DefaultInvitationTTL, []string{"email"}},
+	} {
+		ttl, errs := tt.req.Validate()
+		if got := fields(errs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: errors for %v, want %v", tt.req, got, tt.want)
+		}
+		if tt.want == nil && ttl != tt.wantTTL {
+			t.Errorf("%+v: TTL %v, want %v", tt.req, ttl, tt.wantTTL)
+		}
+	}
+}
+
+func TestCreateUserRequestV2(t *testing.T) {
+	for _, tt := range []struct {
+		req  CreateUserRequestV2
+		want []string
+	}{
+		{CreateUserRequestV2{FirstName: "Ann", LastName: "Lee", Email: "ann@example.com", Age: 30}, nil},
+		{CreateUserRequestV2{FirstName: "Cher", Email: "cher@example.com", Age: 30}, nil},
+		// Only first_name is complained about, not v1's name
+		{CreateUserRequestV2{LastName: "Lee", Email: "ann@example.com", Age: 30}, []string{"first_name"}},
+		{CreateUserRequestV2{FirstName: "Ann", Email: "ann", Age: -1}, []string{"email", "age"}},
+	} {
+		if got := fields(tt.req.Validate()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: errors for %v, want %v", tt.req, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateUserRequestV2(t *testing.T) {
+	user := domain.User{Name: "Mary Ann Smith", Email: "mary@example.com", Age: 40}
+	last, age := "Jones", 41
+	UpdateUserRequestV2{LastName: &last, Age: &age}.Apply(&user)
+	if user.Name != "Mary Jones" || user.Email != "mary@example.com" || user.Age != 41 {
+		t.Errorf("after Apply, user = %+v, want Mary Jones, 41, the same email", user)
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	for _, tt := range []struct{ name, first, last string }{
+		{"John Doe", "John", "Doe"},
+		{"Mary Ann Smith", "Mary", "Ann Smith"},
+		{"Cher", "Cher", ""},
+		{" Padded  Name ", "Padded", "Name"},
+		{"", "", ""},
+	} {
+		first, last := SplitName(tt.name)
+		if first != tt.first || last != tt.last {
+			t.Errorf("SplitName(%q) = %q, %q, want %q, %q", tt.name, first, last, tt.first, tt.last)
+		}
+	}
+	if got := JoinName("Mary", "Ann Smith"); got != "Mary Ann Smith" {
+		t.Errorf("JoinName = %q", got)
+	}
+	if got := JoinName("", "Smith"); got != "Smith" {
+		t.Errorf("JoinName without a first name = %q", got)
+	}
+}
+
+func TestDate(t *testing.T) {
+	type person struct {
+		Birthdate Date `json:"birthdate"`
+	}
+	data, err := json.Marshal(person{NewDate(1990, time.May, 17)})
+	if err != nil || string(data) != `{"birthdate":"1990-05-17"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+	if data, err := json.Marshal(person{}); err != nil || string(data) != `{"birthdate":null}` {
+		t.Errorf("Marshal of the zero Date = %s, %v; want null", data, err)
+	}
+
+	var p person
+	if err := json.Unmarshal([]byte(`{"birthdate":"2000-02-29"}`), &p); err != nil || p.Birthdate != NewDate(2000, time.February, 29) {
+		t.Errorf("Unmarshal = %v, %v", p.Birthdate, err)
+	}
+	if err := json.Unmarshal([]byte(`{"birthdate":null}`), &p); err != nil || p.Birthdate.String() != "2000-02-29" {
+		t.Errorf("Unmarshal of null = %v, %v; want the date left alone", p.Birthdate, err)
+	}
+	for _, bad := range []string{`"2001-02-29"`, `"17/05/1990"`, `"1990-05-17T00:00:00Z"`, `19900517`} {
+		if err := json.Unmarshal([]byte(`{"birthdate":`+bad+`}`), &p); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestPublicUser(t *testing.T) {
+	user := domain.User{ID: 1, Name: "John Doe", Email: "john@example.com", Age: 30}
+	data, err := json.Marshal(PublicUser(user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got domain.User
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	user.Email = "j***@example.com"
+	if got != user {
+		t.Errorf("PublicUser marshaled as %s, want everything but the email as it was", data)
+	}
+
+	for email, want := range map[string]string{
+		"ann@example.com":       "a***@example.com",
+		"\u00e9mile@example.fr": "\u00e9***@example.fr",
+		"@example.com":          "***",
+		"not an email":          "***",
+	} {
+		if got := RedactEmail(email); got != want {
+			t.Errorf("RedactEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
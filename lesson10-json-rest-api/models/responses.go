@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/json"
+
+	"golang-lab/lab/domain"
+)
+
+// BulkResult is what happened to one item of a bulk request
+type BulkResult struct {
+	Index   int                      `json:"index"`  // the item's position in the request
+	Status  int                      `json:"status"` // the status the item would have had on its own
+	ID      int                      `json:"id,omitempty"`
+	Data    any                      `json:"data,omitempty"` // the created user
+	Error   string                   `json:"error,omitempty"`
+	Details []domain.ValidationError `json:"details,omitempty"`
+}
+
+// JSONPatchOp is one operation of an RFC 6902 JSON Patch
+type JSONPatchOp struct {
+	Op    string          `json:"op"` // add, remove, replace, move, copy or test
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"` // for move and copy
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	// Type is a URI naming the kind of problem; clients should switch on
+	// it, not on Title or Detail
+	Type string `json:"type"`
+	// Title describes the kind of problem, the same for every occurrence
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail describes this occurrence
+	Detail string `json:"detail,omitempty"`
+	// Instance is the request that had the problem
+	Instance string `json:"instance,omitempty"`
+	// Errors is an extension member: which fields failed validation
+	Errors []domain.ValidationError `json:"errors,omitempty"`
+}
+
+// ProblemTypeDoc is what GET /api/problems/{type} says about a type
+type ProblemTypeDoc struct {
+	Description string `json:"description"`
+	Status      int    `json:"status"`
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+}
+
+// HealthStatus is the body of GET /api/health
+type HealthStatus struct {
+	Status     string      `json:"status"`
+	Timestamp  string      `json:"timestamp"`
+	UsersCount int         `json:"users_count"`
+	Version    string      `json:"version"`
+	Cache      *CacheStats `json:"cache,omitempty"` // if users are cached
+}
+
+// CacheStats is how well the user cache is doing
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"` // to make room; expired users aren't counted
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+}
+
+// Liveness is the body of GET /healthz: the process is up and serving,
+// whatever its dependencies are doing
+type Liveness struct {
+	Status    string `json:"status"` // always "alive"
+	Timestamp string `json:"timestamp"`
+	Uptime    string `json:"uptime"`
+}
+
+// Readiness is the body of GET /readyz: whether the API can serve
+// requests now, and the check of each dependency that says so
+type Readiness struct {
+	Status string        `json:"status"` // "ready", or "unready" if any check didn't pass
+	Checks []CheckResult `json:"checks"`
+}
+
+// CheckResult is how one readiness check went
+type CheckResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"` // "ok", "failed" or "timeout"
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// ImportReport is how a CSV or NDJSON import went. Rows are imported one
+// at a time, so a bad row is reported and skipped rather than stopping
+// the rest.
+type ImportReport struct {
+	Rows     int              `json:"rows"` // rows read, not counting a CSV header
+	Imported int              `json:"imported"`
+	Failed   []ImportRowError `json:"failed,omitempty"`
+}
+
+// ImportRowError is why one row wasn't imported
+type ImportRowError struct {
+	Line    int                      `json:"line"` // in the uploaded file, from 1
+	Error   string                   `json:"error"`
+	Details []domain.ValidationError `json:"details,omitempty"`
+}
+
+// UserStats is what GET /api/admin/stats answers: how many users there
+// are, and how old. AgeBuckets counts them by age range, like "18-29";
+// "other" is any age outside them all.
+type UserStats struct {
+	Total      int            `json:"total" bson:"total"`
+	AverageAge float64        `json:"average_age" bson:"average_age"`
+	MinAge     int            `json:"min_age" bson:"min_age"`
+	MaxAge     int            `json:"max_age" bson:"max_age"`
+	AgeBuckets map[string]int `json:"age_buckets" bson:"-"`
+}
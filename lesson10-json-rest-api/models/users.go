@@ -0,0 +1,149 @@
+// Package models holds the shapes lesson 10's API sends and receives that
+// lab/domain doesn't: v2 users, API keys, invitations, tokens and
+// problems, with the rules that validate them. It imports nothing of the
+// lesson's, so every other layer can use it.
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang-lab/lab/domain"
+)
+
+// UserV2 is a user as v2 sends it. The store still keeps one name, so
+// FirstName is up to its first space and LastName the rest; a first
+// name with a space in it comes back split differently.
+type UserV2 struct {
+	ID        int       `json:"id" xml:"id" yaml:"id"`
+	FirstName string    `json:"first_name" xml:"first_name" yaml:"first_name"`
+	LastName  string    `json:"last_name" xml:"last_name" yaml:"last_name"`
+	Email     string    `json:"email" xml:"email" yaml:"email"`
+	Age       int       `json:"age" xml:"age" yaml:"age"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at" yaml:"updated_at"`
+	Version   int       `json:"version,omitempty" xml:"version,omitempty" yaml:"version,omitempty"`
+}
+
+func NewUserV2(user domain.User) UserV2 {
+	first, last := SplitName(user.Name)
+	return UserV2{
+		ID:        user.ID,
+		FirstName: first,
+		LastName:  last,
+		Email:     user.Email,
+		Age:       user.Age,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Version:   user.Version,
+	}
+}
+
+// PublicUser is a user as someone who hasn't logged in may see them:
+// everything but the email, which MarshalJSON redacts
+type PublicUser domain.User
+
+// MarshalJSON implements json.Marshaler. Converting back to domain.User
+// drops this method, so json.Marshal marshals the fields as usual instead
+// of calling MarshalJSON again, forever.
+func (u PublicUser) MarshalJSON() ([]byte, error) {
+	user := domain.User(u)
+	user.Email = RedactEmail(user.Email)
+	return json.Marshal(user)
+}
+
+// RedactEmail keeps the first letter and the domain of an email, so
+// john@example.com is j***@example.com
+func RedactEmail(email string) string {
+	local, host, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	_, size := utf8.DecodeRuneInString(local)
+	return local[:size] + "***@" + host
+}
+
+// CreateUserRequestV2 is v2's payload for creating a user. A last name
+// is optional; not everyone has one.
+type CreateUserRequestV2 struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Age       int    `json:"age"`
+}
+
+// Validate checks the request by v1's rules, naming v2's fields
+func (req CreateUserRequestV2) Validate() []domain.ValidationError {
+	var errors []domain.ValidationError
+	if strings.TrimSpace(req.FirstName) == "" {
+		errors = append(errors, domain.ValidationError{
+			Field:   "first_name",
+			Message: "First name is required",
+		})
+	}
+	v1Req := domain.CreateUserRequest{Name: JoinName(req.FirstName, req.LastName), Email: req.Email, Age: req.Age}
+	for _, e := range v1Req.Validate() {
+		if e.Field != "name" { // covered by first_name
+			errors = append(errors, e)
+		}
+	}
+	return errors
+}
+
+// UpdateUserRequestV2 is v2's payload for a partial update. Nil fields
+// are left unchanged, so a PUT can change just the last name.
+type UpdateUserRequestV2 struct {
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Age       *int    `json:"age,omitempty"`
+	Version   *int    `json:"version,omitempty"` // of the user updated; see domain.UpdateUserRequest
+}
+
+// Apply copies the fields that were sent onto user
+func (req UpdateUserRequestV2) Apply(user *domain.User) {
+	first, last := SplitName(user.Name)
+	if req.FirstName != nil {
+		first = *req.FirstName
+	}
+	if req.LastName != nil {
+		last = *req.LastName
+	}
+	user.Name = JoinName(first, last)
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.Age != nil {
+		user.Age = *req.Age
+	}
+}
+
+// SplitName splits a name at its first space: "Mary Ann Smith" is Mary
+// and Ann Smith
+func SplitName(name string) (first, last string) {
+	first, last, _ = strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
+}
+
+// JoinName is the one name the store keeps for first and last
+func JoinName(first, last string) string {
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+	if first == "" || last == "" {
+		return first + last
+	}
+	return first + " " + last
+}
+
+// LinkedUser is a v1 user with its links
+type LinkedUser struct {
+	domain.User `yaml:",inline"`
+	Links       domain.Links `json:"_links" xml:"links" yaml:"_links"`
+}
+
+// LinkedUserV2 is a v2 user with its links
+type LinkedUserV2 struct {
+	UserV2 `yaml:",inline"`
+	Links  domain.Links `json:"_links" xml:"links" yaml:"_links"`
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// Cached is a UserStore in front of another, keeping the users Get
+// returns in an LRU, so reading the same user again doesn't reach the
+// store behind it: GET /api/users/{id} is the API's most common request.
+// Every write through Cached drops what it changes from the cache. A
+// write that goes to the store behind it directly, like another process
+// sharing a SQLite file, shows up once the TTL is over.
+//
+// Only Get is cached. List and Each read every user anyway, and a
+// missing user isn't remembered, so one created later is found at once.
+type Cached struct {
+	UserStore
+	users *LRU[int, domain.User]
+
+	// A Get that read a user from the store before a write, and adds it
+	// to the cache after, would keep the old user until the TTL. So each
+	// write counts one generation, and a Get only adds what it read if no
+	// write happened meanwhile.
+	mu  sync.Mutex
+	gen uint64
+}
+
+// NewCached caches up to size of s's users, for ttl each by clk's time
+func NewCached(s UserStore, size int, ttl time.Duration, clk clock.Clock) *Cached {
+	return &Cached{UserStore: s, users: NewLRU[int, domain.User](size, ttl, clk)}
+}
+
+func (c *Cached) Get(ctx context.Context, id int) (domain.User, error) {
+	if user, ok := c.users.Get(id); ok {
+		return user, nil
+	}
+	gen := c.generation()
+	user, err := c.UserStore.Get(ctx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.mu.Lock()
+	if gen == c.gen {
+		c.users.Add(id, user)
+	}
+	c.mu.Unlock()
+	return user, nil
+}
+
+func (c *Cached) Update(ctx context.Context, user domain.User) error {
+	defer c.invalidate(user.ID)
+	return c.UserStore.Update(ctx, user)
+}
+
+func (c *Cached) Delete(ctx context.Context, id int) error {
+	defer c.invalidate(id)
+	return c.UserStore.Delete(ctx, id)
+}
+
+func (c *Cached) Replace(ctx context.Context, list []domain.User) error {
+	defer c.invalidate(0)
+	return c.UserStore.Replace(ctx, list)
+}
+
+// Stats is how well the cache is doing, for GET /api/health
+func (c *Cached) Stats() models.CacheStats {
+	return c.users.Stats()
+}
+
+func (c *Cached) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// invalidate drops the user with id from the cache, or every user for 0,
+// and starts a new generation. It runs after the write, whether or not
+// the write worked: a failed write may have changed something anyway.
+func (c *Cached) invalidate(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if id == 0 {
+		c.users.Purge()
+	} else {
+		c.users.Remove(id)
+	}
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// ErrKeyNotFound is returned by every APIKeyStore for a key it doesn't
+// have
+var ErrKeyNotFound = errors.New("API key not found")
+
+// APIKeyStore keeps issued keys. Every UserStore is one, so keys live
+// wherever users do.
+type APIKeyStore interface {
+	CreateKey(ctx context.Context, key models.APIKey) error
+	// KeyByHash finds the key whose hash is hash, revoked or not
+	KeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	GetKey(ctx context.Context, id string) (models.APIKey, error)
+	// ListKeys returns every key, revoked ones too, oldest first
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	// RevokeKey marks the key revoked at at. Revoking a revoked key
+	// keeps the first time.
+	RevokeKey(ctx context.Context, id string, at time.Time) error
+}
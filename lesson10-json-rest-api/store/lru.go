@@ -0,0 +1,135 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// LRU is a cache of at most a fixed number of values, safe for
+// concurrent use. Adding one to a full cache evicts the least recently
+// used, and a value older than the TTL is a miss, as if it had never been
+// added.
+//
+// It's the classic pair: a map finds an entry by key in O(1), and a
+// doubly linked list keeps the entries in the order they were used, so
+// moving one to the front, or dropping the one at the back, is O(1) too.
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	clk      clock.Clock
+	order    *list.List // of *lruEntry, most recently used first
+	entries  map[K]*list.Element
+
+	hits, misses, evictions int64
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// NewLRU returns an empty cache of up to capacity values, each good for
+// ttl after it's added, by clk's time. A ttl of 0 keeps them until
+// they're evicted.
+func NewLRU[K comparable, V any](capacity int, ttl time.Duration, clk clock.Clock) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: max(capacity, 1),
+		ttl:      ttl,
+		clk:      clk,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for key, if there is one that hasn't expired,
+// and marks it the most recently used
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && c.expired(elem) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+// Add sets the value for key, evicting the least recently used value if
+// the cache is full
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry[K, V]{key: key, value: value}
+	if c.ttl > 0 {
+		entry.expires = c.clk.Now().Add(c.ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Remove drops the value for key, if there is one
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge drops every value
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+// Stats counts the lookups that found a value and those that didn't,
+// and how full the cache is
+func (c *LRU[K, V]) Stats() models.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return models.CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+	}
+}
+
+func (c *LRU[K, V]) expired(elem *list.Element) bool {
+	expires := elem.Value.(*lruEntry[K, V]).expires
+	return !expires.IsZero() && !c.clk.Now().Before(expires)
+}
+
+func (c *LRU[K, V]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry[K, V]).key)
+}
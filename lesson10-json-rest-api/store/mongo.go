@@ -0,0 +1,322 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/connstring"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// mongoDatabase is the database used when the URI doesn't name one
+const mongoDatabase = "golang_lab"
+
+// mongoTimeout bounds connecting and disconnecting, which have no request
+// context to be cancelled with
+const mongoTimeout = 10 * time.Second
+
+// Mongo keeps users and API keys as documents in MongoDB. The bson tags
+// on domain.User and models.APIKey name the fields, and a user's ID is
+// its _id, so lookups by ID use the index every collection has. Emails
+// are unique: the database, not the handlers, enforces it.
+type Mongo struct {
+	client   *mongo.Client
+	db       *mongo.Database
+	users    *mongo.Collection
+	keys     *mongo.Collection
+	counters *mongo.Collection
+}
+
+// OpenMongo connects to the server at uri, checks it answers, and makes
+// sure the indexes exist. The database is the one in the URI's path,
+// or golang_lab.
+func OpenMongo(uri string) (*Mongo, error) {
+	cs, err := connstring.ParseAndValidate(uri)
+	if err != nil {
+		return nil, err
+	}
+	name := cs.Database
+	if name == "" {
+		name = mongoDatabase
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", uri, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, errors.Join(fmt.Errorf("pinging %s: %w", uri, err), client.Disconnect(ctx))
+	}
+	db := client.Database(name)
+	s := &Mongo{
+		client:   client,
+		db:       db,
+		users:    db.Collection("users"),
+		keys:     db.Collection("api_keys"),
+		counters: db.Collection("counters"),
+	}
+	if err := ensureUserIndexes(ctx, s.users); err != nil {
+		return nil, errors.Join(err, client.Disconnect(ctx))
+	}
+	// Keys are looked up by hash on every request, and two keys with one
+	// hash would make that lookup ambiguous
+	_, err = s.keys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("creating the api_keys index: %w", err), client.Disconnect(ctx))
+	}
+	return s, nil
+}
+
+// ensureUserIndexes creates a unique index on email, so a second user
+// with one fails to insert, and one on created_at, newest first, for
+// sorting by it. Creating an index that exists already does nothing, so
+// this runs on every start.
+func ensureUserIndexes(ctx context.Context, users *mongo.Collection) error {
+	_, err := users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("email_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("created_at_desc"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating the %s indexes: %w", users.Name(), err)
+	}
+	return nil
+}
+
+// userError turns a duplicate email into ErrDuplicateEmail; the email
+// index is the only unique one on users but _id, which Create and Replace
+// never repeat
+func userError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicateEmail, err)
+	}
+	return err
+}
+
+// Database is where the store keeps its collections, for queries
+// UserStore has no method for, like lesson 11's aggregations
+func (s *Mongo) Database() *mongo.Database {
+	return s.db
+}
+
+func (s *Mongo) Get(ctx context.Context, id int) (domain.User, error) {
+	var user domain.User
+	err := s.users.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *Mongo) List(ctx context.Context) ([]domain.User, error) {
+	list := []domain.User{}
+	err := s.Each(ctx, func(user domain.User) error {
+		list = append(list, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Each decodes one document at a time; the cursor fetches them from the
+// server in batches
+func (s *Mongo) Each(ctx context.Context, fn func(domain.User) error) (err error) {
+	cursor, err := s.users.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, cursor.Close(ctx))
+	}()
+
+	for cursor.Next(ctx) {
+		var user domain.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// nextID takes the next user ID from a counter document. MongoDB has no
+// AUTOINCREMENT, and its ObjectIDs aren't the small integers the API
+// uses; $inc on one document is atomic, so two creates never get the
+// same ID, and a deleted user's ID is never handed out again.
+func (s *Mongo) nextID(ctx context.Context) (int, error) {
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": "users"},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("allocating a user ID: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+func (s *Mongo) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	id, err := s.nextID(ctx)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.ID = id
+	user.Version = 1
+	if _, err := s.users.InsertOne(ctx, user); err != nil {
+		return domain.User{}, userError(err)
+	}
+	return user, nil
+}
+
+func (s *Mongo) Update(ctx context.Context, user domain.User) error {
+	result, err := s.users.ReplaceOne(ctx, bson.M{"_id": user.ID}, user)
+	if err != nil {
+		return userError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *Mongo) Delete(ctx context.Context, id int) error {
+	result, err := s.users.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Replace fills a users_restore collection and renames it over users,
+// which MongoDB does in one step: a failure halfway leaves the old users,
+// and readers never see the collection half empty, as with SQLite's
+// transaction. The rename keeps users_restore's indexes, not the old
+// users', so it gets them first. Then the counter carries on after the
+// highest ID in list.
+func (s *Mongo) Replace(ctx context.Context, list []domain.User) error {
+	restore := s.db.Collection("users_restore")
+	if err := restore.Drop(ctx); err != nil {
+		return err
+	}
+	if err := s.db.CreateCollection(ctx, restore.Name()); err != nil {
+		return err
+	}
+	if err := ensureUserIndexes(ctx, restore); err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		if _, err := restore.InsertMany(ctx, list); err != nil {
+			return userError(err)
+		}
+	}
+	err := s.client.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: s.db.Name() + "." + restore.Name()},
+		{Key: "to", Value: s.db.Name() + "." + s.users.Name()},
+		{Key: "dropTarget", Value: true},
+	}).Err()
+	if err != nil {
+		return err
+	}
+
+	highest := 0
+	for _, user := range list {
+		highest = max(highest, user.ID)
+	}
+	_, err = s.counters.UpdateOne(ctx,
+		bson.M{"_id": "users"},
+		bson.M{"$set": bson.M{"seq": highest}},
+		options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+// Ping checks the server answers, picking a new one from the replica
+// set if the last has gone
+func (s *Mongo) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx, nil)
+}
+
+func (s *Mongo) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	return s.client.Disconnect(ctx)
+}
+
+func (s *Mongo) CreateKey(ctx context.Context, key models.APIKey) error {
+	_, err := s.keys.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("API key %s already exists", key.ID)
+	}
+	return err
+}
+
+func (s *Mongo) findKey(ctx context.Context, filter bson.M) (models.APIKey, error) {
+	var key models.APIKey
+	err := s.keys.FindOne(ctx, filter).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.APIKey{}, ErrKeyNotFound
+	}
+	return key, err
+}
+
+func (s *Mongo) KeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	return s.findKey(ctx, bson.M{"hash": hash})
+}
+
+func (s *Mongo) GetKey(ctx context.Context, id string) (models.APIKey, error) {
+	return s.findKey(ctx, bson.M{"_id": id})
+}
+
+func (s *Mongo) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	sort := bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := s.keys.Find(ctx, bson.M{}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+	list := []models.APIKey{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// RevokeKey sets revoked_at only if it isn't set, in the update itself,
+// so two revokes at once still keep the first time
+func (s *Mongo) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	result, err := s.keys.UpdateOne(ctx, bson.M{"_id": id}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"revoked_at": bson.M{"$ifNull": bson.A{"$revoked_at", at}}}}},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// StatsStore is a UserStore that can work user statistics out itself.
+// Only Mongo is one: the others would have to read every user to do it.
+type StatsStore interface {
+	Stats(ctx context.Context) (models.UserStats, error)
+}
+
+// AgeBucketBoundaries split the ages into ranges: each bucket holds the
+// ages from one boundary up to, but not including, the next
+var AgeBucketBoundaries = []int{0, 18, 30, 50, 151}
+
+// AgeBucketLabel names the bucket from lower up to upper, like "18-29"
+func AgeBucketLabel(lower, upper int) string {
+	return fmt.Sprintf("%d-%d", lower, upper-1)
+}
+
+// statsPipeline asks MongoDB to do the math server-side instead of
+// shipping every document here. $facet runs two sub-pipelines over the
+// same users in one round trip.
+var statsPipeline = mongo.Pipeline{
+	{{Key: "$facet", Value: bson.M{
+		"summary": bson.A{
+			bson.M{"$group": bson.M{
+				"_id":         nil,
+				"total":       bson.M{"$sum": 1},
+				"average_age": bson.M{"$avg": "$age"},
+				"min_age":     bson.M{"$min": "$age"},
+				"max_age":     bson.M{"$max": "$age"},
+			}},
+		},
+		"buckets": bson.A{
+			bson.M{"$bucket": bson.M{
+				"groupBy":    "$age",
+				"boundaries": AgeBucketBoundaries,
+				"default":    "other",
+				"output":     bson.M{"count": bson.M{"$sum": 1}},
+			}},
+		},
+	}}},
+}
+
+// facetResult is the one document statsPipeline returns
+type facetResult struct {
+	Summary []models.UserStats `bson:"summary"`
+	Buckets []struct {
+		Lower any `bson:"_id"`
+		Count int `bson:"count"`
+	} `bson:"buckets"`
+}
+
+// Stats runs statsPipeline over the users
+func (s *Mongo) Stats(ctx context.Context) (models.UserStats, error) {
+	cursor, err := s.users.Aggregate(ctx, statsPipeline)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+	var results []facetResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return models.UserStats{}, err
+	}
+	return decodeStats(results), nil
+}
+
+// decodeStats turns the pipeline's result into UserStats. A bucket's _id
+// is its lower boundary, or "other" for ages outside them all.
+func decodeStats(results []facetResult) models.UserStats {
+	stats := models.UserStats{}
+	if len(results) > 0 && len(results[0].Summary) > 0 {
+		stats = results[0].Summary[0]
+	}
+	stats.AgeBuckets = make(map[string]int)
+	if len(results) == 0 {
+		return stats
+	}
+	for _, bucket := range results[0].Buckets {
+		var lower int
+		switch v := bucket.Lower.(type) {
+		case int32:
+			lower = int(v)
+		case int64:
+			lower = int(v)
+		default:
+			stats.AgeBuckets["other"] += bucket.Count
+			continue
+		}
+		for i := 0; i < len(AgeBucketBoundaries)-1; i++ {
+			if AgeBucketBoundaries[i] == lower {
+				stats.AgeBuckets[AgeBucketLabel(AgeBucketBoundaries[i], AgeBucketBoundaries[i+1])] = bucket.Count
+			}
+		}
+	}
+	return stats
+}
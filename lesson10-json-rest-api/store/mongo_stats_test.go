@@ -0,0 +1,45 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// TestDecodeStats decodes a document shaped like statsPipeline's result,
+// round-tripped through BSON as the driver would hand it over; it needs
+// no server
+func TestDecodeStats(t *testing.T) {
+	doc := bson.M{
+		"summary": bson.A{bson.M{"_id": nil, "total": 5, "average_age": 31.2, "min_age": 12, "max_age": 160}},
+		"buckets": bson.A{
+			bson.M{"_id": int32(0), "count": 1},
+			bson.M{"_id": int64(18), "count": 2},
+			bson.M{"_id": int32(30), "count": 1},
+			bson.M{"_id": "other", "count": 1},
+		},
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result facetResult
+	if err := bson.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	got := decodeStats([]facetResult{result})
+	want := models.UserStats{Total: 5, AverageAge: 31.2, MinAge: 12, MaxAge: 160,
+		AgeBuckets: map[string]int{"0-17": 1, "18-29": 2, "30-49": 1, "other": 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeStats = %+v, want %+v", got, want)
+	}
+
+	// An empty collection gives no summary and no buckets
+	if got := decodeStats(nil); got.Total != 0 || got.AgeBuckets == nil || len(got.AgeBuckets) != 0 {
+		t.Errorf("decodeStats(nil) = %+v, want zeros and an empty map", got)
+	}
+}
@@ -0,0 +1,139 @@
+//go:build mongo
+
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/fixtures"
+)
+
+// These tests need a MongoDB server: go test -tags mongo, with
+// MONGO_URL naming it if it isn't on localhost. Each test gets a
+// database of its own, which it drops at the end.
+
+func testMongoURI(t *testing.T) string {
+	t.Helper()
+	server := os.Getenv("MONGO_URL")
+	if server == "" {
+		server = "mongodb://localhost:27017"
+	}
+	return strings.TrimSuffix(server, "/") + "/golang_lab_" + strings.ReplaceAll(t.Name(), "/", "_")
+}
+
+func openTestMongo(t *testing.T, uri string) *Mongo {
+	t.Helper()
+	s, err := OpenMongo(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.db.Drop(context.Background()); err != nil {
+			t.Error(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+func TestMongoStore(t *testing.T) {
+	testStore(t, openTestMongo(t, testMongoURI(t)))
+}
+
+// TestMongoSurvivesRestart reconnects, and checks the users and the ID
+// counter are where the first connection left them
+func TestMongoSurvivesRestart(t *testing.T) {
+	uri := testMongoURI(t)
+	ctx := context.Background()
+	s := openTestMongo(t, uri)
+	if err := s.Replace(ctx, fixtures.Users(fixtures.Small)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := OpenMongo(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := again.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	list, err := again.List(ctx)
+	if err != nil || len(list) != fixtures.Small-1 {
+		t.Fatalf("after reconnecting, %d users, %v; want %d", len(list), err, fixtures.Small-1)
+	}
+	user, err := again.Create(ctx, list[0])
+	if err != nil || user.ID != fixtures.Small+1 {
+		t.Errorf("Create after reconnecting gave ID %d, %v; want %d", user.ID, err, fixtures.Small+1)
+	}
+}
+
+// TestMongoUniqueEmail checks the email index rejects a second user with
+// the same email, and is still there after a Replace swaps the collection
+func TestMongoUniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	s := openTestMongo(t, testMongoURI(t))
+	users := fixtures.Users(fixtures.Small)
+	if err := s.Replace(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+	duplicate := users[1]
+	duplicate.ID = 0
+	if _, err := s.Create(ctx, duplicate); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Create with %s's email = %v, want ErrDuplicateEmail", duplicate.Email, err)
+	}
+	updated := users[2]
+	updated.Email = users[0].Email
+	if err := s.Update(ctx, updated); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Update to %s's email = %v, want ErrDuplicateEmail", updated.Email, err)
+	}
+	if err := s.Replace(ctx, append(users, duplicate)); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Replace with two %s = %v, want ErrDuplicateEmail", duplicate.Email, err)
+	}
+	if list, err := s.List(ctx); err != nil || len(list) != len(users) {
+		t.Errorf("after a failed Replace, %d users, %v; want %d", len(list), err, len(users))
+	}
+}
+
+// TestMongoStats runs the stats pipeline, and checks it agrees with the
+// same sums done in Go
+func TestMongoStats(t *testing.T) {
+	ctx := context.Background()
+	s := openTestMongo(t, testMongoURI(t))
+	users := fixtures.Users(fixtures.Medium)
+	if err := s.Replace(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, buckets := 0, map[string]int{}
+	for _, user := range users {
+		total += user.Age
+		for i := 0; i < len(AgeBucketBoundaries)-1; i++ {
+			if user.Age >= AgeBucketBoundaries[i] && user.Age < AgeBucketBoundaries[i+1] {
+				buckets[AgeBucketLabel(AgeBucketBoundaries[i], AgeBucketBoundaries[i+1])]++
+			}
+		}
+	}
+	if stats.Total != len(users) || stats.AverageAge != float64(total)/float64(len(users)) {
+		t.Errorf("total %d, average %v; want %d, %v", stats.Total, stats.AverageAge, len(users), float64(total)/float64(len(users)))
+	}
+	for label, n := range buckets {
+		if stats.AgeBuckets[label] != n {
+			t.Errorf("bucket %s has %d users, want %d", label, stats.AgeBuckets[label], n)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// sqliteDriver is the database/sql driver name the SQLite store opens.
+// The driver is only linked in with -tags sqlite (see sqlite_driver.go):
+// it's a large package, and most runs of the lesson don't need it.
+const sqliteDriver = "sqlite"
+
+// sqliteSchema creates the tables if the file doesn't have them yet.
+// AUTOINCREMENT keeps SQLite from reusing the ID of a deleted user, as
+// the memory store never does.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	name       TEXT    NOT NULL,
+	email      TEXT    NOT NULL,
+	age        INTEGER NOT NULL,
+	created_at TEXT    NOT NULL,
+	updated_at TEXT    NOT NULL,
+	version    INTEGER NOT NULL DEFAULT 1
+);
+CREATE TABLE IF NOT EXISTS api_keys (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	hash       TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	revoked_at TEXT
+)`
+
+// SQLite keeps users in a SQLite database file, so they survive a
+// restart. It uses nothing but database/sql: the driver only turns the
+// SQL into file operations.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens, or creates, the database at path
+func OpenSQLite(path string) (*SQLite, error) {
+	if !slices.Contains(sql.Drivers(), sqliteDriver) {
+		return nil, errors.New("this build has no SQLite driver; build with -tags sqlite (after go get modernc.org/sqlite)")
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; one connection makes the other
+	// requests wait their turn instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return nil, errors.Join(fmt.Errorf("creating the tables in %s: %w", path, err), db.Close())
+	}
+	if err := addVersionColumn(db); err != nil {
+		return nil, errors.Join(fmt.Errorf("adding the version column to %s: %w", path, err), db.Close())
+	}
+	return &SQLite{db: db}, nil
+}
+
+// addVersionColumn brings a users table from before versions up to date.
+// CREATE TABLE IF NOT EXISTS leaves an existing table as it is, and
+// SQLite has no ADD COLUMN IF NOT EXISTS, so it asks first. Users
+// already there start at version 1.
+func addVersionColumn(db *sql.DB) error {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('users') WHERE name = 'version'`).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1`)
+	return err
+}
+
+// SQLite has no time type; times are stored as RFC 3339 text, which also
+// sorts in time order
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// scanner is what *sql.Row and *sql.Rows have in common
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (domain.User, error) {
+	var user domain.User
+	var created, updated string
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Age, &created, &updated, &user.Version); err != nil {
+		return domain.User{}, err
+	}
+	var err error
+	if user.CreatedAt, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return domain.User{}, fmt.Errorf("user %d: %w", user.ID, err)
+	}
+	if user.UpdatedAt, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+		return domain.User{}, fmt.Errorf("user %d: %w", user.ID, err)
+	}
+	return user, nil
+}
+
+const selectUsers = `SELECT id, name, email, age, created_at, updated_at, version FROM users`
+
+func (s *SQLite) Get(ctx context.Context, id int) (domain.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, selectUsers+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *SQLite) List(ctx context.Context) ([]domain.User, error) {
+	list := []domain.User{}
+	err := s.Each(ctx, func(user domain.User) error {
+		list = append(list, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Each reads one row at a time, so only the user fn has is in memory
+func (s *SQLite) Each(ctx context.Context, fn func(domain.User) error) error {
+	rows, err := s.db.QueryContext(ctx, selectUsers+` ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLite) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (name, email, age, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, 1)`,
+		user.Name, user.Email, user.Age, formatTime(user.CreatedAt), formatTime(user.UpdatedAt))
+	if err != nil {
+		return domain.User{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.ID = int(id)
+	user.Version = 1
+	return user, nil
+}
+
+// oneRow turns an UPDATE or DELETE that matched no rows into
+// ErrUserNotFound
+func oneRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) Update(ctx context.Context, user domain.User) error {
+	return oneRow(s.db.ExecContext(ctx,
+		`UPDATE users SET name = ?, email = ?, age = ?, created_at = ?, updated_at = ?, version = ? WHERE id = ?`,
+		user.Name, user.Email, user.Age, formatTime(user.CreatedAt), formatTime(user.UpdatedAt), user.Version, user.ID))
+}
+
+func (s *SQLite) Delete(ctx context.Context, id int) error {
+	return oneRow(s.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id))
+}
+
+// Replace swaps the users in one transaction, so a failure halfway leaves
+// the old ones, and readers never see the table half empty
+func (s *SQLite) Replace(ctx context.Context, list []domain.User) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users`); err != nil {
+		return err
+	}
+	insert, err := tx.PrepareContext(ctx,
+		`INSERT INTO users (id, name, email, age, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, user := range list {
+		if _, err := insert.ExecContext(ctx, user.ID, user.Name, user.Email, user.Age,
+			formatTime(user.CreatedAt), formatTime(user.UpdatedAt), user.Version); err != nil {
+			return fmt.Errorf("user %d: %w", user.ID, err)
+		}
+	}
+	// AUTOINCREMENT remembers the highest ID ever used; start again after
+	// the highest in list, as the memory store does
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sqlite_sequence SET seq = (SELECT COALESCE(MAX(id), 0) FROM users) WHERE name = 'users'`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping opens a connection to the database file, if there isn't one
+// already, and checks it answers
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) CreateKey(ctx context.Context, key models.APIKey) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, name, role, hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.Role, key.Hash, formatTime(key.CreatedAt))
+	return err
+}
+
+func scanKey(row scanner) (models.APIKey, error) {
+	var key models.APIKey
+	var created string
+	var revoked sql.NullString
+	if err := row.Scan(&key.ID, &key.Name, &key.Role, &key.Hash, &created, &revoked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, ErrKeyNotFound
+		}
+		return models.APIKey{}, err
+	}
+	var err error
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return models.APIKey{}, fmt.Errorf("API key %s: %w", key.ID, err)
+	}
+	if revoked.Valid {
+		at, err := time.Parse(time.RFC3339Nano, revoked.String)
+		if err != nil {
+			return models.APIKey{}, fmt.Errorf("API key %s: %w", key.ID, err)
+		}
+		key.RevokedAt = &at
+	}
+	return key, nil
+}
+
+const selectKeys = `SELECT id, name, role, hash, created_at, revoked_at FROM api_keys`
+
+func (s *SQLite) KeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	return scanKey(s.db.QueryRowContext(ctx, selectKeys+` WHERE hash = ?`, hash))
+}
+
+func (s *SQLite) GetKey(ctx context.Context, id string) (models.APIKey, error) {
+	return scanKey(s.db.QueryRowContext(ctx, selectKeys+` WHERE id = ?`, id))
+}
+
+func (s *SQLite) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, selectKeys+` ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, key)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLite) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, formatTime(at), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build sqlite
+
+package store
+
+// The pure-Go SQLite driver registers itself with database/sql as
+// "sqlite". It needs no cgo, but it's a lot of code to compile, so it's
+// only linked in with -tags sqlite; add it to go.mod first with
+// go get modernc.org/sqlite.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,79 @@
+//go:build sqlite
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"golang-lab/lab/fixtures"
+)
+
+// These tests need the SQLite driver: go test -tags sqlite
+
+func openTestSQLite(t *testing.T, path string) *SQLite {
+	t.Helper()
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, openTestSQLite(t, filepath.Join(t.TempDir(), "users.db")))
+}
+
+// TestSQLiteSurvivesRestart is the point of the SQLite store
+func TestSQLiteSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	ctx := context.Background()
+	first, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Replace(ctx, fixtures.Users(fixtures.Small)); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Delete(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := openTestSQLite(t, path).List(ctx)
+	if err != nil || len(list) != fixtures.Small-1 {
+		t.Fatalf("after reopening, %d users, %v; want %d", len(list), err, fixtures.Small-1)
+	}
+}
+
+// TestSQLiteAddsVersions opens a database from before users had versions
+func TestSQLiteAddsVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	old, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email TEXT NOT NULL,
+		age INTEGER NOT NULL, created_at TEXT NOT NULL, updated_at TEXT NOT NULL);
+		INSERT INTO users (name, email, age, created_at, updated_at)
+		VALUES ('Ann', 'ann@example.com', 30, '2024-01-01T09:00:00Z', '2024-01-01T09:00:00Z')`)
+	if err := errors.Join(err, old.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := openTestSQLite(t, path).Get(context.Background(), 1)
+	if err != nil || user.Name != "Ann" || user.Version != 1 {
+		t.Errorf("Get(1) = %+v, %v; want Ann at version 1", user, err)
+	}
+}
@@ -0,0 +1,245 @@
+// Package store keeps lesson 10's users and API keys: in a map by
+// default, with -tags sqlite in a SQLite database, or in MongoDB.
+// Handlers see only the UserStore interface, so any of them will do.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// ErrUserNotFound is returned by every UserStore for an ID it doesn't have
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrDuplicateEmail is returned by a UserStore that keeps emails unique
+// when a create or update would give two users one. Mongo, with its
+// unique index, is the only one that does.
+var ErrDuplicateEmail = errors.New("email already in use")
+
+// UserStore hides where users are kept. The handlers only ever talk to
+// this, so swapping the map for a database is a change to -storage, not to
+// them. Every method takes a context so a slow database call can be
+// cancelled when the HTTP client goes away.
+type UserStore interface {
+	Get(ctx context.Context, id int) (domain.User, error)
+	// List returns every user, sorted by ID
+	List(ctx context.Context) ([]domain.User, error)
+	// Each calls fn with every user, sorted by ID, and stops at the first
+	// error fn returns, which it returns too. Unlike List it needn't hold
+	// every user at once, so an export can stream a big store.
+	Each(ctx context.Context, fn func(domain.User) error) error
+	// Create stores user under a new ID, which it returns the user with,
+	// at version 1. IDs are never reused, even after a delete.
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+	// Update replaces the user with user.ID, version and all. Checking
+	// the version it replaces is the caller's job (see handlers/locking.go).
+	Update(ctx context.Context, user domain.User) error
+	Delete(ctx context.Context, id int) error
+	// Replace swaps every user for list, which keeps its IDs, for
+	// restoring a backup. New IDs carry on after the highest in list.
+	Replace(ctx context.Context, list []domain.User) error
+	// Ping checks the store can be reached, for GET /readyz
+	Ping(ctx context.Context) error
+	Close() error
+
+	// API keys (see keys.go) are kept with the users. Replace
+	// doesn't touch them.
+	APIKeyStore
+}
+
+// Open picks the UserStore named by -storage. path is the SQLite
+// database file, and mongoURI the MongoDB server.
+func Open(kind, path, mongoURI string) (UserStore, error) {
+	switch kind {
+	case "memory":
+		return NewMemory(), nil
+	case "sqlite":
+		return OpenSQLite(path)
+	case "mongo":
+		return OpenMongo(mongoURI)
+	default:
+		return nil, fmt.Errorf("unknown storage %q (want memory, sqlite or mongo)", kind)
+	}
+}
+
+// Memory keeps users in a map, so they're gone when the process
+// exits unless -data saves them
+type Memory struct {
+	mu     sync.RWMutex
+	users  map[int]domain.User
+	nextID int
+	keys   map[string]models.APIKey // by ID
+}
+
+func NewMemory() *Memory {
+	return &Memory{users: make(map[int]domain.User), nextID: 1, keys: make(map[string]models.APIKey)}
+}
+
+func (s *Memory) Get(ctx context.Context, id int) (domain.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return domain.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *Memory) List(ctx context.Context) ([]domain.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]domain.User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// Each runs fn on a copy of the users, not under the lock: fn may be
+// writing to a slow client, and the users are in memory anyway
+func (s *Memory) Each(ctx context.Context, fn func(domain.User) error) error {
+	list, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range list {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Memory) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.ID = s.nextID
+	user.Version = 1
+	s.nextID++
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *Memory) Update(ctx context.Context, user domain.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; !ok {
+		return ErrUserNotFound
+	}
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *Memory) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *Memory) Replace(ctx context.Context, list []domain.User) error {
+	users := make(map[int]domain.User, len(list))
+	next := 1
+	for _, user := range list {
+		users[user.ID] = user
+		next = max(next, user.ID+1)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = users
+	s.nextID = next
+	return nil
+}
+
+// Ping always succeeds: a map is always there
+func (s *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing; there's nothing to release
+func (s *Memory) Close() error {
+	return nil
+}
+
+func (s *Memory) CreateKey(ctx context.Context, key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key.ID]; ok {
+		return fmt.Errorf("API key %s already exists", key.ID)
+	}
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *Memory) KeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrKeyNotFound
+}
+
+func (s *Memory) GetKey(ctx context.Context, id string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return models.APIKey{}, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *Memory) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]models.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (s *Memory) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+		s.keys[id] = key
+	}
+	return nil
+}
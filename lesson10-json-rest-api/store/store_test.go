@@ -0,0 +1,343 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
+	"golang-lab/lab/domain"
+	"golang-lab/lesson10-json-rest-api/models"
+)
+
+// testStore checks s behaves as the handlers expect a UserStore to.
+// s must be empty.
+func testStore(t *testing.T, s UserStore) {
+	ctx := context.Background()
+	at := demo.Clock
+	newUser := func(name string) domain.User {
+		return domain.User{Name: name, Email: strings.ToLower(name) + "@example.com", Age: 30, CreatedAt: at, UpdatedAt: at}
+	}
+	ids := func() []int {
+		t.Helper()
+		list, err := s.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int{}
+		for _, user := range list {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+	create := func(name string) domain.User {
+		t.Helper()
+		user, err := s.Create(ctx, newUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("Ping = %v", err)
+	}
+	if got := ids(); len(got) != 0 {
+		t.Fatalf("a new store has users %v", got)
+	}
+	ann, bob := create("Ann"), create("Bob")
+	if ann.ID != 1 || bob.ID != 2 || ann.Version != 1 || bob.Version != 1 {
+		t.Errorf("created IDs %d and %d at versions %d and %d, want 1 and 2 at 1", ann.ID, bob.ID, ann.Version, bob.Version)
+	}
+	if got, err := s.Get(ctx, 1); err != nil || !reflect.DeepEqual(got, ann) {
+		t.Errorf("Get(1) = %+v, %v; want %+v", got, err, ann)
+	}
+
+	ann.Name, ann.UpdatedAt, ann.Version = "Annie", at.Add(time.Hour), 2
+	if err := s.Update(ctx, ann); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, 1); err != nil || !reflect.DeepEqual(got, ann) {
+		t.Errorf("after Update, Get(1) = %+v, %v; want %+v", got, err, ann)
+	}
+	if err := s.Update(ctx, domain.User{ID: 99, Name: "Nobody"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Update(99) = %v, want ErrUserNotFound", err)
+	}
+
+	if err := s.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, 2); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrUserNotFound", err)
+	}
+	if err := s.Delete(ctx, 2); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("deleting twice = %v, want ErrUserNotFound", err)
+	}
+	if carl := create("Carl"); carl.ID != 3 {
+		t.Errorf("created ID %d after deleting 2, want 3: IDs aren't reused", carl.ID)
+	}
+
+	restored := []domain.User{newUser("Eve"), newUser("Gil")}
+	restored[0].ID, restored[1].ID = 7, 5
+	if err := s.Replace(ctx, restored); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(); !reflect.DeepEqual(got, []int{5, 7}) {
+		t.Errorf("after Replace, IDs %v, want [5 7]", got)
+	}
+	if next := create("Hal"); next.ID != 8 {
+		t.Errorf("created ID %d after Replace, want 8", next.ID)
+	}
+
+	// Each visits in ID order, and its fn's error stops it
+	var visited []string
+	stop := errors.New("stop")
+	err := s.Each(ctx, func(user domain.User) error {
+		visited = append(visited, user.Name)
+		if len(visited) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || !reflect.DeepEqual(visited, []string{"Gil", "Eve"}) {
+		t.Errorf("Each visited %v, returning %v; want [Gil Eve] and stop", visited, err)
+	}
+	if err := s.Replace(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if next := create("Ivy"); next.ID != 1 {
+		t.Errorf("created ID %d in an emptied store, want 1", next.ID)
+	}
+
+	older := models.APIKey{ID: "k1", Name: "ci", Role: models.RoleWriter, Hash: "hash-one", CreatedAt: at}
+	newer := models.APIKey{ID: "k2", Name: "ops", Role: models.RoleAdmin, Hash: "hash-two", CreatedAt: at.Add(time.Hour)}
+	for _, key := range []models.APIKey{newer, older} {
+		if err := s.CreateKey(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := s.KeyByHash(ctx, "hash-one"); err != nil || !reflect.DeepEqual(got, older) {
+		t.Errorf("KeyByHash = %+v, %v; want %+v", got, err, older)
+	}
+	if _, err := s.KeyByHash(ctx, "hash-three"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("KeyByHash of an unknown key = %v, want ErrKeyNotFound", err)
+	}
+	revokedAt := at.Add(2 * time.Hour)
+	if err := s.RevokeKey(ctx, "k1", revokedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeKey(ctx, "k1", revokedAt.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetKey(ctx, "k1"); err != nil || got.RevokedAt == nil || !got.RevokedAt.Equal(revokedAt) {
+		t.Errorf("after revoking twice, GetKey = %+v, %v; want it revoked the first time", got, err)
+	}
+	if err := s.RevokeKey(ctx, "k9", revokedAt); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RevokeKey of an unknown ID = %v, want ErrKeyNotFound", err)
+	}
+	keys, err := s.ListKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != "k1" || keys[1].ID != "k2" {
+		t.Errorf("ListKeys = %+v, want k1 then k2, oldest first", keys)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestOpenStore(t *testing.T) {
+	if s, err := Open("memory", "", ""); err != nil || s == nil {
+		t.Errorf("Open(memory) = %v, %v", s, err)
+	}
+	if _, err := Open("postgres", "", ""); err == nil {
+		t.Error("Open(postgres) succeeded")
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	testStore(t, NewCached(NewMemory(), 2, time.Minute, clock.NewFake(demo.Clock)))
+}
+
+// testTenant is the context key TestTenantedStore keeps the tenant under
+type testTenant struct{}
+
+func tenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(testTenant{}).(string)
+	return tenant
+}
+
+func newTenanted() *Tenanted {
+	return NewTenanted(NewMemory(), tenantOf, func(string) UserStore { return NewMemory() })
+}
+
+// TestTenantedStore checks each tenant's users are kept apart, with IDs
+// of their own
+func TestTenantedStore(t *testing.T) {
+	testStore(t, newTenanted())
+	s := newTenanted()
+	testStore(t, &tenantStore{s, context.WithValue(context.Background(), testTenant{}, "initech")})
+
+	acme := context.WithValue(context.Background(), testTenant{}, "acme")
+	defaultCtx := context.Background()
+	for _, c := range []struct {
+		ctx  context.Context
+		name string
+	}{{defaultCtx, "Dee"}, {acme, "Ann"}} {
+		if user, err := s.Create(c.ctx, domain.User{Name: c.name}); err != nil || user.ID != 1 {
+			t.Fatalf("Create(%s) = %+v, %v; want the tenant's user 1", c.name, user, err)
+		}
+	}
+	if user, err := s.Get(acme, 1); err != nil || user.Name != "Ann" {
+		t.Errorf("acme's user 1 = %+v, %v; want Ann", user, err)
+	}
+	if err := s.Delete(acme, 1); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := s.Get(defaultCtx, 1); err != nil || user.Name != "Dee" {
+		t.Errorf("the default tenant's user 1 = %+v, %v; want Dee, still there", user, err)
+	}
+	if got := s.Tenants(); !reflect.DeepEqual(got, []string{"acme", DefaultTenant, "initech"}) {
+		t.Errorf("Tenants = %q", got)
+	}
+
+	for i := len(s.Tenants()); i < MaxTenants; i++ {
+		if _, err := s.For(strings.Repeat("t", i)); err != nil {
+			t.Fatalf("tenant %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.For("one-too-many"); !errors.Is(err, ErrTooManyTenants) {
+		t.Errorf("tenant %d: %v, want ErrTooManyTenants", MaxTenants+1, err)
+	}
+	if _, err := s.For("acme"); err != nil {
+		t.Errorf("an existing tenant once full: %v", err)
+	}
+}
+
+// tenantStore is a Tenanted seen by one tenant, for testStore, which
+// passes it a context.Background
+type tenantStore struct {
+	*Tenanted
+	ctx context.Context
+}
+
+func (s *tenantStore) Get(_ context.Context, id int) (domain.User, error) {
+	return s.Tenanted.Get(s.ctx, id)
+}
+
+func (s *tenantStore) List(context.Context) ([]domain.User, error) {
+	return s.Tenanted.List(s.ctx)
+}
+
+func (s *tenantStore) Each(_ context.Context, fn func(domain.User) error) error {
+	return s.Tenanted.Each(s.ctx, fn)
+}
+
+func (s *tenantStore) Create(_ context.Context, user domain.User) (domain.User, error) {
+	return s.Tenanted.Create(s.ctx, user)
+}
+
+func (s *tenantStore) Update(_ context.Context, user domain.User) error {
+	return s.Tenanted.Update(s.ctx, user)
+}
+
+func (s *tenantStore) Delete(_ context.Context, id int) error {
+	return s.Tenanted.Delete(s.ctx, id)
+}
+
+func (s *tenantStore) Replace(_ context.Context, list []domain.User) error {
+	return s.Tenanted.Replace(s.ctx, list)
+}
+
+// TestLRU checks a full cache evicts the least recently used value, and a
+// value past its TTL is a miss
+func TestLRU(t *testing.T) {
+	fake := clock.NewFake(demo.Clock)
+	cache := NewLRU[string, int](2, time.Minute, fake)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	if v, ok := cache.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %t", v, ok)
+	}
+	cache.Add("c", 3) // b is the least recently used now
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b wasn't evicted")
+	}
+	if v, ok := cache.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %d, %t", v, ok)
+	}
+	cache.Add("a", 10)
+	if v, _ := cache.Get("a"); v != 10 {
+		t.Errorf("Get(a) after adding it again = %d, want 10", v)
+	}
+
+	fake.Advance(time.Minute)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a was found after its TTL")
+	}
+	want := models.CacheStats{Hits: 3, Misses: 2, Evictions: 1, Size: 1, Capacity: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	cache.Remove("c")
+	cache.Add("d", 4)
+	cache.Purge()
+	if got := cache.Stats().Size; got != 0 {
+		t.Errorf("size after Purge = %d", got)
+	}
+}
+
+// TestCacheInvalidation checks writes through Cached drop what they
+// change, and that reads come from the cache until they do
+func TestCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	s := NewCached(memory, 10, time.Minute, clock.NewFake(demo.Clock))
+	user, err := s.Create(ctx, domain.User{Name: "Ada", Email: "ada@example.com", Age: 36})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Behind the cache's back: the cached user is still the old one
+	changed := user
+	changed.Name = "Ada Lovelace"
+	if err := memory.Update(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(ctx, user.ID); got.Name != "Ada" {
+		t.Errorf("Get = %q, want the cached Ada", got.Name)
+	}
+
+	// Through it, the next Get sees the change
+	changed.Age = 37
+	if err := s.Update(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(ctx, user.ID); got.Name != "Ada Lovelace" || got.Age != 37 {
+		t.Errorf("Get after Update = %+v", got)
+	}
+	if err := s.Replace(ctx, []domain.User{{ID: user.ID, Name: "Grace"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(ctx, user.ID); got.Name != "Grace" {
+		t.Errorf("Get after Replace = %q, want Grace", got.Name)
+	}
+	if err := s.Delete(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrUserNotFound", err)
+	}
+	if stats := s.Stats(); stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("Stats = %+v, want 1 hit and 4 misses", stats)
+	}
+}
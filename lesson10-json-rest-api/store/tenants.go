@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang-lab/lab/domain"
+)
+
+// DefaultTenant is the tenant whose users are in the store Tenanted was
+// made with: the ones the API had before it had tenants
+const DefaultTenant = "default"
+
+// MaxTenants is how many tenants a Tenanted keeps, the default included
+const MaxTenants = 100
+
+// ErrTooManyTenants is returned for a new tenant once there are MaxTenants
+var ErrTooManyTenants = fmt.Errorf("a store keeps at most %d tenants", MaxTenants)
+
+// Tenanted is a UserStore that keeps each tenant's users apart. Every
+// user method goes to the store of the tenant its context is for, as
+// tenantOf says, so a handler that passes its request's context along
+// sees that tenant's users and no others, without knowing there are
+// tenants. IDs are each tenant's own: tenant a's user 1 isn't tenant b's.
+//
+// The default tenant's users are in the store Tenanted was made with;
+// any other tenant's store is made by newStore the first time it's
+// used. API keys aren't any tenant's: they're kept in the default
+// tenant's store, as are all of Ping and Close's concerns but closing
+// the other stores.
+type Tenanted struct {
+	UserStore // the default tenant's, and the API keys
+	tenantOf  func(context.Context) string
+	newStore  func(tenant string) UserStore
+
+	mu     sync.Mutex
+	others map[string]UserStore
+}
+
+// NewTenanted keeps the default tenant's users in base, and makes any
+// other tenant's store with newStore
+func NewTenanted(base UserStore, tenantOf func(context.Context) string, newStore func(tenant string) UserStore) *Tenanted {
+	return &Tenanted{UserStore: base, tenantOf: tenantOf, newStore: newStore, others: make(map[string]UserStore)}
+}
+
+// For is tenant's store, made the first time it's asked for
+func (t *Tenanted) For(tenant string) (UserStore, error) {
+	if tenant == "" || tenant == DefaultTenant {
+		return t.UserStore, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.others[tenant]; ok {
+		return s, nil
+	}
+	if len(t.others)+1 >= MaxTenants {
+		return nil, ErrTooManyTenants
+	}
+	s := t.newStore(tenant)
+	t.others[tenant] = s
+	return s, nil
+}
+
+// Tenants lists the tenants that have a store, sorted
+func (t *Tenanted) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenants := []string{DefaultTenant}
+	for tenant := range t.others {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+func (t *Tenanted) store(ctx context.Context) (UserStore, error) {
+	return t.For(t.tenantOf(ctx))
+}
+
+func (t *Tenanted) Get(ctx context.Context, id int) (domain.User, error) {
+	s, err := t.store(ctx)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (t *Tenanted) List(ctx context.Context) ([]domain.User, error) {
+	s, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.List(ctx)
+}
+
+func (t *Tenanted) Each(ctx context.Context, fn func(domain.User) error) error {
+	s, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Each(ctx, fn)
+}
+
+func (t *Tenanted) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	s, err := t.store(ctx)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return s.Create(ctx, user)
+}
+
+func (t *Tenanted) Update(ctx context.Context, user domain.User) error {
+	s, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Update(ctx, user)
+}
+
+func (t *Tenanted) Delete(ctx context.Context, id int) error {
+	s, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, id)
+}
+
+func (t *Tenanted) Replace(ctx context.Context, list []domain.User) error {
+	s, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Replace(ctx, list)
+}
+
+// Close closes every tenant's store
+func (t *Tenanted) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	errs := []error{t.UserStore.Close()}
+	for _, s := range t.others {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
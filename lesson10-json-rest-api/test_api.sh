@@ -6,6 +6,11 @@ API_BASE="http://localhost:8080/api"
 echo "=== Testing REST API ==="
 echo
 
+# Listen for changes to users while the rest of the script makes them
+EVENTS=$(mktemp)
+curl -s -N "$API_BASE/users/events" > "$EVENTS" &
+EVENTS_PID=$!
+
 # Test health endpoint
 echo "1. Testing health endpoint:"
 curl -s "$API_BASE/health" | python3 -m json.tool
@@ -18,33 +23,133 @@ curl -s "$API_BASE/users" | python3 -m json.tool
 echo
 echo
 
+# Test paging, sorting and filtering
+echo "2b. Getting the second page of three users, oldest first:"
+curl -s "$API_BASE/users?page=2&limit=3&sort=-age" | python3 -m json.tool
+echo
+echo
+
+# Test content negotiation: the same user as XML, then a page as YAML
+echo "2c. Getting user 1 as XML, then two users as YAML:"
+curl -s -H "Accept: application/xml" "$API_BASE/users/1"
+curl -s -H "Accept: application/yaml" "$API_BASE/users?limit=2"
+echo
+echo
+
 # Test getting specific user
 echo "3. Getting user with ID 1:"
 curl -s "$API_BASE/users/1" | python3 -m json.tool
 echo
 echo
 
+# Test versioning: v2 splits the name in two
+echo "3b. Getting user 1 from v2, with first_name and last_name:"
+curl -s "$API_BASE/v2/users/1" | python3 -m json.tool
+echo
+echo
+
+# Log in; changing users needs the token
+echo "4. Logging in as john@example.com:"
+TOKEN=$(curl -s -X POST \
+  -d '{"email":"john@example.com","password":"golab"}' \
+  "$API_BASE/auth/login" | python3 -c 'import json,sys; print(json.load(sys.stdin)["data"]["token"])')
+echo "Token: ${TOKEN:0:20}..."
+echo
+echo
+
 # Test creating a new user
-echo "4. Creating a new user:"
+echo "5. Creating a new user:"
 curl -s -X POST \
+  -H "Authorization: Bearer $TOKEN" \
   -H "Content-Type: application/json" \
   -d '{"name":"Alice Johnson","email":"alice@example.com","age":28}' \
   "$API_BASE/users" | python3 -m json.tool
 echo
 echo
 
-# Test updating a user
-echo "5. Updating user with ID 1:"
+echo "5b. Creating a user through v2:"
+curl -s -X POST \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"first_name":"Bob","last_name":"Stone","email":"bob@example.com","age":35}' \
+  "$API_BASE/v2/users" | python3 -m json.tool
+echo
+echo
+
+# Test bulk create: one good user, one invalid, and a result for each
+echo "5c. Creating two users in bulk (207 Multi-Status):"
+curl -s -X POST \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '[{"name":"Cara","email":"cara@example.com","age":33},{"name":"","email":"bad","age":30}]' \
+  "$API_BASE/users/bulk" | python3 -m json.tool
+echo
+echo
+
+# version_of prints the version user $1 is at now, for If-Match
+version_of() {
+  curl -s "$API_BASE/users/$1" | python3 -c 'import json,sys; print(json.load(sys.stdin)["data"]["version"])'
+}
+
+# Test updating a user, at the version it's at now
+echo "6. Updating user with ID 1:"
 curl -s -X PUT \
+  -H "Authorization: Bearer $TOKEN" \
   -H "Content-Type: application/json" \
+  -H "If-Match: $(version_of 1)" \
   -d '{"name":"Updated Name","age":26}' \
   "$API_BASE/users/1" | python3 -m json.tool
 echo
 echo
 
+# Patch the user two ways: a merge patch sets fields, and a JSON Patch
+# applies operations only if its test passes
+echo "6b. Patching user 1's age with a merge patch:"
+curl -s -X PATCH \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/merge-patch+json" \
+  -H "If-Match: $(version_of 1)" \
+  -d '{"age":27}' \
+  "$API_BASE/users/1" | python3 -m json.tool
+echo
+echo
+
+echo "6c. Patching user 1's name with a JSON Patch, if the age is still 27:"
+curl -s -X PATCH \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/json-patch+json" \
+  -H "If-Match: $(version_of 1)" \
+  -d '[{"op":"test","path":"/age","value":27},{"op":"replace","path":"/name","value":"Patched Name"}]' \
+  "$API_BASE/users/1" | python3 -m json.tool
+echo
+echo
+
+# Test conditional requests: a current ETag gets 304, a stale one 412
+echo "6d. Fetching user 1 with its ETag (304), then updating with a stale one (412):"
+ETAG=$(curl -s -o /dev/null -D - "$API_BASE/users/1" | tr -d '\r' | sed -n 's/^ETag: //Ip')
+curl -s -o /dev/null -w "%{http_code}\n" -H "If-None-Match: $ETAG" "$API_BASE/users/1"
+curl -s -X PUT \
+  -H "Authorization: Bearer $TOKEN" \
+  -H 'If-Match: "stale"' \
+  -d '{"age":28}' \
+  "$API_BASE/users/1" | python3 -m json.tool
+echo
+echo
+
+# Test optimistic locking: a change to version 1, long gone, gets 409
+echo "6e. Updating user 1 at a version it has moved on from (409):"
+curl -s -X PUT \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "If-Match: 1" \
+  -d '{"age":28}' \
+  "$API_BASE/users/1" | python3 -m json.tool
+echo
+echo
+
 # Test validation error
-echo "6. Testing validation (invalid email):"
+echo "7. Testing validation (invalid email):"
 curl -s -X POST \
+  -H "Authorization: Bearer $TOKEN" \
   -H "Content-Type: application/json" \
   -d '{"name":"","email":"invalid-email","age":200}' \
   "$API_BASE/users" | python3 -m json.tool
@@ -52,9 +157,34 @@ echo
 echo
 
 # Test 404 error
-echo "7. Testing 404 error (user not found):"
+echo "8. Testing 404 error (user not found):"
 curl -s "$API_BASE/users/999" | python3 -m json.tool
 echo
 echo
 
+# Test suggestions
+echo "9. Suggesting users whose name starts with 'j':"
+curl -s "$API_BASE/users/suggest?prefix=j" | python3 -m json.tool
+echo
+echo
+
+# Test search: every term has to match
+echo "9b. Searching for users over 25 whose name starts with 'j':"
+curl -s -G --data-urlencode 'q=name~^j age>25' "$API_BASE/users/search" | python3 -m json.tool
+echo
+echo
+
+# Test a write without a token
+echo "10. Deleting without a token (401):"
+curl -s -X DELETE "$API_BASE/users/2" | python3 -m json.tool
+echo
+echo
+
+# The events streamed while the script ran, as Server-Sent Events
+echo "11. Events streamed while testing:"
+kill "$EVENTS_PID"
+grep '^event:' "$EVENTS"
+rm -f "$EVENTS"
+echo
+
 echo "API testing completed!"
\ No newline at end of file
@@ -0,0 +1,53 @@
+package lesson11
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang-lab/lab/fixtures"
+	"golang-lab/lab/golden"
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+func TestDemonstrateBSON(t *testing.T) {
+	golden.Demo(t, "bson.golden", demonstrateBSON, golden.Timestamps)
+}
+
+func TestPrintStats(t *testing.T) {
+	var b strings.Builder
+	printStats(&b, models.UserStats{Total: 3, AverageAge: 30, MinAge: 20, MaxAge: 40,
+		AgeBuckets: map[string]int{"18-29": 1, "30-49": 2, "other": 1}})
+	want := `
+--- Aggregated Stats ---
+Users: 3, ages 20 to 40, average 30.0
+  0-17    0
+  18-29   1
+  30-49   2
+  50-150  0
+  other   1
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// TestSeedData seeds an empty store, and leaves one with users alone; any
+// UserStore will do, so it needs no server
+func TestSeedData(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	if err := seedData(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedData(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := s.List(ctx); err != nil || len(list) != fixtures.Small-1 {
+		t.Errorf("after seeding twice, %d users, %v; want %d", len(list), err, fixtures.Small-1)
+	}
+}
@@ -0,0 +1,115 @@
+// Lesson 11: MongoDB Document Storage
+// This lesson keeps lesson 10's users in MongoDB: BSON struct tags, the
+// store behind -storage mongo, and an aggregation pipeline for stats
+
+package lesson11
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"golang-lab/lab/domain"
+	"golang-lab/lab/fixtures"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// Run is the lesson's entry point; cmd/lesson11 calls it
+func Run() {
+	fmt.Println("=== Lesson 11: MongoDB Document Storage ===")
+
+	uri := flag.String("mongo-uri", "mongodb://localhost:27017/golang_lab", "the MongoDB server and database")
+	flag.Parse()
+
+	// Show how struct tags shape the stored document
+	demonstrateBSON(os.Stdout)
+
+	// The store is lesson 10's: the same one its API uses with -storage mongo
+	s, err := store.OpenMongo(*uri)
+	if err != nil {
+		fmt.Printf("\nCouldn't reach MongoDB: %v\n", err)
+		fmt.Println("Start one with: docker run -d --name mongo -p 27017:27017 mongo:7")
+		return
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.Printf("Failed to close the store: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := seedData(ctx, s); err != nil {
+		log.Fatalf("Failed to seed data: %v", err)
+	}
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		log.Fatalf("Failed to aggregate stats: %v", err)
+	}
+	printStats(os.Stdout, stats)
+
+	fmt.Println("\nServe these users over HTTP with lesson 10's API:")
+	fmt.Printf("  go run ./cmd/lesson10 -storage mongo -mongo-uri %s\n", *uri)
+}
+
+// seedData fills an empty store with lab/fixtures' sample users
+func seedData(ctx context.Context, s store.UserStore) error {
+	existing, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		fmt.Printf("\nStore already has %d users, skipping seed\n", len(existing))
+		return nil
+	}
+	fmt.Printf("\nSeeding %d users\n", fixtures.Small)
+	return s.Replace(ctx, fixtures.Users(fixtures.Small))
+}
+
+func demonstrateBSON(w io.Writer) {
+	fmt.Fprintln(w, "\n--- BSON Demonstration ---")
+
+	user := domain.User{
+		ID:        100,
+		Name:      "Demo User",
+		Email:     "demo@example.com",
+		Age:       28,
+		CreatedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		Version:   1,
+	}
+
+	// Marshal to BSON - the binary format MongoDB stores
+	data, err := bson.Marshal(user)
+	if err != nil {
+		fmt.Fprintf(w, "Error marshaling: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "BSON document is %d bytes\n", len(data))
+
+	// bson.Raw can print itself as extended JSON, which shows the real keys:
+	// the ID field became "_id" because of its bson tag
+	fmt.Fprintf(w, "As extended JSON: %s\n", bson.Raw(data).String())
+
+	// Unmarshal back into a struct
+	var decoded domain.User
+	if err := bson.Unmarshal(data, &decoded); err != nil {
+		fmt.Fprintf(w, "Error unmarshaling: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Decoded user: %+v\n", decoded)
+
+	// bson.M is an unordered map, bson.D keeps key order (needed for sorts
+	// and index definitions where order matters)
+	filter := bson.M{"age": bson.M{"$gte": 18}}
+	sort := bson.D{{Key: "age", Value: -1}, {Key: "name", Value: 1}}
+	fmt.Fprintf(w, "Filter: %v\n", filter)
+	fmt.Fprintf(w, "Sort: %v\n", sort)
+}
@@ -0,0 +1,23 @@
+package lesson11
+
+import (
+	"fmt"
+	"io"
+
+	"golang-lab/lesson10-json-rest-api/models"
+	"golang-lab/lesson10-json-rest-api/store"
+)
+
+// printStats prints what store.Mongo's stats pipeline worked out, a line
+// for each age bucket
+func printStats(w io.Writer, stats models.UserStats) {
+	fmt.Fprintln(w, "\n--- Aggregated Stats ---")
+	fmt.Fprintf(w, "Users: %d, ages %d to %d, average %.1f\n", stats.Total, stats.MinAge, stats.MaxAge, stats.AverageAge)
+	for i := 0; i < len(store.AgeBucketBoundaries)-1; i++ {
+		label := store.AgeBucketLabel(store.AgeBucketBoundaries[i], store.AgeBucketBoundaries[i+1])
+		fmt.Fprintf(w, "  %-7s %d\n", label, stats.AgeBuckets[label])
+	}
+	if n := stats.AgeBuckets["other"]; n > 0 {
+		fmt.Fprintf(w, "  %-7s %d\n", "other", n)
+	}
+}
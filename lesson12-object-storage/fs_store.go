@@ -0,0 +1,258 @@
+package lesson12
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fsStore is a filesystem fake of an S3 bucket. It keeps each object as a
+// file plus a small ".meta" sidecar holding the content type, and imitates
+// presigned URLs with an HMAC signature it can verify itself.
+type fsStore struct {
+	root    string
+	baseURL string // where fsStore.ServeHTTP is mounted, e.g. http://localhost:8080/files
+	secret  []byte
+}
+
+func newFSStore(root, baseURL string) (*fsStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", root, err)
+	}
+
+	// A fresh secret per run means old presigned links stop working after a
+	// restart - fine for a fake
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &fsStore{root: root, baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+// path turns an object key into a file path, refusing keys that would
+// escape the root directory (e.g. "../../etc/passwd")
+func (s *fsStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *fsStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	// Write to a temporary file and rename it into place, so readers never
+	// see a half-written object - S3 gives the same guarantee
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("writing %s: %w", key, err)
+	}
+	if size >= 0 && written != size {
+		return ObjectInfo{}, fmt.Errorf("writing %s: got %d bytes, expected %d", key, written, size)
+	}
+
+	meta, err := json.Marshal(map[string]string{"content_type": contentType})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.WriteFile(path+".meta", meta, 0o644); err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{Key: key, Size: written, ContentType: contentType, LastModified: time.Now()}, nil
+}
+
+func (s *fsStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	return file, s.info(key, path, stat), nil
+}
+
+// info describes the object in the file at path, reading its content type
+// from the sidecar
+func (s *fsStore) info(key, path string, stat fs.FileInfo) ObjectInfo {
+	info := ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  "application/octet-stream",
+		LastModified: stat.ModTime(),
+	}
+	if data, err := os.ReadFile(path + ".meta"); err == nil {
+		var meta map[string]string
+		if json.Unmarshal(data, &meta) == nil && meta["content_type"] != "" {
+			info.ContentType = meta["content_type"]
+		}
+	}
+	return info
+}
+
+func (s *fsStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	} else if err != nil {
+		return err
+	}
+	os.Remove(path + ".meta")
+	return nil
+}
+
+func (s *fsStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	list := []ObjectInfo{}
+	err := filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		// Sidecars and unfinished uploads aren't objects
+		name := entry.Name()
+		if strings.HasSuffix(name, ".meta") || strings.HasPrefix(name, ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		list = append(list, s.info(key, path, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", prefix, err)
+	}
+	// WalkDir goes directory by directory, which isn't quite key order:
+	// "a/b" comes before "a-b" there
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+func (s *fsStore) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, expiry), nil
+}
+
+func (s *fsStore) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.presign(http.MethodPut, key, expiry), nil
+}
+
+// presign builds a URL whose signature covers the method, key, and expiry
+// time, so none of them can be changed without invalidating it. Real S3
+// presigning (SigV4) works on the same idea with more inputs.
+func (s *fsStore) presign(method, key string, expiry time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(method, key, expires))
+	return s.baseURL + "/" + key + "?" + query.Encode()
+}
+
+func (s *fsStore) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", method, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP plays the part of the S3 endpoint for presigned URLs
+func (s *fsStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	// hmac.Equal compares in constant time so the signature can't be
+	// guessed byte by byte from response timings
+	expected := s.sign(r.Method, key, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		body, info, err := s.Get(r.Context(), key)
+		if errors.Is(err, ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", info.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		io.Copy(w, body)
+	case http.MethodPut:
+		contentType := r.Header.Get("Content-Type")
+		if _, err := s.Put(r.Context(), key, r.Body, r.ContentLength, contentType); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,362 @@
+package lesson12
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"golang-lab/lab/golden"
+)
+
+// presigned URL signatures change on every run (the fs store picks a new
+// secret each time), so they are replaced before comparing
+var signatures = golden.Replace(`expires=\d+(&|\\u0026)signature=[0-9a-f]+`, "expires=<unix time>${1}signature=<hmac>")
+
+func newTestStore(t *testing.T) *fsStore {
+	t.Helper()
+	store, err := newFSStore(t.TempDir(), "http://localhost:8080/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestDemonstrateObjectStore(t *testing.T) {
+	store := newTestStore(t)
+	golden.Demo(t, "objectstore.golden", func(w io.Writer) {
+		demonstrateObjectStore(context.Background(), w, store)
+	}, golden.Timestamps, signatures)
+}
+
+// TestAvatarAPI sends a fixed script of requests to the avatar routes,
+// backed by the fs store, and compares the responses with
+// testdata/avatar.golden
+func TestAvatarAPI(t *testing.T) {
+	objects = newTestStore(t)
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 64)
+
+	requests := []struct{ method, target, body string }{
+		{"GET", "/api/users/1/avatar", ""},
+		{"PUT", "/api/users/1/avatar", "not an image"},
+		{"PUT", "/api/users/1/avatar", png},
+		{"GET", "/api/users/1/avatar", ""},
+		{"GET", "/api/users/1/avatar/url", ""},
+		{"GET", "/api/users/1/avatar/url?expiry=forever", ""},
+		{"POST", "/api/users/1/avatar/upload-url?expiry=1h", ""},
+		{"DELETE", "/api/users/1/avatar", ""},
+		{"DELETE", "/api/users/1/avatar", ""},
+		{"GET", "/api/users/abc/avatar", ""},
+	}
+
+	var transcript strings.Builder
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+		rec := httptest.NewRecorder()
+		handleAvatar(rec, r)
+
+		contentType := rec.Header().Get("Content-Type")
+		body := strings.TrimSpace(rec.Body.String())
+		if strings.HasPrefix(contentType, "image/") {
+			body = fmt.Sprintf("(%d bytes)", rec.Body.Len())
+		}
+		status := strings.TrimSpace(fmt.Sprintf("%d %s", rec.Code, contentType))
+		fmt.Fprintf(&transcript, "%s %s\n%s\n%s\n\n", req.method, req.target, status, body)
+	}
+	golden.Check(t, "avatar.golden", transcript.String(), golden.Timestamps, signatures)
+}
+
+// pngBytes is enough of a PNG for http.DetectContentType
+func pngBytes(fill string) string {
+	return "\x89PNG\r\n\x1a\n" + strings.Repeat(fill, 64)
+}
+
+// serve sends a request to the avatar routes the way Run's mux does
+func serve(method, target string, body io.Reader) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, body)
+	if strings.HasPrefix(target, "/api/avatars") {
+		handleListAvatars(rec, r)
+	} else {
+		handleAvatar(rec, r)
+	}
+	return rec
+}
+
+// servePresigned sends a request to a presigned URL from store, the part
+// Run mounts at /files
+func servePresigned(store *fsStore, method, presigned string, body io.Reader) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest(method, strings.TrimPrefix(presigned, store.baseURL), body))
+	return rec
+}
+
+func TestAvatarUploadDownload(t *testing.T) {
+	objects = newTestStore(t)
+	avatar := pngBytes("\x01")
+
+	tests := []struct {
+		name, method, target, body string
+		wantCode                   int
+		wantType, wantBody         string // wantBody "" means don't check it
+	}{
+		{"missing avatar", "GET", "/api/users/1/avatar", "", http.StatusNotFound, "application/json", `{"error":"Avatar not found"}`},
+		{"upload", "PUT", "/api/users/1/avatar", avatar, http.StatusCreated, "application/json", ""},
+		{"download", "GET", "/api/users/1/avatar", "", http.StatusOK, "image/png", avatar},
+		{"gif", "PUT", "/api/users/2/avatar", "GIF89a" + strings.Repeat("\x00", 32), http.StatusCreated, "application/json", ""},
+		{"gif back", "GET", "/api/users/2/avatar", "", http.StatusOK, "image/gif", ""},
+		{"not an image", "PUT", "/api/users/3/avatar", "<html></html>", http.StatusUnsupportedMediaType, "application/json", ""},
+		{"too large", "PUT", "/api/users/3/avatar", pngBytes("") + strings.Repeat("\x00", maxAvatarSize), http.StatusRequestEntityTooLarge, "application/json", `{"error":"Avatar is larger than 20 MiB"}`},
+		{"rejected upload not stored", "GET", "/api/users/3/avatar", "", http.StatusNotFound, "application/json", ""},
+		{"bad user ID", "GET", "/api/users/-1/avatar", "", http.StatusBadRequest, "application/json", `{"error":"Invalid user ID"}`},
+		{"traversal as user ID", "GET", "/api/users/../avatar", "", http.StatusBadRequest, "application/json", ""},
+		{"wrong method", "POST", "/api/users/1/avatar", "", http.StatusMethodNotAllowed, "application/json", ""},
+		{"delete", "DELETE", "/api/users/1/avatar", "", http.StatusNoContent, "", ""},
+		{"deleted", "GET", "/api/users/1/avatar", "", http.StatusNotFound, "application/json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.method, tt.target, strings.NewReader(tt.body))
+			body := strings.TrimSpace(rec.Body.String())
+			if rec.Code != tt.wantCode || rec.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("got %d %s, want %d %s: %.200s", rec.Code, rec.Header().Get("Content-Type"), tt.wantCode, tt.wantType, body)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body %.200q, want %.200q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListAvatars(t *testing.T) {
+	store := newTestStore(t)
+	objects = store
+	ctx := context.Background()
+
+	list := func() []ObjectInfo {
+		t.Helper()
+		rec := serve("GET", "/api/avatars", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/avatars: %d %s", rec.Code, rec.Body)
+		}
+		var got []ObjectInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := list(); got == nil || len(got) != 0 {
+		t.Errorf("empty bucket listed %v, want []", got)
+	}
+
+	for _, id := range []int{10, 2, 1} {
+		if rec := serve("PUT", fmt.Sprintf("/api/users/%d/avatar", id), strings.NewReader(pngBytes("x"))); rec.Code != http.StatusCreated {
+			t.Fatalf("upload for user %d: %d %s", id, rec.Code, rec.Body)
+		}
+	}
+	// Only avatars are listed, not other objects in the bucket
+	if _, err := store.Put(ctx, "demo/hello.txt", strings.NewReader("hi"), -1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := list()
+	var keys []string
+	for _, info := range got {
+		keys = append(keys, info.Key)
+		if info.Size != int64(len(pngBytes("x"))) || info.ContentType != "image/png" {
+			t.Errorf("%s: %d bytes of %s", info.Key, info.Size, info.ContentType)
+		}
+	}
+	if want := "avatars/user-1 avatars/user-10 avatars/user-2"; strings.Join(keys, " ") != want {
+		t.Errorf("listed %v, want %s", keys, want)
+	}
+
+	if rec := serve("POST", "/api/avatars", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/avatars: %d", rec.Code)
+	}
+}
+
+func TestPresignedURLs(t *testing.T) {
+	store := newTestStore(t)
+	objects = store
+	ctx := context.Background()
+	avatar := pngBytes("\x02")
+
+	presigned := func(method, target string) string {
+		t.Helper()
+		rec := serve(method, target, nil)
+		var resp struct{ Method, URL string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, target, rec.Code, rec.Body)
+		}
+		if !strings.HasPrefix(resp.URL, store.baseURL+"/avatars/user-1?") {
+			t.Fatalf("%s %s gave the URL %s", method, target, resp.URL)
+		}
+		return resp.URL
+	}
+	uploadURL := presigned("POST", "/api/users/1/avatar/upload-url?expiry=1m")
+	downloadURL := presigned("GET", "/api/users/1/avatar/url")
+
+	// Before the upload, the download link finds nothing
+	if rec := servePresigned(store, "GET", downloadURL, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("download before the upload: %d", rec.Code)
+	}
+
+	// The client uploads straight to storage, and the API serves the result
+	put := httptest.NewRequest("PUT", strings.TrimPrefix(uploadURL, store.baseURL), strings.NewReader(avatar))
+	put.Header.Set("Content-Type", "image/png")
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, put)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("presigned upload: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve("GET", "/api/users/1/avatar", nil); rec.Code != http.StatusOK || rec.Body.String() != avatar {
+		t.Errorf("download through the API: %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec := servePresigned(store, "GET", downloadURL, nil); rec.Code != http.StatusOK || rec.Body.String() != avatar || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("presigned download: %d %s, %d bytes", rec.Code, rec.Header().Get("Content-Type"), rec.Body.Len())
+	}
+
+	expired, err := store.PresignGet(ctx, "avatars/user-1", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, method, url string
+		wantBody          string
+	}{
+		{"download link used to upload", "PUT", downloadURL, "invalid signature"},
+		{"upload link used to download", "GET", uploadURL, "invalid signature"},
+		{"another key", "GET", strings.Replace(downloadURL, "user-1", "user-2", 1), "invalid signature"},
+		{"later expiry", "GET", strings.Replace(downloadURL, "expires=", "expires=9", 1), "invalid signature"},
+		{"no signature", "GET", strings.Split(downloadURL, "?")[0], "invalid signature"},
+		{"expired", "GET", expired, "link expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := servePresigned(store, tt.method, tt.url, strings.NewReader("overwritten"))
+			if rec.Code != http.StatusForbidden || strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("got %d %q, want 403 %q", rec.Code, rec.Body, tt.wantBody)
+			}
+		})
+	}
+	if rec := serve("GET", "/api/users/1/avatar", nil); rec.Body.String() != avatar {
+		t.Error("a refused request changed the avatar")
+	}
+
+	for expiry, want := range map[string]int{"200h": 400, "168h1s": 400, "168h": 200, "1s": 200, "999ms": 400, "0s": 400, "-1m": 400} {
+		if rec := serve("GET", "/api/users/1/avatar/url?expiry="+expiry, nil); rec.Code != want {
+			t.Errorf("expiry %s: %d, want %d", expiry, rec.Code, want)
+		}
+	}
+}
+
+// TestFSStorePathTraversal checks that keys with .. or a leading / stay
+// inside the store's directory, whether they come from code or from a
+// presigned URL
+func TestFSStorePathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newFSStore(filepath.Join(dir, "bucket"), "http://localhost:8080/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"../escape", "../../escape", "a/../../escape", "/escape", "a/b/../../../escape"} {
+		if _, err := store.Put(ctx, key, strings.NewReader(key), -1, "text/plain"); err != nil {
+			t.Errorf("Put(%q): %v", key, err)
+			continue
+		}
+		// The same key reads back what was written, from inside the bucket
+		body, _, err := store.Get(ctx, key)
+		if err != nil {
+			t.Errorf("Get(%q): %v", key, err)
+			continue
+		}
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if string(got) != key {
+			t.Errorf("Get(%q) = %q", key, got)
+		}
+	}
+
+	upload, err := store.PresignPut(ctx, "../../outside", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := servePresigned(store, "PUT", upload, strings.NewReader("from a URL")); rec.Code != http.StatusOK {
+		t.Errorf("presigned upload to ../../outside: %d %s", rec.Code, rec.Body)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "bucket" {
+		t.Errorf("%s holds %v; a key escaped the bucket", dir, entries)
+	}
+	for _, name := range []string{"escape", "outside"} {
+		if _, err := os.Stat(filepath.Join(dir, "bucket", name)); err != nil {
+			t.Errorf("%s isn't inside the bucket: %v", name, err)
+		}
+	}
+
+	for _, key := range []string{"", "/", "..", "../.."} {
+		if _, err := store.Put(ctx, key, strings.NewReader("x"), -1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", key)
+		}
+	}
+	if _, _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get of a missing key: %v, want ErrObjectNotFound", err)
+	}
+	if err := store.Delete(ctx, "../missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Delete of a missing key: %v, want ErrObjectNotFound", err)
+	}
+	if _, err := store.Put(ctx, "sized", bytes.NewReader([]byte("abc")), 4, "text/plain"); err == nil {
+		t.Error("Put with the wrong size succeeded")
+	}
+}
+
+// TestS3PutEmptyUnknownSize uploads an empty body of unknown size to a
+// stand-in for S3, and checks it goes up as one PutObject, not as a
+// multipart upload with no parts, which S3 rejects
+func TestS3PutEmptyUnknownSize(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		if r.Method != "PUT" || r.URL.RawQuery != "" {
+			http.Error(w, "only a plain PutObject is expected", http.StatusNotImplemented)
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer server.Close()
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &s3Store{client: client, core: minio.Core{Client: client}, bucket: "avatars"}
+
+	info, err := s.Put(context.Background(), "users/1/avatar", strings.NewReader(""), -1, "image/png")
+	if err != nil || info.Size != 0 {
+		t.Errorf("Put of an empty body = %+v, %v; want 0 bytes", info, err)
+	}
+	if len(requests) != 1 || requests[0] != "PUT /avatars/users/1/avatar?" {
+		t.Errorf("requests %q, want one PUT of the object", requests)
+	}
+}
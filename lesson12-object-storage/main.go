@@ -0,0 +1,313 @@
+// Lesson 12: Object Storage (S3-Compatible)
+// This lesson stores user avatars in an S3-compatible bucket (MinIO) with
+// streaming uploads, multipart uploads for large files, and presigned URLs
+
+package lesson12
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAvatarSize caps uploads so a client can't fill the bucket
+const maxAvatarSize = 20 << 20 // 20 MiB
+
+// allowedAvatarTypes are checked against the sniffed content, not the
+// Content-Type header the client claims
+var allowedAvatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// objects is chosen at startup with the -backend flag
+var objects ObjectStore
+
+// Run is the lesson's entry point; cmd/lesson12 calls it
+func Run() {
+	fmt.Println("=== Lesson 12: Object Storage (S3-Compatible) ===")
+
+	backend := flag.String("backend", "fs", "object storage backend: fs or s3")
+	dir := flag.String("dir", "./data", "directory used by the fs backend")
+	endpoint := flag.String("endpoint", "localhost:9000", "S3 endpoint (host:port)")
+	accessKey := flag.String("access-key", "minioadmin", "S3 access key")
+	secretKey := flag.String("secret-key", "minioadmin", "S3 secret key")
+	bucket := flag.String("bucket", "avatars", "bucket name")
+	useSSL := flag.Bool("ssl", false, "use HTTPS to reach the S3 endpoint")
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	mux := http.NewServeMux()
+
+	switch *backend {
+	case "fs":
+		store, err := newFSStore(*dir, "http://localhost"+*addr+"/files")
+		if err != nil {
+			log.Fatalf("Failed to open fs store: %v", err)
+		}
+		// The fake serves its own presigned URLs
+		mux.Handle("/files/", http.StripPrefix("/files", store))
+		objects = store
+	case "s3":
+		store, err := newS3Store(ctx, *endpoint, *accessKey, *secretKey, *bucket, *useSSL)
+		if err != nil {
+			log.Fatalf("Failed to open s3 store: %v", err)
+		}
+		objects = store
+	default:
+		log.Fatalf("Unknown backend %q (want fs or s3)", *backend)
+	}
+
+	demonstrateObjectStore(ctx, os.Stdout, objects)
+
+	mux.HandleFunc("/api/users/", handleAvatar)
+	mux.HandleFunc("/api/avatars", handleListAvatars)
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: mux,
+	}
+
+	fmt.Printf("\nStarting avatar server with %s backend on http://localhost%s\n", *backend, *addr)
+	fmt.Println("Available endpoints:")
+	fmt.Println("  PUT    /api/users/{id}/avatar             - Upload avatar (raw image body)")
+	fmt.Println("  GET    /api/users/{id}/avatar             - Download avatar through the API")
+	fmt.Println("  DELETE /api/users/{id}/avatar             - Delete avatar")
+	fmt.Println("  GET    /api/users/{id}/avatar/url         - Presigned download URL")
+	fmt.Println("  POST   /api/users/{id}/avatar/upload-url  - Presigned upload URL")
+	fmt.Println("  GET    /api/avatars                       - List every avatar")
+	fmt.Println("\nTest with curl:")
+	fmt.Printf("  curl -X PUT --data-binary @photo.png http://localhost%s/api/users/1/avatar\n", *addr)
+	fmt.Println("\nPress Ctrl+C to stop the server")
+
+	log.Fatal(server.ListenAndServe())
+}
+
+func demonstrateObjectStore(ctx context.Context, w io.Writer, store ObjectStore) {
+	fmt.Fprintln(w, "\n--- Object Store Demonstration ---")
+
+	// Small object: a single PUT request
+	info, err := store.Put(ctx, "demo/hello.txt", strings.NewReader("Hello, object storage!"), -1, "text/plain")
+	if err != nil {
+		fmt.Fprintf(w, "Error uploading: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Uploaded %s (%d bytes)\n", info.Key, info.Size)
+
+	// Large object: above multipartThreshold the S3 store splits it into
+	// parts that are uploaded separately and stitched together at the end
+	large := bytes.Repeat([]byte("0123456789abcdef"), (12<<20)/16)
+	info, err = store.Put(ctx, "demo/large.bin", bytes.NewReader(large), int64(len(large)), "application/octet-stream")
+	if err != nil {
+		fmt.Fprintf(w, "Error uploading large object: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Uploaded %s (%d bytes)\n", info.Key, info.Size)
+
+	// Read it back
+	body, info, err := store.Get(ctx, "demo/hello.txt")
+	if err != nil {
+		fmt.Fprintf(w, "Error downloading: %v\n", err)
+		return
+	}
+	content, _ := io.ReadAll(body)
+	body.Close()
+	fmt.Fprintf(w, "Downloaded %s (%s): %q\n", info.Key, info.ContentType, content)
+
+	// Presigned URL - shareable without credentials until it expires
+	url, err := store.PresignGet(ctx, "demo/hello.txt", 5*time.Minute)
+	if err != nil {
+		fmt.Fprintf(w, "Error presigning: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Presigned URL (valid 5 minutes):\n  %s\n", url)
+
+	// Missing objects map to a sentinel error regardless of backend
+	if _, _, err := store.Get(ctx, "demo/missing.txt"); errors.Is(err, ErrObjectNotFound) {
+		fmt.Fprintln(w, "Missing object correctly reported as ErrObjectNotFound")
+	}
+
+	store.Delete(ctx, "demo/large.bin")
+}
+
+// handleAvatar routes /api/users/{id}/avatar[/url|/upload-url]
+func handleAvatar(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[3] != "avatar" {
+		http.NotFound(w, r)
+		return
+	}
+	userID, err := strconv.Atoi(parts[2])
+	if err != nil || userID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	key := fmt.Sprintf("avatars/user-%d", userID)
+
+	switch {
+	case len(parts) == 4 && r.Method == http.MethodPut:
+		uploadAvatar(w, r, key)
+	case len(parts) == 4 && r.Method == http.MethodGet:
+		downloadAvatar(w, r, key)
+	case len(parts) == 4 && r.Method == http.MethodDelete:
+		deleteAvatar(w, r, key)
+	case len(parts) == 5 && parts[4] == "url" && r.Method == http.MethodGet:
+		presignAvatar(w, r, key, http.MethodGet)
+	case len(parts) == 5 && parts[4] == "upload-url" && r.Method == http.MethodPost:
+		presignAvatar(w, r, key, http.MethodPut)
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// PUT /api/users/{id}/avatar
+func uploadAvatar(w http.ResponseWriter, r *http.Request, key string) {
+	// MaxBytesReader stops reading (and fails the upload) past the limit,
+	// without us buffering the body to measure it first
+	body := http.MaxBytesReader(w, r.Body, maxAvatarSize)
+
+	// Peek at the first 512 bytes to detect the real content type, then
+	// keep streaming from the same buffered reader
+	buffered := bufio.NewReader(body)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Failed to read upload")
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if !allowedAvatarTypes[contentType] {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Avatar must be a PNG, JPEG, GIF, or WebP image, got "+contentType)
+		return
+	}
+
+	info, err := objects.Put(r.Context(), key, buffered, r.ContentLength, contentType)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Avatar is larger than 20 MiB")
+			return
+		}
+		log.Printf("Upload failed: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Upload failed")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, info)
+}
+
+// GET /api/users/{id}/avatar
+func downloadAvatar(w http.ResponseWriter, r *http.Request, key string) {
+	body, info, err := objects.Get(r.Context(), key)
+	if errors.Is(err, ErrObjectNotFound) {
+		respondWithError(w, http.StatusNotFound, "Avatar not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Download failed: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Download failed")
+		return
+	}
+	defer body.Close()
+
+	// Stream straight from the store to the client - the image is never
+	// held in memory as a whole
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Streaming %s failed: %v", key, err)
+	}
+}
+
+// DELETE /api/users/{id}/avatar
+func deleteAvatar(w http.ResponseWriter, r *http.Request, key string) {
+	err := objects.Delete(r.Context(), key)
+	if errors.Is(err, ErrObjectNotFound) {
+		respondWithError(w, http.StatusNotFound, "Avatar not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Delete failed: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Delete failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/avatars
+func handleListAvatars(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	list, err := objects.List(r.Context(), "avatars/")
+	if err != nil {
+		log.Printf("List failed: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "List failed")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// GET /api/users/{id}/avatar/url and POST /api/users/{id}/avatar/upload-url
+func presignAvatar(w http.ResponseWriter, r *http.Request, key, method string) {
+	expiry := 15 * time.Minute
+	if raw := r.URL.Query().Get("expiry"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < time.Second || parsed > 7*24*time.Hour {
+			respondWithError(w, http.StatusBadRequest, "expiry must be a duration between 1s and 168h")
+			return
+		}
+		expiry = parsed
+	}
+
+	var url string
+	var err error
+	if method == http.MethodPut {
+		url, err = objects.PresignPut(r.Context(), key, expiry)
+	} else {
+		url, err = objects.PresignGet(r.Context(), key, expiry)
+	}
+	if err != nil {
+		log.Printf("Presign failed: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Presign failed")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"method":     method,
+		"url":        url,
+		"expires_at": time.Now().Add(expiry).Format(time.RFC3339),
+	})
+}
+
+// Helper functions
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, map[string]string{"error": message})
+}
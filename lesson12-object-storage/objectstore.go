@@ -0,0 +1,37 @@
+package lesson12
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ObjectInfo describes a stored object without its contents
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ErrObjectNotFound is returned by every ObjectStore when a key is missing
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the small slice of S3 this lesson needs. The avatar
+// handlers only see this interface, so the MinIO client and the filesystem
+// fake are interchangeable.
+type ObjectStore interface {
+	// Put streams r into the store. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error)
+	// Get returns a reader for the object; the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PresignGet returns a URL anyone can download from until expiry,
+	// without credentials and without going through our API
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// PresignPut returns a URL a client can upload to directly
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
@@ -0,0 +1,209 @@
+package lesson12
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// Objects at least this big go through an explicit multipart upload
+	multipartThreshold = 8 << 20 // 8 MiB
+	// S3 requires every part except the last to be at least 5 MiB
+	partSize = 5 << 20
+)
+
+// s3Store talks to any S3-compatible service (AWS S3, MinIO, ...)
+type s3Store struct {
+	client *minio.Client
+	core   minio.Core // lower-level API exposing the multipart calls
+	bucket string
+}
+
+func newS3Store(ctx context.Context, endpoint, accessKey, secretKey, bucket string, useSSL bool) (*s3Store, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 client: %w", err)
+	}
+
+	// Buckets are created once; MakeBucket on an existing bucket fails, so
+	// check first
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("checking bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("creating bucket %s: %w", bucket, err)
+		}
+		fmt.Printf("Created bucket %s\n", bucket)
+	}
+
+	return &s3Store{client: client, core: minio.Core{Client: client}, bucket: bucket}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	opts := minio.PutObjectOptions{ContentType: contentType}
+
+	// Unknown or large sizes: upload in parts. (minio.Client.PutObject would
+	// do this for us; spelling it out shows what happens on the wire.)
+	if size < 0 || size >= multipartThreshold {
+		return s.putMultipart(ctx, key, r, opts)
+	}
+
+	upload, err := s.client.PutObject(ctx, s.bucket, key, r, size, opts)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("uploading %s: %w", key, err)
+	}
+	return ObjectInfo{Key: key, Size: upload.Size, ContentType: contentType, LastModified: time.Now()}, nil
+}
+
+// putMultipart uploads r in partSize chunks. Each part is a separate request,
+// so a failed part can be retried without resending the whole object, and
+// only one part is held in memory at a time. A body that turns out to fit
+// in one part, including an empty one, is sent with a plain PutObject
+// instead: S3 rejects a multipart upload with no parts.
+func (s *s3Store) putMultipart(ctx context.Context, key string, r io.Reader, opts minio.PutObjectOptions) (ObjectInfo, error) {
+	buf := make([]byte, partSize)
+	n, readErr := io.ReadFull(r, buf)
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		upload, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(buf[:n]), int64(n), opts)
+		if err != nil {
+			return ObjectInfo{}, fmt.Errorf("uploading %s: %w", key, err)
+		}
+		return ObjectInfo{Key: key, Size: upload.Size, ContentType: opts.ContentType, LastModified: time.Now()}, nil
+	}
+	if readErr != nil {
+		return ObjectInfo{}, fmt.Errorf("reading %s: %w", key, readErr)
+	}
+
+	uploadID, err := s.core.NewMultipartUpload(ctx, s.bucket, key, opts)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("starting multipart upload of %s: %w", key, err)
+	}
+
+	var parts []minio.CompletePart
+	var total int64
+	for partNumber := 1; ; partNumber++ {
+		if n > 0 {
+			part, err := s.core.PutObjectPart(ctx, s.bucket, key, uploadID, partNumber,
+				bytes.NewReader(buf[:n]), int64(n), minio.PutObjectPartOptions{})
+			if err != nil {
+				s.abort(key, uploadID)
+				return ObjectInfo{}, fmt.Errorf("uploading part %d of %s: %w", partNumber, key, err)
+			}
+			parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+			total += int64(n)
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			s.abort(key, uploadID)
+			return ObjectInfo{}, fmt.Errorf("reading %s: %w", key, readErr)
+		}
+		n, readErr = io.ReadFull(r, buf)
+	}
+
+	// Nothing becomes visible in the bucket until this call succeeds
+	if _, err := s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, parts, opts); err != nil {
+		s.abort(key, uploadID)
+		return ObjectInfo{}, fmt.Errorf("completing upload of %s: %w", key, err)
+	}
+	return ObjectInfo{Key: key, Size: total, ContentType: opts.ContentType, LastModified: time.Now()}, nil
+}
+
+// abort frees the parts of a failed upload; without it they keep using
+// (and billing) storage. It uses a fresh context because the request's own
+// context may be the reason we are aborting.
+func (s *s3Store) abort(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.core.AbortMultipartUpload(ctx, s.bucket, key, uploadID); err != nil {
+		fmt.Printf("Warning: failed to abort upload %s: %v\n", uploadID, err)
+	}
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("downloading %s: %w", key, err)
+	}
+
+	// GetObject is lazy - Stat makes the first request and surfaces errors
+	// such as a missing key
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, fmt.Errorf("downloading %s: %w", key, err)
+	}
+
+	return object, ObjectInfo{
+		Key:          key,
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		LastModified: stat.LastModified,
+	}, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	// S3 deletes are idempotent and succeed for missing keys, so check
+	// first to keep the same contract as the filesystem fake
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// ListObjects pages through the bucket in the background; cancelling
+	// the context stops it if we return early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// S3 returns keys in order. A listing carries no content types, so
+	// ContentType is left empty rather than asking for each object's.
+	list := []ObjectInfo{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("listing %s: %w", prefix, object.Err)
+		}
+		list = append(list, ObjectInfo{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+	}
+	return list, nil
+}
+
+func (s *s3Store) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("presigning %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+func (s *s3Store) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, expiry)
+	if err != nil {
+		return "", fmt.Errorf("presigning %s: %w", key, err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,85 @@
+package lesson13
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the server needs. In a container there is no
+// config file to edit and no flags to pass through the orchestrator
+// comfortably, so everything comes from environment variables (the twelve-
+// factor app approach).
+type Config struct {
+	Port            int
+	Environment     string
+	LogLevel        slog.Level
+	LogFormat       string
+	ShutdownTimeout time.Duration
+	Version         string
+}
+
+// loadConfig reads Config from the environment, applying defaults for
+// anything unset and collecting every problem instead of stopping at the
+// first one
+func loadConfig() (Config, error) {
+	cfg := Config{
+		Port:            8080,
+		Environment:     getEnv("APP_ENV", "development"),
+		LogFormat:       getEnv("LOG_FORMAT", "json"),
+		ShutdownTimeout: 15 * time.Second,
+		Version:         getEnv("APP_VERSION", "dev"),
+	}
+
+	var problems []string
+
+	// Platforms like Cloud Run and Heroku tell the app which port to use
+	// through $PORT
+	if raw := os.Getenv("PORT"); raw != "" {
+		port, err := strconv.Atoi(raw)
+		if err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("PORT must be a number between 1 and 65535, got %q", raw))
+		} else {
+			cfg.Port = port
+		}
+	}
+
+	if err := cfg.LogLevel.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL: %v", err))
+	}
+
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		problems = append(problems, fmt.Sprintf("LOG_FORMAT must be json or text, got %q", cfg.LogFormat))
+	}
+
+	if raw := os.Getenv("SHUTDOWN_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("SHUTDOWN_TIMEOUT must be a positive duration, got %q", raw))
+		} else {
+			cfg.ShutdownTimeout = timeout
+		}
+	}
+
+	if len(problems) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return cfg, nil
+}
+
+// Addr is the listen address. Binding to all interfaces (no host part)
+// matters in a container: "localhost:8080" would only accept connections
+// from inside the container itself.
+func (c Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
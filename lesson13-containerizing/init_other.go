@@ -0,0 +1,14 @@
+//go:build !unix
+
+package lesson13
+
+// Containers built from this lesson run Linux, so the init process is only
+// needed there. On other platforms the server always runs directly.
+
+func shouldRunInit() bool {
+	return false
+}
+
+func runInit() int {
+	return 0
+}
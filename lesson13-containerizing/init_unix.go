@@ -0,0 +1,79 @@
+//go:build unix
+
+package lesson13
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// childEnv marks the re-executed server process so it doesn't try to become
+// init again
+const childEnv = "LESSON13_INIT_CHILD"
+
+// shouldRunInit reports whether this process is PID 1 in its PID namespace,
+// which is the case for a container's ENTRYPOINT
+func shouldRunInit() bool {
+	return os.Getpid() == 1 && os.Getenv(childEnv) == "" && os.Getenv("DISABLE_INIT") == ""
+}
+
+// runInit is a tiny init process. PID 1 is special on Linux:
+//   - the kernel doesn't apply default signal actions to it, so an unhandled
+//     SIGTERM from `docker stop` is silently ignored (and the container is
+//     SIGKILLed after the grace period)
+//   - orphaned processes are re-parented to it, and it must wait() on them or
+//     they stay around as zombies
+//
+// runInit starts the real server as a child, forwards every signal to it,
+// reaps any zombie, and exits with the child's exit code. Tools like tini
+// and dumb-init do exactly this.
+func runInit() int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "init: cannot find executable: %v\n", err)
+		return 1
+	}
+
+	// Subscribe before starting the child so no signal is missed
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "init: cannot start server: %v\n", err)
+		return 1
+	}
+	childPID := cmd.Process.Pid
+
+	for sig := range signals {
+		if sig != syscall.SIGCHLD {
+			// Forward everything else (SIGTERM, SIGINT, SIGHUP, ...)
+			cmd.Process.Signal(sig)
+			continue
+		}
+
+		// Reap every child that has exited. We call Wait4 ourselves instead
+		// of cmd.Wait so zombies that aren't our direct child get reaped too.
+		for {
+			var status syscall.WaitStatus
+			pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+			if pid <= 0 || err != nil {
+				break
+			}
+			if pid == childPID {
+				if status.Signaled() {
+					return 128 + int(status.Signal())
+				}
+				return status.ExitStatus()
+			}
+		}
+	}
+	return 0
+}
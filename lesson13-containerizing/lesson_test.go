@@ -0,0 +1,55 @@
+package lesson13
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-lab/lab/golden"
+)
+
+// TestRequests sends a few requests through the logging middleware and
+// compares the responses and the log lines with testdata/requests.golden.
+// /api/info is left out: it reports the machine it runs on.
+func TestRequests(t *testing.T) {
+	var logs bytes.Buffer
+	logger := newLogger(&logs, Config{LogLevel: slog.LevelDebug, LogFormat: "text", Version: "test", Environment: "test"})
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+	handler := loggingMiddleware(logger, newMux(Config{}, time.Now()))
+
+	var transcript strings.Builder
+	for _, target := range []string{"/healthz", "/api/hello", "/api/hello?name=Gopher", "/missing"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		fmt.Fprintf(&transcript, "GET %s\n%d %s\n%s\n", target,
+			rec.Code, rec.Header().Get("Content-Type"), strings.TrimSpace(rec.Body.String()))
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			fmt.Fprintf(&transcript, "  log: %s\n", line)
+		}
+		transcript.WriteString("\n")
+		logs.Reset()
+	}
+	// log times and durations change on every run
+	golden.Check(t, "requests.golden", transcript.String(),
+		golden.Replace(`time=\S+ `, ""),
+		golden.Replace(`duration_ms=\d+`, "duration_ms=<ms>"))
+}
+
+// TestConfigErrors checks that every bad setting is reported at once
+func TestConfigErrors(t *testing.T) {
+	t.Setenv("PORT", "http")
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("LOG_FORMAT", "xml")
+	t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("loadConfig accepted invalid settings")
+	}
+	golden.Check(t, "config_errors.golden", err.Error()+"\n")
+}
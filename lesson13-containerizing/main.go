@@ -0,0 +1,220 @@
+// Lesson 13: Containerizing the Go API
+// This lesson covers the Go-side changes a service needs to run well in a
+// container: env-only config, $PORT, structured logs, health checks, and
+// correct signal handling as PID 1
+
+package lesson13
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Run is the lesson's entry point; cmd/lesson13 calls it
+func Run() {
+	// As PID 1 we hand off to the tiny init, which re-runs this binary as
+	// its child (see init_unix.go)
+	if shouldRunInit() {
+		os.Exit(runInit())
+	}
+
+	// `app healthcheck` lets a distroless image (no curl, no shell) probe
+	// itself: HEALTHCHECK CMD ["/app", "healthcheck"]
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck())
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	logger := newLogger(os.Stdout, cfg)
+	slog.SetDefault(logger)
+
+	if err := run(cfg, logger); err != nil {
+		logger.Error("server stopped with error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// newLogger writes structured logs to w, which is stdout outside of tests.
+// Containers should not manage log files: the runtime collects stdout and
+// ships it wherever it belongs. JSON is easy for log collectors to parse;
+// text is easier to read locally.
+func newLogger(w io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+
+	var handler slog.Handler
+	if cfg.LogFormat == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	// Attributes added here appear on every log line
+	return slog.New(handler).With("service", "lesson13", "version", cfg.Version, "env", cfg.Environment)
+}
+
+func run(cfg Config, logger *slog.Logger) error {
+	server := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           loggingMiddleware(logger, newMux(cfg, time.Now())),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	// `docker stop` sends SIGTERM, Ctrl+C sends SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server starting", "addr", cfg.Addr(), "pid", os.Getpid())
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+		logger.Info("shutdown signal received", "timeout", cfg.ShutdownTimeout.String())
+	}
+
+	// Stop accepting new connections and give in-flight requests time to
+	// finish before the orchestrator sends SIGKILL
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown: %w", err)
+	}
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	logger.Info("server stopped cleanly")
+	return nil
+}
+
+func newMux(cfg Config, started time.Time) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/api/hello", handleHello)
+	mux.HandleFunc("/api/info", func(w http.ResponseWriter, r *http.Request) {
+		handleInfo(w, r, cfg, started)
+	})
+	return mux
+}
+
+// runHealthcheck requests /healthz on the local server and turns the answer
+// into an exit code for the container runtime
+func runHealthcheck() int {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/healthz", cfg.Port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: status %d\n", resp.StatusCode)
+		return 1
+	}
+	return 0
+}
+
+// GET /healthz - cheap liveness check; it must not depend on databases or
+// other services, or one slow dependency restarts every container
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /api/hello
+func handleHello(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "container"
+	}
+
+	// Handlers log through slog with key/value pairs instead of formatted
+	// strings, so each field is searchable on its own
+	slog.Debug("greeting", "name", name)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Hello, " + name + "!"})
+}
+
+// GET /api/info - shows what the container sees
+func handleInfo(w http.ResponseWriter, r *http.Request, cfg Config, started time.Time) {
+	hostname, _ := os.Hostname() // the container ID under Docker
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"hostname":    hostname,
+		"pid":         os.Getpid(),
+		"environment": cfg.Environment,
+		"version":     cfg.Version,
+		"go_version":  runtime.Version(),
+		"num_cpu":     runtime.NumCPU(),
+		"uptime":      time.Since(started).Round(time.Second).String(),
+	})
+}
+
+// statusRecorder remembers the status code so the access log can include it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// loggingMiddleware emits one structured access-log line per request
+func loggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		// Health checks run every few seconds; keep them out of info logs
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" {
+			level = slog.LevelDebug
+		}
+		logger.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("encoding JSON", "error", err)
+	}
+}
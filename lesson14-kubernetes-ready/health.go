@@ -0,0 +1,142 @@
+package lesson14
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckFunc reports whether one dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// Health tracks the two questions Kubernetes asks a pod:
+//   - liveness:  "should I restart you?"  - only if the process is stuck
+//   - readiness: "should I send you traffic?" - no while starting, shutting
+//     down, or while a dependency is unavailable
+type Health struct {
+	ready        atomic.Bool
+	shuttingDown atomic.Bool
+
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+
+	checkTimeout time.Duration
+}
+
+// CheckResult is one dependency's line in the /readyz response
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+func NewHealth(checkTimeout time.Duration) *Health {
+	return &Health{checks: make(map[string]CheckFunc), checkTimeout: checkTimeout}
+}
+
+// AddCheck registers a dependency probe for /readyz
+func (h *Health) AddCheck(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// SetReady marks startup as finished
+func (h *Health) SetReady() {
+	h.ready.Store(true)
+}
+
+// StartShutdown flips readiness off for good. It is the first step of
+// shutdown: the pod keeps serving while Kubernetes notices it is not ready
+// and removes it from the Service endpoints.
+func (h *Health) StartShutdown() bool {
+	return h.shuttingDown.CompareAndSwap(false, true)
+}
+
+func (h *Health) ShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// runChecks probes every dependency concurrently, each with its own timeout,
+// so one hung dependency can't make /readyz itself time out
+func (h *Health) runChecks(ctx context.Context) (map[string]CheckResult, bool) {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make(map[string]CheckFunc, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	results := make(map[string]CheckResult, len(names))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	healthy := true
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			result := CheckResult{Status: "ok", Duration: time.Since(start).Round(time.Microsecond).String()}
+			if err != nil {
+				result.Status = "failing"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = result
+			if err != nil {
+				healthy = false
+			}
+			mu.Unlock()
+		}(name, checks[name])
+	}
+	wg.Wait()
+
+	return results, healthy
+}
+
+// GET /livez - the process answers, so it is alive. Deliberately no
+// dependency checks: a database outage must not restart every pod.
+func (h *Health) handleLivez(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// GET /readyz - 200 only when started, not shutting down, and every
+// dependency check passes
+func (h *Health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{}
+	status := http.StatusOK
+
+	switch {
+	case h.shuttingDown.Load():
+		response["status"] = "shutting_down"
+		status = http.StatusServiceUnavailable
+	case !h.ready.Load():
+		response["status"] = "starting"
+		status = http.StatusServiceUnavailable
+	default:
+		results, healthy := h.runChecks(r.Context())
+		response["checks"] = results
+		response["status"] = "ready"
+		if !healthy {
+			response["status"] = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	respondWithJSON(w, status, response)
+}
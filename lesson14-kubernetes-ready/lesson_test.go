@@ -0,0 +1,55 @@
+package lesson14
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-lab/lab/golden"
+)
+
+// TestProbes walks a pod through startup, a database outage and shutdown,
+// and compares every response with testdata/probes.golden
+func TestProbes(t *testing.T) {
+	health = NewHealth(time.Second)
+	health.AddCheck("database", db.Ping)
+	handler := newMux()
+
+	var transcript strings.Builder
+	request := func(method, target, body string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		fmt.Fprintf(&transcript, "%s\n%d %s\n\n", strings.TrimSpace(method+" "+target+" "+body),
+			rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+
+	transcript.WriteString("# starting\n")
+	request("GET", "/livez", "")
+	request("GET", "/readyz", "")
+
+	transcript.WriteString("# warmed up\n")
+	health.SetReady()
+	request("GET", "/readyz", "")
+	request("POST", "/api/users", `{"name":"Alice","email":"alice@example.com","age":30}`)
+	request("POST", "/api/users", `{"name":"Bob"}`)
+	request("GET", "/api/users/1", "")
+	request("GET", "/api/users/2", "")
+
+	transcript.WriteString("# database outage\n")
+	request("POST", "/admin/dependency?healthy=false", "")
+	request("GET", "/readyz", "")
+	request("GET", "/livez", "")
+	request("POST", "/admin/dependency?healthy=true", "")
+	request("GET", "/readyz", "")
+
+	transcript.WriteString("# shutting down\n")
+	health.StartShutdown()
+	request("GET", "/readyz", "")
+	request("GET", "/livez", "")
+
+	// timestamps and check durations change on every run
+	golden.Check(t, "probes.golden", transcript.String(),
+		golden.Timestamps, golden.Replace(`"duration":"[^"]*"`, `"duration":"<duration>"`))
+}
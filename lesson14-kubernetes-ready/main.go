@@ -0,0 +1,305 @@
+// Lesson 14: Kubernetes-Ready Server Behavior
+// This lesson applies Kubernetes patterns to the lesson 10 user API:
+// liveness vs readiness, a readiness gate that flips before connection
+// draining, preStop-compatible delays, and downward-API configuration
+
+package lesson14
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang-lab/lab/fixtures"
+)
+
+// User represents a user in our system
+type User struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Age       int       `json:"age"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// fakeDatabase stands in for a real dependency whose health we can toggle
+// to watch /readyz react
+type fakeDatabase struct {
+	mu      sync.RWMutex
+	users   map[int]User
+	nextID  int
+	healthy atomic.Bool
+}
+
+func newFakeDatabase() *fakeDatabase {
+	db := &fakeDatabase{users: make(map[int]User), nextID: 1}
+	db.healthy.Store(true)
+	return db
+}
+
+// Ping is registered as a readiness check
+func (db *fakeDatabase) Ping(ctx context.Context) error {
+	if !db.healthy.Load() {
+		return errors.New("database unreachable")
+	}
+	select {
+	case <-time.After(5 * time.Millisecond): // simulated round trip
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Server timings, all overridable from the environment
+var (
+	shutdownDelay = envDuration("SHUTDOWN_DELAY", 5*time.Second)
+	drainTimeout  = envDuration("DRAIN_TIMEOUT", 20*time.Second)
+	startupDelay  = envDuration("STARTUP_DELAY", 2*time.Second)
+)
+
+var (
+	db     = newFakeDatabase()
+	health = NewHealth(time.Second)
+	pod    PodInfo
+)
+
+// Run is the lesson's entry point; cmd/lesson14 calls it
+func Run() {
+	fmt.Println("=== Lesson 14: Kubernetes-Ready Server Behavior ===")
+
+	pod = loadPodInfo()
+	fmt.Printf("Pod %s/%s on node %s (IP %s)\n", pod.Namespace, pod.Name, pod.NodeName, pod.IP)
+	for _, note := range applyResourceLimits(pod) {
+		fmt.Println("Runtime:", note)
+	}
+
+	health.AddCheck("database", db.Ping)
+
+	port := getEnv("PORT", "8080")
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           podHeaderMiddleware(newMux()),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Readiness stays false until warm-up finishes, so Kubernetes won't
+	// route traffic to a pod that can't serve it yet
+	go warmUp()
+
+	fmt.Printf("\nListening on :%s\n", port)
+	fmt.Println("Available endpoints:")
+	fmt.Println("  GET  /livez             - Liveness probe")
+	fmt.Println("  GET  /readyz            - Readiness probe with dependency checks")
+	fmt.Println("  GET  /prestop           - preStop hook (flips readiness, then waits)")
+	fmt.Println("  GET  /api/users         - Get all users")
+	fmt.Println("  POST /api/users         - Create new user")
+	fmt.Println("  GET  /api/users/{id}    - Get user by ID")
+	fmt.Println("  GET  /api/pod           - Downward API information")
+	fmt.Println("  POST /admin/dependency  - ?healthy=false simulates a database outage")
+	fmt.Println("\nPress Ctrl+C to watch the shutdown sequence")
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	shutdown(server, serverErr)
+}
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", health.handleLivez)
+	mux.HandleFunc("/readyz", health.handleReadyz)
+	mux.HandleFunc("/prestop", handlePreStop)
+	mux.HandleFunc("/api/users", handleUsers)
+	mux.HandleFunc("/api/users/", handleUser)
+	mux.HandleFunc("/api/pod", handlePod)
+	mux.HandleFunc("/admin/dependency", handleDependency)
+	return mux
+}
+
+func warmUp() {
+	log.Printf("Warming up for %v (readiness is false)", startupDelay)
+	time.Sleep(startupDelay)
+
+	db.mu.Lock()
+	for _, sample := range fixtures.Users(fixtures.Small) {
+		db.users[sample.ID] = User{ID: sample.ID, Name: sample.Name, Email: sample.Email, Age: sample.Age, CreatedAt: sample.CreatedAt}
+	}
+	db.nextID = fixtures.Small + 1
+	db.mu.Unlock()
+
+	health.SetReady()
+	log.Println("Warm-up complete, readiness is true")
+}
+
+// shutdown runs the three-step sequence that avoids dropped requests:
+//
+//  1. Fail readiness. Kubernetes sends SIGTERM and removes the pod from the
+//     Service endpoints at the same time, but kube-proxy and load balancers
+//     take a few seconds to notice. Requests keep arriving meanwhile.
+//  2. Wait shutdownDelay while still serving, until routing has caught up.
+//  3. server.Shutdown: stop accepting connections and drain in-flight ones.
+//
+// If a preStop hook already did steps 1 and 2, SIGTERM arrives afterwards
+// and we go straight to draining.
+func shutdown(server *http.Server, serverErr <-chan error) {
+	if health.StartShutdown() {
+		log.Printf("SIGTERM: readiness off, still serving for %v while endpoints update", shutdownDelay)
+		time.Sleep(shutdownDelay)
+	} else {
+		log.Println("SIGTERM: preStop hook already waited, draining now")
+	}
+
+	log.Printf("Draining connections (timeout %v)", drainTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Drain incomplete: %v", err)
+	}
+	if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server error: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+// GET /prestop - for a preStop httpGet hook. Kubernetes waits for this
+// request to return before sending SIGTERM, so it is a clean place to
+// flip readiness and sleep.
+func handlePreStop(w http.ResponseWriter, r *http.Request) {
+	if health.StartShutdown() {
+		log.Printf("preStop: readiness off, waiting %v", shutdownDelay)
+		time.Sleep(shutdownDelay)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ready for SIGTERM"})
+}
+
+// GET /api/pod
+func handlePod(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, pod)
+}
+
+// POST /admin/dependency?healthy=false|true
+func handleDependency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	healthy, err := strconv.ParseBool(r.URL.Query().Get("healthy"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "healthy must be true or false")
+		return
+	}
+	db.healthy.Store(healthy)
+	log.Printf("Database marked healthy=%t", healthy)
+	respondWithJSON(w, http.StatusOK, map[string]bool{"database_healthy": healthy})
+}
+
+// Handle multiple users (GET /api/users, POST /api/users)
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		db.mu.RLock()
+		users := make([]User, 0, len(db.users))
+		for _, user := range db.users {
+			users = append(users, user)
+		}
+		db.mu.RUnlock()
+		sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+		respondWithJSON(w, http.StatusOK, users)
+	case http.MethodPost:
+		var user User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		if strings.TrimSpace(user.Name) == "" || !strings.Contains(user.Email, "@") {
+			respondWithError(w, http.StatusBadRequest, "Name and a valid email are required")
+			return
+		}
+		db.mu.Lock()
+		user.ID = db.nextID
+		user.CreatedAt = time.Now()
+		db.users[user.ID] = user
+		db.nextID++
+		db.mu.Unlock()
+		respondWithJSON(w, http.StatusCreated, user)
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// GET /api/users/{id}
+func handleUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/users/"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	db.mu.RLock()
+	user, exists := db.users[id]
+	db.mu.RUnlock()
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// podHeaderMiddleware tags every response with the pod that served it, which
+// makes load balancing across replicas visible with curl -i
+func podHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", pod.Name)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Helper functions
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, map[string]string{"error": message})
+}
@@ -0,0 +1,71 @@
+package lesson14
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+)
+
+// PodInfo is what Kubernetes tells the pod about itself through the
+// downward API (see k8s/deployment.yaml for the env mappings)
+type PodInfo struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	IP          string `json:"ip"`
+	NodeName    string `json:"node_name"`
+	CPULimit    int    `json:"cpu_limit,omitempty"`    // whole cores
+	MemoryLimit int64  `json:"memory_limit,omitempty"` // bytes
+}
+
+// loadPodInfo reads the downward API variables. Outside a cluster they are
+// unset, so every field falls back to something sensible for local runs.
+func loadPodInfo() PodInfo {
+	hostname, _ := os.Hostname()
+	info := PodInfo{
+		Name:      getEnv("POD_NAME", hostname),
+		Namespace: getEnv("POD_NAMESPACE", "local"),
+		IP:        getEnv("POD_IP", "127.0.0.1"),
+		NodeName:  getEnv("NODE_NAME", hostname),
+	}
+
+	// resourceFieldRef exposes limits as plain numbers: CPU rounded up to
+	// whole cores (with divisor 1), memory in bytes
+	if cpu, err := strconv.Atoi(os.Getenv("CPU_LIMIT")); err == nil && cpu > 0 {
+		info.CPULimit = cpu
+	}
+	if mem, err := strconv.ParseInt(os.Getenv("MEMORY_LIMIT"), 10, 64); err == nil && mem > 0 {
+		info.MemoryLimit = mem
+	}
+	return info
+}
+
+// applyResourceLimits tunes the Go runtime to the container's limits.
+// GOMAXPROCS defaults to the node's CPU count, not the pod's quota, which
+// causes CPU throttling; the GC knows nothing about the memory limit and can
+// let the heap grow until the pod is OOM-killed.
+func applyResourceLimits(info PodInfo) []string {
+	var notes []string
+
+	if info.CPULimit > 0 && os.Getenv("GOMAXPROCS") == "" {
+		previous := runtime.GOMAXPROCS(info.CPULimit)
+		notes = append(notes, fmt.Sprintf("GOMAXPROCS %d -> %d (CPU limit)", previous, info.CPULimit))
+	}
+
+	if info.MemoryLimit > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		// Leave ~10% headroom for memory the Go GC doesn't manage
+		limit := info.MemoryLimit / 10 * 9
+		debug.SetMemoryLimit(limit)
+		notes = append(notes, fmt.Sprintf("GOMEMLIMIT set to %d bytes (90%% of memory limit)", limit))
+	}
+
+	return notes
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
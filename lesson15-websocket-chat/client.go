@@ -0,0 +1,156 @@
+package lesson15
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single write may take
+	writeWait = 10 * time.Second
+
+	// pongWait is how long we wait for any message (including a pong)
+	// before deciding the peer is gone
+	pongWait = 60 * time.Second
+
+	// pingPeriod must be shorter than pongWait so a healthy client always
+	// has a chance to answer before the read deadline expires
+	pingPeriod = pongWait * 9 / 10
+
+	// maxMessageSize limits incoming frames; chat lines are short
+	maxMessageSize = 4096
+
+	// sendBuffer is how many outgoing messages may queue per client
+	sendBuffer = 32
+)
+
+// Client is one WebSocket connection. gorilla/websocket allows one
+// concurrent reader and one concurrent writer, so each connection gets
+// exactly two goroutines: readPump and writePump.
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+	name string
+	room string
+}
+
+// readPump moves messages from the socket to the hub. It is the only
+// reader of conn, and it owns unregistering the client when the
+// connection ends for any reason.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	// Every pong pushes the deadline out again; a silent peer times out
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Read error from %s: %v", c.name, err)
+			}
+			return
+		}
+
+		var incoming struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(data, &incoming); err != nil {
+			// Plain text frames are fine too
+			incoming.Text = string(data)
+		}
+
+		text := strings.TrimSpace(incoming.Text)
+		if text == "" {
+			continue
+		}
+
+		c.hub.broadcast <- Message{
+			Type: "chat",
+			Room: c.room,
+			User: c.name,
+			Text: text,
+			Time: time.Now(),
+		}
+	}
+}
+
+// writePump moves messages from the send channel to the socket and sends
+// pings. It is the only writer of conn.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the channel: we were removed from the room
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := c.writeBatch(data); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeBatch writes one message plus anything else already queued as a
+// single frame of newline-separated JSON, saving a frame per message when
+// a room is busy
+func (c *Client) writeBatch(first []byte) error {
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	w.Write(first)
+
+	for queued := len(c.send); queued > 0; queued-- {
+		data, ok := <-c.send
+		if !ok {
+			break
+		}
+		w.Write([]byte{'\n'})
+		w.Write(data)
+	}
+
+	return w.Close()
+}
+
+// validName checks user and room names taken from the query string
+func validName(s string) error {
+	if s == "" || len(s) > 32 {
+		return errors.New("must be 1-32 characters")
+	}
+	for _, r := range s {
+		if !(r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return errors.New("may only contain letters, digits, '-' and '_'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package lesson15
+
+// history is a fixed-size ring buffer of recent messages. Once full, each
+// new message overwrites the oldest one, so memory per room stays constant
+// no matter how long the room lives.
+type history struct {
+	messages []Message
+	next     int  // index the next message is written to
+	full     bool // whether we have wrapped around at least once
+}
+
+func newHistory(size int) *history {
+	return &history{messages: make([]Message, size)}
+}
+
+func (h *history) Add(msg Message) {
+	h.messages[h.next] = msg
+	h.next = (h.next + 1) % len(h.messages)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Snapshot returns the stored messages, oldest first
+func (h *history) Snapshot() []Message {
+	if !h.full {
+		return append([]Message(nil), h.messages[:h.next]...)
+	}
+
+	snapshot := make([]Message, 0, len(h.messages))
+	snapshot = append(snapshot, h.messages[h.next:]...)
+	snapshot = append(snapshot, h.messages[:h.next]...)
+	return snapshot
+}
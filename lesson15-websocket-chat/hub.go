@@ -0,0 +1,184 @@
+package lesson15
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Message is the JSON sent over the socket in both directions
+type Message struct {
+	Type string    `json:"type"` // chat, join, leave, history
+	Room string    `json:"room"`
+	User string    `json:"user,omitempty"`
+	Text string    `json:"text,omitempty"`
+	Time time.Time `json:"time"`
+	// History is only set on "history" messages sent to a new member
+	History []Message `json:"history,omitempty"`
+}
+
+// RoomInfo is what /api/rooms reports about a room
+type RoomInfo struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// room is owned by the hub goroutine; nothing else touches it, so it
+// needs no mutex
+type room struct {
+	name    string
+	clients map[*Client]bool
+	history *history
+}
+
+// Hub keeps track of rooms and their members. All state changes go through
+// channels and are applied by the single Run goroutine, which is the
+// classic Go alternative to guarding shared maps with locks.
+type Hub struct {
+	rooms       map[string]*room
+	historySize int
+
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan Message
+	roomsQuery chan chan []RoomInfo
+}
+
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		rooms:       make(map[string]*room),
+		historySize: historySize,
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		broadcast:   make(chan Message, 64),
+		roomsQuery:  make(chan chan []RoomInfo),
+	}
+}
+
+func (h *Hub) Run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.join(client)
+		case client := <-h.unregister:
+			h.leave(client)
+		case msg := <-h.broadcast:
+			h.publish(msg)
+		case reply := <-h.roomsQuery:
+			reply <- h.roomInfo()
+		}
+	}
+}
+
+// Rooms asks the hub goroutine for a snapshot of rooms and members
+func (h *Hub) Rooms() []RoomInfo {
+	reply := make(chan []RoomInfo)
+	h.roomsQuery <- reply
+	return <-reply
+}
+
+func (h *Hub) join(client *Client) {
+	r, ok := h.rooms[client.room]
+	if !ok {
+		r = &room{
+			name:    client.room,
+			clients: make(map[*Client]bool),
+			history: newHistory(h.historySize),
+		}
+		h.rooms[client.room] = r
+		log.Printf("Room %q created", r.name)
+	}
+	r.clients[client] = true
+
+	// The newcomer gets the recent history first, then everyone (including
+	// them) sees the join
+	h.sendTo(client, Message{
+		Type:    "history",
+		Room:    r.name,
+		Time:    time.Now(),
+		History: r.history.Snapshot(),
+	})
+	h.publish(Message{
+		Type: "join",
+		Room: r.name,
+		User: client.name,
+		Text: fmt.Sprintf("%s joined (%d online)", client.name, len(r.clients)),
+		Time: time.Now(),
+	})
+}
+
+func (h *Hub) leave(client *Client) {
+	r, ok := h.rooms[client.room]
+	if !ok || !r.clients[client] {
+		return
+	}
+	delete(r.clients, client)
+	close(client.send) // tells the write pump to say goodbye and stop
+
+	if len(r.clients) == 0 {
+		delete(h.rooms, r.name)
+		log.Printf("Room %q closed", r.name)
+		return
+	}
+
+	h.publish(Message{
+		Type: "leave",
+		Room: r.name,
+		User: client.name,
+		Text: fmt.Sprintf("%s left (%d online)", client.name, len(r.clients)),
+		Time: time.Now(),
+	})
+}
+
+// publish records a message in the room's history and queues it for every
+// member
+func (h *Hub) publish(msg Message) {
+	r, ok := h.rooms[msg.Room]
+	if !ok {
+		return
+	}
+	r.history.Add(msg)
+
+	for client := range r.clients {
+		h.sendTo(client, msg)
+	}
+	if len(r.clients) == 0 { // every member was too slow and got dropped
+		delete(h.rooms, r.name)
+	}
+}
+
+// sendTo queues a message without blocking. A client whose buffer is full
+// isn't reading fast enough; it's disconnected rather than allowed to
+// stall the hub for everyone else.
+func (h *Hub) sendTo(client *Client, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding message: %v", err)
+		return
+	}
+
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("Dropping slow client %s", client.name)
+		r := h.rooms[client.room]
+		delete(r.clients, client)
+		close(client.send)
+	}
+}
+
+func (h *Hub) roomInfo() []RoomInfo {
+	infos := make([]RoomInfo, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		info := RoomInfo{Name: r.name, Members: []string{}}
+		for client := range r.clients {
+			info.Members = append(info.Members, client.name)
+		}
+		sort.Strings(info.Members)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
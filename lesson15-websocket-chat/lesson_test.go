@@ -0,0 +1,11 @@
+package lesson15
+
+import (
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+func TestDemonstrateHistory(t *testing.T) {
+	golden.Demo(t, "history.golden", demonstrateHistory)
+}
@@ -0,0 +1,172 @@
+// Lesson 15: WebSocket Chat
+// This lesson covers a real-time chat server: upgrading HTTP to WebSocket,
+// a hub goroutine that manages rooms, per-connection read and write pumps,
+// ping/pong keepalive, and a ring buffer of recent messages
+
+package lesson15
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrorResponse represents error response with details
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// indexHTML is compiled into the binary, so the server needs no files
+// next to it at runtime
+//
+//go:embed index.html
+var indexHTML []byte
+
+// upgrader turns an HTTP request into a WebSocket connection. The default
+// CheckOrigin rejects pages from other origins, which stops other sites
+// from opening sockets with a visitor's cookies.
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+var hub *Hub
+
+// Run is the lesson's entry point; cmd/lesson15 calls it
+func Run() {
+	fmt.Println("=== Lesson 15: WebSocket Chat ===")
+
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	historySize := flag.Int("history", 50, "messages of history kept per room")
+	flag.Parse()
+
+	demonstrateHistory(os.Stdout)
+
+	hub = NewHub(*historySize)
+	go hub.Run()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleIndex)
+	mux.HandleFunc("/ws", handleWebSocket)
+	mux.HandleFunc("/api/rooms", handleRooms)
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: loggingMiddleware(mux),
+	}
+
+	fmt.Printf("\nStarting chat server on http://localhost%s\n", *addr)
+	fmt.Println("Available endpoints:")
+	fmt.Println("  GET /                          - Chat page")
+	fmt.Println("  GET /ws?room={room}&name={name} - WebSocket endpoint")
+	fmt.Println("  GET /api/rooms                 - Rooms and their members")
+	fmt.Println("\nOpen the chat page in two browser tabs to try it")
+	fmt.Println("Press Ctrl+C to stop the server")
+
+	log.Fatal(server.ListenAndServe())
+}
+
+// demonstrateHistory shows the ring buffer keeping only the newest messages
+func demonstrateHistory(w io.Writer) {
+	fmt.Fprintln(w, "\n--- Message History Ring Buffer ---")
+
+	h := newHistory(3)
+	for i := 1; i <= 5; i++ {
+		h.Add(Message{Text: fmt.Sprintf("message %d", i)})
+
+		var texts []string
+		for _, msg := range h.Snapshot() {
+			texts = append(texts, msg.Text)
+		}
+		fmt.Fprintf(w, "After adding message %d: %v\n", i, texts)
+	}
+}
+
+// Handlers
+
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	if room == "" {
+		room = "lobby"
+	}
+	name := r.URL.Query().Get("name")
+
+	// Validate before upgrading: once upgraded we can no longer send an
+	// HTTP error response
+	if err := validName(room); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid room: "+err.Error())
+		return
+	}
+	if err := validName(name); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid name: "+err.Error())
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error
+		log.Printf("Upgrade failed: %v", err)
+		return
+	}
+
+	client := &Client{
+		hub:  hub,
+		conn: conn,
+		send: make(chan []byte, sendBuffer),
+		name: name,
+		room: room,
+	}
+	hub.register <- client
+
+	// The handler returns while the pumps keep the connection alive
+	go client.writePump()
+	go client.readPump()
+}
+
+func handleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, hub.Rooms())
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, ErrorResponse{Error: message})
+}
+
+// Middleware
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s in %v", r.Method, r.URL.Path, time.Since(start))
+	})
+}
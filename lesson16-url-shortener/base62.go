@@ -0,0 +1,90 @@
+package lesson16
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// base62Alphabet uses only characters that are safe in a URL path without
+// escaping: digits, then upper case, then lower case
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// codeLength is the length of generated short codes. 62^7 is about 3.5
+// trillion codes, so random collisions are rare but still possible.
+const codeLength = 7
+
+var errInvalidBase62 = errors.New("invalid base62 string")
+
+// encodeBase62 converts n to base 62, most significant digit first
+func encodeBase62(n uint64) string {
+	if n == 0 {
+		return string(base62Alphabet[0])
+	}
+
+	var digits []byte
+	for n > 0 {
+		digits = append(digits, base62Alphabet[n%62])
+		n /= 62
+	}
+
+	// Digits were produced least significant first; reverse them
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+// decodeBase62 is the inverse of encodeBase62
+func decodeBase62(s string) (uint64, error) {
+	if s == "" {
+		return 0, errInvalidBase62
+	}
+
+	var n uint64
+	for _, c := range s {
+		index := strings.IndexRune(base62Alphabet, c)
+		if index < 0 {
+			return 0, errInvalidBase62
+		}
+		next := n*62 + uint64(index)
+		if next/62 != n { // overflowed uint64
+			return 0, errInvalidBase62
+		}
+		n = next
+	}
+	return n, nil
+}
+
+// randomCode returns a random codeLength-character base62 code. Random
+// codes can't be guessed by counting up from a known one, unlike encoding
+// a sequential ID.
+func randomCode() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+
+	code := encodeBase62(binary.BigEndian.Uint64(buf[:]))
+
+	// Pad or trim to a fixed length so every generated code looks the same
+	if len(code) < codeLength {
+		code = strings.Repeat(string(base62Alphabet[0]), codeLength-len(code)) + code
+	}
+	return code[len(code)-codeLength:], nil
+}
+
+// validCode reports whether s can be used as a short code (generated or a
+// user-chosen alias)
+func validCode(s string) bool {
+	if len(s) < 3 || len(s) > 32 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune(base62Alphabet, c) && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package lesson16
+
+import (
+	"sync"
+	"time"
+)
+
+// hitCounter takes hit counting off the redirect path. Handlers drop the
+// code into a buffered channel and return; one goroutine totals hits and
+// flushes them to the store in batches, so a popular link doesn't make
+// every redirect fight over the store's write lock.
+type hitCounter struct {
+	store    *linkStore
+	hits     chan string
+	interval time.Duration
+	wg       sync.WaitGroup
+}
+
+func newHitCounter(store *linkStore, buffer int, interval time.Duration) *hitCounter {
+	c := &hitCounter{
+		store:    store,
+		hits:     make(chan string, buffer),
+		interval: interval,
+	}
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+// Record counts a hit without blocking. If the buffer is full the hit is
+// dropped: a slightly low counter is better than a slow redirect.
+func (c *hitCounter) Record(code string) bool {
+	select {
+	case c.hits <- code:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting hits and waits for pending ones to be flushed
+func (c *hitCounter) Close() {
+	close(c.hits)
+	c.wg.Wait()
+}
+
+func (c *hitCounter) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	pending := make(map[string]int64)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		c.store.RecordHits(pending, time.Now())
+		pending = make(map[string]int64)
+	}
+
+	for {
+		select {
+		case code, ok := <-c.hits:
+			if !ok {
+				flush()
+				return
+			}
+			pending[code]++
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
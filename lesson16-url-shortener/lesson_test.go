@@ -0,0 +1,324 @@
+package lesson16
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang-lab/lab/golden"
+)
+
+func TestDemonstrations(t *testing.T) {
+	golden.Demo(t, "demo.golden", func(w io.Writer) {
+		demonstrateBase62(w)
+		demonstrateCollisions(w)
+	}, golden.Replace(`(?m)^(Random \d+-character code: )\w+$`, "${1}<code>")) // random on every run
+}
+
+// newTestServer gives the handlers a fresh store and a hit counter that
+// only flushes when it's closed, and returns the mux
+func newTestServer() http.Handler {
+	store = newLinkStore()
+	hits = newHitCounter(store, 16, time.Hour)
+	baseURL = "http://sho.rt"
+	adminToken = "test-token"
+	return newMux()
+}
+
+// TestAPI sends a fixed script of requests to the shortener and compares
+// the responses with testdata/api.golden. Links use aliases so their
+// codes are predictable.
+func TestAPI(t *testing.T) {
+	handler := newTestServer()
+	defer hits.Close()
+
+	requests := []struct{ method, target, token, body string }{
+		{"POST", "/api/links", "", `{"url":"https://go.dev/tour","alias":"tour"}`},
+		{"POST", "/api/links", "", `{"url":"https://go.dev","alias":"tour"}`},
+		{"POST", "/api/links", "", `{"url":"ftp://example.com"}`},
+		{"GET", "/tour", "", ""},
+		{"GET", "/nope", "", ""},
+		{"GET", "/api/admin/links/tour", "", ""},
+		{"GET", "/api/admin/links/tour", "wrong", ""},
+		{"DELETE", "/api/admin/links/tour", "test-token", ""},
+		{"GET", "/tour", "", ""},
+	}
+
+	var transcript strings.Builder
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+		if req.token != "" {
+			r.Header.Set("X-Admin-Token", req.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		fmt.Fprintf(&transcript, "%s\n%d", strings.TrimSpace(req.method+" "+req.target+" "+req.body), rec.Code)
+		if location := rec.Header().Get("Location"); location != "" {
+			fmt.Fprintf(&transcript, " Location: %s", location)
+		}
+		fmt.Fprintf(&transcript, "\n%s\n\n", strings.TrimSpace(rec.Body.String()))
+	}
+	golden.Check(t, "api.golden", transcript.String(), golden.Timestamps)
+}
+
+func TestBase62(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		code string
+	}{
+		{0, "0"},
+		{9, "9"},
+		{10, "A"},
+		{61, "z"},
+		{62, "10"},
+		{3843, "zz"},
+		{3844, "100"},
+		{1_000_000, "4C92"},
+		{math.MaxUint64, "LygHa16AHYF"},
+	}
+	for _, tt := range tests {
+		if got := encodeBase62(tt.n); got != tt.code {
+			t.Errorf("encodeBase62(%d) = %q, want %q", tt.n, got, tt.code)
+		}
+		if got, err := decodeBase62(tt.code); got != tt.n || err != nil {
+			t.Errorf("decodeBase62(%q) = %d, %v; want %d", tt.code, got, err, tt.n)
+		}
+	}
+
+	for _, code := range []string{
+		"",
+		"abc-def",      // '-' is fine in an alias but isn't a base62 digit
+		"héllo",        // not ASCII
+		"LygHa16AHYG",  // one more than the largest uint64
+		"zzzzzzzzzzzz", // far past it
+	} {
+		if n, err := decodeBase62(code); !errors.Is(err, errInvalidBase62) {
+			t.Errorf("decodeBase62(%q) = %d, %v; want errInvalidBase62", code, n, err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		code, err := randomCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != codeLength || !validCode(code) {
+			t.Fatalf("randomCode() = %q, want %d base62 characters", code, codeLength)
+		}
+	}
+}
+
+func TestLinkStoreConcurrentCreate(t *testing.T) {
+	s := newLinkStore()
+	now := time.Now()
+
+	const n = 100
+	codes := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			link, err := s.Create(fmt.Sprintf("https://go.dev/%d", i), "", 0, now)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			codes[i] = link.Code
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("code %s was given out twice", code)
+		}
+		seen[code] = true
+		if link, err := s.Resolve(code, now); err != nil || link.URL != fmt.Sprintf("https://go.dev/%d", i) {
+			t.Errorf("Resolve(%s) = %+v, %v", code, link, err)
+		}
+	}
+	if got := len(s.List()); got != n {
+		t.Errorf("List has %d links, want %d", got, n)
+	}
+
+	// Of many requests for one alias, exactly one gets it
+	var taken sync.WaitGroup
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		taken.Add(1)
+		go func() {
+			defer taken.Done()
+			_, err := s.Create("https://go.dev/play", "play", 0, now)
+			results <- err
+		}()
+	}
+	taken.Wait()
+	close(results)
+	wins := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			wins++
+		case !errors.Is(err, ErrCodeTaken):
+			t.Errorf("Create with a taken alias: %v, want ErrCodeTaken", err)
+		}
+	}
+	if wins != 1 {
+		t.Errorf("%d requests got the alias, want 1", wins)
+	}
+}
+
+func TestLinkStoreExpiry(t *testing.T) {
+	s := newLinkStore()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := s.Create("https://go.dev/blog", "blog", time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create("https://go.dev/doc", "doc", 0, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		code    string
+		after   time.Duration
+		wantErr error
+	}{
+		{"blog", 0, nil},
+		{"blog", 59 * time.Minute, nil},
+		{"blog", time.Hour, ErrLinkExpired}, // expires at, not after, its time
+		{"blog", 48 * time.Hour, ErrLinkExpired},
+		{"doc", 10 * 365 * 24 * time.Hour, nil}, // no TTL, never expires
+		{"gone", 0, ErrLinkNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.Resolve(tt.code, now.Add(tt.after)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Resolve(%s) %v later: %v, want %v", tt.code, tt.after, err, tt.wantErr)
+		}
+	}
+
+	// The admin API still sees an expired link, and its alias is free again
+	later := now.Add(2 * time.Hour)
+	if _, err := s.Get("blog"); err != nil {
+		t.Errorf("Get of an expired link: %v", err)
+	}
+	if _, err := s.Create("https://go.dev/blog/v2", "doc", 0, later); !errors.Is(err, ErrCodeTaken) {
+		t.Errorf("reusing a live alias: %v, want ErrCodeTaken", err)
+	}
+	link, err := s.Create("https://go.dev/blog/v2", "blog", 0, later)
+	if err != nil || link.URL != "https://go.dev/blog/v2" {
+		t.Fatalf("reusing an expired alias: %+v, %v", link, err)
+	}
+
+	if _, err := s.Create("https://go.dev/wiki", "wiki", time.Minute, later); err != nil {
+		t.Fatal(err)
+	}
+	if removed := s.PurgeExpired(later.Add(time.Minute)); removed != 1 {
+		t.Errorf("PurgeExpired removed %d links, want 1", removed)
+	}
+	if _, err := s.Get("wiki"); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("Get after purging: %v, want ErrLinkNotFound", err)
+	}
+}
+
+func TestRedirectCountsHits(t *testing.T) {
+	handler := newTestServer()
+	now := time.Now()
+	if _, err := store.Create("https://go.dev/tour", "tour", 0, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("https://go.dev/blog", "blog", time.Nanosecond, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, target string
+		wantCode       int
+		wantLocation   string
+	}{
+		{"GET", "/tour", http.StatusFound, "https://go.dev/tour"},
+		{"HEAD", "/tour", http.StatusFound, "https://go.dev/tour"},
+		{"GET", "/tour", http.StatusFound, "https://go.dev/tour"},
+		{"POST", "/tour", http.StatusMethodNotAllowed, ""},
+		{"GET", "/blog", http.StatusGone, ""},
+		{"GET", "/nope", http.StatusNotFound, ""},
+		{"GET", "/x!", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.wantCode || rec.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("%s %s: %d Location %q, want %d %q", tt.method, tt.target,
+				rec.Code, rec.Header().Get("Location"), tt.wantCode, tt.wantLocation)
+		}
+		if tt.wantCode == http.StatusFound && rec.Header().Get("Cache-Control") != "private, max-age=0" {
+			t.Errorf("%s %s: Cache-Control %q; browsers would cache the redirect", tt.method, tt.target, rec.Header().Get("Cache-Control"))
+		}
+	}
+
+	// Closing the counter flushes the hits it's holding
+	hits.Close()
+	link, err := store.Get("tour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Hits != 3 || link.LastHitAt == nil {
+		t.Errorf("tour has %d hits, last at %v; want 3 and a time", link.Hits, link.LastHitAt)
+	}
+	if link, _ := store.Get("blog"); link.Hits != 0 {
+		t.Errorf("the expired link counted %d hits", link.Hits)
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	handler := newTestServer()
+	defer hits.Close()
+	if _, err := store.Create("https://go.dev/tour", "tour", 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, method, target, token string
+		wantCode                    int
+		wantError                   string
+	}{
+		{"no token", "GET", "/api/admin/links", "", http.StatusUnauthorized, "Admin token required"},
+		{"wrong token", "GET", "/api/admin/links", "test-tokeN", http.StatusUnauthorized, "Admin token required"},
+		{"prefix of the token", "POST", "/api/admin/purge", "test", http.StatusUnauthorized, "Admin token required"},
+		{"list with POST", "POST", "/api/admin/links", "test-token", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"purge with GET", "GET", "/api/admin/purge", "test-token", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"link with PUT", "PUT", "/api/admin/links/tour", "test-token", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"code too short", "GET", "/api/admin/links/ab", "test-token", http.StatusBadRequest, "Invalid short code"},
+		{"no code", "DELETE", "/api/admin/links/", "test-token", http.StatusBadRequest, "Invalid short code"},
+		{"unknown code", "GET", "/api/admin/links/nope", "test-token", http.StatusNotFound, "Link not found"},
+		{"delete unknown", "DELETE", "/api/admin/links/nope", "test-token", http.StatusNotFound, "Link not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.token != "" {
+				r.Header.Set("X-Admin-Token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			want := fmt.Sprintf(`{"error":%q}`, tt.wantError)
+			if rec.Code != tt.wantCode || strings.TrimSpace(rec.Body.String()) != want {
+				t.Errorf("got %d %s, want %d %s", rec.Code, strings.TrimSpace(rec.Body.String()), tt.wantCode, want)
+			}
+		})
+	}
+
+	// None of them touched the link
+	if _, err := store.Get("tour"); err != nil {
+		t.Errorf("tour after the failed requests: %v", err)
+	}
+}
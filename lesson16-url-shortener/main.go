@@ -0,0 +1,426 @@
+// Lesson 16: Mini-Project - URL Shortener
+// This lesson combines storage, HTTP, and concurrency: base62 short codes,
+// collision handling, redirects with hit counting, expiring links, and an
+// admin API
+
+package lesson16
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CreateLinkRequest represents the request payload for shortening a URL
+type CreateLinkRequest struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	TTL   string `json:"ttl,omitempty"` // Go duration, e.g. "24h"
+}
+
+// CreateLinkResponse is returned after a link is created
+type CreateLinkResponse struct {
+	Link
+	ShortURL string `json:"short_url"`
+}
+
+// APIResponse represents a standard API response
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ValidationError represents validation errors
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse represents error response with details
+type ErrorResponse struct {
+	Error   string            `json:"error"`
+	Details []ValidationError `json:"details,omitempty"`
+}
+
+// maxTTL caps how long a link may live when a TTL is given
+const maxTTL = 365 * 24 * time.Hour
+
+var (
+	store   *linkStore
+	hits    *hitCounter
+	baseURL string
+	// adminToken guards /api/admin/; set ADMIN_TOKEN to override
+	adminToken string
+)
+
+// Run is the lesson's entry point; cmd/lesson16 calls it
+func Run() {
+	fmt.Println("=== Lesson 16: Mini-Project - URL Shortener ===")
+
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	flag.StringVar(&baseURL, "base-url", "http://localhost:8080", "public URL that short codes are appended to")
+	flag.Parse()
+
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		adminToken = "admin-secret"
+		fmt.Println("ADMIN_TOKEN not set, using the demo token \"admin-secret\"")
+	}
+
+	demonstrateBase62(os.Stdout)
+	demonstrateCollisions(os.Stdout)
+
+	store = newLinkStore()
+	hits = newHitCounter(store, 1024, 500*time.Millisecond)
+	seedLinks()
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: loggingMiddleware(newMux()),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		fmt.Printf("\nStarting URL shortener on http://localhost%s\n", *addr)
+		fmt.Println("Available endpoints:")
+		fmt.Println("  POST   /api/links              - Shorten a URL")
+		fmt.Println("  GET    /{code}                 - Redirect to the target URL")
+		fmt.Println("  GET    /api/admin/links        - List links with hit counts")
+		fmt.Println("  GET    /api/admin/links/{code} - Get one link")
+		fmt.Println("  DELETE /api/admin/links/{code} - Delete a link")
+		fmt.Println("  POST   /api/admin/purge        - Remove expired links")
+		fmt.Println("\nPress Ctrl+C to stop the server")
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	fmt.Println("\nShutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown error: %v", err)
+	}
+
+	// Only close the hit channel once no handler can send on it
+	hits.Close()
+	fmt.Println("Pending hits flushed, bye")
+}
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/links", handleCreateLink)
+	mux.HandleFunc("/api/admin/links", requireAdmin(handleAdminLinks))
+	mux.HandleFunc("/api/admin/links/", requireAdmin(handleAdminLink))
+	mux.HandleFunc("/api/admin/purge", requireAdmin(handleAdminPurge))
+	mux.HandleFunc("/", handleRedirect)
+	return mux
+}
+
+func demonstrateBase62(w io.Writer) {
+	fmt.Fprintln(w, "\n--- Base62 Encoding ---")
+
+	for _, n := range []uint64{0, 61, 62, 3843, 3844, 1_000_000, 56_800_235_583} {
+		encoded := encodeBase62(n)
+		decoded, _ := decodeBase62(encoded)
+		fmt.Fprintf(w, "%14d -> %-8s -> %d\n", n, encoded, decoded)
+	}
+
+	code, err := randomCode()
+	if err != nil {
+		log.Fatalf("Failed to generate code: %v", err)
+	}
+	fmt.Fprintf(w, "Random %d-character code: %s\n", codeLength, code)
+}
+
+// demonstrateCollisions forces the code generator to repeat itself so the
+// retry loop in linkStore.Create is visible
+func demonstrateCollisions(w io.Writer) {
+	fmt.Fprintln(w, "\n--- Collision Handling ---")
+
+	codes := []string{"aaaaaaa", "aaaaaaa", "aaaaaaa", "bbbbbbb"}
+	next := 0
+	newRandomCodeFor = func() (string, error) {
+		code := codes[next%len(codes)]
+		next++
+		return code, nil
+	}
+	defer func() { newRandomCodeFor = randomCode }()
+
+	demo := newLinkStore()
+	demo.out = w
+	now := time.Now()
+	first, _ := demo.Create("https://go.dev", "", 0, now)
+	fmt.Fprintf(w, "First link got code %s\n", first.Code)
+	second, _ := demo.Create("https://pkg.go.dev", "", 0, now)
+	fmt.Fprintf(w, "Second link got code %s after retries\n", second.Code)
+
+	if _, err := demo.Create("https://go.dev/blog", "", 0, now); err != nil {
+		fmt.Fprintf(w, "Third link: %v\n", err)
+	}
+}
+
+func seedLinks() {
+	now := time.Now()
+	seeds := []struct {
+		url, alias string
+		ttl        time.Duration
+	}{
+		{"https://go.dev/tour", "tour", 0},
+		{"https://pkg.go.dev/net/http", "nethttp", 0},
+		{"https://go.dev/blog", "", time.Minute},
+	}
+
+	for _, seed := range seeds {
+		link, err := store.Create(seed.url, seed.alias, seed.ttl, now)
+		if err != nil {
+			log.Fatalf("Failed to seed %s: %v", seed.url, err)
+		}
+		fmt.Printf("Seeded %s/%s -> %s\n", baseURL, link.Code, link.URL)
+	}
+}
+
+// Handlers
+
+func handleCreateLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req CreateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	ttl, errs := validateCreateLinkRequest(req)
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	link, err := store.Create(req.URL, req.Alias, ttl, time.Now())
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Link created",
+		Data:    CreateLinkResponse{Link: link, ShortURL: baseURL + "/" + link.Code},
+	})
+}
+
+// handleRedirect serves GET /{code}. Hit counting is handed to the
+// background hitCounter so the redirect returns immediately.
+func handleRedirect(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/")
+	if code == "" {
+		respondWithJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "POST a URL to /api/links to shorten it",
+		})
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !validCode(code) {
+		respondWithError(w, http.StatusNotFound, "Link not found")
+		return
+	}
+
+	link, err := store.Resolve(code, time.Now())
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	if !hits.Record(link.Code) {
+		log.Printf("Hit buffer full, dropped hit for %s", link.Code)
+	}
+
+	// 302 rather than 301: browsers cache permanent redirects and would
+	// stop coming back, so hits and expiry would go unnoticed
+	w.Header().Set("Cache-Control", "private, max-age=0")
+	http.Redirect(w, r, link.URL, http.StatusFound)
+}
+
+func handleAdminLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	links := store.List()
+	respondWithJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    links,
+		Message: fmt.Sprintf("Found %d links", len(links)),
+	})
+}
+
+func handleAdminLink(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/admin/links/")
+	if !validCode(code) {
+		respondWithError(w, http.StatusBadRequest, "Invalid short code")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		link, err := store.Get(code)
+		if err != nil {
+			respondWithStoreError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Data:    link,
+		})
+	case http.MethodDelete:
+		if err := store.Delete(code); err != nil {
+			respondWithStoreError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Link deleted",
+		})
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	removed := store.PurgeExpired(time.Now())
+	respondWithJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Removed %d expired links", removed),
+	})
+}
+
+// Helper functions
+
+func validateCreateLinkRequest(req CreateLinkRequest) (time.Duration, []ValidationError) {
+	var errors []ValidationError
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		errors = append(errors, ValidationError{
+			Field:   "url",
+			Message: "URL must be an absolute http or https URL",
+		})
+	} else if strings.HasPrefix(req.URL, baseURL+"/") {
+		errors = append(errors, ValidationError{
+			Field:   "url",
+			Message: "URL is already a short link",
+		})
+	}
+
+	if req.Alias != "" && (!validCode(req.Alias) || strings.HasPrefix(req.Alias, "api")) {
+		errors = append(errors, ValidationError{
+			Field:   "alias",
+			Message: "Alias must be 3-32 letters, digits, '-' or '_' and not start with 'api'",
+		})
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > maxTTL {
+			errors = append(errors, ValidationError{
+				Field:   "ttl",
+				Message: "TTL must be a positive duration up to 8760h, e.g. \"24h\"",
+			})
+		}
+	}
+
+	return ttl, errors
+}
+
+// respondWithStoreError maps store errors onto HTTP status codes
+func respondWithStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrLinkNotFound):
+		respondWithError(w, http.StatusNotFound, "Link not found")
+	case errors.Is(err, ErrLinkExpired):
+		respondWithError(w, http.StatusGone, "Link expired")
+	case errors.Is(err, ErrCodeTaken):
+		respondWithError(w, http.StatusConflict, "Alias already in use")
+	default:
+		log.Printf("Store error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, ErrorResponse{Error: message})
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, errors []ValidationError) {
+	respondWithJSON(w, http.StatusBadRequest, ErrorResponse{
+		Error:   "Validation failed",
+		Details: errors,
+	})
+}
+
+// Middleware
+
+// requireAdmin checks the X-Admin-Token header. ConstantTimeCompare avoids
+// leaking how many leading characters of a guess were right.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			respondWithError(w, http.StatusUnauthorized, "Admin token required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s in %v", r.Method, r.URL.Path, time.Since(start))
+	})
+}
@@ -0,0 +1,178 @@
+package lesson16
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Link is one short code and where it points
+type Link struct {
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Hits      int64      `json:"hits"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
+}
+
+// Expired reports whether the link has an expiry time in the past
+func (l Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// Errors returned by linkStore
+var (
+	ErrLinkNotFound = errors.New("link not found")
+	ErrLinkExpired  = errors.New("link expired")
+	ErrCodeTaken    = errors.New("short code already in use")
+	ErrNoFreeCode   = errors.New("could not find a free short code")
+)
+
+// maxCodeAttempts bounds the retries when a generated code is taken
+const maxCodeAttempts = 5
+
+// newRandomCodeFor generates codes for Create; demonstrateCollisions swaps
+// it for a predictable generator
+var newRandomCodeFor = randomCode
+
+// linkStore keeps links in memory behind a RWMutex: redirects (reads)
+// vastly outnumber creations (writes), so readers shouldn't block each other
+type linkStore struct {
+	mu    sync.RWMutex
+	links map[string]*Link
+	out   io.Writer // where collisions are reported
+}
+
+func newLinkStore() *linkStore {
+	return &linkStore{links: make(map[string]*Link), out: os.Stdout}
+}
+
+// Create stores a new link. With an alias the caller picks the code and a
+// clash is an error; without one we generate random codes and retry on
+// collision.
+func (s *linkStore) Create(url, alias string, ttl time.Duration, now time.Time) (Link, error) {
+	link := &Link{URL: url, CreatedAt: now}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		link.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if alias != "" {
+		if existing, ok := s.links[alias]; ok && !existing.Expired(now) {
+			return Link{}, ErrCodeTaken
+		}
+		link.Code = alias
+		s.links[alias] = link
+		return *link, nil
+	}
+
+	// Checking and inserting under the same lock means two concurrent
+	// requests can't both claim a code that looked free
+	for attempt := 1; attempt <= maxCodeAttempts; attempt++ {
+		code, err := newRandomCodeFor()
+		if err != nil {
+			return Link{}, err
+		}
+		if existing, ok := s.links[code]; ok && !existing.Expired(now) {
+			fmt.Fprintf(s.out, "Collision on code %s (attempt %d), retrying\n", code, attempt)
+			continue
+		}
+		link.Code = code
+		s.links[code] = link
+		return *link, nil
+	}
+	return Link{}, ErrNoFreeCode
+}
+
+// Resolve returns the target of a code, treating expired links as gone
+func (s *linkStore) Resolve(code string, now time.Time) (Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.links[code]
+	if !ok {
+		return Link{}, ErrLinkNotFound
+	}
+	if link.Expired(now) {
+		return Link{}, ErrLinkExpired
+	}
+	return *link, nil
+}
+
+// RecordHits adds a batch of counted hits (see hitCounter)
+func (s *linkStore) RecordHits(counts map[string]int64, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for code, n := range counts {
+		if link, ok := s.links[code]; ok {
+			link.Hits += n
+			hitAt := at
+			link.LastHitAt = &hitAt
+		}
+	}
+}
+
+// Get returns a link including expired ones, for the admin API
+func (s *linkStore) Get(code string) (Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.links[code]
+	if !ok {
+		return Link{}, ErrLinkNotFound
+	}
+	return *link, nil
+}
+
+// List returns every link, most hits first
+func (s *linkStore) List() []Link {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Link, 0, len(s.links))
+	for _, link := range s.links {
+		list = append(list, *link)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Hits != list[j].Hits {
+			return list[i].Hits > list[j].Hits
+		}
+		return list[i].Code < list[j].Code
+	})
+	return list
+}
+
+func (s *linkStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[code]; !ok {
+		return ErrLinkNotFound
+	}
+	delete(s.links, code)
+	return nil
+}
+
+// PurgeExpired deletes expired links and reports how many were removed
+func (s *linkStore) PurgeExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for code, link := range s.links {
+		if link.Expired(now) {
+			delete(s.links, code)
+			removed++
+		}
+	}
+	return removed
+}
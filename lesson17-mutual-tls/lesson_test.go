@@ -0,0 +1,73 @@
+package lesson17
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemonstrations builds the same PKI as Run, starts both servers on
+// random ports and compares what the lesson prints with
+// testdata/demo.golden
+func TestDemonstrations(t *testing.T) {
+	log.SetOutput(io.Discard) // the servers' access log
+	defer log.SetOutput(os.Stderr)
+
+	ca, err := newCA("Golang Lab Dev CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rogueCA, err := newCA("Rogue CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(ca *certAuthority, commonName, unit string, usage x509.ExtKeyUsage, hosts []string) tls.Certificate {
+		t.Helper()
+		cert, err := ca.issue(commonName, unit, usage, hosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	serverCert := issue(ca, "127.0.0.1", "servers", x509.ExtKeyUsageServerAuth, []string{"127.0.0.1", "localhost"})
+	alice := issue(ca, "alice", "billing", x509.ExtKeyUsageClientAuth, nil)
+	bob := issue(ca, "bob", "billing", x509.ExtKeyUsageClientAuth, nil)
+	mallory := issue(ca, "mallory", "interns", x509.ExtKeyUsageClientAuth, nil)
+	eve := issue(rogueCA, "eve", "billing", x509.ExtKeyUsageClientAuth, nil)
+
+	var out golden.Buffer
+	describeCert(&out, "CA", ca.cert)
+	describeCert(&out, "alice", alice.Leaf)
+	describeCert(&out, "eve", eve.Leaf)
+
+	policy := &clientPolicy{
+		allowedUnits: map[string]bool{"billing": true, "ops": true},
+		revoked:      map[string]bool{bob.Leaf.SerialNumber.Text(16): true},
+	}
+	mtlsServer := httptest.NewUnstartedServer(requireClientCert(apiMux()))
+	mtlsServer.TLS = newServerTLSConfig(serverCert, ca.pool(), policy)
+	mtlsServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+
+	tokenServer := httptest.NewUnstartedServer(requireBearerToken(apiMux()))
+	tokenServer.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, MinVersion: tls.VersionTLS12}
+	tokenServer.StartTLS()
+	defer tokenServer.Close()
+
+	demonstrateClients(&out, mtlsServer.Listener.Addr().String(), tokenServer.Listener.Addr().String(), ca.pool(), map[string]*tls.Certificate{
+		"alice (valid)":          &alice,
+		"bob (revoked)":          &bob,
+		"mallory (wrong unit)":   &mallory,
+		"eve (untrusted issuer)": &eve,
+		"no certificate":         nil,
+	})
+	// serial numbers are random, so only their label is kept
+	golden.Check(t, "demo.golden", out.String(), golden.Replace(`serial=[0-9a-f]+\.\.\.`, "serial=<random>"))
+}
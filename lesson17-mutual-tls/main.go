@@ -0,0 +1,380 @@
+// Lesson 17: Mutual TLS Authentication
+// This lesson covers client certificates: generating a development CA,
+// issuing server and client certs, requiring and checking client certs in
+// tls.Config, and how mTLS compares with bearer tokens
+
+package lesson17
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// APIResponse represents a standard API response
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ErrorResponse represents error response with details
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Identity is who the caller is, however they authenticated
+type Identity struct {
+	Name   string `json:"name"`
+	Unit   string `json:"unit,omitempty"`
+	Method string `json:"method"`
+}
+
+// clientPolicy is checked by VerifyPeerCertificate after Go has verified
+// the chain: a valid signature says "our CA issued this", the policy says
+// "and we still want to talk to it"
+type clientPolicy struct {
+	allowedUnits map[string]bool
+	revoked      map[string]bool // serial numbers, as hex
+}
+
+type contextKey string
+
+const identityKey contextKey = "identity"
+
+// apiTokens maps bearer tokens to identities for the token-auth server
+var apiTokens = map[string]Identity{
+	"token-alice-123": {Name: "alice", Unit: "billing", Method: "bearer token"},
+}
+
+// Run is the lesson's entry point; cmd/lesson17 calls it
+func Run() {
+	fmt.Println("=== Lesson 17: Mutual TLS Authentication ===")
+
+	mtlsAddr := flag.String("addr", "localhost:8443", "mTLS server address")
+	tokenAddr := flag.String("token-addr", "localhost:8444", "bearer-token server address")
+	certDir := flag.String("certs", "certs", "directory to write PEM files to")
+	flag.Parse()
+
+	// 1. Build a throwaway PKI
+	fmt.Println("\n--- Generating a Development PKI ---")
+	ca, err := newCA("Golang Lab Dev CA")
+	if err != nil {
+		log.Fatalf("Failed to create CA: %v", err)
+	}
+	rogueCA, err := newCA("Rogue CA")
+	if err != nil {
+		log.Fatalf("Failed to create rogue CA: %v", err)
+	}
+
+	host, _, _ := net.SplitHostPort(*mtlsAddr)
+	serverCert := mustIssue(ca, host, "servers", x509.ExtKeyUsageServerAuth, []string{host, "localhost", "127.0.0.1"})
+	alice := mustIssue(ca, "alice", "billing", x509.ExtKeyUsageClientAuth, nil)
+	bob := mustIssue(ca, "bob", "billing", x509.ExtKeyUsageClientAuth, nil)
+	mallory := mustIssue(ca, "mallory", "interns", x509.ExtKeyUsageClientAuth, nil)
+	eve := mustIssue(rogueCA, "eve", "billing", x509.ExtKeyUsageClientAuth, nil)
+
+	describeCert(os.Stdout, "CA", ca.cert)
+	describeCert(os.Stdout, "server", serverCert.Leaf)
+	describeCert(os.Stdout, "alice", alice.Leaf)
+	describeCert(os.Stdout, "bob", bob.Leaf)
+	describeCert(os.Stdout, "mallory", mallory.Leaf)
+	describeCert(os.Stdout, "eve", eve.Leaf)
+
+	if err := writePKI(*certDir, ca, map[string]tls.Certificate{
+		"server": serverCert,
+		"alice":  alice,
+	}); err != nil {
+		log.Fatalf("Failed to write certificates: %v", err)
+	}
+	fmt.Printf("Wrote ca.pem, server.pem and alice.pem (+ keys) to %s/\n", *certDir)
+
+	// bob's certificate is still valid but has been revoked
+	policy := &clientPolicy{
+		allowedUnits: map[string]bool{"billing": true, "ops": true},
+		revoked:      map[string]bool{bob.Leaf.SerialNumber.Text(16): true},
+	}
+
+	// 2. Start an mTLS server and, for contrast, a bearer-token server
+	mtlsServer := &http.Server{
+		Addr:      *mtlsAddr,
+		Handler:   loggingMiddleware(requireClientCert(apiMux())),
+		TLSConfig: newServerTLSConfig(serverCert, ca.pool(), policy),
+		ErrorLog:  log.New(io.Discard, "", 0), // handshake failures are expected in the demo
+	}
+	tokenServer := &http.Server{
+		Addr:      *tokenAddr,
+		Handler:   loggingMiddleware(requireBearerToken(apiMux())),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{serverCert}, MinVersion: tls.VersionTLS12},
+	}
+
+	for _, server := range []*http.Server{mtlsServer, tokenServer} {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", server.Addr, err)
+		}
+		go func(server *http.Server) {
+			// Certificates are already in TLSConfig, so no file names here
+			if err := server.ServeTLS(listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Server error: %v", err)
+			}
+		}(server)
+	}
+
+	// 3. Call them with different clients
+	demonstrateClients(os.Stdout, *mtlsAddr, *tokenAddr, ca.pool(), map[string]*tls.Certificate{
+		"alice (valid)":          &alice,
+		"bob (revoked)":          &bob,
+		"mallory (wrong unit)":   &mallory,
+		"eve (untrusted issuer)": &eve,
+		"no certificate":         nil,
+	})
+
+	fmt.Printf("\nmTLS server on https://%s, token server on https://%s\n", *mtlsAddr, *tokenAddr)
+	fmt.Println("Available endpoints (on both):")
+	fmt.Println("  GET /api/whoami  - Show the authenticated identity")
+	fmt.Println("  GET /api/reports - A protected resource")
+	fmt.Println("\nPress Ctrl+C to stop the servers")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mtlsServer.Shutdown(shutdownCtx)
+	tokenServer.Shutdown(shutdownCtx)
+}
+
+func mustIssue(ca *certAuthority, commonName, unit string, usage x509.ExtKeyUsage, hosts []string) tls.Certificate {
+	cert, err := ca.issue(commonName, unit, usage, hosts)
+	if err != nil {
+		log.Fatalf("Failed to issue certificate for %s: %v", commonName, err)
+	}
+	return cert
+}
+
+// newServerTLSConfig requires every client to present a certificate signed
+// by our CA, then applies the policy on top
+func newServerTLSConfig(serverCert tls.Certificate, clientCAs *x509.CertPool, policy *clientPolicy) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		MinVersion:   tls.VersionTLS12,
+
+		// RequireAndVerifyClientCert: no cert, or a cert from another CA,
+		// fails the handshake before any HTTP happens
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+
+		// Called after the chain is verified. verifiedChains[0][0] is the
+		// client's leaf certificate. Returning an error aborts the handshake.
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+				return errors.New("no verified client certificate")
+			}
+			return policy.check(verifiedChains[0][0])
+		},
+	}
+}
+
+func (p *clientPolicy) check(cert *x509.Certificate) error {
+	if p.revoked[cert.SerialNumber.Text(16)] {
+		return fmt.Errorf("certificate for %s has been revoked", cert.Subject.CommonName)
+	}
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if p.allowedUnits[unit] {
+			return nil
+		}
+	}
+	return fmt.Errorf("unit %v is not allowed", cert.Subject.OrganizationalUnit)
+}
+
+// newMTLSClient returns an HTTP client that trusts our CA and presents a
+// client certificate when the server asks for one
+func newMTLSClient(caPool *x509.CertPool, clientCert *tls.Certificate) *http.Client {
+	tlsConfig := &tls.Config{
+		RootCAs:    caPool,
+		MinVersion: tls.VersionTLS12,
+	}
+	if clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+func demonstrateClients(w io.Writer, mtlsAddr, tokenAddr string, caPool *x509.CertPool, clients map[string]*tls.Certificate) {
+	fmt.Fprintln(w, "\n--- Calling the mTLS Server ---")
+
+	order := []string{"alice (valid)", "bob (revoked)", "mallory (wrong unit)", "eve (untrusted issuer)", "no certificate"}
+	for _, name := range order {
+		client := newMTLSClient(caPool, clients[name])
+		body, err := get(client, "https://"+mtlsAddr+"/api/whoami", "")
+		if err != nil {
+			fmt.Fprintf(w, "%-24s rejected: %s\n", name, shortError(err))
+			continue
+		}
+		fmt.Fprintf(w, "%-24s accepted: %s\n", name, body)
+	}
+
+	fmt.Fprintln(w, "\n--- Calling the Token Server ---")
+
+	// Same trust in the server, but no client certificate
+	client := newMTLSClient(caPool, nil)
+	for _, token := range []string{"token-alice-123", "stolen-or-guessed", ""} {
+		body, err := get(client, "https://"+tokenAddr+"/api/whoami", token)
+		label := fmt.Sprintf("token %q", token)
+		if err != nil {
+			fmt.Fprintf(w, "%-24s rejected: %s\n", label, shortError(err))
+			continue
+		}
+		fmt.Fprintf(w, "%-24s accepted: %s\n", label, body)
+	}
+}
+
+func get(client *http.Client, url, token string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// shortError trims the URL and operation off client errors for display
+func shortError(err error) string {
+	msg := err.Error()
+	if i := strings.LastIndex(msg, ": remote error: "); i >= 0 {
+		return msg[i+2:]
+	}
+	if i := strings.LastIndex(msg, ": tls: "); i >= 0 {
+		return msg[i+2:]
+	}
+	return msg
+}
+
+// Handlers
+
+func apiMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/whoami", handleWhoAmI)
+	mux.HandleFunc("/api/reports", handleReports)
+	return mux
+}
+
+func handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	identity := r.Context().Value(identityKey).(Identity)
+	respondWithJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    identity,
+	})
+}
+
+func handleReports(w http.ResponseWriter, r *http.Request) {
+	identity := r.Context().Value(identityKey).(Identity)
+	respondWithJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Reports for %s", identity.Name),
+		Data:    []string{"q1-revenue", "q2-revenue"},
+	})
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, ErrorResponse{Error: message})
+}
+
+// Middleware
+
+// requireClientCert turns the verified client certificate into an
+// Identity. By the time a request arrives the handshake has already
+// rejected bad certs, so this only reads r.TLS.
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			respondWithError(w, http.StatusUnauthorized, "Client certificate required")
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		identity := Identity{Name: cert.Subject.CommonName, Method: "client certificate"}
+		if len(cert.Subject.OrganizationalUnit) > 0 {
+			identity.Unit = cert.Subject.OrganizationalUnit[0]
+		}
+
+		ctx := context.WithValue(r.Context(), identityKey, identity)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireBearerToken is the token-auth equivalent: the TLS layer only
+// protects the server's identity, and the caller proves theirs with a
+// shared secret in every request
+func requireBearerToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "Bearer token required")
+			return
+		}
+
+		for known, identity := range apiTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+				ctx := context.WithValue(r.Context(), identityKey, identity)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+	})
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s in %v", r.Method, r.URL.Path, time.Since(start))
+	})
+}
@@ -0,0 +1,47 @@
+package lesson18
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"golang-lab/lab/golden"
+)
+
+// codes, tokens, PKCE challenges and expiry times are random or depend on
+// the clock, so they are replaced before comparing
+var randomParts = []golden.Scrubber{
+	golden.Replace(`(code_challenge|state)=[\w-]+`, "$1=<random>"),
+	golden.Replace(`127\.0\.0\.1:\d+`, "<provider>"),
+	golden.Replace(`code [\w-]+\.\.\.`, "code <code>..."),
+	golden.Replace(`expires \d\d:\d\d:\d\d`, "expires <time>"),
+	golden.Replace(`"expires_in":"\d+s"`, `"expires_in":"<seconds>"`),
+	golden.Replace(`\([\w-]+\.\.\. -> [\w-]+\.\.\.\)`, "(<old token>... -> <new token>...)"),
+}
+
+// TestDemonstrateFlow runs the whole flow against the mock provider and
+// compares what the lesson prints with testdata/flow.golden
+func TestDemonstrateFlow(t *testing.T) {
+	provider := newMockProvider("golab-client", "golab-secret", "http://localhost:8080/callback", time.Minute)
+	server := httptest.NewServer(provider.routes())
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID:     "golab-client",
+		ClientSecret: "golab-secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   server.URL + "/authorize",
+			TokenURL:  server.URL + "/token",
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+		RedirectURL: "http://localhost:8080/callback",
+		Scopes:      []string{"profile"},
+	}
+
+	golden.Demo(t, "flow.golden", func(w io.Writer) {
+		demonstrateFlow(w, config, server.URL)
+	}, randomParts...)
+}
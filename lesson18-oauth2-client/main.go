@@ -0,0 +1,432 @@
+// Lesson 18: OAuth2 Client and Token Management
+// This lesson covers the client side of OAuth2 with golang.org/x/oauth2:
+// the authorization code flow with PKCE, state checks, token caching and
+// automatic refresh, and calling a protected API
+
+package lesson18
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// APIResponse represents a standard API response
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ErrorResponse represents error response with details
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// pendingLogin remembers the PKCE verifier for a login in progress,
+// keyed by the state parameter
+type pendingLogin struct {
+	verifier  string
+	expiresAt time.Time
+}
+
+// app is the client application. It holds one login at a time, like a
+// CLI tool or a desktop app would.
+type app struct {
+	config      *oauth2.Config
+	tokenFile   string
+	providerURL string
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+	source  oauth2.TokenSource // nil until logged in
+}
+
+const stateCookie = "oauth_state"
+
+// Run is the lesson's entry point; cmd/lesson18 calls it
+func Run() {
+	fmt.Println("=== Lesson 18: OAuth2 Client and Token Management ===")
+
+	addr := flag.String("addr", "localhost:8080", "client app address")
+	providerAddr := flag.String("provider-addr", "localhost:9096", "mock provider address")
+	tokenTTL := flag.Duration("token-ttl", 30*time.Second, "access token lifetime issued by the mock provider")
+	tokenFile := flag.String("token-file", filepath.Join(os.TempDir(), "golab-lesson18-token.json"), "where the token is cached")
+	flag.Parse()
+
+	providerURL := "http://" + *providerAddr
+	redirectURL := "http://" + *addr + "/callback"
+
+	// The provider runs in-process so the lesson needs no accounts or
+	// network access; swap the Endpoint for a real one (e.g.
+	// github.Endpoint from golang.org/x/oauth2/github) and nothing else
+	// in the client changes
+	provider := newMockProvider("golab-client", "golab-secret", redirectURL, *tokenTTL)
+	go func() {
+		log.Fatal(http.ListenAndServe(*providerAddr, provider.routes()))
+	}()
+
+	a := &app{
+		config: &oauth2.Config{
+			ClientID:     "golab-client",
+			ClientSecret: "golab-secret",
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   providerURL + "/authorize",
+				TokenURL:  providerURL + "/token",
+				AuthStyle: oauth2.AuthStyleInHeader,
+			},
+			RedirectURL: redirectURL,
+			Scopes:      []string{"profile"},
+		},
+		tokenFile:   *tokenFile,
+		providerURL: providerURL,
+		pending:     make(map[string]pendingLogin),
+	}
+
+	waitForServer(providerURL + "/api/profile")
+	demonstrateFlow(os.Stdout, a.config, providerURL)
+
+	if err := a.restoreLogin(); err != nil {
+		log.Printf("Ignoring cached token: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", a.handleStatus)
+	mux.HandleFunc("/login", a.handleLogin)
+	mux.HandleFunc("/callback", a.handleCallback)
+	mux.HandleFunc("/profile", a.handleProfile)
+	mux.HandleFunc("/logout", a.handleLogout)
+
+	fmt.Printf("\nClient app on http://%s, mock provider on %s\n", *addr, providerURL)
+	fmt.Println("Available endpoints:")
+	fmt.Println("  GET /         - Login status")
+	fmt.Println("  GET /login    - Start the authorization code + PKCE flow")
+	fmt.Println("  GET /callback - Redirect target that exchanges the code")
+	fmt.Println("  GET /profile  - Call the protected API (refreshes automatically)")
+	fmt.Println("  GET /logout   - Forget the cached token")
+	fmt.Printf("\nOpen http://%s/login in a browser. Token cache: %s\n", *addr, *tokenFile)
+	fmt.Println("Press Ctrl+C to stop the server")
+
+	log.Fatal(http.ListenAndServe(*addr, loggingMiddleware(mux)))
+}
+
+// demonstrateFlow runs the whole flow without a browser: it plays the
+// user's part by approving the consent form itself
+func demonstrateFlow(w io.Writer, config *oauth2.Config, providerURL string) {
+	fmt.Fprintln(w, "\n--- Authorization Code Flow with PKCE ---")
+	ctx := context.Background()
+
+	// 1. A fresh verifier and state for every login
+	verifier := oauth2.GenerateVerifier()
+	state := randomToken()
+	authURL := config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+	fmt.Fprintf(w, "1. Send the user to:\n   %s\n", authURL)
+
+	// 2. The user approves; the provider redirects back with a code
+	code, err := approve(authURL, state)
+	if err != nil {
+		log.Fatalf("Approval failed: %v", err)
+	}
+	fmt.Fprintf(w, "2. Provider redirected back with code %s...\n", code[:8])
+
+	// 3. A stolen code is useless without the verifier
+	if _, err := config.Exchange(ctx, code, oauth2.VerifierOption(oauth2.GenerateVerifier())); err != nil {
+		fmt.Fprintf(w, "3. Exchange with the wrong verifier: %s\n", describeOAuthError(err))
+	}
+
+	// 4. Codes are single use, so the failed attempt above burned that
+	// one; get another and exchange it properly
+	code, _ = approve(config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), state)
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Fatalf("Exchange failed: %v", err)
+	}
+	fmt.Fprintf(w, "4. Exchanged for an access token (expires %s) and a refresh token\n",
+		token.Expiry.Format(time.TimeOnly))
+
+	// 5. The client adds the Authorization header and refreshes the
+	// token when it is about to expire
+	source := config.TokenSource(ctx, token)
+	client := oauth2.NewClient(ctx, source)
+	if body, err := getBody(client, providerURL+"/api/profile"); err == nil {
+		fmt.Fprintf(w, "5. Protected API: %s\n", body)
+	}
+
+	// 6. Pretend time passed: an expired token is refreshed transparently
+	token.Expiry = time.Now().Add(-time.Minute)
+	source = config.TokenSource(ctx, token)
+	client = oauth2.NewClient(ctx, source)
+	if body, err := getBody(client, providerURL+"/api/profile"); err == nil {
+		refreshed, _ := source.Token()
+		fmt.Fprintf(w, "6. After expiry the client refreshed (%s... -> %s...) and got: %s\n",
+			token.AccessToken[:8], refreshed.AccessToken[:8], body)
+	}
+}
+
+// approve submits the consent form and returns the code from the redirect
+func approve(authURL, wantState string) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	form := u.Query()
+	form.Set("approve", "yes")
+
+	// Don't follow the redirect: the callback URL isn't being served yet,
+	// and we only want the code from the Location header
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := noRedirect.PostForm(u.Scheme+"://"+u.Host+u.Path, form)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", err
+	}
+	if location.Query().Get("state") != wantState {
+		return "", errors.New("state mismatch")
+	}
+	if e := location.Query().Get("error"); e != "" {
+		return "", errors.New(e)
+	}
+	return location.Query().Get("code"), nil
+}
+
+// restoreLogin picks up a token cached by a previous run
+func (a *app) restoreLogin() error {
+	token, err := loadToken(a.tokenFile)
+	if err != nil || token == nil {
+		return err
+	}
+	a.setToken(token)
+	fmt.Printf("\nRestored cached login (access token expires %s)\n", token.Expiry.Format(time.TimeOnly))
+	return nil
+}
+
+func (a *app) setToken(token *oauth2.Token) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.source = newCachingTokenSource(a.config.TokenSource(context.Background(), token), a.tokenFile, token)
+}
+
+func (a *app) tokenSource() oauth2.TokenSource {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.source
+}
+
+// Handlers
+
+func (a *app) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	source := a.tokenSource()
+	if source == nil {
+		respondWithJSON(w, http.StatusOK, APIResponse{Success: true, Message: "Not logged in; visit /login"})
+		return
+	}
+
+	token, err := source.Token()
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Login expired; visit /login")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Logged in",
+		Data: map[string]interface{}{
+			"expires_at":        token.Expiry,
+			"has_refresh_token": token.RefreshToken != "",
+		},
+	})
+}
+
+// handleLogin starts the flow. The state ties the callback to this
+// browser (CSRF protection); the verifier proves the code exchange comes
+// from whoever started the flow (PKCE).
+func (a *app) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state := randomToken()
+	verifier := oauth2.GenerateVerifier()
+
+	a.mu.Lock()
+	for s, p := range a.pending { // drop abandoned logins
+		if time.Now().After(p.expiresAt) {
+			delete(a.pending, s)
+		}
+	}
+	a.pending[state] = pendingLogin{verifier: verifier, expiresAt: time.Now().Add(10 * time.Minute)}
+	a.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/callback",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // must survive the redirect back from the provider
+	})
+	http.Redirect(w, r, a.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), http.StatusFound)
+}
+
+func (a *app) handleCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		respondWithError(w, http.StatusForbidden, "Authorization failed: "+e)
+		return
+	}
+
+	// The state must match the cookie we set, or someone else started
+	// this flow and is trying to log the user into their account
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || cookie.Value != q.Get("state") {
+		respondWithError(w, http.StatusBadRequest, "State mismatch")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/callback", MaxAge: -1})
+
+	a.mu.Lock()
+	login, ok := a.pending[cookie.Value]
+	delete(a.pending, cookie.Value)
+	a.mu.Unlock()
+	if !ok || time.Now().After(login.expiresAt) {
+		respondWithError(w, http.StatusBadRequest, "Login expired; start again at /login")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	token, err := a.config.Exchange(ctx, q.Get("code"), oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		log.Printf("Code exchange failed: %v", err)
+		respondWithError(w, http.StatusBadGateway, "Code exchange failed: "+describeOAuthError(err))
+		return
+	}
+
+	if err := saveToken(a.tokenFile, token); err != nil {
+		log.Printf("Failed to cache token: %v", err)
+	}
+	a.setToken(token)
+
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
+
+func (a *app) handleProfile(w http.ResponseWriter, r *http.Request) {
+	source := a.tokenSource()
+	if source == nil {
+		respondWithError(w, http.StatusUnauthorized, "Not logged in; visit /login")
+		return
+	}
+
+	// The client's transport asks source for a token on every request;
+	// an expired one is refreshed (and cached) first
+	client := oauth2.NewClient(r.Context(), source)
+	body, err := getBody(client, a.providerURL+"/api/profile")
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			// The refresh token was rejected: the user has to log in again
+			respondWithError(w, http.StatusUnauthorized, "Session expired; visit /login")
+			return
+		}
+		respondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	var profile map[string]string
+	json.Unmarshal([]byte(body), &profile)
+	respondWithJSON(w, http.StatusOK, APIResponse{Success: true, Data: profile})
+}
+
+func (a *app) handleLogout(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.source = nil
+	a.mu.Unlock()
+
+	if err := os.Remove(a.tokenFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove token cache: %v", err)
+	}
+	respondWithJSON(w, http.StatusOK, APIResponse{Success: true, Message: "Logged out"})
+}
+
+// Helper functions
+
+func getBody(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API returned %d", resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// describeOAuthError pulls the OAuth error code out of a token endpoint
+// failure
+func describeOAuthError(err error) string {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode != "" {
+		return retrieveErr.ErrorCode
+	}
+	return err.Error()
+}
+
+func waitForServer(url string) {
+	for i := 0; i < 50; i++ {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, ErrorResponse{Error: message})
+}
+
+// Middleware
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s in %v", r.Method, r.URL.Path, time.Since(start))
+	})
+}
@@ -0,0 +1,255 @@
+package lesson18
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockProvider is a tiny OAuth2 authorization server plus a protected API,
+// just enough to exercise a real client. It auto-creates the user "alice"
+// and keeps everything in memory. Don't use it for anything else.
+type mockProvider struct {
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	tokenTTL     time.Duration
+
+	mu            sync.Mutex
+	codes         map[string]authCode
+	accessTokens  map[string]accessToken
+	refreshTokens map[string]string // refresh token -> user
+}
+
+type authCode struct {
+	user          string
+	redirectURI   string
+	codeChallenge string
+	scope         string
+	expiresAt     time.Time
+}
+
+type accessToken struct {
+	user      string
+	scope     string
+	expiresAt time.Time
+}
+
+// tokenResponse is the JSON body of a successful token request (RFC 6749 5.1)
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+func newMockProvider(clientID, clientSecret, redirectURI string, tokenTTL time.Duration) *mockProvider {
+	return &mockProvider{
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		redirectURI:   redirectURI,
+		tokenTTL:      tokenTTL,
+		codes:         make(map[string]authCode),
+		accessTokens:  make(map[string]accessToken),
+		refreshTokens: make(map[string]string),
+	}
+}
+
+func (p *mockProvider) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/api/profile", p.handleProfile)
+	return mux
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h1>Mock Provider</h1>
+<p><b>{{.ClientID}}</b> wants to access your profile ({{.Scope}}).</p>
+<form method="POST" action="/authorize">
+  {{range $name, $values := .Query}}<input type="hidden" name="{{$name}}" value="{{index $values 0}}">
+  {{end}}<button name="approve" value="yes">Approve as alice</button>
+  <button name="approve" value="no">Deny</button>
+</form>
+</body></html>`))
+
+// handleAuthorize shows a consent page (GET) and issues a code when the
+// user approves (POST)
+func (p *mockProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+
+	// Errors about the client or redirect URI must NOT redirect: we can't
+	// trust where the redirect would go
+	if q.Get("client_id") != p.clientID || q.Get("redirect_uri") != p.redirectURI {
+		http.Error(w, "unknown client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	redirect, _ := url.Parse(p.redirectURI)
+	params := url.Values{"state": {q.Get("state")}}
+
+	switch {
+	case q.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		// This provider requires PKCE, as OAuth 2.1 does for every client
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "PKCE with S256 is required")
+	case r.Method == http.MethodGet:
+		data := struct {
+			ClientID string
+			Scope    string
+			Query    url.Values
+		}{p.clientID, q.Get("scope"), r.URL.Query()}
+		consentPage.Execute(w, data)
+		return
+	case q.Get("approve") != "yes":
+		params.Set("error", "access_denied")
+	default:
+		code := randomToken()
+		p.mu.Lock()
+		p.codes[code] = authCode{
+			user:          "alice",
+			redirectURI:   q.Get("redirect_uri"),
+			codeChallenge: q.Get("code_challenge"),
+			scope:         q.Get("scope"),
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		params.Set("code", code)
+	}
+
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleToken implements the authorization_code and refresh_token grants
+func (p *mockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != p.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.clientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var user, scope string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, ok := p.codes[r.PostForm.Get("code")]
+		// Codes are single use, even when the exchange fails
+		delete(p.codes, r.PostForm.Get("code"))
+		if !ok || time.Now().After(code.expiresAt) || code.redirectURI != r.PostForm.Get("redirect_uri") {
+			tokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		// PKCE: only whoever created the challenge knows the verifier
+		if s256(r.PostForm.Get("code_verifier")) != code.codeChallenge {
+			log.Printf("[provider] PKCE verification failed")
+			tokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		user, scope = code.user, code.scope
+
+	case "refresh_token":
+		old := r.PostForm.Get("refresh_token")
+		var ok bool
+		if user, ok = p.refreshTokens[old]; !ok {
+			tokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		// Rotation: each refresh token works once. Clients must store the
+		// new one, or their next refresh fails.
+		delete(p.refreshTokens, old)
+		scope = "profile"
+		log.Printf("[provider] refreshed token for %s", user)
+
+	default:
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	access, refresh := randomToken(), randomToken()
+	p.accessTokens[access] = accessToken{user: user, scope: scope, expiresAt: time.Now().Add(p.tokenTTL)}
+	p.refreshTokens[refresh] = user
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(p.tokenTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        scope,
+	})
+}
+
+// handleProfile is the protected API: it only answers with a valid,
+// unexpired access token
+func (p *mockProvider) handleProfile(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	p.mu.Lock()
+	info, found := p.accessTokens[token]
+	p.mu.Unlock()
+
+	if !ok || !found || time.Now().After(info.expiresAt) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, `{"error":"invalid_token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"user":       info.user,
+		"email":      info.user + "@example.com",
+		"scope":      info.scope,
+		"expires_in": fmt.Sprintf("%.0fs", time.Until(info.expiresAt).Seconds()),
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// s256 is the PKCE S256 transform: BASE64URL(SHA256(verifier))
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
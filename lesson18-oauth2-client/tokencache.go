@@ -0,0 +1,71 @@
+package lesson18
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// loadToken reads a cached token. A missing file just means "not logged in".
+func loadToken(path string) (*oauth2.Token, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// saveToken writes the token with owner-only permissions: it's a credential
+func saveToken(path string, token *oauth2.Token) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// cachingTokenSource wraps the oauth2 refreshing TokenSource and saves the
+// token whenever it changes. Without this a refreshed token (and, with
+// rotation, the new refresh token) would be lost on restart.
+type cachingTokenSource struct {
+	mu   sync.Mutex
+	base oauth2.TokenSource
+	path string
+	last string // access token last saved
+}
+
+func newCachingTokenSource(base oauth2.TokenSource, path string, current *oauth2.Token) *cachingTokenSource {
+	return &cachingTokenSource{base: base, path: path, last: current.AccessToken}
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token.AccessToken != s.last {
+		log.Printf("Access token refreshed, saving to %s", s.path)
+		if err := saveToken(s.path, token); err != nil {
+			// The token is still usable for this process
+			log.Printf("Failed to cache token: %v", err)
+		}
+		s.last = token.AccessToken
+	}
+	return token, nil
+}
@@ -0,0 +1,295 @@
+package lesson19
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang-lab/lab/clock"
+	"golang-lab/lab/demo"
+	"golang-lab/lab/golden"
+)
+
+// useFakeClock swaps the lesson's clock for a fake one until the test ends
+func useFakeClock(t *testing.T) *clock.Fake {
+	fake := clock.NewFake(demo.Clock)
+	clk = fake
+	t.Cleanup(func() { clk = clock.Real{} })
+	return fake
+}
+
+// TestShedding fills a limiter with room for one request, checks that work
+// is shed while health checks still get through, and compares every
+// response with testdata/shedding.golden
+func TestShedding(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{InitialLimit: 1, MaxQueue: 0})
+	handler := newServerHandler(newBackend(1, time.Millisecond), limiter)
+
+	var transcript strings.Builder
+	request := func(target string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		fmt.Fprintf(&transcript, "GET %s\n%d", target, rec.Code)
+		if retry := rec.Header().Get("Retry-After"); retry != "" {
+			fmt.Fprintf(&transcript, " Retry-After: %s", retry)
+		}
+		fmt.Fprintf(&transcript, "\n%s\n\n", strings.TrimSpace(rec.Body.String()))
+	}
+
+	transcript.WriteString("# idle\n")
+	request("/api/work")
+
+	transcript.WriteString("# the only slot is taken\n")
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	request("/api/work")
+	request("/healthz")
+	request("/stats")
+
+	transcript.WriteString("# the slot is free again\n")
+	limiter.Release(time.Millisecond)
+	request("/api/work")
+	request("/stats")
+
+	// how long the work took changes on every run
+	golden.Check(t, "shedding.golden", transcript.String(), golden.Replace(`"took":"[^"]*"`, `"took":"<duration>"`))
+}
+
+// TestAdaptiveLimit runs rounds of requests through the middleware on a
+// fake clock, each taking exactly as long as the round says, and follows
+// the limit as AIMD moves it
+func TestAdaptiveLimit(t *testing.T) {
+	fake := useFakeClock(t)
+	limiter := NewLimiter(LimiterConfig{
+		InitialLimit:  4,
+		MaxQueue:      0,
+		Adaptive:      true,
+		MinLimit:      2,
+		MaxLimit:      8,
+		TargetLatency: 30 * time.Millisecond,
+		Backoff:       0.5,
+	})
+	var work time.Duration
+	handler := sheddingMiddleware(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clk.Sleep(work)
+	}))
+
+	// round sends n requests at once that each take d, and returns the
+	// limit after them
+	round := func(n int, d time.Duration) int {
+		t.Helper()
+		work = d
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/work", nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("a request within the limit got %d", rec.Code)
+				}
+			}()
+		}
+		fake.BlockUntil(n)
+		fake.Advance(d)
+		wg.Wait()
+		return limiter.Stats().Limit
+	}
+
+	// One request at a time uses too little of the limit to grow it
+	for i := 0; i < 20; i++ {
+		if limit := round(1, 10*time.Millisecond); limit != 4 {
+			t.Fatalf("a quiet period moved the limit to %d, want it left at 4", limit)
+		}
+	}
+
+	// Fast requests that fill the limit grow it by about one per window,
+	// up to MaxLimit and no further
+	limit, rounds := 4, 0
+	for ; limit < 8 && rounds < 30; rounds++ {
+		next := round(limit, 10*time.Millisecond)
+		if next < limit {
+			t.Fatalf("fast requests cut the limit from %d to %d", limit, next)
+		}
+		limit = next
+	}
+	if limit != 8 {
+		t.Fatalf("limit %d after %d rounds of fast requests, want 8", limit, rounds)
+	}
+	if rounds < 4 {
+		t.Errorf("the limit reached 8 in %d rounds; additive increase should be slow", rounds)
+	}
+	if limit := round(8, 10*time.Millisecond); limit != 8 {
+		t.Errorf("limit %d, want it held at MaxLimit 8", limit)
+	}
+
+	// Each slow request halves it, down to MinLimit: 8, 4, 2, 2...
+	if limit := round(1, 50*time.Millisecond); limit != 4 {
+		t.Errorf("one slow request left the limit at %d, want 4", limit)
+	}
+	if limit := round(4, 50*time.Millisecond); limit != 2 {
+		t.Errorf("slow requests left the limit at %d, want MinLimit 2", limit)
+	}
+
+	// The lower limit sheds what the higher one let through
+	for i := 0; i < 2; i++ {
+		if err := limiter.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := limiter.Acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("a third request at limit 2: %v, want ErrQueueFull", err)
+	}
+}
+
+// TestLimiterQueue checks the queue on the fake clock: waiters are
+// served in order when a slot frees, and time out after QueueTimeout
+func TestLimiterQueue(t *testing.T) {
+	fake := useFakeClock(t)
+	limiter := NewLimiter(LimiterConfig{InitialLimit: 1, MaxQueue: 2, QueueTimeout: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	if err := limiter.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first, second := make(chan error), make(chan error)
+	go func() { first <- limiter.Acquire(ctx) }()
+	fake.BlockUntil(1)
+	go func() { second <- limiter.Acquire(ctx) }()
+	fake.BlockUntil(2)
+
+	if err := limiter.Acquire(ctx); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("with the queue full: %v, want ErrQueueFull", err)
+	}
+
+	fake.Advance(40 * time.Millisecond)
+	limiter.Release(time.Millisecond)
+	if err := <-first; err != nil {
+		t.Errorf("the first waiter got %v, want the freed slot", err)
+	}
+	fake.Advance(10 * time.Millisecond)
+	if err := <-second; !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("the second waiter got %v after 50ms, want ErrQueueTimeout", err)
+	}
+
+	stats := limiter.Stats()
+	if stats.InFlight != 1 || stats.Queued != 0 || stats.Accepted != 2 || stats.Shed != 2 {
+		t.Errorf("stats %+v, want 1 in flight, 2 accepted, 2 shed", stats)
+	}
+}
+
+// TestSheddingAfterPanic checks a handler that panics still releases its
+// slot, with the time it took, so panics can't fill the limiter up
+func TestSheddingAfterPanic(t *testing.T) {
+	fake := useFakeClock(t)
+	limiter := NewLimiter(LimiterConfig{InitialLimit: 2, Adaptive: true, MinLimit: 1, MaxLimit: 2,
+		TargetLatency: 10 * time.Millisecond, Backoff: 0.5})
+	handler := sheddingMiddleware(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.Advance(20 * time.Millisecond)
+		if r.URL.Path == "/panic" {
+			panic("handler failed")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("the handler's panic didn't reach the server")
+				}
+			}()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+		}()
+	}
+
+	stats := limiter.Stats()
+	if stats.InFlight != 0 || stats.Limit != 1 {
+		t.Errorf("after 3 panics taking 20ms: %+v, want nothing in flight and the limit backed off to 1", stats)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/work", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("after the panics, a request got %d, want 200", rec.Code)
+	}
+}
+
+// TestOverload sends more requests than the server can take at once, and
+// checks that the excess gets 503 straight away while every admitted
+// request finishes within QueueTimeout plus its own work
+func TestOverload(t *testing.T) {
+	fake := useFakeClock(t)
+	const work, queueTimeout = 20 * time.Millisecond, 50 * time.Millisecond
+	limiter := NewLimiter(LimiterConfig{InitialLimit: 2, MaxQueue: 2, QueueTimeout: queueTimeout})
+	handler := newServerHandler(newBackend(2, work), limiter)
+
+	type result struct {
+		code    int
+		retry   string
+		latency time.Duration
+	}
+	const clients = 10
+	results := make(chan result, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			start := clk.Now()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/work", nil))
+			results <- result{rec.Code, rec.Header().Get("Retry-After"), clk.Since(start)}
+		}()
+	}
+
+	// Two requests are working and two are queued; the other six are
+	// turned away without waiting for the clock at all
+	fake.BlockUntil(4)
+	var shed, ok []result
+	for len(shed) < clients-4 {
+		r := <-results
+		if r.code != http.StatusServiceUnavailable {
+			t.Fatalf("got %d before the clock moved, want 503", r.code)
+		}
+		shed = append(shed, r)
+	}
+	for _, r := range shed {
+		if r.retry != "1" || r.latency != 0 {
+			t.Errorf("shed request: Retry-After %q after %v, want 1 at once", r.retry, r.latency)
+		}
+	}
+
+	// The working two finish and hand their slots to the queued two
+	fake.Advance(work)
+	for len(ok) < 2 {
+		ok = append(ok, <-results)
+	}
+	fake.BlockUntil(4) // two at work again, two queue timeouts still pending
+	fake.Advance(work)
+	for len(ok) < 4 {
+		ok = append(ok, <-results)
+	}
+	for _, r := range ok {
+		if r.code != http.StatusOK {
+			t.Errorf("admitted request got %d", r.code)
+		}
+		if r.latency > queueTimeout+work {
+			t.Errorf("admitted request took %v, more than the %v bound", r.latency, queueTimeout+work)
+		}
+	}
+
+	// The health check doesn't queue behind any of it
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz got %d", rec.Code)
+	}
+	if stats := limiter.Stats(); stats.Accepted != 4 || stats.Shed != clients-4 {
+		t.Errorf("stats %+v, want 4 accepted and %d shed", stats, clients-4)
+	}
+}
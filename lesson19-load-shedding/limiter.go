@@ -0,0 +1,155 @@
+package lesson19
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Errors returned by Limiter.Acquire; both mean "shed this request"
+var (
+	ErrQueueFull    = errors.New("queue full")
+	ErrQueueTimeout = errors.New("timed out waiting in queue")
+)
+
+// LimiterConfig controls a Limiter. With Adaptive false the limit stays at
+// InitialLimit; with Adaptive true it moves between MinLimit and MaxLimit
+// using AIMD.
+type LimiterConfig struct {
+	InitialLimit int
+	MaxQueue     int
+	QueueTimeout time.Duration
+
+	Adaptive      bool
+	MinLimit      int
+	MaxLimit      int
+	TargetLatency time.Duration // slower than this counts as congestion
+	Backoff       float64       // multiplicative decrease, e.g. 0.9
+}
+
+// LimiterStats is a snapshot for the /stats endpoint
+type LimiterStats struct {
+	Limit    int   `json:"limit"`
+	InFlight int   `json:"in_flight"`
+	Queued   int   `json:"queued"`
+	Accepted int64 `json:"accepted"`
+	Shed     int64 `json:"shed"`
+}
+
+// Limiter caps concurrent requests. Requests over the limit wait in a
+// bounded FIFO queue for a limited time; anything beyond that is rejected
+// straight away, which is far cheaper than letting it pile up.
+type Limiter struct {
+	config LimiterConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+	accepted int64
+	shed     int64
+}
+
+func NewLimiter(config LimiterConfig) *Limiter {
+	return &Limiter{config: config, limit: float64(config.InitialLimit)}
+}
+
+// Acquire takes a slot, queueing if necessary. Every successful Acquire
+// must be followed by exactly one Release.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inFlight < l.currentLimit() {
+		l.inFlight++
+		l.accepted++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.config.MaxQueue {
+		l.shed++
+		l.mu.Unlock()
+		return ErrQueueFull
+	}
+
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	var err error
+	select {
+	case <-ready:
+		return nil // Release handed its slot to us
+	case <-clk.After(l.config.QueueTimeout):
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiters {
+		if w == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			l.shed++
+			return err
+		}
+	}
+	// Not in the queue anymore: a slot was handed over just as we gave
+	// up. Take it rather than leak it.
+	return nil
+}
+
+// Release returns a slot. latency is how long the request took; the
+// adaptive limiter uses it to decide whether the server is congested.
+func (l *Limiter) Release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.Adaptive {
+		l.adjust(latency)
+	}
+
+	l.inFlight--
+	// Hand freed slots to waiters in arrival order. If the limit just
+	// shrank below inFlight, nobody is woken.
+	for l.inFlight < l.currentLimit() && len(l.waiters) > 0 {
+		ready := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+		l.accepted++
+		close(ready)
+	}
+}
+
+// adjust is AIMD, the algorithm TCP uses for its congestion window:
+// grow by about one slot per "window" of fast requests, and cut by a
+// fraction on every slow one. Slow growth probes for spare capacity;
+// fast backoff sheds load before queues build up.
+func (l *Limiter) adjust(latency time.Duration) {
+	if latency > l.config.TargetLatency {
+		l.limit = math.Max(float64(l.config.MinLimit), l.limit*l.config.Backoff)
+		return
+	}
+	// Only grow when the limit is actually in use; otherwise a quiet
+	// period would inflate it to MaxLimit and protect nothing
+	if float64(l.inFlight) >= l.limit/2 {
+		l.limit = math.Min(float64(l.config.MaxLimit), l.limit+1/l.limit)
+	}
+}
+
+func (l *Limiter) currentLimit() int {
+	return int(l.limit)
+}
+
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		Limit:    l.currentLimit(),
+		InFlight: l.inFlight,
+		Queued:   len(l.waiters),
+		Accepted: l.accepted,
+		Shed:     l.shed,
+	}
+}
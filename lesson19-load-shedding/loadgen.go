@@ -0,0 +1,152 @@
+package lesson19
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// loadResult collects what happened during one load test run
+type loadResult struct {
+	mu            sync.Mutex
+	okLatencies   []time.Duration
+	shed          int
+	errors        int
+	healthLatency []time.Duration
+}
+
+// runLoadTests starts a server for each mode on a random port, hammers
+// it with more clients than the backend can serve, and prints latency
+// percentiles side by side
+func runLoadTests(w io.Writer, workers int, work time.Duration, clients int, duration time.Duration) {
+	fmt.Fprintf(w, "\n--- Load Test: %d clients, backend capacity %d x %v (%.0f req/s) ---\n",
+		clients, workers, work, float64(workers)/work.Seconds())
+
+	fmt.Fprintf(w, "\n%-9s %7s %7s %9s %9s %9s %12s\n", "mode", "ok", "shed", "p50", "p99", "max", "healthz p99")
+	for _, mode := range []string{"none", "static", "adaptive"} {
+		limiter, _ := newLimiterForMode(mode, targetLatency(work))
+		result := runLoadTest(newServerHandler(newBackend(workers, work), limiter), clients, duration)
+
+		fmt.Fprintf(w, "%-9s %7d %7d %9v %9v %9v %12v\n", mode,
+			len(result.okLatencies), result.shed,
+			percentile(result.okLatencies, 50), percentile(result.okLatencies, 99),
+			percentile(result.okLatencies, 100), percentile(result.healthLatency, 99))
+		if limiter != nil {
+			stats := limiter.Stats()
+			fmt.Fprintf(w, "%-9s final limit %d\n", "", stats.Limit)
+		}
+		if result.errors > 0 {
+			fmt.Fprintf(w, "%-9s %d requests failed outright\n", "", result.errors)
+		}
+	}
+
+	fmt.Fprintln(w, "\nWithout shedding every request waits in line, so latency grows with load.")
+	fmt.Fprintln(w, "With shedding the excess is rejected fast and accepted requests stay quick.")
+}
+
+func runLoadTest(handler http.Handler, clients int, duration time.Duration) *loadResult {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	defer server.Close()
+
+	baseURL := "http://" + listener.Addr().String()
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        clients + 1,
+			MaxIdleConnsPerHost: clients + 1,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	result := &loadResult{}
+	var wg sync.WaitGroup
+
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := time.Now()
+				status, err := fetch(client, baseURL+"/api/work")
+				elapsed := time.Since(start)
+
+				result.mu.Lock()
+				switch {
+				case err != nil:
+					result.errors++
+				case status == http.StatusOK:
+					result.okLatencies = append(result.okLatencies, elapsed)
+				case status == http.StatusServiceUnavailable:
+					result.shed++
+					result.mu.Unlock()
+					// Honor Retry-After in spirit without slowing the
+					// test down: back off briefly before trying again
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+				result.mu.Unlock()
+			}
+		}()
+	}
+
+	// A separate prober plays the orchestrator's health checks
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+				if _, err := fetch(client, baseURL+"/healthz"); err == nil {
+					result.mu.Lock()
+					result.healthLatency = append(result.healthLatency, time.Since(start))
+					result.mu.Unlock()
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+	return result
+}
+
+func fetch(client *http.Client, url string) (int, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// percentile returns the p-th percentile (0-100) rounded to 100µs
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(float64(len(sorted)-1) * p / 100)
+	return sorted[index].Round(100 * time.Microsecond)
+}
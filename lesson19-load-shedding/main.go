@@ -0,0 +1,222 @@
+// Lesson 19: Load Shedding and Adaptive Concurrency Limits
+// This lesson covers protecting a server from overload: capping in-flight
+// requests, a bounded queue with a timeout, letting health checks bypass
+// the limit, and an AIMD limiter that finds the right limit by itself
+
+package lesson19
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"golang-lab/lab/clock"
+)
+
+// APIResponse represents a standard API response
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ErrorResponse represents error response with details
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// clk is where the lesson gets the time; tests can swap in a clock.Fake
+// to step requests and queue timeouts through by hand
+var clk clock.Clock = clock.Real{}
+
+// backend simulates a resource with fixed capacity, like a database
+// connection pool or CPU cores: only `workers` requests make progress at a
+// time and the rest wait. Without shedding, that wait grows without limit.
+type backend struct {
+	slots chan struct{}
+	work  time.Duration
+}
+
+func newBackend(workers int, work time.Duration) *backend {
+	return &backend{slots: make(chan struct{}, workers), work: work}
+}
+
+func (b *backend) Do(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-b.slots }()
+
+	clk.Sleep(b.work)
+	return nil
+}
+
+// Run is the lesson's entry point; cmd/lesson19 calls it
+func Run() {
+	fmt.Println("=== Lesson 19: Load Shedding and Adaptive Concurrency Limits ===")
+
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	mode := flag.String("mode", "adaptive", "limiter: none, static, or adaptive")
+	workers := flag.Int("workers", 4, "simulated backend capacity")
+	work := flag.Duration("work", 20*time.Millisecond, "simulated time per request")
+	loadTest := flag.Bool("loadtest", false, "compare all modes under load and exit")
+	clients := flag.Int("clients", 64, "concurrent clients for -loadtest")
+	duration := flag.Duration("duration", 3*time.Second, "length of each -loadtest run")
+	flag.Parse()
+
+	if *loadTest {
+		runLoadTests(os.Stdout, *workers, *work, *clients, *duration)
+		return
+	}
+
+	limiter, err := newLimiterForMode(*mode, targetLatency(*work))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: newServerHandler(newBackend(*workers, *work), limiter),
+	}
+
+	fmt.Printf("\nStarting server in %s mode on http://localhost%s\n", *mode, *addr)
+	fmt.Println("Available endpoints:")
+	fmt.Println("  GET /api/work - Simulated work (shed under load)")
+	fmt.Println("  GET /healthz  - Health check (never shed)")
+	fmt.Println("  GET /stats    - Limiter state")
+	fmt.Println("\nRun with -loadtest to compare modes")
+	fmt.Println("Press Ctrl+C to stop the server")
+
+	log.Fatal(server.ListenAndServe())
+}
+
+// targetLatency is the adaptive limiter's idea of "fast enough": a little
+// above the uncontended time per request. Real services would use a
+// measured baseline or their latency SLO.
+func targetLatency(work time.Duration) time.Duration {
+	return work * 3 / 2
+}
+
+// newLimiterForMode returns nil for "none", meaning no shedding at all
+func newLimiterForMode(mode string, target time.Duration) (*Limiter, error) {
+	switch mode {
+	case "none":
+		return nil, nil
+	case "static":
+		return NewLimiter(LimiterConfig{
+			InitialLimit: 8,
+			MaxQueue:     16,
+			QueueTimeout: 50 * time.Millisecond,
+		}), nil
+	case "adaptive":
+		return NewLimiter(LimiterConfig{
+			InitialLimit:  8,
+			MaxQueue:      16,
+			QueueTimeout:  50 * time.Millisecond,
+			Adaptive:      true,
+			MinLimit:      2,
+			MaxLimit:      64,
+			TargetLatency: target,
+			Backoff:       0.9,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q (want none, static, or adaptive)", mode)
+	}
+}
+
+func newServerHandler(b *backend, limiter *Limiter) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/work", func(w http.ResponseWriter, r *http.Request) {
+		handleWork(w, r, b)
+	})
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		handleStats(w, r, limiter)
+	})
+
+	if limiter == nil {
+		return mux
+	}
+	return sheddingMiddleware(limiter, mux)
+}
+
+// Handlers
+
+func handleWork(w http.ResponseWriter, r *http.Request, b *backend) {
+	start := clk.Now()
+	if err := b.Do(r.Context()); err != nil {
+		// The client gave up; nobody will read this response
+		return
+	}
+	respondWithJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    map[string]string{"took": clk.Since(start).String()},
+	})
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request, limiter *Limiter) {
+	if limiter == nil {
+		respondWithJSON(w, http.StatusOK, APIResponse{Success: true, Message: "No limiter in this mode"})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, APIResponse{Success: true, Data: limiter.Stats()})
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	respondWithJSON(w, statusCode, ErrorResponse{Error: message})
+}
+
+// Middleware
+
+// isCritical marks requests that must never be shed. If health checks
+// were rejected under load, the orchestrator would restart a server that
+// is busy but healthy, making the overload worse.
+func isCritical(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/stats"
+}
+
+// sheddingMiddleware rejects requests the limiter has no room for with
+// 503 and Retry-After, so well-behaved clients back off
+func sheddingMiddleware(limiter *Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isCritical(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := limiter.Acquire(r.Context()); err != nil {
+			w.Header().Set("Retry-After", "1")
+			respondWithError(w, http.StatusServiceUnavailable, "Server overloaded: "+err.Error())
+			return
+		}
+
+		// Time only the work, not the wait in the queue: the limiter
+		// needs to know how the server is coping, not how long the line is.
+		// Deferred, so a handler that panics (net/http recovers it) still
+		// gives its slot back.
+		start := clk.Now()
+		defer func() { limiter.Release(clk.Since(start)) }()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+//go:build !solution
+
+// Package exercises holds the Lesson 20 exercises. Replace each TODO with
+// a real implementation, then check your work from the repository root:
+//
+//	go run ./cmd/golab verify lesson20
+package exercises
+
+import "golang-lab/lab/analysis"
+
+// Exercise 1: CountCalls parses src, a whole Go file, and counts the calls
+// in it by how the source spells the function: "fmt.Println", "add",
+// "r.URL.Query". types.ExprString spells an expression for you. Return
+// the parse error if src isn't valid Go.
+//
+//golab:require calls go/ast.Inspect
+func CountCalls(src string) (map[string]int, error) {
+	// TODO: parser.ParseFile, then ast.Inspect looking for *ast.CallExpr
+	return nil, nil
+}
+
+// Exercise 2: NoPanic reports every call of the builtin panic with the
+// message "call to panic; return an error instead". A function the
+// package declares itself that happens to be called panic doesn't count:
+// ask pass.TypesInfo.Uses whether the name is a *types.Builtin.
+var NoPanic = &analysis.Analyzer{
+	Name: "nopanic",
+	Doc:  "report calls to panic",
+	Run:  runNoPanic,
+}
+
+func runNoPanic(pass *analysis.Pass) {
+	// TODO: walk pass.Files with ast.Inspect and pass.Reportf each call
+}
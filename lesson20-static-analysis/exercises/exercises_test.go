@@ -0,0 +1,81 @@
+//go:build exercises
+
+package exercises
+
+import (
+	"reflect"
+	"testing"
+
+	"golang-lab/lab/analysis"
+)
+
+func TestCountCalls(t *testing.T) {
+	src := `package p
+
+import "fmt"
+
+func add(a, b int) int { return a + b }
+
+func main() {
+	fmt.Println(add(1, 2), add(3, 4))
+	fmt.Println(len("go"))
+}
+`
+	got, err := CountCalls(src)
+	if err != nil {
+		t.Fatalf("CountCalls error = %v", err)
+	}
+	want := map[string]int{"fmt.Println": 2, "add": 2, "len": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CountCalls = %v; want %v", got, want)
+	}
+
+	if _, err := CountCalls("package p\nfunc f() {"); err == nil {
+		t.Error("CountCalls of broken code returned no error")
+	}
+}
+
+func TestNoPanic(t *testing.T) {
+	src := `package p
+
+import "errors"
+
+func mustPositive(n int) int {
+	if n < 0 {
+		panic("negative")
+	}
+	return n
+}
+
+func check(n int) error {
+	if n < 0 {
+		return errors.New("negative")
+	}
+	return nil
+}
+
+type alarm struct{}
+
+func (alarm) panic() {}
+
+func ring(a alarm) {
+	a.panic()
+	defer func() { panic(recover()) }()
+}
+`
+	pkg, err := analysis.LoadSource("p.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, diagnostic := range analysis.Run([]*analysis.Package{pkg}, NoPanic) {
+		got = append(got, diagnostic.String())
+	}
+	want := []string{
+		"p.go:7:3: call to panic; return an error instead (nopanic)",
+		"p.go:25:17: call to panic; return an error instead (nopanic)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NoPanic reported:\n%q\nwant:\n%q", got, want)
+	}
+}
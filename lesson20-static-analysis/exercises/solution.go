@@ -0,0 +1,54 @@
+//go:build solution
+
+// Reference solutions for the Lesson 20 exercises, built instead of
+// exercises.go by golab verify --solutions. Try the exercises first!
+
+package exercises
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"golang-lab/lab/analysis"
+)
+
+//golab:require calls go/ast.Inspect
+func CountCalls(src string) (map[string]int, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "src.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			counts[types.ExprString(call.Fun)]++
+		}
+		return true
+	})
+	return counts, nil
+}
+
+var NoPanic = &analysis.Analyzer{
+	Name: "nopanic",
+	Doc:  "report calls to panic",
+	Run:  runNoPanic,
+}
+
+func runNoPanic(pass *analysis.Pass) {
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if id, ok := call.Fun.(*ast.Ident); ok {
+				if builtin, ok := pass.TypesInfo.Uses[id].(*types.Builtin); ok && builtin.Name() == "panic" {
+					pass.Reportf(call.Pos(), "call to panic; return an error instead")
+				}
+			}
+			return true
+		})
+	}
+}
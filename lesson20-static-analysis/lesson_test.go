@@ -0,0 +1,12 @@
+package lesson20
+
+import (
+	"testing"
+
+	"golang-lab/lab/golden"
+)
+
+// TestDemo compares everything the lesson prints with testdata/demo.golden
+func TestDemo(t *testing.T) {
+	golden.Demo(t, "demo.golden", Demo)
+}
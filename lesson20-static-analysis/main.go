@@ -0,0 +1,232 @@
+// Lesson 20: Static Analysis
+// This lesson covers reading Go code with go/ast and go/types, and writing vet-style checkers
+
+package lesson20
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang-lab/lab/analysis"
+)
+
+// sample is the code the lesson analyzes. It compiles, but a reviewer
+// would still have a few things to say about it.
+const sample = `package shop
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+func total(prices []string) int {
+	sum := 0
+	for _, p := range prices {
+		n, _ := strconv.Atoi(p)
+		sum += n
+	}
+	return sum
+}
+
+func receipt(items []string) string {
+	out := ""
+	for _, item := range items {
+		out += item + "\n"
+	}
+	return out
+}
+
+func save(path, text string) {
+	os.WriteFile(path, []byte(text), 0o644)
+}
+
+func handleTotal(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("total requested")
+	fmt.Fprintf(w, "%d\n", total(r.URL.Query()["price"]))
+}
+`
+
+// Run is the lesson's entry point; cmd/lesson20 calls it
+func Run() {
+	Demo(os.Stdout)
+}
+
+// Demo prints the lesson's examples to w, so tests can check them
+func Demo(w io.Writer) {
+	fmt.Fprintln(w, "=== Lesson 20: Static Analysis ===")
+
+	fmt.Fprintln(w, "\n--- Parsing ---")
+	file := demonstrateParsing(w)
+
+	fmt.Fprintln(w, "\n--- Walking the Syntax Tree ---")
+	demonstrateInspect(w, file)
+
+	fmt.Fprintln(w, "\n--- Type Information ---")
+	demonstrateTypes(w)
+
+	fmt.Fprintln(w, "\n--- Analyzers ---")
+	demonstrateAnalyzers(w)
+}
+
+// demonstrateParsing turns source text into a syntax tree
+func demonstrateParsing(w io.Writer) *ast.File {
+	// The FileSet maps token.Pos values, which are just numbers, back to
+	// file:line:column
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "shop.go", sample, 0)
+	if err != nil {
+		fmt.Fprintf(w, "parse error: %v\n", err)
+		return nil
+	}
+
+	fmt.Fprintf(w, "package %s\n", file.Name.Name)
+	for _, spec := range file.Imports {
+		fmt.Fprintf(w, "imports %s\n", spec.Path.Value)
+	}
+	// Top-level declarations are the file's children
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			var params []string
+			for _, field := range fn.Type.Params.List {
+				for _, name := range field.Names {
+					params = append(params, name.Name)
+				}
+			}
+			fmt.Fprintf(w, "func %s(%s) at %s\n", fn.Name.Name, strings.Join(params, ", "), fset.Position(fn.Pos()))
+		}
+	}
+
+	// Syntax errors come back with positions, just like the compiler's
+	_, err = parser.ParseFile(fset, "broken.go", "package broken\nfunc f() {", 0)
+	fmt.Fprintf(w, "parsing broken code: %v\n", err)
+	return file
+}
+
+// demonstrateInspect visits every node in the tree with ast.Inspect
+func demonstrateInspect(w io.Writer, file *ast.File) {
+	if file == nil {
+		return
+	}
+	kinds := make(map[string]int)
+	var calls []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		kinds[strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")]++
+		if call, ok := n.(*ast.CallExpr); ok {
+			calls = append(calls, types.ExprString(call.Fun))
+		}
+		return true // false would skip this node's children
+	})
+
+	fmt.Fprintf(w, "calls, in order: %s\n", strings.Join(calls, ", "))
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprint(w, "node counts:")
+	for i, name := range names {
+		if i%4 == 0 {
+			fmt.Fprint(w, "\n ")
+		}
+		fmt.Fprintf(w, " %s=%d", name, kinds[name])
+	}
+	fmt.Fprintln(w)
+}
+
+// demonstrateTypes asks go/types what the syntax alone can't say: which
+// function a name refers to and what it returns
+func demonstrateTypes(w io.Writer) {
+	pkg, err := analysis.LoadSource("shop.go", sample)
+	if err != nil {
+		fmt.Fprintf(w, "type error: %v\n", err)
+		return
+	}
+
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			// The syntax only knows a call's name; the type checker knows
+			// which package it comes from and what it returns. Conversions
+			// look like calls in the tree, but the "function" is a type.
+			name := types.ExprString(call.Fun)
+			switch tv := pkg.Info.Types[call.Fun]; {
+			case tv.IsType():
+				fmt.Fprintf(w, "%-20s conversion to %s\n", name, tv.Type)
+			case !tv.IsBuiltin():
+				fmt.Fprintf(w, "%-20s %s\n", name, types.TypeString(tv.Type, types.RelativeTo(pkg.Types)))
+			}
+			return true
+		})
+	}
+}
+
+// ConcatInLoop is an analyzer written in this lesson: it reports string
+// += inside loops, which copies the whole string every time round. Use a
+// strings.Builder instead.
+var ConcatInLoop = &analysis.Analyzer{
+	Name: "concatinloop",
+	Doc:  "report strings built with += inside loops",
+	Run:  runConcatInLoop,
+}
+
+func runConcatInLoop(pass *analysis.Pass) {
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			var body *ast.BlockStmt
+			switch loop := n.(type) {
+			case *ast.ForStmt:
+				body = loop.Body
+			case *ast.RangeStmt:
+				body = loop.Body
+			default:
+				return true
+			}
+			ast.Inspect(body, func(n ast.Node) bool {
+				assign, ok := n.(*ast.AssignStmt)
+				if !ok || assign.Tok != token.ADD_ASSIGN {
+					return true
+				}
+				// sum += n is fine; only strings are copied
+				if basic, ok := pass.TypesInfo.TypeOf(assign.Lhs[0]).Underlying().(*types.Basic); ok && basic.Info()&types.IsString != 0 {
+					pass.Reportf(assign.Pos(), "string concatenation in a loop; use a strings.Builder")
+				}
+				return true
+			})
+			return false // the inner walk covered nested loops
+		})
+	}
+}
+
+// demonstrateAnalyzers runs golab vet's analyzers and this lesson's own
+// over the sample, the same way go vet runs its checks
+func demonstrateAnalyzers(w io.Writer) {
+	pkg, err := analysis.LoadSource("shop.go", sample)
+	if err != nil {
+		fmt.Fprintf(w, "type error: %v\n", err)
+		return
+	}
+
+	analyzers := append([]*analysis.Analyzer{ConcatInLoop}, analysis.All...)
+	for _, analyzer := range analyzers {
+		fmt.Fprintf(w, "%-14s %s\n", analyzer.Name, analyzer.Doc)
+	}
+	fmt.Fprintln(w)
+	for _, diagnostic := range analysis.Run([]*analysis.Package{pkg}, analyzers...) {
+		fmt.Fprintln(w, diagnostic)
+	}
+}
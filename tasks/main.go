@@ -0,0 +1,198 @@
+// Command tasks runs the repository's chores. They are written in Go rather
+// than make or shell, so they work the same on Windows, macOS and Linux:
+//
+//	go run ./tasks               # list the tasks
+//	go run ./tasks build
+//	go run ./tasks testall
+//	go run ./tasks runlesson 08
+//	go run ./tasks bench
+//	go run ./tasks clean
+//
+// Each task is an exported function below; add one to the tasks table to
+// make it runnable. Names are matched without regard to case.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// binDir is where Build puts the commands it compiles
+const binDir = "bin"
+
+// task is one chore and how to describe it in the list
+type task struct {
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var tasks = map[string]task{
+	"build":     {"build", "compile every package and put golab and the lessons in bin/", noArgs(Build)},
+	"testall":   {"testall", "vet, test, check the reference solutions pass and smoke test lessons 09 and 10", noArgs(TestAll)},
+	"runlesson": {"runlesson <lesson> [-- lesson flags]", "run one lesson through golab", RunLesson},
+	"bench":     {"bench [packages...]", "run the benchmarks (default: all)", Bench},
+	"clean":     {"clean", "remove build output, lesson data and the test cache", noArgs(Clean)},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printTasks()
+		return
+	}
+
+	name := strings.ToLower(os.Args[1])
+	t, ok := tasks[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "tasks: unknown task %q\n\n", os.Args[1])
+		printTasks()
+		os.Exit(2)
+	}
+	root, err := findRoot()
+	if err == nil {
+		err = os.Chdir(root)
+	}
+	if err == nil {
+		err = t.run(os.Args[2:])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tasks %s: %v\n", name, err)
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.ExitCode())
+		}
+		os.Exit(1)
+	}
+}
+
+func printTasks() {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Usage: go run ./tasks <task> [args]")
+	fmt.Println("\nTasks:")
+	for _, name := range names {
+		fmt.Printf("  %-40s %s\n", tasks[name].usage, tasks[name].summary)
+	}
+}
+
+// Build compiles every package, then puts golab and each lesson's command
+// in bin/, with .exe on Windows
+func Build() error {
+	if err := run("go", "build", "./..."); err != nil {
+		return err
+	}
+	commands, err := filepath.Glob(filepath.Join("cmd", "*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range commands {
+		binary := filepath.Join(binDir, filepath.Base(dir))
+		if runtime.GOOS == "windows" {
+			binary += ".exe"
+		}
+		if err := run("go", "build", "-o", binary, "./"+filepath.ToSlash(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestAll runs the same checks as a pull request: go vet, go test, the
+// exercise tests and golab vet against the reference solutions, and the
+// smoke tests of server lessons 09 and 10
+func TestAll() error {
+	steps := [][]string{
+		{"go", "vet", "./..."},
+		{"go", "test", "./..."},
+		{"go", "run", "./cmd/golab", "verify", "--solutions"},
+		{"go", "run", "./cmd/golab", "vet", "--solutions"},
+		{"go", "run", "./cmd/lesson09", "-ci"},
+		{"go", "run", "./cmd/lesson10", "-ci"},
+	}
+	for _, step := range steps {
+		if err := run(step[0], step[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunLesson runs a lesson with golab run, which also picks a free port
+// for server lessons. Arguments after the lesson go to golab run.
+func RunLesson(args []string) error {
+	if len(args) == 0 {
+		return errors.New("which lesson? e.g. go run ./tasks runlesson 08")
+	}
+	return run("go", append([]string{"run", "./cmd/golab", "run"}, args...)...)
+}
+
+// Bench runs every benchmark, or those in the given packages, with
+// allocation counts and without the ordinary tests
+func Bench(args []string) error {
+	if len(args) == 0 {
+		args = []string{"./..."}
+	}
+	return run("go", append([]string{"test", "-run", "^$", "-bench", ".", "-benchmem"}, args...)...)
+}
+
+// Clean removes what builds and lessons leave behind: bin/, a golab
+// binary built in the root, the data/ and certs/ directories lessons 12
+// and 17 create, and the test cache
+func Clean() error {
+	for _, path := range []string{binDir, "golab", "golab.exe", "data", "certs"} {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		fmt.Printf("tasks: removing %s\n", path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return run("go", "clean", "-testcache")
+}
+
+// run echoes and runs a command, connected to the terminal
+func run(name string, args ...string) error {
+	fmt.Printf("tasks: %s %s\n", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func noArgs(f func() error) func([]string) error {
+	return func(args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+		}
+		return f()
+	}
+}
+
+// findRoot walks up from the working directory to the go.mod, so tasks
+// can be run from any subdirectory
+func findRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no go.mod found; run tasks from inside the repository")
+		}
+		dir = parent
+	}
+}